@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/GrainedLotus515/gobard/internal/config"
+	"github.com/GrainedLotus515/gobard/internal/doctor"
+	"github.com/GrainedLotus515/gobard/internal/logger"
+)
+
+// runDoctor checks the bot's dependencies and settings, printing a checklist, and returns
+// the exit code: 1 if a critical check failed
+func runDoctor(args []string) int {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	configPath := flags.String("config", os.Getenv("GOBARD_CONFIG"), "YAML or TOML config file; environment variables override it")
+	encode := flags.Bool("encode", false, "also encode a test tone to check FFmpeg and libopus end to end")
+	flags.Parse(args)
+
+	// The checklist says everything worth saying
+	logger.SetLevel("error")
+
+	cfg, err := config.Inspect(*configPath)
+	results := doctor.Run(cfg, err, doctor.Options{Encode: *encode})
+	if !doctor.Print(os.Stdout, results) {
+		return 1
+	}
+	return 0
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"flag"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/GrainedLotus515/gobard/internal/bot"
@@ -12,19 +14,44 @@ import (
 )
 
 func main() {
+	// Variables set before .env is read win over it, on reloads too
+	inherited := make(map[string]bool)
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		inherited[name] = true
+	}
+
 	// Load .env file (optional, won't error if not present)
 	if err := godotenv.Load(); err != nil {
 		logger.Debug("No .env file found, using environment variables")
 	}
 
-	// Load configuration from environment
-	cfg, err := config.Load()
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		os.Exit(runDoctor(os.Args[2:]))
+	}
+
+	configPath := flag.String("config", os.Getenv("GOBARD_CONFIG"), "YAML or TOML config file; environment variables override it")
+	flag.Parse()
+
+	// Load configuration from the config file if given, else from the environment
+	loadConfig := config.Load
+	if *configPath != "" {
+		loadConfig = func() (*config.Config, error) {
+			return config.LoadFromFile(*configPath)
+		}
+	}
+	cfg, err := loadConfig()
 	if err != nil {
 		logger.Fatal("Failed to load configuration", "err", err)
 	}
 
-	// Set debug mode based on config
-	logger.SetDebugMode(cfg.Debug)
+	// Apply the log settings; DEBUG=true still forces debug logs
+	if err := logger.SetFormat(cfg.LogFormat); err != nil {
+		logger.Fatal("Invalid log format", "err", err)
+	}
+	if err := logger.SetLevel(cfg.EffectiveLogLevel()); err != nil {
+		logger.Fatal("Invalid log level", "err", err)
+	}
 
 	// Create bot instance
 	b, err := bot.New(cfg)
@@ -32,16 +59,34 @@ func main() {
 		logger.Fatal("Failed to create bot", "err", err)
 	}
 
+	b.SetConfigLoader(func() (*config.Config, error) {
+		rereadDotenv(inherited)
+		return loadConfig()
+	})
+
 	// Start the bot
 	if err := b.Start(); err != nil {
 		logger.Fatal("Failed to start bot", "err", err)
 	}
 
-	// Wait for interrupt signal
+	// Wait for interrupt signal, reloading the configuration on SIGHUP
 	logger.Info("Bot is running. Press CTRL-C to exit.")
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-sc
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			logger.Info("Reloading configuration")
+			if _, err := b.Reload(); err != nil {
+				logger.Error("Configuration reload failed; keeping the running settings", "err", err)
+			}
+		}
+	}()
+	select {
+	case <-sc:
+	case <-b.ShutdownRequested():
+	}
 
 	// Graceful shutdown
 	logger.Info("Shutting down...")
@@ -51,3 +96,17 @@ func main() {
 
 	logger.Info("Goodbye! 👋")
 }
+
+// rereadDotenv applies edits to .env before a reload, leaving alone the variables that were
+// set before it was first read
+func rereadDotenv(inherited map[string]bool) {
+	values, err := godotenv.Read()
+	if err != nil {
+		return
+	}
+	for name, value := range values {
+		if !inherited[name] {
+			os.Setenv(name, value)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package applemusic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/GrainedLotus515/gobard/internal/webmeta"
+)
+
+// ErrUnreadable is returned when a link's page doesn't say what's on it
+var ErrUnreadable = errors.New("couldn't read that Apple Music link")
+
+// httpClient fetches Apple Music pages; tests swap its transport
+var httpClient = &http.Client{}
+
+var (
+	countryPattern = regexp.MustCompile(`^[a-z]{2}$`)
+	idPattern      = regexp.MustCompile(`^[0-9]+$`)
+	playlistID     = regexp.MustCompile(`^pl\.[A-Za-z0-9.-]+$`)
+	// titleBy matches og:title forms like "Song - Song by Artist - Apple Music" and
+	// "Song by Artist on Apple Music"
+	titleBy = regexp.MustCompile(`^(.+?)(?: - (?:Song|Single|EP|Album|Playlist))? by (.+?)(?: - Apple Music| on Apple Music)?$`)
+)
+
+// Link is a parsed Apple Music link
+type Link struct {
+	Type    string // song, album or playlist
+	ID      string
+	Country string // Storefront the link was shared from, e.g. "us"
+}
+
+// URL returns the page for the link
+// The name slug Apple puts in links is optional, so it is left out
+func (l Link) URL() string {
+	return fmt.Sprintf("https://music.apple.com/%s/%s/%s", l.Country, l.Type, l.ID)
+}
+
+// IsURL reports whether a link is on an Apple Music host
+func IsURL(raw string) bool {
+	u, err := neturl.Parse(strings.TrimSpace(raw))
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && isHost(u.Hostname())
+}
+
+// isHost reports whether host serves Apple Music pages
+func isHost(host string) bool {
+	switch strings.ToLower(host) {
+	case "music.apple.com", "geo.music.apple.com", "itunes.apple.com":
+		return true
+	}
+	return false
+}
+
+// ParseURL parses an Apple Music song, album or playlist link
+// Album links with an i= parameter point at one of the album's songs, and are read as that song
+func ParseURL(raw string) (Link, error) {
+	u, err := neturl.Parse(strings.TrimSpace(raw))
+	if err != nil || !isHost(u.Hostname()) {
+		return Link{}, fmt.Errorf("invalid Apple Music URL")
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	link := Link{Country: "us"}
+	if len(segments) > 0 && countryPattern.MatchString(segments[0]) {
+		link.Country, segments = segments[0], segments[1:]
+	}
+	// The last segment is the ID; a name slug may come before it
+	if len(segments) < 2 || len(segments) > 3 {
+		return Link{}, fmt.Errorf("invalid Apple Music URL")
+	}
+	link.Type, link.ID = segments[0], segments[len(segments)-1]
+
+	switch link.Type {
+	case "album":
+		if song := u.Query().Get("i"); idPattern.MatchString(song) {
+			link.Type, link.ID = "song", song
+		}
+		fallthrough
+	case "song":
+		if !idPattern.MatchString(link.ID) {
+			return Link{}, fmt.Errorf("invalid Apple Music ID %q", link.ID)
+		}
+	case "playlist":
+		if !playlistID.MatchString(link.ID) {
+			return Link{}, fmt.Errorf("invalid Apple Music playlist ID %q", link.ID)
+		}
+	default:
+		return Link{}, fmt.Errorf("unsupported Apple Music link type %q", link.Type)
+	}
+	return link, nil
+}
+
+// GetTracks reads the song, album or playlist a link points at from its page
+func GetTracks(ctx context.Context, raw string) (*webmeta.Import, error) {
+	link, err := ParseURL(raw)
+	if err != nil {
+		return nil, err
+	}
+	page, err := webmeta.Fetch(ctx, httpClient, link.URL(), isHost)
+	if err != nil {
+		logger.Debug("Failed to fetch Apple Music page", "url", link.URL(), "err", err)
+		return nil, fmt.Errorf("%w: %w", ErrUnreadable, err)
+	}
+	return fromPage(link, page)
+}
+
+// fromPage builds tracks from a fetched page
+// Song pages are read from their JSON-LD, falling back to OpenGraph tags; album and playlist
+// track lists only appear in the JSON-LD
+func fromPage(link Link, page *webmeta.Page) (*webmeta.Import, error) {
+	if link.Type == "song" {
+		recording := webmeta.Recording{}
+		if len(page.Recordings) > 0 {
+			recording = page.Recordings[0]
+		}
+		if recording.Title == "" || recording.Artist == "" {
+			title, artist := splitTitle(page.Get("og:title", "twitter:title"))
+			if recording.Title == "" {
+				recording.Title = page.Get("apple:title")
+			}
+			if recording.Title == "" {
+				recording.Title = title
+			}
+			if recording.Artist == "" {
+				recording.Artist = artist
+			}
+		}
+		if recording.Duration == 0 {
+			if seconds, err := strconv.Atoi(page.Get("music:song:duration", "music:duration")); err == nil {
+				recording.Duration = time.Duration(seconds) * time.Second
+			}
+		}
+		if recording.Title == "" || recording.Artist == "" {
+			return nil, ErrUnreadable
+		}
+
+		track := newTrack(link.ID, link.URL(), recording)
+		track.Thumbnail = page.Get("og:image")
+		return &webmeta.Import{Tracks: []*player.Track{track}}, nil
+	}
+
+	if len(page.Recordings) == 0 {
+		return nil, ErrUnreadable
+	}
+	result := &webmeta.Import{Title: page.Collection, Owner: page.Owner}
+	if result.Title == "" {
+		result.Title, _ = splitTitle(page.Get("og:title"))
+	}
+	thumbnail := page.Get("og:image")
+	for _, recording := range page.Recordings {
+		// Without the song's ID its match can't be remembered
+		id, url := "", link.URL()
+		if song, err := ParseURL(recording.URL); err == nil && song.Type == "song" {
+			id, url = song.ID, song.URL()
+		}
+		track := newTrack(id, url, recording)
+		track.Thumbnail = thumbnail
+		result.Tracks = append(result.Tracks, track)
+	}
+	return result, nil
+}
+
+// newTrack creates a track to be matched on YouTube
+func newTrack(id, url string, recording webmeta.Recording) *player.Track {
+	return &player.Track{
+		ID:       id,
+		Title:    recording.Title,
+		Artist:   recording.Artist,
+		URL:      url,
+		Duration: recording.Duration,
+		Source:   player.SourceAppleMusic,
+	}
+}
+
+// splitTitle splits an og:title into a name and artist; the artist is empty if it isn't named
+func splitTitle(title string) (string, string) {
+	if m := titleBy.FindStringSubmatch(title); m != nil {
+		return strings.TrimSpace(m[1]), strings.TrimSpace(m[2])
+	}
+	title = strings.TrimSuffix(strings.TrimSuffix(title, " on Apple Music"), " - Apple Music")
+	return strings.TrimSpace(title), ""
+}
@@ -0,0 +1,136 @@
+package applemusic
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    Link
+		wantErr bool
+	}{
+		{name: "song", raw: "https://music.apple.com/us/song/blinding-lights/1488408568", want: Link{Type: "song", ID: "1488408568", Country: "us"}},
+		{name: "song without slug", raw: "https://music.apple.com/gb/song/1488408568", want: Link{Type: "song", ID: "1488408568", Country: "gb"}},
+		{name: "song in album", raw: "https://music.apple.com/us/album/after-hours/1499378108?i=1499378615", want: Link{Type: "song", ID: "1499378615", Country: "us"}},
+		{name: "album", raw: "https://music.apple.com/us/album/abbey-road-remastered/1441164359", want: Link{Type: "album", ID: "1441164359", Country: "us"}},
+		{name: "playlist", raw: "https://music.apple.com/us/playlist/todays-hits/pl.f4d106fed2bd41149aaacabb233eb5eb", want: Link{Type: "playlist", ID: "pl.f4d106fed2bd41149aaacabb233eb5eb", Country: "us"}},
+		{name: "no country", raw: "https://music.apple.com/album/abbey-road/1441164359", want: Link{Type: "album", ID: "1441164359", Country: "us"}},
+		{name: "legacy host", raw: "https://itunes.apple.com/us/album/abbey-road/1441164359", want: Link{Type: "album", ID: "1441164359", Country: "us"}},
+		{name: "artist", raw: "https://music.apple.com/us/artist/the-beatles/136975", wantErr: true},
+		{name: "bad ID", raw: "https://music.apple.com/us/album/abbey-road/abc", wantErr: true},
+		{name: "other host", raw: "https://music.apple.com.evil.example/us/song/x/1488408568", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseURL(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseURL(%q) = %+v; want an error", tt.raw, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseURL(%q) = %+v, %v; want %+v", tt.raw, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// fixtureTransport serves saved pages by path
+type fixtureTransport map[string]string
+
+func (f fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	file, ok := f[req.URL.Path]
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found", Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+	}
+	body, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: io.NopCloser(strings.NewReader(string(body))), Request: req}, nil
+}
+
+// serveFixtures makes httpClient serve the given pages for the rest of the test
+func serveFixtures(t *testing.T, pages fixtureTransport) {
+	t.Helper()
+	old := httpClient
+	httpClient = &http.Client{Transport: pages}
+	t.Cleanup(func() { httpClient = old })
+}
+
+func TestGetTracksSong(t *testing.T) {
+	serveFixtures(t, fixtureTransport{"/us/song/1499378615": "testdata/song.html"})
+
+	result, err := GetTracks(context.Background(), "https://music.apple.com/us/album/after-hours/1499378108?i=1499378615")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Title != "" || len(result.Tracks) != 1 {
+		t.Fatalf("GetTracks = %+v, want one song", result)
+	}
+	track := result.Tracks[0]
+	if track.Title != "Blinding Lights" || track.Artist != "The Weeknd" || track.Duration != 200*time.Second || track.ID != "1499378615" {
+		t.Errorf("track = %+v", track)
+	}
+	if !track.NeedsMatch() {
+		t.Error("Apple Music track doesn't need a YouTube match")
+	}
+}
+
+func TestGetTracksAlbum(t *testing.T) {
+	serveFixtures(t, fixtureTransport{"/us/album/1441164359": "testdata/album.html"})
+
+	result, err := GetTracks(context.Background(), "https://music.apple.com/us/album/abbey-road-remastered/1441164359")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Title != "Abbey Road (Remastered)" || result.Owner != "The Beatles" {
+		t.Errorf("album = %q by %q", result.Title, result.Owner)
+	}
+
+	want := []struct {
+		id, title string
+		duration  time.Duration
+	}{
+		{"1441164426", "Come Together", 260 * time.Second},
+		{"1441164430", "Something", 183 * time.Second},
+		{"", "Maxwell's Silver Hammer", 207 * time.Second},
+	}
+	if len(result.Tracks) != len(want) {
+		t.Fatalf("got %d tracks, want %d", len(result.Tracks), len(want))
+	}
+	for i, w := range want {
+		track := result.Tracks[i]
+		if track.ID != w.id || track.Title != w.title || track.Artist != "The Beatles" || track.Duration != w.duration {
+			t.Errorf("track %d = %+v, want %+v", i, track, w)
+		}
+	}
+}
+
+func TestGetTracksUnreadable(t *testing.T) {
+	serveFixtures(t, fixtureTransport{"/us/song/1488408568": "testdata/unavailable.html"})
+
+	for _, link := range []string{
+		"https://music.apple.com/us/song/blinding-lights/1488408568",
+		"https://music.apple.com/us/song/gone/1111111111",
+	} {
+		_, err := GetTracks(context.Background(), link)
+		if !errors.Is(err, ErrUnreadable) {
+			t.Errorf("GetTracks(%q) error = %v, want ErrUnreadable", link, err)
+		}
+		if err != nil && !strings.HasPrefix(err.Error(), "couldn't read that Apple Music link") {
+			t.Errorf("GetTracks(%q) error = %q", link, err)
+		}
+	}
+}
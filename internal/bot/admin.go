@@ -0,0 +1,156 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/bwmarrin/discordgo"
+)
+
+// handleAdmin handles the bot owner's /admin commands, which act on the whole bot rather than
+// one server
+func (b *Bot) handleAdmin(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	s := b.Session
+	// Discord shows the command to every server admin, so check ownership here
+	if err := b.requireOwner(s, i, "use /admin"); err != nil {
+		return err
+	}
+
+	subCmd, err := subcommand(i.ApplicationCommandData().Options)
+	if err != nil {
+		return err
+	}
+	action := subCmd.Name
+	if subCmd.Type == discordgo.ApplicationCommandOptionSubCommandGroup {
+		if subCmd, err = subcommand(subCmd.Options); err != nil {
+			return err
+		}
+		action += " " + subCmd.Name
+	}
+	logger.Info("Admin command", "user", i.Member.User.ID, "action", action, "guild", i.GuildID)
+
+	switch action {
+	case "status":
+		b.respondEphemeralEmbed(r, i, b.statusEmbed(s))
+
+	case "guilds":
+		b.respondEphemeralEmbed(r, i, guildListEmbed(stateGuilds(s)))
+
+	case "reload-config":
+		result, err := b.Reload()
+		if err != nil {
+			return fmt.Errorf("reload failed, keeping the running settings: %w", err)
+		}
+		b.respondEphemeral(r, i, reloadSummary(result))
+
+	case "cache prune":
+		message, err := b.pruneCache(subCmd.Options)
+		if err != nil {
+			return err
+		}
+		b.respondEphemeral(r, i, message)
+
+	case "leave-guild":
+		guildID, ok := getStringOption(subCmd.Options, "id")
+		if !ok {
+			return missingOption("id")
+		}
+		guildID = strings.TrimSpace(guildID)
+		guild, err := s.State.Guild(guildID)
+		if err != nil {
+			return fmt.Errorf("the bot isn't in a server with ID %s", guildID)
+		}
+		// The reply can't be sent once the bot has left the server it was asked in
+		if guild.ID == i.GuildID {
+			b.respondEphemeral(r, i, fmt.Sprintf("👋 Leaving **%s**", guild.Name))
+		}
+		if err := s.GuildLeave(guild.ID); err != nil {
+			return fmt.Errorf("failed to leave %s: %w", guild.Name, err)
+		}
+		logger.Info("Left server", "guild", guild.ID, "name", guild.Name, "user", i.Member.User.ID)
+		if guild.ID != i.GuildID {
+			b.respondEphemeral(r, i, fmt.Sprintf("👋 Left **%s**", guild.Name))
+		}
+
+	case "set-log-level":
+		level, ok := getStringOption(subCmd.Options, "level")
+		if !ok {
+			return missingOption("level")
+		}
+		if err := logger.SetLevel(level); err != nil {
+			return err
+		}
+		b.respondEphemeral(r, i, fmt.Sprintf("✅ Log level set to %s until the next restart or a reload that changes LOG_LEVEL", level))
+
+	case "shutdown":
+		b.respondEphemeral(r, i, "👋 Shutting down…")
+		b.requestShutdown()
+
+	default:
+		return i18n.Error("error.unknown_subcommand")
+	}
+	return nil
+}
+
+// requireOwner returns an error naming what only the bot's owner may do if the invoking user
+// doesn't own the bot
+func (b *Bot) requireOwner(s *discordgo.Session, i *discordgo.InteractionCreate, what string) error {
+	if i.Member == nil || i.Member.User == nil {
+		return fmt.Errorf("only the bot's owner can %s", what)
+	}
+	owner, err := b.isOwner(s, i.Member.User.ID)
+	if err != nil {
+		return err
+	}
+	if !owner {
+		logger.Warn("Refused an owner-only command", "user", i.Member.User.ID, "guild", i.GuildID)
+		return fmt.Errorf("only the bot's owner can %s", what)
+	}
+	return nil
+}
+
+// statusEmbed shows the players, memory use and goroutines of the running bot
+func (b *Bot) statusEmbed(s *discordgo.Session) *discordgo.MessageEmbed {
+	players := b.PlayerManager.Players()
+	playing := 0
+	for _, p := range players {
+		if p.IsPlaying() {
+			playing++
+		}
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	embed := &discordgo.MessageEmbed{
+		Title: "🔧 Bot Status",
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Uptime", Value: formatDuration(time.Since(b.startedAt)), Inline: true},
+			{Name: "Servers", Value: fmt.Sprintf("%d", len(stateGuilds(s))), Inline: true},
+			{Name: "Players", Value: fmt.Sprintf("%d, %d playing", len(players), playing), Inline: true},
+			{Name: "Memory", Value: fmt.Sprintf("%d MB in use, %d MB from the OS", mem.HeapAlloc>>20, mem.Sys>>20), Inline: true},
+			{Name: "Goroutines", Value: fmt.Sprintf("%d", runtime.NumGoroutine()), Inline: true},
+			{Name: "Go", Value: runtime.Version(), Inline: true},
+		},
+		Color: 0x0099ff,
+	}
+	if s.ShardCount > 1 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Shard", Value: fmt.Sprintf("%d of %d", s.ShardID, s.ShardCount), Inline: true})
+	}
+	return embed
+}
+
+// requestShutdown asks main to stop the bot, as a signal would
+func (b *Bot) requestShutdown() {
+	b.shutdownOnce.Do(func() { close(b.shutdown) })
+}
+
+// ShutdownRequested is closed when the bot's owner asks it to shut down with /admin shutdown
+func (b *Bot) ShutdownRequested() <-chan struct{} {
+	return b.shutdown
+}
@@ -0,0 +1,240 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// auditStoreFile is where servers' audit channels are kept, relative to the cache directory
+	auditStoreFile = "guilds/audit.json"
+	// auditFlushDelay is how long audit lines are collected before being posted together,
+	// so a burst of commands is one message rather than many
+	auditFlushDelay = 3 * time.Second
+	// auditMessageLimit is the most characters posted in one audit message, Discord's limit
+	auditMessageLimit = 2000
+)
+
+// auditedCommands are the commands that change a server's playback, queue or settings
+var auditedCommands = map[string]bool{
+	"play": true, "pause": true, "resume": true, "skip": true, "stop": true, "clear": true,
+	"disconnect": true, "shuffle": true, "loop": true, "volume": true, "seek": true,
+	"trackvolume": true, "fseek": true, "skipchapter": true, "abloop": true, "filter": true, "move": true,
+	"remove": true, "config": true, "fav": true, "queue": true, "sfx": true, "blocklist": true,
+}
+
+// unauditedSubcommands are subcommands of audited commands that only show something
+var unauditedSubcommands = map[string]bool{
+	"filter show":    true,
+	"blocklist show": true,
+	"config show":    true,
+	"fav add":        true,
+	"fav list":       true,
+	"fav remove":     true,
+	"queue show":     true,
+	"sfx list":       true,
+}
+
+// auditLog collects audit lines per server and posts them in batches
+type auditLog struct {
+	mu      sync.Mutex
+	pending map[string][]string // Lines waiting to be posted, by guild ID
+	muted   map[string]bool     // Guilds whose audit channel the bot can't post in
+}
+
+// auditEntry is an audited command being run
+type auditEntry struct {
+	channelID string
+	// queued are the tracks queued before /play or /fav play ran, to tell which ones it added
+	queued map[*player.Track]bool
+}
+
+// beginAudit returns the audit entry for a command about to run, or nil if it isn't audited
+// on this server
+func (b *Bot) beginAudit(i *discordgo.InteractionCreate, name string) *auditEntry {
+	if b.auditChannels == nil || !auditedCommands[name] {
+		return nil
+	}
+	if unauditedSubcommands[name+" "+subcommandName(i.ApplicationCommandData().Options)] {
+		return nil
+	}
+	channelID, ok := b.auditChannels.Get(i.GuildID)
+	if !ok {
+		return nil
+	}
+
+	entry := &auditEntry{channelID: channelID}
+	if name == "play" || name == "fav" {
+		snapshot := b.PlayerManager.GetPlayer(i.GuildID).Queue.Snapshot()
+		entry.queued = make(map[*player.Track]bool, len(snapshot.Upcoming)+1)
+		entry.queued[snapshot.Current] = true
+		for _, track := range snapshot.Upcoming {
+			entry.queued[track] = true
+		}
+	}
+	return entry
+}
+
+// finishAudit records an audited command that succeeded
+func (b *Bot) finishAudit(i *discordgo.InteractionCreate, name string, entry *auditEntry) {
+	line := fmt.Sprintf("<t:%d:T> <@%s> /%s", time.Now().Unix(), i.Member.User.ID, name)
+	if args := commandArgs(i.ApplicationCommandData().Options); args != "" {
+		line += " " + args
+	}
+	if entry.queued != nil {
+		line += " → " + b.addedTracks(i, entry)
+	}
+	b.audit.add(b.Session, i.GuildID, entry.channelID, line)
+}
+
+// addedTracks describes the tracks /play or /fav play added: the title of a single track, or how many
+func (b *Bot) addedTracks(i *discordgo.InteractionCreate, entry *auditEntry) string {
+	var added []*player.Track
+	snapshot := b.PlayerManager.GetPlayer(i.GuildID).Queue.Snapshot()
+	for _, track := range append([]*player.Track{snapshot.Current}, snapshot.Upcoming...) {
+		if track != nil && !entry.queued[track] && track.RequestedBy == i.Member.User.ID {
+			added = append(added, track)
+		}
+	}
+	if len(added) == 1 {
+		return "**" + added[0].Title + "**"
+	}
+	return i18n.T(b.guildLocale(i.GuildID), "audit.tracks", "count", len(added))
+}
+
+// auditChannelText names a server's audit channel for /config show
+func (b *Bot) auditChannelText(guildID, locale string) string {
+	if b.auditChannels != nil {
+		if channelID, ok := b.auditChannels.Get(guildID); ok {
+			return "<#" + channelID + ">"
+		}
+	}
+	return i18n.T(locale, "config.audit_none")
+}
+
+// subcommandName returns the name of the subcommand a command was run with, or ""
+func subcommandName(options []*discordgo.ApplicationCommandInteractionDataOption) string {
+	if sub, err := subcommand(options); err == nil {
+		return sub.Name
+	}
+	return ""
+}
+
+// commandArgs formats a command's subcommands and options like "set-volume volume:50"
+func commandArgs(options []*discordgo.ApplicationCommandInteractionDataOption) string {
+	var parts []string
+	for _, option := range options {
+		switch option.Type {
+		case discordgo.ApplicationCommandOptionSubCommand, discordgo.ApplicationCommandOptionSubCommandGroup:
+			parts = append(parts, option.Name)
+			if args := commandArgs(option.Options); args != "" {
+				parts = append(parts, args)
+			}
+		case discordgo.ApplicationCommandOptionChannel:
+			parts = append(parts, fmt.Sprintf("%s:<#%v>", option.Name, option.Value))
+		default:
+			parts = append(parts, fmt.Sprintf("%s:%v", option.Name, option.Value))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// add queues a line for a server's audit channel, posting the batch after auditFlushDelay
+func (a *auditLog) add(s *discordgo.Session, guildID, channelID, line string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.muted[guildID] {
+		return
+	}
+	if a.pending == nil {
+		a.pending = make(map[string][]string)
+	}
+	if len(a.pending[guildID]) == 0 {
+		time.AfterFunc(auditFlushDelay, func() { a.flush(s, guildID, channelID) })
+	}
+	a.pending[guildID] = append(a.pending[guildID], line)
+}
+
+// flush posts a server's pending audit lines, as few messages as fit
+// If the bot can't post in the channel, the server's audit lines are dropped from then on,
+// with one warning, until its audit channel is set again
+func (a *auditLog) flush(s *discordgo.Session, guildID, channelID string) {
+	a.mu.Lock()
+	lines := a.pending[guildID]
+	delete(a.pending, guildID)
+	a.mu.Unlock()
+
+	for _, message := range auditMessages(lines) {
+		_, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+			Content: message,
+			// The lines mention users and may quote titles; nobody should be pinged
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err == nil {
+			continue
+		}
+		if isPermissionError(err) {
+			a.mu.Lock()
+			if a.muted == nil {
+				a.muted = make(map[string]bool)
+			}
+			a.muted[guildID] = true
+			a.mu.Unlock()
+			logger.Warn("Can't post in the audit channel, dropping audit lines until it is set again", "guild", guildID, "channel", channelID, "err", err)
+			return
+		}
+		logger.Warn("Failed to post audit lines", "guild", guildID, "channel", channelID, "err", err)
+	}
+}
+
+// unmute lets a server's audit lines be posted again, after its audit channel changed
+func (a *auditLog) unmute(guildID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.muted, guildID)
+}
+
+// auditMessages joins audit lines into messages within auditMessageLimit
+func auditMessages(lines []string) []string {
+	var messages []string
+	var current strings.Builder
+	for _, line := range lines {
+		if len(line) > auditMessageLimit {
+			line = strings.ToValidUTF8(line[:auditMessageLimit-len("…")], "") + "…"
+		}
+		if current.Len() > 0 && current.Len()+1+len(line) > auditMessageLimit {
+			messages = append(messages, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteByte('\n')
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		messages = append(messages, current.String())
+	}
+	return messages
+}
+
+// isPermissionError reports whether Discord refused a request for lack of access or permissions
+func isPermissionError(err error) bool {
+	var restErr *discordgo.RESTError
+	if !errors.As(err, &restErr) {
+		return false
+	}
+	if restErr.Message != nil && (restErr.Message.Code == discordgo.ErrCodeMissingAccess || restErr.Message.Code == discordgo.ErrCodeMissingPermissions) {
+		return true
+	}
+	return restErr.Response != nil && restErr.Response.StatusCode == http.StatusForbidden
+}
@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestCommandArgs(t *testing.T) {
+	tests := []struct {
+		options []*discordgo.ApplicationCommandInteractionDataOption
+		want    string
+	}{
+		{nil, ""},
+		{[]*discordgo.ApplicationCommandInteractionDataOption{
+			{Name: "level", Type: discordgo.ApplicationCommandOptionInteger, Value: float64(50)},
+		}, "level:50"},
+		{[]*discordgo.ApplicationCommandInteractionDataOption{
+			{Name: "set-audit-channel", Type: discordgo.ApplicationCommandOptionSubCommand, Options: []*discordgo.ApplicationCommandInteractionDataOption{
+				{Name: "channel", Type: discordgo.ApplicationCommandOptionChannel, Value: "42"},
+			}},
+		}, "set-audit-channel channel:<#42>"},
+		{[]*discordgo.ApplicationCommandInteractionDataOption{
+			{Name: "reload", Type: discordgo.ApplicationCommandOptionSubCommand},
+		}, "reload"},
+	}
+	for _, tt := range tests {
+		if got := commandArgs(tt.options); got != tt.want {
+			t.Errorf("commandArgs() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestAuditMessagesFitTheLimit(t *testing.T) {
+	line := strings.Repeat("a", 900)
+	messages := auditMessages([]string{line, line, line, strings.Repeat("é", 1500)})
+
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages, want 3", len(messages))
+	}
+	if messages[0] != line+"\n"+line {
+		t.Error("first message doesn't join the first two lines")
+	}
+	for idx, message := range messages {
+		if len(message) > auditMessageLimit {
+			t.Errorf("message %d is %d bytes, over the limit", idx, len(message))
+		}
+	}
+	if !strings.HasSuffix(messages[2], "…") || !strings.HasPrefix(messages[2], "é") {
+		t.Errorf("long line wasn't cut on a character boundary: %q…", messages[2][:10])
+	}
+}
@@ -0,0 +1,217 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/GrainedLotus515/gobard/internal/youtube"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// blocklistStoreFile is where servers' blocklists are kept, relative to the cache directory
+	blocklistStoreFile = "guilds/blocklist.json"
+	// blocklistLimit is the most entries one server's blocklist can hold
+	blocklistLimit = 100
+	// blocklistShown is how many characters of entries /blocklist show lists, under
+	// Discord's embed description limit
+	blocklistShown = 3800
+)
+
+// blockRule is a blocklist entry: a YouTube video, any other link, or words a title can't
+// contain; exactly one field is set
+type blockRule struct {
+	VideoID string `json:"video_id,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Text    string `json:"text,omitempty"` // Lowercase
+}
+
+// parseBlockRule reads a blocklist entry as /blocklist add and BLOCKLIST take it
+// YouTube links block their video however it's linked; other links block that exact link,
+// and anything else blocks titles containing it
+func parseBlockRule(input string) (blockRule, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return blockRule{}, i18n.Error("blocklist.empty_entry")
+	}
+	if !isURL(input) {
+		return blockRule{Text: strings.ToLower(input)}, nil
+	}
+	if link, err := youtube.ParseURL(input); err == nil && link.VideoID != "" {
+		return blockRule{VideoID: link.VideoID}, nil
+	}
+	return blockRule{URL: normalizeBlockedURL(input)}, nil
+}
+
+// normalizeBlockedURL makes links that differ only in case or a trailing slash compare equal
+func normalizeBlockedURL(link string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(link)), "/")
+}
+
+// String shows the rule as it is listed and removed
+func (r blockRule) String() string {
+	switch {
+	case r.VideoID != "":
+		return "https://www.youtube.com/watch?v=" + r.VideoID
+	case r.URL != "":
+		return r.URL
+	}
+	return r.Text
+}
+
+// matches reports whether the rule blocks a track: by its YouTube video ID, its link, or
+// words in its title
+func (r blockRule) matches(track *player.Track) bool {
+	switch {
+	case r.VideoID != "":
+		if track.Source == player.SourceYouTube && track.ID == r.VideoID {
+			return true
+		}
+		link, err := youtube.ParseURL(track.URL)
+		return err == nil && link.VideoID == r.VideoID
+	case r.URL != "":
+		return track.URL != "" && normalizeBlockedURL(track.URL) == r.URL
+	case r.Text != "":
+		return strings.Contains(strings.ToLower(track.Title), r.Text) ||
+			strings.Contains(strings.ToLower(track.RawTitle), r.Text)
+	}
+	return false
+}
+
+// blocklisted reports whether any of the rules blocks a track
+func blocklisted(rules []blockRule, track *player.Track) bool {
+	return slices.ContainsFunc(rules, func(rule blockRule) bool { return rule.matches(track) })
+}
+
+// globalBlockRules returns the rules BLOCKLIST sets for every server
+func (b *Bot) globalBlockRules() []blockRule {
+	entries := b.config().Blocklist
+	rules := make([]blockRule, 0, len(entries))
+	for _, entry := range entries {
+		if rule, err := parseBlockRule(entry); err == nil {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// blockRules returns the rules BLOCKLIST sets for every server followed by the server's own
+func (b *Bot) blockRules(guildID string) []blockRule {
+	rules := b.globalBlockRules()
+	if b.blocklist != nil {
+		guildRules, _ := b.blocklist.Get(guildID)
+		rules = append(rules, guildRules...)
+	}
+	return rules
+}
+
+// handleBlocklist handles the blocklist command
+func (b *Bot) handleBlocklist(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	if i.Member == nil || i.Member.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageGuild) == 0 {
+		return i18n.Error("blocklist.admins_only")
+	}
+	if b.blocklist == nil {
+		return i18n.Error("blocklist.unavailable")
+	}
+	subCmd, err := subcommand(i.ApplicationCommandData().Options)
+	if err != nil {
+		return err
+	}
+
+	switch subCmd.Name {
+	case "add":
+		entry, ok := getStringOption(subCmd.Options, "entry")
+		if !ok {
+			return missingOption("entry")
+		}
+		rule, err := parseBlockRule(entry)
+		if err != nil {
+			return err
+		}
+		err = b.blocklist.Update(i.GuildID, func(rules []blockRule, _ bool) ([]blockRule, error) {
+			if slices.Contains(rules, rule) {
+				return nil, i18n.Error("blocklist.exists", "entry", rule)
+			}
+			if len(rules) >= blocklistLimit {
+				return nil, i18n.Error("blocklist.full", "limit", blocklistLimit)
+			}
+			return append(rules[:len(rules):len(rules)], rule), nil
+		})
+		if err != nil {
+			return err
+		}
+		b.respond(r, i, confirmation, b.t(i, "blocklist.added", "entry", rule))
+	case "remove":
+		entry, ok := getStringOption(subCmd.Options, "entry")
+		if !ok {
+			return missingOption("entry")
+		}
+		var removed blockRule
+		err := b.blocklist.Update(i.GuildID, func(rules []blockRule, _ bool) ([]blockRule, error) {
+			n := blockRuleIndex(rules, entry)
+			if n < 0 {
+				return nil, i18n.Error("blocklist.not_found", "entry", strings.TrimSpace(entry))
+			}
+			removed = rules[n]
+			return append(rules[:n:n], rules[n+1:]...), nil
+		})
+		if err != nil {
+			return err
+		}
+		b.respond(r, i, confirmation, b.t(i, "blocklist.removed", "entry", removed))
+	case "show":
+		rules, _ := b.blocklist.Get(i.GuildID)
+		b.respondEphemeralEmbed(r, i, blocklistEmbed(rules, len(b.globalBlockRules()), b.locale(i)))
+	default:
+		return i18n.Error("error.unknown_subcommand")
+	}
+	return nil
+}
+
+// blockRuleIndex finds the rule /blocklist remove was given: its number in /blocklist show
+// or the entry itself; -1 if there's no such rule
+func blockRuleIndex(rules []blockRule, entry string) int {
+	if n, err := strconv.Atoi(strings.TrimSpace(entry)); err == nil {
+		if n >= 1 && n <= len(rules) {
+			return n - 1
+		}
+		return -1
+	}
+	rule, err := parseBlockRule(entry)
+	if err != nil {
+		return -1
+	}
+	return slices.Index(rules, rule)
+}
+
+// blocklistEmbed lists a server's blocklist, numbered as /blocklist remove takes it
+func blocklistEmbed(rules []blockRule, global int, locale string) *discordgo.MessageEmbed {
+	var builder strings.Builder
+	for n, rule := range rules {
+		line := fmt.Sprintf("%d. `%s`\n", n+1, rule)
+		if builder.Len()+len(line) > blocklistShown {
+			builder.WriteString("…")
+			break
+		}
+		builder.WriteString(line)
+	}
+	if len(rules) == 0 {
+		builder.WriteString(i18n.T(locale, "blocklist.none"))
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       i18n.T(locale, "blocklist.title"),
+		Description: builder.String(),
+		Color:       0x0099ff,
+		Footer:      &discordgo.MessageEmbedFooter{Text: i18n.T(locale, "blocklist.footer", "count", len(rules), "limit", blocklistLimit)},
+	}
+	if global > 0 {
+		embed.Footer.Text += " · " + i18n.T(locale, "blocklist.global", "count", global)
+	}
+	return embed
+}
@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/GrainedLotus515/gobard/internal/player"
+)
+
+func TestParseBlockRule(t *testing.T) {
+	tests := []struct {
+		input string
+		want  blockRule
+	}{
+		{"https://youtu.be/dQw4w9WgXcQ?t=42", blockRule{VideoID: "dQw4w9WgXcQ"}},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=RDdQw4w9WgXcQ", blockRule{VideoID: "dQw4w9WgXcQ"}},
+		{" https://Example.com/Loud.mp3/ ", blockRule{URL: "https://example.com/loud.mp3"}},
+		{"  EARRAPE ", blockRule{Text: "earrape"}},
+	}
+	for _, tt := range tests {
+		got, err := parseBlockRule(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("parseBlockRule(%q) = %+v, %v; want %+v", tt.input, got, err, tt.want)
+		}
+	}
+	if _, err := parseBlockRule("   "); err == nil {
+		t.Error("parseBlockRule accepted an empty entry")
+	}
+}
+
+func TestBlocklisted(t *testing.T) {
+	video := &player.Track{ID: "dQw4w9WgXcQ", Title: "Never Gonna Give You Up", URL: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", Source: player.SourceYouTube}
+	direct := &player.Track{Title: "loud.mp3", URL: "https://example.com/loud.mp3", Source: player.SourceDirect}
+	cleaned := &player.Track{Title: "Song", RawTitle: "Song (EARRAPE edition)", Source: player.SourceYouTube}
+
+	rule := func(entry string) []blockRule {
+		r, err := parseBlockRule(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []blockRule{r}
+	}
+
+	tests := []struct {
+		rules []blockRule
+		track *player.Track
+		want  bool
+	}{
+		{rule("https://youtu.be/dQw4w9WgXcQ"), video, true},
+		{rule("https://youtu.be/aaaaaaaaaaa"), video, false},
+		{rule("never gonna"), video, true},
+		{rule("HTTPS://example.com/loud.mp3"), direct, true},
+		{rule("https://example.com/quiet.mp3"), direct, false},
+		{rule("earrape"), cleaned, true},
+		{nil, video, false},
+	}
+	for _, tt := range tests {
+		if got := blocklisted(tt.rules, tt.track); got != tt.want {
+			t.Errorf("blocklisted(%v, %q) = %v, want %v", tt.rules, tt.track.Title, got, tt.want)
+		}
+	}
+}
+
+func TestBlockRuleIndex(t *testing.T) {
+	rules := []blockRule{{Text: "earrape"}, {VideoID: "dQw4w9WgXcQ"}}
+	tests := []struct {
+		entry string
+		want  int
+	}{
+		{"1", 0},
+		{"2", 1},
+		{"3", -1},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", 1},
+		{"EarRape", 0},
+		{"bass boosted", -1},
+	}
+	for _, tt := range tests {
+		if got := blockRuleIndex(rules, tt.entry); got != tt.want {
+			t.Errorf("blockRuleIndex(%q) = %d, want %d", tt.entry, got, tt.want)
+		}
+	}
+}
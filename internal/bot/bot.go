@@ -3,40 +3,164 @@ package bot
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/GrainedLotus515/gobard/internal/cache"
 	"github.com/GrainedLotus515/gobard/internal/config"
+	"github.com/GrainedLotus515/gobard/internal/direct"
 	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/lyrics"
 	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/GrainedLotus515/gobard/internal/sponsorblock"
 	"github.com/GrainedLotus515/gobard/internal/spotify"
+	"github.com/GrainedLotus515/gobard/internal/store"
+	"github.com/GrainedLotus515/gobard/internal/tools"
 	"github.com/GrainedLotus515/gobard/internal/youtube"
 	"github.com/bwmarrin/discordgo"
 )
 
+// volumeStoreFile is where servers' own default volumes are kept, relative to the cache directory
+const volumeStoreFile = "guilds/volumes.json"
+
+// filterStoreFile is where servers' custom filter chains are kept, relative to the cache directory
+const filterStoreFile = "guilds/filters.json"
+
 // Bot represents the Discord bot
 type Bot struct {
 	Session       *discordgo.Session
-	Config        *config.Config
+	Config        *config.Config // Read it through config(), as Reload replaces it
 	PlayerManager *player.Manager
 	Cache         *cache.Cache
 	YouTube       *youtube.Client
 	Spotify       *spotify.Client
+	Direct        *direct.Client
+	Lyrics        *lyrics.Client
 	Commands      []*discordgo.ApplicationCommand
+
+	// failedDownloads maps cache keys to when their download last failed for good
+	failedDownloads sync.Map
+	// preEncoding holds the cache artifacts being pre-encoded, by key and suffix
+	preEncoding sync.Map
+
+	// languages holds the languages servers chose; nil if they can't be remembered
+	languages *store.Store[string]
+	// quietModes holds the servers that turned on quiet mode; nil if it can't be remembered
+	quietModes *store.Store[bool]
+	// auditChannels holds the channels servers' audit lines are posted in, by guild ID; nil
+	// if they can't be remembered
+	auditChannels *store.Store[string]
+	audit         auditLog
+	// notifications holds the users who turned on now-playing DMs with /notify; nil if they
+	// can't be remembered
+	notifications *store.Store[bool]
+	notifier      notifier
+	// favorites holds the tracks users saved with /fav, by user ID; nil if they can't be
+	// remembered
+	favorites *store.Store[[]favorite]
+	// soundboard holds servers' /sfx sound effects by name, by guild ID; nil if they can't be
+	// remembered
+	soundboard *store.Store[map[string]soundEffect]
+	// blocklist holds the tracks servers blocked with /blocklist, by guild ID; nil if they
+	// can't be remembered
+	blocklist *store.Store[[]blockRule]
+
+	// lyricsCache keeps /lyrics lookups by track, so repeated lookups and page buttons don't
+	// query the API again
+	lyricsCache lyricsCache
+
+	// imports remembers recent imports' unmatched tracks for their retry buttons
+	imports importRecords
+
+	// follows debounces moving with requesters who switch voice channels
+	follows followDebouncer
+
+	// quietHours holds servers' quiet hours, by guild ID; nil if they can't be remembered
+	quietHours *store.Store[quietHours]
+	quiet      quietWatch
+	// stopQuietHours stops watching for quiet hours beginning and ending
+	stopQuietHours func()
+
+	// spotifyMatches finds and remembers YouTube videos for Spotify, Apple Music and Deezer tracks
+	spotifyMatches *spotifyMatcher
+
+	// stopJanitor stops the cache's hourly pruning
+	stopJanitor func()
+
+	// loadConfig loads the configuration again for Reload; nil if reloading isn't set up
+	loadConfig func() (*config.Config, error)
+	reloadMu   sync.Mutex // Serializes reloads
+	configMu   sync.RWMutex
+
+	// commands counts command outcomes and latencies since startup
+	commands commandStats
+	// cooldowns rate limits each user's commands in each server
+	cooldowns cooldowns
+
+	startedAt    time.Time
+	shutdown     chan struct{} // Closed by /admin shutdown
+	shutdownOnce sync.Once
+}
+
+// config returns the running configuration
+func (b *Bot) config() *config.Config {
+	b.configMu.RLock()
+	defer b.configMu.RUnlock()
+	return b.Config
 }
 
 // New creates a new bot instance
 func New(cfg *config.Config) (*Bot, error) {
+	// Check external tools before anything else
+	tools.FFmpeg = cfg.FFmpegPath
+	tools.FFprobe = cfg.FFprobePath
+	tools.YtDlp = cfg.YtDlpPath
+	tools.YtDlpExtraArgs = cfg.YtDlpExtraArgs
+	tools.YtDlpCookiesFile = cfg.YtDlpCookies
+	tools.Proxies = tools.NewProxyPool(cfg.ProxyURLs)
+	youtube.SetMaxConcurrency(cfg.YtDlpMaxProcs)
+	youtube.SetResultFilter(resultFilter(cfg))
+	if len(cfg.ProxyURLs) > 0 {
+		logger.Info("Routing yt-dlp and FFmpeg through proxies", "count", len(cfg.ProxyURLs))
+	}
+
+	if cfg.YtDlpCookies != "" {
+		info, err := os.Stat(cfg.YtDlpCookies)
+		if err != nil {
+			return nil, fmt.Errorf("cookies file unavailable: %w", err)
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("cookies file %s is a directory", cfg.YtDlpCookies)
+		}
+		if info.Mode().Perm()&0o004 != 0 {
+			logger.Warn("Cookies file is world-readable; restrict it with chmod 600", "path", cfg.YtDlpCookies)
+		}
+	}
+
+	versions, err := tools.Check()
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("External tools found", "ffmpeg", versions.FFmpeg, "yt-dlp", versions.YtDlp)
+
 	// Create Discord session
 	session, err := discordgo.New("Bot " + cfg.DiscordToken)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Discord session: %w", err)
 	}
+	if err := setupSharding(session, cfg); err != nil {
+		return nil, err
+	}
 
 	// Create cache
 	cacheManager, err := cache.NewCache(cfg.CacheDir, cfg.CacheLimit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create cache: %w", err)
 	}
+	cacheManager.SetMinFree(cfg.CacheMinFree)
 
 	// Create YouTube client
 	ytClient := youtube.NewClient(cfg.YouTubeAPIKey)
@@ -44,34 +168,180 @@ func New(cfg *config.Config) (*Bot, error) {
 	// Create Spotify client (optional)
 	var spotifyClient *spotify.Client
 	if cfg.SpotifyClientID != "" && cfg.SpotifySecret != "" {
-		spotifyClient, err = spotify.NewClient(cfg.SpotifyClientID, cfg.SpotifySecret)
+		spotifyClient, err = spotify.NewClient(cfg.SpotifyClientID, cfg.SpotifySecret, cfg.SpotifyMarket)
 		if err != nil {
 			logger.Warn("Failed to create Spotify client", "err", err)
 		}
 	}
 
+	audioSettings := player.AudioSettings{
+		SampleRate:    48000,
+		Channels:      cfg.AudioChannels,
+		Bitrate:       cfg.OpusBitrate * 1000,
+		MaxBitrate:    cfg.OpusMaxBitrate * 1000,
+		FrameDuration: time.Duration(cfg.FrameDurationMs) * time.Millisecond,
+		FEC:           cfg.OpusFEC,
+		PacketLoss:    cfg.OpusPacketLoss,
+
+		StartupTimeout: cfg.EncoderStartupTimeout,
+		JitterBuffer:   time.Duration(cfg.JitterBufferMs) * time.Millisecond,
+	}
+
+	directClient := direct.NewClient(cfg.DirectMaxSize)
+
+	playerManager := player.NewManager()
+	playerManager.SetAudioSettings(audioSettings)
+	playerManager.SetReplayFromStartAt(cfg.ReplayFromTimestamp)
+	playerManager.SetHistoryLimit(cfg.QueueHistorySize)
+	playerManager.SetStreamMode(player.StreamMode(cfg.StreamMode))
+	playerManager.SetDirectOpener(directClient.Open)
+	playerManager.SetDefaults(player.PlayerDefaults{
+		Volume:              cfg.DefaultVolume,
+		ReduceOnVoice:       cfg.ReduceVolumeOnVoice,
+		ReduceOnVoiceTarget: cfg.ReduceVolumeOnVoiceTarget,
+	})
+	if volumes, err := store.Open[int](filepath.Join(cfg.CacheDir, volumeStoreFile)); err != nil {
+		logger.Warn("Per-server default volumes won't be remembered", "err", err)
+	} else {
+		playerManager.SetVolumeStore(volumes)
+	}
+	if filters, err := store.Open[string](filepath.Join(cfg.CacheDir, filterStoreFile)); err != nil {
+		logger.Warn("Custom filters won't be remembered", "err", err)
+	} else {
+		playerManager.SetFilterStore(filters)
+	}
+
+	// Create SponsorBlock client (optional)
+	if cfg.EnableSponsorBlock {
+		timeout := time.Duration(cfg.SponsorBlockTimeout) * time.Second
+		playerManager.SetSponsorBlock(sponsorblock.NewClient(cfg.SponsorBlockCategories, timeout))
+		logger.Info("SponsorBlock enabled", "categories", cfg.SponsorBlockCategories)
+	}
+
+	languages, err := store.Open[string](filepath.Join(cfg.CacheDir, languageStoreFile))
+	if err != nil {
+		logger.Warn("Per-server languages won't be remembered", "err", err)
+		languages = nil
+	}
+
+	quietModes, err := store.Open[bool](filepath.Join(cfg.CacheDir, quietModeStoreFile))
+	if err != nil {
+		logger.Warn("Quiet mode won't be remembered", "err", err)
+		quietModes = nil
+	}
+
+	auditChannels, err := store.Open[string](filepath.Join(cfg.CacheDir, auditStoreFile))
+	if err != nil {
+		logger.Warn("Audit channels won't be remembered", "err", err)
+		auditChannels = nil
+	}
+
+	notifications, err := store.Open[bool](filepath.Join(cfg.CacheDir, notifyStoreFile))
+	if err != nil {
+		logger.Warn("Now-playing DM choices won't be remembered", "err", err)
+		notifications = nil
+	}
+
+	favorites, err := store.Open[[]favorite](filepath.Join(cfg.CacheDir, favoritesStoreFile))
+	if err != nil {
+		logger.Warn("Favorites won't be remembered", "err", err)
+		favorites = nil
+	}
+
+	soundboard, err := store.Open[map[string]soundEffect](filepath.Join(cfg.CacheDir, sfxStoreFile))
+	if err != nil {
+		logger.Warn("Sound effects won't be remembered", "err", err)
+		soundboard = nil
+	}
+
+	blocklist, err := store.Open[[]blockRule](filepath.Join(cfg.CacheDir, blocklistStoreFile))
+	if err != nil {
+		logger.Warn("Blocklists won't be remembered", "err", err)
+		blocklist = nil
+	}
+
+	quietHoursStore, err := store.Open[quietHours](filepath.Join(cfg.CacheDir, quietHoursStoreFile))
+	if err != nil {
+		logger.Warn("Quiet hours won't be remembered", "err", err)
+		quietHoursStore = nil
+	}
+
 	bot := &Bot{
 		Session:       session,
 		Config:        cfg,
-		PlayerManager: player.NewManager(),
+		PlayerManager: playerManager,
 		Cache:         cacheManager,
 		YouTube:       ytClient,
 		Spotify:       spotifyClient,
+		Direct:        directClient,
+		Lyrics:        lyrics.NewClient(cfg.LyricsAPIURL, lyricsTimeout),
+
+		languages:      languages,
+		quietModes:     quietModes,
+		auditChannels:  auditChannels,
+		notifications:  notifications,
+		favorites:      favorites,
+		soundboard:     soundboard,
+		blocklist:      blocklist,
+		quietHours:     quietHoursStore,
+		spotifyMatches: newSpotifyMatcher(ytClient, cfg.CacheDir),
+		stopJanitor:    cacheManager.StartJanitor(cfg.CacheMaxAge),
+
+		startedAt: time.Now(),
+		shutdown:  make(chan struct{}),
 	}
 
+	playerManager.SetVoiceJoiner(bot.JoinVoiceChannel)
+	bot.stopQuietHours = bot.watchQuietHours()
+
 	// Register handlers
 	session.AddHandler(bot.ready)
 	session.AddHandler(bot.interactionCreate)
+	session.AddHandler(bot.guildCreate)
+	session.AddHandler(bot.messageCreate)
 	session.AddHandler(bot.voiceStateUpdate)
 
+	// Handlers must run concurrently, so one slow command doesn't hold up every server's
+	session.SyncEvents = false
+
 	// Set intents
 	session.Identify.Intents = discordgo.IntentsGuilds |
 		discordgo.IntentsGuildVoiceStates |
 		discordgo.IntentsGuildMessages
+	// Prefix commands need message text, a privileged intent enabled in the Developer Portal
+	if cfg.CommandPrefix != "" {
+		session.Identify.Intents |= discordgo.IntentsMessageContent
+	}
 
 	return bot, nil
 }
 
+// setupSharding sets the shard the session identifies as, asking Discord how many shards to
+// use when SHARD_COUNT is auto
+// Discord sends each shard only its own servers' events, so a process's voice connections
+// always belong to its session
+func setupSharding(session *discordgo.Session, cfg *config.Config) error {
+	count := cfg.ShardCount
+	if count == 0 {
+		gateway, err := session.GatewayBot()
+		if err != nil {
+			return fmt.Errorf("failed to get the recommended shard count: %w", err)
+		}
+		count = gateway.Shards
+		logger.Info("Using the recommended shard count", "shards", count)
+	}
+	if cfg.ShardID >= count {
+		return fmt.Errorf("SHARD_ID %d is out of range for %d shards", cfg.ShardID, count)
+	}
+
+	session.ShardID = cfg.ShardID
+	session.ShardCount = count
+	if count > 1 {
+		logger.SetShard(cfg.ShardID, count)
+	}
+	return nil
+}
+
 // Start starts the bot
 func (b *Bot) Start() error {
 	if err := b.Session.Open(); err != nil {
@@ -84,6 +354,12 @@ func (b *Bot) Start() error {
 
 // Stop stops the bot
 func (b *Bot) Stop() error {
+	b.stopJanitor()
+	b.stopQuietHours()
+	b.spotifyMatches.flush()
+	if err := b.Cache.Flush(); err != nil {
+		logger.Warn("Failed to save cache index", "err", err)
+	}
 	return b.Session.Close()
 }
 
@@ -93,14 +369,24 @@ func (b *Bot) ready(s *discordgo.Session, event *discordgo.Ready) {
 	inviteURL := fmt.Sprintf("https://discord.com/api/oauth2/authorize?client_id=%s&permissions=0&scope=bot%%20applications.commands", s.State.User.ID)
 	logger.Info("Invite the bot using this link", "url", inviteURL)
 
-	// Set bot status
-	status := b.Config.BotStatus
+	b.updatePresence(s)
+
+	// Register commands
+	if err := b.registerCommands(); err != nil {
+		logger.Error("Error registering commands", "err", err)
+	}
+}
+
+// updatePresence sets the bot's status and activity from the configuration
+func (b *Bot) updatePresence(s *discordgo.Session) {
+	cfg := b.config()
+	status := cfg.BotStatus
 	if status == "" {
 		status = "online"
 	}
 
 	activityType := discordgo.ActivityTypeListening
-	switch b.Config.BotActivityType {
+	switch cfg.BotActivityType {
 	case "PLAYING":
 		activityType = discordgo.ActivityTypeGame
 	case "STREAMING":
@@ -113,20 +399,15 @@ func (b *Bot) ready(s *discordgo.Session, event *discordgo.Ready) {
 		Status: status,
 		Activities: []*discordgo.Activity{
 			{
-				Name: b.Config.BotActivity,
+				Name: cfg.BotActivity,
 				Type: activityType,
-				URL:  b.Config.BotActivityURL,
+				URL:  cfg.BotActivityURL,
 			},
 		},
 	})
 	if err != nil {
 		logger.Error("Error setting status", "err", err)
 	}
-
-	// Register commands
-	if err := b.registerCommands(); err != nil {
-		logger.Error("Error registering commands", "err", err)
-	}
 }
 
 // voiceStateUpdate handles voice state changes
@@ -143,10 +424,18 @@ func (b *Bot) voiceStateUpdate(s *discordgo.Session, vsu *discordgo.VoiceStateUp
 				p.Queue.ClearAll()
 				p.ClearVoiceConnection()
 			}
+		} else {
+			// Bot joined or was moved; follow the new channel, and its bitrate
+			p := b.PlayerManager.GetPlayer(vsu.GuildID)
+			p.SetVoiceChannelID(vsu.ChannelID)
+			p.SetChannelBitrate(b.ChannelBitrate(vsu.ChannelID))
 		}
 		return
 	}
 
+	// Someone joining, leaving or switching channels may leave the bot behind its requester
+	b.considerFollowing(vsu.GuildID)
+
 	// Handle volume reduction when someone speaks
 	if vsu.VoiceState.SelfMute || vsu.VoiceState.SelfDeaf {
 		return
@@ -181,21 +470,50 @@ func (b *Bot) GetVoiceChannel(guildID, userID string) (string, error) {
 	return "", fmt.Errorf("user not in voice channel")
 }
 
+// ChannelBitrate gets a voice channel's bitrate in bits per second, or 0 if unknown
+func (b *Bot) ChannelBitrate(channelID string) int {
+	channel, err := b.Session.State.Channel(channelID)
+	if err != nil {
+		return 0
+	}
+	return channel.Bitrate
+}
+
+// IsDJ checks if a member may use DJ-only commands
+// Administrators, members with Manage Server, and members with the DJ role qualify
+func (b *Bot) IsDJ(guildID string, member *discordgo.Member) bool {
+	if member == nil {
+		return false
+	}
+
+	if member.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageGuild) != 0 {
+		return true
+	}
+
+	if b.config().DJRole == "" {
+		return false
+	}
+
+	for _, roleID := range member.Roles {
+		role, err := b.Session.State.Role(guildID, roleID)
+		if err == nil && strings.EqualFold(role.Name, b.config().DJRole) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // JoinVoiceChannel joins a voice channel
 func (b *Bot) JoinVoiceChannel(guildID, channelID string) (*discordgo.VoiceConnection, error) {
 	// Join voice channel: mute=false, deaf=false
 	// Bot needs to hear users for voice ducking feature
 	ctx := context.Background()
+	// Returns once the connection is ready; the speaking state is set when playback starts
 	vc, err := b.Session.ChannelVoiceJoin(ctx, guildID, channelID, false, false)
 	if err != nil {
 		return nil, fmt.Errorf("failed to join voice channel: %w", err)
 	}
 
-	// Wait for voice connection to be ready
-	// This ensures the encryption handshake is complete
-	if err := vc.Speaking(true); err != nil {
-		logger.Warn("Failed to set speaking state", "err", err)
-	}
-
 	return vc, nil
 }
@@ -2,11 +2,17 @@ package bot
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/GrainedLotus515/gobard/internal/i18n"
 	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/player"
 	"github.com/bwmarrin/discordgo"
 )
 
+// adminPermissions hides admin-only commands from members without Manage Server
+var adminPermissions int64 = discordgo.PermissionManageGuild
+
 // registerCommands registers all slash commands
 func (b *Bot) registerCommands() error {
 	commands := []*discordgo.ApplicationCommand{
@@ -20,6 +26,47 @@ func (b *Bot) registerCommands() error {
 					Description: "Song name, URL, or search query",
 					Required:    true,
 				},
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "limit",
+					Description: "Most tracks to add from a playlist",
+					MinValue:    func() *float64 { v := 1.0; return &v }(),
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "offset",
+					Description: "Playlist entries to skip before adding",
+					MinValue:    func() *float64 { v := 0.0; return &v }(),
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "volume",
+					Description: "Volume for these tracks, in percent of the server's volume (50-150)",
+					MinValue:    func() *float64 { v := float64(player.MinTrackVolume); return &v }(),
+					MaxValue:    player.MaxTrackVolume,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "force",
+					Description: "Play during quiet hours (DJs and admins only)",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "interleave",
+					Description: "Take turns with other requesters' tracks instead of queueing all of these after them",
+				},
+			},
+		},
+		{
+			Name:        "search",
+			Description: "Show the top YouTube results for a query",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "query",
+					Description: "Search query",
+					Required:    true,
+				},
 			},
 		},
 		{
@@ -40,7 +87,46 @@ func (b *Bot) registerCommands() error {
 		},
 		{
 			Name:        "queue",
-			Description: "Show the current queue",
+			Description: "Show or reorder the queue",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "show",
+					Description: "Show the current queue",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "sort",
+					Description: "Sort the upcoming tracks",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "by",
+							Description: "What to sort by",
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "title", Value: "title"},
+								{Name: "duration", Value: "duration"},
+								{Name: "requester", Value: "requester"},
+							},
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "order",
+							Description: "Ascending (default) or descending",
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "asc", Value: "asc"},
+								{Name: "desc", Value: "desc"},
+							},
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "reverse",
+					Description: "Reverse the order of the upcoming tracks",
+				},
+			},
 		},
 		{
 			Name:        "now-playing",
@@ -69,10 +155,24 @@ func (b *Bot) registerCommands() error {
 				{
 					Type:        discordgo.ApplicationCommandOptionInteger,
 					Name:        "level",
-					Description: "Volume level (0-100)",
+					Description: "Volume level (0-100, or up to 200 where /config set-allow-boost is on)",
 					Required:    true,
 					MinValue:    func() *float64 { v := 0.0; return &v }(),
-					MaxValue:    100,
+					MaxValue:    player.MaxBoostedVolume,
+				},
+			},
+		},
+		{
+			Name:        "trackvolume",
+			Description: "Set the playing track's volume relative to the server's volume",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "level",
+					Description: "Percent of the server's volume (50-150, 100 to reset)",
+					Required:    true,
+					MinValue:    func() *float64 { v := float64(player.MinTrackVolume); return &v }(),
+					MaxValue:    player.MaxTrackVolume,
 				},
 			},
 		},
@@ -83,23 +183,107 @@ func (b *Bot) registerCommands() error {
 				{
 					Type:        discordgo.ApplicationCommandOptionString,
 					Name:        "position",
-					Description: "Position (e.g., 1:30 or 90s)",
+					Description: "Position (e.g., 1:30, 1:02:30, 90s or 50%)",
 					Required:    true,
 				},
 			},
 		},
 		{
 			Name:        "fseek",
-			Description: "Fast seek forward by seconds",
+			Description: "Seek forward, or back with a negative number of seconds",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
 					Type:        discordgo.ApplicationCommandOptionInteger,
 					Name:        "seconds",
-					Description: "Number of seconds to skip forward",
+					Description: "Seconds to skip forward, or back if negative",
 					Required:    true,
 				},
 			},
 		},
+		{
+			Name:        "chapters",
+			Description: "List the chapters of the current song",
+		},
+		{
+			Name:        "skipchapter",
+			Description: "Skip to the next chapter of the current song",
+		},
+		{
+			Name:        "abloop",
+			Description: "Loop a section of the current song",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set",
+					Description: "Loop between two positions",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "start",
+							Description: "Loop start (e.g., 1:30 or 90s)",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "end",
+							Description: "Loop end (e.g., 2:00 or 120s)",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "off",
+					Description: "Stop looping the section",
+				},
+			},
+		},
+		{
+			Name:        "filter",
+			Description: "Apply an audio filter",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "preset",
+					Description: "Apply a filter preset",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "name",
+							Description: "Filter preset",
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "off", Value: "off"},
+								{Name: "bassboost", Value: "bassboost"},
+								{Name: "nightcore", Value: "nightcore"},
+								{Name: "vaporwave", Value: "vaporwave"},
+								{Name: "karaoke", Value: "karaoke"},
+								{Name: "tremolo", Value: "tremolo"},
+							},
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "custom",
+					Description: "Apply a custom FFmpeg filter chain (DJ only)",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "expression",
+							Description: "FFmpeg -af filter chain (e.g., equalizer=f=60:t=h:width=200:g=6)",
+							Required:    true,
+							MaxLength:   player.MaxCustomFilterLength,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "show",
+					Description: "Show the active filter chain",
+				},
+			},
+		},
 		{
 			Name:        "move",
 			Description: "Move a song in the queue",
@@ -120,20 +304,233 @@ func (b *Bot) registerCommands() error {
 		},
 		{
 			Name:        "remove",
-			Description: "Remove a song from the queue",
+			Description: "Remove a song from the queue by position or title",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
 					Type:        discordgo.ApplicationCommandOptionInteger,
 					Name:        "position",
 					Description: "Position in queue to remove",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "title",
+					Description: "Part of the title of the song to remove, instead of its position",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "all",
+					Description: "Remove every song matching the title",
+				},
+			},
+		},
+		{
+			Name:        "find",
+			Description: "Find songs in the queue by title",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "text",
+					Description: "Part of the title to look for",
 					Required:    true,
 				},
 			},
 		},
+		{
+			Name:        "lyrics",
+			Description: "Show the lyrics of the current song or another one",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "query",
+					Description: "Song to look up instead, like \"artist title\"",
+				},
+			},
+		},
+		{
+			Name:        "notify",
+			Description: "DM me when a song I queued starts playing",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "mode",
+					Description: "Now-playing DMs",
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "on", Value: "on"},
+						{Name: "off", Value: "off"},
+					},
+				},
+			},
+		},
+		{
+			Name:        "grab",
+			Description: "DM me the song that's playing",
+		},
+		{
+			Name:        "fav",
+			Description: "Your favorite songs, in any server",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "add",
+					Description: "Save the song that's playing, or another one",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "query",
+							Description: "Song to save instead (URL or search)",
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "Show your favorites",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "play",
+					Description: "Queue one of your favorites, or all of them",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "which",
+							Description: "Number from /fav list, or \"all\"",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "remove",
+					Description: "Remove one of your favorites",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "number",
+							Description: "Number from /fav list",
+							Required:    true,
+							MinValue:    func() *float64 { v := 1.0; return &v }(),
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "sfx",
+			Description: "Short sound effects, played over the music",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "add",
+					Description: "Save a sound effect of up to 10 seconds (DJs and admins)",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "name",
+							Description: "Name to play it by, like airhorn",
+							Required:    true,
+							MaxLength:   32,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionAttachment,
+							Name:        "file",
+							Description: "Audio file",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "List this server's sound effects",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "play",
+					Description: "Play a sound effect in your voice channel",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "name",
+							Description: "Name of the sound effect",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "remove",
+					Description: "Delete a sound effect (DJs and admins)",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "name",
+							Description: "Name of the sound effect",
+							Required:    true,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:                     "blocklist",
+			Description:              "Keep tracks out of this server's queue (admin only)",
+			DefaultMemberPermissions: &adminPermissions,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "add",
+					Description: "Block a YouTube video, a link, or tracks with some words in their title",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "entry",
+							Description: "Link, or words titles can't contain",
+							Required:    true,
+							MaxLength:   200,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "remove",
+					Description: "Unblock an entry",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "entry",
+							Description: "Number from /blocklist show, or the entry itself",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "show",
+					Description: "List this server's blocklist",
+				},
+			},
+		},
 		{
 			Name:        "config",
 			Description: "Configure bot settings",
 			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set-default-volume",
+					Description: "Set the volume playback starts at for this server",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "volume",
+							Description: "Default volume (0-100); leave out to use the bot's default",
+							Required:    false,
+							MinValue:    func() *float64 { v := 0.0; return &v }(),
+							MaxValue:    100,
+						},
+					},
+				},
 				{
 					Type:        discordgo.ApplicationCommandOptionSubCommand,
 					Name:        "set-reduce-vol-when-voice",
@@ -162,6 +559,243 @@ func (b *Bot) registerCommands() error {
 						},
 					},
 				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set-bitrate",
+					Description: "Set the audio bitrate for this server",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "kbps",
+							Description: "Bitrate in kbps (8-510, 0 for the default)",
+							Required:    true,
+							MinValue:    func() *float64 { v := 0.0; return &v }(),
+							MaxValue:    510,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set-audio-robustness",
+					Description: "Trade bitrate for resilience to packet loss",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "level",
+							Description: "Robustness level",
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "default", Value: "default"},
+								{Name: "low", Value: "low"},
+								{Name: "medium", Value: "medium"},
+								{Name: "high", Value: "high"},
+							},
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set-max-duration",
+					Description: "Set the longest track that can be queued on this server",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "length",
+							Description: "A length like 1h30m or 90:00, \"none\" for no limit, or \"default\"",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set-spotify-market",
+					Description: "Set the country whose Spotify catalog is used for links",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "country",
+							Description: "Two-letter country code like US or DE, or \"default\"",
+							Required:    true,
+							MinLength:   func() *int { v := 2; return &v }(),
+							MaxLength:   7,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set-search-provider",
+					Description: "Choose where searches look for songs",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "provider",
+							Description: "Search provider",
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "YouTube", Value: "youtube"},
+								{Name: "YouTube Music", Value: "youtube_music"},
+								{Name: "default", Value: "default"},
+							},
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set-playback-mode",
+					Description: "Choose whether tracks that aren't cached yet play while downloading or download first",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "mode",
+							Description: "Playback mode",
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "stream first", Value: "stream-first"},
+								{Name: "download first", Value: "download-first"},
+								{Name: "auto", Value: "auto"},
+								{Name: "default", Value: "default"},
+							},
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set-quiet-mode",
+					Description: "Show confirmations like pause or volume changes only to whoever asked",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "mode",
+							Description: "Quiet mode",
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "on", Value: "on"},
+								{Name: "off", Value: "off"},
+							},
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set-fair-queue",
+					Description: "Let requesters take turns in the queue whenever several tracks are added at once",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "mode",
+							Description: "Fair queue mode",
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "on", Value: "on"},
+								{Name: "off", Value: "off"},
+							},
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set-follow-requester",
+					Description: "Move with whoever requested the playing track when they switch voice channels",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "mode",
+							Description: "Follow the requester",
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "on", Value: "on"},
+								{Name: "off", Value: "off"},
+							},
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set-allow-boost",
+					Description: "Let /volume go up to 200%, with a limiter so loud parts don't distort",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "mode",
+							Description: "Allow volume boost",
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "on", Value: "on"},
+								{Name: "off", Value: "off"},
+							},
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set-quiet-hours",
+					Description: "Stop music every day between two times (admin only)",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "start",
+							Description: "When quiet hours begin, like 21:00",
+							Required:    true,
+							MaxLength:   5,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "end",
+							Description: "When quiet hours end, like 07:00",
+							Required:    true,
+							MaxLength:   5,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "timezone",
+							Description: "IANA timezone like Europe/Berlin or America/New_York",
+							Required:    true,
+							MaxLength:   64,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "clear-quiet-hours",
+					Description: "Stop having quiet hours (admin only)",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set-audit-channel",
+					Description: "Post who changed playback, the queue or settings to a channel (admin only)",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionChannel,
+							Name:         "channel",
+							Description:  "Channel to post in; leave out to stop",
+							ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set-language",
+					Description: "Set the language the bot answers in on this server",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "language",
+							Description: "Language, or \"default\" to follow each member's Discord language",
+							Required:    true,
+							Choices:     languageChoices(),
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "clear-spotify-cache",
+					Description: "Forget remembered Spotify to YouTube matches (admin only)",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "reload",
+					Description: "Reload the bot's configuration without restarting (bot owner only)",
+				},
 				{
 					Type:        discordgo.ApplicationCommandOptionSubCommand,
 					Name:        "show",
@@ -169,117 +803,321 @@ func (b *Bot) registerCommands() error {
 				},
 			},
 		},
+		{
+			Name:                     "cache",
+			Description:              "Manage the audio cache (admin only)",
+			DefaultMemberPermissions: &adminPermissions,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "stats",
+					Description: "Show cache usage, hit ratio and the largest cached tracks",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "clear",
+					Description: "Remove every cached track except the ones playing now",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "prune",
+					Description: "Remove tracks not played for a while and files the cache doesn't track",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "older-than",
+							Description: "Unplayed for longer than this, e.g. 30d or 12h (default: CACHE_MAX_AGE)",
+							Required:    false,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "verify",
+					Description: "Check every cached file and remove damaged ones",
+				},
+			},
+		},
+		{
+			Name:                     "admin",
+			Description:              "Manage the running bot (bot owner only)",
+			DefaultMemberPermissions: &adminPermissions,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "status",
+					Description: "Show players, memory use and goroutines",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "guilds",
+					Description: "List the servers the bot is in, with their member counts",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "reload-config",
+					Description: "Reload the bot's configuration without restarting",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+					Name:        "cache",
+					Description: "Manage the audio cache",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionSubCommand,
+							Name:        "prune",
+							Description: "Remove tracks not played for a while and files the cache doesn't track",
+							Options: []*discordgo.ApplicationCommandOption{
+								{
+									Type:        discordgo.ApplicationCommandOptionString,
+									Name:        "older-than",
+									Description: "Unplayed for longer than this, e.g. 30d or 12h (default: CACHE_MAX_AGE)",
+									Required:    false,
+								},
+							},
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "leave-guild",
+					Description: "Make the bot leave a server",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "id",
+							Description: "The server's ID, as listed by /admin guilds",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "set-log-level",
+					Description: "Change the log level until the next restart",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "level",
+							Description: "The least severe messages to log",
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "debug", Value: "debug"},
+								{Name: "info", Value: "info"},
+								{Name: "warn", Value: "warn"},
+								{Name: "error", Value: "error"},
+							},
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "shutdown",
+					Description: "Stop the bot gracefully",
+				},
+			},
+		},
+		{
+			Name:                     "debug",
+			Description:              "Show diagnostics (admin only)",
+			DefaultMemberPermissions: &adminPermissions,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "audio",
+					Description: "Show encoder and playback counters for the current track",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "stats",
+					Description: "Show running and waiting yt-dlp processes",
+				},
+			},
+		},
+	}
+
+	for _, cmd := range commands {
+		cmd.DescriptionLocalizations = descriptionLocalizations(cmd.Name)
 	}
 
 	b.Commands = commands
+	cfg := b.config()
 
-	if b.Config.RegisterGlobally {
-		// Register globally
-		logger.Info("📝 Registering commands globally...")
+	// Registering per guild, only /admin is global, as the bot's owner may need it in any server
+	global, perGuild := commands, []*discordgo.ApplicationCommand(nil)
+	if !cfg.RegisterGlobally {
+		global = nil
 		for _, cmd := range commands {
-			_, err := b.Session.ApplicationCommandCreate(b.Session.State.User.ID, "", cmd)
-			if err != nil {
-				return fmt.Errorf("failed to create command %s: %w", cmd.Name, err)
+			if cmd.Name == "admin" {
+				global = append(global, cmd)
+			} else {
+				perGuild = append(perGuild, cmd)
 			}
 		}
+	}
+
+	if cfg.RegisterGlobally {
+		logger.Info("📝 Registering commands globally...")
 	} else {
-		// Register for each guild
 		logger.Info("📝 Registering commands per guild...")
-		guilds := b.Session.State.Guilds
-		for _, guild := range guilds {
-			for _, cmd := range commands {
-				_, err := b.Session.ApplicationCommandCreate(b.Session.State.User.ID, guild.ID, cmd)
-				if err != nil {
-					logger.Error("Failed to create command", "cmd", cmd.Name, "guild", guild.ID, "err", err)
-				}
-			}
+	}
+	if cfg.CleanCommandsOnStart {
+		logger.Info("Deleting and recreating every command (CLEAN_COMMANDS_ON_START)")
+	}
+
+	// Global commands are shared by every shard, so only the first registers them
+	var total commandSync
+	if b.Session.ShardID == 0 {
+		sync, err := b.syncCommands("", global, cfg.CleanCommandsOnStart)
+		if err != nil {
+			return fmt.Errorf("failed to register global commands: %w", err)
+		}
+		total = sync
+	}
+	// Servers are synced in both modes, so switching modes doesn't leave duplicates behind;
+	// each shard's state only holds its own servers
+	for _, guild := range stateGuilds(b.Session) {
+		if !cfg.GuildAllowed(guild.ID) {
+			continue
+		}
+		sync, err := b.syncCommands(guild.ID, perGuild, cfg.CleanCommandsOnStart)
+		total.add(sync)
+		if err != nil {
+			logger.Error("Failed to register commands", "guild", guild.ID, "err", err)
 		}
 	}
 
-	logger.Info("✅ Commands registered successfully")
+	logger.Info("✅ Commands registered", "commands", total.String())
 	return nil
 }
 
 // interactionCreate handles slash command interactions
 func (b *Bot) interactionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type == discordgo.InteractionMessageComponent {
+		b.componentInteraction(s, i)
+		return
+	}
 	if i.Type != discordgo.InteractionApplicationCommand {
 		return
 	}
+	r := newInteractionResponder(s, i)
+
+	// Commands need a server's voice channels and players, and handlers rely on i.Member
+	if i.GuildID == "" || i.Member == nil || i.Member.User == nil {
+		b.respondEphemeral(r, i, b.t(i, "error.servers_only"))
+		return
+	}
+
+	// guildCreate leaves servers that aren't allowed, but commands may arrive before it does;
+	// they still get a reply, or Discord shows the command as failed
+	if !b.config().GuildAllowed(i.GuildID) {
+		logger.Warn("Refusing a command from a server that isn't allowed", "guild", i.GuildID)
+		b.respondEphemeral(r, i, b.t(i, "error.server_not_allowed"))
+		return
+	}
 
 	data := i.ApplicationCommandData()
+	handle := b.commandHandler(data.Name)
+	if handle == nil {
+		b.respondError(r, i, i18n.Error("error.unknown_command"))
+		return
+	}
+
+	b.runCommand(r, i, data.Name, handle)
+}
+
+// componentInteraction handles button presses, routed by the start of their custom ID
+func (b *Bot) componentInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	r := newInteractionResponder(s, i)
+	if i.GuildID == "" {
+		b.respondEphemeral(r, i, b.t(i, "error.servers_only"))
+		return
+	}
+	if !b.config().GuildAllowed(i.GuildID) {
+		logger.Warn("Refusing a button press from a server that isn't allowed", "guild", i.GuildID)
+		b.respondEphemeral(r, i, b.t(i, "error.server_not_allowed"))
+		return
+	}
+	switch customID := i.MessageComponentData().CustomID; {
+	case strings.HasPrefix(customID, lyricsButtonPrefix):
+		b.handleLyricsButton(s, i)
+	case strings.HasPrefix(customID, favButtonPrefix):
+		b.handleFavButton(s, i)
+	case strings.HasPrefix(customID, importButtonPrefix):
+		b.handleImportButton(s, i)
+	}
+}
 
-	var err error
-	switch data.Name {
+// commandHandler returns the handler for a command, or nil if there is no such command
+func (b *Bot) commandHandler(name string) commandHandler {
+	switch name {
 	case "play":
-		err = b.handlePlay(s, i)
+		return b.handlePlay
+	case "search":
+		return b.handleSearch
 	case "pause":
-		err = b.handlePause(s, i)
+		return b.handlePause
 	case "resume":
-		err = b.handleResume(s, i)
+		return b.handleResume
 	case "skip":
-		err = b.handleSkip(s, i)
+		return b.handleSkip
 	case "stop":
-		err = b.handleStop(s, i)
+		return b.handleStop
 	case "queue":
-		err = b.handleQueue(s, i)
+		return b.handleQueue
 	case "now-playing":
-		err = b.handleNowPlaying(s, i)
+		return b.handleNowPlaying
 	case "clear":
-		err = b.handleClear(s, i)
+		return b.handleClear
 	case "disconnect":
-		err = b.handleDisconnect(s, i)
+		return b.handleDisconnect
 	case "shuffle":
-		err = b.handleShuffle(s, i)
+		return b.handleShuffle
 	case "loop":
-		err = b.handleLoop(s, i)
+		return b.handleLoop
 	case "volume":
-		err = b.handleVolume(s, i)
+		return b.handleVolume
+	case "trackvolume":
+		return b.handleTrackVolume
 	case "seek":
-		err = b.handleSeek(s, i)
+		return b.handleSeek
 	case "fseek":
-		err = b.handleFSeek(s, i)
+		return b.handleFSeek
+	case "chapters":
+		return b.handleChapters
+	case "skipchapter":
+		return b.handleSkipChapter
+	case "abloop":
+		return b.handleABLoop
+	case "filter":
+		return b.handleFilter
 	case "move":
-		err = b.handleMove(s, i)
+		return b.handleMove
 	case "remove":
-		err = b.handleRemove(s, i)
+		return b.handleRemove
+	case "find":
+		return b.handleFind
+	case "lyrics":
+		return b.handleLyrics
+	case "notify":
+		return b.handleNotify
+	case "grab":
+		return b.handleGrab
+	case "fav":
+		return b.handleFav
+	case "sfx":
+		return b.handleSfx
+	case "blocklist":
+		return b.handleBlocklist
 	case "config":
-		err = b.handleConfig(s, i)
+		return b.handleConfig
+	case "cache":
+		return b.handleCache
+	case "debug":
+		return b.handleDebug
+	case "admin":
+		return b.handleAdmin
 	default:
-		err = fmt.Errorf("unknown command")
-	}
-
-	if err != nil {
-		b.respondError(s, i, err)
+		return nil
 	}
 }
-
-// respondError sends an error response
-func (b *Bot) respondError(s *discordgo.Session, i *discordgo.InteractionCreate, err error) {
-	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{
-			Content: fmt.Sprintf("🚫 ope: %v", err),
-			Flags:   discordgo.MessageFlagsEphemeral,
-		},
-	})
-}
-
-// respond sends a success response
-func (b *Bot) respond(s *discordgo.Session, i *discordgo.InteractionCreate, message string) {
-	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{
-			Content: message,
-		},
-	})
-}
-
-// respondEmbed sends an embed response
-func (b *Bot) respondEmbed(s *discordgo.Session, i *discordgo.InteractionCreate, embed *discordgo.MessageEmbed) {
-	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{
-			Embeds: []*discordgo.MessageEmbed{embed},
-		},
-	})
-}
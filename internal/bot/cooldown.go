@@ -0,0 +1,114 @@
+package bot
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/ratelimit"
+	"github.com/GrainedLotus515/gobard/internal/spotify"
+	"github.com/GrainedLotus515/gobard/internal/youtube"
+	"github.com/bwmarrin/discordgo"
+)
+
+// commandClass groups commands by how much work they cause, for rate limiting
+type commandClass int
+
+const (
+	// controlCommand is everything that only changes the bot's own state
+	controlCommand commandClass = iota
+	// searchCommand looks something up with yt-dlp or another service
+	searchCommand
+	// playlistCommand imports a playlist, album or several tracks at once
+	playlistCommand
+)
+
+// commandRates is how often each user may run each class of command in a server
+var commandRates = map[commandClass]ratelimit.Rate{
+	controlCommand:  {Burst: 15, Per: 30 * time.Second},
+	searchCommand:   {Burst: 5, Per: time.Minute},
+	playlistCommand: {Burst: 2, Per: 5 * time.Minute},
+}
+
+// cooldowns holds a rate limiter per command class, keyed by guild and user ID
+type cooldowns struct {
+	once     sync.Once
+	limiters map[commandClass]*ratelimit.Limiter
+}
+
+// allow takes a token for a command of a class, reporting how long to wait if there was none
+func (c *cooldowns) allow(class commandClass, guildID, userID string, now time.Time) (bool, time.Duration) {
+	c.once.Do(func() {
+		c.limiters = make(map[commandClass]*ratelimit.Limiter, len(commandRates))
+		for class, rate := range commandRates {
+			c.limiters[class] = ratelimit.New(rate)
+		}
+	})
+	return c.limiters[class].Allow(guildID+":"+userID, now)
+}
+
+// classifyCommand returns the class a command invocation is rate limited as
+func classifyCommand(name string, options []*discordgo.ApplicationCommandInteractionDataOption) commandClass {
+	switch name {
+	case "play":
+		query, _ := getStringOption(options, "query")
+		if isPlaylistQuery(query) {
+			return playlistCommand
+		}
+		return searchCommand
+	case "search", "lyrics":
+		return searchCommand
+	case "fav":
+		if len(options) == 0 {
+			return controlCommand
+		}
+		sub := options[0]
+		switch sub.Name {
+		case "play":
+			if which, _ := getStringOption(sub.Options, "which"); strings.EqualFold(which, "all") {
+				return playlistCommand
+			}
+			return searchCommand
+		case "add":
+			if query, _ := getStringOption(sub.Options, "query"); query != "" {
+				return searchCommand
+			}
+		}
+	}
+	return controlCommand
+}
+
+// isPlaylistQuery reports whether a /play query imports more than one track
+func isPlaylistQuery(query string) bool {
+	if spotify.IsSpotifyURL(query) {
+		kind, _, err := spotify.ParseSpotifyURL(query)
+		return err == nil && kind != "track"
+	}
+	if link, err := youtube.ParseURL(query); err == nil && link != nil {
+		return link.IsPlaylist()
+	}
+	// Apple Music and Deezer albums; Apple Music links to one of an album's songs add ?i=
+	return isURL(query) && (strings.Contains(query, "/playlist/") || (strings.Contains(query, "/album/") && !strings.Contains(query, "i=")))
+}
+
+// cooldownRefusal returns the error a command is refused with when its invoker ran too many
+// commands of its class lately, or nil
+// DJs and admins are exempt with RATE_LIMIT_EXEMPT_DJS
+func (b *Bot) cooldownRefusal(i *discordgo.InteractionCreate, name string) error {
+	cfg := b.config()
+	if cfg == nil || !cfg.RateLimit || i.Member == nil || i.Member.User == nil {
+		return nil
+	}
+	if cfg.RateLimitExemptDJs && b.IsDJ(i.GuildID, i.Member) {
+		return nil
+	}
+
+	class := classifyCommand(name, i.ApplicationCommandData().Options)
+	ok, wait := b.cooldowns.allow(class, i.GuildID, i.Member.User.ID, time.Now())
+	if ok {
+		return nil
+	}
+	return i18n.Error("ratelimit.slow_down", "seconds", int(math.Ceil(wait.Seconds())))
+}
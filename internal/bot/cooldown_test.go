@@ -0,0 +1,44 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestClassifyCommand(t *testing.T) {
+	query := func(value string) []*discordgo.ApplicationCommandInteractionDataOption {
+		return []*discordgo.ApplicationCommandInteractionDataOption{
+			{Name: "query", Type: discordgo.ApplicationCommandOptionString, Value: value},
+		}
+	}
+	favPlay := func(which string) []*discordgo.ApplicationCommandInteractionDataOption {
+		return []*discordgo.ApplicationCommandInteractionDataOption{{
+			Name:    "play",
+			Type:    discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandInteractionDataOption{{Name: "which", Type: discordgo.ApplicationCommandOptionString, Value: which}},
+		}}
+	}
+
+	tests := []struct {
+		name    string
+		options []*discordgo.ApplicationCommandInteractionDataOption
+		want    commandClass
+	}{
+		{"play", query("never gonna give you up"), searchCommand},
+		{"play", query("https://www.youtube.com/watch?v=dQw4w9WgXcQ"), searchCommand},
+		{"play", query("https://www.youtube.com/playlist?list=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI"), playlistCommand},
+		{"play", query("https://open.spotify.com/album/4aawyAB9vmqN3uQ7FjRGTy"), playlistCommand},
+		{"play", query("https://open.spotify.com/track/4cOdK2wGLETKBW3PvgPWqT"), searchCommand},
+		{"play", query("https://www.deezer.com/en/playlist/1234"), playlistCommand},
+		{"search", query("lofi"), searchCommand},
+		{"fav", favPlay("3"), searchCommand},
+		{"fav", favPlay("all"), playlistCommand},
+		{"skip", nil, controlCommand},
+	}
+	for _, tt := range tests {
+		if got := classifyCommand(tt.name, tt.options); got != tt.want {
+			t.Errorf("classifyCommand(%q, %v) = %d, want %d", tt.name, tt.options, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package bot
+
+import (
+	"cmp"
+	"context"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/bwmarrin/discordgo"
+)
+
+// slowCommand is how long a command may run before it is logged as slow
+const slowCommand = 2 * time.Second
+
+// commandTimeout is how long a command's lookups may take before they are given up on
+// It stays under the 15 minutes an interaction token lasts, so the user still hears about it
+const commandTimeout = 10 * time.Minute
+
+// commandHandler runs one slash command; a returned error is shown to the user
+// ctx ends when the command times out; work that outlives the command, like playback, must
+// not use it
+type commandHandler func(ctx context.Context, r responder, i *discordgo.InteractionCreate) error
+
+// commandStats counts how commands went since startup, for /debug stats
+type commandStats struct {
+	run, failed, panicked, slow atomic.Int64
+
+	mu      sync.Mutex
+	latency map[string]*commandLatency
+}
+
+// commandLatency is how long one command has taken
+type commandLatency struct {
+	Name  string
+	Count int64
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Average returns the mean time the command took
+func (l commandLatency) Average() time.Duration {
+	if l.Count == 0 {
+		return 0
+	}
+	return l.Total / time.Duration(l.Count)
+}
+
+// record adds a run of a command that took elapsed
+func (c *commandStats) record(name string, elapsed time.Duration) {
+	c.run.Add(1)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.latency == nil {
+		c.latency = make(map[string]*commandLatency)
+	}
+	l, ok := c.latency[name]
+	if !ok {
+		l = &commandLatency{Name: name}
+		c.latency[name] = l
+	}
+	l.Count++
+	l.Total += elapsed
+	l.Max = max(l.Max, elapsed)
+}
+
+// slowest returns up to n commands with the highest average latency, slowest first
+func (c *commandStats) slowest(n int) []commandLatency {
+	c.mu.Lock()
+	latencies := make([]commandLatency, 0, len(c.latency))
+	for _, l := range c.latency {
+		latencies = append(latencies, *l)
+	}
+	c.mu.Unlock()
+
+	slices.SortFunc(latencies, func(a, b commandLatency) int {
+		return cmp.Compare(b.Average(), a.Average())
+	})
+	return latencies[:min(n, len(latencies))]
+}
+
+// runCommand runs a command's handler, reporting its error to the user and timing it
+// A panic is logged with its stack and answered with a generic error instead of crashing
+// the bot for every server
+// Commands that change a server's playback or settings are posted to its audit channel when
+// they succeed, so handlers don't need to know about auditing
+// discordgo already calls each event handler in its own goroutine, so a slow command, like one
+// waiting on yt-dlp, doesn't hold up other servers' commands
+// Users who run too many commands of a class are asked to slow down before the handler runs
+// Handlers get a context that times out after commandTimeout, so a stuck lookup can't keep a
+// command running forever
+func (b *Bot) runCommand(r responder, i *discordgo.InteractionCreate, name string, handle commandHandler) {
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+		b.commands.record(name, elapsed)
+
+		if recovered := recover(); recovered != nil {
+			b.commands.panicked.Add(1)
+			logger.Error("Command panicked", "cmd", name, "guild", i.GuildID, "panic", recovered, "stack", string(debug.Stack()))
+			b.respondError(r, i, i18n.Error("error.panic", "command", name))
+			return
+		}
+		if elapsed > slowCommand {
+			b.commands.slow.Add(1)
+			logger.Warn("Slow command", "cmd", name, "guild", i.GuildID, "took", elapsed.Round(time.Millisecond))
+		}
+	}()
+
+	if err := b.cooldownRefusal(i, name); err != nil {
+		b.respondError(r, i, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	audit := b.beginAudit(i, name)
+	if err := handle(ctx, r, i); err != nil {
+		b.commands.failed.Add(1)
+		b.respondError(r, i, err)
+	} else if audit != nil {
+		b.finishAudit(i, name, audit)
+	}
+}
@@ -0,0 +1,118 @@
+package bot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// recordingTransport answers every Discord API request with 204, or with 200 and body if it
+// is set, and keeps each request's method, path and body
+type recordingTransport struct {
+	mu       sync.Mutex
+	requests []string
+	body     string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := ""
+	if req.Body != nil {
+		data, _ := io.ReadAll(req.Body)
+		body = string(data)
+	}
+	t.mu.Lock()
+	t.requests = append(t.requests, req.Method+" "+req.URL.Path+" "+body)
+	t.mu.Unlock()
+	if t.body != "" {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(t.body)), Header: make(http.Header), Request: req}, nil
+	}
+	return &http.Response{StatusCode: http.StatusNoContent, Body: http.NoBody, Header: make(http.Header), Request: req}, nil
+}
+
+func testInteraction(name string) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:      "1",
+		Token:   "token",
+		GuildID: "2",
+		Type:    discordgo.InteractionApplicationCommand,
+		Data:    discordgo.ApplicationCommandInteractionData{Name: name},
+	}}
+}
+
+func TestRunCommandRecoversFromPanic(t *testing.T) {
+	s, err := discordgo.New("Bot token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := &recordingTransport{}
+	s.Client = &http.Client{Transport: transport}
+
+	b := &Bot{}
+	i := testInteraction("boom")
+	b.runCommand(newInteractionResponder(s, i), i, "boom", func(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+		options := i.ApplicationCommandData().Options
+		_ = options[0].Name // Out of range
+		return nil
+	})
+
+	if got := b.commands.panicked.Load(); got != 1 {
+		t.Errorf("panicked = %d, want 1", got)
+	}
+	if len(transport.requests) != 1 || !strings.Contains(transport.requests[0], "something went wrong running /boom") {
+		t.Errorf("responses = %q, want one generic error", transport.requests)
+	}
+
+	// The bot keeps handling commands afterwards
+	ok := testInteraction("ok")
+	b.runCommand(newInteractionResponder(s, ok), ok, "ok", func(context.Context, responder, *discordgo.InteractionCreate) error { return nil })
+	if got := b.commands.run.Load(); got != 2 {
+		t.Errorf("run = %d, want 2", got)
+	}
+}
+
+func TestRunCommandGivesHandlersADeadline(t *testing.T) {
+	s, err := discordgo.New("Bot token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Client = &http.Client{Transport: &recordingTransport{}}
+
+	var got context.Context
+	b := &Bot{}
+	i := testInteraction("slow")
+	b.runCommand(newInteractionResponder(s, i), i, "slow", func(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+		got = ctx
+		deadline, ok := ctx.Deadline()
+		if !ok || time.Until(deadline) > commandTimeout {
+			t.Errorf("deadline = %v (set %v), want within %v", deadline, ok, commandTimeout)
+		}
+		return nil
+	})
+
+	// Lookups a command started are stopped once it returns
+	if got.Err() == nil {
+		t.Error("context still live after the command returned")
+	}
+}
+
+func TestCommandStatsSlowest(t *testing.T) {
+	var stats commandStats
+	stats.record("play", 3*time.Second)
+	stats.record("play", time.Second)
+	stats.record("skip", 10*time.Millisecond)
+	stats.record("queue", 2500*time.Millisecond)
+
+	slowest := stats.slowest(2)
+	if len(slowest) != 2 || slowest[0].Name != "queue" || slowest[1].Name != "play" {
+		t.Fatalf("slowest = %+v", slowest)
+	}
+	if slowest[1].Count != 2 || slowest[1].Average() != 2*time.Second || slowest[1].Max != 3*time.Second {
+		t.Errorf("play = %+v", slowest[1])
+	}
+}
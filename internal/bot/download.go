@@ -0,0 +1,150 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/cache"
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/GrainedLotus515/gobard/internal/youtube"
+	"github.com/bwmarrin/discordgo"
+)
+
+// Playback modes, deciding how tracks that aren't cached yet play
+const (
+	// playbackStreamFirst plays tracks from their download as it is written, streaming if
+	// it can't keep up
+	playbackStreamFirst = "stream-first"
+	// playbackDownloadFirst waits for tracks to download, for networks too flaky to stream
+	playbackDownloadFirst = "download-first"
+	// playbackAuto downloads tracks up to DOWNLOAD_FIRST_MAX_DURATION first and plays longer
+	// ones while they download
+	playbackAuto = "auto"
+)
+
+// downloadProgressInterval is how often the notice of a track downloading before it plays is
+// posted and updated
+const downloadProgressInterval = 3 * time.Second
+
+// playbackMode returns a guild's playback mode: its /config set-playback-mode choice, else
+// PLAYBACK_MODE
+func (b *Bot) playbackMode(p *player.GuildPlayer) string {
+	if mode := p.GetPlaybackMode(); mode != "" {
+		return mode
+	}
+	return b.config().PlaybackMode
+}
+
+// downloadsFirst reports whether a track that isn't cached waits for its download before
+// playing in a guild's playback mode
+func (b *Bot) downloadsFirst(p *player.GuildPlayer, track *player.Track) bool {
+	switch b.playbackMode(p) {
+	case playbackDownloadFirst:
+		return true
+	case playbackAuto:
+		return track.Duration > 0 && track.Duration <= b.config().DownloadFirstMaxDuration
+	}
+	return false
+}
+
+// playbackModeName shows a playback mode in a locale
+func playbackModeName(mode, locale string) string {
+	switch mode {
+	case playbackDownloadFirst:
+		return i18n.T(locale, "config.playback_download_first")
+	case playbackAuto:
+		return i18n.T(locale, "config.playback_auto")
+	}
+	return i18n.T(locale, "config.playback_stream_first")
+}
+
+// downloadTrack downloads a track into the cache and returns the cached file
+// Downloads that failed for good are remembered so the track streams for a while instead
+// Pre-encoding is left to the caller, so nothing waiting on the download waits for it too
+func (b *Bot) downloadTrack(ctx context.Context, url, key, title string, meta cache.Metadata) (string, error) {
+	logger.PlaybackDownloading(title)
+	path, err := b.Cache.GetOrCreate(ctx, key, meta, func(ctx context.Context, path string) error {
+		return b.YouTube.Download(ctx, url, path)
+	})
+	if errors.Is(err, context.Canceled) {
+		logger.Info("Background download cancelled", "title", title)
+		return "", err
+	}
+	if errors.Is(err, cache.ErrNoSpace) {
+		logger.Warn("Streaming without caching, the disk is almost full", "title", title, "err", err)
+		return "", err
+	}
+	if err != nil {
+		var downloadErr *youtube.DownloadError
+		if errors.As(err, &downloadErr) || errors.Is(err, cache.ErrTooLarge) || errors.Is(err, cache.ErrEmpty) {
+			b.failedDownloads.Store(key, time.Now())
+		}
+		logger.Error("Background download failed", "title", title, "err", err)
+		return "", err
+	}
+	logger.Info("Background download completed", "title", title)
+	return path, nil
+}
+
+// awaitDownload waits for the current track's download to report on done, posting a notice
+// in a channel that shows its progress once it takes a while
+// The notice is a message of its own: the play loop announces nothing per track, and the
+// /play reply that queued the track may have outlived its interaction token
+// It reports whether the download finished; it gives up when the download fails, takes
+// longer than DOWNLOAD_FIRST_TIMEOUT or the track stops being the current one, and the track
+// streams instead
+func (b *Bot) awaitDownload(p *player.GuildPlayer, channelID string, track *player.Track, key string, done <-chan error) bool {
+	timeout := time.NewTimer(b.config().DownloadFirstTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(downloadProgressInterval)
+	defer ticker.Stop()
+
+	var notice *discordgo.Message
+	defer func() {
+		if notice != nil {
+			b.Session.ChannelMessageDelete(channelID, notice.ID)
+		}
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			return err == nil
+		case <-timeout.C:
+			logger.Warn("Download took too long, streaming instead", "title", track.Title, "timeout", b.config().DownloadFirstTimeout)
+			return false
+		case <-ticker.C:
+			if p.Queue.Current() != track {
+				return false
+			}
+			written, ok := b.Cache.Downloaded(key)
+			if !ok {
+				continue
+			}
+			text := downloadNotice(track, written, b.guildLocale(p.GuildID))
+			var err error
+			if notice == nil {
+				notice, err = b.Session.ChannelMessageSend(channelID, text)
+			} else {
+				_, err = b.Session.ChannelMessageEdit(channelID, notice.ID, text)
+			}
+			if err != nil {
+				logger.Debug("Failed to show download progress", "guild", p.GuildID, "err", err)
+			}
+		}
+	}
+}
+
+// downloadNotice tells a channel how far a track's download has got: a percentage of its
+// estimated size when its length is known, else the size so far
+func downloadNotice(track *player.Track, written int64, locale string) string {
+	if estimate := int64(track.Duration.Seconds() * typicalBitrate / 8); estimate > 0 {
+		percent := min(written*100/estimate, 99)
+		return i18n.T(locale, "playback.downloading", "title", track.Title, "progress", fmt.Sprintf("%d%%", percent))
+	}
+	return i18n.T(locale, "playback.downloading", "title", track.Title, "progress", fmt.Sprintf("%.1f MB", float64(written)/(1<<20)))
+}
@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/config"
+	"github.com/GrainedLotus515/gobard/internal/player"
+)
+
+func TestDownloadsFirst(t *testing.T) {
+	b := &Bot{Config: &config.Config{PlaybackMode: playbackStreamFirst, DownloadFirstMaxDuration: 10 * time.Minute}}
+	p := player.NewManager().GetPlayer("guild")
+	song := &player.Track{Duration: 4 * time.Minute}
+	mix := &player.Track{Duration: time.Hour}
+	unknown := &player.Track{}
+
+	if b.downloadsFirst(p, song) {
+		t.Error("stream-first mode downloads first")
+	}
+
+	p.SetPlaybackMode(playbackAuto)
+	if !b.downloadsFirst(p, song) || b.downloadsFirst(p, mix) || b.downloadsFirst(p, unknown) {
+		t.Error("auto mode should download only tracks known to be short first")
+	}
+
+	p.SetPlaybackMode(playbackDownloadFirst)
+	if !b.downloadsFirst(p, mix) || !b.downloadsFirst(p, unknown) {
+		t.Error("download-first mode streams a track")
+	}
+}
+
+func TestDownloadNotice(t *testing.T) {
+	song := &player.Track{Title: "Song", Duration: 100 * time.Second}
+	// 100s at 160 kbps is about 2 MB
+	if got, want := downloadNotice(song, 1_000_000, "en-US"), "⬇️ Downloading **Song** before it plays… 50%"; got != want {
+		t.Errorf("downloadNotice = %q, want %q", got, want)
+	}
+	if got, want := downloadNotice(song, 5_000_000, "en-US"), "⬇️ Downloading **Song** before it plays… 99%"; got != want {
+		t.Errorf("downloadNotice past the estimate = %q, want %q", got, want)
+	}
+	if got, want := downloadNotice(&player.Track{Title: "Stream"}, 3<<20, "en-US"), "⬇️ Downloading **Stream** before it plays… 3.0 MB"; got != want {
+		t.Errorf("downloadNotice without a length = %q, want %q", got, want)
+	}
+}
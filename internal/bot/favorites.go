@@ -0,0 +1,328 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/GrainedLotus515/gobard/internal/youtube"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// favoritesStoreFile is where users' /fav lists are kept, relative to the cache directory
+	favoritesStoreFile = "users/favorites.json"
+	// favoritesLimit is the most favorites one user can keep
+	favoritesLimit = 100
+	// favoritesPageSize is how many favorites one page of /fav list shows
+	favoritesPageSize = 10
+	// favoritesResolveWorkers is how many favorites /fav play all looks up at once
+	favoritesResolveWorkers = 4
+	// favButtonPrefix starts the custom IDs of /fav list page buttons, followed by the page
+	// they turn to
+	favButtonPrefix = "fav:"
+)
+
+// favorite is a track a user saved with /fav add; it is looked up again when played, as
+// stream URLs expire
+type favorite struct {
+	Title    string        `json:"title"`
+	Artist   string        `json:"artist"`
+	URL      string        `json:"url"`
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// newFavorite saves what's needed to find a track again
+func newFavorite(track *player.Track) favorite {
+	return favorite{Title: track.Title, Artist: track.Artist, URL: track.URL, Duration: track.Duration}
+}
+
+// query is what a favorite is resolved from: its URL, or a search for tracks without one
+func (f favorite) query() string {
+	if f.URL != "" {
+		return f.URL
+	}
+	return f.Artist + " " + f.Title
+}
+
+// addFavorite appends a favorite to a list, refusing duplicates and lists that are full
+func addFavorite(favorites []favorite, fav favorite) ([]favorite, error) {
+	for _, existing := range favorites {
+		if existing.query() == fav.query() {
+			return nil, i18n.Error("fav.exists", "title", fav.Title)
+		}
+	}
+	if len(favorites) >= favoritesLimit {
+		return nil, i18n.Error("fav.full", "limit", favoritesLimit)
+	}
+	return append(favorites, fav), nil
+}
+
+// handleFav handles the fav command
+func (b *Bot) handleFav(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	if b.favorites == nil {
+		return i18n.Error("fav.unavailable")
+	}
+	subCmd, err := subcommand(i.ApplicationCommandData().Options)
+	if err != nil {
+		return err
+	}
+
+	switch subCmd.Name {
+	case "add":
+		return b.favAdd(ctx, r, i, subCmd.Options)
+	case "list":
+		favorites, _ := b.favorites.Get(i.Member.User.ID)
+		if len(favorites) == 0 {
+			b.respondEphemeral(r, i, b.t(i, "fav.empty"))
+			return nil
+		}
+		b.reply(r, i, &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{favoritesEmbed(favorites, 0, b.locale(i))},
+			Components: pageButtons(favButtonPrefix, 0, favoritesPages(favorites)),
+			Flags:      discordgo.MessageFlagsEphemeral,
+		})
+		return nil
+	case "play":
+		return b.favPlay(ctx, r, i, subCmd.Options)
+	case "remove":
+		n, ok := getIntOption(subCmd.Options, "number")
+		if !ok {
+			return missingOption("number")
+		}
+		var removed favorite
+		err := b.favorites.Update(i.Member.User.ID, func(favorites []favorite, _ bool) ([]favorite, error) {
+			if n < 1 || n > len(favorites) {
+				return nil, i18n.Error("fav.invalid_number", "count", len(favorites))
+			}
+			removed = favorites[n-1]
+			return append(favorites[:n-1:n-1], favorites[n:]...), nil
+		})
+		if err != nil {
+			return err
+		}
+		b.respondEphemeral(r, i, b.t(i, "fav.removed", "title", removed.Title))
+		return nil
+	default:
+		return i18n.Error("error.unknown_subcommand")
+	}
+}
+
+// favAdd saves the playing track, or the one a query finds, to the invoker's favorites
+func (b *Bot) favAdd(ctx context.Context, r responder, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) error {
+	p := b.PlayerManager.GetPlayer(i.GuildID)
+
+	var track *player.Track
+	if query, ok := getStringOption(options, "query"); ok && query != "" {
+		b.deferResponse(r, i, confirmation)
+		tracks, playlist, err := b.resolveQuery(ctx, query, i.Member.User.ID, p, youtube.PlaylistOptions{Limit: 1})
+		if err != nil {
+			return err
+		}
+		if playlist != nil {
+			return i18n.Error("fav.playlist")
+		}
+		if len(tracks) == 0 {
+			return i18n.Error("error.no_songs")
+		}
+		track = tracks[0]
+	} else if track = p.Queue.Current(); track == nil {
+		return i18n.Error("fav.nothing_playing")
+	}
+
+	fav := newFavorite(track)
+	var count int
+	err := b.favorites.Update(i.Member.User.ID, func(favorites []favorite, _ bool) ([]favorite, error) {
+		favorites, err := addFavorite(favorites, fav)
+		count = len(favorites)
+		return favorites, err
+	})
+	if err != nil {
+		return err
+	}
+	b.respondEphemeral(r, i, b.t(i, "fav.added", "title", fav.Title, "number", count))
+	return nil
+}
+
+// favPlay queues one of the invoker's favorites, or all of them, looking each up again
+func (b *Bot) favPlay(ctx context.Context, r responder, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) error {
+	which, ok := getStringOption(options, "which")
+	if !ok {
+		return missingOption("which")
+	}
+	favorites, _ := b.favorites.Get(i.Member.User.ID)
+	if len(favorites) == 0 {
+		return i18n.Error("fav.empty")
+	}
+	if !strings.EqualFold(which, "all") {
+		n, err := strconv.Atoi(strings.TrimSpace(which))
+		if err != nil || n < 1 || n > len(favorites) {
+			return i18n.Error("fav.invalid_number", "count", len(favorites))
+		}
+		favorites = favorites[n-1 : n]
+	}
+	if err := b.quietHoursRefusal(i, false); err != nil {
+		return err
+	}
+
+	p, err := b.joinInvoker(i)
+	if err != nil {
+		return err
+	}
+	b.deferResponse(r, i, announcement)
+
+	// A single favorite reports why it can't be played; of several, those are skipped
+	locale := b.locale(i)
+	favorites = favorites[:min(len(favorites), b.config().MaxPlaylistSize)]
+	found, errs := b.resolveFavorites(ctx, r, p, favorites, i.Member.User.ID, locale)
+	var tracks []*player.Track
+	skipped := 0
+	for n, err := range errs {
+		if err != nil {
+			if len(favorites) == 1 {
+				return err
+			}
+			logger.Debug("Skipping a favorite", "title", favorites[n].Title, "err", err)
+			skipped++
+			continue
+		}
+		tracks = append(tracks, found[n])
+	}
+	if len(tracks) == 0 {
+		return i18n.Error("error.no_songs")
+	}
+
+	current, ahead := p.Queue.AddAll(tracks)
+	ahead, placed := interleaveRequesters(p, tracks, ahead, false)
+	placement := b.queuePlacementFields(p, current, ahead, placed, locale)
+	p.EnsureLoop(func() { b.playLoop(i.GuildID, i.ChannelID) })
+
+	embed := &discordgo.MessageEmbed{
+		Title:       i18n.T(locale, "play.added"),
+		Description: i18n.T(locale, "track.by", "title", tracks[0].Title, "artist", tracks[0].Artist),
+		Color:       0x00ff00,
+		Fields:      placement,
+	}
+	if len(tracks) == 1 {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: tracks[0].Thumbnail}
+	} else {
+		embed.Description = i18n.T(locale, "play.added_tracks", "count", len(tracks))
+	}
+	if skipped > 0 {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: i18n.T(locale, "fav.skipped", "count", skipped)}
+	}
+	b.respondEmbed(r, i, announcement, embed)
+	return nil
+}
+
+// resolveFavorites looks favorites up again, favoritesResolveWorkers at a time with yt-dlp's
+// limiter bounding the processes, editing the deferred response with how far it got
+// It returns the track found for each favorite, or why it can't be played
+func (b *Bot) resolveFavorites(ctx context.Context, r responder, p *player.GuildPlayer, favorites []favorite, userID, locale string) ([]*player.Track, []error) {
+	found := make([]*player.Track, len(favorites))
+	errs := make([]error, len(favorites))
+	next := make(chan int)
+	done := make(chan struct{})
+	for range min(favoritesResolveWorkers, len(favorites)) {
+		go func() {
+			for n := range next {
+				found[n], errs[n] = b.resolveFavorite(ctx, p, favorites[n], userID)
+				done <- struct{}{}
+			}
+		}()
+	}
+	go func() {
+		defer close(next)
+		for n := range favorites {
+			next <- n
+		}
+	}()
+
+	progress := importProgress(r, locale)
+	for n := range favorites {
+		<-done
+		progress(n+1, len(favorites))
+	}
+	return found, errs
+}
+
+// resolveFavorite looks one favorite up again, refusing a track the server doesn't allow
+func (b *Bot) resolveFavorite(ctx context.Context, p *player.GuildPlayer, fav favorite, userID string) (*player.Track, error) {
+	found, playlist, err := b.resolveQuery(ctx, fav.query(), userID, p, youtube.PlaylistOptions{Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if playlist != nil || len(found) == 0 {
+		return nil, i18n.Error("error.no_songs")
+	}
+	if reason := b.refusal(p, found[0]); reason != nil {
+		return nil, i18n.Error("play.refused", "title", found[0].Title, "reason", reason)
+	}
+	return found[0], nil
+}
+
+// handleFavButton turns the page of a /fav list response
+func (b *Bot) handleFavButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	page, _ := strconv.Atoi(strings.TrimPrefix(i.MessageComponentData().CustomID, favButtonPrefix))
+
+	var favorites []favorite
+	if b.favorites != nil && i.Member != nil && i.Member.User != nil {
+		favorites, _ = b.favorites.Get(i.Member.User.ID)
+	}
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    b.t(i, "fav.empty"),
+			Embeds:     []*discordgo.MessageEmbed{},
+			Components: []discordgo.MessageComponent{},
+		},
+	}
+	if len(favorites) > 0 {
+		pages := favoritesPages(favorites)
+		page = max(0, min(page, pages-1))
+		response.Data = &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{favoritesEmbed(favorites, page, b.locale(i))},
+			Components: pageButtons(favButtonPrefix, page, pages),
+		}
+	}
+	if err := s.InteractionRespond(i.Interaction, response); err != nil {
+		logger.Warn("Failed to turn the favorites page", "guild", i.GuildID, "err", err)
+	}
+}
+
+// favoritesPages is how many pages of /fav list a list of favorites takes
+func favoritesPages(favorites []favorite) int {
+	return (len(favorites) + favoritesPageSize - 1) / favoritesPageSize
+}
+
+// favoritesEmbed shows one page of a user's favorites, numbered as /fav play and /fav remove
+// take them
+func favoritesEmbed(favorites []favorite, page int, locale string) *discordgo.MessageEmbed {
+	start := page * favoritesPageSize
+	end := min(len(favorites), start+favoritesPageSize)
+
+	var builder strings.Builder
+	for idx, fav := range favorites[start:end] {
+		fmt.Fprintf(&builder, "%d. **%s** - %s", start+idx+1, fav.Title, fav.Artist)
+		if fav.Duration > 0 {
+			fmt.Fprintf(&builder, " (%s)", formatDuration(fav.Duration))
+		}
+		builder.WriteString("\n")
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       i18n.T(locale, "fav.title"),
+		Description: builder.String(),
+		Color:       0x0099ff,
+		Footer:      &discordgo.MessageEmbedFooter{Text: i18n.T(locale, "fav.footer", "count", len(favorites), "limit", favoritesLimit)},
+	}
+	if pages := favoritesPages(favorites); pages > 1 {
+		embed.Footer.Text += " · " + i18n.T(locale, "fav.page", "page", page+1, "pages", pages)
+	}
+	return embed
+}
@@ -0,0 +1,80 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/player"
+)
+
+func TestAddFavorite(t *testing.T) {
+	song := favorite{Title: "Song", Artist: "Band", URL: "https://youtu.be/abc"}
+	favorites, err := addFavorite(nil, song)
+	if err != nil || len(favorites) != 1 {
+		t.Fatalf("addFavorite = %v, %v", favorites, err)
+	}
+	if _, err := addFavorite(favorites, song); err == nil {
+		t.Error("addFavorite saved the same song twice")
+	}
+
+	// Favorites without a URL are told apart by their search
+	other := favorite{Title: "Other", Artist: "Band"}
+	if favorites, err = addFavorite(favorites, other); err != nil || len(favorites) != 2 {
+		t.Fatalf("addFavorite = %v, %v", favorites, err)
+	}
+	if other.query() != "Band Other" {
+		t.Errorf("query() = %q, want a search", other.query())
+	}
+
+	full := make([]favorite, favoritesLimit)
+	for idx := range full {
+		full[idx] = favorite{URL: fmt.Sprintf("https://youtu.be/%d", idx)}
+	}
+	if _, err := addFavorite(full, song); err == nil {
+		t.Error("addFavorite went past the limit")
+	}
+}
+
+func TestFavoritesEmbed(t *testing.T) {
+	favorites := make([]favorite, 23)
+	for idx := range favorites {
+		favorites[idx] = favorite{Title: fmt.Sprintf("Song %d", idx+1), Artist: "Band"}
+	}
+	if pages := favoritesPages(favorites); pages != 3 {
+		t.Fatalf("favoritesPages = %d, want 3", pages)
+	}
+
+	embed := favoritesEmbed(favorites, 2, "en-US")
+	lines := strings.Split(strings.TrimSpace(embed.Description), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "21. **Song 21**") {
+		t.Errorf("last page = %q, want favorites 21 to 23", embed.Description)
+	}
+	if !strings.Contains(embed.Footer.Text, "3/3") {
+		t.Errorf("footer = %q, want the page", embed.Footer.Text)
+	}
+}
+
+func TestResolveFavoritesKeepsTheirOrder(t *testing.T) {
+	s, _ := testSession(t)
+	b := &Bot{}
+	i := testInteraction("fav")
+	p := player.NewManager().GetPlayer(i.GuildID)
+
+	// Spotify links fail at once without a Spotify client, so nothing reaches yt-dlp
+	var favorites []favorite
+	for n := range 10 {
+		favorites = append(favorites, favorite{Title: fmt.Sprint(n), URL: fmt.Sprintf("https://open.spotify.com/track/%d", n)})
+	}
+	found, errs := b.resolveFavorites(context.Background(), newInteractionResponder(s, i), p, favorites, "user", i18n.Default)
+	if len(found) != len(favorites) || len(errs) != len(favorites) {
+		t.Fatalf("got %d tracks and %d errors for %d favorites", len(found), len(errs), len(favorites))
+	}
+	for n, err := range errs {
+		if message, ok := err.(*i18n.Message); !ok || message.Key != "play.spotify_disabled" || found[n] != nil {
+			t.Errorf("favorite %d: track %v, error %v; want play.spotify_disabled", n, found[n], err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package bot
+
+import (
+	"sync"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/bwmarrin/discordgo"
+)
+
+// followDebounce is how long voice channels must settle before the bot follows a requester,
+// so hopping through a few channels moves it once
+const followDebounce = 3 * time.Second
+
+// followDebouncer runs one pending follow check per guild, pushed back by every voice change
+type followDebouncer struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+// schedule runs check for a guild once there have been no voice changes for delay
+func (d *followDebouncer) schedule(guildID string, delay time.Duration, check func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if timer, ok := d.timers[guildID]; ok {
+		timer.Stop()
+	}
+	if d.timers == nil {
+		d.timers = make(map[string]*time.Timer)
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		d.mu.Lock()
+		if d.timers[guildID] == timer {
+			delete(d.timers, guildID)
+		}
+		d.mu.Unlock()
+		check()
+	})
+	d.timers[guildID] = timer
+}
+
+// considerFollowing schedules a follow check after someone's voice state changed in a guild
+// whose player follows the current track's requester
+func (b *Bot) considerFollowing(guildID string) {
+	p := b.PlayerManager.GetPlayer(guildID)
+	if !p.FollowsRequester() || !p.IsVoiceConnected() || p.Queue.Current() == nil {
+		return
+	}
+	b.follows.schedule(guildID, followDebounce, func() { b.followRequester(guildID) })
+}
+
+// followRequester moves the bot into the current track's requester's voice channel if it
+// should, pausing while it moves
+func (b *Bot) followRequester(guildID string) {
+	p := b.PlayerManager.GetPlayer(guildID)
+	track := p.Queue.Current()
+	if !p.FollowsRequester() || !p.IsVoiceConnected() || track == nil {
+		return
+	}
+
+	guild, err := b.Session.State.Guild(guildID)
+	if err != nil {
+		return
+	}
+	botID := b.Session.State.User.ID
+	b.Session.State.RLock()
+	target := followTarget(guild, botID, track.RequestedBy, p.GetVoiceChannelID())
+	b.Session.State.RUnlock()
+	if target == "" {
+		return
+	}
+
+	// Never follow into a channel the bot couldn't play in
+	const needed = discordgo.PermissionVoiceConnect | discordgo.PermissionVoiceSpeak
+	perms, err := b.Session.State.UserChannelPermissions(botID, target)
+	if err != nil || perms&needed != needed {
+		logger.Debug("Not following requester into a channel without Connect and Speak", "guild", guildID, "channel", target)
+		return
+	}
+
+	resume := p.IsPlaying()
+	if resume {
+		p.Pause()
+	}
+	if err := p.MoveTo(target); err != nil {
+		logger.Warn("Failed to follow requester", "guild", guildID, "channel", target, "err", err)
+	} else {
+		p.SetChannelBitrate(b.ChannelBitrate(target))
+		logger.Info("Followed requester to another voice channel", "guild", guildID, "channel", target, "user", track.RequestedBy)
+	}
+	if resume {
+		p.Resume()
+	}
+}
+
+// followTarget returns the voice channel to follow a requester into, or "" to stay: they must
+// be in another channel that isn't the AFK channel, and nobody else may be listening in the
+// bot's channel; the caller must hold the state's lock
+func followTarget(guild *discordgo.Guild, botID, requesterID, botChannelID string) string {
+	target := ""
+	for _, vs := range guild.VoiceStates {
+		if vs.UserID == requesterID {
+			target = vs.ChannelID
+		}
+	}
+	if target == "" || target == botChannelID || target == guild.AfkChannelID {
+		return ""
+	}
+
+	for _, vs := range guild.VoiceStates {
+		if vs.ChannelID != botChannelID || vs.UserID == botID {
+			continue
+		}
+		if vs.Member != nil && vs.Member.User != nil && vs.Member.User.Bot {
+			continue
+		}
+		return ""
+	}
+	return target
+}
@@ -0,0 +1,49 @@
+package bot
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestFollowTarget(t *testing.T) {
+	listener := func(userID, channelID string, bot bool) *discordgo.VoiceState {
+		return &discordgo.VoiceState{UserID: userID, ChannelID: channelID, Member: &discordgo.Member{User: &discordgo.User{ID: userID, Bot: bot}}}
+	}
+	tests := []struct {
+		name   string
+		states []*discordgo.VoiceState
+		want   string
+	}{
+		{"requester moved, nobody left", []*discordgo.VoiceState{listener("bot", "a", true), listener("dj", "b", false)}, "b"},
+		{"other bots don't count as listeners", []*discordgo.VoiceState{listener("bot", "a", true), listener("other-bot", "a", true), listener("dj", "b", false)}, "b"},
+		{"someone still listening", []*discordgo.VoiceState{listener("bot", "a", true), listener("friend", "a", false), listener("dj", "b", false)}, ""},
+		{"requester in the bot's channel", []*discordgo.VoiceState{listener("bot", "a", true), listener("dj", "a", false)}, ""},
+		{"requester left voice", []*discordgo.VoiceState{listener("bot", "a", true)}, ""},
+		{"requester went AFK", []*discordgo.VoiceState{listener("bot", "a", true), listener("dj", "afk", false)}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guild := &discordgo.Guild{AfkChannelID: "afk", VoiceStates: tt.states}
+			if got := followTarget(guild, "bot", "dj", "a"); got != tt.want {
+				t.Errorf("followTarget() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFollowDebouncerRunsOnceAfterHops(t *testing.T) {
+	var d followDebouncer
+	var runs atomic.Int32
+	for range 5 {
+		d.schedule("guild", 50*time.Millisecond, func() { runs.Add(1) })
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if n := runs.Load(); n != 1 {
+		t.Errorf("check ran %d times, want once after the hops settled", n)
+	}
+}
@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxGuildListLength keeps /admin guilds within an embed description's 4096 characters
+const maxGuildListLength = 4000
+
+// guildCreate leaves servers that ALLOWED_GUILD_IDS and BLOCKED_GUILD_IDS don't allow
+// Discord sends it for every server when the bot connects and whenever it is added to one
+func (b *Bot) guildCreate(s *discordgo.Session, event *discordgo.GuildCreate) {
+	if event.Unavailable || b.config().GuildAllowed(event.ID) {
+		return
+	}
+	b.leaveGuild(s, event.Guild)
+}
+
+// leaveGuild posts GUILD_LEAVE_MESSAGE in a server's system channel, if both are set, and leaves it
+func (b *Bot) leaveGuild(s *discordgo.Session, guild *discordgo.Guild) {
+	logger.Warn("Leaving a server that isn't allowed", "guild", guild.ID, "name", guild.Name, "members", guild.MemberCount)
+
+	if message := b.config().GuildLeaveMessage; message != "" && guild.SystemChannelID != "" {
+		if _, err := s.ChannelMessageSend(guild.SystemChannelID, message); err != nil {
+			logger.Debug("Failed to post the leave message", "guild", guild.ID, "err", err)
+		}
+	}
+	if err := s.GuildLeave(guild.ID); err != nil {
+		logger.Error("Failed to leave server", "guild", guild.ID, "err", err)
+	}
+}
+
+// leaveDisallowedGuilds leaves every server the configuration no longer allows, after a reload
+func (b *Bot) leaveDisallowedGuilds(s *discordgo.Session) {
+	cfg := b.config()
+	for _, guild := range stateGuilds(s) {
+		if !cfg.GuildAllowed(guild.ID) {
+			b.leaveGuild(s, guild)
+		}
+	}
+}
+
+// stateGuilds returns the servers the bot is in
+func stateGuilds(s *discordgo.Session) []*discordgo.Guild {
+	s.State.RLock()
+	defer s.State.RUnlock()
+	return slices.Clone(s.State.Guilds)
+}
+
+// guildListEmbed lists servers by member count, largest first
+func guildListEmbed(guilds []*discordgo.Guild) *discordgo.MessageEmbed {
+	sorted := slices.Clone(guilds)
+	slices.SortFunc(sorted, func(a, b *discordgo.Guild) int {
+		return cmp.Or(cmp.Compare(b.MemberCount, a.MemberCount), strings.Compare(a.Name, b.Name))
+	})
+
+	var sb strings.Builder
+	members := 0
+	for n, guild := range sorted {
+		members += guild.MemberCount
+		line := fmt.Sprintf("**%s** (`%s`): %d members\n", guild.Name, guild.ID, guild.MemberCount)
+		if sb.Len()+len(line) > maxGuildListLength {
+			fmt.Fprintf(&sb, "…and %d more", len(sorted)-n)
+			for _, rest := range sorted[n+1:] {
+				members += rest.MemberCount
+			}
+			break
+		}
+		sb.WriteString(line)
+	}
+	if len(sorted) == 0 {
+		sb.WriteString("The bot isn't in any servers")
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("🏠 Servers (%d)", len(sorted)),
+		Description: sb.String(),
+		Footer:      &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("%d members in total", members)},
+		Color:       0x0099ff,
+	}
+}
@@ -1,199 +1,580 @@
 package bot
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"math/rand"
+	"math"
+	"net/url"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/GrainedLotus515/gobard/internal/applemusic"
 	"github.com/GrainedLotus515/gobard/internal/cache"
+	"github.com/GrainedLotus515/gobard/internal/deezer"
+	"github.com/GrainedLotus515/gobard/internal/i18n"
 	"github.com/GrainedLotus515/gobard/internal/logger"
 	"github.com/GrainedLotus515/gobard/internal/player"
 	"github.com/GrainedLotus515/gobard/internal/spotify"
+	"github.com/GrainedLotus515/gobard/internal/webmeta"
 	"github.com/GrainedLotus515/gobard/internal/youtube"
 	"github.com/bwmarrin/discordgo"
 )
 
 // handlePlay handles the play command
-func (b *Bot) handlePlay(s *discordgo.Session, i *discordgo.InteractionCreate) error {
-	query := i.ApplicationCommandData().Options[0].StringValue()
-
-	// Get user's voice channel
-	channelID, err := b.GetVoiceChannel(i.GuildID, i.Member.User.ID)
-	if err != nil {
-		return fmt.Errorf("you must be in a voice channel to play music")
+func (b *Bot) handlePlay(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	var query string
+	opts := youtube.PlaylistOptions{Limit: b.config().MaxPlaylistSize}
+	force := false
+	interleave := false
+	volumeOffset := 0
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "query":
+			query = option.StringValue()
+		case "limit":
+			opts.Limit = min(int(option.IntValue()), b.config().MaxPlaylistSize)
+		case "offset":
+			opts.Offset = int(option.IntValue())
+		case "volume":
+			level := int(option.IntValue())
+			if level < player.MinTrackVolume || level > player.MaxTrackVolume {
+				return i18n.Error("trackvolume.invalid", "min", player.MinTrackVolume, "max", player.MaxTrackVolume)
+			}
+			volumeOffset = level - 100
+		case "force":
+			force = option.BoolValue()
+		case "interleave":
+			interleave = option.BoolValue()
+		}
+	}
+	if query == "" {
+		return missingOption("query")
+	}
+	if err := b.quietHoursRefusal(i, force); err != nil {
+		return err
 	}
 
-	// Get or create player
-	p := b.PlayerManager.GetPlayer(i.GuildID)
-
-	// Join voice channel if not already connected
-	if p.VoiceConnection == nil {
-		vc, err := b.JoinVoiceChannel(i.GuildID, channelID)
-		if err != nil {
-			return err
-		}
-		p.VoiceConnection = vc
+	p, err := b.joinInvoker(i)
+	if err != nil {
+		return err
 	}
 
 	// Defer the response since this might take a while
-	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
-	})
+	b.deferResponse(r, i, announcement)
 
-	// Parse the query and get tracks
-	tracks, err := b.resolveQuery(query, i.Member.User.ID)
+	// Parse the query and get tracks, showing progress while a playlist imports
+	locale := b.locale(i)
+	opts.Progress = importProgress(r, locale)
+	tracks, playlist, err := b.resolveQuery(ctx, query, i.Member.User.ID, p, opts)
 	if err != nil {
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-			Content: ptrString(fmt.Sprintf("🚫 ope: %v", err)),
-		})
-		return nil
+		return err
+	}
+
+	// Leave out tracks this server doesn't allow
+	if playlist == nil {
+		for _, track := range tracks {
+			if reason := b.refusal(p, track); reason != nil {
+				return i18n.Error("play.refused", "title", track.Title, "reason", reason)
+			}
+		}
+	} else if tracks = b.allowedTracks(p, tracks, playlist); len(tracks) == 0 && playlist.TooLong+playlist.Live+playlist.Blocked > 0 {
+		return i18n.Error("play.none_allowed", "summary", importSummary(playlist, locale))
 	}
 
 	if len(tracks) == 0 {
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-			Content: ptrString("🚫 ope: no songs found"),
-		})
-		return nil
+		return i18n.Error("error.no_songs")
 	}
 
 	// Add tracks to queue
 	for _, track := range tracks {
-		p.Queue.Add(track)
+		track.VolumeOffset = volumeOffset
 	}
+	current, ahead := p.Queue.AddAll(tracks)
+	ahead, placed := interleaveRequesters(p, tracks, ahead, interleave)
+	placement := b.queuePlacementFields(p, current, ahead, placed, locale)
 
 	// Start playing if playback loop is not already running
-	if !p.IsLoopRunning() {
-		p.SetLoopRunning(true)
-		go b.playLoop(i.GuildID, i.ChannelID)
-	}
+	p.EnsureLoop(func() { b.playLoop(i.GuildID, i.ChannelID) })
 
 	// Send response
-	if len(tracks) == 1 {
+	if len(tracks) == 1 && (playlist == nil || len(playlist.Missing) == 0) {
+		description := i18n.T(locale, "track.by", "title", tracks[0].Title, "artist", tracks[0].Artist)
+		if tracks[0].IsLive {
+			description += "\n" + i18n.T(locale, "track.live")
+		} else if tracks[0].StartAt > 0 {
+			description += "\n" + i18n.T(locale, "play.starting_at", "position", formatDuration(tracks[0].StartAt))
+		}
 		embed := &discordgo.MessageEmbed{
-			Title:       "Added to queue",
-			Description: fmt.Sprintf("**%s**\nby %s", tracks[0].Title, tracks[0].Artist),
+			Title:       i18n.T(locale, "play.added"),
+			Description: description,
 			Color:       0x00ff00,
 			Thumbnail: &discordgo.MessageEmbedThumbnail{
 				URL: tracks[0].Thumbnail,
 			},
+			Fields: placement,
+		}
+		b.respondEmbed(r, i, announcement, embed)
+	} else if playlist != nil {
+		embed := playlistEmbed(playlist, locale)
+		embed.Fields = placement
+		b.respondEmbed(r, i, announcement, embed)
+
+		// Small imports from other services are matched right away, so the summary can
+		// tell which tracks weren't found and offer to retry them
+		if matchesEagerly(tracks) {
+			record := &importRecord{
+				id:           i.ID,
+				userID:       i.Member.User.ID,
+				channelID:    i.ChannelID,
+				volumeOffset: volumeOffset,
+				locale:       locale,
+				embed:        embed,
+			}
+			b.imports.put(record)
+			go b.matchImport(r, p, tracks, record)
 		}
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-			Embeds: &[]*discordgo.MessageEmbed{embed},
-		})
 	} else {
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-			Content: ptrString(fmt.Sprintf("✅ Added %d tracks to queue", len(tracks))),
+		b.respondEmbed(r, i, announcement, &discordgo.MessageEmbed{
+			Title:       i18n.T(locale, "play.added"),
+			Description: i18n.T(locale, "play.added_tracks", "count", len(tracks)),
+			Color:       0x00ff00,
+			Fields:      placement,
+		})
+	}
+
+	return nil
+}
+
+// importProgressInterval is the minimum time between playlist import progress edits
+const importProgressInterval = 3 * time.Second
+
+// importProgress returns a callback that edits a deferred response with playlist import progress
+// A prefix command has no response to edit until it is answered, so it shows no progress
+func importProgress(r responder, locale string) func(resolved, total int) {
+	last := time.Now()
+	return func(resolved, total int) {
+		if time.Since(last) < importProgressInterval {
+			return
+		}
+		last = time.Now()
+
+		content := i18n.T(locale, "import.progress", "resolved", resolved)
+		if total > 0 {
+			content = i18n.T(locale, "import.progress_total", "resolved", resolved, "total", total)
+		}
+		r.edit(&discordgo.WebhookEdit{
+			Content: ptrString(content),
+		})
+	}
+}
+
+// interleaveRequesters lets requesters take turns in the queue after several tracks were
+// added, when asked to or in the server's fair queue mode
+// It returns the tracks now ahead of the first one added and how many of the added tracks
+// follow it in a row, for queuePlacementFields
+func interleaveRequesters(p *player.GuildPlayer, added, ahead []*player.Track, asked bool) ([]*player.Track, int) {
+	if len(added) < 2 || !(asked || p.IsFairQueue()) {
+		return ahead, len(added)
+	}
+	p.Queue.InterleaveByRequester()
+
+	upcoming := p.Queue.Snapshot().Upcoming
+	first := slices.Index(upcoming, added[0])
+	if first < 0 {
+		return ahead, len(added)
+	}
+	placed := 1
+	for placed < len(added) && first+placed < len(upcoming) && upcoming[first+placed] == added[placed] {
+		placed++
+	}
+	return upcoming[:first], placed
+}
+
+// queuePlacementFields show where tracks just added landed in the queue, numbered as /queue
+// numbers them, and when the first of them should start playing
+func (b *Bot) queuePlacementFields(p *player.GuildPlayer, current *player.Track, ahead []*player.Track, count int, locale string) []*discordgo.MessageEmbedField {
+	if current == nil && len(ahead) == 0 {
+		return []*discordgo.MessageEmbedField{{Name: i18n.T(locale, "play.position"), Value: i18n.T(locale, "play.up_next"), Inline: true}}
+	}
+
+	first := len(ahead) + 1
+	position := fmt.Sprintf("#%d", first)
+	if count > 1 {
+		position = fmt.Sprintf("#%d–#%d", first, first+count-1)
+	}
+	fields := []*discordgo.MessageEmbedField{{Name: i18n.T(locale, "play.position"), Value: position, Inline: true}}
+
+	if eta, ok := queueETA(p, current, ahead); ok {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   i18n.T(locale, "play.eta"),
+			Value:  i18n.T(locale, "play.eta_value", "eta", formatDuration(eta)),
+			Inline: true,
 		})
 	}
+	return fields
+}
+
+// queueETA estimates how long until the tracks after ahead start playing: what is left of
+// the current track and the length of every track ahead, at the filter's speed
+// There is no estimate when a track ahead has no known end or the current one repeats
+func queueETA(p *player.GuildPlayer, current *player.Track, ahead []*player.Track) (time.Duration, bool) {
+	var eta time.Duration
+	if current != nil {
+		if _, _, looping := p.ABLoop(); looping || p.Queue.Loop || current.IsLive || current.Duration <= 0 {
+			return 0, false
+		}
+		eta = max(current.Duration-p.Position(), 0)
+	}
+	for _, track := range ahead {
+		if track.IsLive || track.Duration <= 0 {
+			return 0, false
+		}
+		eta += track.Duration
+	}
+	return p.GetFilter().RealTime(eta), true
+}
+
+// playlistEmbed describes an imported playlist with its name, owner and track counts
+func playlistEmbed(playlist *youtube.Playlist, locale string) *discordgo.MessageEmbed {
+	var description string
+	if playlist.Title != "" {
+		description = fmt.Sprintf("**%s**\n", playlist.Title)
+		if playlist.Uploader != "" {
+			description += i18n.T(locale, "playlist.by", "uploader", playlist.Uploader) + "\n"
+		}
+	}
+
+	added := len(playlist.Tracks)
+	if playlist.NextOffset > 0 {
+		description += i18n.T(locale, "playlist.added_more",
+			"added", added, "total", formatCount(int64(playlist.Total)), "offset", playlist.NextOffset)
+	} else if playlist.Total > added {
+		description += i18n.T(locale, "playlist.added_some", "added", added, "total", playlist.Total)
+	} else {
+		description += i18n.T(locale, "playlist.added_all", "count", added)
+	}
+	description += importSummary(playlist, locale)
+
+	embed := &discordgo.MessageEmbed{
+		Title:       i18n.T(locale, "playlist.added"),
+		Description: description,
+		Color:       0x00ff00,
+	}
+	if added > 0 && playlist.Tracks[0].Thumbnail != "" {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: playlist.Tracks[0].Thumbnail}
+	}
+	return embed
+}
+
+// importSummary lists the playlist entries that weren't added, or returns "" if none were left out
+func importSummary(playlist *youtube.Playlist, locale string) string {
+	var summary string
+	if playlist.Skipped > 0 {
+		summary += "\n" + i18n.T(locale, "import.skipped", "count", playlist.Skipped)
+	}
+	if playlist.Failed > 0 {
+		summary += "\n" + i18n.T(locale, "import.failed", "count", playlist.Failed)
+	}
+	if playlist.TooLong > 0 {
+		summary += "\n" + i18n.T(locale, "import.too_long", "count", playlist.TooLong)
+	}
+	if playlist.Live > 0 {
+		summary += "\n" + i18n.T(locale, "import.live", "count", playlist.Live)
+	}
+	if playlist.Blocked > 0 {
+		summary += "\n" + i18n.T(locale, "import.blocked", "count", playlist.Blocked)
+	}
+	if len(playlist.Missing) > 0 {
+		summary += "\n" + i18n.T(locale, "import.missing", "missing", missingList(playlist.Missing))
+	}
+	return summary
+}
+
+// missingListed is how many entries missingList names
+const missingListed = 10
+
+// missingList names the first few entries that couldn't be added, e.g. "a, b +3 more"
+func missingList(names []string) *i18n.Message {
+	list := strings.Join(names[:min(len(names), missingListed)], ", ")
+	return i18n.New("import.missing_list", "names", list, "more", max(len(names)-missingListed, 0))
+}
+
+// searchResultLimit is how many results /search shows
+const searchResultLimit = 5
+
+// handleSearch handles the search command
+func (b *Bot) handleSearch(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	query, ok := getStringOption(i.ApplicationCommandData().Options, "query")
+	if !ok {
+		return missingOption("query")
+	}
+
+	// Defer the response since this might take a while
+	b.deferResponse(r, i, announcement)
+
+	tracks, err := b.YouTube.Search(ctx, query, searchResultLimit, b.searchProvider(b.PlayerManager.GetPlayer(i.GuildID)))
+	if err != nil {
+		return err
+	}
+
+	if len(tracks) == 0 {
+		return i18n.Error("error.no_songs")
+	}
+
+	locale := b.locale(i)
+	var builder strings.Builder
+	for idx, track := range tracks {
+		length := i18n.T(locale, "track.live")
+		if !track.IsLive {
+			length = formatDuration(track.Duration)
+		}
+		builder.WriteString(i18n.T(locale, "search.result", "number", idx+1, "title", track.Title, "url", track.URL,
+			"artist", track.Artist, "length", length, "views", formatCount(track.ViewCount)) + "\n")
+	}
 
+	embed := &discordgo.MessageEmbed{
+		Title:       i18n.T(locale, "search.title", "query", query),
+		Description: builder.String(),
+		Color:       0x0099ff,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: i18n.T(locale, "search.footer"),
+		},
+	}
+	b.respondEmbed(r, i, announcement, embed)
 	return nil
 }
 
-// resolveQuery resolves a query to tracks
-func (b *Bot) resolveQuery(query, userID string) ([]*player.Track, error) {
+// joinInvoker joins the voice channel of the user who ran a command, unless the bot is
+// already connected, and returns the server's player
+func (b *Bot) joinInvoker(i *discordgo.InteractionCreate) (*player.GuildPlayer, error) {
+	channelID, err := b.GetVoiceChannel(i.GuildID, i.Member.User.ID)
+	if err != nil {
+		return nil, i18n.Error("error.not_in_voice")
+	}
+
+	p := b.PlayerManager.GetPlayer(i.GuildID)
+
+	// A concurrent /play reuses this join
+	joined, err := p.EnsureVoice(channelID)
+	if err != nil {
+		return nil, err
+	}
+	if joined {
+		p.SetChannelBitrate(b.ChannelBitrate(channelID))
+	}
+	return p, nil
+}
+
+// resolveQuery resolves a query to tracks for a guild's player
+// The playlist is set when a playlist, album, or artist was imported; YouTube playlists are limited by opts
+// Spotify links are looked up in the guild's market, and searches use its search provider
+func (b *Bot) resolveQuery(ctx context.Context, query, userID string, p *player.GuildPlayer, opts youtube.PlaylistOptions) ([]*player.Track, *youtube.Playlist, error) {
+	market := p.GetSpotifyMarket()
+
 	// Check if it's a Spotify URL
 	if spotify.IsSpotifyURL(query) {
 		if b.Spotify == nil {
-			return nil, fmt.Errorf("Spotify integration is not configured")
+			return nil, nil, i18n.Error("play.spotify_disabled")
 		}
 
 		spotifyType, id, err := spotify.ParseSpotifyURL(query)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		var spotifyTracks []*player.Track
+		var missing []string
 
 		switch spotifyType {
 		case "track":
-			track, err := b.Spotify.GetTrackInfo(id)
+			track, err := b.Spotify.GetTrackInfo(id, market)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			spotifyTracks = []*player.Track{track}
 		case "playlist":
-			tracks, err := b.Spotify.GetPlaylistTracks(id)
+			tracks, skipped, err := b.Spotify.GetPlaylistTracks(id, market)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
-			spotifyTracks = tracks
+			spotifyTracks, missing = tracks, skipped
 		case "album":
-			tracks, err := b.Spotify.GetAlbumTracks(id)
+			tracks, err := b.Spotify.GetAlbumTracks(id, market)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			spotifyTracks = tracks
 		case "artist":
-			tracks, err := b.Spotify.GetArtistTopTracks(id)
+			tracks, err := b.Spotify.GetArtistTopTracks(id, market)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			spotifyTracks = tracks
 		default:
-			return nil, fmt.Errorf("unsupported Spotify type: %s", spotifyType)
+			return nil, nil, i18n.Error("play.spotify_unsupported", "type", spotifyType)
 		}
 
-		// Convert Spotify tracks to YouTube
-		tracks := make([]*player.Track, 0)
-		for _, st := range spotifyTracks {
-			searchQuery := fmt.Sprintf("%s %s", st.Artist, st.Title)
-			ytTracks, err := b.YouTube.Search(searchQuery)
-			if err != nil || len(ytTracks) == 0 {
-				continue
-			}
-			ytTracks[0].RequestedBy = userID
-			tracks = append(tracks, ytTracks[0])
+		if len(spotifyTracks) == 0 && len(missing) > 0 {
+			return nil, nil, i18n.Error("play.none_playable", "count", len(missing), "missing", missingList(missing))
 		}
 
-		return tracks, nil
+		if spotifyType == "track" {
+			return b.matchNow(ctx, spotifyTracks[0], userID)
+		}
+		return queueForMatching(&youtube.Playlist{Tracks: spotifyTracks, Total: len(spotifyTracks) + len(missing), Missing: missing}, userID)
+	}
+
+	// Apple Music and Deezer links are read from their pages and matched on YouTube like Spotify
+	var imported func(context.Context, string) (*webmeta.Import, error)
+	switch {
+	case applemusic.IsURL(query):
+		imported = applemusic.GetTracks
+	case deezer.IsURL(query):
+		imported = deezer.GetTracks
+	}
+	if imported != nil {
+		result, err := imported(ctx, query)
+		if err != nil {
+			return nil, nil, err
+		}
+		if result.Title == "" && len(result.Tracks) == 1 {
+			return b.matchNow(ctx, result.Tracks[0], userID)
+		}
+		playlist := &youtube.Playlist{Title: result.Title, Uploader: result.Owner, Tracks: result.Tracks, Total: len(result.Tracks)}
+		if opts.Limit > 0 && len(playlist.Tracks) > opts.Limit {
+			playlist.Tracks = playlist.Tracks[:opts.Limit]
+		}
+		return queueForMatching(playlist, userID)
 	}
 
-	// Check if it's a YouTube URL
-	if youtube.IsYouTubeURL(query) {
-		if youtube.IsPlaylist(query) {
-			tracks, err := b.YouTube.GetPlaylistInfo(query)
+	// Check if it's a YouTube URL; only the canonical form built from its IDs reaches yt-dlp
+	link, err := youtube.ParseURL(query)
+	if err != nil && !errors.Is(err, youtube.ErrNotYouTubeURL) {
+		return nil, nil, err
+	}
+	if link != nil {
+		if link.IsPlaylist() {
+			playlist, err := b.YouTube.GetPlaylistInfo(ctx, link.PlaylistURL(), opts)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
-			for _, track := range tracks {
+			for _, track := range playlist.Tracks {
 				track.RequestedBy = userID
 			}
-			return tracks, nil
+			return playlist.Tracks, playlist, nil
 		} else {
-			track, err := b.YouTube.GetVideoInfo(query)
+			track, err := b.YouTube.GetVideoInfo(ctx, link.WatchURL())
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			track.RequestedBy = userID
-			return []*player.Track{track}, nil
+			return []*player.Track{track}, nil, nil
+		}
+	}
+
+	// Any other link has to point straight at an audio file
+	if isURL(query) {
+		track, err := b.Direct.GetTrackInfo(query)
+		if err != nil {
+			return nil, nil, err
 		}
+		track.RequestedBy = userID
+		return []*player.Track{track}, nil, nil
 	}
 
 	// Otherwise, search YouTube
-	tracks, err := b.YouTube.Search(query)
+	tracks, err := b.YouTube.Search(ctx, query, 1, b.searchProvider(p))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	for _, track := range tracks {
 		track.RequestedBy = userID
 	}
-	return tracks, nil
+	return tracks, nil, nil
+}
+
+// searchProvider returns where a guild's searches look, its own choice or SEARCH_PROVIDER
+func (b *Bot) searchProvider(p *player.GuildPlayer) youtube.SearchProvider {
+	if provider := p.GetSearchProvider(); provider != "" {
+		return youtube.SearchProvider(provider)
+	}
+	return youtube.SearchProvider(b.config().SearchProvider)
+}
+
+// matchNow matches a single track from another service on YouTube, so a bad match is
+// reported right away instead of when it comes up
+func (b *Bot) matchNow(ctx context.Context, track *player.Track, userID string) ([]*player.Track, *youtube.Playlist, error) {
+	matched, err := b.spotifyMatches.match(ctx, track)
+	if errors.Is(err, youtube.ErrNoCloseMatch) {
+		return nil, nil, i18n.Error("play.no_match", "artist", track.Artist, "title", track.Title)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	matched.RequestedBy = userID
+	return []*player.Track{matched}, nil, nil
+}
+
+// queueForMatching returns the tracks of a playlist, album or artist from another service
+// as placeholders that the track resolver matches on YouTube shortly before they play
+func queueForMatching(playlist *youtube.Playlist, userID string) ([]*player.Track, *youtube.Playlist, error) {
+	for _, track := range playlist.Tracks {
+		track.RequestedBy = userID
+	}
+	return playlist.Tracks, playlist, nil
 }
 
 // playLoop handles the playback loop for a guild
 func (b *Bot) playLoop(guildID string, channelID string) {
 	logger.Debug("Starting playback loop", "guild", guildID)
 	p := b.PlayerManager.GetPlayer(guildID)
+	p.SetTextChannelID(channelID)
 
 	// Ensure we log when the loop ends
 	defer func() {
 		logger.Debug("Playback loop ended", "guild", guildID)
 	}()
 
+	// Look up upcoming tracks' streams in the background before they come up
+	resolver := newTrackResolver(b.YouTube, b.spotifyMatches, p.Queue, b.Cache, b.config().StreamPrefetchCount)
+	ctx, stopResolver := context.WithCancel(context.Background())
+	defer stopResolver()
+	go resolver.run(ctx)
+
+	// retried marks that the current track has already been restarted after producing no audio
+	retried := false
+	// last is the track that played last, to tell a looped repeat from a new track
+	var last *player.Track
+
+	// The cache entry being played is pinned so downloads of other tracks can't evict it
+	// mid-song; hold swaps the pin to another key ("" releases it)
+	pinned := ""
+	hold := func(key string) {
+		if key == pinned {
+			return
+		}
+		if pinned != "" {
+			b.Cache.Unpin(pinned)
+		}
+		if key != "" {
+			b.Cache.Pin(key)
+		}
+		pinned = key
+	}
+	defer hold("")
+
+	// cancelDownload stops the cache download started for the track being played, once it is
+	// skipped or fails; a track that plays to its end lets its download finish for the cache
+	cancelDownload := context.CancelFunc(func() {})
+	defer func() { cancelDownload() }()
+
 	for {
 		track := p.Queue.Current()
+		repeat := track != nil && track == last
 		if track == nil {
 			track = p.Queue.Next()
 			if track == nil {
@@ -209,63 +590,227 @@ func (b *Bot) playLoop(guildID string, channelID string) {
 			}
 		}
 
+		track, err := resolver.await(track)
+		if p.Queue.Current() != track {
+			// Skipped or removed while its lookup ran; start over with whatever is current now
+			continue
+		}
+		if err != nil {
+			errMsg := i18n.T(b.guildLocale(guildID), "playback.skipped", "artist", track.Artist, "title", track.Title, "reason", err)
+			b.Session.ChannelMessageSend(channelID, errMsg)
+
+			logger.Warn("Skipping track that couldn't be matched on YouTube", "title", track.Title, "err", err)
+			retried = false
+			p.Queue.Next()
+			continue
+		}
+		// Tracks whose length was unknown when queued, and tracks queued before the limits
+		// changed, are checked now
+		if reason := b.refusal(p, track); reason != nil {
+			errMsg := i18n.T(b.guildLocale(guildID), "playback.skipped", "artist", track.Artist, "title", track.Title, "reason", reason)
+			b.Session.ChannelMessageSend(channelID, errMsg)
+
+			logger.Info("Skipping track the server doesn't allow", "title", track.Title, "reason", reason.Error())
+			retried = false
+			p.Queue.Next()
+			continue
+		}
 		logger.Info("Processing track", "title", track.Title)
 
-		// Check if track is already cached
+		// Check if track is already cached; an empty LocalPath triggers the streaming encoder
+		// Livestreams have no end to download and direct links are played as-is, so they always stream
 		cacheKey := cache.GenerateKey(track.URL)
-		if cachedPath, exists := b.Cache.Get(cacheKey); exists {
-			// Use cached file
+		encodeSettings := preEncodeSettings(p)
+		dcaSuffix := player.DCASuffix(encodeSettings)
+		cachedPath, cached := "", false
+		cacheable := !track.IsLive && track.Source != player.SourceDirect
+		if cacheable && b.Cache.Contains(cacheKey) {
+			// A truncated file would cut the track short; damaged entries are removed so
+			// the track streams and is downloaded again
+			b.Cache.Annotate(cacheKey, trackMetadata(track))
+			var err error
+			if b.Cache.Probed(cacheKey) {
+				// Only compares durations, without running ffprobe
+				err = b.Cache.Verify(cacheKey)
+			} else {
+				// Probing can take seconds, so this play goes ahead and the next one knows
+				go b.verifyCached(cacheKey, track.Title)
+			}
+			if errors.Is(err, cache.ErrCorrupt) {
+				logger.Warn("Cached file failed verification, streaming instead", "title", track.Title, "err", err)
+			} else {
+				if err != nil {
+					logger.Debug("Couldn't verify cached file, playing it anyway", "title", track.Title, "err", err)
+				}
+				// Pin before looking the entry up, so it can't be evicted in between
+				hold(cacheKey)
+				cachedPath, cached = b.Cache.Get(cacheKey)
+			}
+		}
+		if !cached {
+			hold("")
+		}
+		track = p.Queue.UpdateCurrent(track, func(t *player.Track) {
+			t.LocalPath = cachedPath
+			t.EncodedPath = ""
+			t.Download = nil
+			if !cached {
+				return
+			}
+			if dcaPath, exists := b.Cache.GetArtifact(cacheKey, dcaSuffix); exists {
+				t.EncodedPath = dcaPath
+			}
+		})
+		if cached && track.EncodedPath == "" && b.config().PreEncodeCache {
+			// Cached before pre-encoding was enabled or at another bitrate; the frames are
+			// ready for the track's next play
+			go b.preEncode(cacheKey, cachedPath, track.Title, encodeSettings)
+		}
+
+		if !cacheable {
+			logger.Info("Streaming without caching", "live", track.IsLive, "source", track.Source)
+		} else if cached {
 			logger.PlaybackCached(cachedPath)
-			track.LocalPath = cachedPath
+		} else if b.downloadFailedRecently(cacheKey) {
+			logger.Debug("Streaming without caching after a recent download failure", "title", track.Title)
+		} else if reason := b.skipDownloadReason(track); reason != "" {
+			logger.Debug("Streaming without caching", "title", track.Title, "reason", reason)
 		} else {
-			// Not cached - stream immediately and download in background
-			logger.Info("Track not cached, streaming and downloading in background")
-			track.LocalPath = "" // Empty path triggers streaming encoder
-
-			// Start background download for future plays
-			go func(url, key, title string) {
-				logger.PlaybackDownloading(title)
-				_, err := b.Cache.GetOrCreate(key, func(path string) error {
-					return b.YouTube.Download(url, path)
-				})
-				if err != nil {
-					logger.Error("Background download failed", "title", title, "err", err)
-				} else {
-					logger.Info("Background download completed", "title", title)
+			// Not cached - download in the background; it stops if the track is skipped or removed
+			downloadCtx, cancel := context.WithCancel(track.Context())
+			cancelDownload = cancel
+			downloaded := make(chan error, 1)
+			go func(ctx context.Context, url, key, title string, meta cache.Metadata) {
+				path, err := b.downloadTrack(ctx, url, key, title, meta)
+				// Download-first playback starts from the file now; the frames are for later plays
+				downloaded <- err
+				if err == nil && b.config().PreEncodeCache {
+					b.preEncode(key, path, title, encodeSettings)
+				}
+			}(downloadCtx, track.URL, cacheKey, track.Title, trackMetadata(track))
+
+			// In download-first mode, play the finished file
+			if b.downloadsFirst(p, track) {
+				logger.Info("Track not cached, downloading before playing")
+				ok := b.awaitDownload(p, channelID, track, cacheKey, downloaded)
+				if p.Queue.Current() != track {
+					cancelDownload()
+					continue
 				}
-			}(track.URL, cacheKey, track.Title)
+				if ok {
+					hold(cacheKey)
+					cachedPath, cached = b.Cache.Get(cacheKey)
+					if !cached {
+						hold("")
+					}
+				}
+			}
+
+			if cached {
+				track = p.Queue.UpdateCurrent(track, func(t *player.Track) {
+					t.LocalPath = cachedPath
+					if dcaPath, exists := b.Cache.GetArtifact(cacheKey, dcaSuffix); exists {
+						t.EncodedPath = dcaPath
+					}
+				})
+			} else {
+				// Play from the download as it is written, falling back to streaming if it
+				// can't keep up
+				logger.Info("Track not cached, playing while downloading in background")
+				track = p.Queue.UpdateCurrent(track, func(t *player.Track) {
+					t.Download = b.Cache.Follower(cacheKey)
+				})
+			}
 		}
 
 		// Play the track with retry logic
 		logger.Info("Starting playback")
-		err := p.Play()
+		err = p.Play()
 
 		if err != nil {
 			logger.Warn("First play attempt failed, retrying", "err", err, "title", track.Title)
 
 			// Clear stream URL to force fresh fetch on retry
-			track.StreamURL = ""
+			track = p.Queue.UpdateCurrent(track, func(t *player.Track) { t.StreamURL = "" })
+
+			// A connection that died while idle fails the same way again, so join afresh first
+			rejoined := false
+			if !p.VoiceReady() {
+				if err := p.Rejoin(); err != nil {
+					logger.Warn("Failed to rejoin voice channel", "guild", guildID, "err", err)
+				} else {
+					rejoined = true
+				}
+			}
 
 			// Retry once
 			err = p.Play()
+			if err == nil && rejoined {
+				logger.Info("Recovered playback by rejoining voice channel", "guild", guildID, "title", track.Title)
+			}
 			if err != nil {
 				// Send failure notification to Discord
-				errMsg := fmt.Sprintf("❌ **Track Failed:** %s\n**Reason:** %v", track.Title, err)
+				errMsg := i18n.T(b.guildLocale(guildID), "playback.failed", "title", track.Title, "reason", err)
 				b.Session.ChannelMessageSend(channelID, errMsg)
 
 				logger.Error("Track failed after retry", "title", track.Title, "err", err)
+				cancelDownload()
 				p.Queue.Next()
 				continue
 			}
 		}
 
+		if !repeat && !retried {
+			go b.notifyRequester(guildID, channelID, track)
+		}
+		last = track
+
 		// Wait for track to finish
 		logger.Debug("Waiting for track to complete")
-		p.WaitForCompletion()
-		logger.Info("Track completed", "title", track.Title)
+		result := p.WaitForCompletion()
+		if result.Reason == player.ReasonSkipped {
+			// Free the bandwidth and yt-dlp slot for whatever plays next
+			cancelDownload()
+		}
+
+		switch result.Reason {
+		case player.ReasonStopped:
+			// Whoever stopped playback has dealt with the queue and the connection
+			logger.Info("Playback stopped", "title", track.Title, "position", result.Position)
+			p.SetLoopRunning(false)
+			return
+		case player.ReasonFailed:
+			// A connection that never became ready only costs this track; one that went away ends the loop
+			if errors.Is(result.Err, player.ErrVoiceLost) {
+				logger.Info("Voice connection lost, stopping playback", "guild", guildID, "title", track.Title)
+				p.Queue.ClearAll()
+				p.SetLoopRunning(false)
+				return
+			}
+
+			// A stream that never produced audio is usually a dead CDN URL; retry once with a fresh one
+			if result.Retryable() && !retried {
+				logger.Warn("No audio received, retrying with a fresh stream URL", "title", track.Title, "err", result.Err)
+				track = p.Queue.UpdateCurrent(track, func(t *player.Track) { t.StreamURL = "" })
+				retried = true
+				continue
+			}
+
+			errMsg := i18n.T(b.guildLocale(guildID), "playback.failed", "title", track.Title, "reason", result.Err)
+			b.Session.ChannelMessageSend(channelID, errMsg)
+
+			logger.Error("Track failed", "title", track.Title, "retried", retried, "err", result.Err)
+			retried = false
+			cancelDownload()
+			p.Queue.Next()
+			continue
+		}
+		retried = false
 
-		// Check if we should loop the current track
-		if p.Queue.Loop {
+		logger.Info("Track ended", "title", track.Title, "reason", result.Reason, "position", result.Position)
+
+		// Loop the current track when it ends by itself; a skip moves on regardless
+		if result.Reason == player.ReasonFinished && p.Queue.Loop {
 			// Verify voice connection is still valid before replaying
 			if !p.IsVoiceConnected() {
 				logger.Info("Voice connection lost during loop, stopping playback", "guild", guildID)
@@ -291,298 +836,1512 @@ func (b *Bot) playLoop(guildID string, channelID string) {
 	}
 }
 
+// typicalBitrate is the bitrate in bits per second assumed when estimating a download's
+// size; YouTube's best audio formats are around 130-160 kbps Opus
+const typicalBitrate = 160_000
+
+// trackMetadata is what the cache records about a track
+func trackMetadata(track *player.Track) cache.Metadata {
+	return cache.Metadata{
+		URL:      track.URL,
+		Title:    track.Title,
+		Artist:   track.Artist,
+		Duration: track.Duration,
+	}
+}
+
+// skipDownloadReason returns why a track shouldn't be downloaded for the cache, or "" if
+// it should: tracks over CACHE_MAX_TRACK_DURATION, or whose estimated size is over the
+// cache's per-file limit, would take up room better spent on other tracks
+func (b *Bot) skipDownloadReason(track *player.Track) string {
+	if limit := b.config().CacheMaxTrackDuration; limit > 0 && track.Duration > limit {
+		return fmt.Sprintf("longer than %s", limit)
+	}
+	estimate := int64(track.Duration.Seconds() * typicalBitrate / 8)
+	if max := b.Cache.MaxFileSize(); estimate > max {
+		return fmt.Sprintf("estimated %d MB, over the %d MB per-file limit", estimate>>20, max>>20)
+	}
+	return ""
+}
+
+// downloadRetryAfter is how long a track whose download failed for good streams without caching
+const downloadRetryAfter = time.Hour
+
+// downloadFailedRecently reports whether the download for a cache key failed within downloadRetryAfter
+func (b *Bot) downloadFailedRecently(key string) bool {
+	failedAt, ok := b.failedDownloads.Load(key)
+	if !ok {
+		return false
+	}
+	if time.Since(failedAt.(time.Time)) > downloadRetryAfter {
+		b.failedDownloads.Delete(key)
+		return false
+	}
+	return true
+}
+
+// preEncodeSettings returns the settings a guild's tracks are pre-encoded with: its own
+// bitrate, at unity volume since pre-encoded frames are only sent when no gain is needed
+func preEncodeSettings(p *player.GuildPlayer) player.AudioSettings {
+	settings := p.GetEncoderSettings()
+	settings.Volume = nil
+	return settings
+}
+
+// preEncode transcodes a cached track into Opus frames at a guild's audio settings, unless
+// they exist or are being made already
+func (b *Bot) preEncode(key, path, title string, settings player.AudioSettings) {
+	suffix := player.DCASuffix(settings)
+
+	if _, exists := b.Cache.GetArtifact(key, suffix); exists {
+		return
+	}
+	if _, running := b.preEncoding.LoadOrStore(key+suffix, true); running {
+		return
+	}
+	defer b.preEncoding.Delete(key + suffix)
+
+	_, err := b.Cache.CreateArtifact(key, suffix, func(dest string) error {
+		return player.EncodeDCA(path, dest, settings)
+	})
+	if err != nil {
+		logger.Error("Pre-encode failed", "title", title, "err", err)
+		return
+	}
+	logger.Info("Pre-encode completed", "title", title)
+}
+
 // handlePause handles the pause command
-func (b *Bot) handlePause(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+func (b *Bot) handlePause(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
 	p := b.PlayerManager.GetPlayer(i.GuildID)
 	p.Pause()
-	b.respond(s, i, "⏸️ Paused")
+	b.respond(r, i, confirmation, b.t(i, "pause.done"))
 	return nil
 }
 
 // handleResume handles the resume command
-func (b *Bot) handleResume(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+func (b *Bot) handleResume(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
 	p := b.PlayerManager.GetPlayer(i.GuildID)
 	p.Resume()
-	b.respond(s, i, "▶️ Resumed")
+	b.respond(r, i, confirmation, b.t(i, "resume.done"))
 	return nil
 }
 
 // handleSkip handles the skip command
-func (b *Bot) handleSkip(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+func (b *Bot) handleSkip(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
 	p := b.PlayerManager.GetPlayer(i.GuildID)
 	next := p.Skip()
 
 	if next == nil {
-		b.respond(s, i, "⏭️ Skipped (queue is now empty)")
+		b.respond(r, i, announcement, b.t(i, "skip.done_empty"))
 	} else {
-		b.respond(s, i, fmt.Sprintf("⏭️ Skipped to: **%s**", next.Title))
+		b.respond(r, i, announcement, b.t(i, "skip.done", "title", next.Title))
 	}
 	return nil
 }
 
 // handleStop handles the stop command
-func (b *Bot) handleStop(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+func (b *Bot) handleStop(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
 	p := b.PlayerManager.GetPlayer(i.GuildID)
 	p.Stop()
 	p.Queue.ClearAll()
 	p.Disconnect()
-	b.respond(s, i, "⏹️ Stopped and cleared queue")
+	b.respond(r, i, announcement, b.t(i, "stop.done"))
 	return nil
 }
 
 // handleQueue handles the queue command
-func (b *Bot) handleQueue(s *discordgo.Session, i *discordgo.InteractionCreate) error {
-	p := b.PlayerManager.GetPlayer(i.GuildID)
-
-	if p.Queue.IsEmpty() {
-		b.respond(s, i, "Queue is empty")
-		return nil
+func (b *Bot) handleQueue(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	subCmd, err := subcommand(i.ApplicationCommandData().Options)
+	if err != nil {
+		return err
 	}
 
-	var builder strings.Builder
-	builder.WriteString("**Current Queue:**\n\n")
-
-	for idx, track := range p.Queue.Tracks {
-		prefix := fmt.Sprintf("%d. ", idx+1)
-		if idx == p.Queue.CurrentIndex {
-			prefix = "▶️ "
+	switch subCmd.Name {
+	case "show":
+		return b.showQueue(r, i)
+	case "sort":
+		by, ok := getStringOption(subCmd.Options, "by")
+		if !ok {
+			return missingOption("by")
+		}
+		order, _ := getStringOption(subCmd.Options, "order")
+		p := b.PlayerManager.GetPlayer(i.GuildID)
+		upcoming := p.Queue.Snapshot().Upcoming
+		less, err := b.queueOrder(i.GuildID, by, order == "desc", upcoming)
+		if err != nil {
+			return err
+		}
+		if len(upcoming) < 2 {
+			return i18n.Error("queue.not_enough")
 		}
-		builder.WriteString(fmt.Sprintf("%s**%s** - %s\n", prefix, track.Title, track.Artist))
+		p.Queue.SortUpcoming(less)
+		b.respond(r, i, confirmation, b.t(i, "queue.sorted", "by", by))
+	case "reverse":
+		p := b.PlayerManager.GetPlayer(i.GuildID)
+		if len(p.Queue.Upcoming(2)) < 2 {
+			return i18n.Error("queue.not_enough")
+		}
+		p.Queue.ReverseUpcoming()
+		b.respond(r, i, confirmation, b.t(i, "queue.reversed"))
+	default:
+		return i18n.Error("error.unknown_subcommand")
 	}
+	return nil
+}
 
-	embed := &discordgo.MessageEmbed{
-		Title:       "Queue",
-		Description: builder.String(),
+// queueOrder returns how /queue sort orders tracks by title, duration or requester
+// Requesters are ordered by their name in the server, so each one's tracks end up together;
+// the names of upcoming's requesters are looked up here, as sorting holds the queue's lock,
+// and anyone else's ID stands in for their name
+func (b *Bot) queueOrder(guildID, by string, descending bool, upcoming []*player.Track) (func(a, b *player.Track) bool, error) {
+	var key func(*player.Track) string
+	var less func(x, y *player.Track) bool
+	switch by {
+	case "title":
+		key = func(track *player.Track) string { return strings.ToLower(track.Title) }
+	case "duration":
+		// Livestreams never end, so they sort after everything else
+		length := func(track *player.Track) time.Duration {
+			if track.IsLive {
+				return math.MaxInt64
+			}
+			return track.Duration
+		}
+		less = func(x, y *player.Track) bool { return length(x) < length(y) }
+	case "requester":
+		names := make(map[string]string)
+		for _, track := range upcoming {
+			if _, ok := names[track.RequestedBy]; !ok {
+				names[track.RequestedBy] = strings.ToLower(b.memberName(guildID, track.RequestedBy))
+			}
+		}
+		key = func(track *player.Track) string {
+			if name, ok := names[track.RequestedBy]; ok {
+				return name
+			}
+			return strings.ToLower(track.RequestedBy)
+		}
+	default:
+		return nil, i18n.Error("queue.invalid_sort")
+	}
+	if key != nil {
+		less = func(x, y *player.Track) bool { return key(x) < key(y) }
+	}
+	if descending {
+		return func(x, y *player.Track) bool { return less(y, x) }, nil
+	}
+	return less, nil
+}
+
+// memberName returns the name a user goes by in a server, or their ID if they aren't in the
+// state cache
+func (b *Bot) memberName(guildID, userID string) string {
+	if member, err := b.Session.State.Member(guildID, userID); err == nil && member.User != nil {
+		return member.DisplayName()
+	}
+	return userID
+}
+
+// showQueue shows the current track and the upcoming ones
+func (b *Bot) showQueue(r responder, i *discordgo.InteractionCreate) error {
+	p := b.PlayerManager.GetPlayer(i.GuildID)
+
+	if p.Queue.IsEmpty() {
+		b.respond(r, i, announcement, b.t(i, "queue.empty"))
+		return nil
+	}
+
+	locale := b.locale(i)
+	var builder strings.Builder
+	builder.WriteString(i18n.T(locale, "queue.heading") + "\n\n")
+
+	// Upcoming tracks are numbered as /move and /remove take them
+	snapshot := p.Queue.Snapshot()
+	if snapshot.Current != nil {
+		builder.WriteString(queueLine("▶️ ", snapshot.Current))
+	}
+	for idx, track := range snapshot.Upcoming {
+		builder.WriteString(queueLine(fmt.Sprintf("%d. ", idx+1), track))
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       i18n.T(locale, "queue.title"),
+		Description: builder.String(),
 		Color:       0x0099ff,
 		Footer: &discordgo.MessageEmbedFooter{
-			Text: fmt.Sprintf("%d tracks", p.Queue.Length()),
+			Text: i18n.T(locale, "queue.footer", "count", p.Queue.Length()),
 		},
 	}
 
-	b.respondEmbed(s, i, embed)
+	b.respondEmbed(r, i, announcement, embed)
 	return nil
 }
 
+// queueLine is one track in /queue
+func queueLine(prefix string, track *player.Track) string {
+	if track.IsLive {
+		prefix += "🔴 "
+	}
+	line := fmt.Sprintf("%s**%s** - %s", prefix, track.Title, track.Artist)
+	if track.VolumeOffset != 0 {
+		line += " " + volumeOffsetText(track.VolumeOffset)
+	}
+	return line + "\n"
+}
+
+// volumeOffsetText shows a track's volume offset like "(−20%)"
+func volumeOffsetText(offset int) string {
+	if offset < 0 {
+		return fmt.Sprintf("(−%d%%)", -offset)
+	}
+	return fmt.Sprintf("(+%d%%)", offset)
+}
+
 // handleNowPlaying handles the now-playing command
-func (b *Bot) handleNowPlaying(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+func (b *Bot) handleNowPlaying(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
 	p := b.PlayerManager.GetPlayer(i.GuildID)
 	track := p.Queue.Current()
 
 	if track == nil {
-		b.respond(s, i, "Nothing is currently playing")
+		b.respond(r, i, announcement, b.t(i, "nowplaying.nothing"))
 		return nil
 	}
 
+	locale := b.locale(i)
+	position := p.Position()
 	embed := &discordgo.MessageEmbed{
-		Title:       "Now Playing",
-		Description: fmt.Sprintf("**%s**\nby %s", track.Title, track.Artist),
+		Title:       i18n.T(locale, "nowplaying.title"),
+		Description: i18n.T(locale, "track.by", "title", track.Title, "artist", track.Artist),
 		Color:       0x00ff00,
 		Thumbnail: &discordgo.MessageEmbedThumbnail{
 			URL: track.Thumbnail,
 		},
 		Fields: []*discordgo.MessageEmbedField{
 			{
-				Name:   "Duration",
+				Name:   i18n.T(locale, "nowplaying.duration"),
 				Value:  formatDuration(track.Duration),
 				Inline: true,
 			},
 			{
-				Name:   "Position",
-				Value:  formatDuration(p.CurrentPosition),
+				Name:   i18n.T(locale, "nowplaying.position"),
+				Value:  formatDuration(position),
 				Inline: true,
 			},
 		},
 	}
 
-	b.respondEmbed(s, i, embed)
+	// Livestreams have no duration; show how long the bot has been tuned in instead
+	if track.IsLive {
+		embed.Fields = []*discordgo.MessageEmbedField{
+			{Name: i18n.T(locale, "track.live"), Value: i18n.T(locale, "nowplaying.elapsed", "position", formatDuration(position)), Inline: true},
+		}
+	}
+
+	if filter := p.GetFilter(); filter.Expression != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   i18n.T(locale, "nowplaying.filter"),
+			Value:  filter.Name,
+			Inline: true,
+		})
+		if filter.Speed != 1.0 && !track.IsLive && track.Duration > position {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:   i18n.T(locale, "nowplaying.remaining"),
+				Value:  formatDuration(filter.RealTime(track.Duration - position)),
+				Inline: true,
+			})
+		}
+	}
+
+	if volume := p.GetVolume(); volume > player.MaxVolume {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   i18n.T(locale, "nowplaying.boost"),
+			Value:  fmt.Sprintf("🔊 %d%%", volume),
+			Inline: true,
+		})
+	}
+
+	if start, end, active := p.ABLoop(); active {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "🔁 A-B",
+			Value:  fmt.Sprintf("%s → %s", formatDuration(start), formatDuration(end)),
+			Inline: true,
+		})
+	}
+
+	if idx := track.ChapterAt(position); idx >= 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   i18n.T(locale, "nowplaying.chapter"),
+			Value:  fmt.Sprintf("%s (%d/%d)", track.Chapters[idx].Title, idx+1, len(track.Chapters)),
+			Inline: false,
+		})
+	}
+
+	b.respondEmbed(r, i, announcement, embed)
 	return nil
 }
 
 // handleClear handles the clear command
-func (b *Bot) handleClear(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+func (b *Bot) handleClear(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
 	p := b.PlayerManager.GetPlayer(i.GuildID)
 	p.Queue.Clear()
-	b.respond(s, i, "🗑️ Cleared queue")
+	b.respond(r, i, confirmation, b.t(i, "clear.done"))
 	return nil
 }
 
 // handleDisconnect handles the disconnect command
-func (b *Bot) handleDisconnect(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+func (b *Bot) handleDisconnect(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
 	p := b.PlayerManager.GetPlayer(i.GuildID)
 	p.Disconnect()
-	b.respond(s, i, "👋 Disconnected")
+	b.respond(r, i, announcement, b.t(i, "disconnect.done"))
 	return nil
 }
 
 // handleShuffle handles the shuffle command
-func (b *Bot) handleShuffle(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+func (b *Bot) handleShuffle(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
 	p := b.PlayerManager.GetPlayer(i.GuildID)
 
-	if p.Queue.Length() <= 1 {
-		return fmt.Errorf("not enough tracks to shuffle")
+	if len(p.Queue.Upcoming(2)) < 2 {
+		return i18n.Error("shuffle.not_enough")
 	}
 
-	// Shuffle all tracks except the current one
-	current := p.Queue.CurrentIndex
-	tracks := p.Queue.Tracks
+	// Keep the current track, shuffle the rest
+	p.Queue.ShuffleUpcoming()
 
-	// Keep current track, shuffle the rest
-	if current >= 0 {
-		// Shuffle tracks after current
-		toShuffle := tracks[current+1:]
-		rand.Shuffle(len(toShuffle), func(i, j int) {
-			toShuffle[i], toShuffle[j] = toShuffle[j], toShuffle[i]
-		})
-	} else {
-		// Shuffle all tracks
-		rand.Shuffle(len(tracks), func(i, j int) {
-			tracks[i], tracks[j] = tracks[j], tracks[i]
-		})
-	}
-
-	b.respond(s, i, "🔀 Shuffled queue")
+	b.respond(r, i, confirmation, b.t(i, "shuffle.done"))
 	return nil
 }
 
 // handleLoop handles the loop command
-func (b *Bot) handleLoop(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+func (b *Bot) handleLoop(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
 	p := b.PlayerManager.GetPlayer(i.GuildID)
 	p.Queue.Loop = !p.Queue.Loop
 
 	if p.Queue.Loop {
-		b.respond(s, i, "🔂 Looping enabled")
+		b.respond(r, i, confirmation, b.t(i, "loop.on"))
 	} else {
-		b.respond(s, i, "▶️ Looping disabled")
+		b.respond(r, i, confirmation, b.t(i, "loop.off"))
 	}
 	return nil
 }
 
 // handleVolume handles the volume command
-func (b *Bot) handleVolume(s *discordgo.Session, i *discordgo.InteractionCreate) error {
-	volume := int(i.ApplicationCommandData().Options[0].IntValue())
+func (b *Bot) handleVolume(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	volume, ok := getIntOption(i.ApplicationCommandData().Options, "level")
+	if !ok {
+		return missingOption("level")
+	}
 
 	p := b.PlayerManager.GetPlayer(i.GuildID)
+	if volume > p.VolumeLimit() {
+		return i18n.Error("volume.boost_off", "max", p.VolumeLimit())
+	}
 	if err := p.SetVolume(volume); err != nil {
 		return err
 	}
 
-	b.respond(s, i, fmt.Sprintf("🔊 Volume set to %d%%", volume))
+	b.respond(r, i, confirmation, b.t(i, "volume.done", "volume", volume))
+	return nil
+}
+
+// handleTrackVolume handles the trackvolume command
+func (b *Bot) handleTrackVolume(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	level, ok := getIntOption(i.ApplicationCommandData().Options, "level")
+	if !ok {
+		return missingOption("level")
+	}
+	if level < player.MinTrackVolume || level > player.MaxTrackVolume {
+		return i18n.Error("trackvolume.invalid", "min", player.MinTrackVolume, "max", player.MaxTrackVolume)
+	}
+
+	p := b.PlayerManager.GetPlayer(i.GuildID)
+	track := p.Queue.Current()
+	if track == nil {
+		return i18n.Error("error.nothing_playing")
+	}
+	if err := p.SetTrackVolume(level - 100); err != nil {
+		return err
+	}
+
+	b.respond(r, i, confirmation, b.t(i, "trackvolume.done", "title", track.Title, "volume", level))
 	return nil
 }
 
 // handleSeek handles the seek command
-func (b *Bot) handleSeek(s *discordgo.Session, i *discordgo.InteractionCreate) error {
-	position := i.ApplicationCommandData().Options[0].StringValue()
+func (b *Bot) handleSeek(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	position, ok := getStringOption(i.ApplicationCommandData().Options, "position")
+	if !ok {
+		return missingOption("position")
+	}
 
-	duration, err := parseDuration(position)
+	p := b.PlayerManager.GetPlayer(i.GuildID)
+	track := p.Queue.Current()
+	if track == nil {
+		return i18n.Error("error.nothing_playing")
+	}
+	duration, err := parseSeekPosition(position, track)
 	if err != nil {
 		return err
 	}
 
-	p := b.PlayerManager.GetPlayer(i.GuildID)
 	if err := p.Seek(duration); err != nil {
 		return err
 	}
 
-	b.respond(s, i, fmt.Sprintf("⏩ Seeked to %s", formatDuration(duration)))
+	b.respond(r, i, announcement, b.t(i, "seek.done", "position", formatDuration(duration)))
 	return nil
 }
 
 // handleFSeek handles the fseek command
-func (b *Bot) handleFSeek(s *discordgo.Session, i *discordgo.InteractionCreate) error {
-	seconds := int(i.ApplicationCommandData().Options[0].IntValue())
+func (b *Bot) handleFSeek(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	seconds, ok := getIntOption(i.ApplicationCommandData().Options, "seconds")
+	if !ok {
+		return missingOption("seconds")
+	}
 
+	// Seeking back past the start goes to the start
 	p := b.PlayerManager.GetPlayer(i.GuildID)
-	newPosition := p.CurrentPosition + time.Duration(seconds)*time.Second
+	newPosition := max(p.Position()+time.Duration(seconds)*time.Second, 0)
 
 	if err := p.Seek(newPosition); err != nil {
 		return err
 	}
 
-	b.respond(s, i, fmt.Sprintf("⏩ Seeked forward %d seconds", seconds))
+	if seconds < 0 {
+		b.respond(r, i, announcement, b.t(i, "fseek.back", "count", -seconds))
+		return nil
+	}
+	b.respond(r, i, announcement, b.t(i, "fseek.done", "count", seconds))
+	return nil
+}
+
+// handleChapters handles the chapters command
+func (b *Bot) handleChapters(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	p := b.PlayerManager.GetPlayer(i.GuildID)
+	track := p.Queue.Current()
+
+	if track == nil {
+		return i18n.Error("error.nothing_playing")
+	}
+
+	if len(track.Chapters) == 0 {
+		b.respond(r, i, announcement, b.t(i, "chapters.none"))
+		return nil
+	}
+
+	current := track.ChapterAt(p.Position())
+
+	var builder strings.Builder
+	for idx, chapter := range track.Chapters {
+		prefix := fmt.Sprintf("%d. ", idx+1)
+		if idx == current {
+			prefix = "▶️ "
+		}
+		line := fmt.Sprintf("%s`%s` %s\n", prefix, formatDuration(chapter.Start), chapter.Title)
+
+		// Stay within Discord's embed description limit
+		if builder.Len()+len(line) > 4000 {
+			builder.WriteString("…")
+			break
+		}
+		builder.WriteString(line)
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       b.t(i, "chapters.title", "title", track.Title),
+		Description: builder.String(),
+		Color:       0x0099ff,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: b.t(i, "chapters.footer", "count", len(track.Chapters)),
+		},
+	}
+
+	b.respondEmbed(r, i, announcement, embed)
+	return nil
+}
+
+// handleSkipChapter handles the skipchapter command
+func (b *Bot) handleSkipChapter(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	p := b.PlayerManager.GetPlayer(i.GuildID)
+	track := p.Queue.Current()
+
+	if track == nil {
+		return i18n.Error("error.nothing_playing")
+	}
+
+	if len(track.Chapters) == 0 {
+		return i18n.Error("skipchapter.none")
+	}
+
+	next := track.ChapterAt(p.Position()) + 1
+	if next >= len(track.Chapters) {
+		return i18n.Error("skipchapter.last")
+	}
+
+	chapter := track.Chapters[next]
+	if err := p.Seek(chapter.Start); err != nil {
+		return err
+	}
+
+	b.respond(r, i, announcement, b.t(i, "skipchapter.done", "title", chapter.Title, "start", formatDuration(chapter.Start)))
+	return nil
+}
+
+// handleABLoop handles the abloop command
+func (b *Bot) handleABLoop(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	subCmd, err := subcommand(i.ApplicationCommandData().Options)
+	if err != nil {
+		return err
+	}
+	p := b.PlayerManager.GetPlayer(i.GuildID)
+
+	switch subCmd.Name {
+	case "set":
+		startValue, ok := getStringOption(subCmd.Options, "start")
+		if !ok {
+			return missingOption("start")
+		}
+		endValue, ok := getStringOption(subCmd.Options, "end")
+		if !ok {
+			return missingOption("end")
+		}
+		start, err := parseDuration(startValue)
+		if err != nil {
+			return err
+		}
+		end, err := parseDuration(endValue)
+		if err != nil {
+			return err
+		}
+
+		if err := p.SetABLoop(start, end); err != nil {
+			return err
+		}
+		b.respond(r, i, announcement, b.t(i, "abloop.done", "start", formatDuration(start), "end", formatDuration(end)))
+
+	case "off":
+		p.ClearABLoop()
+		b.respond(r, i, announcement, b.t(i, "abloop.off"))
+
+	default:
+		return i18n.Error("error.unknown_subcommand")
+	}
+
+	return nil
+}
+
+// handleFilter handles the filter command
+func (b *Bot) handleFilter(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	subCmd, err := subcommand(i.ApplicationCommandData().Options)
+	if err != nil {
+		return err
+	}
+	p := b.PlayerManager.GetPlayer(i.GuildID)
+
+	switch subCmd.Name {
+	case "preset":
+		name, ok := getStringOption(subCmd.Options, "name")
+		if !ok {
+			return missingOption("name")
+		}
+		filter, ok := player.FilterPresets[name]
+		if !ok {
+			return i18n.Error("filter.unknown", "name", name)
+		}
+
+		p.SetFilter(filter)
+		if err := b.PlayerManager.SetGuildCustomFilter(i.GuildID, ""); err != nil {
+			return err
+		}
+		if filter.Expression == "" {
+			b.respond(r, i, announcement, b.t(i, "filter.off"))
+		} else {
+			b.respond(r, i, announcement, b.t(i, "filter.done", "name", filter.Name))
+		}
+
+	case "custom":
+		if !b.IsDJ(i.GuildID, i.Member) {
+			return i18n.Error("filter.djs_only")
+		}
+
+		expression, ok := getStringOption(subCmd.Options, "expression")
+		if !ok {
+			return missingOption("expression")
+		}
+		expression = strings.TrimSpace(expression)
+
+		// Validation runs FFmpeg, so defer the response
+		b.deferResponse(r, i, announcement)
+
+		if err := player.ValidateCustomFilter(expression); err != nil {
+			return err
+		}
+
+		p.SetFilter(player.CustomFilter(expression))
+		if err := b.PlayerManager.SetGuildCustomFilter(i.GuildID, expression); err != nil {
+			return err
+		}
+		b.respond(r, i, announcement, b.t(i, "filter.custom_done", "expression", expression))
+
+	case "show":
+		filter := p.GetFilter()
+		if filter.Expression == "" {
+			b.respond(r, i, announcement, b.t(i, "filter.none"))
+		} else {
+			b.respond(r, i, announcement, b.t(i, "filter.active", "name", filter.Name, "expression", filter.Expression))
+		}
+
+	default:
+		return i18n.Error("error.unknown_subcommand")
+	}
+
 	return nil
 }
 
 // handleMove handles the move command
-func (b *Bot) handleMove(s *discordgo.Session, i *discordgo.InteractionCreate) error {
-	from := int(i.ApplicationCommandData().Options[0].IntValue()) - 1
-	to := int(i.ApplicationCommandData().Options[1].IntValue()) - 1
+func (b *Bot) handleMove(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	options := i.ApplicationCommandData().Options
+	from, ok := getIntOption(options, "from")
+	if !ok {
+		return missingOption("from")
+	}
+	to, ok := getIntOption(options, "to")
+	if !ok {
+		return missingOption("to")
+	}
+	from, to = from-1, to-1
 
 	p := b.PlayerManager.GetPlayer(i.GuildID)
 	if !p.Queue.Move(from, to) {
-		return fmt.Errorf("invalid positions")
+		return i18n.Error("move.invalid")
 	}
 
-	b.respond(s, i, fmt.Sprintf("↔️ Moved track from position %d to %d", from+1, to+1))
+	b.respond(r, i, confirmation, b.t(i, "move.done", "from", from+1, "to", to+1))
 	return nil
 }
 
 // handleRemove handles the remove command
-func (b *Bot) handleRemove(s *discordgo.Session, i *discordgo.InteractionCreate) error {
-	position := int(i.ApplicationCommandData().Options[0].IntValue()) - 1
-
+func (b *Bot) handleRemove(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	options := i.ApplicationCommandData().Options
 	p := b.PlayerManager.GetPlayer(i.GuildID)
+
+	if title, ok := getStringOption(options, "title"); ok {
+		all, _ := getBoolOption(options, "all")
+		removed, candidates := p.Queue.RemoveByTitle(title, all)
+		switch {
+		case len(candidates) > 0:
+			return i18n.Error("remove.ambiguous", "title", title, "candidates", queueMatchList(candidates))
+		case len(removed) == 0:
+			return i18n.Error("find.none", "text", title)
+		case len(removed) == 1:
+			b.respond(r, i, confirmation, b.t(i, "remove.done_title", "title", removed[0].Title))
+		default:
+			b.respond(r, i, confirmation, b.t(i, "remove.done_titles", "count", len(removed), "title", title))
+		}
+		return nil
+	}
+	if _, ok := getBoolOption(options, "all"); ok {
+		return i18n.Error("remove.all_needs_title")
+	}
+
+	position, ok := getIntOption(options, "position")
+	if !ok {
+		return missingOption("position")
+	}
+	position--
+
 	if !p.Queue.Remove(position) {
-		return fmt.Errorf("invalid position")
+		return i18n.Error("remove.invalid")
 	}
 
-	b.respond(s, i, fmt.Sprintf("🗑️ Removed track at position %d", position+1))
+	b.respond(r, i, confirmation, b.t(i, "remove.done", "position", position+1))
 	return nil
 }
 
-// handleConfig handles the config command
-func (b *Bot) handleConfig(s *discordgo.Session, i *discordgo.InteractionCreate) error {
-	options := i.ApplicationCommandData().Options
-	if len(options) == 0 {
-		return fmt.Errorf("no subcommand provided")
+// findListLimit is the most matches /find and an ambiguous /remove list
+const findListLimit = 15
+
+// handleFind handles the find command
+func (b *Bot) handleFind(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	text, ok := getStringOption(i.ApplicationCommandData().Options, "text")
+	if !ok {
+		return missingOption("text")
+	}
+
+	p := b.PlayerManager.GetPlayer(i.GuildID)
+	matches := p.Queue.Find(text)
+	if len(matches) == 0 {
+		return i18n.Error("find.none", "text", text)
+	}
+
+	locale := b.locale(i)
+	embed := &discordgo.MessageEmbed{
+		Title:       i18n.T(locale, "find.title", "text", text),
+		Description: queueMatchList(matches),
+		Color:       0x0099ff,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: i18n.T(locale, "find.footer", "count", len(matches)),
+		},
+	}
+	b.respondEmbed(r, i, announcement, embed)
+	return nil
+}
+
+// queueMatchList lists queue matches with the positions /remove and /move take, up to
+// findListLimit of them
+func queueMatchList(matches []player.QueueMatch) string {
+	var builder strings.Builder
+	for _, match := range matches[:min(len(matches), findListLimit)] {
+		builder.WriteString(queueLine(fmt.Sprintf("%d. ", match.Index+1), match.Track))
+	}
+	if len(matches) > findListLimit {
+		fmt.Fprintf(&builder, "… +%d\n", len(matches)-findListLimit)
 	}
+	return builder.String()
+}
 
-	subCmd := options[0]
+// handleConfig handles the config command
+func (b *Bot) handleConfig(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	subCmd, err := subcommand(i.ApplicationCommandData().Options)
+	if err != nil {
+		return err
+	}
 	p := b.PlayerManager.GetPlayer(i.GuildID)
 
 	switch subCmd.Name {
+	case "set-default-volume":
+		volume, given := getIntOption(subCmd.Options, "volume")
+		if !given {
+			volume = -1
+		}
+		if err := b.PlayerManager.SetGuildDefaultVolume(i.GuildID, volume); err != nil {
+			return err
+		}
+		// The player already exists, so start from the new default if nothing is playing
+		volume, _ = b.PlayerManager.DefaultVolume(i.GuildID)
+		if !p.IsPlaying() {
+			if err := p.SetVolume(volume); err != nil {
+				return err
+			}
+		}
+		if !given {
+			b.respond(r, i, announcement, b.t(i, "config.volume_reset", "volume", volume))
+		} else {
+			b.respond(r, i, announcement, b.t(i, "config.volume_done", "volume", volume))
+		}
+
 	case "set-reduce-vol-when-voice":
-		enabled := subCmd.Options[0].BoolValue()
+		enabled, ok := getBoolOption(subCmd.Options, "enabled")
+		if !ok {
+			return missingOption("enabled")
+		}
 		p.ReduceOnVoice = enabled
 		if enabled {
-			b.respond(s, i, "✅ Volume reduction enabled")
+			b.respond(r, i, announcement, b.t(i, "config.reduce_on"))
 		} else {
-			b.respond(s, i, "❌ Volume reduction disabled")
+			b.respond(r, i, announcement, b.t(i, "config.reduce_off"))
 		}
 
 	case "set-reduce-vol-when-voice-target":
-		volume := int(subCmd.Options[0].IntValue())
+		volume, ok := getIntOption(subCmd.Options, "volume")
+		if !ok {
+			return missingOption("volume")
+		}
 		p.ReduceOnVoiceTarget = volume
-		b.respond(s, i, fmt.Sprintf("✅ Volume reduction target set to %d%%", volume))
+		b.respond(r, i, announcement, b.t(i, "config.reduce_target_done", "volume", volume))
+
+	case "set-bitrate":
+		kbps, ok := getIntOption(subCmd.Options, "kbps")
+		if !ok {
+			return missingOption("kbps")
+		}
+		if err := p.SetBitrateOverride(kbps * 1000); err != nil {
+			return err
+		}
+		if kbps == 0 {
+			b.respond(r, i, announcement, b.t(i, "config.bitrate_reset", "kbps", b.config().OpusBitrate))
+		} else {
+			b.respond(r, i, announcement, b.t(i, "config.bitrate_done", "kbps", kbps))
+		}
+
+	case "set-audio-robustness":
+		level, ok := getStringOption(subCmd.Options, "level")
+		if !ok {
+			return missingOption("level")
+		}
+		if level == "default" {
+			level = ""
+		}
+		if err := p.SetRobustness(level); err != nil {
+			return err
+		}
+		if level == "" {
+			b.respond(r, i, announcement, b.t(i, "config.robustness_reset"))
+		} else {
+			b.respond(r, i, announcement, b.t(i, "config.robustness_done", "level", level, "loss", player.RobustnessLevels[level]))
+		}
+
+	case "set-max-duration":
+		value, ok := getStringOption(subCmd.Options, "length")
+		if !ok {
+			return missingOption("length")
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(value) {
+		case "default":
+			p.SetMaxTrackDuration(0)
+		case "none", "off", "0":
+			p.SetMaxTrackDuration(player.NoTrackLimit)
+		default:
+			limit, err := parseDuration(value)
+			if err != nil || limit <= 0 {
+				return i18n.Error("config.max_duration_invalid")
+			}
+			p.SetMaxTrackDuration(limit)
+		}
+		if limit := b.trackLimit(p); limit > 0 {
+			b.respond(r, i, announcement, b.t(i, "config.max_duration_done", "limit", formatDuration(limit)))
+		} else {
+			b.respond(r, i, announcement, b.t(i, "config.max_duration_none"))
+		}
+
+	case "set-spotify-market":
+		market, ok := getStringOption(subCmd.Options, "country")
+		if !ok {
+			return missingOption("country")
+		}
+		if strings.EqualFold(market, "default") {
+			p.SetSpotifyMarket("")
+			b.respond(r, i, announcement, b.t(i, "config.market_reset", "market", b.config().SpotifyMarket))
+			break
+		}
+		market, err := spotify.NormalizeMarket(market)
+		if err != nil {
+			return err
+		}
+		p.SetSpotifyMarket(market)
+		b.respond(r, i, announcement, b.t(i, "config.market_done", "market", market))
+
+	case "set-search-provider":
+		provider, ok := getStringOption(subCmd.Options, "provider")
+		if !ok {
+			return missingOption("provider")
+		}
+		switch youtube.SearchProvider(provider) {
+		case youtube.SearchYouTube, youtube.SearchYouTubeMusic:
+			p.SetSearchProvider(provider)
+		case "default":
+			p.SetSearchProvider("")
+		default:
+			return i18n.Error("config.search_invalid")
+		}
+		b.respond(r, i, announcement, b.t(i, "config.search_done", "provider", searchProviderName(b.searchProvider(p), b.locale(i))))
+
+	case "set-playback-mode":
+		mode, ok := getStringOption(subCmd.Options, "mode")
+		if !ok {
+			return missingOption("mode")
+		}
+		switch mode {
+		case playbackStreamFirst, playbackDownloadFirst, playbackAuto:
+			p.SetPlaybackMode(mode)
+		case "default":
+			p.SetPlaybackMode("")
+		default:
+			return i18n.Error("config.playback_invalid")
+		}
+		b.respond(r, i, announcement, b.t(i, "config.playback_done", "mode", playbackModeName(b.playbackMode(p), b.locale(i))))
+
+	case "set-quiet-mode":
+		mode, ok := getStringOption(subCmd.Options, "mode")
+		if !ok {
+			return missingOption("mode")
+		}
+		if b.quietModes == nil {
+			return i18n.Error("config.quiet_unavailable")
+		}
+		switch mode {
+		case "on":
+			if err := b.quietModes.Set(i.GuildID, true); err != nil {
+				return err
+			}
+			b.respond(r, i, announcement, b.t(i, "config.quiet_on"))
+		case "off":
+			if err := b.quietModes.Clear(i.GuildID); err != nil {
+				return err
+			}
+			b.respond(r, i, announcement, b.t(i, "config.quiet_off"))
+		default:
+			return i18n.Error("config.quiet_invalid")
+		}
+
+	case "set-fair-queue":
+		mode, ok := getStringOption(subCmd.Options, "mode")
+		if !ok {
+			return missingOption("mode")
+		}
+		switch mode {
+		case "on":
+			p.SetFairQueue(true)
+			b.respond(r, i, announcement, b.t(i, "config.fair_on"))
+		case "off":
+			p.SetFairQueue(false)
+			b.respond(r, i, announcement, b.t(i, "config.fair_off"))
+		default:
+			return i18n.Error("config.fair_invalid")
+		}
+
+	case "set-follow-requester":
+		mode, ok := getStringOption(subCmd.Options, "mode")
+		if !ok {
+			return missingOption("mode")
+		}
+		switch mode {
+		case "on":
+			p.SetFollowRequester(true)
+			b.respond(r, i, announcement, b.t(i, "config.follow_on"))
+		case "off":
+			p.SetFollowRequester(false)
+			b.respond(r, i, announcement, b.t(i, "config.follow_off"))
+		default:
+			return i18n.Error("config.follow_invalid")
+		}
+
+	case "set-allow-boost":
+		mode, ok := getStringOption(subCmd.Options, "mode")
+		if !ok {
+			return missingOption("mode")
+		}
+		switch mode {
+		case "on":
+			p.SetAllowBoost(true)
+			b.respond(r, i, announcement, b.t(i, "config.boost_on", "max", player.MaxBoostedVolume))
+		case "off":
+			p.SetAllowBoost(false)
+			b.respond(r, i, announcement, b.t(i, "config.boost_off", "max", player.MaxVolume))
+		default:
+			return i18n.Error("config.boost_invalid")
+		}
+
+	case "set-quiet-hours":
+		if i.Member.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageGuild) == 0 {
+			return i18n.Error("config.quiet_hours_admins_only")
+		}
+		if b.quietHours == nil {
+			return i18n.Error("config.quiet_hours_unavailable")
+		}
+		start, _ := getStringOption(subCmd.Options, "start")
+		end, _ := getStringOption(subCmd.Options, "end")
+		timezone, ok := getStringOption(subCmd.Options, "timezone")
+		if !ok {
+			return missingOption("timezone")
+		}
+		q, err := newQuietHours(start, end, timezone)
+		if err != nil {
+			return err
+		}
+		if err := b.quietHours.Set(i.GuildID, q); err != nil {
+			return err
+		}
+		b.quiet.forget(i.GuildID)
+		b.respond(r, i, announcement, b.t(i, "config.quiet_hours_done", "start", q.Start, "end", q.End, "timezone", q.Timezone))
+
+	case "clear-quiet-hours":
+		if i.Member.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageGuild) == 0 {
+			return i18n.Error("config.quiet_hours_admins_only")
+		}
+		if b.quietHours == nil {
+			return i18n.Error("config.quiet_hours_unavailable")
+		}
+		if err := b.quietHours.Clear(i.GuildID); err != nil {
+			return err
+		}
+		b.quiet.forget(i.GuildID)
+		b.respond(r, i, announcement, b.t(i, "config.quiet_hours_cleared"))
+
+	case "set-audit-channel":
+		// The audit log is for holding members to account, so only admins may move or stop it
+		if i.Member.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageGuild) == 0 {
+			return i18n.Error("config.audit_admins_only")
+		}
+		if b.auditChannels == nil {
+			return i18n.Error("config.audit_unavailable")
+		}
+		channelID, ok := getChannelOption(subCmd.Options, "channel")
+		if !ok {
+			if err := b.auditChannels.Clear(i.GuildID); err != nil {
+				return err
+			}
+			b.respond(r, i, announcement, b.t(i, "config.audit_off"))
+			break
+		}
+		perms, err := b.Session.State.UserChannelPermissions(b.Session.State.User.ID, channelID)
+		if err != nil || perms&(discordgo.PermissionViewChannel|discordgo.PermissionSendMessages) != discordgo.PermissionViewChannel|discordgo.PermissionSendMessages {
+			return i18n.Error("config.audit_no_access", "channel", channelID)
+		}
+		if err := b.auditChannels.Set(i.GuildID, channelID); err != nil {
+			return err
+		}
+		b.audit.unmute(i.GuildID)
+		b.respond(r, i, announcement, b.t(i, "config.audit_done", "channel", channelID))
+
+	case "set-language":
+		language, ok := getStringOption(subCmd.Options, "language")
+		if !ok {
+			return missingOption("language")
+		}
+		if b.languages == nil {
+			return i18n.Error("config.language_unavailable")
+		}
+		if language == "default" {
+			if err := b.languages.Clear(i.GuildID); err != nil {
+				return err
+			}
+			b.respond(r, i, announcement, b.t(i, "config.language_reset"))
+			break
+		}
+		locale := i18n.Match(language)
+		if locale == "" {
+			return i18n.Error("config.language_unknown", "language", language)
+		}
+		if err := b.languages.Set(i.GuildID, locale); err != nil {
+			return err
+		}
+		b.respond(r, i, announcement, b.t(i, "config.language_done", "language", i18n.T(locale, "language.name")))
+
+	case "reload":
+		// The configuration is shared by every server, so only the bot's owner may reload it
+		if err := b.requireOwner(b.Session, i, "reload the configuration"); err != nil {
+			return err
+		}
+		logger.Info("Admin command", "user", i.Member.User.ID, "action", "reload-config", "guild", i.GuildID)
+		result, err := b.Reload()
+		if err != nil {
+			return fmt.Errorf("reload failed, keeping the running settings: %w", err)
+		}
+		b.respond(r, i, announcement, reloadSummary(result))
+
+	case "clear-spotify-cache":
+		// Matches are shared by every server, so only admins may clear them
+		if i.Member == nil || i.Member.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageGuild) == 0 {
+			return i18n.Error("config.spotify_admins_only")
+		}
+		n, err := b.spotifyMatches.clear()
+		if err != nil {
+			return err
+		}
+		b.respond(r, i, announcement, b.t(i, "config.spotify_cleared", "count", n))
 
 	case "show":
+		settings := p.GetEncoderSettings()
+		market := p.GetSpotifyMarket()
+		if market == "" {
+			market = b.config().SpotifyMarket
+		}
+		defaultVolume, guildVolume := b.PlayerManager.DefaultVolume(i.GuildID)
+		locale := b.locale(i)
+		language := i18n.T(locale, "config.language_auto")
+		if guildLocale, ok := b.guildLanguage(i.GuildID); ok {
+			language = i18n.T(guildLocale, "language.name")
+		}
 		embed := &discordgo.MessageEmbed{
-			Title: "Configuration",
+			Title: i18n.T(locale, "config.title"),
 			Fields: []*discordgo.MessageEmbedField{
 				{
-					Name:   "Reduce volume on voice",
+					Name:   i18n.T(locale, "config.default_volume"),
+					Value:  defaultVolumeText(defaultVolume, guildVolume, locale),
+					Inline: true,
+				},
+				{
+					Name:   i18n.T(locale, "config.reduce"),
 					Value:  fmt.Sprintf("%v", p.ReduceOnVoice),
 					Inline: true,
 				},
 				{
-					Name:   "Voice reduction target",
+					Name:   i18n.T(locale, "config.reduce_target"),
 					Value:  fmt.Sprintf("%d%%", p.ReduceOnVoiceTarget),
 					Inline: true,
 				},
+				{
+					Name:   i18n.T(locale, "config.bitrate"),
+					Value:  fmt.Sprintf("%d kbps", settings.Bitrate/1000),
+					Inline: true,
+				},
+				{
+					Name:   i18n.T(locale, "config.fec"),
+					Value:  fmt.Sprintf("%v / %d%%", settings.FEC, settings.PacketLoss),
+					Inline: true,
+				},
+				{
+					Name:   i18n.T(locale, "config.max_duration"),
+					Value:  trackLimitText(b.trackLimit(p), locale),
+					Inline: true,
+				},
+				{
+					Name:   i18n.T(locale, "config.market"),
+					Value:  market,
+					Inline: true,
+				},
+				{
+					Name:   i18n.T(locale, "config.search"),
+					Value:  searchProviderName(b.searchProvider(p), locale),
+					Inline: true,
+				},
+				{
+					Name:   i18n.T(locale, "config.playback"),
+					Value:  playbackModeName(b.playbackMode(p), locale),
+					Inline: true,
+				},
+				{
+					Name:   i18n.T(locale, "config.language"),
+					Value:  language,
+					Inline: true,
+				},
+				{
+					Name:   i18n.T(locale, "config.quiet"),
+					Value:  fmt.Sprintf("%v", b.quietMode(i.GuildID)),
+					Inline: true,
+				},
+				{
+					Name:   i18n.T(locale, "config.fair"),
+					Value:  fmt.Sprintf("%v", p.IsFairQueue()),
+					Inline: true,
+				},
+				{
+					Name:   i18n.T(locale, "config.follow"),
+					Value:  fmt.Sprintf("%v", p.FollowsRequester()),
+					Inline: true,
+				},
+				{
+					Name:   i18n.T(locale, "config.boost"),
+					Value:  fmt.Sprintf("%v", p.AllowBoost),
+					Inline: true,
+				},
+				{
+					Name:   i18n.T(locale, "config.quiet_hours"),
+					Value:  b.quietHoursText(i.GuildID, locale),
+					Inline: true,
+				},
+				{
+					Name:   i18n.T(locale, "config.audit"),
+					Value:  b.auditChannelText(i.GuildID, locale),
+					Inline: true,
+				},
 			},
 			Color: 0x0099ff,
 		}
-		b.respondEmbed(s, i, embed)
+		b.respondEmbed(r, i, announcement, embed)
 
 	default:
-		return fmt.Errorf("unknown subcommand")
+		return i18n.Error("error.unknown_subcommand")
 	}
 
 	return nil
 }
 
+// searchProviderName names a search provider for /config
+func searchProviderName(provider youtube.SearchProvider, locale string) string {
+	if provider == youtube.SearchYouTubeMusic {
+		return i18n.T(locale, "config.search_music")
+	}
+	return i18n.T(locale, "config.search_youtube")
+}
+
+// handleCache handles the cache command
+func (b *Bot) handleCache(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	// The cache is shared by every server, so only admins may manage it
+	if i.Member == nil || i.Member.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageGuild) == 0 {
+		return fmt.Errorf("only server admins can use /cache")
+	}
+
+	subCmd, err := subcommand(i.ApplicationCommandData().Options)
+	if err != nil {
+		return err
+	}
+
+	switch subCmd.Name {
+	case "stats":
+		b.respondEmbed(r, i, announcement, cacheStatsEmbed(b.Cache))
+
+	case "clear":
+		removed, freed := b.Cache.Clear()
+		b.respond(r, i, announcement, fmt.Sprintf("🧹 Removed %d cached tracks, freeing %d MB; tracks playing now were kept", removed, freed>>20))
+
+	case "prune":
+		message, err := b.pruneCache(subCmd.Options)
+		if err != nil {
+			return err
+		}
+		b.respond(r, i, announcement, message)
+
+	case "verify":
+		keys := b.Cache.Keys()
+		b.respond(r, i, announcement, fmt.Sprintf("🔍 Checking %d cached tracks in the background…", len(keys)))
+		go b.verifyCache(i.ChannelID, keys)
+
+	default:
+		return i18n.Error("error.unknown_subcommand")
+	}
+	return nil
+}
+
+// pruneCache prunes the cache for /cache prune and /admin cache prune, returning the reply
+func (b *Bot) pruneCache(options []*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	olderThan := b.config().CacheMaxAge
+	for _, option := range options {
+		if option.Name == "older-than" {
+			age, err := parseAge(option.StringValue())
+			if err != nil {
+				return "", err
+			}
+			olderThan = age
+		}
+	}
+
+	removed, freed := b.Cache.Prune(olderThan)
+	message := fmt.Sprintf("🧹 Removed %d files, freeing %d MB", removed, freed>>20)
+	if olderThan > 0 {
+		message += fmt.Sprintf(" (tracks unplayed for over %s)", olderThan)
+	}
+	return message, nil
+}
+
+// verifyCached probes a cached file in the background; a damaged one that is playing is
+// removed once the track ends
+func (b *Bot) verifyCached(key, title string) {
+	err := b.Cache.Verify(key)
+	if errors.Is(err, cache.ErrCorrupt) {
+		logger.Warn("Cached file failed verification", "title", title, "err", err)
+	} else if err != nil {
+		logger.Debug("Couldn't verify cached file", "title", title, "err", err)
+	}
+}
+
+// verifyCache checks every cached file and reports how many were damaged to a channel
+func (b *Bot) verifyCache(channelID string, keys []string) {
+	checked, damaged, failed := 0, 0, 0
+	for _, key := range keys {
+		err := b.Cache.Verify(key)
+		switch {
+		case err == nil:
+			checked++
+		case errors.Is(err, cache.ErrCorrupt):
+			checked++
+			damaged++
+		case b.Cache.Contains(key):
+			// ffprobe couldn't be run; the file itself may be fine
+			logger.Warn("Couldn't verify cached file", "key", key, "err", err)
+			failed++
+		}
+	}
+	logger.Info("Verified cache", "checked", checked, "damaged", damaged, "failed", failed)
+
+	message := fmt.Sprintf("✅ Checked %d cached tracks, %d were damaged and removed", checked, damaged)
+	if failed > 0 {
+		message += fmt.Sprintf("; %d couldn't be checked, see the logs", failed)
+	}
+	b.Session.ChannelMessageSend(channelID, message)
+}
+
+// cacheLargestListed is how many of the largest entries /cache stats lists
+const cacheLargestListed = 10
+
+// cacheStatsEmbed describes the cache's usage, how often it is hit, and its largest entries
+func cacheStatsEmbed(c *cache.Cache) *discordgo.MessageEmbed {
+	stats := c.DetailedStats()
+
+	var largest strings.Builder
+	for _, entry := range c.Largest(cacheLargestListed) {
+		name := entry.Title
+		if name == "" {
+			name = filepath.Base(entry.Path)
+		} else if entry.Artist != "" {
+			name = entry.Artist + " – " + entry.Title
+		}
+		fmt.Fprintf(&largest, "%d MB · %s (%d plays)\n", entry.Size>>20, name, entry.PlayCount)
+	}
+	if largest.Len() == 0 {
+		largest.WriteString("Empty")
+	}
+
+	return &discordgo.MessageEmbed{
+		Title: "💾 Cache",
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Usage", Value: fmt.Sprintf("%d MB of %d MB, %d tracks", stats.Size>>20, stats.MaxSize>>20, stats.Entries), Inline: true},
+			{Name: "Hit ratio", Value: fmt.Sprintf("%.0f%% (%d hits, %d misses)", stats.HitRatio()*100, stats.Hits, stats.Misses), Inline: true},
+			{Name: "Served from cache", Value: fmt.Sprintf("%d MB", stats.BytesServed>>20), Inline: true},
+			{Name: "Downloads", Value: fmt.Sprintf("%d started, %d completed, %d failed", stats.DownloadsStarted, stats.DownloadsCompleted, stats.DownloadsFailed), Inline: true},
+			{Name: "Evictions", Value: fmt.Sprintf("%d", stats.Evictions), Inline: true},
+			{Name: "Disk free", Value: diskFreeText(stats), Inline: true},
+			{Name: "Largest entries", Value: largest.String()},
+		},
+		Footer: &discordgo.MessageEmbedFooter{Text: "Counters are since the bot started"},
+		Color:  0x0099ff,
+	}
+}
+
+// trackLimitText describes a track length limit
+func trackLimitText(limit time.Duration, locale string) string {
+	if limit <= 0 {
+		return i18n.T(locale, "config.no_limit")
+	}
+	return formatDuration(limit)
+}
+
+// reloadSummary describes what a configuration reload changed
+func reloadSummary(result *ReloadResult) string {
+	if len(result.Applied) == 0 && len(result.Restart) == 0 {
+		return "✅ Configuration reloaded; nothing changed"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("✅ Configuration reloaded")
+	for _, change := range result.Applied {
+		fmt.Fprintf(&sb, "\n• `%s`: %s → %s", change.Name, change.Old, change.New)
+	}
+	if len(result.Restart) > 0 {
+		fmt.Fprintf(&sb, "\n⚠️ Needs a restart: %s", strings.Join(result.Restart, ", "))
+	}
+	return sb.String()
+}
+
+// defaultVolumeText describes the volume players start at and where it comes from
+func defaultVolumeText(volume int, guild bool, locale string) string {
+	if guild {
+		return i18n.T(locale, "config.default_volume_server", "volume", volume)
+	}
+	return fmt.Sprintf("%d%%", volume)
+}
+
+// diskFreeText describes the free space on the cache's disk and the reserve kept
+func diskFreeText(stats cache.Stats) string {
+	if stats.FreeSpace < 0 {
+		return "Unknown"
+	}
+	text := fmt.Sprintf("%d MB", stats.FreeSpace>>20)
+	if stats.MinFree > 0 {
+		text += fmt.Sprintf(" (keeping %d MB)", stats.MinFree>>20)
+		if stats.FreeSpace < stats.MinFree {
+			text = "⚠️ " + text
+		}
+	}
+	return text
+}
+
+// parseAge parses an age like "30d", "12h" or "90m"; days aren't a Go duration unit, so
+// they are handled here
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid age %q; use something like 30d or 12h", s)
+}
+
+// handleDebug handles the debug command
+func (b *Bot) handleDebug(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	if i.Member == nil || i.Member.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageGuild) == 0 {
+		return fmt.Errorf("only server admins can use /debug")
+	}
+
+	subCmd, err := subcommand(i.ApplicationCommandData().Options)
+	if err != nil {
+		return err
+	}
+
+	var embed *discordgo.MessageEmbed
+	switch subCmd.Name {
+	case "audio":
+		var err error
+		if embed, err = b.audioDebugEmbed(i.GuildID); err != nil {
+			return err
+		}
+
+	case "stats":
+		ytdlp := youtube.CurrentStats()
+		embed = &discordgo.MessageEmbed{
+			Title: "🔧 Bot Stats",
+			Fields: []*discordgo.MessageEmbedField{
+				{Name: "yt-dlp running", Value: fmt.Sprintf("%d of %d", ytdlp.Running, ytdlp.Limit), Inline: true},
+				{Name: "yt-dlp waiting", Value: fmt.Sprintf("%d", ytdlp.Waiting), Inline: true},
+				{Name: "Commands", Value: fmt.Sprintf("%d run, %d failed, %d crashed, %d slow", b.commands.run.Load(), b.commands.failed.Load(), b.commands.panicked.Load(), b.commands.slow.Load())},
+			},
+			Color: 0x0099ff,
+		}
+		if slowest := b.commands.slowest(5); len(slowest) > 0 {
+			var sb strings.Builder
+			for _, l := range slowest {
+				fmt.Fprintf(&sb, "/%s: %s average, %s max over %d runs\n", l.Name, l.Average().Round(time.Millisecond), l.Max.Round(time.Millisecond), l.Count)
+			}
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Slowest commands", Value: sb.String()})
+		}
+
+	default:
+		return i18n.Error("error.unknown_subcommand")
+	}
+
+	b.respondEphemeralEmbed(r, i, embed)
+	return nil
+}
+
+// audioDebugEmbed shows the encoder and playback counters for a guild's current track
+func (b *Bot) audioDebugEmbed(guildID string) (*discordgo.MessageEmbed, error) {
+	stats := b.PlayerManager.GetPlayer(guildID).AudioStats()
+	if !stats.HasEncoder {
+		return nil, fmt.Errorf("nothing is playing")
+	}
+
+	enc := stats.Encoder
+	return &discordgo.MessageEmbed{
+		Title: "🔧 Audio Debug",
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Frames encoded", Value: fmt.Sprintf("%d", enc.FramesEncoded), Inline: true},
+			{Name: "Bytes produced", Value: fmt.Sprintf("%d", enc.BytesProduced), Inline: true},
+			{Name: "Average bitrate", Value: fmt.Sprintf("%.1f kbps", float64(enc.AverageBitrate)/1000), Inline: true},
+			{Name: "Frames buffered", Value: fmt.Sprintf("%d", enc.FramesBuffered), Inline: true},
+			{Name: "Since last frame", Value: formatSince(enc.SinceLastFrame), Inline: true},
+			{Name: "Frames sent", Value: fmt.Sprintf("%d", stats.FramesSent), Inline: true},
+			{Name: "Since last send", Value: formatSince(stats.SinceLastSend), Inline: true},
+			{Name: "Under-runs", Value: fmt.Sprintf("%d", stats.Underruns), Inline: true},
+		},
+		Color: 0x0099ff,
+	}, nil
+}
+
 // Helper functions
 
+// isURL reports whether a query is a link rather than search terms
+// Queries like "Mozart: Requiem" parse with a scheme but no host, so a host is required
+func isURL(query string) bool {
+	u, err := url.Parse(strings.TrimSpace(query))
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// formatSince formats the time since an event for debug output
+func formatSince(d time.Duration) string {
+	if d == 0 {
+		return "never"
+	}
+	return fmt.Sprintf("%d ms", d.Milliseconds())
+}
+
+// formatCount formats a count with thousands separators
+func formatCount(n int64) string {
+	digits := strconv.FormatInt(n, 10)
+	var builder strings.Builder
+	for idx, digit := range digits {
+		if idx > 0 && (len(digits)-idx)%3 == 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteRune(digit)
+	}
+	return builder.String()
+}
+
 func formatDuration(d time.Duration) string {
 	d = d.Round(time.Second)
 	h := d / time.Hour
@@ -597,38 +2356,68 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%02d:%02d", m, s)
 }
 
+// maxDurationField is the most digits the first field of a colon-separated duration may have
+const maxDurationField = 5
+
+// parseDuration reads a position or length typed by a user: "1:02:30", "1:30", "90", "90s"
+// or "1m30s"
 func parseDuration(s string) (time.Duration, error) {
-	// Support formats: "1:30", "90", "90s", "1m30s"
+	s = strings.TrimSpace(s)
 	if strings.Contains(s, ":") {
 		parts := strings.Split(s, ":")
-		if len(parts) != 2 {
-			return 0, fmt.Errorf("invalid duration format")
-		}
-
-		minutes, err := strconv.Atoi(parts[0])
-		if err != nil {
-			return 0, err
+		if len(parts) > 3 {
+			return 0, i18n.Error("error.invalid_duration")
 		}
 
-		seconds, err := strconv.Atoi(parts[1])
-		if err != nil {
-			return 0, err
+		var seconds int64
+		for n, part := range parts {
+			value, err := strconv.ParseInt(part, 10, 64)
+			// Fields are plain digits; minutes and seconds after the first field are under 60
+			valid := err == nil && part[0] >= '0' && part[0] <= '9'
+			if n == 0 {
+				valid = valid && len(part) <= maxDurationField
+			} else {
+				valid = valid && len(part) <= 2 && value < 60
+			}
+			if !valid {
+				return 0, i18n.Error("error.invalid_duration")
+			}
+			seconds = seconds*60 + value
 		}
-
-		return time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second, nil
+		return time.Duration(seconds) * time.Second, nil
 	}
 
 	// Try parsing as duration string
-	if d, err := time.ParseDuration(s); err == nil {
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
 		return d, nil
 	}
 
 	// Try parsing as seconds
-	if seconds, err := strconv.Atoi(strings.TrimSuffix(s, "s")); err == nil {
+	digits := strings.TrimSuffix(s, "s")
+	if seconds, err := strconv.ParseInt(digits, 10, 64); err == nil && digits[0] >= '0' && digits[0] <= '9' &&
+		seconds <= int64(math.MaxInt64/time.Second) {
 		return time.Duration(seconds) * time.Second, nil
 	}
 
-	return 0, fmt.Errorf("invalid duration format")
+	return 0, i18n.Error("error.invalid_duration")
+}
+
+// parseSeekPosition reads a /seek position: anything parseDuration reads, or a percentage of
+// the track's length like "50%", which livestreams and tracks of unknown length don't have
+func parseSeekPosition(s string, track *player.Track) (time.Duration, error) {
+	number, ok := strings.CutSuffix(strings.TrimSpace(s), "%")
+	if !ok {
+		return parseDuration(s)
+	}
+	if track.IsLive || track.Duration <= 0 {
+		return 0, i18n.Error("seek.percent_no_length")
+	}
+
+	percent, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || math.IsNaN(percent) || percent < 0 || percent > 100 {
+		return 0, i18n.Error("seek.invalid_percent")
+	}
+	return time.Duration(float64(track.Duration) * percent / 100), nil
 }
 
 func ptrString(s string) *string {
@@ -0,0 +1,272 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/config"
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/GrainedLotus515/gobard/internal/youtube"
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestQueueETA(t *testing.T) {
+	p := player.NewManager().GetPlayer("guild")
+	current := &player.Track{Title: "now", Duration: 3 * time.Minute}
+	ahead := []*player.Track{
+		{Title: "next", Duration: 4 * time.Minute},
+		{Title: "after", Duration: 5 * time.Minute},
+	}
+
+	if eta, ok := queueETA(p, current, ahead); !ok || eta != 12*time.Minute {
+		t.Errorf("queueETA = %v, %v; want 12m", eta, ok)
+	}
+	if eta, ok := queueETA(p, nil, ahead[:1]); !ok || eta != 4*time.Minute {
+		t.Errorf("queueETA with nothing playing = %v, %v; want 4m", eta, ok)
+	}
+
+	p.SetFilter(player.AudioFilter{Name: "fast", Expression: "atempo=2", Speed: 2})
+	if eta, ok := queueETA(p, current, ahead); !ok || eta != 6*time.Minute {
+		t.Errorf("queueETA at double speed = %v, %v; want 6m", eta, ok)
+	}
+
+	live := []*player.Track{{Title: "stream", IsLive: true}}
+	if _, ok := queueETA(p, current, live); ok {
+		t.Error("queueETA estimated past a livestream")
+	}
+	p.Queue.Loop = true
+	if _, ok := queueETA(p, current, ahead); ok {
+		t.Error("queueETA estimated past a looping track")
+	}
+}
+
+func TestQueueOrder(t *testing.T) {
+	b := &Bot{}
+	short := &player.Track{Title: "b", Duration: time.Minute}
+	long := &player.Track{Title: "A", Duration: 5 * time.Minute}
+	live := &player.Track{Title: "c", IsLive: true}
+
+	byTitle, err := b.queueOrder("guild", "title", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !byTitle(long, short) || byTitle(short, long) {
+		t.Error("titles aren't sorted case-insensitively")
+	}
+
+	byDuration, err := b.queueOrder("guild", "duration", true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !byDuration(long, short) || !byDuration(live, long) {
+		t.Error("descending durations don't put livestreams and longer tracks first")
+	}
+	if byDuration(short, short) {
+		t.Error("descending order reports a track as less than itself, so sorting isn't stable")
+	}
+
+	if _, err := b.queueOrder("guild", "views", false, nil); err == nil {
+		t.Error("queueOrder accepted an unknown key")
+	}
+}
+
+func TestQueueOrderByRequesterName(t *testing.T) {
+	state := discordgo.NewState()
+	state.GuildAdd(&discordgo.Guild{ID: "guild"})
+	state.MemberAdd(&discordgo.Member{GuildID: "guild", User: &discordgo.User{ID: "1"}, Nick: "Zoe"})
+	state.MemberAdd(&discordgo.Member{GuildID: "guild", User: &discordgo.User{ID: "2"}, Nick: "adam"})
+	b := &Bot{Session: &discordgo.Session{State: state}}
+
+	zoe := &player.Track{Title: "z", RequestedBy: "1"}
+	adam := &player.Track{Title: "a", RequestedBy: "2"}
+	byRequester, err := b.queueOrder("guild", "requester", false, []*player.Track{zoe, adam})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !byRequester(adam, zoe) || byRequester(zoe, adam) {
+		t.Error("requesters aren't sorted by their names, ignoring case")
+	}
+
+	// A requester whose name wasn't looked up beforehand sorts by ID rather than reaching the state
+	state.MemberRemove(&discordgo.Member{GuildID: "guild", User: &discordgo.User{ID: "1"}})
+	if !byRequester(adam, zoe) {
+		t.Error("names changed after the order was made")
+	}
+	if late := (&player.Track{Title: "late", RequestedBy: "0"}); !byRequester(late, adam) {
+		t.Error("a requester that wasn't looked up doesn't sort by ID")
+	}
+}
+
+func TestInterleaveRequesters(t *testing.T) {
+	p := player.NewManager().GetPlayer("guild")
+	p.Queue.AddAll([]*player.Track{
+		{Title: "now", RequestedBy: "a"},
+		{Title: "a1", RequestedBy: "a"},
+		{Title: "a2", RequestedBy: "a"},
+	})
+	p.Queue.Next()
+	added := []*player.Track{{Title: "b1", RequestedBy: "b"}, {Title: "b2", RequestedBy: "b"}}
+	_, ahead := p.Queue.AddAll(added)
+
+	if got, placed := interleaveRequesters(p, added, ahead, false); len(got) != 2 || placed != 2 {
+		t.Errorf("interleaveRequesters without fair queue = %d ahead, %d placed; want 2, 2", len(got), placed)
+	}
+
+	p.SetFairQueue(true)
+	got, placed := interleaveRequesters(p, added, ahead, false)
+	if len(got) != 1 || got[0].Title != "a1" || placed != 1 {
+		t.Errorf("interleaveRequesters in fair queue mode = %d ahead, %d placed; want a1 ahead, 1 placed", len(got), placed)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	valid := []struct {
+		input string
+		want  time.Duration
+	}{
+		{"90", 90 * time.Second},
+		{"90s", 90 * time.Second},
+		{"0", 0},
+		{"1m30s", 90 * time.Second},
+		{"1h2m", time.Hour + 2*time.Minute},
+		{"1:30", 90 * time.Second},
+		{"0:05", 5 * time.Second},
+		{"1:5", 65 * time.Second},
+		{"90:00", 90 * time.Minute},
+		{"1:02:30", time.Hour + 2*time.Minute + 30*time.Second},
+		{"0:00:00", 0},
+		{"10:59:59", 10*time.Hour + 59*time.Minute + 59*time.Second},
+		{" 2:00 ", 2 * time.Minute},
+	}
+	for _, tt := range valid {
+		if got, err := parseDuration(tt.input); err != nil || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v; want %v", tt.input, got, err, tt.want)
+		}
+	}
+
+	invalid := []string{
+		"", " ", "s", "abc", "1:2:3:4", "1:60", "1:02:60", "1:60:00", ":30", "1:", "1::30",
+		"-5", "-1:30", "1:-30", "+5", "+1:30", "1:+3", "1.5:00", "1:30.5", "1:030",
+		"-1m", "5x", "1:3o", "999999:00", "99999999999999999999", "9999999999999s", "½", "１:３０",
+	}
+	for _, input := range invalid {
+		if got, err := parseDuration(input); err == nil {
+			t.Errorf("parseDuration(%q) = %v, want an error", input, got)
+		}
+	}
+}
+
+func TestParseSeekPosition(t *testing.T) {
+	song := &player.Track{Duration: 4 * time.Minute}
+	valid := []struct {
+		input string
+		want  time.Duration
+	}{
+		{"50%", 2 * time.Minute},
+		{"0%", 0},
+		{"100%", 4 * time.Minute},
+		{"12.5%", 30 * time.Second},
+		{" 25 % ", time.Minute},
+		{"1:30", 90 * time.Second},
+	}
+	for _, tt := range valid {
+		if got, err := parseSeekPosition(tt.input, song); err != nil || got != tt.want {
+			t.Errorf("parseSeekPosition(%q) = %v, %v; want %v", tt.input, got, err, tt.want)
+		}
+	}
+
+	for _, input := range []string{"%", "-10%", "101%", "NaN%", "Inf%", "abc%", "50%%", "5O%"} {
+		if got, err := parseSeekPosition(input, song); err == nil {
+			t.Errorf("parseSeekPosition(%q) = %v, want an error", input, got)
+		}
+	}
+
+	for _, track := range []*player.Track{{IsLive: true}, {}} {
+		if _, err := parseSeekPosition("50%", track); err == nil {
+			t.Errorf("parseSeekPosition accepted a percentage of a track with live %v and length %v", track.IsLive, track.Duration)
+		}
+	}
+}
+
+func TestRemoveAllNeedsTitle(t *testing.T) {
+	s, _ := testSession(t)
+	b := &Bot{PlayerManager: player.NewManager()}
+	i := testInteraction("remove")
+	p := b.PlayerManager.GetPlayer(i.GuildID)
+	p.Queue.Add(&player.Track{Title: "playing"})
+	p.Queue.Next()
+	p.Queue.Add(&player.Track{Title: "next"})
+
+	i.Data = discordgo.ApplicationCommandInteractionData{Name: "remove", Options: []*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "position", Type: discordgo.ApplicationCommandOptionInteger, Value: float64(1)},
+		{Name: "all", Type: discordgo.ApplicationCommandOptionBoolean, Value: true},
+	}}
+
+	err := b.handleRemove(context.Background(), newInteractionResponder(s, i), i)
+	if message, ok := err.(*i18n.Message); !ok || message.Key != "remove.all_needs_title" {
+		t.Errorf("error = %v, want remove.all_needs_title", err)
+	}
+	if p.Queue.Length() != 2 {
+		t.Errorf("Length() = %d, want nothing removed", p.Queue.Length())
+	}
+}
+
+// Run with -race: /config and /play run in goroutines of their own
+func TestConfigDuringPlay(t *testing.T) {
+	s, _ := testSession(t)
+	b := &Bot{
+		Config:        &config.Config{SpotifyMarket: "US", SearchProvider: "youtube", PlaybackMode: playbackStreamFirst, MaxTrackDuration: time.Hour},
+		PlayerManager: player.NewManager(),
+	}
+	p := b.PlayerManager.GetPlayer(testInteraction("config").GuildID)
+	settings := []struct{ subcommand, option, value string }{
+		{"set-fair-queue", "mode", "on"},
+		{"set-follow-requester", "mode", "on"},
+		{"set-max-duration", "length", "10:00"},
+		{"set-spotify-market", "country", "BR"},
+		{"set-search-provider", "provider", "youtube_music"},
+		{"set-playback-mode", "mode", playbackDownloadFirst},
+	}
+
+	var wg sync.WaitGroup
+	for _, setting := range settings {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			i := testInteraction("config")
+			i.Data = discordgo.ApplicationCommandInteractionData{Name: "config", Options: []*discordgo.ApplicationCommandInteractionDataOption{{
+				Name: setting.subcommand,
+				Type: discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandInteractionDataOption{
+					{Name: setting.option, Type: discordgo.ApplicationCommandOptionString, Value: setting.value},
+				},
+			}}}
+			if err := b.handleConfig(context.Background(), newInteractionResponder(s, i), i); err != nil {
+				t.Errorf("/config %s: %v", setting.subcommand, err)
+			}
+		}()
+	}
+
+	// What /play reads of the guild's settings while it resolves and queues tracks
+	track := &player.Track{Title: "song", Duration: 5 * time.Minute, RequestedBy: "a"}
+	for range 20 {
+		b.resolveQuery(context.Background(), "https://open.spotify.com/track/x", "a", p, youtube.PlaylistOptions{})
+		b.searchProvider(p)
+		b.refusal(p, track)
+		b.downloadsFirst(p, track)
+		interleaveRequesters(p, []*player.Track{track, track}, nil, false)
+		p.FollowsRequester()
+	}
+	wg.Wait()
+
+	if limit := b.trackLimit(p); limit != 10*time.Minute {
+		t.Errorf("trackLimit = %v, want 10m", limit)
+	}
+	if !p.IsFairQueue() || !p.FollowsRequester() || p.GetSpotifyMarket() != "BR" ||
+		b.searchProvider(p) != youtube.SearchYouTubeMusic || b.playbackMode(p) != playbackDownloadFirst {
+		t.Error("a /config setting was lost")
+	}
+}
@@ -0,0 +1,305 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// importMatchLimit is the most tracks an album, artist or playlist from another service
+	// can have to be matched on YouTube as soon as it's imported, so its summary can tell
+	// which weren't found; bigger imports are matched shortly before each track plays
+	importMatchLimit = 50
+	// importRetryWindow is how long an import's unmatched tracks can be retried, which is
+	// also how long Discord lets its response be edited
+	importRetryWindow = 15 * time.Minute
+	// importButtonPrefix starts the custom ID of an import's retry button, followed by the
+	// ID of the interaction that imported it
+	importButtonPrefix = "import:"
+)
+
+// matchFailure is a track an import couldn't match on YouTube, and why
+type matchFailure struct {
+	Track *player.Track // Detached from the queue, to be queued again once matched
+	Err   error
+}
+
+// importRecord is an import whose tracks are being matched, or whose unmatched tracks can
+// be retried
+type importRecord struct {
+	id           string // The importing interaction's ID
+	userID       string
+	channelID    string
+	volumeOffset int
+	locale       string
+	// embed is the import's summary as first sent, without the matching field
+	embed *discordgo.MessageEmbed
+
+	mu       sync.Mutex
+	matched  int
+	added    []string // Titles of tracks added by retrying, approximate ones marked
+	refused  int      // Tracks found by retrying that the server doesn't allow
+	failed   []matchFailure
+	retrying bool
+}
+
+// importRecords remembers imports by their ID for importRetryWindow
+type importRecords struct {
+	mu      sync.Mutex
+	records map[string]*importRecord
+}
+
+// put remembers an import until importRetryWindow passes
+func (r *importRecords) put(record *importRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.records == nil {
+		r.records = make(map[string]*importRecord)
+	}
+	r.records[record.id] = record
+	time.AfterFunc(importRetryWindow, func() { r.forget(record) })
+}
+
+// get returns the import an interaction started, if it is still remembered
+func (r *importRecords) get(id string) (*importRecord, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record, ok := r.records[id]
+	return record, ok
+}
+
+// forget drops an import, unless another was remembered under its ID since
+func (r *importRecords) forget(record *importRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.records[record.id] == record {
+		delete(r.records, record.id)
+	}
+}
+
+// matchesEagerly reports whether an import's tracks are matched on YouTube as soon as it's
+// queued rather than as they come up
+func matchesEagerly(tracks []*player.Track) bool {
+	return len(tracks) > 0 && len(tracks) <= importMatchLimit && tracks[0].NeedsMatch()
+}
+
+// matchImport matches an import's tracks on YouTube one by one, removing the ones without
+// a match from the queue and editing the import's summary to show how far it got
+// Tracks removed meanwhile are left alone, as is the current track, which the playback
+// loop matches itself
+func (b *Bot) matchImport(r responder, p *player.GuildPlayer, tracks []*player.Track, record *importRecord) {
+	last := time.Now()
+	matched := 0
+	var failed []matchFailure
+	for n, track := range tracks {
+		if time.Since(last) >= importProgressInterval {
+			last = time.Now()
+			record.show(r, p.GuildID, i18n.T(record.locale, "import.matching", "done", n, "total", len(tracks)), false)
+		}
+		if track.Context().Err() != nil || track == p.Queue.Current() {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(track.Context(), resolveTimeout)
+		resolved, err := b.spotifyMatches.match(ctx, track)
+		cancel()
+		switch {
+		case err == nil:
+			// The track resolver may have swapped it in already
+			p.Queue.ReplaceUpcoming(track, resolved)
+			matched++
+		case track.Context().Err() != nil:
+			// Removed while it was being matched
+		case p.Queue.RemoveTrack(track):
+			logger.Debug("Couldn't match an imported track", "guild", p.GuildID, "title", track.Title, "err", err)
+			failed = append(failed, matchFailure{Track: track.Detached(), Err: err})
+		}
+	}
+
+	record.mu.Lock()
+	record.matched = matched
+	record.failed = failed
+	record.mu.Unlock()
+	record.show(r, p.GuildID, record.summary(), len(failed) > 0)
+}
+
+// summary describes what matching an import found, and what retrying it added
+func (r *importRecord) summary() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lines := []string{i18n.T(r.locale, "import.matched", "count", r.matched)}
+	if len(r.added) > 0 {
+		lines = append(lines, i18n.T(r.locale, "import.retried", "count", len(r.added), "titles", missingList(r.added)))
+	}
+	if r.refused > 0 {
+		lines = append(lines, i18n.T(r.locale, "import.retry_refused", "count", r.refused))
+	}
+	if len(r.failed) > 0 {
+		titles := make([]string, len(r.failed))
+		for n, failure := range r.failed {
+			titles[n] = failure.Track.Title
+		}
+		lines = append(lines, i18n.T(r.locale, "import.match_failed", "count", len(r.failed), "titles", missingList(titles)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// show edits an import's summary to add a field about matching, with the retry button if
+// retry is set
+func (r *importRecord) show(to responder, guildID, value string, retry bool) {
+	embed := *r.embed
+	embed.Fields = append(embed.Fields[:len(embed.Fields):len(embed.Fields)], &discordgo.MessageEmbedField{
+		Name:  i18n.T(r.locale, "import.match_field"),
+		Value: value,
+	})
+	embeds := []*discordgo.MessageEmbed{&embed}
+
+	components := []discordgo.MessageComponent{}
+	if retry {
+		components = importRetryButton(r.id, r.locale)
+	}
+	if err := to.edit(&discordgo.WebhookEdit{
+		Embeds:     &embeds,
+		Components: &components,
+	}); err != nil {
+		logger.Warn("Failed to update an import's summary", "guild", guildID, "err", err)
+	}
+}
+
+// importRetryButton is the button that retries matching the tracks an import couldn't match
+func importRetryButton(id, locale string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    i18n.T(locale, "import.retry_button"),
+				Style:    discordgo.SecondaryButton,
+				CustomID: importButtonPrefix + id,
+			},
+		}},
+	}
+}
+
+// handleImportButton retries matching the tracks an import couldn't match, accepting covers
+// and live versions when nothing closer turns up, and queues the ones found
+// Only the user who imported the tracks can retry them
+func (b *Bot) handleImportButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	id := strings.TrimPrefix(i.MessageComponentData().CustomID, importButtonPrefix)
+	record, ok := b.imports.get(id)
+	switch {
+	case !ok:
+		b.importButtonNotice(s, i, b.t(i, "import.retry_expired"))
+		return
+	case i.Member == nil || i.Member.User == nil || i.Member.User.ID != record.userID:
+		b.importButtonNotice(s, i, b.t(i, "import.retry_not_yours"))
+		return
+	}
+
+	record.mu.Lock()
+	if record.retrying {
+		record.mu.Unlock()
+		b.importButtonNotice(s, i, b.t(i, "import.retry_running"))
+		return
+	}
+	record.retrying = true
+	failed := record.failed
+	record.mu.Unlock()
+	defer func() {
+		record.mu.Lock()
+		record.retrying = false
+		record.mu.Unlock()
+	}()
+
+	// Finding the tracks again may take longer than Discord waits for an answer
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	}); err != nil {
+		logger.Warn("Failed to acknowledge an import retry", "guild", i.GuildID, "err", err)
+		return
+	}
+
+	p, err := b.joinInvoker(i)
+	if err != nil {
+		b.importButtonFollowup(s, i, err)
+		return
+	}
+
+	// The button's message is edited through the interaction that pressed it
+	r := newInteractionResponder(s, i)
+	record.show(r, i.GuildID, i18n.T(record.locale, "import.retrying", "count", len(failed)), false)
+
+	var tracks []*player.Track
+	var added []string
+	var stillFailed []matchFailure
+	refused := 0
+	for _, failure := range failed {
+		ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+		matched, approximate, err := b.spotifyMatches.matchLoosely(ctx, failure.Track)
+		cancel()
+		if err != nil {
+			stillFailed = append(stillFailed, matchFailure{Track: failure.Track, Err: err})
+			continue
+		}
+		if reason := b.refusal(p, matched); reason != nil {
+			refused++
+			continue
+		}
+		matched.RequestedBy = record.userID
+		matched.VolumeOffset = record.volumeOffset
+		tracks = append(tracks, matched)
+
+		title := matched.Title
+		if approximate {
+			title = i18n.T(record.locale, "import.approximate", "title", title)
+		}
+		added = append(added, title)
+	}
+
+	if len(tracks) > 0 {
+		_, ahead := p.Queue.AddAll(tracks)
+		interleaveRequesters(p, tracks, ahead, false)
+		p.EnsureLoop(func() { b.playLoop(i.GuildID, record.channelID) })
+	}
+
+	record.mu.Lock()
+	record.added = append(record.added, added...)
+	record.refused += refused
+	record.failed = stillFailed
+	record.mu.Unlock()
+	record.show(r, i.GuildID, record.summary(), len(stillFailed) > 0)
+}
+
+// importButtonNotice answers a retry button press with a message only the presser sees
+func (b *Bot) importButtonNotice(s *discordgo.Session, i *discordgo.InteractionCreate, message string) {
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: message,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	}); err != nil {
+		logger.Warn("Failed to answer an import retry", "guild", i.GuildID, "err", err)
+	}
+}
+
+// importButtonFollowup tells the presser of an acknowledged retry button why it failed
+func (b *Bot) importButtonFollowup(s *discordgo.Session, i *discordgo.InteractionCreate, err error) {
+	message := err.Error()
+	if m, ok := err.(*i18n.Message); ok {
+		message = m.In(b.locale(i))
+	}
+	if _, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content: b.t(i, "error", "error", message),
+		Flags:   discordgo.MessageFlagsEphemeral,
+	}); err != nil {
+		logger.Warn("Failed to answer an import retry", "guild", i.GuildID, "err", err)
+	}
+}
@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GrainedLotus515/gobard/internal/player"
+)
+
+func TestImportRecords(t *testing.T) {
+	var records importRecords
+	first := &importRecord{id: "1"}
+	records.put(first)
+	if got, ok := records.get("1"); !ok || got != first {
+		t.Fatalf("get(1) = %p, %v; want the import put", got, ok)
+	}
+
+	// An import remembered again under the same ID outlives the first one's expiry
+	second := &importRecord{id: "1"}
+	records.put(second)
+	records.forget(first)
+	if got, ok := records.get("1"); !ok || got != second {
+		t.Errorf("get(1) after the first import expired = %p, %v; want the second", got, ok)
+	}
+	records.forget(second)
+	if _, ok := records.get("1"); ok {
+		t.Error("an expired import is still remembered")
+	}
+}
+
+func TestImportSummary(t *testing.T) {
+	record := &importRecord{locale: "en-US", matched: 8}
+	if got, want := record.summary(), "✅ 8 found on YouTube"; got != want {
+		t.Errorf("summary = %q, want %q", got, want)
+	}
+
+	record.added = []string{"Intro (⚠ approximate)"}
+	record.failed = []matchFailure{
+		{Track: &player.Track{Title: "Skit"}, Err: errors.New("no match")},
+		{Track: &player.Track{Title: "Outro"}, Err: errors.New("no match")},
+	}
+	want := "✅ 8 found on YouTube\n➕ Added 1 on retry: Intro (⚠ approximate)\n⚠️ 2 not found: Skit, Outro"
+	if got := record.summary(); got != want {
+		t.Errorf("summary after a retry = %q, want %q", got, want)
+	}
+}
+
+func TestMatchesEagerly(t *testing.T) {
+	spotify := func(n int) []*player.Track {
+		tracks := make([]*player.Track, n)
+		for i := range tracks {
+			tracks[i] = &player.Track{Source: player.SourceSpotify}
+		}
+		return tracks
+	}
+	if !matchesEagerly(spotify(12)) {
+		t.Error("an album from Spotify isn't matched right away")
+	}
+	if matchesEagerly(spotify(importMatchLimit + 1)) {
+		t.Error("a big Spotify playlist is matched right away")
+	}
+	if matchesEagerly([]*player.Track{{Source: player.SourceYouTube}}) {
+		t.Error("a YouTube playlist is matched")
+	}
+}
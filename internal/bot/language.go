@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/bwmarrin/discordgo"
+)
+
+// languageStoreFile is where servers' chosen languages are kept, relative to the cache directory
+const languageStoreFile = "guilds/languages.json"
+
+// locale returns the locale to answer an interaction in: the server's language set with
+// /config set-language, else the member's Discord language, else the server's
+func (b *Bot) locale(i *discordgo.InteractionCreate) string {
+	if locale, ok := b.guildLanguage(i.GuildID); ok {
+		return locale
+	}
+	if locale := i18n.Match(string(i.Locale)); locale != "" {
+		return locale
+	}
+	if i.GuildLocale != nil {
+		if locale := i18n.Match(string(*i.GuildLocale)); locale != "" {
+			return locale
+		}
+	}
+	return i18n.Default
+}
+
+// guildLocale returns the locale for messages a server gets outside of a command, like
+// playback notices: its language set with /config set-language, else its community language
+func (b *Bot) guildLocale(guildID string) string {
+	if locale, ok := b.guildLanguage(guildID); ok {
+		return locale
+	}
+	if guild, err := b.Session.State.Guild(guildID); err == nil {
+		if locale := i18n.Match(guild.PreferredLocale); locale != "" {
+			return locale
+		}
+	}
+	return i18n.Default
+}
+
+// guildLanguage returns the locale a server chose, if it chose one that is still available
+func (b *Bot) guildLanguage(guildID string) (string, bool) {
+	if b.languages == nil || guildID == "" {
+		return "", false
+	}
+	locale, ok := b.languages.Get(guildID)
+	if !ok {
+		return "", false
+	}
+	locale = i18n.Match(locale)
+	return locale, locale != ""
+}
+
+// t returns a message in the locale an interaction is answered in; see i18n.T
+func (b *Bot) t(i *discordgo.InteractionCreate, key string, args ...any) string {
+	return i18n.T(b.locale(i), key, args...)
+}
+
+// languageChoices are the options of /config set-language: "default" and each locale,
+// named in its own language
+func languageChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := []*discordgo.ApplicationCommandOptionChoice{{Name: "default", Value: "default"}}
+	for _, locale := range i18n.Locales() {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  i18n.T(locale, "language.name"),
+			Value: locale,
+		})
+	}
+	return choices
+}
+
+// descriptionLocalizations returns a command's description in each locale that translates
+// it, for Discord to show in members' own language; nil if none do
+func descriptionLocalizations(name string) *map[discordgo.Locale]string {
+	localizations := make(map[discordgo.Locale]string)
+	for _, locale := range i18n.Locales() {
+		if locale != i18n.Default && i18n.Has(locale, "command."+name) {
+			localizations[discordgo.Locale(locale)] = i18n.T(locale, "command."+name)
+		}
+	}
+	if len(localizations) == 0 {
+		return nil
+	}
+	return &localizations
+}
@@ -0,0 +1,59 @@
+package bot
+
+import (
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/GrainedLotus515/gobard/internal/youtube"
+)
+
+// trackLimit returns the longest track a guild may queue, 0 for no limit
+func (b *Bot) trackLimit(p *player.GuildPlayer) time.Duration {
+	switch limit := p.GetMaxTrackDuration(); {
+	case limit == player.NoTrackLimit:
+		return 0
+	case limit > 0:
+		return limit
+	}
+	return b.config().MaxTrackDuration
+}
+
+// refusal returns why a guild doesn't allow a track, or nil if it does
+func (b *Bot) refusal(p *player.GuildPlayer, track *player.Track) *i18n.Message {
+	if blocklisted(b.blockRules(p.GuildID), track) {
+		return i18n.New("limit.blocked")
+	}
+	if track.IsLive && !b.config().AllowLive {
+		return i18n.New("limit.live")
+	}
+	if limit := b.trackLimit(p); track.OverLimit(limit) {
+		return i18n.New("limit.too_long", "length", formatDuration(track.Duration), "limit", formatDuration(limit))
+	}
+	return nil
+}
+
+// allowedTracks leaves out the tracks of an import that a guild doesn't allow or has
+// blocklisted, counting them in playlist
+// Tracks of unknown length are kept; they are checked again once resolved
+func (b *Bot) allowedTracks(p *player.GuildPlayer, tracks []*player.Track, playlist *youtube.Playlist) []*player.Track {
+	limit := b.trackLimit(p)
+	allowLive := b.config().AllowLive
+	rules := b.blockRules(p.GuildID)
+
+	kept := make([]*player.Track, 0, len(tracks))
+	for _, track := range tracks {
+		switch {
+		case blocklisted(rules, track):
+			playlist.Blocked++
+		case track.IsLive && !allowLive:
+			playlist.Live++
+		case track.OverLimit(limit):
+			playlist.TooLong++
+		default:
+			kept = append(kept, track)
+		}
+	}
+	playlist.Tracks = kept
+	return kept
+}
@@ -0,0 +1,334 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/lyrics"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// lyricsTimeout is how long a lyrics lookup may take
+	lyricsTimeout = 10 * time.Second
+	// lyricsPageLimit is the most characters on one page of lyrics, Discord's embed
+	// description limit
+	lyricsPageLimit = 4096
+	// lyricsCacheSize is how many lookups are remembered, found or not
+	lyricsCacheSize = 256
+	// lyricsRefreshInterval is how often synced lyrics follow the playing track
+	lyricsRefreshInterval = 3 * time.Second
+	// lyricsLiveFor is how long synced lyrics keep following the track; Discord stops
+	// accepting edits of an interaction's response after 15 minutes
+	lyricsLiveFor = 14 * time.Minute
+	// lyricsContext is how many lines are shown before and after the one being sung
+	lyricsContext = 5
+	// lyricsButtonPrefix starts the custom IDs of /lyrics page buttons, followed by the
+	// lyrics' ID and the page they turn to
+	lyricsButtonPrefix = "lyrics:"
+)
+
+// lyricsCache remembers lookups by key, including songs without lyrics (a nil entry), and
+// forgets the oldest once it holds lyricsCacheSize
+type lyricsCache struct {
+	mu      sync.Mutex
+	entries map[string]*lyrics.Lyrics
+	order   []string
+}
+
+// get returns the lyrics remembered for a key, which are nil if there were none
+func (c *lyricsCache) get(key string) (*lyrics.Lyrics, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	l, ok := c.entries[key]
+	return l, ok
+}
+
+// put remembers the lyrics for a key
+func (c *lyricsCache) put(key string, l *lyrics.Lyrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]*lyrics.Lyrics)
+	}
+	if _, ok := c.entries[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = l
+	for len(c.order) > lyricsCacheSize {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// findLyrics returns the lyrics remembered for a key, or looks them up with find and
+// remembers them, also by their ID for the page buttons; nil means there are none
+func (b *Bot) findLyrics(ctx context.Context, key string, find func(ctx context.Context) (*lyrics.Lyrics, error)) (*lyrics.Lyrics, error) {
+	if l, ok := b.lyricsCache.get(key); ok {
+		return l, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lyricsTimeout)
+	defer cancel()
+	l, err := find(ctx)
+	if errors.Is(err, lyrics.ErrNotFound) {
+		b.lyricsCache.put(key, nil)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	b.lyricsCache.put(key, l)
+	b.lyricsCache.put(lyricsIDKey(l.ID), l)
+	return l, nil
+}
+
+// lyricsIDKey is the cache key of lyrics by their ID
+func lyricsIDKey(id int) string {
+	return "id:" + strconv.Itoa(id)
+}
+
+// handleLyrics handles the lyrics command
+func (b *Bot) handleLyrics(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	query, _ := getStringOption(i.ApplicationCommandData().Options, "query")
+	query = strings.TrimSpace(query)
+
+	p := b.PlayerManager.GetPlayer(i.GuildID)
+	var track *player.Track
+	if query == "" {
+		if track = p.Queue.Current(); track == nil {
+			return i18n.Error("error.nothing_playing")
+		}
+	}
+
+	b.deferResponse(r, i, announcement)
+
+	var l *lyrics.Lyrics
+	var err error
+	name := query
+	if track != nil {
+		name = track.Title
+		key := track.ID
+		if key == "" {
+			key = track.URL
+		}
+		l, err = b.findLyrics(ctx, "track:"+key, func(ctx context.Context) (*lyrics.Lyrics, error) {
+			return b.Lyrics.Find(ctx, track.Artist, track.Title, track.Duration)
+		})
+	} else {
+		l, err = b.findLyrics(ctx, "query:"+strings.ToLower(query), func(ctx context.Context) (*lyrics.Lyrics, error) {
+			return b.Lyrics.Search(ctx, query)
+		})
+	}
+	if err != nil {
+		logger.Warn("Lyrics lookup failed", "title", name, "err", err)
+		return i18n.Error("lyrics.failed")
+	}
+	if l == nil {
+		return i18n.Error("lyrics.not_found", "title", name)
+	}
+	if l.Instrumental {
+		b.respond(r, i, announcement, b.t(i, "lyrics.instrumental", "title", l.Title))
+		return nil
+	}
+	// Songs with only synced lyrics get them as plain text too; this entry has neither
+	if l.Plain == "" {
+		return i18n.Error("lyrics.not_found", "title", name)
+	}
+
+	locale := b.locale(i)
+	if track != nil && len(l.Synced) > 0 && !track.IsLive {
+		line := lyrics.LineAt(l.Synced, p.Position())
+		b.respondEmbed(r, i, announcement, liveLyricsEmbed(l, line, locale))
+		go b.followLyrics(r, p, track, l, line, locale)
+		return nil
+	}
+
+	pages := lyricsPages(l.Plain)
+	b.reply(r, i, &discordgo.InteractionResponseData{
+		Embeds:     []*discordgo.MessageEmbed{lyricsEmbed(l, pages, 0, locale)},
+		Components: lyricsButtons(l.ID, 0, len(pages)),
+	})
+	return nil
+}
+
+// followLyrics keeps a /lyrics response highlighting the line being sung while its track
+// plays, then turns it into the paged lyrics
+func (b *Bot) followLyrics(r responder, p *player.GuildPlayer, track *player.Track, l *lyrics.Lyrics, shown int, locale string) {
+	ticker := time.NewTicker(lyricsRefreshInterval)
+	defer ticker.Stop()
+	deadline := time.Now().Add(lyricsLiveFor)
+
+	for range ticker.C {
+		current := p.Queue.Current()
+		if current == nil || current.URL != track.URL || time.Now().After(deadline) {
+			break
+		}
+		line := lyrics.LineAt(l.Synced, p.Position())
+		if line == shown {
+			continue
+		}
+		shown = line
+		embeds := []*discordgo.MessageEmbed{liveLyricsEmbed(l, line, locale)}
+		if err := r.edit(&discordgo.WebhookEdit{Embeds: &embeds}); err != nil {
+			logger.Debug("Stopped following lyrics", "title", l.Title, "err", err)
+			return
+		}
+	}
+
+	pages := lyricsPages(l.Plain)
+	embeds := []*discordgo.MessageEmbed{lyricsEmbed(l, pages, 0, locale)}
+	components := lyricsButtons(l.ID, 0, len(pages))
+	if err := r.edit(&discordgo.WebhookEdit{Embeds: &embeds, Components: &components}); err != nil {
+		logger.Debug("Failed to show paged lyrics", "title", l.Title, "err", err)
+	}
+}
+
+// handleLyricsButton turns the page of a /lyrics response
+func (b *Bot) handleLyricsButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	idText, pageText, _ := strings.Cut(strings.TrimPrefix(i.MessageComponentData().CustomID, lyricsButtonPrefix), ":")
+	id, _ := strconv.Atoi(idText)
+	page, _ := strconv.Atoi(pageText)
+	locale := b.locale(i)
+
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: i18n.T(locale, "lyrics.expired"),
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	}
+	if l, ok := b.lyricsCache.get(lyricsIDKey(id)); ok && l != nil {
+		pages := lyricsPages(l.Plain)
+		page = max(0, min(page, len(pages)-1))
+		response = &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Embeds:     []*discordgo.MessageEmbed{lyricsEmbed(l, pages, page, locale)},
+				Components: lyricsButtons(l.ID, page, len(pages)),
+			},
+		}
+	}
+	if err := s.InteractionRespond(i.Interaction, response); err != nil {
+		logger.Warn("Failed to turn the lyrics page", "guild", i.GuildID, "err", err)
+	}
+}
+
+// lyricsEmbed shows one page of lyrics
+func lyricsEmbed(l *lyrics.Lyrics, pages []string, page int, locale string) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       lyricsTitle(l, locale),
+		Description: pages[page],
+		Color:       0x00ff00,
+	}
+	if len(pages) > 1 {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: i18n.T(locale, "lyrics.page", "page", page+1, "pages", len(pages))}
+	}
+	return embed
+}
+
+// liveLyricsEmbed shows the synced lyrics around a line, with that line highlighted
+func liveLyricsEmbed(l *lyrics.Lyrics, line int, locale string) *discordgo.MessageEmbed {
+	start := max(0, line-lyricsContext)
+	end := min(len(l.Synced), max(line, 0)+lyricsContext+1)
+
+	var sb strings.Builder
+	for idx := start; idx < end; idx++ {
+		text := l.Synced[idx].Text
+		if text == "" {
+			text = "♪"
+		}
+		if idx == line {
+			fmt.Fprintf(&sb, "**▶ %s**\n", text)
+		} else {
+			sb.WriteString(text + "\n")
+		}
+	}
+	return &discordgo.MessageEmbed{
+		Title:       lyricsTitle(l, locale),
+		Description: truncateRunes(sb.String(), lyricsPageLimit),
+		Color:       0x00ff00,
+		Footer:      &discordgo.MessageEmbedFooter{Text: i18n.T(locale, "lyrics.live")},
+	}
+}
+
+// lyricsTitle is the embed title of a song's lyrics
+func lyricsTitle(l *lyrics.Lyrics, locale string) string {
+	return truncateRunes(i18n.T(locale, "lyrics.title", "artist", l.Artist, "title", l.Title), 256)
+}
+
+// lyricsButtons are the buttons that turn the pages of lyrics, or none for a single page
+func lyricsButtons(id, page, pages int) []discordgo.MessageComponent {
+	return pageButtons(fmt.Sprintf("%s%d:", lyricsButtonPrefix, id), page, pages)
+}
+
+// pageButtons are the buttons that turn the pages of a response, or none for a single page;
+// their custom IDs are prefix followed by the page they turn to
+func pageButtons(prefix string, page, pages int) []discordgo.MessageComponent {
+	if pages <= 1 {
+		return []discordgo.MessageComponent{}
+	}
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "◀",
+				Style:    discordgo.SecondaryButton,
+				CustomID: prefix + strconv.Itoa(page-1),
+				Disabled: page == 0,
+			},
+			discordgo.Button{
+				Label:    "▶",
+				Style:    discordgo.SecondaryButton,
+				CustomID: prefix + strconv.Itoa(page+1),
+				Disabled: page >= pages-1,
+			},
+		}},
+	}
+}
+
+// lyricsPages splits lyrics into pages of at most lyricsPageLimit characters, breaking
+// between lines
+func lyricsPages(text string) []string {
+	var pages []string
+	var current strings.Builder
+	size := 0
+	for _, line := range strings.Split(text, "\n") {
+		line = truncateRunes(line, lyricsPageLimit)
+		length := utf8.RuneCountInString(line)
+		if size > 0 && size+1+length > lyricsPageLimit {
+			pages = append(pages, current.String())
+			current.Reset()
+			size = 0
+		}
+		if size > 0 {
+			current.WriteByte('\n')
+			size++
+		}
+		current.WriteString(line)
+		size += length
+	}
+	if size > 0 || len(pages) == 0 {
+		pages = append(pages, current.String())
+	}
+	return pages
+}
+
+// truncateRunes shortens s to at most limit characters, ending it with "…" if it was cut
+func truncateRunes(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/lyrics"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestLyricsPagesBreakBetweenLines(t *testing.T) {
+	line := strings.Repeat("ã", 1500)
+	pages := lyricsPages(strings.Join([]string{line, line, line, strings.Repeat("x", 5000)}, "\n"))
+
+	if len(pages) != 3 {
+		t.Fatalf("got %d pages, want 3", len(pages))
+	}
+	if pages[0] != line+"\n"+line {
+		t.Error("first page doesn't hold the first two lines")
+	}
+	for idx, page := range pages {
+		if n := utf8.RuneCountInString(page); n > lyricsPageLimit {
+			t.Errorf("page %d has %d characters, over the limit", idx, n)
+		}
+	}
+	if got := lyricsPages(""); len(got) != 1 {
+		t.Errorf("empty lyrics got %d pages, want 1", len(got))
+	}
+}
+
+func TestLyricsButtons(t *testing.T) {
+	if got := lyricsButtons(7, 0, 1); len(got) != 0 {
+		t.Errorf("single page got %d rows of buttons, want none", len(got))
+	}
+
+	row := lyricsButtons(7, 0, 3)[0].(discordgo.ActionsRow)
+	prev, next := row.Components[0].(discordgo.Button), row.Components[1].(discordgo.Button)
+	if !prev.Disabled || next.Disabled {
+		t.Errorf("first page: previous disabled = %v, next disabled = %v", prev.Disabled, next.Disabled)
+	}
+	if next.CustomID != lyricsButtonPrefix+"7:1" {
+		t.Errorf("next CustomID = %q", next.CustomID)
+	}
+}
+
+func TestLiveLyricsHighlightsTheCurrentLine(t *testing.T) {
+	l := &lyrics.Lyrics{Artist: "A", Title: "T"}
+	for idx := range 20 {
+		l.Synced = append(l.Synced, lyrics.Line{Text: "line " + strconv.Itoa(idx)})
+	}
+
+	embed := liveLyricsEmbed(l, 10, i18n.Default)
+	if !strings.Contains(embed.Description, "**▶ line 10**") {
+		t.Errorf("description %q doesn't highlight line 10", embed.Description)
+	}
+	if strings.Contains(embed.Description, "line 4\n") || !strings.Contains(embed.Description, "line 5\n") || !strings.Contains(embed.Description, "line 15") {
+		t.Errorf("description %q doesn't show %d lines around the current one", embed.Description, lyricsContext)
+	}
+
+	embed = liveLyricsEmbed(l, -1, i18n.Default)
+	if strings.Contains(embed.Description, "▶") || !strings.HasPrefix(embed.Description, "line 0\n") {
+		t.Errorf("before the first line: description %q", embed.Description)
+	}
+}
+
+func TestLyricsCacheForgetsTheOldest(t *testing.T) {
+	var c lyricsCache
+	for idx := range lyricsCacheSize + 1 {
+		c.put(strconv.Itoa(idx), nil)
+	}
+	if _, ok := c.get("0"); ok {
+		t.Error("the oldest entry was kept")
+	}
+	if _, ok := c.get(strconv.Itoa(lyricsCacheSize)); !ok {
+		t.Error("the newest entry was forgotten")
+	}
+}
+
+func TestLyricsInstrumentalOnlyWhenMarked(t *testing.T) {
+	tests := []struct {
+		name    string
+		record  string
+		wantErr string // Empty if a reply is sent
+		want    string
+	}{
+		{"synced only", `{"id":1,"trackName":"Hero","syncedLyrics":"[00:01.00] Hey"}`, "", "Hey"},
+		{"instrumental", `{"id":2,"trackName":"Hero","instrumental":true}`, "", "is instrumental"},
+		{"empty", `{"id":3,"trackName":"Hero"}`, "no lyrics found", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("[" + tt.record + "]"))
+			}))
+			defer server.Close()
+
+			s, transport := testSession(t)
+			b := &Bot{PlayerManager: player.NewManager(), Lyrics: lyrics.NewClient(server.URL, time.Second)}
+			i := testInteraction("lyrics")
+			i.Data = discordgo.ApplicationCommandInteractionData{Name: "lyrics", Options: []*discordgo.ApplicationCommandInteractionDataOption{
+				{Name: "query", Type: discordgo.ApplicationCommandOptionString, Value: "hero"},
+			}}
+
+			err := b.handleLyrics(context.Background(), newInteractionResponder(s, i), i)
+			if tt.wantErr != "" {
+				message, ok := err.(*i18n.Message)
+				if !ok || !strings.Contains(message.In(i18n.Default), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if last := transport.requests[len(transport.requests)-1]; !strings.Contains(last, tt.want) {
+				t.Errorf("reply = %q, want %q", last, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/GrainedLotus515/gobard/internal/spotify"
+	"github.com/GrainedLotus515/gobard/internal/youtube"
+)
+
+const (
+	// matchStoreFile is where Spotify matches are kept, relative to the cache directory
+	// It lives in a subdirectory so the audio cache doesn't treat it as a cached track
+	matchStoreFile = "spotify/matches.json"
+	// matchMaxAge is how long a Spotify match is reused before searching YouTube again
+	matchMaxAge = 30 * 24 * time.Hour
+)
+
+// spotifyMatcher finds YouTube videos for Spotify tracks, reusing earlier matches
+// Apple Music and Deezer tracks are matched the same way
+type spotifyMatcher struct {
+	youtube *youtube.Client
+	store   *spotify.MatchStore // nil if the store couldn't be opened
+}
+
+// newSpotifyMatcher creates a matcher whose matches are stored in the cache directory
+// Matching still works without the store if it can't be opened
+func newSpotifyMatcher(client *youtube.Client, cacheDir string) *spotifyMatcher {
+	store, err := spotify.NewMatchStore(filepath.Join(cacheDir, matchStoreFile), matchMaxAge)
+	if err != nil {
+		logger.Warn("Spotify matches won't be remembered", "err", err)
+		store = nil
+	}
+	return &spotifyMatcher{youtube: client, store: store}
+}
+
+// match returns a copy of a Spotify track pointing at its YouTube match
+// A stored match is reused unless it was a weak one; new matches are stored
+func (m *spotifyMatcher) match(ctx context.Context, track *player.Track) (*player.Track, error) {
+	key := matchKey(track)
+	if m.store != nil && key != "" {
+		if stored, ok := m.store.Get(key); ok && stored.Score >= youtube.ConfidentMatchScore {
+			resolved, err := m.youtube.ResolveMatch(ctx, track, stored.VideoID)
+			if err == nil {
+				return resolved, nil
+			}
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return nil, err
+			}
+			// The video may have been taken down; search again
+			logger.Debug("Stored Spotify match failed, searching again", "title", track.Title, "video", stored.VideoID, "err", err)
+		}
+	}
+
+	matched, score, err := m.youtube.FindMatch(ctx, track)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.store != nil && key != "" {
+		match := spotify.Match{VideoID: matched.ID, Title: matched.Title, Score: score}
+		m.store.Put(key, match)
+	}
+	return matched, nil
+}
+
+// matchLoosely is match falling back to the best result however low it scores, reporting
+// whether it did; such matches aren't stored
+func (m *spotifyMatcher) matchLoosely(ctx context.Context, track *player.Track) (*player.Track, bool, error) {
+	matched, err := m.match(ctx, track)
+	if !errors.Is(err, youtube.ErrNoCloseMatch) {
+		return matched, false, err
+	}
+	matched, _, err = m.youtube.FindLooseMatch(ctx, track)
+	return matched, err == nil, err
+}
+
+// matchKey returns the key a track's match is stored under, or "" if it has no ID
+// Spotify IDs are used as they are; other services' IDs are prefixed with the service, as
+// their numeric IDs could collide
+func matchKey(track *player.Track) string {
+	if track.ID == "" || track.Source == player.SourceSpotify {
+		return track.ID
+	}
+	return string(track.Source) + ":" + track.ID
+}
+
+// flush saves matches that haven't been written yet
+func (m *spotifyMatcher) flush() {
+	if m.store == nil {
+		return
+	}
+	if err := m.store.Flush(); err != nil {
+		logger.Warn("Failed to save Spotify matches", "err", err)
+	}
+}
+
+// clear forgets every stored match and returns how many there were
+func (m *spotifyMatcher) clear() (int, error) {
+	if m.store == nil {
+		return 0, nil
+	}
+	return m.store.Clear()
+}
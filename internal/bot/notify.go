@@ -0,0 +1,231 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// notifyStoreFile is where users' /notify choices are kept, relative to the cache directory
+	notifyStoreFile = "users/notify.json"
+	// notifyInterval is the least time between two now-playing DMs to the same user
+	notifyInterval = time.Minute
+	// notifyMaxFailures is how many DMs in a row can fail before a user's notifications are
+	// turned off, usually because they closed their DMs
+	notifyMaxFailures = 3
+)
+
+// notifier rate-limits now-playing DMs and counts the ones that failed, by user ID
+type notifier struct {
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+	failures map[string]int
+}
+
+// allow reports whether a user can be sent a DM now, and if so counts it as sent
+func (n *notifier) allow(userID string, now time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if last, ok := n.lastSent[userID]; ok && now.Sub(last) < notifyInterval {
+		return false
+	}
+	if n.lastSent == nil {
+		n.lastSent = make(map[string]time.Time)
+	}
+	n.lastSent[userID] = now
+	return true
+}
+
+// failed records a DM that couldn't be sent and reports whether the user has reached
+// notifyMaxFailures
+func (n *notifier) failed(userID string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.failures == nil {
+		n.failures = make(map[string]int)
+	}
+	n.failures[userID]++
+	if n.failures[userID] < notifyMaxFailures {
+		return false
+	}
+	delete(n.failures, userID)
+	return true
+}
+
+// succeeded clears a user's failed DMs
+func (n *notifier) succeeded(userID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.failures, userID)
+}
+
+// notifyRequester DMs the user who queued a track that it started, if they turned
+// notifications on with /notify; it is called once per track, not for looped repeats
+func (b *Bot) notifyRequester(guildID, channelID string, track *player.Track) {
+	if b.notifications == nil || track.RequestedBy == "" {
+		return
+	}
+	if on, _ := b.notifications.Get(track.RequestedBy); !on {
+		return
+	}
+	if !b.notifier.allow(track.RequestedBy, time.Now()) {
+		return
+	}
+
+	err := b.sendNowPlayingDM(guildID, channelID, track)
+	if err == nil {
+		b.notifier.succeeded(track.RequestedBy)
+		return
+	}
+	if !isDMClosed(err) {
+		logger.Warn("Failed to send now-playing DM", "user", track.RequestedBy, "err", err)
+		return
+	}
+	if b.notifier.failed(track.RequestedBy) {
+		logger.Info("Turning off now-playing DMs for a user they can't be sent to", "user", track.RequestedBy)
+		if err := b.notifications.Clear(track.RequestedBy); err != nil {
+			logger.Warn("Failed to turn off now-playing DMs", "user", track.RequestedBy, "err", err)
+		}
+	}
+}
+
+// sendNowPlayingDM sends the now-playing embed for a track to its requester
+func (b *Bot) sendNowPlayingDM(guildID, channelID string, track *player.Track) error {
+	locale := b.guildLocale(guildID)
+	embed := &discordgo.MessageEmbed{
+		Title:       i18n.T(locale, "notify.title", "guild", b.guildName(guildID)),
+		Description: i18n.T(locale, "track.by", "title", track.Title, "artist", track.Artist),
+		URL:         track.URL,
+		Color:       0x00ff00,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:  i18n.T(locale, "notify.channel"),
+				Value: fmt.Sprintf("https://discord.com/channels/%s/%s", guildID, channelID),
+			},
+		},
+	}
+	if track.Thumbnail != "" {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: track.Thumbnail}
+	}
+	return b.sendDMEmbed(track.RequestedBy, embed)
+}
+
+// handleNotify handles the notify command
+func (b *Bot) handleNotify(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	if b.notifications == nil {
+		return i18n.Error("notify.unavailable")
+	}
+	mode, ok := getStringOption(i.ApplicationCommandData().Options, "mode")
+	if !ok {
+		return missingOption("mode")
+	}
+
+	userID := i.Member.User.ID
+	switch mode {
+	case "on":
+		if err := b.notifications.Set(userID, true); err != nil {
+			return err
+		}
+		b.notifier.succeeded(userID)
+		b.respondEphemeral(r, i, b.t(i, "notify.on"))
+	case "off":
+		if err := b.notifications.Clear(userID); err != nil {
+			return err
+		}
+		b.respondEphemeral(r, i, b.t(i, "notify.off"))
+	default:
+		return i18n.Error("notify.invalid")
+	}
+	return nil
+}
+
+// isDMClosed reports whether Discord refused a DM because the user doesn't accept them
+func isDMClosed(err error) bool {
+	var restErr *discordgo.RESTError
+	return errors.As(err, &restErr) && restErr.Message != nil && restErr.Message.Code == discordgo.ErrCodeCannotSendMessagesToThisUser
+}
+
+// handleGrab handles the grab command, which DMs the invoker the current track with the
+// point they grabbed it at; if their DMs are closed it is shown to them in the channel instead
+func (b *Bot) handleGrab(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	p := b.PlayerManager.GetPlayer(i.GuildID)
+	track := p.Queue.Current()
+	if track == nil {
+		return i18n.Error("nowplaying.nothing")
+	}
+
+	locale := b.locale(i)
+	embed := grabEmbed(locale, b.guildName(i.GuildID), track, p.Position())
+
+	userID := i.Member.User.ID
+	err := b.sendDMEmbed(userID, embed)
+	if err == nil {
+		b.respondEphemeral(r, i, b.t(i, "grab.sent"))
+		return nil
+	}
+	if !isDMClosed(err) {
+		logger.Warn("Failed to send grab DM", "user", userID, "err", err)
+	}
+	embed.Footer = &discordgo.MessageEmbedFooter{Text: i18n.T(locale, "grab.dm_closed")}
+	b.respondEphemeralEmbed(r, i, embed)
+	return nil
+}
+
+// grabEmbed describes a grabbed track: what it is, where it was in it and who queued it
+func grabEmbed(locale, guildName string, track *player.Track, position time.Duration) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       track.Title,
+		Description: i18n.T(locale, "grab.from", "artist", track.Artist, "guild", guildName),
+		URL:         track.URL,
+		Color:       0x00ff00,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   i18n.T(locale, "grab.at"),
+				Value:  formatDuration(position),
+				Inline: true,
+			},
+		},
+	}
+	if !track.IsLive && track.Duration > 0 {
+		embed.Fields[0].Value = fmt.Sprintf("%s / %s", formatDuration(position), formatDuration(track.Duration))
+	}
+	if track.RequestedBy != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   i18n.T(locale, "grab.requested_by"),
+			Value:  "<@" + track.RequestedBy + ">",
+			Inline: true,
+		})
+	}
+	if track.Thumbnail != "" {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: track.Thumbnail}
+	}
+	return embed
+}
+
+// sendDMEmbed sends an embed to a user's DMs
+func (b *Bot) sendDMEmbed(userID string, embed *discordgo.MessageEmbed) error {
+	dm, err := b.Session.UserChannelCreate(userID)
+	if err != nil {
+		return fmt.Errorf("failed to open DM channel: %w", err)
+	}
+	_, err = b.Session.ChannelMessageSendEmbed(dm.ID, embed)
+	return err
+}
+
+// guildName returns a guild's name, or its ID if it isn't in the state cache
+func (b *Bot) guildName(guildID string) string {
+	if guild, err := b.Session.State.Guild(guildID); err == nil {
+		return guild.Name
+	}
+	return guildID
+}
@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/player"
+)
+
+func TestNotifierRateLimitsPerUser(t *testing.T) {
+	var n notifier
+	start := time.Now()
+
+	if !n.allow("1", start) {
+		t.Fatal("first DM wasn't allowed")
+	}
+	if n.allow("1", start.Add(30*time.Second)) {
+		t.Error("second DM within a minute was allowed")
+	}
+	if !n.allow("2", start.Add(30*time.Second)) {
+		t.Error("another user's DM was held back")
+	}
+	if !n.allow("1", start.Add(notifyInterval)) {
+		t.Error("DM a minute later wasn't allowed")
+	}
+}
+
+func TestNotifierGivesUpAfterRepeatedFailures(t *testing.T) {
+	var n notifier
+	for attempt := 1; attempt < notifyMaxFailures; attempt++ {
+		if n.failed("1") {
+			t.Fatalf("gave up after %d failures, want %d", attempt, notifyMaxFailures)
+		}
+	}
+	n.succeeded("1")
+	for attempt := 1; attempt < notifyMaxFailures; attempt++ {
+		if n.failed("1") {
+			t.Fatal("a successful DM didn't reset the failures")
+		}
+	}
+	if !n.failed("1") {
+		t.Errorf("didn't give up after %d failures", notifyMaxFailures)
+	}
+}
+
+func TestGrabEmbed(t *testing.T) {
+	track := &player.Track{Title: "Song", Artist: "Band", URL: "https://example.com/song", Duration: 3 * time.Minute, RequestedBy: "42", Thumbnail: "https://example.com/thumb.jpg"}
+	embed := grabEmbed("en-US", "Guild", track, 75*time.Second)
+	if embed.Title != "Song" || embed.URL != track.URL || embed.Thumbnail == nil {
+		t.Errorf("grabEmbed = %+v, missing the track", embed)
+	}
+	if len(embed.Fields) != 2 || embed.Fields[0].Value != "01:15 / 03:00" || embed.Fields[1].Value != "<@42>" {
+		t.Errorf("grabEmbed fields = %+v, want the position and requester", embed.Fields)
+	}
+
+	live := &player.Track{Title: "Stream", IsLive: true}
+	embed = grabEmbed("en-US", "Guild", live, time.Minute)
+	if len(embed.Fields) != 1 || embed.Fields[0].Value != "01:00" || embed.Thumbnail != nil {
+		t.Errorf("grabEmbed for a livestream = %+v", embed.Fields)
+	}
+}
@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/bwmarrin/discordgo"
+)
+
+// Discord validates options against the registered commands, but a stale registration or a
+// hand-crafted request can still leave one out or send it with another type, and the
+// discordgo value getters panic on the wrong type, so handlers read options through these
+
+// getStringOption returns the named string option and whether it was given
+func getStringOption(options []*discordgo.ApplicationCommandInteractionDataOption, name string) (string, bool) {
+	option := findOption(options, name, discordgo.ApplicationCommandOptionString)
+	if option == nil {
+		return "", false
+	}
+	return option.StringValue(), true
+}
+
+// getIntOption returns the named integer option and whether it was given
+func getIntOption(options []*discordgo.ApplicationCommandInteractionDataOption, name string) (int, bool) {
+	option := findOption(options, name, discordgo.ApplicationCommandOptionInteger)
+	if option == nil {
+		return 0, false
+	}
+	return int(option.IntValue()), true
+}
+
+// getBoolOption returns the named boolean option and whether it was given
+func getBoolOption(options []*discordgo.ApplicationCommandInteractionDataOption, name string) (bool, bool) {
+	option := findOption(options, name, discordgo.ApplicationCommandOptionBoolean)
+	if option == nil {
+		return false, false
+	}
+	return option.BoolValue(), true
+}
+
+// getChannelOption returns the ID of the named channel option and whether it was given
+func getChannelOption(options []*discordgo.ApplicationCommandInteractionDataOption, name string) (string, bool) {
+	option := findOption(options, name, discordgo.ApplicationCommandOptionChannel)
+	if option == nil {
+		return "", false
+	}
+	id, ok := option.Value.(string)
+	return id, ok
+}
+
+// getAttachmentOption returns the file of the named attachment option and whether it was given
+func getAttachmentOption(data discordgo.ApplicationCommandInteractionData, options []*discordgo.ApplicationCommandInteractionDataOption, name string) (*discordgo.MessageAttachment, bool) {
+	option := findOption(options, name, discordgo.ApplicationCommandOptionAttachment)
+	if option == nil || data.Resolved == nil {
+		return nil, false
+	}
+	id, _ := option.Value.(string)
+	attachment, ok := data.Resolved.Attachments[id]
+	return attachment, ok && attachment != nil
+}
+
+// findOption returns the option with a name and type, or nil
+func findOption(options []*discordgo.ApplicationCommandInteractionDataOption, name string, optionType discordgo.ApplicationCommandOptionType) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, option := range options {
+		if option != nil && option.Name == name && option.Type == optionType {
+			return option
+		}
+	}
+	return nil
+}
+
+// subcommand returns the subcommand or subcommand group a command was invoked with
+func subcommand(options []*discordgo.ApplicationCommandInteractionDataOption) (*discordgo.ApplicationCommandInteractionDataOption, error) {
+	if len(options) == 0 || options[0] == nil ||
+		(options[0].Type != discordgo.ApplicationCommandOptionSubCommand && options[0].Type != discordgo.ApplicationCommandOptionSubCommandGroup) {
+		return nil, i18n.Error("error.no_subcommand")
+	}
+	return options[0], nil
+}
+
+// missingOption is the error for a required option that wasn't given
+func missingOption(name string) error {
+	return i18n.Error("error.missing_option", "option", name)
+}
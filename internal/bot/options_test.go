@@ -0,0 +1,129 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/GrainedLotus515/gobard/internal/config"
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestInteractionCreateRejectsDMs(t *testing.T) {
+	s, err := discordgo.New("Bot token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := &recordingTransport{}
+	s.Client = &http.Client{Transport: transport}
+
+	dm := testInteraction("play")
+	dm.GuildID = ""
+	dm.User = &discordgo.User{ID: "3"}
+
+	b := &Bot{}
+	b.interactionCreate(s, dm)
+
+	if len(transport.requests) != 1 || !strings.Contains(transport.requests[0], "only works in servers") {
+		t.Errorf("responses = %q, want the servers-only message", transport.requests)
+	}
+	if got := b.commands.run.Load(); got != 0 {
+		t.Errorf("run = %d, want the command not to run", got)
+	}
+}
+
+func TestInteractionCreateRefusesDisallowedServers(t *testing.T) {
+	s, err := discordgo.New("Bot token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := &recordingTransport{}
+	s.Client = &http.Client{Transport: transport}
+
+	i := testInteraction("play")
+	i.Member = &discordgo.Member{User: &discordgo.User{ID: "3"}}
+
+	b := &Bot{Config: &config.Config{BlockedGuildIDs: []string{i.GuildID}}}
+	b.interactionCreate(s, i)
+
+	if len(transport.requests) != 1 || !strings.Contains(transport.requests[0], "isn't available in this server") || !strings.Contains(transport.requests[0], `"flags":64`) {
+		t.Errorf("responses = %q, want an ephemeral refusal", transport.requests)
+	}
+	if got := b.commands.run.Load(); got != 0 {
+		t.Errorf("run = %d, want the command not to run", got)
+	}
+}
+
+func TestHandlersReportMissingOptions(t *testing.T) {
+	b := &Bot{}
+	tests := []struct {
+		name    string
+		handle  commandHandler
+		options []*discordgo.ApplicationCommandInteractionDataOption
+		want    string
+	}{
+		{"volume", b.handleVolume, nil, "level"},
+		{"volume", b.handleVolume, []*discordgo.ApplicationCommandInteractionDataOption{
+			{Name: "level", Type: discordgo.ApplicationCommandOptionString, Value: "loud"},
+		}, "level"},
+		{"move", b.handleMove, []*discordgo.ApplicationCommandInteractionDataOption{
+			{Name: "from", Type: discordgo.ApplicationCommandOptionInteger, Value: float64(2)},
+		}, "to"},
+		{"search", b.handleSearch, nil, "query"},
+		{"config", b.handleConfig, nil, "subcommand"},
+		{"cache", b.handleCache, nil, "subcommand"},
+	}
+	for _, tt := range tests {
+		i := testInteraction(tt.name)
+		i.Member = &discordgo.Member{User: &discordgo.User{ID: "3"}, Permissions: discordgo.PermissionAdministrator}
+		i.Data = discordgo.ApplicationCommandInteractionData{Name: tt.name, Options: tt.options}
+
+		err := tt.handle(context.Background(), nil, i)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("/%s with %d options: error = %v, want one naming %q", tt.name, len(tt.options), err, tt.want)
+		}
+	}
+}
+
+func TestGetOptionChecksType(t *testing.T) {
+	options := []*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "level", Type: discordgo.ApplicationCommandOptionInteger, Value: float64(40)},
+		{Name: "enabled", Type: discordgo.ApplicationCommandOptionBoolean, Value: true},
+	}
+	if level, ok := getIntOption(options, "level"); !ok || level != 40 {
+		t.Errorf("getIntOption = %d, %v", level, ok)
+	}
+	if _, ok := getStringOption(options, "level"); ok {
+		t.Error("getStringOption read an integer option")
+	}
+	if enabled, ok := getBoolOption(options, "enabled"); !ok || !enabled {
+		t.Errorf("getBoolOption = %v, %v", enabled, ok)
+	}
+	if _, ok := getIntOption(options, "missing"); ok {
+		t.Error("getIntOption found a missing option")
+	}
+}
+
+func TestGetAttachmentOption(t *testing.T) {
+	file := &discordgo.MessageAttachment{ID: "9", Filename: "airhorn.ogg"}
+	data := discordgo.ApplicationCommandInteractionData{
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{
+			{Name: "file", Type: discordgo.ApplicationCommandOptionAttachment, Value: "9"},
+			{Name: "other", Type: discordgo.ApplicationCommandOptionAttachment, Value: "10"},
+		},
+		Resolved: &discordgo.ApplicationCommandInteractionDataResolved{
+			Attachments: map[string]*discordgo.MessageAttachment{"9": file},
+		},
+	}
+	if got, ok := getAttachmentOption(data, data.Options, "file"); !ok || got != file {
+		t.Errorf("getAttachmentOption = %v, %v; want the resolved file", got, ok)
+	}
+	if _, ok := getAttachmentOption(data, data.Options, "other"); ok {
+		t.Error("getAttachmentOption found a file that wasn't resolved")
+	}
+	data.Resolved = nil
+	if _, ok := getAttachmentOption(data, data.Options, "file"); ok {
+		t.Error("getAttachmentOption found a file without resolved data")
+	}
+}
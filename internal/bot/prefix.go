@@ -0,0 +1,101 @@
+package bot
+
+import (
+	"strings"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/bwmarrin/discordgo"
+)
+
+// messageInteractionPrefix starts the IDs of interactions built from prefix commands
+const messageInteractionPrefix = "message:"
+
+// prefixCommand is a slash command that can also be typed with COMMAND_PREFIX
+type prefixCommand struct {
+	name       string // The slash command it runs
+	subcommand string // The subcommand it runs, if the slash command has them
+	query      bool   // Whether the text after the command is passed as the query option
+}
+
+// prefixCommands maps the commands that can be typed with COMMAND_PREFIX to the slash
+// commands they run
+var prefixCommands = map[string]prefixCommand{
+	"play":        {name: "play", query: true},
+	"p":           {name: "play", query: true},
+	"skip":        {name: "skip"},
+	"stop":        {name: "stop"},
+	"pause":       {name: "pause"},
+	"resume":      {name: "resume"},
+	"queue":       {name: "queue", subcommand: "show"},
+	"q":           {name: "queue", subcommand: "show"},
+	"np":          {name: "now-playing"},
+	"now-playing": {name: "now-playing"},
+	"lyrics":      {name: "lyrics", query: true},
+}
+
+// messageCreate runs prefix commands, like "!play song", for clients where slash commands
+// don't work well
+// Messages that don't start with a known command are ignored, as other bots may share the prefix
+func (b *Bot) messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
+	prefix := b.config().CommandPrefix
+	if prefix == "" || m.Author == nil || m.Author.Bot || m.GuildID == "" {
+		return
+	}
+	i := prefixInteraction(m.Message, prefix)
+	if i == nil || !b.config().GuildAllowed(m.GuildID) {
+		return
+	}
+	if perms, err := s.State.UserChannelPermissions(m.Author.ID, m.ChannelID); err == nil {
+		i.Member.Permissions = perms
+	}
+
+	name := i.ApplicationCommandData().Name
+	logger.Debug("Prefix command", "cmd", name, "user", m.Author.ID, "guild", m.GuildID)
+	b.runCommand(newMessageResponder(s, m.Message), i, name, b.commandHandler(name))
+}
+
+// prefixInteraction turns a prefix command message into the interaction its slash command
+// would receive, or returns nil if the message isn't a prefix command
+// Handlers only read the command from it; their replies go through a messageResponder
+func prefixInteraction(m *discordgo.Message, prefix string) *discordgo.InteractionCreate {
+	content, ok := strings.CutPrefix(strings.TrimSpace(m.Content), prefix)
+	if !ok {
+		return nil
+	}
+	word, args, _ := strings.Cut(content, " ")
+	command, ok := prefixCommands[strings.ToLower(word)]
+	if !ok {
+		return nil
+	}
+
+	var options []*discordgo.ApplicationCommandInteractionDataOption
+	if args = strings.TrimSpace(args); command.query && args != "" {
+		options = append(options, &discordgo.ApplicationCommandInteractionDataOption{
+			Name:  "query",
+			Type:  discordgo.ApplicationCommandOptionString,
+			Value: args,
+		})
+	}
+
+	if command.subcommand != "" {
+		options = []*discordgo.ApplicationCommandInteractionDataOption{{
+			Name:    command.subcommand,
+			Type:    discordgo.ApplicationCommandOptionSubCommand,
+			Options: options,
+		}}
+	}
+
+	member := &discordgo.Member{User: m.Author}
+	if m.Member != nil {
+		member.Roles = m.Member.Roles
+		member.Nick = m.Member.Nick
+	}
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:        messageInteractionPrefix + m.ID,
+		Type:      discordgo.InteractionApplicationCommand,
+		GuildID:   m.GuildID,
+		ChannelID: m.ChannelID,
+		Member:    member,
+		Data:      discordgo.ApplicationCommandInteractionData{Name: command.name, Options: options},
+	}}
+}
@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestPrefixInteraction(t *testing.T) {
+	author := &discordgo.User{ID: "2"}
+	tests := []struct {
+		content   string
+		wantName  string
+		wantQuery string
+	}{
+		{"!play never gonna give you up", "play", "never gonna give you up"},
+		{"  !P   lofi  ", "play", "lofi"},
+		{"!np", "now-playing", ""},
+		{"!skip extra words", "skip", ""},
+		{"!play", "play", ""},
+		{"!dance", "", ""},
+		{"play song", "", ""},
+		{"?play song", "", ""},
+	}
+	for _, tt := range tests {
+		m := &discordgo.Message{ID: "10", ChannelID: "20", GuildID: "30", Content: tt.content, Author: author}
+		i := prefixInteraction(m, "!")
+		if tt.wantName == "" {
+			if i != nil {
+				t.Errorf("%q: got /%s, want no command", tt.content, i.ApplicationCommandData().Name)
+			}
+			continue
+		}
+		if i == nil {
+			t.Errorf("%q: got no command, want /%s", tt.content, tt.wantName)
+			continue
+		}
+		data := i.ApplicationCommandData()
+		if data.Name != tt.wantName {
+			t.Errorf("%q: name = %q, want %q", tt.content, data.Name, tt.wantName)
+		}
+		query, _ := getStringOption(data.Options, "query")
+		if query != tt.wantQuery {
+			t.Errorf("%q: query = %q, want %q", tt.content, query, tt.wantQuery)
+		}
+		if i.ID != "message:10" || i.GuildID != "30" || i.ChannelID != "20" || i.Member.User != author {
+			t.Errorf("%q: interaction = %+v, want it to carry the message's IDs and author", tt.content, i.Interaction)
+		}
+	}
+}
+
+func TestPrefixInteractionSubcommand(t *testing.T) {
+	m := &discordgo.Message{ID: "10", GuildID: "30", Content: "!q", Author: &discordgo.User{ID: "2"}}
+	i := prefixInteraction(m, "!")
+	if i == nil {
+		t.Fatal("got no command, want /queue show")
+	}
+	if sub, err := subcommand(i.ApplicationCommandData().Options); err != nil || sub.Name != "show" {
+		t.Errorf("subcommand = %v, %v; want show", sub, err)
+	}
+}
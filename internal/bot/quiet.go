@@ -0,0 +1,277 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // Quiet hours need IANA timezones even where the system has none
+
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// quietHoursStoreFile is where servers' quiet hours are kept, relative to the cache directory
+	quietHoursStoreFile = "guilds/quiet_hours.json"
+	// quietHoursInterval is how often servers are checked for quiet hours starting or ending
+	quietHoursInterval = 30 * time.Second
+	// quietFadeSteps and quietFadeDuration control the fade out before pausing for quiet hours
+	quietFadeSteps    = 10
+	quietFadeDuration = 3 * time.Second
+)
+
+// quietHours is a daily window, in a timezone, during which music doesn't play
+type quietHours struct {
+	Start    string `json:"start"` // "21:00"
+	End      string `json:"end"`
+	Timezone string `json:"timezone"` // IANA name like "Europe/Berlin"
+}
+
+// parseClock parses a time of day like "21:00" or "7:30" into hours and minutes
+func parseClock(s string) (int, int, error) {
+	hourText, minuteText, ok := strings.Cut(strings.TrimSpace(s), ":")
+	hour, hourErr := strconv.Atoi(hourText)
+	minute, minuteErr := strconv.Atoi(minuteText)
+	if !ok || hourErr != nil || minuteErr != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 || len(minuteText) != 2 {
+		return 0, 0, fmt.Errorf("invalid time of day: %q", s)
+	}
+	return hour, minute, nil
+}
+
+// newQuietHours checks and normalizes a quiet hours window
+func newQuietHours(start, end, timezone string) (quietHours, error) {
+	startHour, startMinute, err := parseClock(start)
+	if err != nil {
+		return quietHours{}, i18n.Error("config.quiet_hours_invalid_time")
+	}
+	endHour, endMinute, err := parseClock(end)
+	if err != nil {
+		return quietHours{}, i18n.Error("config.quiet_hours_invalid_time")
+	}
+	if startHour == endHour && startMinute == endMinute {
+		return quietHours{}, i18n.Error("config.quiet_hours_empty")
+	}
+	loc, err := time.LoadLocation(strings.TrimSpace(timezone))
+	if err != nil || loc == time.Local {
+		return quietHours{}, i18n.Error("config.quiet_hours_invalid_timezone", "timezone", timezone)
+	}
+	return quietHours{
+		Start:    fmt.Sprintf("%02d:%02d", startHour, startMinute),
+		End:      fmt.Sprintf("%02d:%02d", endHour, endMinute),
+		Timezone: loc.String(),
+	}, nil
+}
+
+// active reports whether now is within the window and, if so, when the window ends
+// Windows may cross midnight; times are taken on the local calendar, so they follow DST
+func (q quietHours) active(now time.Time) (bool, time.Time) {
+	loc, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		return false, time.Time{}
+	}
+	startHour, startMinute, err := parseClock(q.Start)
+	if err != nil {
+		return false, time.Time{}
+	}
+	endHour, endMinute, err := parseClock(q.End)
+	if err != nil {
+		return false, time.Time{}
+	}
+
+	local := now.In(loc)
+	year, month, day := local.Date()
+	start := time.Date(year, month, day, startHour, startMinute, 0, 0, loc)
+	end := time.Date(year, month, day, endHour, endMinute, 0, 0, loc)
+
+	if start.Before(end) {
+		return !local.Before(start) && local.Before(end), end
+	}
+	// The window crosses midnight: it began yesterday and ends today, or begins today
+	if local.Before(end) {
+		return true, end
+	}
+	if !local.Before(start) {
+		return true, time.Date(year, month, day+1, endHour, endMinute, 0, 0, loc)
+	}
+	return false, time.Time{}
+}
+
+// quietHoursUntil returns when a guild's quiet hours end, formatted in their timezone, if
+// they are on now
+func (b *Bot) quietHoursUntil(guildID string) (string, bool) {
+	if b.quietHours == nil {
+		return "", false
+	}
+	q, ok := b.quietHours.Get(guildID)
+	if !ok {
+		return "", false
+	}
+	active, until := q.active(time.Now())
+	if !active {
+		return "", false
+	}
+	return until.Format("15:04"), true
+}
+
+// quietHoursText describes a guild's quiet hours for /config show
+func (b *Bot) quietHoursText(guildID, locale string) string {
+	if b.quietHours != nil {
+		if q, ok := b.quietHours.Get(guildID); ok {
+			return i18n.T(locale, "config.quiet_hours_value", "start", q.Start, "end", q.End, "timezone", q.Timezone)
+		}
+	}
+	return i18n.T(locale, "config.quiet_hours_none")
+}
+
+// quietWatch remembers, by guild ID, whose quiet hours were on at the last check and which
+// players it paused
+type quietWatch struct {
+	mu     sync.Mutex
+	active map[string]bool
+	paused map[string]bool
+}
+
+// forget drops what is known about a guild's quiet hours, after they were changed or cleared
+func (w *quietWatch) forget(guildID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.active, guildID)
+	delete(w.paused, guildID)
+}
+
+// watchQuietHours pauses playback when servers' quiet hours begin and resumes it when they
+// end, until the returned function is called
+func (b *Bot) watchQuietHours() func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(quietHoursInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				b.checkQuietHours(time.Now())
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// checkQuietHours acts on every server whose quiet hours began or ended since the last check
+func (b *Bot) checkQuietHours(now time.Time) {
+	if b.quietHours == nil {
+		return
+	}
+	for guildID, q := range b.quietHours.All() {
+		active, until := q.active(now)
+
+		b.quiet.mu.Lock()
+		if b.quiet.active == nil {
+			b.quiet.active = make(map[string]bool)
+			b.quiet.paused = make(map[string]bool)
+		}
+		began := active && !b.quiet.active[guildID]
+		ended := !active && b.quiet.active[guildID]
+		resume := ended && b.quiet.paused[guildID]
+		b.quiet.active[guildID] = active
+		if ended {
+			delete(b.quiet.paused, guildID)
+		}
+		b.quiet.mu.Unlock()
+
+		switch {
+		case began:
+			if b.pauseForQuietHours(guildID, until.Format("15:04")) {
+				b.quiet.mu.Lock()
+				b.quiet.paused[guildID] = true
+				b.quiet.mu.Unlock()
+			}
+		case resume:
+			b.resumeAfterQuietHours(guildID)
+		}
+	}
+}
+
+// pauseForQuietHours fades out and pauses a guild's playback, reporting whether anything was playing
+func (b *Bot) pauseForQuietHours(guildID, until string) bool {
+	p := b.PlayerManager.GetPlayer(guildID)
+	if !p.IsPlaying() {
+		return false
+	}
+
+	volume := p.GetVolume()
+	for step := quietFadeSteps - 1; step >= 0; step-- {
+		p.SetVolume(volume * step / quietFadeSteps)
+		time.Sleep(quietFadeDuration / quietFadeSteps)
+	}
+	p.Pause()
+	p.SetVolume(volume)
+
+	logger.Info("Paused for quiet hours", "guild", guildID, "until", until)
+	b.postPlaybackNotice(p, i18n.T(b.guildLocale(guildID), "quiet_hours.started", "until", until))
+	return true
+}
+
+// resumeAfterQuietHours resumes playback paused for quiet hours, if anyone is still listening
+func (b *Bot) resumeAfterQuietHours(guildID string) {
+	p := b.PlayerManager.GetPlayer(guildID)
+	if !p.IsVoiceConnected() || p.Queue.Current() == nil || !b.hasListeners(guildID, p.GetVoiceChannelID()) {
+		logger.Info("Quiet hours ended with nobody listening, staying paused", "guild", guildID)
+		return
+	}
+
+	p.Resume()
+	logger.Info("Resumed after quiet hours", "guild", guildID)
+	b.postPlaybackNotice(p, i18n.T(b.guildLocale(guildID), "quiet_hours.ended"))
+}
+
+// hasListeners reports whether anyone other than bots is in a voice channel
+func (b *Bot) hasListeners(guildID, channelID string) bool {
+	guild, err := b.Session.State.Guild(guildID)
+	if err != nil {
+		return false
+	}
+	b.Session.State.RLock()
+	defer b.Session.State.RUnlock()
+	for _, vs := range guild.VoiceStates {
+		if vs.ChannelID != channelID || vs.UserID == b.Session.State.User.ID {
+			continue
+		}
+		if vs.Member != nil && vs.Member.User != nil && vs.Member.User.Bot {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// postPlaybackNotice posts a message in the channel a guild's playback was started from
+func (b *Bot) postPlaybackNotice(p *player.GuildPlayer, content string) {
+	channelID := p.GetTextChannelID()
+	if channelID == "" {
+		return
+	}
+	if _, err := b.Session.ChannelMessageSend(channelID, content); err != nil {
+		logger.Warn("Failed to post playback notice", "guild", p.GuildID, "err", err)
+	}
+}
+
+// quietHoursRefusal returns the error /play gives during quiet hours, or nil if it may play
+// DJs and admins may play anyway with force
+func (b *Bot) quietHoursRefusal(i *discordgo.InteractionCreate, force bool) error {
+	until, active := b.quietHoursUntil(i.GuildID)
+	if !active {
+		return nil
+	}
+	if force && b.IsDJ(i.GuildID, i.Member) {
+		logger.Info("Quiet hours overridden", "guild", i.GuildID, "user", i.Member.User.ID)
+		return nil
+	}
+	return i18n.Error("play.quiet_hours", "until", until)
+}
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietHoursActive(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		hours      quietHours
+		now        time.Time
+		wantActive bool
+		wantUntil  time.Time
+	}{
+		{
+			name:       "inside a daytime window",
+			hours:      quietHours{Start: "13:00", End: "15:00", Timezone: "Europe/Berlin"},
+			now:        time.Date(2026, 6, 1, 14, 0, 0, 0, berlin),
+			wantActive: true,
+			wantUntil:  time.Date(2026, 6, 1, 15, 0, 0, 0, berlin),
+		},
+		{
+			name:  "the window's end is outside it",
+			hours: quietHours{Start: "13:00", End: "15:00", Timezone: "Europe/Berlin"},
+			now:   time.Date(2026, 6, 1, 15, 0, 0, 0, berlin),
+		},
+		{
+			name:       "before midnight in a window crossing it",
+			hours:      quietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Berlin"},
+			now:        time.Date(2026, 6, 1, 23, 30, 0, 0, berlin),
+			wantActive: true,
+			wantUntil:  time.Date(2026, 6, 2, 7, 0, 0, 0, berlin),
+		},
+		{
+			name:       "after midnight in a window crossing it",
+			hours:      quietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Berlin"},
+			now:        time.Date(2026, 6, 2, 6, 59, 0, 0, berlin),
+			wantActive: true,
+			wantUntil:  time.Date(2026, 6, 2, 7, 0, 0, 0, berlin),
+		},
+		{
+			name:  "outside a window crossing midnight",
+			hours: quietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Berlin"},
+			now:   time.Date(2026, 6, 2, 12, 0, 0, 0, berlin),
+		},
+		{
+			name:       "times are read in the configured timezone",
+			hours:      quietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Berlin"},
+			now:        time.Date(2026, 6, 1, 20, 30, 0, 0, time.UTC), // 22:30 in Berlin
+			wantActive: true,
+			wantUntil:  time.Date(2026, 6, 2, 7, 0, 0, 0, berlin),
+		},
+		{
+			// Clocks in New York jump from 02:00 to 03:00 on 8 March 2026, so the night
+			// is an hour shorter but still ends at 07:00 local time
+			name:       "across a DST change",
+			hours:      quietHours{Start: "22:00", End: "07:00", Timezone: "America/New_York"},
+			now:        time.Date(2026, 3, 8, 6, 30, 0, 0, newYork),
+			wantActive: true,
+			wantUntil:  time.Date(2026, 3, 8, 7, 0, 0, 0, newYork),
+		},
+		{
+			name:  "after a DST change",
+			hours: quietHours{Start: "22:00", End: "07:00", Timezone: "America/New_York"},
+			now:   time.Date(2026, 3, 8, 11, 30, 0, 0, time.UTC), // 07:30 EDT, but 06:30 EST
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			active, until := tt.hours.active(tt.now)
+			if active != tt.wantActive {
+				t.Fatalf("active = %v, want %v", active, tt.wantActive)
+			}
+			if active && !until.Equal(tt.wantUntil) {
+				t.Errorf("until = %v, want %v", until, tt.wantUntil)
+			}
+		})
+	}
+}
+
+func TestNewQuietHours(t *testing.T) {
+	q, err := newQuietHours("7:30", "21:00", "Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Start != "07:30" || q.End != "21:00" || q.Timezone != "Europe/Berlin" {
+		t.Errorf("got %+v", q)
+	}
+
+	for _, tt := range []struct{ start, end, timezone string }{
+		{"24:00", "07:00", "Europe/Berlin"},
+		{"21:0", "07:00", "Europe/Berlin"},
+		{"nine", "07:00", "Europe/Berlin"},
+		{"21:00", "21:00", "Europe/Berlin"},
+		{"21:00", "07:00", "Mars/Olympus_Mons"},
+		{"21:00", "07:00", "Local"},
+	} {
+		if _, err := newQuietHours(tt.start, tt.end, tt.timezone); err == nil {
+			t.Errorf("newQuietHours(%q, %q, %q) succeeded", tt.start, tt.end, tt.timezone)
+		}
+	}
+}
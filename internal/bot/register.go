@@ -0,0 +1,186 @@
+package bot
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// commandSync counts what registering commands did
+type commandSync struct {
+	created, updated, deleted, unchanged int
+}
+
+// add adds another registration's counts
+func (c *commandSync) add(other commandSync) {
+	c.created += other.created
+	c.updated += other.updated
+	c.deleted += other.deleted
+	c.unchanged += other.unchanged
+}
+
+// String summarizes the counts, like "2 created, 1 updated, 3 deleted, 14 unchanged"
+func (c commandSync) String() string {
+	return fmt.Sprintf("%d created, %d updated, %d deleted, %d unchanged", c.created, c.updated, c.deleted, c.unchanged)
+}
+
+// commandUpdate is a registered command to replace with its current definition
+type commandUpdate struct {
+	ID      string
+	Command *discordgo.ApplicationCommand
+}
+
+// commandDiff is what it takes to turn the registered commands into the defined ones
+type commandDiff struct {
+	create    []*discordgo.ApplicationCommand
+	update    []commandUpdate
+	remove    []*discordgo.ApplicationCommand
+	unchanged int
+}
+
+// diffCommands compares the registered commands with the defined ones by name and definition
+func diffCommands(registered, defined []*discordgo.ApplicationCommand) commandDiff {
+	byName := make(map[string]*discordgo.ApplicationCommand, len(registered))
+	for _, cmd := range registered {
+		byName[cmd.Name] = cmd
+	}
+
+	var diff commandDiff
+	for _, cmd := range defined {
+		existing, ok := byName[cmd.Name]
+		switch {
+		case !ok:
+			diff.create = append(diff.create, cmd)
+		case !sameCommand(existing, cmd):
+			diff.update = append(diff.update, commandUpdate{ID: existing.ID, Command: cmd})
+		default:
+			diff.unchanged++
+		}
+		delete(byName, cmd.Name)
+	}
+	for _, cmd := range registered {
+		if _, stale := byName[cmd.Name]; stale {
+			diff.remove = append(diff.remove, cmd)
+		}
+	}
+	return diff
+}
+
+// syncCommands makes the commands registered globally (guildID "") or in one server match
+// defined, touching only the ones that differ; clean deletes and recreates all of them instead
+func (b *Bot) syncCommands(guildID string, defined []*discordgo.ApplicationCommand, clean bool) (commandSync, error) {
+	appID := b.Session.State.User.ID
+	registered, err := b.Session.ApplicationCommands(appID, guildID)
+	if err != nil {
+		return commandSync{}, fmt.Errorf("failed to list registered commands: %w", err)
+	}
+
+	diff := diffCommands(registered, defined)
+	if clean {
+		diff = commandDiff{create: defined, remove: registered}
+	}
+
+	var sync commandSync
+	for _, cmd := range diff.remove {
+		if err := b.Session.ApplicationCommandDelete(appID, guildID, cmd.ID); err != nil {
+			return sync, fmt.Errorf("failed to delete command %s: %w", cmd.Name, err)
+		}
+		sync.deleted++
+	}
+	for _, update := range diff.update {
+		if _, err := b.Session.ApplicationCommandEdit(appID, guildID, update.ID, update.Command); err != nil {
+			return sync, fmt.Errorf("failed to update command %s: %w", update.Command.Name, err)
+		}
+		sync.updated++
+	}
+	for _, cmd := range diff.create {
+		if _, err := b.Session.ApplicationCommandCreate(appID, guildID, cmd); err != nil {
+			return sync, fmt.Errorf("failed to create command %s: %w", cmd.Name, err)
+		}
+		sync.created++
+	}
+	sync.unchanged = diff.unchanged
+	return sync, nil
+}
+
+// commandShape is the part of a command's definition GoBard sets, in the form Discord
+// returns it, so a defined command can be compared with a registered one
+type commandShape struct {
+	Type          discordgo.ApplicationCommandType
+	Name          string
+	Description   string
+	Localizations map[discordgo.Locale]string
+	Permissions   *int64
+	Options       []optionShape
+}
+
+// optionShape is the part of an option's definition GoBard sets
+type optionShape struct {
+	Type         discordgo.ApplicationCommandOptionType
+	Name         string
+	Description  string
+	Required     bool
+	Autocomplete bool
+	Choices      []string
+	ChannelTypes []discordgo.ChannelType
+	MinValue     *float64
+	MaxValue     float64
+	MinLength    *int
+	MaxLength    int
+	Options      []optionShape
+}
+
+// sameCommand reports whether two command definitions match
+func sameCommand(a, b *discordgo.ApplicationCommand) bool {
+	return reflect.DeepEqual(shapeOf(a), shapeOf(b))
+}
+
+// shapeOf returns a command's definition with the defaults Discord fills in
+func shapeOf(cmd *discordgo.ApplicationCommand) commandShape {
+	shape := commandShape{
+		Type:        cmd.Type,
+		Name:        cmd.Name,
+		Description: cmd.Description,
+		Permissions: cmd.DefaultMemberPermissions,
+		Options:     optionShapes(cmd.Options),
+	}
+	if shape.Type == 0 {
+		shape.Type = discordgo.ChatApplicationCommand
+	}
+	if cmd.DescriptionLocalizations != nil && len(*cmd.DescriptionLocalizations) > 0 {
+		shape.Localizations = *cmd.DescriptionLocalizations
+	}
+	return shape
+}
+
+// optionShapes returns options' definitions, nil if there are none
+func optionShapes(options []*discordgo.ApplicationCommandOption) []optionShape {
+	if len(options) == 0 {
+		return nil
+	}
+	shapes := make([]optionShape, 0, len(options))
+	for _, option := range options {
+		shape := optionShape{
+			Type:         option.Type,
+			Name:         option.Name,
+			Description:  option.Description,
+			Required:     option.Required,
+			Autocomplete: option.Autocomplete,
+			MinValue:     option.MinValue,
+			MaxValue:     option.MaxValue,
+			MinLength:    option.MinLength,
+			MaxLength:    option.MaxLength,
+			Options:      optionShapes(option.Options),
+		}
+		if len(option.ChannelTypes) > 0 {
+			shape.ChannelTypes = option.ChannelTypes
+		}
+		// Discord returns integer choice values as JSON numbers, which decode to float64
+		for _, choice := range option.Choices {
+			shape.Choices = append(shape.Choices, fmt.Sprintf("%s=%v", choice.Name, choice.Value))
+		}
+		shapes = append(shapes, shape)
+	}
+	return shapes
+}
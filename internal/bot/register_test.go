@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestDiffCommands(t *testing.T) {
+	min1 := 1.0
+	defined := []*discordgo.ApplicationCommand{
+		{Name: "play", Description: "Play a song", Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionInteger, Name: "limit", Description: "Most tracks", MinValue: &min1},
+		}},
+		{Name: "loop", Description: "Toggle looping", Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionString, Name: "mode", Description: "Mode", Choices: []*discordgo.ApplicationCommandOptionChoice{
+				{Name: "off", Value: "off"},
+				{Name: "one", Value: 1},
+			}},
+		}},
+		{Name: "skip", Description: "Skip the current song"},
+		{Name: "lyrics", Description: "Show lyrics"},
+	}
+
+	// As Discord returns them: types filled in, empty options, integer choices as float64
+	min1Copy := 1.0
+	registered := []*discordgo.ApplicationCommand{
+		{ID: "1", Type: discordgo.ChatApplicationCommand, Name: "play", Description: "Play a song", Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionInteger, Name: "limit", Description: "Most tracks", MinValue: &min1Copy, ChannelTypes: []discordgo.ChannelType{}},
+		}},
+		{ID: "2", Type: discordgo.ChatApplicationCommand, Name: "loop", Description: "Toggle looping", Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionString, Name: "mode", Description: "Mode", Choices: []*discordgo.ApplicationCommandOptionChoice{
+				{Name: "off", Value: "off"},
+				{Name: "one", Value: float64(1)},
+			}},
+		}},
+		{ID: "3", Type: discordgo.ChatApplicationCommand, Name: "skip", Description: "Skip the song", Options: []*discordgo.ApplicationCommandOption{}},
+		{ID: "4", Type: discordgo.ChatApplicationCommand, Name: "fseek", Description: "Seek forward"},
+	}
+
+	diff := diffCommands(registered, defined)
+	if diff.unchanged != 2 {
+		t.Errorf("unchanged = %d, want 2 (play and loop)", diff.unchanged)
+	}
+	if len(diff.update) != 1 || diff.update[0].ID != "3" || diff.update[0].Command.Name != "skip" {
+		t.Errorf("update = %+v, want skip", diff.update)
+	}
+	if len(diff.create) != 1 || diff.create[0].Name != "lyrics" {
+		t.Errorf("create = %+v, want lyrics", diff.create)
+	}
+	if len(diff.remove) != 1 || diff.remove[0].ID != "4" {
+		t.Errorf("remove = %+v, want fseek", diff.remove)
+	}
+}
+
+func TestSameCommandComparesPermissions(t *testing.T) {
+	perms := int64(discordgo.PermissionManageGuild)
+	defined := &discordgo.ApplicationCommand{Name: "cache", Description: "Manage the cache", DefaultMemberPermissions: &perms}
+	registered := &discordgo.ApplicationCommand{Name: "cache", Description: "Manage the cache"}
+	if sameCommand(registered, defined) {
+		t.Error("a command that gained default permissions should be updated")
+	}
+}
@@ -0,0 +1,196 @@
+package bot
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/GrainedLotus515/gobard/internal/config"
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/youtube"
+	"github.com/bwmarrin/discordgo"
+)
+
+// reloadable maps the Config fields Reload applies to the running bot to their setting names
+// Everything else is read once at startup, so changing it needs a restart
+var reloadable = map[string]string{
+	"LogLevel":                 "LOG_LEVEL",
+	"LogFormat":                "LOG_FORMAT",
+	"Debug":                    "DEBUG",
+	"CacheLimit":               "CACHE_LIMIT",
+	"CacheMinFree":             "CACHE_MIN_FREE",
+	"CacheMaxTrackDuration":    "CACHE_MAX_TRACK_DURATION",
+	"PreEncodeCache":           "PRE_ENCODE_CACHE",
+	"PlaybackMode":             "PLAYBACK_MODE",
+	"DownloadFirstMaxDuration": "DOWNLOAD_FIRST_MAX_DURATION",
+	"DownloadFirstTimeout":     "DOWNLOAD_FIRST_TIMEOUT",
+	"BotStatus":                "BOT_STATUS",
+	"BotActivityType":          "BOT_ACTIVITY_TYPE",
+	"BotActivity":              "BOT_ACTIVITY",
+	"BotActivityURL":           "BOT_ACTIVITY_URL",
+	"DJRole":                   "DJ_ROLE",
+	"MaxPlaylistSize":          "MAX_PLAYLIST_SIZE",
+	"MaxTrackDuration":         "MAX_TRACK_DURATION",
+	"AllowLive":                "ALLOW_LIVE",
+	"AllowedGuildIDs":          "ALLOWED_GUILD_IDS",
+	"BlockedGuildIDs":          "BLOCKED_GUILD_IDS",
+	"GuildLeaveMessage":        "GUILD_LEAVE_MESSAGE",
+	"Blocklist":                "BLOCKLIST",
+	"RateLimit":                "RATE_LIMIT",
+	"RateLimitExemptDJs":       "RATE_LIMIT_EXEMPT_DJS",
+	"BotOwnerIDs":              "BOT_OWNER_IDS",
+	"YtDlpMaxProcs":            "YTDLP_MAX_CONCURRENCY",
+	"StreamPrefetchCount":      "STREAM_PREFETCH_COUNT",
+	"SearchProvider":           "SEARCH_PROVIDER",
+	"SearchMaxDuration":        "SEARCH_MAX_DURATION",
+	"SearchMaxRatio":           "SEARCH_MAX_LENGTH_RATIO",
+	"SearchJunkPatterns":       "SEARCH_JUNK_PATTERNS",
+}
+
+// SettingChange is a setting Reload changed on the running bot
+type SettingChange struct {
+	Name string
+	Old  string
+	New  string
+}
+
+// ReloadResult describes what a reload changed
+type ReloadResult struct {
+	Applied []SettingChange
+	Restart []string // Config fields that changed but keep their old value until a restart
+}
+
+// SetConfigLoader sets how Reload loads the configuration again
+func (b *Bot) SetConfigLoader(load func() (*config.Config, error)) {
+	b.loadConfig = load
+}
+
+// Reload loads the configuration again and applies the settings that can change while the
+// bot runs, logging each change; other changed settings keep their running values and are
+// reported as needing a restart
+// An invalid configuration is rejected as a whole
+func (b *Bot) Reload() (*ReloadResult, error) {
+	if b.loadConfig == nil {
+		return nil, fmt.Errorf("configuration reloading isn't set up")
+	}
+
+	b.reloadMu.Lock()
+	defer b.reloadMu.Unlock()
+
+	loaded, err := b.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	old := b.config()
+	next := *old
+	result := &ReloadResult{}
+
+	oldValue := reflect.ValueOf(old).Elem()
+	loadedValue := reflect.ValueOf(loaded).Elem()
+	nextValue := reflect.ValueOf(&next).Elem()
+	for i := range oldValue.NumField() {
+		if reflect.DeepEqual(oldValue.Field(i).Interface(), loadedValue.Field(i).Interface()) {
+			continue
+		}
+		field := oldValue.Type().Field(i).Name
+		name, ok := reloadable[field]
+		if !ok {
+			result.Restart = append(result.Restart, field)
+			continue
+		}
+		nextValue.Field(i).Set(loadedValue.Field(i))
+		result.Applied = append(result.Applied, SettingChange{
+			Name: name,
+			Old:  fmt.Sprint(oldValue.Field(i).Interface()),
+			New:  fmt.Sprint(loadedValue.Field(i).Interface()),
+		})
+	}
+
+	b.configMu.Lock()
+	b.Config = &next
+	b.configMu.Unlock()
+	b.applyConfig(old, &next)
+
+	for _, change := range result.Applied {
+		logger.Info("Setting reloaded", "setting", change.Name, "change", change.Old+" → "+change.New)
+	}
+	if len(result.Restart) > 0 {
+		logger.Warn("Changed settings need a restart to take effect", "settings", strings.Join(result.Restart, ", "))
+	}
+	if len(result.Applied) == 0 && len(result.Restart) == 0 {
+		logger.Info("Configuration unchanged")
+	}
+	return result, nil
+}
+
+// applyConfig pushes reloaded settings into the parts of the bot that copied them at startup
+// Settings read on every command, like DJ_ROLE, take effect without this
+func (b *Bot) applyConfig(old, cfg *config.Config) {
+	if cfg.LogFormat != old.LogFormat {
+		if err := logger.SetFormat(cfg.LogFormat); err != nil {
+			logger.Error("Failed to change the log format", "err", err)
+		}
+	}
+	if cfg.EffectiveLogLevel() != old.EffectiveLogLevel() {
+		if err := logger.SetLevel(cfg.EffectiveLogLevel()); err != nil {
+			logger.Error("Failed to change the log level", "err", err)
+		}
+	}
+
+	if cfg.CacheLimit != old.CacheLimit {
+		b.Cache.SetLimit(cfg.CacheLimit)
+	}
+	if cfg.CacheMinFree != old.CacheMinFree {
+		b.Cache.SetMinFree(cfg.CacheMinFree)
+	}
+
+	if cfg.YtDlpMaxProcs != old.YtDlpMaxProcs {
+		youtube.SetMaxConcurrency(cfg.YtDlpMaxProcs)
+	}
+	if cfg.SearchMaxDuration != old.SearchMaxDuration || cfg.SearchMaxRatio != old.SearchMaxRatio ||
+		!slices.Equal(cfg.SearchJunkPatterns, old.SearchJunkPatterns) {
+		youtube.SetResultFilter(resultFilter(cfg))
+	}
+
+	if cfg.BotStatus != old.BotStatus || cfg.BotActivityType != old.BotActivityType ||
+		cfg.BotActivity != old.BotActivity || cfg.BotActivityURL != old.BotActivityURL {
+		b.updatePresence(b.Session)
+	}
+
+	if !slices.Equal(cfg.AllowedGuildIDs, old.AllowedGuildIDs) || !slices.Equal(cfg.BlockedGuildIDs, old.BlockedGuildIDs) {
+		go b.leaveDisallowedGuilds(b.Session)
+	}
+}
+
+// resultFilter builds the search result filter from SEARCH_MAX_DURATION,
+// SEARCH_MAX_LENGTH_RATIO and SEARCH_JUNK_PATTERNS
+func resultFilter(cfg *config.Config) youtube.ResultFilter {
+	return youtube.ResultFilter{
+		MaxDuration:  cfg.SearchMaxDuration,
+		MaxRatio:     float64(cfg.SearchMaxRatio),
+		JunkPatterns: cfg.SearchJunkPatterns,
+	}
+}
+
+// isOwner reports whether a user owns the bot: one of BOT_OWNER_IDS if it is set, else the
+// owner of the bot's Discord application or a member of the team that owns it
+func (b *Bot) isOwner(s *discordgo.Session, userID string) (bool, error) {
+	if owners := b.config().BotOwnerIDs; len(owners) > 0 {
+		return slices.Contains(owners, userID), nil
+	}
+	app, err := s.Application("@me")
+	if err != nil {
+		return false, fmt.Errorf("failed to look up the bot's owner: %w", err)
+	}
+	if app.Team != nil {
+		for _, member := range app.Team.Members {
+			if member.User != nil && member.User.ID == userID {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return app.Owner != nil && app.Owner.ID == userID, nil
+}
@@ -0,0 +1,196 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/cache"
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/GrainedLotus515/gobard/internal/youtube"
+)
+
+// resolveTimeout bounds each background yt-dlp lookup
+const resolveTimeout = 30 * time.Second
+
+// trackResolver fetches full info and stream URLs for the next few tracks as the playhead
+// moves, so they start without the slow stream URL lookup, and matches queued Spotify,
+// Apple Music and Deezer tracks on YouTube
+// It is the only background lookup per guild, so no track is looked up twice
+type trackResolver struct {
+	youtube *youtube.Client
+	spotify *spotifyMatcher
+	queue   *player.Queue
+	cache   *cache.Cache
+	ahead   int // Upcoming tracks to resolve
+
+	mu       sync.Mutex
+	inFlight map[*player.Track]*resolution
+}
+
+// resolution is one background lookup
+type resolution struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	result *player.Track // nil if the lookup failed or was cancelled
+	err    error
+}
+
+// newTrackResolver creates a resolver for a guild's queue that looks ahead by the given number of tracks
+func newTrackResolver(client *youtube.Client, matcher *spotifyMatcher, queue *player.Queue, cache *cache.Cache, ahead int) *trackResolver {
+	return &trackResolver{
+		youtube:  client,
+		spotify:  matcher,
+		queue:    queue,
+		cache:    cache,
+		ahead:    ahead,
+		inFlight: make(map[*player.Track]*resolution),
+	}
+}
+
+// run resolves upcoming tracks as the queue changes until ctx is cancelled
+func (r *trackResolver) run(ctx context.Context) {
+	for {
+		r.update(ctx)
+
+		select {
+		case <-ctx.Done():
+			r.cancelAll()
+			return
+		case <-r.queue.Changes():
+		}
+	}
+}
+
+// update starts lookups for upcoming tracks that need one and cancels the ones no longer upcoming
+func (r *trackResolver) update(ctx context.Context) {
+	upcoming := r.queue.Upcoming(r.ahead)
+	current := r.queue.Current()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	wanted := make(map[*player.Track]bool, len(upcoming))
+	for _, track := range upcoming {
+		wanted[track] = true
+		if _, ok := r.inFlight[track]; !ok && r.needsLookup(track) {
+			r.start(ctx, track)
+		}
+	}
+
+	for track, res := range r.inFlight {
+		// The playback loop may be waiting on the current track's lookup
+		if wanted[track] || track == current {
+			continue
+		}
+		res.cancel()
+		delete(r.inFlight, track)
+	}
+}
+
+// needsLookup reports whether a track would otherwise have to look up its stream when it starts
+// Live manifests expire quickly, so livestreams are always extracted as they start
+func (r *trackResolver) needsLookup(track *player.Track) bool {
+	if track.NeedsMatch() {
+		return true
+	}
+	if track.IsLive || track.Source != player.SourceYouTube || track.URL == "" {
+		return false
+	}
+	if !track.Partial && track.StreamURL != "" {
+		return false
+	}
+	return !r.cache.Contains(cache.GenerateKey(track.URL))
+}
+
+// start looks up a track in the background; the caller must hold r.mu
+// The lookup stops when the resolver stops or the track leaves the queue
+func (r *trackResolver) start(parent context.Context, track *player.Track) {
+	ctx, cancel := context.WithTimeout(track.Context(), resolveTimeout)
+	stop := context.AfterFunc(parent, cancel)
+	res := &resolution{cancel: cancel, done: make(chan struct{})}
+	r.inFlight[track] = res
+
+	go func() {
+		defer close(res.done)
+		defer stop()
+		defer cancel()
+
+		resolved, err := r.lookup(ctx, track)
+		if err != nil {
+			if !errors.Is(ctx.Err(), context.Canceled) {
+				logger.Debug("Background track resolution failed", "title", track.Title, "err", err)
+			}
+			res.err = err
+			return
+		}
+		res.result = resolved
+
+		// If the track already started playing, await hands the result over instead
+		if r.queue.ReplaceUpcoming(track, resolved) {
+			logger.Debug("Resolved upcoming track", "title", resolved.Title)
+		}
+	}()
+}
+
+// lookup fetches what track needs to play: a YouTube match for Spotify, Apple Music and
+// Deezer tracks, or full info and a stream URL for YouTube tracks
+func (r *trackResolver) lookup(ctx context.Context, track *player.Track) (*player.Track, error) {
+	if track.NeedsMatch() {
+		return r.spotify.match(ctx, track)
+	}
+	return r.youtube.ResolveTrack(ctx, track)
+}
+
+// await returns the track to play in place of track, waiting for its lookup if one is running
+// The current queue entry is swapped for the resolved track
+// Tracks from other services that weren't matched in the background are matched now; an
+// error means one couldn't be matched and has to be skipped
+func (r *trackResolver) await(track *player.Track) (*player.Track, error) {
+	r.mu.Lock()
+	res, ok := r.inFlight[track]
+	delete(r.inFlight, track)
+	r.mu.Unlock()
+
+	var resolved *player.Track
+	var err error
+	switch {
+	case ok:
+		<-res.done
+		resolved, err = res.result, res.err
+	case track.NeedsMatch():
+		ctx, cancel := context.WithTimeout(track.Context(), resolveTimeout)
+		resolved, err = r.lookup(ctx, track)
+		cancel()
+	default:
+		return track, nil
+	}
+
+	if resolved == nil {
+		// A YouTube track can still stream without its lookup; a track to match has nothing to play
+		if track.NeedsMatch() {
+			if err == nil {
+				err = context.Canceled
+			}
+			return track, err
+		}
+		return track, nil
+	}
+	if !r.queue.ReplaceCurrent(track, resolved) {
+		return track, nil
+	}
+	return resolved, nil
+}
+
+// cancelAll stops every running lookup
+func (r *trackResolver) cancelAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for track, res := range r.inFlight {
+		res.cancel()
+		delete(r.inFlight, track)
+	}
+}
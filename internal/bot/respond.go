@@ -0,0 +1,292 @@
+package bot
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/bwmarrin/discordgo"
+)
+
+// replyState is how far an interaction has been answered
+type replyState int
+
+const (
+	replyNone              replyState = iota // Nothing sent yet; the next reply is the initial response
+	replyDeferred                            // "Thinking…" shown; the next reply edits it
+	replyDeferredEphemeral                   // "Thinking…" shown to the invoker only; the next reply edits it
+	replySent                                // Answered; further replies are followups
+)
+
+// messageClass is what a reply is for, which decides who sees it
+type messageClass int
+
+const (
+	announcement messageClass = iota // News for the whole channel, like "Added to queue"
+	confirmation                     // Acknowledges a control command; only the invoker sees it in quiet mode
+)
+
+// quietModeStoreFile is where the servers that turned on quiet mode are kept, relative to
+// the cache directory
+const quietModeStoreFile = "guilds/quiet_mode.json"
+
+// quietMode reports whether a server turned on quiet mode, which shows confirmations of
+// control commands only to whoever ran them
+func (b *Bot) quietMode(guildID string) bool {
+	if b.quietModes == nil {
+		return false
+	}
+	on, _ := b.quietModes.Get(guildID)
+	return on
+}
+
+// classFlags returns the flags a reply of a class is sent with: confirmations are
+// ephemeral on servers that turned on quiet mode
+func (b *Bot) classFlags(i *discordgo.InteractionCreate, class messageClass) discordgo.MessageFlags {
+	if class == confirmation && b.quietMode(i.GuildID) {
+		return discordgo.MessageFlagsEphemeral
+	}
+	return 0
+}
+
+// responder delivers a command's replies where the command was run: as an interaction's
+// responses, or as messages replying to the message a prefix command was typed in
+type responder interface {
+	// deferReply acknowledges a command that may take longer than Discord's three seconds to
+	// answer; flags decide whether the reply to come is ephemeral
+	deferReply(flags discordgo.MessageFlags) error
+	// reply sends a message
+	reply(data *discordgo.InteractionResponseData) error
+	// edit changes the first reply, or the deferred response standing in for it
+	edit(edit *discordgo.WebhookEdit) error
+}
+
+// interactionResponder answers an interaction
+// Discord accepts exactly one initial response per interaction, so it remembers how far the
+// interaction was answered and sends the next message the only way Discord still accepts it
+type interactionResponder struct {
+	s           *discordgo.Session
+	interaction *discordgo.Interaction
+
+	mu    sync.Mutex
+	state replyState
+}
+
+// newInteractionResponder returns a responder for an interaction nothing was sent for yet
+func newInteractionResponder(s *discordgo.Session, i *discordgo.InteractionCreate) *interactionResponder {
+	return &interactionResponder{s: s, interaction: i.Interaction}
+}
+
+// deferReply shows "thinking…"; the next reply replaces it
+// An interaction that was already answered or deferred is left alone
+func (r *interactionResponder) deferReply(flags discordgo.MessageFlags) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state != replyNone {
+		return nil
+	}
+	err := r.s.InteractionRespond(r.interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: flags},
+	})
+	if err != nil {
+		return err
+	}
+	if flags&discordgo.MessageFlagsEphemeral != 0 {
+		r.state = replyDeferredEphemeral
+	} else {
+		r.state = replyDeferred
+	}
+	return nil
+}
+
+// reply sends a message as the initial response, in place of a deferred one, or as a followup
+// A public deferred response can't be made ephemeral, so an ephemeral reply deletes it and
+// is sent as a followup instead
+func (r *interactionResponder) reply(data *discordgo.InteractionResponseData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state := r.state
+	if state == replyDeferred && data.Flags&discordgo.MessageFlagsEphemeral != 0 {
+		if err := r.s.InteractionResponseDelete(r.interaction); err != nil {
+			logger.Warn("Failed to delete the deferred response", "guild", r.interaction.GuildID, "err", err)
+		}
+		state = replySent
+	}
+
+	var err error
+	switch state {
+	case replyNone:
+		err = r.s.InteractionRespond(r.interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: data,
+		})
+	case replyDeferred, replyDeferredEphemeral:
+		embeds := data.Embeds
+		if embeds == nil {
+			embeds = []*discordgo.MessageEmbed{}
+		}
+		edit := &discordgo.WebhookEdit{
+			Content: &data.Content, // Also replaces any progress shown while deferred
+			Embeds:  &embeds,
+		}
+		if data.Components != nil {
+			edit.Components = &data.Components
+		}
+		_, err = r.s.InteractionResponseEdit(r.interaction, edit)
+	case replySent:
+		_, err = r.s.FollowupMessageCreate(r.interaction, true, &discordgo.WebhookParams{
+			Content:    data.Content,
+			Embeds:     data.Embeds,
+			Components: data.Components,
+			Flags:      data.Flags,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	r.state = replySent
+	return nil
+}
+
+// edit changes the interaction's response
+func (r *interactionResponder) edit(edit *discordgo.WebhookEdit) error {
+	_, err := r.s.InteractionResponseEdit(r.interaction, edit)
+	return err
+}
+
+// errNoReply is returned when a prefix command's reply is edited before it was sent
+var errNoReply = errors.New("nothing was sent to edit")
+
+// messageResponder answers a prefix command with messages replying to the one it was typed in
+// Messages can't be ephemeral, so everything it sends is public
+type messageResponder struct {
+	s       *discordgo.Session
+	message *discordgo.Message
+
+	mu   sync.Mutex
+	sent *discordgo.Message // The first reply, which edit changes
+}
+
+// newMessageResponder returns a responder for a prefix command's message
+func newMessageResponder(s *discordgo.Session, m *discordgo.Message) *messageResponder {
+	return &messageResponder{s: s, message: m}
+}
+
+// deferReply shows the bot typing, which lasts until it sends a message
+func (r *messageResponder) deferReply(discordgo.MessageFlags) error {
+	return r.s.ChannelTyping(r.message.ChannelID)
+}
+
+// reply sends a message replying to the command's
+func (r *messageResponder) reply(data *discordgo.InteractionResponseData) error {
+	sent, err := r.s.ChannelMessageSendComplex(r.message.ChannelID, &discordgo.MessageSend{
+		Content:    data.Content,
+		Embeds:     data.Embeds,
+		Components: data.Components,
+		Reference:  r.message.Reference(),
+		// Track titles may contain mentions
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sent == nil {
+		r.sent = sent
+	}
+	return nil
+}
+
+// edit changes the first reply; before there is one, it returns errNoReply
+func (r *messageResponder) edit(edit *discordgo.WebhookEdit) error {
+	r.mu.Lock()
+	sent := r.sent
+	r.mu.Unlock()
+	if sent == nil {
+		return errNoReply
+	}
+
+	_, err := r.s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:              sent.ID,
+		Channel:         sent.ChannelID,
+		Content:         edit.Content,
+		Embeds:          edit.Embeds,
+		Components:      edit.Components,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	return err
+}
+
+// deferResponse acknowledges a command that may take a while to answer
+// Whether the reply is ephemeral is decided here, so it takes the class of the reply to come
+func (b *Bot) deferResponse(r responder, i *discordgo.InteractionCreate, class messageClass) {
+	if err := r.deferReply(b.classFlags(i, class)); err != nil {
+		logger.Warn("Failed to defer the response", "cmd", commandName(i), "guild", i.GuildID, "err", err)
+	}
+}
+
+// reply sends a reply to a command, logging it if that fails
+func (b *Bot) reply(r responder, i *discordgo.InteractionCreate, data *discordgo.InteractionResponseData) {
+	if err := r.reply(data); err != nil {
+		logger.Warn("Failed to reply", "cmd", commandName(i), "guild", i.GuildID, "err", err)
+	}
+}
+
+// commandName returns the name of an interaction's command, or "" for button presses
+func commandName(i *discordgo.InteractionCreate) string {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return ""
+	}
+	return i.ApplicationCommandData().Name
+}
+
+// respondError sends an error response only the invoking user sees, whatever was sent before it
+// An *i18n.Message error is translated; wrapped in another error, it keeps the wrapper's text
+func (b *Bot) respondError(r responder, i *discordgo.InteractionCreate, err error) {
+	message := err.Error()
+	if m, ok := err.(*i18n.Message); ok {
+		message = m.In(b.locale(i))
+	}
+	b.reply(r, i, &discordgo.InteractionResponseData{
+		Content: b.t(i, "error", "error", message),
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+}
+
+// respond sends a success response of a class
+func (b *Bot) respond(r responder, i *discordgo.InteractionCreate, class messageClass, message string) {
+	b.reply(r, i, &discordgo.InteractionResponseData{
+		Content: message,
+		Flags:   b.classFlags(i, class),
+	})
+}
+
+// respondEmbed sends an embed response of a class
+func (b *Bot) respondEmbed(r responder, i *discordgo.InteractionCreate, class messageClass, embed *discordgo.MessageEmbed) {
+	b.reply(r, i, &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{embed},
+		Flags:  b.classFlags(i, class),
+	})
+}
+
+// respondEphemeral sends a response only the invoking user sees
+func (b *Bot) respondEphemeral(r responder, i *discordgo.InteractionCreate, message string) {
+	b.reply(r, i, &discordgo.InteractionResponseData{
+		Content: message,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+}
+
+// respondEphemeralEmbed sends an embed only the invoking user sees
+func (b *Bot) respondEphemeralEmbed(r responder, i *discordgo.InteractionCreate, embed *discordgo.MessageEmbed) {
+	b.reply(r, i, &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{embed},
+		Flags:  discordgo.MessageFlagsEphemeral,
+	})
+}
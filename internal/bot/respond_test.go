@@ -0,0 +1,185 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/GrainedLotus515/gobard/internal/store"
+	"github.com/bwmarrin/discordgo"
+)
+
+// testSession returns a session whose API requests are recorded instead of sent
+func testSession(t *testing.T) (*discordgo.Session, *recordingTransport) {
+	t.Helper()
+	s, err := discordgo.New("Bot token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := &recordingTransport{}
+	s.Client = &http.Client{Transport: transport}
+	return s, transport
+}
+
+func TestRespondErrorFollowsEarlierReplies(t *testing.T) {
+	tests := []struct {
+		name   string
+		before func(b *Bot, r responder, i *discordgo.InteractionCreate)
+		want   []string // Method and path of the requests sending the error
+	}{
+		{"nothing sent", func(*Bot, responder, *discordgo.InteractionCreate) {}, []string{"POST /api/v9/interactions/1/token/callback"}},
+		// A public deferral can't turn ephemeral, so it is deleted for an ephemeral followup
+		{"deferred", func(b *Bot, r responder, i *discordgo.InteractionCreate) {
+			b.deferResponse(r, i, announcement)
+		}, []string{"DELETE /api/v9/webhooks/4/token/messages/@original", "POST /api/v9/webhooks/4/token"}},
+		{"already answered", func(b *Bot, r responder, i *discordgo.InteractionCreate) {
+			b.respond(r, i, announcement, "✅ done")
+		}, []string{"POST /api/v9/webhooks/4/token"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, transport := testSession(t)
+			i := testInteraction("play")
+			i.AppID = "4"
+
+			b := &Bot{}
+			r := newInteractionResponder(s, i)
+			tt.before(b, r, i)
+			before := len(transport.requests)
+			b.respondError(r, i, fmt.Errorf("no songs found"))
+
+			sent := transport.requests[before:]
+			if len(sent) != len(tt.want) {
+				t.Fatalf("requests = %q, want %d more for the error", transport.requests, len(tt.want))
+			}
+			for idx, want := range tt.want {
+				if !strings.HasPrefix(sent[idx], want+" ") {
+					t.Errorf("request %d = %q, want %s", idx, sent[idx], want)
+				}
+			}
+			if got := sent[len(sent)-1]; !strings.Contains(got, "no songs found") || !strings.Contains(got, `"flags":64`) {
+				t.Errorf("error sent as %q, want an ephemeral message", got)
+			}
+		})
+	}
+}
+
+func TestQuietModeHidesConfirmations(t *testing.T) {
+	for _, quiet := range []bool{false, true} {
+		s, transport := testSession(t)
+		quietModes, err := store.Open[bool](filepath.Join(t.TempDir(), "quiet_mode.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if quiet {
+			quietModes.Set("2", true)
+		}
+		b := &Bot{PlayerManager: player.NewManager(), quietModes: quietModes}
+
+		confirm := testInteraction("pause")
+		b.respond(newInteractionResponder(s, confirm), confirm, confirmation, "⏸️ Paused")
+		announce := testInteraction("play")
+		announce.ID = "5"
+		b.respond(newInteractionResponder(s, announce), announce, announcement, "Added to queue")
+
+		if got := strings.Contains(transport.requests[0], `"flags":64`); got != quiet {
+			t.Errorf("quiet mode %v: confirmation ephemeral = %v", quiet, got)
+		}
+		if strings.Contains(transport.requests[1], `"flags":64`) {
+			t.Errorf("quiet mode %v: announcement was ephemeral", quiet)
+		}
+		// Looking the setting up doesn't create a player for the server
+		if players := b.PlayerManager.Players(); len(players) != 0 {
+			t.Errorf("quiet mode %v: %d players created", quiet, len(players))
+		}
+	}
+}
+
+func TestDeferResponseOnlyOnce(t *testing.T) {
+	s, transport := testSession(t)
+	i := testInteraction("search")
+	i.AppID = "4"
+
+	b := &Bot{}
+	r := newInteractionResponder(s, i)
+	b.deferResponse(r, i, announcement)
+	b.deferResponse(r, i, announcement)
+	if len(transport.requests) != 1 {
+		t.Errorf("requests = %q, want a single deferral", transport.requests)
+	}
+}
+
+func TestRespondErrorTranslates(t *testing.T) {
+	languages, err := store.Open[string](filepath.Join(t.TempDir(), "languages.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := languages.Set("2", "pt-BR"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		b      *Bot
+		locale discordgo.Locale
+		want   string
+	}{
+		{"member's language", &Bot{}, discordgo.PortugueseBR, "eita: nenhuma música encontrada"},
+		{"server's language", &Bot{languages: languages}, discordgo.EnglishUS, "eita: nenhuma música encontrada"},
+		{"unavailable language", &Bot{}, discordgo.Japanese, "ope: no songs found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, transport := testSession(t)
+			i := testInteraction("play")
+			i.Locale = tt.locale
+
+			tt.b.respondError(newInteractionResponder(s, i), i, i18n.Error("error.no_songs"))
+			if len(transport.requests) != 1 || !strings.Contains(transport.requests[0], tt.want) {
+				t.Errorf("requests = %q, want %q", transport.requests, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageResponderRepliesToTheCommand(t *testing.T) {
+	s, transport := testSession(t)
+	transport.body = `{"id":"11","channel_id":"20"}`
+	m := &discordgo.Message{ID: "10", ChannelID: "20", GuildID: "30", Content: "!play song"}
+	r := newMessageResponder(s, m)
+
+	if err := r.edit(&discordgo.WebhookEdit{}); !errors.Is(err, errNoReply) {
+		t.Errorf("edit before replying = %v, want errNoReply", err)
+	}
+
+	b := &Bot{}
+	i := prefixInteraction(m, "!")
+	b.deferResponse(r, i, announcement)
+	b.respondEphemeral(r, i, "only for you")
+	content := "🔍 Importing"
+	if err := r.edit(&discordgo.WebhookEdit{Content: &content}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"POST /api/v9/channels/20/typing",
+		"POST /api/v9/channels/20/messages",
+		"PATCH /api/v9/channels/20/messages/11",
+	}
+	if len(transport.requests) != len(want) {
+		t.Fatalf("requests = %q, want %d", transport.requests, len(want))
+	}
+	for idx, want := range want {
+		if !strings.HasPrefix(transport.requests[idx], want+" ") {
+			t.Errorf("request %d = %q, want %s", idx, transport.requests[idx], want)
+		}
+	}
+	if reply := transport.requests[1]; !strings.Contains(reply, `"message_id":"10"`) || !strings.Contains(reply, "only for you") {
+		t.Errorf("reply = %q, want the message replying to the command", reply)
+	}
+}
@@ -0,0 +1,304 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/cache"
+	"github.com/GrainedLotus515/gobard/internal/i18n"
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// sfxStoreFile is where servers' sound effects are listed, relative to the cache directory
+	sfxStoreFile = "guilds/sfx.json"
+	// sfxDir holds the sound effects' audio, in a directory per server, relative to the cache
+	// directory; the cache never evicts files in subdirectories
+	sfxDir = "sfx"
+	// sfxMaxSize is the largest file /sfx add accepts, in bytes
+	sfxMaxSize = 4 << 20
+	// sfxLimit is the most sound effects one server can keep
+	sfxLimit = 25
+	// sfxDownloadTimeout bounds downloading an uploaded sound effect
+	sfxDownloadTimeout = 30 * time.Second
+	// sfxLeaveDelay is how long the bot stays after playing a sound effect in a channel it
+	// joined for it, in case another follows
+	sfxLeaveDelay = 5 * time.Second
+)
+
+// sfxName is what sound effects can be called: short, lowercase and without spaces
+var sfxName = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// soundEffect is a short clip a server saved with /sfx add
+type soundEffect struct {
+	File     string        `json:"file"` // Name of the audio file in the server's sfx directory
+	Duration time.Duration `json:"duration"`
+	AddedBy  string        `json:"added_by"`
+}
+
+// sfxPath returns where a server's sound effect file is kept
+func (b *Bot) sfxPath(guildID, file string) string {
+	return filepath.Join(b.config().CacheDir, sfxDir, guildID, file)
+}
+
+// handleSfx handles the sfx command
+func (b *Bot) handleSfx(ctx context.Context, r responder, i *discordgo.InteractionCreate) error {
+	if b.soundboard == nil {
+		return i18n.Error("sfx.unavailable")
+	}
+	subCmd, err := subcommand(i.ApplicationCommandData().Options)
+	if err != nil {
+		return err
+	}
+
+	switch subCmd.Name {
+	case "add":
+		return b.sfxAdd(ctx, r, i, subCmd.Options)
+	case "list":
+		b.respondEmbed(r, i, announcement, b.sfxListEmbed(i))
+		return nil
+	case "play":
+		return b.sfxPlay(r, i, subCmd.Options)
+	case "remove":
+		if !b.IsDJ(i.GuildID, i.Member) {
+			return i18n.Error("sfx.djs_only")
+		}
+		name, ok := getStringOption(subCmd.Options, "name")
+		if !ok {
+			return missingOption("name")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		var removed soundEffect
+		err := b.soundboard.Update(i.GuildID, func(effects map[string]soundEffect, _ bool) (map[string]soundEffect, error) {
+			effect, ok := effects[name]
+			if !ok {
+				return nil, i18n.Error("sfx.not_found", "name", name)
+			}
+			removed = effect
+			// Get hands out the stored map, so it is copied rather than changed in place
+			effects = maps.Clone(effects)
+			delete(effects, name)
+			return effects, nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(b.sfxPath(i.GuildID, removed.File)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Warn("Failed to delete a sound effect's file", "guild", i.GuildID, "name", name, "err", err)
+		}
+		b.respond(r, i, confirmation, b.t(i, "sfx.removed", "name", name))
+		return nil
+	default:
+		return i18n.Error("error.unknown_subcommand")
+	}
+}
+
+// sfxAdd saves an uploaded clip as one of the server's sound effects
+func (b *Bot) sfxAdd(ctx context.Context, r responder, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) error {
+	if !b.IsDJ(i.GuildID, i.Member) {
+		return i18n.Error("sfx.djs_only")
+	}
+	name, ok := getStringOption(options, "name")
+	if !ok {
+		return missingOption("name")
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !sfxName.MatchString(name) {
+		return i18n.Error("sfx.invalid_name")
+	}
+	attachment, ok := getAttachmentOption(i.ApplicationCommandData(), options, "file")
+	if !ok {
+		return missingOption("file")
+	}
+	if attachment.Size > sfxMaxSize {
+		return i18n.Error("sfx.too_big", "size", sfxMaxSize>>20)
+	}
+	if effects, _ := b.soundboard.Get(i.GuildID); effects[name].File != "" {
+		return i18n.Error("sfx.exists", "name", name)
+	}
+
+	b.deferResponse(r, i, confirmation)
+
+	file := name + sfxExtension(attachment.Filename)
+	path := b.sfxPath(i.GuildID, file)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create sound effect directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := downloadAttachment(ctx, b.Session.Client, attachment.URL, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	duration, err := cache.ProbeDuration(tmp)
+	if err != nil {
+		os.Remove(tmp)
+		logger.Debug("Rejected a sound effect ffprobe can't read", "guild", i.GuildID, "name", name, "err", err)
+		return i18n.Error("sfx.unreadable")
+	}
+	if duration > player.MaxClipDuration {
+		os.Remove(tmp)
+		return i18n.Error("sfx.too_long", "limit", formatDuration(player.MaxClipDuration))
+	}
+
+	effect := soundEffect{File: file, Duration: duration, AddedBy: i.Member.User.ID}
+	err = b.soundboard.Update(i.GuildID, func(effects map[string]soundEffect, _ bool) (map[string]soundEffect, error) {
+		if _, ok := effects[name]; ok {
+			return nil, i18n.Error("sfx.exists", "name", name)
+		}
+		if len(effects) >= sfxLimit {
+			return nil, i18n.Error("sfx.full", "limit", sfxLimit)
+		}
+		effects = maps.Clone(effects)
+		if effects == nil {
+			effects = make(map[string]soundEffect)
+		}
+		effects[name] = effect
+		return effects, nil
+	})
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	b.respond(r, i, confirmation, b.t(i, "sfx.added", "name", name, "duration", formatDuration(duration)))
+	return nil
+}
+
+// sfxPlay plays one of the server's sound effects in the invoker's voice channel, over
+// whatever is playing; if the bot joined only for it, it leaves again shortly after
+func (b *Bot) sfxPlay(r responder, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) error {
+	name, ok := getStringOption(options, "name")
+	if !ok {
+		return missingOption("name")
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	effects, _ := b.soundboard.Get(i.GuildID)
+	effect, ok := effects[name]
+	if !ok {
+		return i18n.Error("sfx.not_found", "name", name)
+	}
+	if err := b.quietHoursRefusal(i, false); err != nil {
+		return err
+	}
+
+	idle := !b.PlayerManager.GetPlayer(i.GuildID).IsLoopRunning()
+	p, err := b.joinInvoker(i)
+	if err != nil {
+		return err
+	}
+	if p.ClipBusy() {
+		return i18n.Error("sfx.busy")
+	}
+
+	b.respond(r, i, confirmation, b.t(i, "sfx.playing", "name", name))
+
+	// Clips play for up to player.MaxClipDuration, longer than a command should take
+	go func() {
+		if err := p.PlayClip(b.sfxPath(i.GuildID, effect.File)); err != nil {
+			logger.Warn("Failed to play a sound effect", "guild", i.GuildID, "name", name, "err", err)
+		}
+		if idle {
+			time.AfterFunc(sfxLeaveDelay, func() {
+				if !p.IsLoopRunning() && !p.ClipBusy() {
+					p.Disconnect()
+				}
+			})
+		}
+	}()
+	return nil
+}
+
+// sfxListEmbed lists the server's sound effects by name
+func (b *Bot) sfxListEmbed(i *discordgo.InteractionCreate) *discordgo.MessageEmbed {
+	locale := b.locale(i)
+	effects, _ := b.soundboard.Get(i.GuildID)
+	if len(effects) == 0 {
+		return &discordgo.MessageEmbed{
+			Title:       i18n.T(locale, "sfx.title"),
+			Description: i18n.T(locale, "sfx.none"),
+			Color:       0x0099ff,
+		}
+	}
+
+	names := make([]string, 0, len(effects))
+	for name := range effects {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var builder strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&builder, "`%s` (%s)\n", name, formatDuration(effects[name].Duration))
+	}
+	return &discordgo.MessageEmbed{
+		Title:       i18n.T(locale, "sfx.title"),
+		Description: builder.String(),
+		Color:       0x0099ff,
+		Footer:      &discordgo.MessageEmbedFooter{Text: i18n.T(locale, "sfx.footer", "count", len(effects), "limit", sfxLimit)},
+	}
+}
+
+// sfxExtensions are the extensions an uploaded sound effect keeps; ffmpeg picks its demuxer
+// partly from the name, so anything else, like a playlist, mustn't reach it
+var sfxExtensions = map[string]bool{
+	".aac": true, ".flac": true, ".m4a": true, ".mp3": true, ".oga": true,
+	".ogg": true, ".opus": true, ".wav": true, ".weba": true, ".webm": true,
+}
+
+// sfxExtension returns the extension an uploaded file is saved with: its own if it's a known
+// audio format, so ffmpeg can tell formats apart that it can't detect
+func sfxExtension(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if !sfxExtensions[ext] {
+		return ".audio"
+	}
+	return ext
+}
+
+// downloadAttachment saves an uploaded file at path, refusing files over sfxMaxSize
+func downloadAttachment(ctx context.Context, client *http.Client, url, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, sfxDownloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to download the file: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download the file: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download the file: %s", resp.Status)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to save the file: %w", err)
+	}
+	defer file.Close()
+	n, err := io.Copy(file, io.LimitReader(resp.Body, sfxMaxSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to download the file: %w", err)
+	}
+	if n > sfxMaxSize {
+		return i18n.Error("sfx.too_big", "size", sfxMaxSize>>20)
+	}
+	return file.Close()
+}
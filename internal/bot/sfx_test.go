@@ -0,0 +1,51 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSfxExtension(t *testing.T) {
+	tests := map[string]string{
+		"airhorn.OGG":      ".ogg",
+		"clip.mp3":         ".mp3",
+		"noextension":      ".audio",
+		"weird.m p3":       ".audio",
+		"long.extension12": ".audio",
+		"../../etc.wav":    ".wav",
+		"list.m3u8":        ".audio",
+		"notes.txt":        ".audio",
+	}
+	for filename, want := range tests {
+		if got := sfxExtension(filename); got != want {
+			t.Errorf("sfxExtension(%q) = %q, want %q", filename, got, want)
+		}
+	}
+}
+
+func TestDownloadAttachmentLimitsSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/big" {
+			w.Write([]byte(strings.Repeat("x", sfxMaxSize+1)))
+			return
+		}
+		w.Write([]byte("audio"))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "clip.ogg")
+	if err := downloadAttachment(context.Background(), server.Client(), server.URL+"/small", path); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "audio" {
+		t.Errorf("saved %q, want the file", data)
+	}
+	if err := downloadAttachment(context.Background(), server.Client(), server.URL+"/big", path); err == nil {
+		t.Error("downloadAttachment saved a file over sfxMaxSize")
+	}
+}
@@ -1,29 +1,131 @@
 package cache
 
 import (
+	"cmp"
+	"container/heap"
+	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
 )
 
 // Cache manages cached audio files
 type Cache struct {
 	dir     string
 	maxSize int64
+	minFree int64 // Free space kept on the cache's filesystem, 0 for no reserve
 	mu      sync.RWMutex
 	entries map[string]*CacheEntry
+	pins    map[string]int // Entries being played, by key, with how many holders each
+
+	downloads map[string]*download // GetOrCreate creations in progress, by key
+	tempSeq   int                  // Makes each file name in downloadDir unique
+
+	indexMu    sync.Mutex
+	indexTimer *time.Timer // Pending index write, nil if the index is up to date
+
+	counters counters
+}
+
+// counters track how well the cache is doing since startup
+type counters struct {
+	hits, misses       atomic.Int64
+	bytesServed        atomic.Int64
+	downloadsStarted   atomic.Int64
+	downloadsCompleted atomic.Int64
+	downloadsFailed    atomic.Int64
+	evictions          atomic.Int64
+}
+
+// Stats is a snapshot of the cache's usage and counters since startup
+type Stats struct {
+	Entries int
+	Size    int64 // Bytes used, including artifacts
+	MaxSize int64
+
+	Hits        int64 // Get calls that found the entry
+	Misses      int64 // Get calls that didn't
+	BytesServed int64 // Size of the files Get returned
+
+	DownloadsStarted   int64
+	DownloadsCompleted int64
+	DownloadsFailed    int64 // Including cancelled and oversized downloads
+	Evictions          int64 // Entries evicted to make room
+
+	FreeSpace int64 // Bytes free on the cache's filesystem, -1 if unknown
+	MinFree   int64
+}
+
+// HitRatio returns the fraction of Get calls that found their entry, 0 if there were none
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
 }
 
 // CacheEntry represents a cached file
+// Everything but Path, Size and Artifacts is kept in the index, so it survives restarts
 type CacheEntry struct {
-	Path         string
-	Size         int64
-	LastAccessed time.Time
-	URL          string
+	Path           string
+	Size           int64 // includes artifacts
+	LastAccessed   time.Time
+	URL            string
+	Title          string
+	Artist         string
+	Duration       time.Duration
+	CreatedAt      time.Time
+	PlayCount      int           // Times the entry was played from the cache
+	ProbedDuration time.Duration // The file's own duration once Verify has read it, unknownDuration if it has none
+	Artifacts      []string      // derived files stored and evicted together with Path
+
+	damaged bool // Verify found the file damaged while it was pinned; removed once unpinned
+}
+
+// ErrTooLarge is returned when a created file is over the per-file size limit
+var ErrTooLarge = errors.New("file is too large to cache")
+
+// ErrEmpty is returned when a created file has nothing in it
+var ErrEmpty = errors.New("created file is empty")
+
+// ErrNoSpace is returned when the cache's filesystem is below its free space reserve even
+// after evicting
+var ErrNoSpace = errors.New("not enough free disk space to cache")
+
+// diskFree reports the free space on a filesystem; tests swap it
+var diskFree = freeSpace
+
+// FreeSpace returns the bytes available on dir's filesystem, or errors.ErrUnsupported on
+// systems where it can't be read
+func FreeSpace(dir string) (int64, error) {
+	return freeSpace(dir)
+}
+
+// maxFileShare is the largest fraction of the cache a single file may take, so one long
+// video can't push out everything else
+const maxFileShare = 4
+
+// artifactTempSuffix marks artifacts that are still being written
+const artifactTempSuffix = ".tmp"
+
+// downloadDir holds files GetOrCreate is still creating, relative to the cache directory
+// Anything left in it is from an interrupted run and is removed at startup
+const downloadDir = "downloading"
+
+// isPartialDownload reports whether name is one of the files yt-dlp writes while downloading:
+// "<output>.part", fragments like "<output>.part-Frag3", and "<output>.ytdl"
+func isPartialDownload(name string) bool {
+	return strings.HasSuffix(name, ".ytdl") || strings.Contains(name, ".part")
 }
 
 // NewCache creates a new cache manager
@@ -36,6 +138,17 @@ func NewCache(dir string, maxSize int64) (*Cache, error) {
 		dir:     dir,
 		maxSize: maxSize,
 		entries: make(map[string]*CacheEntry),
+		pins:    make(map[string]int),
+
+		downloads: make(map[string]*download),
+	}
+
+	downloads := filepath.Join(dir, downloadDir)
+	if err := os.RemoveAll(downloads); err != nil {
+		return nil, fmt.Errorf("failed to clear interrupted downloads: %w", err)
+	}
+	if err := os.MkdirAll(downloads, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
 	}
 
 	// Load existing cache entries
@@ -54,7 +167,10 @@ func (c *Cache) loadEntries() error {
 	}
 
 	var totalSize int64
+	var owner *CacheEntry
+	var ownerKey string
 
+	// ReadDir sorts by name, so artifacts (key + suffix) follow the entry they belong to
 	for _, file := range files {
 		if file.IsDir() {
 			continue
@@ -65,48 +181,180 @@ func (c *Cache) loadEntries() error {
 			continue
 		}
 
-		path := filepath.Join(c.dir, file.Name())
-		c.entries[file.Name()] = &CacheEntry{
+		name := file.Name()
+		path := filepath.Join(c.dir, name)
+
+		// Leftover from an interrupted artifact build or download, or a download that
+		// failed when the disk was full
+		if strings.HasSuffix(name, artifactTempSuffix) || isPartialDownload(name) || info.Size() == 0 {
+			os.Remove(path)
+			continue
+		}
+
+		totalSize += info.Size()
+
+		if owner != nil && strings.HasPrefix(name, ownerKey+".") {
+			owner.Artifacts = append(owner.Artifacts, path)
+			owner.Size += info.Size()
+			continue
+		}
+
+		owner = &CacheEntry{
 			Path:         path,
 			Size:         info.Size(),
 			LastAccessed: info.ModTime(),
 		}
-
-		totalSize += info.Size()
+		ownerKey = name
+		c.entries[name] = owner
 	}
 
+	c.applyIndex(c.readIndex())
+
 	// Evict old entries if cache is too large
 	if totalSize > c.maxSize {
 		c.evict(totalSize - c.maxSize)
 	}
 
+	// Rewrite the index so it matches the files on disk
+	c.saveIndex()
+
 	return nil
 }
 
-// Get gets a cached file path if it exists
+// Get gets a cached file path to play if it exists, counting the play in the index
 func (c *Cache) Get(key string) (string, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	entry, exists := c.entries[key]
+	entry, exists := c.present(key)
 	if !exists {
+		c.counters.misses.Add(1)
 		return "", false
 	}
 
-	// Update access time
+	c.counters.hits.Add(1)
+	c.counters.bytesServed.Add(entry.Size)
 	entry.LastAccessed = time.Now()
+	entry.PlayCount++
+	c.saveIndex()
+
+	return entry.Path, true
+}
+
+// Contains reports whether a key is cached without counting it as played
+func (c *Cache) Contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, exists := c.present(key)
+	return exists
+}
+
+// Lookup returns a copy of a cached entry's metadata
+func (c *Cache) Lookup(key string) (*CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.present(key)
+	if !exists {
+		return nil, false
+	}
+	copied := *entry
+	copied.Artifacts = slices.Clone(entry.Artifacts)
+	return &copied, true
+}
+
+// present returns an entry if its file is still on disk, forgetting it otherwise; the
+// caller must hold c.mu
+func (c *Cache) present(key string) (*CacheEntry, bool) {
+	entry, exists := c.entries[key]
+	if !exists || entry.damaged {
+		return nil, false
+	}
 
-	// Verify file still exists
 	if _, err := os.Stat(entry.Path); os.IsNotExist(err) {
-		delete(c.entries, key)
-		return "", false
+		c.removeEntry(key, entry)
+		c.saveIndex()
+		return nil, false
 	}
+	return entry, true
+}
 
-	return entry.Path, true
+// newEntry creates an entry for a file just added to the cache
+func newEntry(path string, size int64, meta Metadata) *CacheEntry {
+	now := time.Now()
+	return &CacheEntry{
+		Path:         path,
+		Size:         size,
+		LastAccessed: now,
+		URL:          meta.URL,
+		Title:        meta.Title,
+		Artist:       meta.Artist,
+		Duration:     meta.Duration,
+		CreatedAt:    now,
+	}
+}
+
+// SetMinFree sets how much space to keep free on the cache's filesystem, which may be
+// shared with other programs; downloads evict entries to keep it, or are refused
+func (c *Cache) SetMinFree(bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.minFree = bytes
+}
+
+// ensureSpace evicts entries until the filesystem has minFree bytes free, returning
+// ErrNoSpace if it can't
+// Filesystems whose free space can't be read are assumed to have room
+func (c *Cache) ensureSpace() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.minFree <= 0 {
+		return nil
+	}
+	free, err := diskFree(c.dir)
+	if err != nil {
+		if !errors.Is(err, errors.ErrUnsupported) {
+			logger.Debug("Couldn't read free disk space", "dir", c.dir, "err", err)
+		}
+		return nil
+	}
+	if free >= c.minFree {
+		return nil
+	}
+
+	c.evict(c.minFree - free)
+	if free, err = diskFree(c.dir); err == nil && free < c.minFree {
+		return fmt.Errorf("%w: %d MB free, keeping %d MB", ErrNoSpace, free>>20, c.minFree>>20)
+	}
+	return nil
+}
+
+// SetLimit changes the cache's size limit, evicting entries right away if it shrank
+func (c *Cache) SetLimit(maxSize int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.maxSize = maxSize
+	if size := c.getCurrentSize(); size > maxSize {
+		c.evict(size - maxSize)
+	}
+}
+
+// MaxFileSize returns the largest file the cache accepts
+func (c *Cache) MaxFileSize() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.maxSize / maxFileShare
 }
 
-// Set adds a file to the cache
-func (c *Cache) Set(key, sourcePath string, size int64) error {
+// Set adds a file to the cache; files over MaxFileSize are rejected with ErrTooLarge
+func (c *Cache) Set(key, sourcePath string, size int64, meta Metadata) error {
+	if size > c.MaxFileSize() {
+		return fmt.Errorf("%w: %d MB", ErrTooLarge, size>>20)
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -118,53 +366,152 @@ func (c *Cache) Set(key, sourcePath string, size int64) error {
 
 	destPath := filepath.Join(c.dir, key)
 
-	// Copy file to cache
-	if err := copyFile(sourcePath, destPath); err != nil {
+	// Copy file to cache, renaming it into place so Get never sees half of it
+	c.tempSeq++
+	tempPath := filepath.Join(c.dir, downloadDir, fmt.Sprintf("%d-%s", c.tempSeq, key))
+	if err := copyFile(sourcePath, tempPath); err != nil {
+		os.Remove(tempPath)
 		return fmt.Errorf("failed to copy file to cache: %w", err)
 	}
-
-	c.entries[key] = &CacheEntry{
-		Path:         destPath,
-		Size:         size,
-		LastAccessed: time.Now(),
+	if err := os.Rename(tempPath, destPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to copy file to cache: %w", err)
 	}
 
+	c.entries[key] = newEntry(destPath, size, meta)
+	c.saveIndex()
+
 	return nil
 }
 
+// download is a GetOrCreate creation shared by every caller asking for the same key
+type download struct {
+	done     chan struct{} // closed once path and err are set
+	path     string
+	err      error
+	tempPath string             // where the file is created, read by Followers
+	waiters  int                // callers still waiting; the creation is cancelled when none are left
+	cancel   context.CancelFunc // cancels the creation
+}
+
 // GetOrCreate gets a cached file or creates it using the provided function
-func (c *Cache) GetOrCreate(key string, create func(path string) error) (string, error) {
-	// Check if already cached
-	if path, exists := c.Get(key); exists {
-		return path, nil
+// A created file over MaxFileSize is deleted and ErrTooLarge returned
+// Concurrent calls for the same key share one creation. Cancelling ctx stops waiting; the
+// creation itself is only cancelled once every caller waiting for it has given up, and a
+// file that was fully created is registered regardless
+// The file is created in downloadDir and renamed into place, so an interrupted creation
+// never leaves a partial file that Get would serve
+func (c *Cache) GetOrCreate(ctx context.Context, key string, meta Metadata, create func(ctx context.Context, path string) error) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	// Check if already cached; this isn't a play, so it isn't counted as one
+	if entry, exists := c.present(key); exists {
+		c.mu.Unlock()
+		return entry.Path, nil
+	}
+	d, running := c.downloads[key]
+	if !running {
+		downloadCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c.tempSeq++
+		// The key stays at the end of the name, as yt-dlp expects the real file extension
+		tempPath := filepath.Join(c.dir, downloadDir, fmt.Sprintf("%d-%s", c.tempSeq, key))
+		d = &download{done: make(chan struct{}), tempPath: tempPath, cancel: cancel}
+		c.downloads[key] = d
+		go c.runDownload(downloadCtx, key, d, meta, create)
+	}
+	d.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-d.done:
+		return d.path, d.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		d.waiters--
+		if d.waiters == 0 && c.downloads[key] == d {
+			// Nobody wants the file any more; a later call starts a fresh creation
+			d.cancel()
+			delete(c.downloads, key)
+		}
+		c.mu.Unlock()
+		return "", ctx.Err()
+	}
+}
+
+// runDownload creates a file for GetOrCreate under a temporary name, then registers it
+// The creation runs WITHOUT holding the lock, so other cache operations proceed meanwhile
+func (c *Cache) runDownload(ctx context.Context, key string, d *download, meta Metadata, create func(ctx context.Context, path string) error) {
+	defer d.cancel()
+	defer close(d.done)
+
+	if err := c.ensureSpace(); err != nil {
+		c.mu.Lock()
+		d.err = err
+		if c.downloads[key] == d {
+			delete(c.downloads, key)
+		}
+		c.mu.Unlock()
+		return
 	}
+	c.counters.downloadsStarted.Add(1)
 
 	destPath := filepath.Join(c.dir, key)
+	path, err := c.createFile(ctx, key, destPath, d.tempPath, meta, create)
+	if err != nil {
+		c.counters.downloadsFailed.Add(1)
+	} else {
+		c.counters.downloadsCompleted.Add(1)
+	}
+
+	c.mu.Lock()
+	d.path, d.err = path, err
+	if c.downloads[key] == d {
+		delete(c.downloads, key)
+	}
+	c.mu.Unlock()
+}
 
-	// Create the file WITHOUT holding the lock
-	// This allows other cache operations to proceed during download
-	if err := create(destPath); err != nil {
+// createFile runs create on tempPath and moves the result to destPath as key's entry
+func (c *Cache) createFile(ctx context.Context, key, destPath, tempPath string, meta Metadata, create func(ctx context.Context, path string) error) (string, error) {
+	if err := create(ctx, tempPath); err != nil {
+		os.Remove(tempPath)
 		return "", fmt.Errorf("failed to create cached file: %w", err)
 	}
 
-	// Get file size
-	info, err := os.Stat(destPath)
+	info, err := os.Stat(tempPath)
 	if err != nil {
-		os.Remove(destPath)
+		os.Remove(tempPath)
 		return "", fmt.Errorf("failed to stat created file: %w", err)
 	}
-
 	size := info.Size()
+	if size == 0 {
+		os.Remove(tempPath)
+		return "", ErrEmpty
+	}
+	if size > c.MaxFileSize() {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("%w: %d MB", ErrTooLarge, size>>20)
+	}
 
-	// NOW acquire lock only for registration
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// Check if another goroutine already created this entry while we were downloading
-	if entry, exists := c.entries[key]; exists {
-		// Remove our duplicate download
-		os.Remove(destPath)
+	// A cancelled creation that was started again may have finished first
+	if entry, exists := c.entries[key]; exists && !entry.damaged {
+		os.Remove(tempPath)
 		return entry.Path, nil
+	} else if exists {
+		// Replacing a damaged file that is still being played; the player keeps reading
+		// the removed file
+		c.removeEntry(key, entry)
+	}
+
+	if err := os.Rename(tempPath, destPath); err != nil {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("failed to store cached file: %w", err)
 	}
 
 	// Evict if necessary
@@ -173,48 +520,183 @@ func (c *Cache) GetOrCreate(key string, create func(path string) error) (string,
 		c.evict(currentSize + size - c.maxSize)
 	}
 
-	c.entries[key] = &CacheEntry{
-		Path:         destPath,
-		Size:         size,
-		LastAccessed: time.Now(),
+	c.entries[key] = newEntry(destPath, size, meta)
+	c.saveIndex()
+
+	return destPath, nil
+}
+
+// GetArtifact gets the path of a file derived from a cached entry, if it exists
+func (c *Cache) GetArtifact(key, suffix string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, exists := c.entries[key]
+	if !exists {
+		return "", false
 	}
 
+	path := filepath.Join(c.dir, key+suffix)
+	if !slices.Contains(entry.Artifacts, path) {
+		return "", false
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", false
+	}
+
+	return path, true
+}
+
+// CreateArtifact creates a file derived from a cached entry using the provided function
+// The artifact is stored as key+suffix and evicted together with its entry
+func (c *Cache) CreateArtifact(key, suffix string, create func(path string) error) (string, error) {
+	c.mu.RLock()
+	_, exists := c.entries[key]
+	c.mu.RUnlock()
+	if !exists {
+		return "", fmt.Errorf("%s is not cached", key)
+	}
+
+	destPath := filepath.Join(c.dir, key+suffix)
+	tempPath := destPath + artifactTempSuffix
+
+	// Build the artifact WITHOUT holding the lock
+	if err := create(tempPath); err != nil {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("failed to create artifact: %w", err)
+	}
+
+	info, err := os.Stat(tempPath)
+	if err != nil {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("failed to stat created artifact: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The entry may have been evicted while the artifact was being built
+	entry, exists := c.entries[key]
+	if !exists {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("%s was evicted", key)
+	}
+
+	if slices.Contains(entry.Artifacts, destPath) {
+		os.Remove(tempPath)
+		return destPath, nil
+	}
+
+	if err := os.Rename(tempPath, destPath); err != nil {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("failed to store artifact: %w", err)
+	}
+
+	// Evict if necessary
+	currentSize := c.getCurrentSize()
+	if currentSize+info.Size() > c.maxSize {
+		c.evict(currentSize + info.Size() - c.maxSize)
+	}
+
+	if _, exists := c.entries[key]; !exists {
+		// Evicted to make room; drop the artifact with it
+		os.Remove(destPath)
+		return "", fmt.Errorf("%s was evicted", key)
+	}
+
+	entry.Artifacts = append(entry.Artifacts, destPath)
+	entry.Size += info.Size()
+	c.saveIndex()
+
 	return destPath, nil
 }
 
-// evict removes old cache entries to free up space
-func (c *Cache) evict(targetSize int64) {
-	// Sort entries by last accessed time
-	type entrySort struct {
-		key   string
-		entry *CacheEntry
+// removeEntry deletes an entry's file and its artifacts; the caller must hold c.mu
+func (c *Cache) removeEntry(key string, entry *CacheEntry) {
+	os.Remove(entry.Path)
+	for _, artifact := range entry.Artifacts {
+		os.Remove(artifact)
 	}
+	delete(c.entries, key)
+}
 
-	entries := make([]entrySort, 0, len(c.entries))
-	for key, entry := range c.entries {
-		entries = append(entries, entrySort{key, entry})
+// Pin keeps an entry from being evicted while it is read, e.g. during playback
+// Pins are counted, so every Pin needs a matching Unpin
+func (c *Cache) Pin(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pins[key]++
+}
+
+// Unpin releases a pin taken with Pin, removing the entry if Verify found it damaged
+// while it was pinned
+func (c *Cache) Unpin(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pins[key] > 1 {
+		c.pins[key]--
+		return
 	}
+	delete(c.pins, key)
+	if entry, exists := c.entries[key]; exists && entry.damaged {
+		logger.Info("Removing damaged cache entry no longer in use", "key", key, "title", entry.Title)
+		c.removeEntry(key, entry)
+		c.saveIndex()
+	}
+}
 
-	// Sort by last accessed (oldest first)
-	for i := 0; i < len(entries)-1; i++ {
-		for j := i + 1; j < len(entries); j++ {
-			if entries[i].entry.LastAccessed.After(entries[j].entry.LastAccessed) {
-				entries[i], entries[j] = entries[j], entries[i]
-			}
-		}
+// evictionItem is an entry waiting in an evictionQueue
+type evictionItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// evictionQueue is a min-heap of entries by last access, so the least recently played
+// entry is evicted first
+type evictionQueue []evictionItem
+
+func (q evictionQueue) Len() int { return len(q) }
+func (q evictionQueue) Less(i, j int) bool {
+	return q[i].entry.LastAccessed.Before(q[j].entry.LastAccessed)
+}
+func (q evictionQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *evictionQueue) Push(x any)   { *q = append(*q, x.(evictionItem)) }
+func (q *evictionQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// evict removes the least recently played entries until targetSize bytes are freed; the
+// caller must hold c.mu
+// Pinned entries are skipped, so the cache can stay over its limit while they are in use
+func (c *Cache) evict(targetSize int64) {
+	queue := make(evictionQueue, 0, len(c.entries))
+	for key, entry := range c.entries {
+		queue = append(queue, evictionItem{key, entry})
 	}
+	heap.Init(&queue)
 
 	var freedSize int64
-	for _, e := range entries {
-		if freedSize >= targetSize {
-			break
+	pinned := 0
+	for freedSize < targetSize && queue.Len() > 0 {
+		item := heap.Pop(&queue).(evictionItem)
+		if c.pins[item.key] > 0 {
+			pinned++
+			continue
 		}
 
-		// Delete file
-		os.Remove(e.entry.Path)
-		freedSize += e.entry.Size
-		delete(c.entries, e.key)
+		// Delete file and its artifacts
+		freedSize += item.entry.Size
+		c.removeEntry(item.key, item.entry)
+		c.counters.evictions.Add(1)
+	}
+	if freedSize < targetSize && pinned > 0 {
+		logger.Warn("Cache stays over its limit while entries are in use", "pinned", pinned, "over_bytes", targetSize-freedSize)
 	}
+	c.saveIndex()
 }
 
 // getCurrentSize returns the current total cache size
@@ -226,17 +708,115 @@ func (c *Cache) getCurrentSize() int64 {
 	return total
 }
 
-// Clear removes all cache entries
-func (c *Cache) Clear() error {
+// Clear removes every entry that isn't pinned by playback, returning how many entries were
+// removed and how many bytes that freed
+func (c *Cache) Clear() (int, int64) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	removed := 0
+	var freed int64
 	for key, entry := range c.entries {
-		os.Remove(entry.Path)
-		delete(c.entries, key)
+		if c.pins[key] > 0 {
+			continue
+		}
+		removed++
+		freed += entry.Size
+		c.removeEntry(key, entry)
 	}
+	c.saveIndex()
 
-	return nil
+	return removed, freed
+}
+
+// janitorInterval is how often the janitor prunes the cache
+const janitorInterval = time.Hour
+
+// Prune removes entries not played for longer than olderThan (0 keeps them all) and files
+// in the cache directory that belong to no entry, returning how many files were removed and
+// how many bytes that freed
+// Pinned entries are kept however old they are
+func (c *Cache) Prune(olderThan time.Duration) (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	var freed int64
+
+	if olderThan > 0 {
+		cutoff := time.Now().Add(-olderThan)
+		for key, entry := range c.entries {
+			if c.pins[key] > 0 || !entry.LastAccessed.Before(cutoff) {
+				continue
+			}
+			removed += 1 + len(entry.Artifacts)
+			freed += entry.Size
+			c.removeEntry(key, entry)
+		}
+	}
+
+	// Files nobody tracks, e.g. left behind by a failed removal
+	known := make(map[string]bool)
+	for _, entry := range c.entries {
+		known[entry.Path] = true
+		for _, artifact := range entry.Artifacts {
+			known[artifact] = true
+		}
+	}
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		logger.Warn("Failed to read cache directory for pruning", "err", err)
+	}
+	for _, file := range files {
+		// Subdirectories hold downloads in progress and other stores; .tmp files are
+		// artifacts being built and are cleaned up at startup
+		if file.IsDir() || strings.HasSuffix(file.Name(), artifactTempSuffix) {
+			continue
+		}
+		path := filepath.Join(c.dir, file.Name())
+		if known[path] {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			removed++
+			freed += info.Size()
+		}
+	}
+
+	if removed > 0 {
+		c.saveIndex()
+	}
+	return removed, freed
+}
+
+// StartJanitor prunes entries not played for longer than maxAge, and untracked files, every
+// hour until the returned function is called
+// A maxAge of 0 disables it altogether; /cache prune still removes untracked files on demand
+func (c *Cache) StartJanitor(maxAge time.Duration) (stop func()) {
+	if maxAge <= 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(janitorInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if removed, freed := c.Prune(maxAge); removed > 0 {
+					logger.Info("Pruned cache", "files", removed, "freed_mb", freed>>20)
+				}
+			}
+		}
+	}()
+	return cancel
 }
 
 // GenerateKey generates a cache key from a URL
@@ -273,3 +853,44 @@ func (c *Cache) GetStats() (int, int64, int64) {
 	size := c.getCurrentSize()
 	return count, size, c.maxSize
 }
+
+// DetailedStats returns the cache's usage and its counters since startup
+func (c *Cache) DetailedStats() Stats {
+	free, err := diskFree(c.dir)
+	if err != nil {
+		free = -1
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return Stats{
+		Entries:            len(c.entries),
+		Size:               c.getCurrentSize(),
+		MaxSize:            c.maxSize,
+		Hits:               c.counters.hits.Load(),
+		Misses:             c.counters.misses.Load(),
+		BytesServed:        c.counters.bytesServed.Load(),
+		DownloadsStarted:   c.counters.downloadsStarted.Load(),
+		DownloadsCompleted: c.counters.downloadsCompleted.Load(),
+		DownloadsFailed:    c.counters.downloadsFailed.Load(),
+		Evictions:          c.counters.evictions.Load(),
+		FreeSpace:          free,
+		MinFree:            c.minFree,
+	}
+}
+
+// Largest returns copies of the n largest entries, largest first
+func (c *Cache) Largest(n int) []CacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entries := make([]CacheEntry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		copied := *entry
+		copied.Artifacts = slices.Clone(entry.Artifacts)
+		entries = append(entries, copied)
+	}
+	slices.SortFunc(entries, func(a, b CacheEntry) int { return cmp.Compare(b.Size, a.Size) })
+	return entries[:min(n, len(entries))]
+}
@@ -0,0 +1,1011 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/tools"
+)
+
+func createFile(size int) func(path string) error {
+	return func(path string) error {
+		return os.WriteFile(path, make([]byte, size), 0644)
+	}
+}
+
+func downloadFile(size int) func(ctx context.Context, path string) error {
+	return func(ctx context.Context, path string) error {
+		return os.WriteFile(path, make([]byte, size), 0644)
+	}
+}
+
+// newCache is NewCache writing any pending index when the test ends, before its directory
+// is removed
+func newCache(t *testing.T, dir string, maxSize int64) (*Cache, error) {
+	c, err := NewCache(dir, maxSize)
+	if err == nil {
+		t.Cleanup(func() { c.Flush() })
+	}
+	return c, err
+}
+
+func TestArtifactsEvictedWithEntry(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newCache(t, dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.GetOrCreate(context.Background(), "a.webm", Metadata{}, downloadFile(250)); err != nil {
+		t.Fatal(err)
+	}
+	artifact, err := c.CreateArtifact("a.webm", ".dca", createFile(300))
+	if err != nil {
+		t.Fatalf("CreateArtifact: %v", err)
+	}
+	if path, ok := c.GetArtifact("a.webm", ".dca"); !ok || path != artifact {
+		t.Fatalf("GetArtifact = %q, %v", path, ok)
+	}
+
+	// Make a.webm the oldest entry, then add enough to force eviction
+	c.entries["a.webm"].LastAccessed = time.Now().Add(-time.Hour)
+	for _, key := range []string{"b.webm", "c.webm"} {
+		if _, err := c.GetOrCreate(context.Background(), key, Metadata{}, downloadFile(250)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, ok := c.Get("a.webm"); ok {
+		t.Error("a.webm should have been evicted")
+	}
+	for _, name := range []string{"a.webm", "a.webm.dca"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s still on disk", name)
+		}
+	}
+}
+
+func TestLoadEntriesGroupsArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.webm"), make([]byte, 100), 0644)
+	os.WriteFile(filepath.Join(dir, "a.webm.128k-20ms-2ch.dca"), make([]byte, 50), 0644)
+	os.WriteFile(filepath.Join(dir, "a.webm.dca.tmp"), make([]byte, 10), 0644)
+	os.WriteFile(filepath.Join(dir, "b.webm"), make([]byte, 100), 0644)
+
+	c, err := newCache(t, dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count, size, _ := c.GetStats(); count != 2 || size != 250 {
+		t.Errorf("got %d entries totalling %d bytes, want 2 totalling 250", count, size)
+	}
+	if _, ok := c.GetArtifact("a.webm", ".128k-20ms-2ch.dca"); !ok {
+		t.Error("artifact was not attached to its entry")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.webm.dca.tmp")); !os.IsNotExist(err) {
+		t.Error("temporary artifact was not removed")
+	}
+}
+
+func TestGetOrCreateCancelled(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newCache(t, dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	_, err = c.GetOrCreate(ctx, "a.webm", Metadata{}, func(downloadCtx context.Context, path string) error {
+		// Simulate a download that is interrupted halfway
+		if err := os.WriteFile(path, make([]byte, 100), 0644); err != nil {
+			return err
+		}
+		cancel()
+		<-downloadCtx.Done()
+		stopped <- downloadCtx.Err()
+		return downloadCtx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetOrCreate = %v, want context.Canceled", err)
+	}
+	if err := <-stopped; !errors.Is(err, context.Canceled) {
+		t.Errorf("download context = %v, want it cancelled with its only caller", err)
+	}
+	waitFor(t, func() bool {
+		entries, _ := os.ReadDir(filepath.Join(dir, downloadDir))
+		return len(entries) == 0
+	}, "partial file was left behind")
+	if _, err := os.Stat(filepath.Join(dir, "a.webm")); !os.IsNotExist(err) {
+		t.Error("partial file was moved into the cache")
+	}
+	if c.Contains("a.webm") {
+		t.Error("cancelled download was registered")
+	}
+
+	if _, err := c.GetOrCreate(ctx, "b.webm", Metadata{}, downloadFile(100)); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetOrCreate with a cancelled context = %v", err)
+	}
+}
+
+func TestGetOrCreateRegistersAfterCancel(t *testing.T) {
+	c, err := newCache(t, t.TempDir(), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A download that finishes is kept even if its track was removed meanwhile
+	ctx, cancel := context.WithCancel(context.Background())
+	c.GetOrCreate(ctx, "a.webm", Metadata{}, func(_ context.Context, path string) error {
+		defer cancel()
+		return os.WriteFile(path, make([]byte, 100), 0644)
+	})
+	waitFor(t, func() bool { return c.Contains("a.webm") }, "finished download was not registered")
+}
+
+func TestGetOrCreateSharesDownload(t *testing.T) {
+	c, err := newCache(t, t.TempDir(), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	create := func(ctx context.Context, path string) error {
+		calls.Add(1)
+		<-release
+		return os.WriteFile(path, make([]byte, 100), 0644)
+	}
+
+	// The first caller gives up; the others still get the file
+	ctx, cancel := context.WithCancel(context.Background())
+	results := make(chan error, 3)
+	for i := range 3 {
+		go func() {
+			waitCtx := context.Background()
+			if i == 0 {
+				waitCtx = ctx
+			}
+			path, err := c.GetOrCreate(waitCtx, "a.webm", Metadata{}, create)
+			if err == nil && filepath.Base(path) != "a.webm" {
+				err = fmt.Errorf("path = %q", path)
+			}
+			results <- err
+		}()
+	}
+	waitFor(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		d := c.downloads["a.webm"]
+		return d != nil && d.waiters == 3
+	}, "callers didn't join the same download")
+	cancel()
+	close(release)
+
+	cancelled := 0
+	for range 3 {
+		if err := <-results; errors.Is(err, context.Canceled) {
+			cancelled++
+		} else if err != nil {
+			t.Error(err)
+		}
+	}
+	if cancelled != 1 {
+		t.Errorf("%d callers were cancelled, want 1", cancelled)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("create ran %d times, want 1", n)
+	}
+	if !c.Contains("a.webm") {
+		t.Error("shared download was not registered")
+	}
+}
+
+// waitFor polls cond until it holds, failing with msg after a second
+func waitFor(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLoadEntriesRemovesPartialDownloads(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.webm", "a.webm.part", "b.webm.part-Frag3", "b.webm.ytdl"} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, 10), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := newCache(t, dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count, size, _ := c.GetStats(); count != 1 || size != 10 {
+		t.Errorf("GetStats = %d entries, %d bytes; want only a.webm", count, size)
+	}
+	for _, name := range []string{"a.webm.part", "b.webm.part-Frag3", "b.webm.ytdl"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", name)
+		}
+	}
+}
+
+func TestIndexSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newCache(t, dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta := Metadata{URL: "https://www.youtube.com/watch?v=abc", Title: "Song", Artist: "Band", Duration: 3 * time.Minute}
+	if _, err := c.GetOrCreate(context.Background(), "a.webm", meta, downloadFile(100)); err != nil {
+		t.Fatal(err)
+	}
+	c.Get("a.webm")
+	c.Get("a.webm")
+	if !c.Contains("a.webm") {
+		t.Fatal("Contains = false for a cached entry")
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = newCache(t, dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := c.Lookup("a.webm")
+	if !ok {
+		t.Fatal("entry was lost on restart")
+	}
+	if entry.URL != meta.URL || entry.Title != meta.Title || entry.Artist != meta.Artist || entry.Duration != meta.Duration {
+		t.Errorf("Lookup = %+v, want metadata %+v", entry, meta)
+	}
+	if entry.PlayCount != 2 {
+		t.Errorf("PlayCount = %d, want 2 (Contains and GetOrCreate don't count)", entry.PlayCount)
+	}
+	if entry.CreatedAt.IsZero() || entry.LastAccessed.Before(entry.CreatedAt) {
+		t.Errorf("CreatedAt = %v, LastAccessed = %v", entry.CreatedAt, entry.LastAccessed)
+	}
+}
+
+func TestIndexWritesAreBatched(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newCache(t, dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"a.webm", "b.webm"} {
+		if _, err := c.GetOrCreate(context.Background(), key, Metadata{}, downloadFile(100)); err != nil {
+			t.Fatal(err)
+		}
+		c.Get(key)
+	}
+	if _, err := os.Stat(filepath.Join(dir, indexFile)); !os.IsNotExist(err) {
+		t.Errorf("index was written before the save delay: %v", err)
+	}
+
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if err != nil || !strings.Contains(string(data), `"a.webm"`) || !strings.Contains(string(data), `"b.webm"`) {
+		t.Errorf("index after Flush = %s, %v; want both entries", data, err)
+	}
+}
+
+func TestIndexRebuiltFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.webm"), make([]byte, 100), 0644)
+	os.MkdirAll(filepath.Join(dir, "index"), 0755)
+	os.WriteFile(filepath.Join(dir, indexFile), []byte("{not json"), 0644)
+
+	c, err := newCache(t, dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok := c.Lookup("a.webm"); !ok || entry.Size != 100 || entry.CreatedAt.IsZero() {
+		t.Errorf("Lookup after a damaged index = %+v, %v", entry, ok)
+	}
+
+	// Records for files that are gone are dropped
+	os.Remove(filepath.Join(dir, "a.webm"))
+	os.WriteFile(filepath.Join(dir, "b.webm"), make([]byte, 50), 0644)
+	if c, err = newCache(t, dir, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Lookup("a.webm"); ok {
+		t.Error("entry without a file was kept")
+	}
+	if count, size, _ := c.GetStats(); count != 1 || size != 50 {
+		t.Errorf("GetStats = %d entries, %d bytes; want only b.webm", count, size)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if err != nil || !strings.Contains(string(data), `"b.webm"`) || strings.Contains(string(data), `"a.webm"`) {
+		t.Errorf("index = %s, %v; want only b.webm", data, err)
+	}
+}
+
+func TestEvictionSkipsPinnedEntries(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newCache(t, dir, 800)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fill the cache with entries played four, three, two and one hours ago
+	for i, key := range []string{"a.webm", "b.webm", "c.webm", "d.webm"} {
+		if _, err := c.GetOrCreate(context.Background(), key, Metadata{}, downloadFile(200)); err != nil {
+			t.Fatal(err)
+		}
+		c.entries[key].LastAccessed = time.Now().Add(-time.Duration(4-i) * time.Hour)
+	}
+
+	// a.webm is the oldest but is playing
+	c.Pin("a.webm")
+	if _, err := c.GetOrCreate(context.Background(), "e.webm", Metadata{}, downloadFile(200)); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]bool{"a.webm": true, "b.webm": false, "c.webm": true, "d.webm": true, "e.webm": true} {
+		if got := c.Contains(key); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", key, got, want)
+		}
+	}
+
+	// Once unpinned it is evicted like any other entry
+	c.Unpin("a.webm")
+	if _, err := c.GetOrCreate(context.Background(), "f.webm", Metadata{}, downloadFile(200)); err != nil {
+		t.Fatal(err)
+	}
+	if c.Contains("a.webm") {
+		t.Error("a.webm survived eviction after Unpin")
+	}
+}
+
+func TestSetLimitEvicts(t *testing.T) {
+	c, err := newCache(t, t.TempDir(), 800)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range []string{"a.webm", "b.webm", "c.webm"} {
+		if _, err := c.GetOrCreate(context.Background(), key, Metadata{}, downloadFile(200)); err != nil {
+			t.Fatal(err)
+		}
+		c.entries[key].LastAccessed = time.Now().Add(-time.Duration(3-i) * time.Hour)
+	}
+
+	c.SetLimit(400)
+	for key, want := range map[string]bool{"a.webm": false, "b.webm": true, "c.webm": true} {
+		if got := c.Contains(key); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", key, got, want)
+		}
+	}
+	if _, _, limit := c.GetStats(); limit != 400 {
+		t.Errorf("limit = %d, want 400", limit)
+	}
+}
+
+func TestPinsAreCounted(t *testing.T) {
+	c, err := newCache(t, t.TempDir(), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Pin("a.webm")
+	c.Pin("a.webm")
+	c.Unpin("a.webm")
+	if c.pins["a.webm"] != 1 {
+		t.Errorf("pins after two Pins and an Unpin = %d, want 1", c.pins["a.webm"])
+	}
+	c.Unpin("a.webm")
+	c.Unpin("a.webm")
+	if _, ok := c.pins["a.webm"]; ok {
+		t.Error("unbalanced Unpin left a pin behind")
+	}
+}
+
+// Run with -race: Get bumps access times and play counts while other goroutines add entries
+func TestConcurrentAccess(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newCache(t, dir, 2000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetOrCreate(context.Background(), "shared.webm", Metadata{}, downloadFile(10)); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(t.TempDir(), "source")
+	if err := os.WriteFile(source, make([]byte, 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 20 {
+				key := fmt.Sprintf("%d-%d.webm", i, j)
+				switch j % 3 {
+				case 0:
+					c.Get("shared.webm")
+				case 1:
+					if err := c.Set(key, source, 10, Metadata{Title: key}); err != nil {
+						t.Error(err)
+					}
+				case 2:
+					if _, err := c.GetOrCreate(context.Background(), key, Metadata{Title: key}, downloadFile(10)); err != nil {
+						t.Error(err)
+					}
+				}
+				c.Lookup("shared.webm")
+				c.GetStats()
+			}
+		}()
+	}
+	wg.Wait()
+
+	entry, ok := c.Lookup("shared.webm")
+	if !ok {
+		t.Fatal("shared entry was evicted")
+	}
+	if want := 8 * 7; entry.PlayCount != want {
+		t.Errorf("PlayCount = %d, want %d", entry.PlayCount, want)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newCache(t, dir, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"old.webm", "playing.webm", "recent.webm"} {
+		if _, err := c.GetOrCreate(context.Background(), key, Metadata{}, downloadFile(100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.CreateArtifact("old.webm", ".dca", createFile(50)); err != nil {
+		t.Fatal(err)
+	}
+	c.entries["old.webm"].LastAccessed = time.Now().Add(-48 * time.Hour)
+	c.entries["playing.webm"].LastAccessed = time.Now().Add(-48 * time.Hour)
+	c.Pin("playing.webm")
+
+	// A file the cache doesn't track, and one still being written
+	os.WriteFile(filepath.Join(dir, "stray.webm"), make([]byte, 30), 0644)
+	os.WriteFile(filepath.Join(dir, "recent.webm.dca.tmp"), make([]byte, 5), 0644)
+
+	removed, freed := c.Prune(24 * time.Hour)
+	if removed != 3 || freed != 180 {
+		t.Errorf("Prune = %d files, %d bytes; want 3 files, 180 bytes", removed, freed)
+	}
+	for key, want := range map[string]bool{"old.webm": false, "playing.webm": true, "recent.webm": true} {
+		if got := c.Contains(key); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", key, got, want)
+		}
+	}
+	for name, want := range map[string]bool{"old.webm.dca": false, "stray.webm": false, "recent.webm.dca.tmp": true} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if got := err == nil; got != want {
+			t.Errorf("%s on disk = %v, want %v", name, got, want)
+		}
+	}
+
+	// Without an age only untracked files go
+	c.Unpin("playing.webm")
+	if removed, _ := c.Prune(0); removed != 0 || !c.Contains("playing.webm") {
+		t.Errorf("Prune(0) removed %d files", removed)
+	}
+}
+
+func TestOversizedFilesRejected(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newCache(t, dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.GetOrCreate(context.Background(), "a.webm", Metadata{}, downloadFile(300)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("GetOrCreate of a 300 byte file in a 1000 byte cache = %v, want ErrTooLarge", err)
+	}
+	source := filepath.Join(t.TempDir(), "source")
+	os.WriteFile(source, make([]byte, 300), 0644)
+	if err := c.Set("b.webm", source, 300, Metadata{}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Set of a 300 byte file = %v, want ErrTooLarge", err)
+	}
+
+	for _, name := range []string{"a.webm", "b.webm"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s was kept", name)
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, downloadDir)); len(entries) != 0 {
+		t.Errorf("%d files left in %s", len(entries), downloadDir)
+	}
+}
+
+func TestDetailedStats(t *testing.T) {
+	c, err := newCache(t, t.TempDir(), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeDiskFree(t, c, 5000)
+
+	c.Get("a.webm")
+	if _, err := c.GetOrCreate(context.Background(), "a.webm", Metadata{Title: "A"}, downloadFile(100)); err != nil {
+		t.Fatal(err)
+	}
+	c.GetOrCreate(context.Background(), "b.webm", Metadata{}, func(context.Context, string) error { return errors.New("gone") })
+	if _, err := c.GetOrCreate(context.Background(), "c.webm", Metadata{Title: "C"}, downloadFile(200)); err != nil {
+		t.Fatal(err)
+	}
+	c.Get("a.webm")
+	c.Get("a.webm")
+
+	stats := c.DetailedStats()
+	want := Stats{Entries: 2, Size: 300, MaxSize: 1000, Hits: 2, Misses: 1, BytesServed: 200, DownloadsStarted: 3, DownloadsCompleted: 2, DownloadsFailed: 1, FreeSpace: 4700}
+	if stats != want {
+		t.Errorf("DetailedStats = %+v, want %+v", stats, want)
+	}
+	if ratio := stats.HitRatio(); ratio < 0.66 || ratio > 0.67 {
+		t.Errorf("HitRatio = %v, want 2/3", ratio)
+	}
+
+	largest := c.Largest(1)
+	if len(largest) != 1 || largest[0].Title != "C" {
+		t.Errorf("Largest(1) = %+v, want c.webm", largest)
+	}
+}
+
+func TestClearKeepsPinnedEntries(t *testing.T) {
+	c, err := newCache(t, t.TempDir(), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a.webm", "b.webm"} {
+		if _, err := c.GetOrCreate(context.Background(), key, Metadata{}, downloadFile(100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.Pin("a.webm")
+	if removed, freed := c.Clear(); removed != 1 || freed != 100 {
+		t.Errorf("Clear = %d entries, %d bytes; want 1, 100", removed, freed)
+	}
+	if !c.Contains("a.webm") || c.Contains("b.webm") {
+		t.Error("Clear removed the pinned entry or kept the other one")
+	}
+}
+
+// fakeFFprobe points tools.FFprobe at a script that reports 60s for files named short*,
+// fails for files named bad*, reports no duration for files named nodur*, reports 200s
+// otherwise, and logs each call to the returned file
+func fakeFFprobe(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	path := filepath.Join(dir, "ffprobe")
+	script := `#!/bin/sh
+for last; do :; done
+echo "$last" >> ` + calls + `
+case "$(basename "$last")" in
+short*) echo 60.0 ;;
+bad*) echo "Invalid data found when processing input" >&2; exit 1 ;;
+nodur*) echo N/A ;;
+*) echo 201.3 ;;
+esac
+`
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := tools.FFprobe
+	tools.FFprobe = path
+	t.Cleanup(func() { tools.FFprobe = previous })
+	return calls
+}
+
+func TestVerify(t *testing.T) {
+	calls := fakeFFprobe(t)
+	c, err := newCache(t, t.TempDir(), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	track := Metadata{Duration: 200 * time.Second}
+	for _, key := range []string{"good.webm", "short.webm", "bad.webm"} {
+		if _, err := c.GetOrCreate(context.Background(), key, track, downloadFile(100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.Verify("good.webm"); err != nil {
+		t.Errorf("Verify(good.webm) = %v", err)
+	}
+	for _, key := range []string{"short.webm", "bad.webm"} {
+		if err := c.Verify(key); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Verify(%s) = %v, want ErrCorrupt", key, err)
+		}
+		if c.Contains(key) {
+			t.Errorf("%s was kept", key)
+		}
+	}
+
+	// The probed duration is remembered, so the file isn't probed again
+	if err := c.Verify("good.webm"); err != nil {
+		t.Errorf("second Verify(good.webm) = %v", err)
+	}
+	data, _ := os.ReadFile(calls)
+	if n := strings.Count(string(data), "good.webm"); n != 1 {
+		t.Errorf("good.webm probed %d times, want 1", n)
+	}
+}
+
+func TestVerifyKeepsPinnedEntries(t *testing.T) {
+	fakeFFprobe(t)
+	c, err := newCache(t, t.TempDir(), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetOrCreate(context.Background(), "short.webm", Metadata{Duration: 200 * time.Second}, downloadFile(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Pin("short.webm")
+	c.Pin("short.webm")
+	path := filepath.Join(c.dir, "short.webm")
+	if err := c.Verify("short.webm"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Verify = %v, want ErrCorrupt", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("a pinned entry's file was removed: %v", err)
+	}
+	if c.Contains("short.webm") {
+		t.Error("a damaged entry is still served while pinned")
+	}
+
+	// It goes once the last holder lets go
+	c.Unpin("short.webm")
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("entry removed while still pinned once: %v", err)
+	}
+	c.Unpin("short.webm")
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("damaged entry kept after being unpinned: %v", err)
+	}
+}
+
+func TestVerifyWithoutDuration(t *testing.T) {
+	calls := fakeFFprobe(t)
+	c, err := newCache(t, t.TempDir(), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetOrCreate(context.Background(), "nodur.webm", Metadata{Duration: 200 * time.Second}, downloadFile(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A readable file without a duration can't be compared with the track, but is kept and
+	// not probed again
+	if c.Probed("nodur.webm") {
+		t.Error("Probed = true before Verify")
+	}
+	for range 2 {
+		if err := c.Verify("nodur.webm"); err != nil {
+			t.Errorf("Verify = %v", err)
+		}
+	}
+	if !c.Contains("nodur.webm") || !c.Probed("nodur.webm") {
+		t.Error("entry without a duration was removed or not marked probed")
+	}
+	data, _ := os.ReadFile(calls)
+	if n := strings.Count(string(data), "nodur.webm"); n != 1 {
+		t.Errorf("nodur.webm probed %d times, want 1", n)
+	}
+}
+
+func TestVerifyWithoutFFprobe(t *testing.T) {
+	previous := tools.FFprobe
+	tools.FFprobe = filepath.Join(t.TempDir(), "missing")
+	t.Cleanup(func() { tools.FFprobe = previous })
+
+	c, err := newCache(t, t.TempDir(), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetOrCreate(context.Background(), "a.webm", Metadata{}, downloadFile(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Verify("a.webm"); err == nil || errors.Is(err, ErrCorrupt) {
+		t.Errorf("Verify = %v, want a non-corruption error", err)
+	}
+	if !c.Contains("a.webm") {
+		t.Error("entry removed because ffprobe couldn't run")
+	}
+}
+
+// fakeDiskFree makes the cache's filesystem report free bytes, less whatever the cache holds
+func fakeDiskFree(t *testing.T, c *Cache, free int64) {
+	t.Helper()
+	previous := diskFree
+	diskFree = func(string) (int64, error) { return free - c.getCurrentSize(), nil }
+	t.Cleanup(func() { diskFree = previous })
+}
+
+func TestDownloadsKeepFreeSpace(t *testing.T) {
+	c, err := newCache(t, t.TempDir(), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1000 bytes free on an empty cache, 700 of them reserved
+	fakeDiskFree(t, c, 1000)
+	c.SetMinFree(700)
+
+	for _, key := range []string{"a.webm", "b.webm"} {
+		if _, err := c.GetOrCreate(context.Background(), key, Metadata{}, downloadFile(200)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.entries["a.webm"].LastAccessed = time.Now().Add(-time.Hour)
+
+	// 600 free; the next download first evicts a.webm to get back to the reserve
+	if _, err := c.GetOrCreate(context.Background(), "c.webm", Metadata{}, downloadFile(200)); err != nil {
+		t.Fatal(err)
+	}
+	if c.Contains("a.webm") || !c.Contains("b.webm") || !c.Contains("c.webm") {
+		t.Errorf("entries = %v, want b.webm and c.webm", c.Keys())
+	}
+
+	// With the rest pinned nothing can be evicted, so the download is refused
+	c.Pin("b.webm")
+	c.Pin("c.webm")
+	c.SetMinFree(900)
+	if _, err := c.GetOrCreate(context.Background(), "d.webm", Metadata{}, downloadFile(200)); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("GetOrCreate = %v, want ErrNoSpace", err)
+	}
+	if stats := c.DetailedStats(); stats.FreeSpace != 600 || stats.MinFree != 900 {
+		t.Errorf("free space = %d keeping %d, want 600 keeping 900", stats.FreeSpace, stats.MinFree)
+	}
+}
+
+func TestEmptyDownloadsRejected(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newCache(t, dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.GetOrCreate(context.Background(), "a.webm", Metadata{}, downloadFile(0)); !errors.Is(err, ErrEmpty) {
+		t.Errorf("GetOrCreate = %v, want ErrEmpty", err)
+	}
+	if c.Contains("a.webm") {
+		t.Error("empty file was cached")
+	}
+
+	// Empty files left by an older version are dropped at startup
+	os.WriteFile(filepath.Join(dir, "b.webm"), nil, 0644)
+	c, err = newCache(t, dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Contains("b.webm") {
+		t.Error("empty file was loaded")
+	}
+}
+
+// growingDownload writes chunks to path's ".part" file one at a time as yt-dlp does, then
+// renames it into place, failing instead if fail is set
+func growingDownload(chunks [][]byte, next <-chan struct{}, fail error) func(ctx context.Context, path string) error {
+	return func(ctx context.Context, path string) error {
+		file, err := os.Create(path + ".part")
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		for _, chunk := range chunks {
+			<-next
+			if _, err := file.Write(chunk); err != nil {
+				return err
+			}
+		}
+		if fail != nil {
+			os.Remove(path + ".part")
+			return fail
+		}
+		return os.Rename(path+".part", path)
+	}
+}
+
+func TestFollowerReadsGrowingDownload(t *testing.T) {
+	c, err := newCache(t, t.TempDir(), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := make(chan struct{})
+	chunks := [][]byte{[]byte("first "), []byte("second "), []byte("third")}
+	go c.GetOrCreate(context.Background(), "a.webm", Metadata{}, growingDownload(chunks, next, nil))
+
+	reader, err := c.Follower("a.webm").Open()
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer reader.Close()
+
+	// Each chunk is released only once the previous one has been read
+	var got []byte
+	buf := make([]byte, 64)
+	for range chunks {
+		next <- struct{}{}
+		n, err := reader.Read(buf)
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		got = append(got, buf[:n]...)
+	}
+	if n, err := reader.Read(buf); n != 0 || err != io.EOF {
+		t.Errorf("Read after the download finished = %d, %v, want io.EOF", n, err)
+	}
+	if string(got) != "first second third" {
+		t.Errorf("read %q", got)
+	}
+	if !c.Contains("a.webm") {
+		t.Error("the followed download was not cached")
+	}
+
+	// Once cached, the file is read directly
+	reader, err = c.Follower("a.webm").Open()
+	if err != nil {
+		t.Fatalf("Open after caching: %v", err)
+	}
+	defer reader.Close()
+	if data, _ := io.ReadAll(reader); string(data) != "first second third" {
+		t.Errorf("read %q from the cached file", data)
+	}
+}
+
+func TestFollowerFailedDownload(t *testing.T) {
+	c, err := newCache(t, t.TempDir(), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := make(chan struct{})
+	download := growingDownload([][]byte{[]byte("partial")}, next, errors.New("connection reset"))
+	go c.GetOrCreate(context.Background(), "a.webm", Metadata{}, download)
+
+	follower := c.Follower("a.webm")
+	reader, err := follower.Open()
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer reader.Close()
+	next <- struct{}{}
+
+	data, err := io.ReadAll(reader)
+	if err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("ReadAll = %q, %v, want the download's error", data, err)
+	}
+	if !follower.Failed() {
+		t.Error("follower not marked as failed")
+	}
+	if _, err := follower.Open(); err == nil {
+		t.Error("Open succeeded after the download failed")
+	}
+}
+
+func TestFollowerFallsBackFromSlowDownload(t *testing.T) {
+	previousWarmup, previousWindow := followWarmup, followRateWindow
+	followWarmup, followRateWindow = 0, 300*time.Millisecond
+	t.Cleanup(func() { followWarmup, followRateWindow = previousWarmup, previousWindow })
+
+	c, err := newCache(t, t.TempDir(), 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The download keeps trickling in, never stalling for followStallTimeout, but a reader
+	// that wants the data faster spends most of its time waiting
+	chunks := make([][]byte, 200)
+	for i := range chunks {
+		chunks[i] = []byte("chunk")
+	}
+	next := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				select {
+				case next <- struct{}{}:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	go c.GetOrCreate(context.Background(), "a.webm", Metadata{}, growingDownload(chunks, next, nil))
+
+	follower := c.Follower("a.webm")
+	reader, err := follower.Open()
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer reader.Close()
+
+	start := time.Now()
+	_, err = io.ReadAll(reader)
+	if !errors.Is(err, ErrStalled) || !follower.Failed() {
+		t.Errorf("ReadAll = %v, want ErrStalled", err)
+	}
+	if elapsed := time.Since(start); elapsed >= followStallTimeout {
+		t.Errorf("fell back after %s, want before the %s stall timeout", elapsed, followStallTimeout)
+	}
+}
+
+func TestFollowerWithoutDownload(t *testing.T) {
+	c, err := newCache(t, t.TempDir(), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	follower := c.Follower("a.webm")
+	if _, err := follower.Open(); err == nil || !follower.Failed() {
+		t.Errorf("Open = %v, want an error", err)
+	}
+}
+
+func TestDownloaded(t *testing.T) {
+	c, err := newCache(t, t.TempDir(), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Downloaded("a.webm"); ok {
+		t.Fatal("Downloaded reported a download that never started")
+	}
+
+	next := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.GetOrCreate(context.Background(), "a.webm", Metadata{}, growingDownload([][]byte{[]byte("12345"), []byte("678")}, next, nil))
+	}()
+	next <- struct{}{}
+	waitFor(t, func() bool { n, ok := c.Downloaded("a.webm"); return ok && n == 5 }, "the first chunk was never counted")
+
+	next <- struct{}{}
+	<-done
+	if _, ok := c.Downloaded("a.webm"); ok {
+		t.Error("Downloaded still reports a finished download")
+	}
+}
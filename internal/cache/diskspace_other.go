@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package cache
+
+import "errors"
+
+// freeSpace isn't supported here, so the free space reserve isn't enforced
+func freeSpace(dir string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
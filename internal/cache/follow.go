@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// followPoll is how often a follower checks a download for more data
+	followPoll = 50 * time.Millisecond
+	// followRegisterTimeout bounds waiting for GetOrCreate to start the download, which the
+	// playback loop does from another goroutine
+	followRegisterTimeout = time.Second
+	// followStartTimeout bounds waiting for the download to start writing
+	followStartTimeout = 10 * time.Second
+	// followStallTimeout is how long a reader waits for the download to write more
+	followStallTimeout = 5 * time.Second
+	// followMaxWaitShare is the largest share of the time a reader may spend waiting for the
+	// download; waiting more means it writes slower than the track plays
+	followMaxWaitShare = 0.25
+)
+
+// The reader starts judging the download's rate followWarmup after opening, once FFmpeg's
+// first burst has filled its buffers, and then over at least followRateWindow; variables so
+// tests can shorten them
+var (
+	followWarmup     = 10 * time.Second
+	followRateWindow = 10 * time.Second
+)
+
+// ErrStalled is returned by a follower's reader when the download stops writing
+var ErrStalled = errors.New("download fell behind playback")
+
+// Follower reads a GetOrCreate download while it is being written, so a track can play from
+// the same fetch that caches it
+// Once the download stalls or fails, Open refuses and the track should be streamed instead
+type Follower struct {
+	c      *Cache
+	key    string
+	failed atomic.Bool
+}
+
+// Follower returns a follower for the download of key
+func (c *Cache) Follower(key string) *Follower {
+	return &Follower{c: c, key: key}
+}
+
+// Failed reports whether the download stalled or failed
+func (f *Follower) Failed() bool {
+	return f.failed.Load()
+}
+
+// Open returns a reader over the download from its start, or over the cached file once it
+// is complete
+// The download's temporary file is held open, so moving it into place doesn't disturb the reader
+func (f *Follower) Open() (io.ReadCloser, error) {
+	if f.failed.Load() {
+		return nil, ErrStalled
+	}
+
+	started := time.Now()
+	for {
+		f.c.mu.RLock()
+		entry, cached := f.c.entries[f.key]
+		d := f.c.downloads[f.key]
+		f.c.mu.RUnlock()
+
+		switch {
+		case cached:
+			return os.Open(entry.Path)
+		case d == nil && time.Since(started) > followRegisterTimeout:
+			return nil, f.fail(fmt.Errorf("no download of %s", f.key))
+		case d != nil:
+			if file := openTemp(d.tempPath); file != nil {
+				return &followReader{file: file, download: d, follower: f, opened: time.Now()}, nil
+			}
+			select {
+			case <-d.done:
+				// Registered as an entry, or failed; look again to find out which
+				f.c.mu.RLock()
+				_, cached = f.c.entries[f.key]
+				f.c.mu.RUnlock()
+				if !cached {
+					return nil, f.fail(fmt.Errorf("download failed: %w", d.err))
+				}
+				continue
+			default:
+			}
+			if time.Since(started) > followStartTimeout {
+				return nil, f.fail(fmt.Errorf("download didn't start within %s", followStartTimeout))
+			}
+		}
+		time.Sleep(followPoll)
+	}
+}
+
+// fail marks the download as unusable for playback and returns err
+func (f *Follower) fail(err error) error {
+	f.failed.Store(true)
+	return err
+}
+
+// openTemp opens a download's temporary file: yt-dlp writes "<path>.part" and renames it
+// to path when done
+func openTemp(path string) *os.File {
+	for _, name := range []string{path + ".part", path} {
+		if file, err := os.Open(name); err == nil {
+			return file
+		}
+	}
+	return nil
+}
+
+// Downloaded returns how many bytes the running download of key has written so far, or
+// false if there is none
+func (c *Cache) Downloaded(key string) (int64, bool) {
+	c.mu.RLock()
+	d := c.downloads[key]
+	c.mu.RUnlock()
+	if d == nil {
+		return 0, false
+	}
+	for _, name := range []string{d.tempPath + ".part", d.tempPath} {
+		if info, err := os.Stat(name); err == nil {
+			return info.Size(), true
+		}
+	}
+	return 0, true
+}
+
+// followReader reads a file as a download writes it, waiting at its end for more
+// FFmpeg reads only as fast as the track plays once its buffers are full, so the share of
+// time spent waiting at the end of what was written is how far the download is behind
+// playback: a download at 80% of real time keeps the reader waiting about 20% of the time
+type followReader struct {
+	file     *os.File
+	download *download
+	follower *Follower
+	closed   atomic.Bool
+
+	opened time.Time
+	waited time.Duration // Time spent waiting for the download since followWarmup
+}
+
+// Read reads what has been written, waits for more, and returns io.EOF once the download is done
+// It fails with ErrStalled if the download stops, or keeps falling behind playback
+func (r *followReader) Read(p []byte) (int, error) {
+	waiting := time.Now()
+	defer func() { r.waited += r.waitedSince(waiting) }()
+
+	for {
+		n, err := r.file.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+
+		select {
+		case <-r.download.done:
+			// Everything was written before the download finished
+			if n, err := r.file.Read(p); n > 0 || err != io.EOF {
+				return n, err
+			}
+			if r.download.err != nil {
+				return 0, r.follower.fail(fmt.Errorf("download failed: %w", r.download.err))
+			}
+			return 0, io.EOF
+		default:
+		}
+
+		if r.closed.Load() {
+			return 0, os.ErrClosed
+		}
+		if time.Since(waiting) > followStallTimeout || r.tooSlow(waiting) {
+			return 0, r.follower.fail(ErrStalled)
+		}
+		time.Sleep(followPoll)
+	}
+}
+
+// tooSlow reports whether the reader, waiting since waiting, has spent more than
+// followMaxWaitShare of the time since followWarmup waiting for the download
+func (r *followReader) tooSlow(waiting time.Time) bool {
+	judged := r.opened.Add(followWarmup)
+	elapsed := time.Since(judged)
+	if elapsed < followRateWindow {
+		return false
+	}
+	waited := r.waited + r.waitedSince(waiting)
+	return float64(waited) > followMaxWaitShare*float64(elapsed)
+}
+
+// waitedSince returns how long the reader has been waiting since waiting, not counting
+// the time before followWarmup
+func (r *followReader) waitedSince(waiting time.Time) time.Duration {
+	if judged := r.opened.Add(followWarmup); waiting.Before(judged) {
+		waiting = judged
+	}
+	return max(time.Since(waiting), 0)
+}
+
+// Close stops any waiting Read and closes the file
+func (r *followReader) Close() error {
+	r.closed.Store(true)
+	return r.file.Close()
+}
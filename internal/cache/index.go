@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+)
+
+// indexFile is where entry metadata is kept, relative to the cache directory
+// It lives in a subdirectory so loadEntries doesn't treat it as a cached file
+const indexFile = "index/entries.json"
+
+// Metadata describes the track a cache entry holds
+type Metadata struct {
+	URL      string
+	Title    string
+	Artist   string
+	Duration time.Duration
+}
+
+// indexRecord is an entry's metadata as stored in the index
+type indexRecord struct {
+	URL          string        `json:"url,omitempty"`
+	Title        string        `json:"title,omitempty"`
+	Artist       string        `json:"artist,omitempty"`
+	Duration     time.Duration `json:"duration,omitempty"`
+	Size         int64         `json:"size"`
+	CreatedAt    time.Time     `json:"created_at"`
+	LastAccessed time.Time     `json:"last_accessed"`
+	PlayCount    int           `json:"play_count"`
+	Probed       time.Duration `json:"probed_duration,omitempty"`
+}
+
+// indexPath returns the index file's path
+func (c *Cache) indexPath() string {
+	return filepath.Join(c.dir, indexFile)
+}
+
+// readIndex reads the index; a missing or damaged index reads as empty, so entries are
+// rebuilt from the files on disk
+func (c *Cache) readIndex() map[string]indexRecord {
+	records := make(map[string]indexRecord)
+
+	data, err := os.ReadFile(c.indexPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return records
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &records)
+	}
+	if err != nil {
+		logger.Warn("Ignoring unreadable cache index, rebuilding it from the cached files", "path", c.indexPath(), "err", err)
+		return make(map[string]indexRecord)
+	}
+	return records
+}
+
+// applyIndex fills in entries found on disk from their index records; entries without one
+// keep what the file says (its modification time), and records without a file are dropped
+// on the next save
+func (c *Cache) applyIndex(records map[string]indexRecord) {
+	for key, entry := range c.entries {
+		record, ok := records[key]
+		if !ok {
+			entry.CreatedAt = entry.LastAccessed
+			continue
+		}
+		entry.URL = record.URL
+		entry.Title = record.Title
+		entry.Artist = record.Artist
+		entry.Duration = record.Duration
+		entry.CreatedAt = record.CreatedAt
+		entry.PlayCount = record.PlayCount
+		entry.ProbedDuration = record.Probed
+		if !record.LastAccessed.IsZero() {
+			entry.LastAccessed = record.LastAccessed
+		}
+	}
+}
+
+// indexSaveDelay is how long saveIndex waits before writing, so a burst of plays and
+// downloads rewrites the index once rather than once per change
+const indexSaveDelay = 5 * time.Second
+
+// saveIndex schedules a write of every entry's metadata to the index, if one isn't pending
+// already; the caller must hold c.mu
+func (c *Cache) saveIndex() {
+	c.indexMu.Lock()
+	defer c.indexMu.Unlock()
+
+	if c.indexTimer == nil {
+		c.indexTimer = time.AfterFunc(indexSaveDelay, c.saveIndexLater)
+	}
+}
+
+// saveIndexLater is the write saveIndex schedules
+// Failures are only logged: the index can always be rebuilt, and playback shouldn't stop for it
+func (c *Cache) saveIndexLater() {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.takeIndexTimer() {
+		return // Flush wrote it first
+	}
+	if err := c.writeIndex(); err != nil {
+		logger.Warn("Failed to save cache index", "err", err)
+	}
+}
+
+// Flush writes the index now if a write is pending; call it before exiting
+func (c *Cache) Flush() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.takeIndexTimer() {
+		return nil
+	}
+	return c.writeIndex()
+}
+
+// takeIndexTimer cancels the pending index write and reports whether there was one
+func (c *Cache) takeIndexTimer() bool {
+	c.indexMu.Lock()
+	defer c.indexMu.Unlock()
+
+	if c.indexTimer == nil {
+		return false
+	}
+	c.indexTimer.Stop()
+	c.indexTimer = nil
+	return true
+}
+
+// writeIndex writes the index to a temporary file and renames it over the old one, so a
+// crash mid-write can't leave a truncated file; the caller must hold c.mu
+func (c *Cache) writeIndex() error {
+	records := make(map[string]indexRecord, len(c.entries))
+	for key, entry := range c.entries {
+		records[key] = indexRecord{
+			URL:          entry.URL,
+			Title:        entry.Title,
+			Artist:       entry.Artist,
+			Duration:     entry.Duration,
+			Size:         entry.Size,
+			CreatedAt:    entry.CreatedAt,
+			LastAccessed: entry.LastAccessed,
+			PlayCount:    entry.PlayCount,
+			Probed:       entry.ProbedDuration,
+		}
+	}
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache index: %w", err)
+	}
+
+	path := c.indexPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache index directory: %w", err)
+	}
+	tmp := path + artifactTempSuffix
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cache index: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write cache index: %w", err)
+	}
+	return nil
+}
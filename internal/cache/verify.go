@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/tools"
+)
+
+// ErrCorrupt is returned by Verify for a cached file that is truncated or unreadable
+var ErrCorrupt = errors.New("cached file is damaged")
+
+// ErrNoDuration is returned by ProbeDuration for a file ffprobe can read but that doesn't
+// say how long it is
+var ErrNoDuration = errors.New("ffprobe found no duration")
+
+// probeTimeout bounds ffprobe reading a cached file's duration
+const probeTimeout = 15 * time.Second
+
+// unknownDuration is stored as the probed duration of a file that has none, so it isn't
+// probed again
+const unknownDuration time.Duration = -1
+
+// Verify checks that a cached file is readable and as long as the track it holds, and
+// removes it if not, so it is downloaded again
+// The probed duration is kept in the index, so each file is only probed once (see Probed)
+// Entries without a known track or file duration are only checked for being readable. A
+// damaged entry that is pinned is hidden and removed once it is no longer played, but still
+// reported
+// Only errors wrapping ErrCorrupt say anything about the file; others, e.g. ffprobe missing
+// or timing out, leave the entry as it is
+func (c *Cache) Verify(key string) error {
+	c.mu.Lock()
+	entry, exists := c.present(key)
+	if !exists {
+		c.mu.Unlock()
+		return fmt.Errorf("%s is not cached", key)
+	}
+	path, expected, probed := entry.Path, entry.Duration, entry.ProbedDuration
+	c.mu.Unlock()
+
+	if probed == 0 {
+		duration, err := ProbeDuration(path)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// ffprobe ran but couldn't read the file
+			return c.discard(key, fmt.Errorf("%w: %w", ErrCorrupt, err))
+		}
+		if errors.Is(err, ErrNoDuration) {
+			duration, err = unknownDuration, nil
+		}
+		if err != nil {
+			return err
+		}
+		probed = duration
+
+		c.mu.Lock()
+		if entry, exists := c.entries[key]; exists && entry.Path == path {
+			entry.ProbedDuration = duration
+			c.saveIndex()
+		}
+		c.mu.Unlock()
+	}
+
+	if expected > 0 && probed > 0 {
+		diff := expected - probed
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > durationTolerance(expected) {
+			return c.discard(key, fmt.Errorf("%w: it is %s long, the track %s", ErrCorrupt, probed.Round(time.Second), expected.Round(time.Second)))
+		}
+	}
+	return nil
+}
+
+// Annotate fills in metadata an entry doesn't have yet, e.g. for files cached before the
+// index existed
+func (c *Cache) Annotate(key string, meta Metadata) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.entries[key]
+	if !exists {
+		return
+	}
+	changed := false
+	fill := func(field *string, value string) {
+		if *field == "" && value != "" {
+			*field = value
+			changed = true
+		}
+	}
+	fill(&entry.URL, meta.URL)
+	fill(&entry.Title, meta.Title)
+	fill(&entry.Artist, meta.Artist)
+	if entry.Duration == 0 && meta.Duration > 0 {
+		entry.Duration = meta.Duration
+		changed = true
+	}
+	if changed {
+		c.saveIndex()
+	}
+}
+
+// Probed reports whether Verify already knows a cached file's duration, so verifying it
+// won't run ffprobe
+func (c *Cache) Probed(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.present(key)
+	return exists && entry.ProbedDuration != 0
+}
+
+// Keys returns the keys of every cached entry
+func (c *Cache) Keys() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// discard removes a damaged entry unless it is pinned, and returns err
+func (c *Cache) discard(key string, err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.entries[key]
+	if !exists {
+		return err
+	}
+	if c.pins[key] > 0 {
+		logger.Warn("Damaged cache entry is in use, removing it later", "key", key, "err", err)
+		entry.damaged = true
+		return err
+	}
+	logger.Warn("Removing damaged cache entry", "key", key, "title", entry.Title, "err", err)
+	c.removeEntry(key, entry)
+	c.saveIndex()
+	return err
+}
+
+// durationTolerance is how far a file's duration may be from its track's; container
+// durations and the ones services report differ by a second or two, more for long tracks
+func durationTolerance(expected time.Duration) time.Duration {
+	return max(5*time.Second, expected/50)
+}
+
+// ProbeDuration reads an audio file's container duration with ffprobe
+func ProbeDuration(path string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, tools.FFprobe,
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		"-i", path,
+	).Output()
+	if ctx.Err() != nil {
+		// A slow probe says nothing about the file
+		return 0, fmt.Errorf("ffprobe timed out")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil || seconds <= 0 {
+		return 0, ErrNoDuration
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -1,10 +1,17 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
 )
 
 // Config holds all application configuration
@@ -17,10 +24,34 @@ type Config struct {
 	YouTubeAPIKey   string
 	SpotifyClientID string
 	SpotifySecret   string
+	SpotifyMarket   string // ISO 3166-1 alpha-2 country whose catalog Spotify lookups use
 
 	// Cache settings
 	CacheDir   string
 	CacheLimit int64 // in bytes
+	// CacheMinFree is how much space downloads leave free on the cache's disk, in bytes
+	CacheMinFree int64
+	// CacheMaxAge is how long an entry may go unplayed before the janitor removes it, 0 to keep it
+	CacheMaxAge time.Duration
+	// CacheMaxTrackDuration is the longest track downloaded for the cache, 0 for no limit
+	CacheMaxTrackDuration time.Duration
+
+	// MaxTrackDuration is the longest track that may be queued, 0 for no limit; servers can
+	// override it
+	MaxTrackDuration time.Duration
+	// AllowLive lets livestreams be queued; they have no length, so MaxTrackDuration
+	// doesn't apply to them
+	AllowLive bool
+	// PreEncodeCache transcodes downloaded tracks once into Opus frame files stored alongside them
+	PreEncodeCache bool
+	// PlaybackMode is how tracks that aren't cached yet play: "stream-first" plays while they
+	// download, "download-first" waits for the download, and "auto" waits only for tracks up
+	// to DownloadFirstMaxDuration; servers can override it
+	PlaybackMode string
+	// DownloadFirstMaxDuration is the longest track the auto playback mode downloads first
+	DownloadFirstMaxDuration time.Duration
+	// DownloadFirstTimeout is how long a track waits for its download before streaming instead
+	DownloadFirstTimeout time.Duration
 
 	// Bot behavior
 	BotStatus           string
@@ -29,83 +60,487 @@ type Config struct {
 	BotActivityURL      string
 	RegisterGlobally    bool
 	WaitAfterQueueEmpty time.Duration
+	DJRole              string // Role name allowed to use DJ-only commands
+	MaxPlaylistSize     int    // Most tracks a single playlist import may add
+
+	// ShardCount is how many gateway shards the bot's servers are split across, 0 to use the
+	// count Discord recommends; ShardID is the shard this process serves
+	ShardCount int
+	ShardID    int
+
+	// CommandPrefix enables typed commands like "!play", empty to only use slash commands
+	CommandPrefix string
+
+	// CleanCommandsOnStart deletes and recreates every command at startup instead of
+	// updating only the ones that changed
+	CleanCommandsOnStart bool
+
+	// BotOwnerIDs are the users allowed to run owner-only commands like /admin; empty means
+	// the owner of the Discord application
+	BotOwnerIDs []string
+
+	// AllowedGuildIDs are the only servers the bot stays in; empty allows every server
+	AllowedGuildIDs []string
+	// BlockedGuildIDs are servers the bot leaves, even if they are allowed
+	BlockedGuildIDs []string
+	// GuildLeaveMessage is posted in a server's system channel before leaving it; empty to leave quietly
+	GuildLeaveMessage string
+
+	// Blocklist are YouTube links, other links or title words no server may queue, on top of
+	// each server's /blocklist
+	Blocklist []string
+
+	// RateLimit slows down users who run many searches, playlist imports or other commands
+	// in a short time
+	RateLimit bool
+	// RateLimitExemptDJs lets DJs and admins run commands as often as they like
+	RateLimitExemptDJs bool
 
 	// Features
-	EnableSponsorBlock  bool
-	SponsorBlockTimeout int
+	EnableSponsorBlock     bool
+	SponsorBlockTimeout    int // in seconds
+	SponsorBlockCategories []string
+	// SearchProvider is where searches look by default: "youtube" or "youtube_music"
+	SearchProvider string
+	// SearchMaxDuration drops longer search results unless nothing else is found; 0 for no limit
+	SearchMaxDuration time.Duration
+	// SearchMaxRatio drops search results longer than this multiple of the song's known
+	// length, like a Spotify track's; 0 for no limit
+	SearchMaxRatio int
+	// SearchJunkPatterns are title words, like "full album", that move search results behind
+	// the others unless the query has them too
+	SearchJunkPatterns []string
+	// LyricsAPIURL is an LRCLIB-compatible API /lyrics looks songs up in; empty for LRCLIB's
+	LyricsAPIURL string
 
 	// Playback settings
 	DefaultVolume             int
 	ReduceVolumeOnVoice       bool
 	ReduceVolumeOnVoiceTarget int
+	ReplayFromTimestamp       bool
+	// QueueHistorySize is how many played tracks each server's queue keeps
+	QueueHistorySize int
+
+	// Audio encoding settings
+	OpusBitrate     int // in kbps
+	OpusMaxBitrate  int // in kbps, caps bitrates matched from the voice channel
+	FrameDurationMs int
+	AudioChannels   int
+	OpusFEC         bool
+	OpusPacketLoss  int // expected packet loss percentage
+
+	// StreamMode is "url" (yt-dlp extracts a URL for FFmpeg) or "pipe" (yt-dlp pipes into FFmpeg)
+	StreamMode string
+	// StreamPrefetchCount is how many upcoming tracks get their stream URL looked up ahead of time
+	StreamPrefetchCount int
+
+	// EncoderStartupTimeout is how long FFmpeg may run without producing audio (0 to disable)
+	EncoderStartupTimeout time.Duration
+	// JitterBufferMs is how much audio is read ahead of the send clock, in milliseconds
+	JitterBufferMs int
+
+	// DirectMaxSize is the largest audio file a direct link may point at, in bytes (0 for no limit)
+	DirectMaxSize int64
+
+	// External binaries
+	FFmpegPath     string
+	FFprobePath    string
+	YtDlpPath      string
+	YtDlpExtraArgs []string // appended to every yt-dlp invocation
+	YtDlpCookies   string   // Netscape cookies file for age-restricted and members-only videos
+	YtDlpMaxProcs  int      // most yt-dlp lookups and downloads running at once
+	ProxyURLs      []string // proxies used round-robin for yt-dlp and FFmpeg network requests
 
 	// Debug settings
-	Debug bool
+	Debug     bool   // Forces the debug log level
+	LogLevel  string // debug, info, warn, or error
+	LogFormat string // text or json
 }
 
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
+	return load(&settings{})
+}
+
+// load builds the configuration from s and validates it
+func load(s *settings) (*Config, error) {
+	cfg, err := parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Inspect loads the configuration like Load, or like LoadFromFile if path is set, but
+// returns it even when it fails validation, together with the validation error, so the
+// rest of it can still be checked
+func Inspect(path string) (*Config, error) {
+	s := &settings{}
+	if path != "" {
+		file, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		s.file = file.values
+	}
+
+	cfg, err := parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// parse builds the configuration from s, failing only on values that can't be read
+func parse(s *settings) (*Config, error) {
 	cfg := &Config{
 		// Required
-		DiscordToken: os.Getenv("DISCORD_TOKEN"),
+		DiscordToken: s.get("DISCORD_TOKEN"),
 
 		// Optional APIs
-		YouTubeAPIKey:   os.Getenv("YOUTUBE_API_KEY"),
-		SpotifyClientID: os.Getenv("SPOTIFY_CLIENT_ID"),
-		SpotifySecret:   os.Getenv("SPOTIFY_CLIENT_SECRET"),
+		YouTubeAPIKey:   s.get("YOUTUBE_API_KEY"),
+		SpotifyClientID: s.get("SPOTIFY_CLIENT_ID"),
+		SpotifySecret:   s.get("SPOTIFY_CLIENT_SECRET"),
+		SpotifyMarket:   strings.ToUpper(s.getOrDefault("SPOTIFY_MARKET", "US")),
 
 		// Cache defaults
-		CacheDir:   getEnvOrDefault("CACHE_DIR", "./cache"),
-		CacheLimit: parseCacheLimit(getEnvOrDefault("CACHE_LIMIT", "2GB")),
+		CacheDir: s.getOrDefault("CACHE_DIR", "./cache"),
+
+		PreEncodeCache: s.getBool("PRE_ENCODE_CACHE", false),
+		PlaybackMode:   strings.ToLower(s.getOrDefault("PLAYBACK_MODE", "stream-first")),
 
 		// Bot settings
-		BotStatus:           getEnvOrDefault("BOT_STATUS", "online"),
-		BotActivityType:     getEnvOrDefault("BOT_ACTIVITY_TYPE", "LISTENING"),
-		BotActivity:         getEnvOrDefault("BOT_ACTIVITY", "music"),
-		BotActivityURL:      os.Getenv("BOT_ACTIVITY_URL"),
-		RegisterGlobally:    getEnvBool("REGISTER_COMMANDS_ON_BOT", false),
-		WaitAfterQueueEmpty: time.Duration(getEnvInt("WAIT_AFTER_QUEUE_EMPTIES", 30)) * time.Second,
+		BotStatus:           s.getOrDefault("BOT_STATUS", "online"),
+		BotActivityType:     s.getOrDefault("BOT_ACTIVITY_TYPE", "LISTENING"),
+		BotActivity:         s.getOrDefault("BOT_ACTIVITY", "music"),
+		BotActivityURL:      s.get("BOT_ACTIVITY_URL"),
+		RegisterGlobally:    s.getBool("REGISTER_COMMANDS_ON_BOT", false),
+		WaitAfterQueueEmpty: time.Duration(s.getInt("WAIT_AFTER_QUEUE_EMPTIES", 30)) * time.Second,
+		DJRole:              s.getOrDefault("DJ_ROLE", "DJ"),
+		MaxPlaylistSize:     s.getInt("MAX_PLAYLIST_SIZE", 500),
+		AllowLive:           s.getBool("ALLOW_LIVE", true),
+
+		CleanCommandsOnStart: s.getBool("CLEAN_COMMANDS_ON_START", false),
+		CommandPrefix:        s.get("COMMAND_PREFIX"),
+
+		BotOwnerIDs:       s.getList("BOT_OWNER_IDS", nil),
+		AllowedGuildIDs:   s.getList("ALLOWED_GUILD_IDS", nil),
+		BlockedGuildIDs:   s.getList("BLOCKED_GUILD_IDS", nil),
+		GuildLeaveMessage: s.get("GUILD_LEAVE_MESSAGE"),
+
+		Blocklist: s.getList("BLOCKLIST", nil),
+
+		RateLimit:          s.getBool("RATE_LIMIT", true),
+		RateLimitExemptDJs: s.getBool("RATE_LIMIT_EXEMPT_DJS", true),
 
 		// Features
-		EnableSponsorBlock:  getEnvBool("ENABLE_SPONSORBLOCK", false),
-		SponsorBlockTimeout: getEnvInt("SPONSORBLOCK_TIMEOUT", 5),
+		EnableSponsorBlock:     s.getBool("ENABLE_SPONSORBLOCK", false),
+		SponsorBlockTimeout:    s.getInt("SPONSORBLOCK_TIMEOUT", 5),
+		SponsorBlockCategories: s.getList("SPONSORBLOCK_CATEGORIES", []string{"sponsor", "selfpromo", "interaction", "music_offtopic"}),
+		SearchProvider:         strings.ToLower(s.getOrDefault("SEARCH_PROVIDER", "youtube")),
+		SearchMaxRatio:         s.getInt("SEARCH_MAX_LENGTH_RATIO", 3),
+		SearchJunkPatterns:     s.getList("SEARCH_JUNK_PATTERNS", []string{"1 hour", "10 hours", "hour loop", "full album", "compilation", "slowed + reverb", "slowed and reverb"}),
+		LyricsAPIURL:           s.get("LYRICS_API_URL"),
 
 		// Playback
-		DefaultVolume:             getEnvInt("DEFAULT_VOLUME", 100),
-		ReduceVolumeOnVoice:       getEnvBool("REDUCE_VOL_WHEN_VOICE", false),
-		ReduceVolumeOnVoiceTarget: getEnvInt("REDUCE_VOL_WHEN_VOICE_TARGET", 70),
+		DefaultVolume:             s.getInt("DEFAULT_VOLUME", 100),
+		ReduceVolumeOnVoice:       s.getBool("REDUCE_VOL_WHEN_VOICE", false),
+		ReduceVolumeOnVoiceTarget: s.getInt("REDUCE_VOL_WHEN_VOICE_TARGET", 70),
+		ReplayFromTimestamp:       s.getBool("REPLAY_FROM_TIMESTAMP", false),
+		QueueHistorySize:          s.getInt("QUEUE_HISTORY_SIZE", 50),
+
+		// Audio encoding
+		OpusBitrate:     s.getInt("OPUS_BITRATE", 128),
+		OpusMaxBitrate:  s.getInt("OPUS_MAX_BITRATE", 384),
+		FrameDurationMs: s.getInt("FRAME_DURATION_MS", 20),
+		AudioChannels:   s.getInt("AUDIO_CHANNELS", 2),
+		OpusFEC:         s.getBool("OPUS_FEC", false),
+		OpusPacketLoss:  s.getInt("OPUS_EXPECTED_LOSS", 0),
+
+		StreamMode:            s.getOrDefault("STREAM_MODE", "url"),
+		StreamPrefetchCount:   s.getInt("STREAM_PREFETCH_COUNT", 3),
+		EncoderStartupTimeout: time.Duration(s.getInt("ENCODER_STARTUP_TIMEOUT", 15)) * time.Second,
+		JitterBufferMs:        s.getInt("JITTER_BUFFER_MS", 200),
+
+		// External binaries
+		FFmpegPath:     s.getOrDefault("FFMPEG_PATH", "ffmpeg"),
+		FFprobePath:    s.getOrDefault("FFPROBE_PATH", "ffprobe"),
+		YtDlpPath:      s.getOrDefault("YTDLP_PATH", "yt-dlp"),
+		YtDlpExtraArgs: strings.Fields(s.get("YTDLP_EXTRA_ARGS")),
+		YtDlpCookies:   s.get("YTDLP_COOKIES_FILE"),
+		YtDlpMaxProcs:  s.getInt("YTDLP_MAX_CONCURRENCY", 3),
+		ProxyURLs:      s.getList("HTTP_PROXY_URL", nil),
 
 		// Debug
-		Debug: getEnvBool("DEBUG", false),
+		Debug:     s.getBool("DEBUG", false),
+		LogLevel:  strings.ToLower(s.getOrDefault("LOG_LEVEL", "info")),
+		LogFormat: strings.ToLower(s.getOrDefault("LOG_FORMAT", "text")),
+	}
+
+	sizes := []struct {
+		key, defaultValue string
+		dest              *int64
+	}{
+		{"CACHE_LIMIT", "2GB", &cfg.CacheLimit},
+		{"CACHE_MIN_FREE", "1GB", &cfg.CacheMinFree},
+		{"DIRECT_MAX_SIZE", "500MB", &cfg.DirectMaxSize},
+	}
+	for _, setting := range sizes {
+		size, err := parseSize(s.getOrDefault(setting.key, setting.defaultValue))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", setting.key, err)
+		}
+		*setting.dest = size
+	}
+
+	maxAge, err := time.ParseDuration(s.getOrDefault("CACHE_MAX_AGE", "0"))
+	if err != nil || maxAge < 0 {
+		return nil, fmt.Errorf("CACHE_MAX_AGE must be a duration like 720h, or 0 to keep entries until space runs out")
+	}
+	cfg.CacheMaxAge = maxAge
+
+	maxTrack, err := time.ParseDuration(s.getOrDefault("CACHE_MAX_TRACK_DURATION", "1h"))
+	if err != nil || maxTrack < 0 {
+		return nil, fmt.Errorf("CACHE_MAX_TRACK_DURATION must be a duration like 1h30m, or 0 for no limit")
+	}
+	cfg.CacheMaxTrackDuration = maxTrack
+
+	downloadFirst, err := time.ParseDuration(s.getOrDefault("DOWNLOAD_FIRST_MAX_DURATION", "10m"))
+	if err != nil || downloadFirst < 0 {
+		return nil, fmt.Errorf("DOWNLOAD_FIRST_MAX_DURATION must be a duration like 10m")
+	}
+	cfg.DownloadFirstMaxDuration = downloadFirst
+
+	downloadTimeout, err := time.ParseDuration(s.getOrDefault("DOWNLOAD_FIRST_TIMEOUT", "45s"))
+	if err != nil || downloadTimeout <= 0 {
+		return nil, fmt.Errorf("DOWNLOAD_FIRST_TIMEOUT must be a duration like 45s")
 	}
+	cfg.DownloadFirstTimeout = downloadTimeout
 
-	if cfg.DiscordToken == "" {
-		return nil, fmt.Errorf("DISCORD_TOKEN environment variable is required")
+	maxResult, err := time.ParseDuration(s.getOrDefault("SEARCH_MAX_DURATION", "0"))
+	if err != nil || maxResult < 0 {
+		return nil, fmt.Errorf("SEARCH_MAX_DURATION must be a duration like 1h30m, or 0 for no limit")
 	}
+	cfg.SearchMaxDuration = maxResult
 
+	maxQueued, err := time.ParseDuration(s.getOrDefault("MAX_TRACK_DURATION", "0"))
+	if err != nil || maxQueued < 0 {
+		return nil, fmt.Errorf("MAX_TRACK_DURATION must be a duration like 1h30m, or 0 for no limit")
+	}
+	cfg.MaxTrackDuration = maxQueued
+
+	if shards := strings.ToLower(s.getOrDefault("SHARD_COUNT", "1")); shards != "auto" {
+		count, err := strconv.Atoi(shards)
+		if err != nil || count < 1 {
+			return nil, fmt.Errorf("SHARD_COUNT must be a number of shards, or auto")
+		}
+		cfg.ShardCount = count
+	}
+	shardID, err := strconv.Atoi(s.getOrDefault("SHARD_ID", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("SHARD_ID must be a number")
+	}
+	cfg.ShardID = shardID
 	return cfg, nil
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
+// EffectiveLogLevel returns the log level to use: LOG_LEVEL, or debug when DEBUG is set
+func (c *Config) EffectiveLogLevel() string {
+	if c.Debug {
+		return "debug"
+	}
+	return c.LogLevel
+}
+
+// GuildAllowed reports whether the bot may stay in a server: it must not be blocked and, if
+// there is an allow list, must be on it
+func (c *Config) GuildAllowed(guildID string) bool {
+	if slices.Contains(c.BlockedGuildIDs, guildID) {
+		return false
+	}
+	return len(c.AllowedGuildIDs) == 0 || slices.Contains(c.AllowedGuildIDs, guildID)
+}
+
+// Validate checks that the settings are usable, reporting every problem at once
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.DiscordToken == "" {
+		errs = append(errs, fmt.Errorf("DISCORD_TOKEN is required"))
+	}
+
+	if c.MaxPlaylistSize < 1 {
+		errs = append(errs, fmt.Errorf("MAX_PLAYLIST_SIZE must be at least 1"))
+	}
+
+	if len(c.SpotifyMarket) != 2 || strings.Trim(c.SpotifyMarket, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		errs = append(errs, fmt.Errorf("SPOTIFY_MARKET must be a two-letter country code like US or DE"))
+	}
+
+	if c.ShardID < 0 || (c.ShardCount > 0 && c.ShardID >= c.ShardCount) {
+		errs = append(errs, fmt.Errorf("SHARD_ID must be between 0 and SHARD_COUNT-1"))
+	}
+
+	if c.YtDlpMaxProcs < 1 {
+		errs = append(errs, fmt.Errorf("YTDLP_MAX_CONCURRENCY must be at least 1"))
+	}
+
+	if c.DefaultVolume < 0 || c.DefaultVolume > 100 {
+		errs = append(errs, fmt.Errorf("DEFAULT_VOLUME must be between 0 and 100"))
+	}
+
+	if c.ReduceVolumeOnVoiceTarget < 0 || c.ReduceVolumeOnVoiceTarget > 100 {
+		errs = append(errs, fmt.Errorf("REDUCE_VOL_WHEN_VOICE_TARGET must be between 0 and 100"))
+	}
+
+	if c.OpusBitrate < 8 || c.OpusBitrate > 510 {
+		errs = append(errs, fmt.Errorf("OPUS_BITRATE must be between 8 and 510 kbps"))
+	}
+
+	if c.OpusMaxBitrate < c.OpusBitrate || c.OpusMaxBitrate > 510 {
+		errs = append(errs, fmt.Errorf("OPUS_MAX_BITRATE must be between OPUS_BITRATE and 510 kbps"))
+	}
+
+	if c.FrameDurationMs != 20 && c.FrameDurationMs != 40 && c.FrameDurationMs != 60 {
+		errs = append(errs, fmt.Errorf("FRAME_DURATION_MS must be 20, 40, or 60"))
+	}
+
+	if c.AudioChannels != 1 && c.AudioChannels != 2 {
+		errs = append(errs, fmt.Errorf("AUDIO_CHANNELS must be 1 or 2"))
+	}
+
+	if c.OpusPacketLoss < 0 || c.OpusPacketLoss > 100 {
+		errs = append(errs, fmt.Errorf("OPUS_EXPECTED_LOSS must be between 0 and 100"))
+	}
+
+	if c.QueueHistorySize < 0 {
+		errs = append(errs, fmt.Errorf("QUEUE_HISTORY_SIZE must be 0 or more"))
+	}
+
+	if c.SearchProvider != "youtube" && c.SearchProvider != "youtube_music" {
+		errs = append(errs, fmt.Errorf("SEARCH_PROVIDER must be youtube or youtube_music"))
+	}
+
+	if c.PlaybackMode != "stream-first" && c.PlaybackMode != "download-first" && c.PlaybackMode != "auto" {
+		errs = append(errs, fmt.Errorf("PLAYBACK_MODE must be stream-first, download-first or auto"))
+	}
+
+	if c.SearchMaxRatio < 0 {
+		errs = append(errs, fmt.Errorf("SEARCH_MAX_LENGTH_RATIO must be 0 or more"))
+	}
+
+	if c.StreamMode != "url" && c.StreamMode != "pipe" {
+		errs = append(errs, fmt.Errorf("STREAM_MODE must be url or pipe"))
+	}
+
+	if c.StreamPrefetchCount < 0 || c.StreamPrefetchCount > 10 {
+		errs = append(errs, fmt.Errorf("STREAM_PREFETCH_COUNT must be between 0 and 10"))
+	}
+
+	if c.DirectMaxSize < 0 {
+		errs = append(errs, fmt.Errorf("DIRECT_MAX_SIZE must not be negative"))
+	}
+
+	if c.EncoderStartupTimeout < 0 {
+		errs = append(errs, fmt.Errorf("ENCODER_STARTUP_TIMEOUT must not be negative"))
+	}
+
+	if c.JitterBufferMs < c.FrameDurationMs || c.JitterBufferMs > 10000 {
+		errs = append(errs, fmt.Errorf("JITTER_BUFFER_MS must be between FRAME_DURATION_MS and 10000"))
+	}
+
+	if !slices.Contains(logger.Levels, c.LogLevel) {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL must be one of %s", strings.Join(logger.Levels, ", ")))
+	}
+
+	if !slices.Contains(logger.Formats, c.LogFormat) {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT must be %s", strings.Join(logger.Formats, " or ")))
+	}
+
+	for _, list := range []struct {
+		key string
+		ids []string
+	}{
+		{"BOT_OWNER_IDS", c.BotOwnerIDs},
+		{"ALLOWED_GUILD_IDS", c.AllowedGuildIDs},
+		{"BLOCKED_GUILD_IDS", c.BlockedGuildIDs},
+	} {
+		for _, id := range list.ids {
+			if strings.Trim(id, "0123456789") != "" {
+				errs = append(errs, fmt.Errorf("%s must be a comma-separated list of IDs, not %q", list.key, id))
+			}
+		}
+	}
+
+	for _, proxy := range c.ProxyURLs {
+		u, err := url.Parse(proxy)
+		if err != nil || u.Host == "" {
+			errs = append(errs, fmt.Errorf("HTTP_PROXY_URL contains an invalid proxy URL"))
+			continue
+		}
+		switch u.Scheme {
+		case "http", "https", "socks4", "socks4a", "socks5", "socks5h":
+		default:
+			errs = append(errs, fmt.Errorf("HTTP_PROXY_URL scheme %q is not supported", u.Scheme))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// settings looks settings up by their environment variable name: the environment first,
+// then the config file, if one was loaded
+type settings struct {
+	file map[string]string // Config file values by environment variable name
+	read map[string]bool   // Names looked up, so unknown config file keys can be reported
+}
+
+// get returns a setting, or "" if it isn't set
+func (s *settings) get(key string) string {
+	if s.read == nil {
+		s.read = make(map[string]bool)
+	}
+	s.read[key] = true
+
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
-	return defaultValue
+	return s.file[key]
 }
 
-func getEnvBool(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
-		b, err := strconv.ParseBool(value)
-		if err != nil {
-			return defaultValue
-		}
-		return b
+func (s *settings) getOrDefault(key, defaultValue string) string {
+	if value := s.get(key); value != "" {
+		return value
 	}
 	return defaultValue
 }
 
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
+// getBool reads a boolean setting; yes/no and on/off are accepted too, as YAML 1.1 and
+// many .env files spell them, and anything else is reported and ignored
+func (s *settings) getBool(key string, defaultValue bool) bool {
+	value := s.get(key)
+	if value == "" {
+		return defaultValue
+	}
+	switch strings.ToLower(value) {
+	case "yes", "on":
+		return true
+	case "no", "off":
+		return false
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.Warn("Ignoring a setting that isn't true or false", "key", key, "value", value, "default", defaultValue)
+		return defaultValue
+	}
+	return b
+}
+
+func (s *settings) getInt(key string, defaultValue int) int {
+	if value := s.get(key); value != "" {
 		i, err := strconv.Atoi(value)
 		if err != nil {
 			return defaultValue
@@ -115,33 +550,54 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
-func parseCacheLimit(limit string) int64 {
-	if limit == "" {
-		return 2 * 1024 * 1024 * 1024 // 2GB default
+func (s *settings) getList(key string, defaultValue []string) []string {
+	value := s.get(key)
+	if value == "" {
+		return defaultValue
 	}
 
-	multiplier := int64(1)
-	numStr := limit
-
-	// Parse unit suffix
-	if len(limit) >= 2 {
-		suffix := limit[len(limit)-2:]
-		if suffix == "GB" || suffix == "gb" {
-			multiplier = 1024 * 1024 * 1024
-			numStr = limit[:len(limit)-2]
-		} else if suffix == "MB" || suffix == "mb" {
-			multiplier = 1024 * 1024
-			numStr = limit[:len(limit)-2]
-		} else if suffix == "KB" || suffix == "kb" {
-			multiplier = 1024
-			numStr = limit[:len(limit)-2]
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
 	}
+	if len(items) == 0 {
+		return defaultValue
+	}
+	return items
+}
 
-	num, err := strconv.ParseInt(numStr, 10, 64)
-	if err != nil {
-		return 2 * 1024 * 1024 * 1024 // 2GB default on error
+// sizeUnits are the multipliers of the units parseSize accepts
+var sizeUnits = map[string]float64{
+	"":  1,
+	"b": 1,
+	"k": 1 << 10, "kb": 1 << 10,
+	"m": 1 << 20, "mb": 1 << 20,
+	"g": 1 << 30, "gb": 1 << 30,
+	"t": 1 << 40, "tb": 1 << 40,
+}
+
+// parseSize parses a size like "512MB", "1.5 GB" or "2t"; units are binary and
+// case-insensitive, and a bare number is in bytes
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if end < 0 {
+		end = len(s)
+	}
+
+	num, err := strconv.ParseFloat(s[:end], 64)
+	multiplier, known := sizeUnits[strings.ToLower(strings.TrimSpace(s[end:]))]
+	if err != nil || !known {
+		return 0, fmt.Errorf("invalid size %q; use something like 512MB, 1.5GB or 2TB", s)
 	}
 
-	return num * multiplier
+	size := num * multiplier
+	if size >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return int64(size), nil
 }
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"0", 0},
+		{"1024", 1024},
+		{"100B", 100},
+		{"100b", 100},
+		{"1KB", 1 << 10},
+		{"1k", 1 << 10},
+		{"512MB", 512 << 20},
+		{"512mb", 512 << 20},
+		{"512M", 512 << 20},
+		{"2GB", 2 << 30},
+		{"2Gb", 2 << 30},
+		{"2g", 2 << 30},
+		{"1.5GB", 3 << 29},
+		{"1.5 GB", 3 << 29},
+		{" 10 GB ", 10 << 30},
+		{".5GB", 1 << 29},
+		{"1TB", 1 << 40},
+		{"1t", 1 << 40},
+		{"0.25TB", 1 << 38},
+		{"2.5KB", 2560},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if err != nil {
+			t.Errorf("parseSize(%q) returned %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseSizeRejectsInvalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"GB",
+		"abc",
+		"-1GB",
+		"1.2.3GB",
+		"1PB",
+		"1 G B",
+		"1GiB",
+		"1e3",
+		"10GBs",
+		"NaN",
+		"99999999TB",
+	} {
+		if got, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) = %d, want an error", in, got)
+		}
+	}
+}
+
+func TestLoadRejectsMalformedSize(t *testing.T) {
+	t.Setenv("DISCORD_TOKEN", "token")
+	t.Setenv("CACHE_LIMIT", "1.5 gigs")
+
+	if _, err := Load(); err == nil {
+		t.Error("Load accepted CACHE_LIMIT=1.5 gigs")
+	}
+}
+
+func TestLoadLogSettings(t *testing.T) {
+	t.Setenv("DISCORD_TOKEN", "token")
+	t.Setenv("LOG_LEVEL", "WARN")
+	t.Setenv("LOG_FORMAT", "json")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LogLevel != "warn" || cfg.LogFormat != "json" {
+		t.Errorf("level %q, format %q", cfg.LogLevel, cfg.LogFormat)
+	}
+
+	t.Setenv("LOG_LEVEL", "verbose")
+	t.Setenv("LOG_FORMAT", "xml")
+	_, err = Load()
+	if err == nil || !strings.Contains(err.Error(), "LOG_LEVEL") || !strings.Contains(err.Error(), "LOG_FORMAT") {
+		t.Errorf("Load() error = %v, want both log settings rejected", err)
+	}
+}
+
+func TestGuildAllowed(t *testing.T) {
+	open := &Config{}
+	if !open.GuildAllowed("1") {
+		t.Error("without lists every server should be allowed")
+	}
+
+	cfg := &Config{AllowedGuildIDs: []string{"1", "2"}, BlockedGuildIDs: []string{"2", "3"}}
+	for id, want := range map[string]bool{"1": true, "2": false, "3": false, "4": false} {
+		if got := cfg.GuildAllowed(id); got != want {
+			t.Errorf("GuildAllowed(%q) = %v, want %v", id, got, want)
+		}
+	}
+
+	blocked := &Config{BlockedGuildIDs: []string{"3"}}
+	if blocked.GuildAllowed("3") || !blocked.GuildAllowed("4") {
+		t.Error("a block list alone should only block the servers on it")
+	}
+}
+
+func TestLoadRejectsMalformedGuildIDs(t *testing.T) {
+	t.Setenv("DISCORD_TOKEN", "token")
+	t.Setenv("ALLOWED_GUILD_IDS", "123456789012345678, my server")
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "ALLOWED_GUILD_IDS") {
+		t.Errorf("Load() error = %v, want ALLOWED_GUILD_IDS rejected", err)
+	}
+}
+
+func TestLoadShards(t *testing.T) {
+	t.Setenv("DISCORD_TOKEN", "token")
+	t.Setenv("SHARD_COUNT", "auto")
+	t.Setenv("SHARD_ID", "3")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ShardCount != 0 || cfg.ShardID != 3 {
+		t.Errorf("auto: count %d, id %d", cfg.ShardCount, cfg.ShardID)
+	}
+
+	t.Setenv("SHARD_COUNT", "2")
+	t.Setenv("SHARD_ID", "2")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "SHARD_ID") {
+		t.Errorf("Load() error = %v, want SHARD_ID 2 of 2 rejected", err)
+	}
+
+	t.Setenv("SHARD_ID", "one")
+	if _, err := Load(); err == nil {
+		t.Error("Load accepted SHARD_ID=one")
+	}
+}
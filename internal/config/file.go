@@ -0,0 +1,177 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadFromFile loads configuration from a YAML (.yaml, .yml) or TOML (.toml) file
+// Keys are the environment variable names in lower case, either flat (cache_limit) or
+// grouped under a section (cache: limit), and lists may be written as lists. Values may use
+// anything the format allows, e.g. multi-line arrays or YAML block scalars. Environment
+// variables override the file, and ${NAME} in a value is replaced by the environment
+// variable NAME, so secrets can stay out of the file
+func LoadFromFile(path string) (*Config, error) {
+	file, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &settings{file: file.values}
+	cfg, err := load(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var unknown []string
+	for key, name := range file.names {
+		if !s.read[key] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		slices.Sort(unknown)
+		logger.Warn("Ignoring unknown settings in config file", "path", path, "keys", strings.Join(unknown, ", "))
+	}
+	return cfg, nil
+}
+
+// configFile is a parsed config file
+type configFile struct {
+	values map[string]string // By environment variable name
+	names  map[string]string // The keys as written, by environment variable name
+}
+
+// listSeparators joins lists for settings that aren't comma-separated
+var listSeparators = map[string]string{"YTDLP_EXTRA_ARGS": " "}
+
+// readConfigFile parses a config file by its extension
+func readConfigFile(path string) (*configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var tree map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	file := &configFile{values: make(map[string]string), names: make(map[string]string)}
+	if err := file.add(nil, tree); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return file, nil
+}
+
+// add stores every setting in a mapping, with sections nested under their key paths
+func (f *configFile) add(path []string, mapping map[string]any) error {
+	// Sorted, so which of two spellings of a setting is reported doesn't vary
+	for _, key := range slices.Sorted(maps.Keys(mapping)) {
+		keyPath := append(slices.Clone(path), key)
+		switch value := mapping[key].(type) {
+		case map[string]any:
+			if err := f.add(keyPath, value); err != nil {
+				return err
+			}
+		case []any:
+			items := make([]string, len(value))
+			for i, item := range value {
+				scalar, err := scalarString(item)
+				if err != nil {
+					return fmt.Errorf("%s: %w", strings.Join(keyPath, "."), err)
+				}
+				items[i] = scalar
+			}
+			if err := f.set(keyPath, items); err != nil {
+				return err
+			}
+		default:
+			scalar, err := scalarString(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", strings.Join(keyPath, "."), err)
+			}
+			if err := f.set(keyPath, []string{scalar}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// scalarString formats a decoded scalar as the environment variable would spell it
+func scalarString(value any) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case int:
+		return strconv.Itoa(value), nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case uint64:
+		return strconv.FormatUint(value, 10), nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case time.Time:
+		return value.Format(time.RFC3339), nil
+	default:
+		return "", fmt.Errorf("expected a value or a list of values")
+	}
+}
+
+// set stores a value under the environment variable its key path names
+func (f *configFile) set(path []string, values []string) error {
+	name := strings.Join(path, ".")
+	key := strings.ToUpper(strings.ReplaceAll(strings.Join(path, "_"), "-", "_"))
+	if _, exists := f.values[key]; exists {
+		return fmt.Errorf("%s is set more than once (as %s and %s)", key, f.names[key], name)
+	}
+
+	separator, ok := listSeparators[key]
+	if !ok {
+		separator = ","
+	}
+	for i, value := range values {
+		values[i] = expandEnv(value)
+	}
+	f.values[key] = strings.Join(values, separator)
+	f.names[key] = name
+	return nil
+}
+
+// envReference matches ${NAME} in config file values
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} with the environment variable NAME
+func expandEnv(value string) string {
+	return envReference.ReplaceAllStringFunc(value, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		if _, ok := os.LookupEnv(name); !ok {
+			logger.Warn("Config file refers to an unset environment variable", "name", name)
+		}
+		return os.Getenv(name)
+	})
+}
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a config file named name and returns its path
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadYAML(t *testing.T) {
+	t.Setenv("TEST_SECRET", "s3cret")
+	path := writeConfig(t, "gobard.yaml", `
+# Secrets come from the environment
+discord_token: ${TEST_SECRET}
+spotify_market: "DE"   # quoted
+bot_activity: Rock 'n' roll # apostrophes aren't quotes
+
+cache:
+  dir: /var/cache/gobard
+  limit: 1.5GB
+
+sponsorblock_categories: [sponsor, "selfpromo"]
+ytdlp:
+  extra_args:
+    - --force-ipv4
+    - '--sleep-requests 1'
+default_volume: 80
+`)
+
+	file, err := readConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"DISCORD_TOKEN":           "s3cret",
+		"SPOTIFY_MARKET":          "DE",
+		"BOT_ACTIVITY":            "Rock 'n' roll",
+		"CACHE_DIR":               "/var/cache/gobard",
+		"CACHE_LIMIT":             "1.5GB",
+		"SPONSORBLOCK_CATEGORIES": "sponsor,selfpromo",
+		"YTDLP_EXTRA_ARGS":        "--force-ipv4 --sleep-requests 1",
+		"DEFAULT_VOLUME":          "80",
+	}
+	if !reflect.DeepEqual(file.values, want) {
+		t.Errorf("values = %v\nwant %v", file.values, want)
+	}
+	if file.names["CACHE_LIMIT"] != "cache.limit" {
+		t.Errorf("CACHE_LIMIT written as %q", file.names["CACHE_LIMIT"])
+	}
+}
+
+func TestReadTOML(t *testing.T) {
+	path := writeConfig(t, "gobard.toml", `
+discord_token = "token" # comment
+default_volume = 80
+
+[cache]
+limit = "512MB"
+max-age = '720h'
+
+[sponsorblock]
+categories = ["sponsor", "intro"]
+`)
+
+	file, err := readConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"DISCORD_TOKEN":           "token",
+		"DEFAULT_VOLUME":          "80",
+		"CACHE_LIMIT":             "512MB",
+		"CACHE_MAX_AGE":           "720h",
+		"SPONSORBLOCK_CATEGORIES": "sponsor,intro",
+	}
+	if !reflect.DeepEqual(file.values, want) {
+		t.Errorf("values = %v\nwant %v", file.values, want)
+	}
+}
+
+func TestReadMultiLineValues(t *testing.T) {
+	yamlPath := writeConfig(t, "gobard.yaml", `
+sponsorblock_categories: [
+  sponsor,
+  intro,
+]
+bot_activity: >
+  folded
+  text
+lyrics_api_url: |-
+  https://lyrics.example.com
+`)
+	tomlPath := writeConfig(t, "gobard.toml", `
+sponsorblock_categories = [
+  "sponsor",  # trailing comments and commas are fine
+  "intro",
+]
+bot_activity = """
+multi-line"""
+`)
+
+	file, err := readConfigFile(yamlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"SPONSORBLOCK_CATEGORIES": "sponsor,intro",
+		"BOT_ACTIVITY":            "folded text\n",
+		"LYRICS_API_URL":          "https://lyrics.example.com",
+	}
+	if !reflect.DeepEqual(file.values, want) {
+		t.Errorf("YAML values = %q\nwant %q", file.values, want)
+	}
+
+	if file, err = readConfigFile(tomlPath); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{"SPONSORBLOCK_CATEGORIES": "sponsor,intro", "BOT_ACTIVITY": "multi-line"}
+	if !reflect.DeepEqual(file.values, want) {
+		t.Errorf("TOML values = %q\nwant %q", file.values, want)
+	}
+}
+
+func TestReadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{"bad.yaml", "cache_limit 2GB\n", "bad.yaml: yaml:"},
+		{"dup.yaml", "cache_limit: 1GB\ncache:\n  limit: 2GB\n", "CACHE_LIMIT is set more than once (as cache.limit and cache_limit)"},
+		{"twice.yaml", "cache_limit: 1GB\ncache_limit: 2GB\n", "already defined"},
+		{"list.yaml", "- sponsor\n", "list.yaml: yaml:"},
+		{"quote.yaml", "discord_token: \"abc\n", "quote.yaml: yaml:"},
+		{"nested.yaml", "categories:\n  - [a, b]\n", "categories: expected a value or a list of values"},
+		{"array.toml", "categories = [\"a\",\n", "array.toml: toml:"},
+		{"section.toml", "[cache\n", "section.toml: toml:"},
+		{"gobard.json", "{}", "must end in .yaml, .yml or .toml"},
+	}
+	for _, tt := range tests {
+		_, err := readConfigFile(writeConfig(t, tt.name, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestLoadFromFile(t *testing.T) {
+	path := writeConfig(t, "gobard.yaml", `
+discord_token: from-file
+default_volume: 80
+cache:
+  limit: 1GB
+not_a_setting: true
+`)
+	// The environment overrides the file
+	t.Setenv("DISCORD_TOKEN", "")
+	t.Setenv("DEFAULT_VOLUME", "50")
+
+	cfg, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DiscordToken != "from-file" || cfg.DefaultVolume != 50 || cfg.CacheLimit != 1<<30 {
+		t.Errorf("token %q, volume %d, cache limit %d", cfg.DiscordToken, cfg.DefaultVolume, cfg.CacheLimit)
+	}
+}
+
+func TestLoadFromFileBooleans(t *testing.T) {
+	t.Setenv("DISCORD_TOKEN", "token")
+	t.Setenv("PRE_ENCODE_CACHE", "")
+	t.Setenv("ALLOW_LIVE", "")
+
+	// YAML 1.1 spellings are strings to a YAML 1.2 parser, but still read as booleans
+	path := writeConfig(t, "gobard.yaml", "pre_encode_cache: yes\nallow_live: off\n")
+	cfg, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.PreEncodeCache || cfg.AllowLive {
+		t.Errorf("pre_encode_cache = %v, allow_live = %v; want true, false", cfg.PreEncodeCache, cfg.AllowLive)
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	t.Setenv("DISCORD_TOKEN", "")
+	path := writeConfig(t, "gobard.yaml", "opus_bitrate: 1000\nstream_mode: carrier-pigeon\n")
+
+	_, err := LoadFromFile(path)
+	if err == nil {
+		t.Fatal("LoadFromFile accepted an invalid config")
+	}
+	for _, want := range []string{"DISCORD_TOKEN is required", "OPUS_BITRATE", "STREAM_MODE"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't mention %s", err, want)
+		}
+	}
+}
+
+func TestExampleConfig(t *testing.T) {
+	t.Setenv("DISCORD_TOKEN", "token")
+
+	file, err := readConfigFile("../../config.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &settings{file: file.values}
+	if _, err := load(s); err != nil {
+		t.Fatal(err)
+	}
+	for key, name := range file.names {
+		if !s.read[key] {
+			t.Errorf("config.example.yaml sets unknown key %s", name)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package deezer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/GrainedLotus515/gobard/internal/webmeta"
+)
+
+// ErrUnreadable is returned when a link's page doesn't say what's on it
+var ErrUnreadable = errors.New("couldn't read that Deezer link")
+
+// httpClient fetches Deezer pages; tests swap its transport
+var httpClient = &http.Client{}
+
+var (
+	langPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]{2})?$`)
+	idPattern   = regexp.MustCompile(`^[0-9]+$`)
+	// listenTo matches descriptions like "Listen to Song by Artist on Deezer. With music streaming..."
+	listenTo = regexp.MustCompile(`^Listen to (.+?) by (.+?)(?: on Deezer\b|\. |\.?$)`)
+)
+
+// linkTypes are the kinds of Deezer links that can be queued
+var linkTypes = map[string]bool{"track": true, "album": true, "playlist": true}
+
+// Link is a parsed Deezer link
+type Link struct {
+	Type string // track, album or playlist
+	ID   string
+}
+
+// URL returns the English page for the link
+func (l Link) URL() string {
+	return fmt.Sprintf("https://www.deezer.com/en/%s/%s", l.Type, l.ID)
+}
+
+// IsURL reports whether a link is on a Deezer host, including share links
+func IsURL(raw string) bool {
+	u, err := neturl.Parse(strings.TrimSpace(raw))
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && isHost(u.Hostname())
+}
+
+// isHost reports whether host serves Deezer pages or share links
+func isHost(host string) bool {
+	host = strings.ToLower(host)
+	return host == "deezer.com" || host == "www.deezer.com" || isShortLinkHost(host)
+}
+
+// isShortLinkHost reports whether host serves share links that redirect to a page
+func isShortLinkHost(host string) bool {
+	host = strings.ToLower(host)
+	return host == "link.deezer.com" || host == "deezer.page.link"
+}
+
+// ParseURL parses a deezer.com track, album or playlist link; share links have to be
+// followed first, which GetTracks does
+func ParseURL(raw string) (Link, error) {
+	u, err := neturl.Parse(strings.TrimSpace(raw))
+	if err != nil || !isHost(u.Hostname()) || isShortLinkHost(u.Hostname()) {
+		return Link{}, fmt.Errorf("invalid Deezer URL")
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) > 0 && langPattern.MatchString(segments[0]) {
+		segments = segments[1:]
+	}
+	if len(segments) != 2 {
+		return Link{}, fmt.Errorf("invalid Deezer URL")
+	}
+
+	link := Link{Type: segments[0], ID: segments[1]}
+	if !linkTypes[link.Type] {
+		return Link{}, fmt.Errorf("unsupported Deezer link type %q", link.Type)
+	}
+	if !idPattern.MatchString(link.ID) {
+		return Link{}, fmt.Errorf("invalid Deezer ID %q", link.ID)
+	}
+	return link, nil
+}
+
+// GetTracks reads the track, album or playlist a link points at from its page
+// Share links are followed to the page they redirect to
+func GetTracks(ctx context.Context, raw string) (*webmeta.Import, error) {
+	u, err := neturl.Parse(strings.TrimSpace(raw))
+	if err != nil || !isHost(u.Hostname()) {
+		return nil, fmt.Errorf("invalid Deezer URL")
+	}
+
+	pageURL := u.String()
+	if !isShortLinkHost(u.Hostname()) {
+		link, err := ParseURL(raw)
+		if err != nil {
+			return nil, err
+		}
+		pageURL = link.URL()
+	}
+
+	page, err := webmeta.Fetch(ctx, httpClient, pageURL, isHost)
+	if err != nil {
+		logger.Debug("Failed to fetch Deezer page", "url", pageURL, "err", err)
+		return nil, fmt.Errorf("%w: %w", ErrUnreadable, err)
+	}
+
+	link, err := ParseURL(page.URL.String())
+	if err != nil {
+		logger.Debug("Deezer link led to an unexpected page", "url", page.URL, "err", err)
+		return nil, ErrUnreadable
+	}
+	return fromPage(link, page)
+}
+
+// fromPage builds tracks from a fetched page
+// Track pages are read from their JSON-LD, falling back to OpenGraph tags; album and playlist
+// track lists only appear in the JSON-LD
+func fromPage(link Link, page *webmeta.Page) (*webmeta.Import, error) {
+	if link.Type == "track" {
+		recording := webmeta.Recording{}
+		if len(page.Recordings) > 0 {
+			recording = page.Recordings[0]
+		}
+		if recording.Title == "" || recording.Artist == "" {
+			title, artist := splitTitle(page.Get("og:title", "twitter:title"), page.Get("og:description", "description"))
+			if recording.Title == "" {
+				recording.Title = title
+			}
+			if recording.Artist == "" {
+				recording.Artist = artist
+			}
+		}
+		if recording.Duration == 0 {
+			if seconds, err := strconv.Atoi(page.Get("music:duration", "music:song:duration")); err == nil {
+				recording.Duration = time.Duration(seconds) * time.Second
+			}
+		}
+		if recording.Title == "" || recording.Artist == "" {
+			return nil, ErrUnreadable
+		}
+
+		track := newTrack(link.ID, link.URL(), recording)
+		track.Thumbnail = page.Get("og:image")
+		return &webmeta.Import{Tracks: []*player.Track{track}}, nil
+	}
+
+	if len(page.Recordings) == 0 {
+		return nil, ErrUnreadable
+	}
+	result := &webmeta.Import{Title: page.Collection, Owner: page.Owner}
+	if result.Title == "" {
+		result.Title = page.Get("og:title")
+	}
+	thumbnail := page.Get("og:image")
+	for _, recording := range page.Recordings {
+		// Without the track's ID its match can't be remembered
+		id, url := "", link.URL()
+		if track, err := ParseURL(recording.URL); err == nil && track.Type == "track" {
+			id, url = track.ID, track.URL()
+		}
+		track := newTrack(id, url, recording)
+		track.Thumbnail = thumbnail
+		result.Tracks = append(result.Tracks, track)
+	}
+	return result, nil
+}
+
+// newTrack creates a track to be matched on YouTube
+func newTrack(id, url string, recording webmeta.Recording) *player.Track {
+	return &player.Track{
+		ID:       id,
+		Title:    recording.Title,
+		Artist:   recording.Artist,
+		URL:      url,
+		Duration: recording.Duration,
+		Source:   player.SourceDeezer,
+	}
+}
+
+// splitTitle finds a track's name and artist in its page's og:title ("Song - Artist") or
+// description ("Listen to Song by Artist on Deezer"); the description is preferred as a
+// dash in the song's name makes the title ambiguous
+func splitTitle(title, description string) (string, string) {
+	if m := listenTo.FindStringSubmatch(description); m != nil {
+		return strings.TrimSpace(m[1]), strings.TrimSpace(m[2])
+	}
+	if i := strings.LastIndex(title, " - "); i > 0 {
+		return strings.TrimSpace(title[:i]), strings.TrimSpace(title[i+3:])
+	}
+	return strings.TrimSpace(title), ""
+}
@@ -0,0 +1,141 @@
+package deezer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    Link
+		wantErr bool
+	}{
+		{name: "track", raw: "https://www.deezer.com/en/track/1103767862", want: Link{Type: "track", ID: "1103767862"}},
+		{name: "regional track", raw: "https://www.deezer.com/pt-br/track/1103767862?utm_source=share", want: Link{Type: "track", ID: "1103767862"}},
+		{name: "no language", raw: "https://deezer.com/album/302127", want: Link{Type: "album", ID: "302127"}},
+		{name: "playlist", raw: "https://www.deezer.com/fr/playlist/908622995", want: Link{Type: "playlist", ID: "908622995"}},
+		{name: "artist", raw: "https://www.deezer.com/en/artist/27", wantErr: true},
+		{name: "bad ID", raw: "https://www.deezer.com/en/track/abc", wantErr: true},
+		{name: "share link", raw: "https://link.deezer.com/s/30pDI2ZPN2YcZ8Vb4QRXK", wantErr: true},
+		{name: "other host", raw: "https://deezer.com.evil.example/en/track/1103767862", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseURL(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseURL(%q) = %+v; want an error", tt.raw, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseURL(%q) = %+v, %v; want %+v", tt.raw, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// fixtureTransport serves saved pages by path and redirects share links to their target
+type fixtureTransport struct {
+	pages     map[string]string
+	redirects map[string]string
+}
+
+func (f fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{Header: make(http.Header), Body: io.NopCloser(strings.NewReader("")), Request: req}
+	if target, ok := f.redirects[req.URL.Path]; ok {
+		resp.StatusCode, resp.Status = http.StatusFound, "302 Found"
+		resp.Header.Set("Location", target)
+		return resp, nil
+	}
+	file, ok := f.pages[req.URL.Path]
+	if !ok {
+		resp.StatusCode, resp.Status = http.StatusNotFound, "404 Not Found"
+		return resp, nil
+	}
+	body, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	resp.StatusCode, resp.Status = http.StatusOK, "200 OK"
+	resp.Body = io.NopCloser(strings.NewReader(string(body)))
+	return resp, nil
+}
+
+// serveFixtures makes httpClient use f for the rest of the test
+func serveFixtures(t *testing.T, f fixtureTransport) {
+	t.Helper()
+	old := httpClient
+	httpClient = &http.Client{Transport: f}
+	t.Cleanup(func() { httpClient = old })
+}
+
+func TestGetTracksShareLink(t *testing.T) {
+	serveFixtures(t, fixtureTransport{
+		pages:     map[string]string{"/en/track/1103767862": "testdata/track.html"},
+		redirects: map[string]string{"/s/30pDI2ZPN2YcZ8Vb4QRXK": "https://www.deezer.com/en/track/1103767862?host=0&utm_source=share"},
+	})
+
+	result, err := GetTracks(context.Background(), "https://link.deezer.com/s/30pDI2ZPN2YcZ8Vb4QRXK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Tracks) != 1 {
+		t.Fatalf("GetTracks = %+v, want one track", result)
+	}
+	track := result.Tracks[0]
+	if track.Title != "Heat Waves" || track.Artist != "Glass Animals" || track.Duration != 238*time.Second || track.ID != "1103767862" {
+		t.Errorf("track = %+v", track)
+	}
+}
+
+func TestGetTracksPlaylist(t *testing.T) {
+	serveFixtures(t, fixtureTransport{pages: map[string]string{"/en/playlist/908622995": "testdata/playlist.html"}})
+
+	result, err := GetTracks(context.Background(), "https://www.deezer.com/us/playlist/908622995")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Title != "Road Trip" || result.Owner != "Sam" || len(result.Tracks) != 2 {
+		t.Fatalf("GetTracks = %+v", result)
+	}
+	if track := result.Tracks[1]; track.Title != "Dancing Queen" || track.Artist != "ABBA" || track.Duration != 231*time.Second || track.ID != "884025" {
+		t.Errorf("second track = %+v", track)
+	}
+}
+
+func TestGetTracksRefusesOtherHosts(t *testing.T) {
+	serveFixtures(t, fixtureTransport{redirects: map[string]string{"/s/abc": "https://evil.example/en/track/1"}})
+
+	_, err := GetTracks(context.Background(), "https://link.deezer.com/s/abc")
+	if !errors.Is(err, ErrUnreadable) {
+		t.Errorf("GetTracks error = %v, want ErrUnreadable", err)
+	}
+}
+
+func TestSplitTitle(t *testing.T) {
+	tests := []struct {
+		title, description string
+		wantName           string
+		wantArtist         string
+	}{
+		{"Heat Waves - Glass Animals", "", "Heat Waves", "Glass Animals"},
+		{"Come Together - Remastered 2009 - The Beatles", "Listen to Come Together - Remastered 2009 by The Beatles on Deezer.", "Come Together - Remastered 2009", "The Beatles"},
+		{"Untitled", "", "Untitled", ""},
+	}
+	for _, tt := range tests {
+		name, artist := splitTitle(tt.title, tt.description)
+		if name != tt.wantName || artist != tt.wantArtist {
+			t.Errorf("splitTitle(%q, %q) = %q, %q; want %q, %q", tt.title, tt.description, name, artist, tt.wantName, tt.wantArtist)
+		}
+	}
+}
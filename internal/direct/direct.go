@@ -0,0 +1,285 @@
+package direct
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/GrainedLotus515/gobard/internal/tools"
+)
+
+// ErrWebPage is returned for links to HTML pages rather than audio files
+var ErrWebPage = errors.New("that link is a web page, not an audio file")
+
+// ErrTooLarge is returned by reads past the size limit, whatever the server said the size was
+var ErrTooLarge = errors.New("that file is over the size limit")
+
+const (
+	// checkTimeout bounds the request that checks a link's type and size
+	checkTimeout = 10 * time.Second
+	// probeBytes is as much of a file as ffprobe gets to read its duration and tags
+	probeBytes = 4 << 20
+	// probeTimeout bounds ffprobe reading a file's duration and tags
+	probeTimeout = 15 * time.Second
+)
+
+// audioExtensions are file extensions played even when the server doesn't send an audio type
+var audioExtensions = map[string]bool{
+	".mp3": true, ".ogg": true, ".oga": true, ".opus": true, ".flac": true,
+	".wav": true, ".m4a": true, ".aac": true, ".webm": true, ".mka": true,
+}
+
+// Client checks, probes and fetches links to audio files on web servers
+// FFmpeg and ffprobe are only ever handed bodies the client fetched, so every connection,
+// redirects included, goes through its address checks
+type Client struct {
+	httpClient   *http.Client
+	streamClient *http.Client // httpClient without the overall timeout, for playback
+	maxSize      int64        // Largest accepted file in bytes, 0 for no limit
+}
+
+// NewClient creates a client that rejects files larger than maxSize bytes (0 for no limit)
+// Links to loopback, private and link-local addresses are refused, so users can't make the
+// bot reach into the network it runs in
+func NewClient(maxSize int64) *Client {
+	return newClient(maxSize, publicOnly)
+}
+
+// newClient creates a client whose connections are vetted by control (nil allows all)
+func newClient(maxSize int64, control func(network, address string, c syscall.RawConn) error) *Client {
+	dialer := &net.Dialer{Timeout: checkTimeout, Control: control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil // A proxy would make the dialer check the proxy's address instead
+
+	transport.ResponseHeaderTimeout = checkTimeout
+
+	return &Client{
+		httpClient:   &http.Client{Transport: transport, Timeout: checkTimeout},
+		streamClient: &http.Client{Transport: transport},
+		maxSize:      maxSize,
+	}
+}
+
+// publicOnly refuses connections to addresses that aren't on the public internet
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("links to local network addresses aren't allowed")
+	}
+	return nil
+}
+
+// GetTrackInfo checks that a link points at an audio file and builds a track that streams it
+// The title and artist come from the file's tags when ffprobe can read them, otherwise the
+// file name and host are used
+func (c *Client) GetTrackInfo(rawURL string) (*player.Track, error) {
+	u, err := neturl.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid link")
+	}
+	link := u.String()
+
+	if err := c.check(link, u); err != nil {
+		return nil, err
+	}
+
+	track := &player.Track{
+		ID:     link,
+		Title:  fileName(u),
+		Artist: u.Hostname(),
+		URL:    link,
+		Source: player.SourceDirect,
+	}
+
+	info, err := c.probe(link)
+	if err != nil {
+		logger.Debug("Couldn't probe direct link, using its file name", "url", link, "err", err)
+		return track, nil
+	}
+	if title := info.tag("title"); title != "" {
+		track.Title = title
+	}
+	if artist := info.tag("artist"); artist != "" {
+		track.Artist = artist
+	}
+	if seconds, err := strconv.ParseFloat(info.Format.Duration, 64); err == nil && seconds > 0 {
+		track.Duration = time.Duration(seconds * float64(time.Second))
+	}
+	return track, nil
+}
+
+// check requests the link's headers and rejects web pages, other non-audio content and
+// files over the size limit
+// Servers that don't allow HEAD get a GET whose body is never read
+func (c *Client) check(link string, u *neturl.URL) error {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+
+	resp, err := c.request(ctx, http.MethodHead, link)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp, err = c.request(ctx, http.MethodGet, link)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't reach that link: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("that link returned %s", resp.Status)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return ErrWebPage
+	case strings.HasPrefix(mediaType, "audio/"), mediaType == "application/ogg":
+	case audioExtensions[strings.ToLower(path.Ext(u.Path))]:
+	case mediaType == "":
+		return fmt.Errorf("that link isn't an audio file")
+	default:
+		return fmt.Errorf("that link isn't an audio file (%s)", mediaType)
+	}
+
+	if c.maxSize > 0 && resp.ContentLength > c.maxSize {
+		return fmt.Errorf("that file is %d MB, over the %d MB limit", resp.ContentLength>>20, c.maxSize>>20)
+	}
+	return nil
+}
+
+// request sends a request for link; redirects go through the same address checks
+func (c *Client) request(ctx context.Context, method, link string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.httpClient.Do(req)
+}
+
+// Open fetches a link's body for playback until ctx is done
+// Reading more than the size limit fails with ErrTooLarge, so a server that sends no or a
+// false Content-Length can't get past it
+func (c *Client) Open(ctx context.Context, link string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.streamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't reach that link: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("that link returned %s", resp.Status)
+	}
+	if c.maxSize > 0 && resp.ContentLength > c.maxSize {
+		resp.Body.Close()
+		return nil, fmt.Errorf("that file is %d MB, over the %d MB limit", resp.ContentLength>>20, c.maxSize>>20)
+	}
+	if c.maxSize == 0 {
+		return resp.Body, nil
+	}
+	return &limitedBody{body: resp.Body, left: c.maxSize}, nil
+}
+
+// limitedBody fails reads once more than left bytes have been read
+type limitedBody struct {
+	body io.ReadCloser
+	left int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.left < 0 {
+		return 0, ErrTooLarge
+	}
+	// Read one byte past the limit so a file of exactly the limit still ends with io.EOF
+	if int64(len(p)) > b.left+1 {
+		p = p[:b.left+1]
+	}
+	n, err := b.body.Read(p)
+	b.left -= int64(n)
+	if b.left < 0 {
+		return n + int(b.left), ErrTooLarge
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
+
+// fileName returns the last path segment of a link, or its host if the path is empty
+func fileName(u *neturl.URL) string {
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return u.Hostname()
+	}
+	return name
+}
+
+// probeResult is the part of ffprobe's JSON output that describes the file
+type probeResult struct {
+	Format struct {
+		Duration string            `json:"duration"`
+		Tags     map[string]string `json:"tags"`
+	} `json:"format"`
+}
+
+// tag returns a tag by name; containers disagree on case, e.g. "title" vs "TITLE"
+func (r probeResult) tag(name string) string {
+	for key, value := range r.Format.Tags {
+		if strings.EqualFold(key, name) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// probe reads a file's duration and tags with ffprobe, from the first probeBytes of the
+// body Open fetches
+func (c *Client) probe(link string) (probeResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	var result probeResult
+	body, err := c.Open(ctx, link)
+	if err != nil {
+		return result, err
+	}
+	defer body.Close()
+
+	cmd := exec.CommandContext(ctx, tools.FFprobe,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-i", "pipe:0",
+	)
+	cmd.Stdin = io.LimitReader(body, probeBytes)
+	output, err := cmd.Output()
+	if err != nil {
+		return result, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return result, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,185 @@
+package direct
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/GrainedLotus515/gobard/internal/tools"
+)
+
+// fakeFFprobe points tools.FFprobe at a script printing output, and returns the file it
+// saves its arguments and stdin to
+func fakeFFprobe(t *testing.T, output string) (args, stdin string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ffprobe")
+	args, stdin = filepath.Join(dir, "args"), filepath.Join(dir, "stdin")
+	script := "#!/bin/sh\necho \"$@\" > " + args + "\ncat > " + stdin + "\ncat <<'EOF'\n" + output + "\nEOF\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := tools.FFprobe
+	tools.FFprobe = path
+	t.Cleanup(func() { tools.FFprobe = previous })
+	return args, stdin
+}
+
+// newServer serves files whose Content-Type and Content-Length come from the path
+func newServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/song.mp3", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("Content-Length", "1000")
+		if r.Method == http.MethodGet {
+			w.Write(bytes.Repeat([]byte{'a'}, 1000))
+		}
+	})
+	mux.HandleFunc("/unsized.mp3", func(w http.ResponseWriter, r *http.Request) {
+		// Flushing first sends the body chunked, with no Content-Length
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.(http.Flusher).Flush()
+		w.Write(bytes.Repeat([]byte{'a'}, 5000))
+	})
+	mux.HandleFunc("/files/My%20Song.flac", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	})
+	mux.HandleFunc("/data.bin", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	})
+	mux.HandleFunc("/huge.ogg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/ogg")
+		w.Header().Set("Content-Length", "5000")
+	})
+	mux.HandleFunc("/get-only.opus", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "audio/opus")
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetTrackInfoProbesTags(t *testing.T) {
+	args, stdin := fakeFFprobe(t, `{"format":{"duration":"183.5","tags":{"TITLE":"Tagged Title","artist":"Tagged Artist"}}}`)
+	server := newServer(t)
+
+	track, err := newClient(2000, nil).GetTrackInfo(server.URL + "/song.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if track.Source != player.SourceDirect || track.URL != server.URL+"/song.mp3" {
+		t.Errorf("track = %+v", track)
+	}
+	if track.Title != "Tagged Title" || track.Artist != "Tagged Artist" || track.Duration != 183500*time.Millisecond {
+		t.Errorf("metadata = %q by %q, %v", track.Title, track.Artist, track.Duration)
+	}
+
+	// ffprobe reads the body the client fetched, never the link itself
+	if data, err := os.ReadFile(args); err != nil || strings.Contains(string(data), server.URL) || !strings.Contains(string(data), "pipe:0") {
+		t.Errorf("ffprobe arguments = %q, %v; want pipe:0 and no link", data, err)
+	}
+	if info, err := os.Stat(stdin); err != nil || info.Size() != 1000 {
+		t.Errorf("ffprobe got %v bytes on stdin, %v; want the 1000 byte body", info, err)
+	}
+}
+
+func TestOpenEnforcesSizeLimitOnBody(t *testing.T) {
+	server := newServer(t)
+
+	body, err := newClient(2000, nil).Open(context.Background(), server.URL+"/unsized.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if !errors.Is(err, ErrTooLarge) || len(data) != 2000 {
+		t.Errorf("ReadAll = %d bytes, %v; want 2000 bytes and ErrTooLarge", len(data), err)
+	}
+
+	// A file of exactly the limit reads to the end
+	body, err = newClient(1000, nil).Open(context.Background(), server.URL+"/song.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	if data, err := io.ReadAll(body); err != nil || len(data) != 1000 {
+		t.Errorf("ReadAll = %d bytes, %v; want the whole 1000 byte file", len(data), err)
+	}
+
+	if _, err := newClient(0, nil).Open(context.Background(), server.URL+"/missing.mp3"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("missing file: err = %v", err)
+	}
+}
+
+func TestGetTrackInfoFallsBackToFileName(t *testing.T) {
+	fakeFFprobe(t, `not json`)
+	server := newServer(t)
+
+	track, err := newClient(0, nil).GetTrackInfo(server.URL + "/files/My%20Song.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if track.Title != "My Song.flac" || track.Artist != "127.0.0.1" {
+		t.Errorf("track = %q by %q, want the file name and host", track.Title, track.Artist)
+	}
+}
+
+func TestGetTrackInfoRejections(t *testing.T) {
+	fakeFFprobe(t, `{}`)
+	server := newServer(t)
+	client := newClient(2000, nil)
+
+	if _, err := client.GetTrackInfo(server.URL + "/page"); !errors.Is(err, ErrWebPage) {
+		t.Errorf("HTML page: err = %v, want ErrWebPage", err)
+	}
+	if _, err := client.GetTrackInfo(server.URL + "/data.bin"); err == nil || !strings.Contains(err.Error(), "isn't an audio file") {
+		t.Errorf("binary file: err = %v", err)
+	}
+	if _, err := client.GetTrackInfo(server.URL + "/huge.ogg"); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("oversized file: err = %v", err)
+	}
+	if _, err := client.GetTrackInfo(server.URL + "/missing.mp3"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("missing file: err = %v", err)
+	}
+	if _, err := client.GetTrackInfo("ftp://example.com/song.mp3"); err == nil {
+		t.Error("ftp link accepted")
+	}
+}
+
+func TestGetTrackInfoFallsBackToGet(t *testing.T) {
+	fakeFFprobe(t, `{}`)
+	server := newServer(t)
+
+	if _, err := newClient(0, nil).GetTrackInfo(server.URL + "/get-only.opus"); err != nil {
+		t.Errorf("server without HEAD: %v", err)
+	}
+}
+
+func TestLocalAddressesRefused(t *testing.T) {
+	server := newServer(t)
+
+	if _, err := NewClient(0).GetTrackInfo(server.URL + "/song.mp3"); err == nil || !strings.Contains(err.Error(), "local network") {
+		t.Errorf("loopback link: err = %v", err)
+	}
+	if _, err := NewClient(0).Open(context.Background(), server.URL+"/song.mp3"); err == nil || !strings.Contains(err.Error(), "local network") {
+		t.Errorf("loopback playback: err = %v", err)
+	}
+}
@@ -0,0 +1,312 @@
+// Package doctor checks that GoBard's dependencies and settings are usable, for the
+// `gobard doctor` subcommand
+package doctor
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/cache"
+	"github.com/GrainedLotus515/gobard/internal/config"
+	"github.com/GrainedLotus515/gobard/internal/spotify"
+	"github.com/GrainedLotus515/gobard/internal/tools"
+	"github.com/hraban/opus"
+)
+
+const (
+	// minFFmpegMajor and minFFmpegMinor are the oldest FFmpeg release known to work
+	minFFmpegMajor, minFFmpegMinor = 4, 1
+	// maxYtDlpAge is how old a yt-dlp release may be before YouTube changes are likely to break it
+	maxYtDlpAge = 90 * 24 * time.Hour
+	// spotifyTimeout bounds the Spotify credentials check
+	spotifyTimeout = 10 * time.Second
+)
+
+// Status is the outcome of a check
+type Status int
+
+const (
+	Pass Status = iota
+	Skip        // Not applicable with the current settings
+	Warn        // Works, but something is likely to go wrong
+	Fail        // GoBard won't work until it is fixed
+)
+
+// symbols are printed before each result
+var symbols = map[Status]string{Pass: "✅", Skip: "➖", Warn: "⚠️ ", Fail: "❌"}
+
+// Result is the outcome of one check
+type Result struct {
+	Name   string
+	Status Status
+	Detail string
+	Hint   string // How to fix a warning or failure
+}
+
+// Options selects the optional checks
+type Options struct {
+	// Encode runs FFmpeg and libopus over a generated test tone
+	Encode bool
+}
+
+// Run runs every check; cfg may be nil if the configuration couldn't be read, in which case
+// configErr says why and the checks fall back to the default tool paths
+func Run(cfg *config.Config, configErr error, opts Options) []Result {
+	results := []Result{checkConfig(configErr)}
+
+	if cfg != nil {
+		tools.FFmpeg = cfg.FFmpegPath
+		tools.FFprobe = cfg.FFprobePath
+		tools.YtDlp = cfg.YtDlpPath
+		tools.YtDlpExtraArgs = cfg.YtDlpExtraArgs
+		results = append(results, checkToken(cfg.DiscordToken))
+	}
+
+	results = append(results, checkFFmpeg(), checkFFprobe(), checkYtDlp(time.Now()), checkOpus())
+
+	if cfg != nil {
+		results = append(results, checkCacheDir(cfg), checkSpotify(cfg))
+	}
+	if opts.Encode {
+		results = append(results, checkEncode())
+	}
+	return results
+}
+
+// Print writes the results as a checklist and reports whether every critical check passed
+func Print(w io.Writer, results []Result) bool {
+	ok := true
+	for _, result := range results {
+		line := fmt.Sprintf("%s %s", symbols[result.Status], result.Name)
+		if result.Detail != "" {
+			line += ": " + result.Detail
+		}
+		fmt.Fprintln(w, line)
+		if result.Hint != "" && (result.Status == Warn || result.Status == Fail) {
+			fmt.Fprintf(w, "   → %s\n", result.Hint)
+		}
+		if result.Status == Fail {
+			ok = false
+		}
+	}
+
+	fmt.Fprintln(w)
+	if ok {
+		fmt.Fprintln(w, "All critical checks passed")
+	} else {
+		fmt.Fprintln(w, "Some critical checks failed; fix them before starting the bot")
+	}
+	return ok
+}
+
+// checkConfig reports whether the configuration is valid
+func checkConfig(err error) Result {
+	if err != nil {
+		return Result{
+			Name:   "Configuration",
+			Status: Fail,
+			Detail: strings.ReplaceAll(err.Error(), "\n", "; "),
+			Hint:   "See .env.example for every setting and its allowed values",
+		}
+	}
+	return Result{Name: "Configuration", Status: Pass, Detail: "valid"}
+}
+
+// checkToken checks that the Discord token looks like one: three dot-separated base64
+// segments, the first of which is the bot's numeric user ID
+// Whether Discord accepts it is only known once the bot logs in
+func checkToken(token string) Result {
+	result := Result{Name: "Discord token", Hint: "Copy the token from the Bot page of your application in the Discord Developer Portal"}
+
+	if token == "" {
+		result.Status, result.Detail = Fail, "DISCORD_TOKEN is not set"
+		return result
+	}
+	if strings.HasPrefix(token, "Bot ") {
+		result.Status, result.Detail = Fail, `starts with "Bot ", which GoBard adds itself`
+		result.Hint = `Remove "Bot " from the start of DISCORD_TOKEN`
+		return result
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		result.Status, result.Detail = Fail, "not in the id.timestamp.signature format"
+		return result
+	}
+
+	id, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[0], "="))
+	if err != nil {
+		id, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(parts[0], "="))
+	}
+	if err != nil || len(id) == 0 || strings.Trim(string(id), "0123456789") != "" {
+		result.Status, result.Detail = Fail, "the first part doesn't encode a user ID"
+		return result
+	}
+
+	result.Status, result.Detail = Pass, "well-formed, for bot user "+string(id)
+	return result
+}
+
+// checkFFmpeg checks that FFmpeg runs and is recent enough
+func checkFFmpeg() Result {
+	result := Result{Name: "FFmpeg", Hint: "Install FFmpeg 4.1 or newer, or point FFMPEG_PATH at it"}
+
+	version, err := tools.FFmpegVersion()
+	if err != nil {
+		result.Status, result.Detail = Fail, fmt.Sprintf("%s: %v", tools.FFmpeg, err)
+		return result
+	}
+
+	result.Detail = version
+	major, minor, ok := ffmpegRelease(version)
+	switch {
+	case !ok:
+		// Development builds like "N-112345-g0123abcd" have no release number
+		result.Status = Pass
+		result.Detail += " (development build)"
+	case major < minFFmpegMajor || (major == minFFmpegMajor && minor < minFFmpegMinor):
+		result.Status = Warn
+		result.Detail += fmt.Sprintf(" is older than %d.%d", minFFmpegMajor, minFFmpegMinor)
+	default:
+		result.Status = Pass
+	}
+	return result
+}
+
+// ffmpegReleasePattern matches release versions like "6.1.1", "n6.1" or "4.4.2-0ubuntu0.22.04.1"
+var ffmpegReleasePattern = regexp.MustCompile(`^n?(\d+)\.(\d+)`)
+
+// ffmpegRelease returns the major and minor release of an FFmpeg version string
+func ffmpegRelease(version string) (major, minor int, ok bool) {
+	m := ffmpegReleasePattern.FindStringSubmatch(version)
+	if m == nil {
+		return 0, 0, false
+	}
+	major, _ = strconv.Atoi(m[1])
+	minor, _ = strconv.Atoi(m[2])
+	return major, minor, true
+}
+
+// checkFFprobe checks for FFprobe, which only some features need
+func checkFFprobe() Result {
+	version, err := tools.FFprobeVersion()
+	if err != nil {
+		return Result{
+			Name:   "FFprobe",
+			Status: Warn,
+			Detail: fmt.Sprintf("%s: %v", tools.FFprobe, err),
+			Hint:   "FFprobe comes with FFmpeg; without it direct links have no tags and cached files aren't verified. Set FFPROBE_PATH if it is installed elsewhere",
+		}
+	}
+	return Result{Name: "FFprobe", Status: Pass, Detail: version}
+}
+
+// checkYtDlp checks that yt-dlp runs and was released recently, as YouTube changes often
+// break older releases
+func checkYtDlp(now time.Time) Result {
+	result := Result{Name: "yt-dlp", Hint: "Install yt-dlp, or point YTDLP_PATH at it"}
+
+	version, err := tools.YtDlpVersion()
+	if err != nil {
+		result.Status, result.Detail = Fail, fmt.Sprintf("%s: %v", tools.YtDlp, err)
+		return result
+	}
+
+	result.Status, result.Detail = Pass, version
+	if released, ok := ytDlpRelease(version); ok && now.Sub(released) > maxYtDlpAge {
+		result.Status = Warn
+		result.Detail += fmt.Sprintf(" is %d days old", int(now.Sub(released).Hours()/24))
+		result.Hint = "Update it with `yt-dlp -U` (or your package manager); old releases stop working as YouTube changes"
+	}
+	return result
+}
+
+// ytDlpRelease returns the release date in a yt-dlp version like "2024.08.06" or
+// "2024.08.06.232701"
+func ytDlpRelease(version string) (time.Time, bool) {
+	if len(version) < len("2006.01.02") {
+		return time.Time{}, false
+	}
+	released, err := time.Parse("2006.01.02", version[:len("2006.01.02")])
+	return released, err == nil
+}
+
+// checkOpus checks that libopus can create an encoder
+func checkOpus() Result {
+	if _, err := opus.NewEncoder(48000, 2, opus.AppAudio); err != nil {
+		return Result{
+			Name:   "libopus",
+			Status: Fail,
+			Detail: err.Error(),
+			Hint:   "Install libopus (libopus0 / opus) and rebuild; the build also needs libopus-dev and pkg-config",
+		}
+	}
+	return Result{Name: "libopus", Status: Pass, Detail: opus.Version()}
+}
+
+// checkCacheDir checks that the cache directory can be written and reports its free space
+func checkCacheDir(cfg *config.Config) Result {
+	result := Result{Name: "Cache directory", Hint: fmt.Sprintf("Create %s and make it writable by the bot's user, or change CACHE_DIR", cfg.CacheDir)}
+
+	if err := os.MkdirAll(cfg.CacheDir, 0755); err != nil {
+		result.Status, result.Detail = Fail, err.Error()
+		return result
+	}
+	probe, err := os.CreateTemp(cfg.CacheDir, ".doctor-*")
+	if err != nil {
+		result.Status, result.Detail = Fail, fmt.Sprintf("%s isn't writable: %v", cfg.CacheDir, err)
+		return result
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	dir, _ := filepath.Abs(cfg.CacheDir)
+	result.Status, result.Detail = Pass, dir+" is writable"
+
+	free, err := cache.FreeSpace(cfg.CacheDir)
+	switch {
+	case errors.Is(err, errors.ErrUnsupported):
+		result.Detail += "; free space can't be read on this system"
+	case err != nil:
+		result.Detail += fmt.Sprintf("; free space unknown: %v", err)
+	default:
+		result.Detail += fmt.Sprintf(", %d MB free", free>>20)
+		if free < cfg.CacheMinFree+cfg.CacheLimit {
+			result.Status = Warn
+			result.Hint = fmt.Sprintf("A full cache (CACHE_LIMIT, %d MB) plus the reserve (CACHE_MIN_FREE, %d MB) doesn't fit; free up space or lower them", cfg.CacheLimit>>20, cfg.CacheMinFree>>20)
+		}
+	}
+	return result
+}
+
+// checkSpotify checks that Spotify accepts the client credentials, if they are set
+func checkSpotify(cfg *config.Config) Result {
+	result := Result{Name: "Spotify credentials"}
+	if cfg.SpotifyClientID == "" || cfg.SpotifySecret == "" {
+		result.Status, result.Detail = Skip, "not configured; Spotify links won't work"
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), spotifyTimeout)
+	defer cancel()
+	err := spotify.CheckCredentials(ctx, cfg.SpotifyClientID, cfg.SpotifySecret)
+	switch {
+	case errors.Is(err, spotify.ErrInvalidCredentials):
+		result.Status, result.Detail = Fail, "rejected by Spotify"
+		result.Hint = "Check SPOTIFY_CLIENT_ID and SPOTIFY_CLIENT_SECRET on your app in the Spotify Developer Dashboard"
+	case err != nil:
+		result.Status, result.Detail = Warn, err.Error()
+		result.Hint = "Spotify couldn't be reached; check the network connection"
+	default:
+		result.Status, result.Detail = Pass, "accepted"
+	}
+	return result
+}
@@ -0,0 +1,112 @@
+package doctor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/tools"
+)
+
+func TestCheckToken(t *testing.T) {
+	id := base64.RawStdEncoding.EncodeToString([]byte("123456789012345678"))
+	tests := []struct {
+		token string
+		want  Status
+	}{
+		{id + ".GhJkLm.abcdefghijklmnopqrstuvwxyz0123456789", Pass},
+		{"Bot " + id + ".GhJkLm.signature", Fail},
+		{"", Fail},
+		{"not-a-token", Fail},
+		{id + "..signature", Fail},
+		{base64.RawStdEncoding.EncodeToString([]byte("username")) + ".GhJkLm.signature", Fail},
+	}
+	for _, tt := range tests {
+		if got := checkToken(tt.token); got.Status != tt.want {
+			t.Errorf("checkToken(%q) = %v (%s), want %v", tt.token, got.Status, got.Detail, tt.want)
+		}
+	}
+}
+
+func TestFFmpegRelease(t *testing.T) {
+	tests := []struct {
+		version      string
+		major, minor int
+		ok           bool
+	}{
+		{"6.1.1", 6, 1, true},
+		{"n7.0", 7, 0, true},
+		{"4.4.2-0ubuntu0.22.04.1", 4, 4, true},
+		{"N-112345-g0123abcd", 0, 0, false},
+	}
+	for _, tt := range tests {
+		major, minor, ok := ffmpegRelease(tt.version)
+		if major != tt.major || minor != tt.minor || ok != tt.ok {
+			t.Errorf("ffmpegRelease(%q) = %d, %d, %v", tt.version, major, minor, ok)
+		}
+	}
+}
+
+// fakeYtDlp installs a yt-dlp that reports version
+func fakeYtDlp(t *testing.T, version string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "yt-dlp")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\necho "+version+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := tools.YtDlp
+	tools.YtDlp = path
+	t.Cleanup(func() { tools.YtDlp = old })
+}
+
+func TestCheckYtDlp(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	fakeYtDlp(t, "2025.05.22")
+	if result := checkYtDlp(now); result.Status != Pass {
+		t.Errorf("recent release: %v (%s)", result.Status, result.Detail)
+	}
+
+	fakeYtDlp(t, "2024.08.06.232701")
+	if result := checkYtDlp(now); result.Status != Warn || !strings.Contains(result.Detail, "299 days old") {
+		t.Errorf("old release: %v (%s)", result.Status, result.Detail)
+	}
+
+	tools.YtDlp = filepath.Join(t.TempDir(), "missing")
+	if result := checkYtDlp(now); result.Status != Fail {
+		t.Errorf("missing yt-dlp: %v (%s)", result.Status, result.Detail)
+	}
+}
+
+func TestTestTone(t *testing.T) {
+	tone := testTone(48000, 2, time.Second)
+	if len(tone) != 44+48000*2*2 {
+		t.Fatalf("tone is %d bytes", len(tone))
+	}
+	if !bytes.HasPrefix(tone, []byte("RIFF")) || string(tone[8:16]) != "WAVEfmt " || string(tone[36:40]) != "data" {
+		t.Errorf("bad WAV header % x", tone[:44])
+	}
+}
+
+func TestPrintReportsFailures(t *testing.T) {
+	var out bytes.Buffer
+	ok := Print(&out, []Result{
+		{Name: "FFmpeg", Status: Pass, Detail: "6.1.1"},
+		{Name: "FFprobe", Status: Warn, Detail: "not found", Hint: "install it"},
+	})
+	if !ok {
+		t.Error("warnings alone shouldn't fail")
+	}
+	if !strings.Contains(out.String(), "→ install it") {
+		t.Errorf("hint missing from output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if Print(&out, []Result{{Name: "yt-dlp", Status: Fail, Detail: "not found"}}) {
+		t.Error("a failed check should fail")
+	}
+}
@@ -0,0 +1,121 @@
+package doctor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/player"
+)
+
+const (
+	// toneDuration is the length of the test tone
+	toneDuration = 2 * time.Second
+	// toneFrequency is the test tone's pitch in Hz
+	toneFrequency = 440
+	// encodeTimeout bounds the whole encode check
+	encodeTimeout = 30 * time.Second
+)
+
+// checkEncode runs a test tone through FFmpeg and libopus, the same path playback uses, and
+// checks that the expected number of frames comes out
+func checkEncode() Result {
+	result := Result{Name: "Encode test", Hint: "Run with DEBUG=true and play a track to see FFmpeg's output; a wrong frame count usually means a broken FFmpeg build"}
+
+	settings := player.DefaultAudioSettings()
+	tone := testTone(settings.SampleRate, settings.Channels, toneDuration)
+	encoder, err := player.NewEncoder(player.EncoderConfig{
+		AudioSettings: settings,
+		Input:         "pipe:0",
+		Reader:        bytes.NewReader(tone),
+	})
+	if err != nil {
+		result.Status, result.Detail = Fail, err.Error()
+		return result
+	}
+	defer encoder.Cleanup()
+
+	frames, err := countFrames(encoder, encodeTimeout)
+	if err != nil {
+		result.Status, result.Detail = Fail, err.Error()
+		if msg := encoder.Messages(); msg != "" {
+			result.Detail += ": " + msg
+		}
+		return result
+	}
+
+	// FFmpeg may pad or drop the last partial frame
+	want := int(toneDuration / settings.FrameDuration)
+	if frames < want-1 || frames > want+1 {
+		result.Status, result.Detail = Fail, fmt.Sprintf("got %d Opus frames from a %s tone, want %d", frames, toneDuration, want)
+		return result
+	}
+	result.Status, result.Detail = Pass, fmt.Sprintf("%d Opus frames from a %s tone", frames, toneDuration)
+	return result
+}
+
+// countFrames reads every frame from encoder, giving up after timeout
+func countFrames(encoder *player.Encoder, timeout time.Duration) (int, error) {
+	type count struct {
+		frames int
+		err    error
+	}
+	done := make(chan count, 1)
+	go func() {
+		frames := 0
+		for {
+			_, err := encoder.OpusFrame()
+			if errors.Is(err, io.EOF) {
+				done <- count{frames, nil}
+				return
+			}
+			if err != nil {
+				done <- count{frames, err}
+				return
+			}
+			frames++
+		}
+	}()
+
+	select {
+	case c := <-done:
+		return c.frames, c.err
+	case <-time.After(timeout):
+		return 0, fmt.Errorf("encoding didn't finish within %s", timeout)
+	}
+}
+
+// testTone returns a WAV file holding a sine tone, so the encode check needs no network
+// or sample file
+func testTone(sampleRate, channels int, duration time.Duration) []byte {
+	samples := int(duration.Seconds() * float64(sampleRate))
+	dataSize := samples * channels * 2
+
+	var buf bytes.Buffer
+	buf.Grow(44 + dataSize)
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))                    // fmt chunk size
+	binary.Write(&buf, binary.LittleEndian, uint16(1))                     // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(channels))              // channels
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))            // sample rate
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*channels*2)) // byte rate
+	binary.Write(&buf, binary.LittleEndian, uint16(channels*2))            // block align
+	binary.Write(&buf, binary.LittleEndian, uint16(16))                    // bits per sample
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+
+	for i := range samples {
+		// Half volume, so resampling can't clip
+		sample := int16(math.Sin(2*math.Pi*toneFrequency*float64(i)/float64(sampleRate)) * math.MaxInt16 / 2)
+		for range channels {
+			binary.Write(&buf, binary.LittleEndian, sample)
+		}
+	}
+	return buf.Bytes()
+}
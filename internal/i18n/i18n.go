@@ -0,0 +1,237 @@
+// Package i18n translates the messages GoBard shows users
+//
+// Each locale is a JSON file in locales/, named after its Discord locale code (like pt-BR.json),
+// that maps message keys to text/template strings such as "Skipped to: **{{.title}}**".
+// Messages that count something give their plural forms instead, like
+// {"one": "{{.count}} track", "other": "{{.count}} tracks"}, picked by the "count" argument.
+// A message missing from a locale falls back to the default locale, so translations can be partial
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// Default is the locale every message exists in, used when no other locale has it
+const Default = "en-US"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// catalog holds one locale's messages, by key and then plural form
+type catalog map[string]map[string]*template.Template
+
+// catalogs are the embedded locales by code
+var catalogs = mustLoad()
+
+// mustLoad parses the embedded locales; they are part of the binary, so a bad one is a bug
+func mustLoad() map[string]catalog {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	catalogs := make(map[string]catalog, len(entries))
+	for _, entry := range entries {
+		data, err := localeFiles.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		code := strings.TrimSuffix(entry.Name(), ".json")
+		c, err := parseCatalog(code, data)
+		if err != nil {
+			panic(fmt.Sprintf("invalid locale %s: %v", entry.Name(), err))
+		}
+		catalogs[code] = c
+	}
+	if _, ok := catalogs[Default]; !ok {
+		panic("missing default locale " + Default)
+	}
+	return catalogs
+}
+
+// parseCatalog parses a locale file
+func parseCatalog(code string, data []byte) (catalog, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	c := make(catalog, len(raw))
+	for key, value := range raw {
+		forms := make(map[string]string)
+		var text string
+		if err := json.Unmarshal(value, &text); err == nil {
+			forms["other"] = text
+		} else if err := json.Unmarshal(value, &forms); err != nil {
+			return nil, fmt.Errorf("%s: want a string or plural forms", key)
+		}
+		if _, ok := forms["other"]; !ok {
+			return nil, fmt.Errorf("%s: missing the \"other\" plural form", key)
+		}
+
+		c[key] = make(map[string]*template.Template, len(forms))
+		for form, text := range forms {
+			tmpl, err := template.New(code + ":" + key).Option("missingkey=zero").Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			c[key][form] = tmpl
+		}
+	}
+	return c, nil
+}
+
+// Locales returns the codes of the available locales, sorted
+func Locales() []string {
+	codes := make([]string, 0, len(catalogs))
+	for code := range catalogs {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	return codes
+}
+
+// Match returns the available locale for a Discord locale code, matching by language if
+// there's no exact match (en-GB gets en-US), or "" if there is none
+func Match(locale string) string {
+	if _, ok := catalogs[locale]; ok {
+		return locale
+	}
+	language, _, _ := strings.Cut(locale, "-")
+	if language == "" {
+		return ""
+	}
+	for _, code := range Locales() {
+		if strings.EqualFold(code, language) || strings.HasPrefix(strings.ToLower(code), strings.ToLower(language)+"-") {
+			return code
+		}
+	}
+	return ""
+}
+
+// T returns a message in a locale, filled in from args given as key-value pairs like
+// "title", track.Title; a "count" argument picks the plural form, and a *Message argument
+// is translated into the same locale
+// An unknown key is returned as it is, so a missing message shows up without breaking the reply
+func T(locale, key string, args ...any) string {
+	forms, locale := lookup(locale, key)
+	if forms == nil {
+		return key
+	}
+
+	data := make(map[string]any, len(args)/2)
+	for idx := 0; idx+1 < len(args); idx += 2 {
+		name, ok := args[idx].(string)
+		if !ok {
+			continue
+		}
+		if m, ok := args[idx+1].(*Message); ok {
+			data[name] = m.In(locale)
+		} else {
+			data[name] = args[idx+1]
+		}
+	}
+
+	tmpl := forms["other"]
+	if count, ok := toInt(data["count"]); ok {
+		if form, ok := forms[pluralForm(locale, count)]; ok {
+			tmpl = form
+		}
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return key
+	}
+	return sb.String()
+}
+
+// lookup finds a message in a locale or the default one, returning the locale it came from
+func lookup(locale, key string) (map[string]*template.Template, string) {
+	if code := Match(locale); code != "" {
+		if forms, ok := catalogs[code][key]; ok {
+			return forms, code
+		}
+	}
+	return catalogs[Default][key], Default
+}
+
+// Has reports whether a locale itself has a message, without falling back to the default
+func Has(locale, key string) bool {
+	_, ok := catalogs[locale][key]
+	return ok
+}
+
+// toInt returns a count argument as an int
+func toInt(value any) (int, bool) {
+	switch n := value.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case int32:
+		return int(n), true
+	}
+	return 0, false
+}
+
+// pluralRules pick the plural form of a count in languages where it isn't "one" for
+// exactly 1 and "other" otherwise; add a language here when a locale needs another rule
+var pluralRules = map[string]func(n int) string{
+	// Portuguese and French treat 0 as singular, "0 faixa"
+	"pt": zeroOrOne,
+	"fr": zeroOrOne,
+}
+
+// pluralForm returns the plural form, "one" or "other", of a count in a locale's language
+func pluralForm(locale string, n int) string {
+	language, _, _ := strings.Cut(locale, "-")
+	if rule, ok := pluralRules[language]; ok {
+		return rule(n)
+	}
+	if n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+// zeroOrOne is the plural rule of languages where 0 and 1 are singular
+func zeroOrOne(n int) string {
+	if n == 0 || n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+// Message is a message to be translated once the reader's locale is known
+// As an error its text is in the default locale, so handlers can return it like any other
+// error and have the reply translated
+type Message struct {
+	Key  string
+	Args []any
+}
+
+// New returns a message to translate later; see T for the arguments
+func New(key string, args ...any) *Message {
+	return &Message{Key: key, Args: args}
+}
+
+// Error returns a translatable error; see T for the arguments
+func Error(key string, args ...any) error {
+	return New(key, args...)
+}
+
+// Error returns the message in the default locale
+func (m *Message) Error() string {
+	return T(Default, m.Key, m.Args...)
+}
+
+// In returns the message in a locale
+func (m *Message) In(locale string) string {
+	return T(locale, m.Key, m.Args...)
+}
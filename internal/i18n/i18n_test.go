@@ -0,0 +1,117 @@
+package i18n
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"text/template/parse"
+)
+
+func TestLocalesOnlyTranslateDefaultMessages(t *testing.T) {
+	for code, c := range catalogs {
+		for key, forms := range c {
+			// Command descriptions are defined with the commands, so only translations have them
+			if strings.HasPrefix(key, "command.") {
+				continue
+			}
+			defaults, ok := catalogs[Default][key]
+			if !ok {
+				t.Errorf("%s has %s, which %s doesn't", code, key, Default)
+				continue
+			}
+			want := fields(defaults["other"].Tree.Root)
+			for form, tmpl := range forms {
+				for field := range fields(tmpl.Tree.Root) {
+					if !want[field] {
+						t.Errorf("%s %s (%s) uses .%s, which %s doesn't pass", code, key, form, field, Default)
+					}
+				}
+			}
+		}
+	}
+}
+
+// fields returns the names of the arguments a template uses
+func fields(node parse.Node) map[string]bool {
+	found := make(map[string]bool)
+	var walk func(parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n != nil {
+				for _, child := range n.Nodes {
+					walk(child)
+				}
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.PipeNode:
+			if n != nil {
+				for _, cmd := range n.Cmds {
+					for _, arg := range cmd.Args {
+						walk(arg)
+					}
+				}
+			}
+		case *parse.FieldNode:
+			found[n.Ident[0]] = true
+		}
+	}
+	walk(node)
+	return found
+}
+
+func TestT(t *testing.T) {
+	tests := []struct {
+		locale, key string
+		args        []any
+		want        string
+	}{
+		{"en-US", "skip.done", []any{"title", "Song"}, "⏭️ Skipped to: **Song**"},
+		{"en-GB", "queue.footer", []any{"count", 1}, "1 track"},
+		{"en-US", "queue.footer", []any{"count", 0}, "0 tracks"},
+		{"pt-BR", "queue.footer", []any{"count", 0}, "0 faixa"},
+		{"pt-BR", "queue.footer", []any{"count", 2}, "2 faixas"},
+		{"pt-BR", "error", []any{"error", New("error.no_songs")}, "🚫 eita: nenhuma música encontrada"},
+		{"pt-BR", "error", []any{"error", fmt.Errorf("yt-dlp failed")}, "🚫 eita: yt-dlp failed"},
+		{"ja", "stop.done", nil, "⏹️ Stopped and cleared queue"},
+		{"", "stop.done", nil, "⏹️ Stopped and cleared queue"},
+		{"pt-BR", "no.such.key", nil, "no.such.key"},
+		{"en-US", "import.missing_list", []any{"names", "a, b", "more", 0}, "a, b"},
+		{"en-US", "import.missing_list", []any{"names", "a, b", "more", 3}, "a, b +3 more"},
+	}
+	for _, tt := range tests {
+		if got := T(tt.locale, tt.key, tt.args...); got != tt.want {
+			t.Errorf("T(%q, %q) = %q, want %q", tt.locale, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := map[string]string{
+		"en-US": "en-US",
+		"en-GB": "en-US",
+		"pt-BR": "pt-BR",
+		"ja":    "",
+		"":      "",
+	}
+	for locale, want := range tests {
+		if got := Match(locale); got != want {
+			t.Errorf("Match(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+func TestMessageError(t *testing.T) {
+	err := Error("error.missing_option", "option", "query")
+	if got, want := err.Error(), "the query option is required"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if got, want := err.(*Message).In("pt-BR"), "a opção query é obrigatória"; got != want {
+		t.Errorf("In(pt-BR) = %q, want %q", got, want)
+	}
+}
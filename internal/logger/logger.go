@@ -1,46 +1,71 @@
 package logger
 
 import (
+	"fmt"
 	"os"
+	"slices"
+	"time"
 
 	"github.com/charmbracelet/log"
 )
 
 var Logger *log.Logger
 
-// debugMode controls whether timing/debug logs are shown
-var debugMode bool
-
 func init() {
 	Logger = log.New(os.Stderr)
 	Logger.SetReportCaller(false)
 	Logger.SetReportTimestamp(true)
 
-	// Default to Info level, DEBUG env var will override via SetDebugMode
+	// Default to Info level; LOG_LEVEL and DEBUG override it via SetLevel
 	Logger.SetLevel(log.InfoLevel)
 }
 
-// SetDebugMode enables or disables debug logging
-func SetDebugMode(enabled bool) {
-	debugMode = enabled
-	if enabled {
-		Logger.SetLevel(log.DebugLevel)
+// Levels are the log levels SetLevel accepts
+var Levels = []string{"debug", "info", "warn", "error"}
+
+// Formats are the log formats SetFormat accepts
+var Formats = []string{"text", "json"}
+
+// SetLevel sets the lowest level that is logged: debug, info, warn, or error
+func SetLevel(level string) error {
+	if !slices.Contains(Levels, level) {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	parsed, _ := log.ParseLevel(level)
+	Logger.SetLevel(parsed)
+	if parsed == log.DebugLevel {
 		Logger.Info("Debug mode enabled")
-	} else {
-		Logger.SetLevel(log.InfoLevel)
 	}
+	return nil
+}
+
+// SetFormat sets how log lines are written: text for people, json for log collectors
+func SetFormat(format string) error {
+	switch format {
+	case "text":
+		Logger.SetFormatter(log.TextFormatter)
+	case "json":
+		Logger.SetFormatter(log.JSONFormatter)
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	return nil
 }
 
-// IsDebugMode returns whether debug mode is enabled
+// SetShard adds the gateway shard to every log line, so the logs of a sharded bot's
+// processes can be told apart; call it before logging from other goroutines
+func SetShard(id, count int) {
+	Logger = Logger.With("shard", fmt.Sprintf("%d/%d", id, count))
+}
+
+// IsDebugMode returns whether debug logs are shown
 func IsDebugMode() bool {
-	return debugMode
+	return Logger.GetLevel() <= log.DebugLevel
 }
 
-// Timing logs timing information (only shown when DEBUG=true)
+// Timing logs timing information (only shown at the debug level)
 func Timing(msg string, keyvals ...any) {
-	if debugMode {
-		Logger.Debug("⏱️ "+msg, keyvals...)
-	}
+	Logger.Debug("⏱️ "+msg, keyvals...)
 }
 
 // Playback logging functions
@@ -68,8 +93,20 @@ func PlaybackEncodingError(err error) {
 	Logger.Error("❌ Encoder error", "err", err)
 }
 
+func PlaybackEndedEarly(title string, position, duration time.Duration, messages string) {
+	Logger.Error("❌ Track ended early", "title", title, "position", position.Round(time.Second), "duration", duration, "ffmpeg", messages)
+}
+
+func PlaybackBitrate(bitrate, channelBitrate int) {
+	Logger.Info("🎚️  Encoder bitrate", "kbps", bitrate/1000, "channel_kbps", channelBitrate/1000)
+}
+
 func PlaybackVoiceWaiting() {
-	Logger.Debug("⏳ Waiting for voice connection to stabilize")
+	Logger.Debug("⏳ Waiting for voice connection to be ready")
+}
+
+func PlaybackVoiceReady(waited time.Duration) {
+	Logger.Debug("🔊 Voice connection ready", "waited", waited.Round(time.Millisecond))
 }
 
 func PlaybackSpeakingStart() {
@@ -108,6 +145,15 @@ func PlaybackStopped(count int) {
 	Logger.Warn("⏹️  Playback stopped", "frames_sent", count)
 }
 
+// SponsorBlock logging
+func SponsorBlockSkipping(category string, from, to time.Duration) {
+	Logger.Info("⏭️  Skipping SponsorBlock segment", "category", category, "from", from, "to", to)
+}
+
+func SponsorBlockSummary(title string, total time.Duration) {
+	Logger.Info("⏭️  SponsorBlock skipped", "title", title, "total", total)
+}
+
 // Voice connection logging
 func VoiceConnecting(channel string) {
 	Logger.Info("🔗 Connecting to voice channel", "channel", channel)
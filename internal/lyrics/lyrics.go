@@ -0,0 +1,229 @@
+// Package lyrics looks up song lyrics from LRCLIB or another server with the same API
+package lyrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the public LRCLIB API, which needs no key
+const DefaultAPIURL = "https://lrclib.net/api"
+
+// userAgent identifies the bot to the API, as LRCLIB asks clients to
+const userAgent = "GoBard (https://github.com/GrainedLotus515/GoBard)"
+
+// ErrNotFound is returned when there are no lyrics for a song
+var ErrNotFound = errors.New("no lyrics found")
+
+// Lyrics are one song's lyrics
+type Lyrics struct {
+	ID           int
+	Artist       string
+	Title        string
+	Plain        string
+	Synced       []Line // Empty if the song has no synced lyrics
+	Instrumental bool
+}
+
+// Line is a line of synced lyrics and when it is sung
+type Line struct {
+	At   time.Duration
+	Text string
+}
+
+// apiRecord is a song as returned by the API
+type apiRecord struct {
+	ID           int     `json:"id"`
+	TrackName    string  `json:"trackName"`
+	ArtistName   string  `json:"artistName"`
+	Duration     float64 `json:"duration"`
+	Instrumental bool    `json:"instrumental"`
+	PlainLyrics  string  `json:"plainLyrics"`
+	SyncedLyrics string  `json:"syncedLyrics"`
+}
+
+// Client handles lyrics API requests
+type Client struct {
+	httpClient *http.Client
+	apiURL     string
+}
+
+// NewClient creates a client for the API at apiURL, or LRCLIB's if it is empty
+func NewClient(apiURL string, timeout time.Duration) *Client {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &Client{
+		httpClient: &http.Client{Timeout: timeout},
+		apiURL:     strings.TrimSuffix(apiURL, "/"),
+	}
+}
+
+// Find returns the lyrics of a song by artist and title, cleaned with CleanTitle first
+// An exact lookup is tried before a search, which copes with titles that don't quite match
+func (c *Client) Find(ctx context.Context, artist, title string, duration time.Duration) (*Lyrics, error) {
+	artist, title = CleanTitle(artist, title)
+
+	params := url.Values{}
+	params.Set("artist_name", artist)
+	params.Set("track_name", title)
+	if duration > 0 {
+		params.Set("duration", strconv.Itoa(int(duration.Seconds())))
+	}
+	var record apiRecord
+	err := c.get(ctx, "/get?"+params.Encode(), &record)
+	if err == nil {
+		return record.lyrics(), nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	return c.Search(ctx, strings.TrimSpace(artist+" "+title))
+}
+
+// Search returns the lyrics of the best match for a free-form query like "artist title"
+func (c *Client) Search(ctx context.Context, query string) (*Lyrics, error) {
+	var records []apiRecord
+	if err := c.get(ctx, "/search?"+url.Values{"q": {query}}.Encode(), &records); err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if record.PlainLyrics != "" || record.SyncedLyrics != "" || record.Instrumental {
+			return record.lyrics(), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// get fetches an API path into v; a 404 is ErrNotFound
+func (c *Client) get(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build lyrics request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query lyrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("lyrics API returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse lyrics response: %w", err)
+	}
+	return nil
+}
+
+// lyrics converts an API record
+func (r apiRecord) lyrics() *Lyrics {
+	l := &Lyrics{
+		ID:           r.ID,
+		Artist:       r.ArtistName,
+		Title:        r.TrackName,
+		Plain:        strings.TrimSpace(r.PlainLyrics),
+		Synced:       ParseLRC(r.SyncedLyrics),
+		Instrumental: r.Instrumental,
+	}
+	// Some songs only have synced lyrics
+	if l.Plain == "" && len(l.Synced) > 0 {
+		texts := make([]string, len(l.Synced))
+		for idx, line := range l.Synced {
+			texts[idx] = line.Text
+		}
+		l.Plain = strings.Join(texts, "\n")
+	}
+	return l
+}
+
+// noisePattern matches bracketed parts of video titles that aren't part of the song title,
+// like "(Official Video)" or "[4K Remaster]"
+var noisePattern = regexp.MustCompile(`(?i)\s*[(\[][^)\]]*\b(official|video|audio|lyrics?|visuali[sz]er|hd|hq|4k|remaster(ed)?|m/?v|explicit|clean)\b[^)\]]*[)\]]`)
+
+// remasterSuffix matches a remaster note after a dash, like "Song - Remastered 2011"
+var remasterSuffix = regexp.MustCompile(`(?i)\s+-\s+(\d{4}\s+)?remaster(ed)?\b.*$`)
+
+// featPattern matches a featured artist at the end of a title
+var featPattern = regexp.MustCompile(`(?i)\s*[(\[]?\s*\b(feat|ft)\.?\s.*$`)
+
+// channelSuffix matches what YouTube appends to artists' channel names
+var channelSuffix = regexp.MustCompile(`(?i)(\s+-\s+topic|vevo|\s+official)$`)
+
+// CleanTitle strips video noise like "(Official Video)" and featured artists from a title,
+// and takes the artist from titles like "Artist - Title" when the uploader is a channel
+func CleanTitle(artist, title string) (string, string) {
+	title = noisePattern.ReplaceAllString(title, "")
+	title = remasterSuffix.ReplaceAllString(title, "")
+	title = featPattern.ReplaceAllString(title, "")
+	artist = strings.TrimSpace(channelSuffix.ReplaceAllString(artist, ""))
+
+	if left, right, ok := strings.Cut(title, " - "); ok {
+		left, right = strings.TrimSpace(left), strings.TrimSpace(right)
+		if artist == "" || strings.EqualFold(left, artist) || !strings.Contains(strings.ToLower(right), strings.ToLower(artist)) {
+			artist, title = left, right
+		}
+	}
+	return artist, strings.TrimSpace(title)
+}
+
+// timestampPattern matches an LRC timestamp like [01:23.45]
+var timestampPattern = regexp.MustCompile(`\[(\d+):(\d{2})(?:[.:](\d{1,3}))?\]`)
+
+// ParseLRC parses LRC synced lyrics into lines in the order they are sung
+// A line with several timestamps is sung at each of them; tags like [ar:Artist] are skipped
+func ParseLRC(text string) []Line {
+	var lines []Line
+	for _, raw := range strings.Split(text, "\n") {
+		raw = strings.TrimSpace(raw)
+		stamps := timestampPattern.FindAllStringSubmatchIndex(raw, -1)
+		if len(stamps) == 0 {
+			continue
+		}
+		end := 0
+		var times []time.Duration
+		for _, stamp := range stamps {
+			if stamp[0] != end {
+				break
+			}
+			end = stamp[1]
+			minutes, _ := strconv.Atoi(raw[stamp[2]:stamp[3]])
+			seconds, _ := strconv.Atoi(raw[stamp[4]:stamp[5]])
+			at := time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+			if stamp[6] >= 0 {
+				fraction := raw[stamp[6]:stamp[7]]
+				value, _ := strconv.Atoi(fraction)
+				for range 3 - len(fraction) {
+					value *= 10
+				}
+				at += time.Duration(value) * time.Millisecond
+			}
+			times = append(times, at)
+		}
+		lineText := strings.TrimSpace(raw[end:])
+		for _, at := range times {
+			lines = append(lines, Line{At: at, Text: lineText})
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].At < lines[j].At })
+	return lines
+}
+
+// LineAt returns the index of the line being sung at a position, or -1 before the first
+func LineAt(lines []Line, position time.Duration) int {
+	return sort.Search(len(lines), func(idx int) bool { return lines[idx].At > position }) - 1
+}
@@ -0,0 +1,112 @@
+package lyrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		artist, title         string
+		wantArtist, wantTitle string
+	}{
+		{"Rick Astley", "Rick Astley - Never Gonna Give You Up (Official Music Video)", "Rick Astley", "Never Gonna Give You Up"},
+		{"Queen - Topic", "Bohemian Rhapsody - Remastered 2011", "Queen", "Bohemian Rhapsody"},
+		{"DuaLipaVEVO", "Dua Lipa - Levitating [Official Video] ft. DaBaby", "Dua Lipa", "Levitating"},
+		{"Monstercat", "Pegboard Nerds - Hero (feat. Elizaveta)", "Pegboard Nerds", "Hero"},
+		{"Daft Punk", "Get Lucky [4K Remaster] (Lyrics)", "Daft Punk", "Get Lucky"},
+		{"", "Artist - Song", "Artist", "Song"},
+	}
+	for _, tt := range tests {
+		artist, title := CleanTitle(tt.artist, tt.title)
+		if artist != tt.wantArtist || title != tt.wantTitle {
+			t.Errorf("CleanTitle(%q, %q) = %q, %q; want %q, %q", tt.artist, tt.title, artist, title, tt.wantArtist, tt.wantTitle)
+		}
+	}
+}
+
+func TestParseLRC(t *testing.T) {
+	lines := ParseLRC("[ar:Someone]\n[00:12.34] First\n[01:02.5]Second\r\n[00:05.00][00:30.000] Chorus\nno timestamp\n[00:40.00]")
+
+	want := []Line{
+		{5 * time.Second, "Chorus"},
+		{12*time.Second + 340*time.Millisecond, "First"},
+		{30 * time.Second, "Chorus"},
+		{40 * time.Second, ""},
+		{62*time.Second + 500*time.Millisecond, "Second"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d: %+v", len(lines), len(want), lines)
+	}
+	for idx := range want {
+		if lines[idx] != want[idx] {
+			t.Errorf("line %d = %+v, want %+v", idx, lines[idx], want[idx])
+		}
+	}
+}
+
+func TestLineAt(t *testing.T) {
+	lines := []Line{{At: 5 * time.Second}, {At: 10 * time.Second}, {At: 20 * time.Second}}
+	tests := []struct {
+		position time.Duration
+		want     int
+	}{
+		{0, -1},
+		{5 * time.Second, 0},
+		{15 * time.Second, 1},
+		{time.Minute, 2},
+	}
+	for _, tt := range tests {
+		if got := LineAt(lines, tt.position); got != tt.want {
+			t.Errorf("LineAt(%v) = %d, want %d", tt.position, got, tt.want)
+		}
+	}
+}
+
+func TestFindFallsBackToSearch(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/api/get":
+			if r.URL.Query().Get("track_name") != "Hero" || r.URL.Query().Get("duration") != "214" {
+				t.Errorf("get query = %s", r.URL.RawQuery)
+			}
+			http.NotFound(w, r)
+		case "/api/search":
+			if q := r.URL.Query().Get("q"); q != "Pegboard Nerds Hero" {
+				t.Errorf("search q = %q", q)
+			}
+			w.Write([]byte(`[{"id":1,"trackName":"Hero"},{"id":2,"trackName":"Hero","artistName":"Pegboard Nerds","syncedLyrics":"[00:01.00] Hey"}]`))
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL+"/api/", time.Second)
+	got, err := c.Find(context.Background(), "Monstercat", "Pegboard Nerds - Hero (Official Video)", 214*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 2 || got.Plain != "Hey" || len(got.Synced) != 1 {
+		t.Errorf("Find() = %+v, want the second result with its synced lyrics as plain text", got)
+	}
+	if len(paths) != 2 {
+		t.Errorf("requested %v, want a lookup then a search", paths)
+	}
+}
+
+func TestSearchNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL, time.Second).Search(context.Background(), "nothing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Search() error = %v, want ErrNotFound", err)
+	}
+}
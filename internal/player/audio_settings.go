@@ -0,0 +1,61 @@
+package player
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// AudioSettings controls how PCM audio is encoded to Opus
+type AudioSettings struct {
+	SampleRate    int
+	Channels      int
+	Bitrate       int // in bits per second
+	MaxBitrate    int // upper bound when matching the voice channel bitrate (0 for no limit)
+	FrameDuration time.Duration
+	FEC           bool // Opus in-band forward error correction
+	PacketLoss    int  // expected packet loss percentage (0-100)
+
+	// StartupTimeout is how long FFmpeg may run without producing PCM before the stream is abandoned (0 to disable)
+	StartupTimeout time.Duration
+
+	// JitterBuffer is how much audio is read ahead of the send clock
+	JitterBuffer time.Duration
+
+	// Volume is the live volume in percent decoded audio is scaled by (nil to leave it as is)
+	Volume *atomic.Int32
+}
+
+// DefaultAudioSettings returns 48kHz stereo at 128kbps with 20ms frames
+func DefaultAudioSettings() AudioSettings {
+	return AudioSettings{
+		SampleRate:     48000,
+		Channels:       2,
+		Bitrate:        128000,
+		MaxBitrate:     384000,
+		FrameDuration:  20 * time.Millisecond,
+		StartupTimeout: 15 * time.Second,
+		JitterBuffer:   200 * time.Millisecond,
+	}
+}
+
+// Opus bitrate limits in bits per second
+const (
+	MinBitrate = 8000
+	MaxBitrate = 510000
+)
+
+// maxOpusPacketSize is the encode buffer size; the largest packet (60ms at 510kbps, with FEC
+// sharing the same bitrate budget) is about 3.8KB
+const maxOpusPacketSize = 4000
+
+// RobustnessLevels maps /config robustness levels to expected packet loss percentages
+var RobustnessLevels = map[string]int{
+	"low":    5,
+	"medium": 15,
+	"high":   30,
+}
+
+// FrameSize returns the number of samples per channel in one frame
+func (s AudioSettings) FrameSize() int {
+	return s.SampleRate * int(s.FrameDuration/time.Millisecond) / 1000
+}
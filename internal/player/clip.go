@@ -0,0 +1,166 @@
+package player
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/bwmarrin/discordgo"
+)
+
+// MaxClipDuration is the longest clip PlayClip plays; anything after it is cut off
+const MaxClipDuration = 10 * time.Second
+
+// ErrClipBusy is returned by PlayClip while another clip is playing or waiting to
+var ErrClipBusy = errors.New("another sound effect is already playing")
+
+// clip is a short sound, like a sound effect, sent in place of the current track's frames
+type clip struct {
+	frames [][]byte
+	done   chan struct{} // Closed once the clip was sent or dropped
+}
+
+// PlayClip plays a short audio file in the voice channel and returns once it has played
+// A playing or paused track holds still for the clip and carries on where it was after it;
+// with nothing playing the clip is sent on its own, and cut off if a track starts
+// Holding the track is a deliberate first step: ducking it under the clip would mean mixing
+// the two as PCM, which the send loop can't do with frames that are already Opus
+func (p *GuildPlayer) PlayClip(path string) error {
+	p.mu.RLock()
+	vc := p.VoiceConnection
+	settings := p.encoderSettings()
+	volume := p.Volume
+	streamMode := p.StreamMode
+	p.mu.RUnlock()
+	if vc == nil {
+		return ErrVoiceLost
+	}
+
+	// Clips play at the server's volume, not the current track's
+	var level atomic.Int32
+	level.Store(int32(volume))
+	settings.Volume = &level
+	frames, err := p.encodeClip(path, settings, streamMode)
+	if err != nil {
+		return err
+	}
+	c := &clip{frames: frames, done: make(chan struct{})}
+
+	p.mu.Lock()
+	switch {
+	case p.sendingTrack:
+		if p.pendingClip != nil {
+			p.mu.Unlock()
+			return ErrClipBusy
+		}
+		p.pendingClip = c
+		p.mu.Unlock()
+		<-c.done
+		return nil
+	case p.sendingClip:
+		p.mu.Unlock()
+		return ErrClipBusy
+	}
+	p.sendingClip = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.sendingClip = false
+		p.mu.Unlock()
+	}()
+
+	// Right after a join the connection may still be connecting
+	deadline := time.Now().Add(voiceReadyTimeout)
+	for !voiceReady(vc) {
+		if time.Now().After(deadline) {
+			close(c.done)
+			return ErrVoiceNeverReady
+		}
+		time.Sleep(voiceReadyPoll)
+	}
+
+	if err := vc.Speaking(true); err != nil {
+		logger.PlaybackSpeakingError(err)
+	}
+	defer vc.Speaking(false)
+	sendClip(vc, c, settings.FrameDuration, nil, func() bool {
+		p.mu.RLock()
+		defer p.mu.RUnlock()
+		return p.sendingTrack
+	})
+	return nil
+}
+
+// ClipBusy reports whether a clip is playing or waiting to, so PlayClip would return ErrClipBusy
+func (p *GuildPlayer) ClipBusy() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.sendingClip || p.pendingClip != nil
+}
+
+// encodeClip encodes an audio file into Opus frames, at most MaxClipDuration of them
+func (p *GuildPlayer) encodeClip(path string, settings AudioSettings, mode StreamMode) ([][]byte, error) {
+	encoder, err := p.startEncoder(&Track{Title: filepath.Base(path), LocalPath: path}, settings, 0, "", mode)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEncoderStart, err)
+	}
+	defer encoder.Cleanup()
+
+	limit := int(MaxClipDuration / settings.FrameDuration)
+	var frames [][]byte
+	for len(frames) < limit {
+		frame, err := encoder.OpusFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame)
+	}
+	if len(frames) == 0 {
+		return nil, ErrNoData
+	}
+	return frames, nil
+}
+
+// sendClip sends a clip's frames on their own clock and closes its done channel
+// It gives up early when interrupted reports true, and reports the reason if stop delivers
+// one; both may be nil
+func sendClip(vc *discordgo.VoiceConnection, c *clip, frameDuration time.Duration, stop <-chan PlaybackReason, interrupted func() bool) (PlaybackReason, bool) {
+	defer close(c.done)
+
+	clock := time.NewTicker(frameDuration)
+	defer clock.Stop()
+	for _, frame := range c.frames {
+		if interrupted != nil && interrupted() {
+			return 0, false
+		}
+		select {
+		case <-clock.C:
+		case reason := <-stop:
+			return reason, true
+		}
+		select {
+		case vc.OpusSend <- frame:
+		case <-time.After(5 * time.Second):
+			logger.Error("Timeout sending clip frame, voice connection may be dead")
+			return 0, false
+		case reason := <-stop:
+			return reason, true
+		}
+	}
+	return 0, false
+}
+
+// dropClip forgets a clip waiting for the send loop once it ends; the caller must hold p.mu
+func (p *GuildPlayer) dropClip() {
+	if p.pendingClip != nil {
+		close(p.pendingClip.done)
+		p.pendingClip = nil
+	}
+}
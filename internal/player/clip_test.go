@@ -0,0 +1,69 @@
+package player
+
+import (
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// clipEncoders opens a five-frame encoder for clips and an endless one for tracks
+func clipEncoders(track *Track, _ AudioSettings, _ time.Duration, _ string, _ StreamMode) (EncoderInterface, error) {
+	if track.LocalPath != "" {
+		return &fakeEncoder{frames: 5, err: io.EOF}, nil
+	}
+	return &fakeEncoder{frames: -1}, nil
+}
+
+func TestPlayClipWhileIdle(t *testing.T) {
+	p := NewManager().GetPlayer("guild")
+	vc := newTestVoiceConnection()
+	p.VoiceConnection = vc
+	p.openEncoder = clipEncoders
+
+	var sent atomic.Int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range vc.OpusSend {
+			sent.Add(1)
+		}
+	}()
+
+	if err := p.PlayClip("airhorn.ogg"); err != nil {
+		t.Fatal(err)
+	}
+	close(vc.OpusSend)
+	<-done
+	if sent.Load() != 5 {
+		t.Errorf("sent %d frames, want the clip's 5", sent.Load())
+	}
+}
+
+func TestPlayClipHoldsTrack(t *testing.T) {
+	p := newTestPlayer(t, nil)
+	p.openEncoder = clipEncoders
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+	waitForFrames(t, p)
+
+	before := p.AudioStats().FramesSent
+	if err := p.PlayClip("airhorn.ogg"); err != nil {
+		t.Fatal(err)
+	}
+	// The track's frames wait while the clip's go out in their place
+	after := p.AudioStats().FramesSent
+	if after-before > 2 {
+		t.Errorf("%d track frames were sent during the clip", after-before)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if p.AudioStats().FramesSent == after {
+		t.Error("the track didn't carry on after the clip")
+	}
+
+	p.Stop()
+	if result := waitForResult(t, p); result.Reason != ReasonStopped {
+		t.Errorf("result = %+v, want stopped", result)
+	}
+}
@@ -0,0 +1,189 @@
+package player
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+)
+
+// Pre-encoded tracks use the raw DCA layout: each Opus frame is prefixed with its
+// length as a little-endian int16, with no file header
+
+// DCASuffix returns the cache artifact suffix for frames pre-encoded with these settings
+func DCASuffix(settings AudioSettings) string {
+	return fmt.Sprintf(".%dk-%dms-%dch.dca", settings.Bitrate/1000, settings.FrameDuration/time.Millisecond, settings.Channels)
+}
+
+// EncodeDCA transcodes source once into a DCA file at dest
+func EncodeDCA(source, dest string, settings AudioSettings) error {
+	start := time.Now()
+
+	encoder, err := NewCustomEncoder(source, settings, 0, "")
+	if err != nil {
+		return err
+	}
+	defer encoder.Cleanup()
+
+	file, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("failed to create DCA file: %w", err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	frames := 0
+	for {
+		frame, err := encoder.OpusFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := writeDCAFrame(w, frame); err != nil {
+			return fmt.Errorf("failed to write DCA file: %w", err)
+		}
+		frames++
+	}
+
+	if err := encoder.Cleanup(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w", err)
+	}
+	if frames == 0 {
+		return fmt.Errorf("no audio frames encoded")
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write DCA file: %w", err)
+	}
+
+	logger.Timing("DCA pre-encode completed", "frames", frames, "duration_ms", time.Since(start).Milliseconds())
+	return file.Close()
+}
+
+// writeDCAFrame writes one length-prefixed Opus frame
+func writeDCAFrame(w io.Writer, frame []byte) error {
+	if err := binary.Write(w, binary.LittleEndian, int16(len(frame))); err != nil {
+		return err
+	}
+	_, err := w.Write(frame)
+	return err
+}
+
+// DCAReader plays frames from a pre-encoded DCA file
+type DCAReader struct {
+	file          *os.File
+	r             *bufio.Reader
+	frameDuration time.Duration
+	mu            sync.Mutex
+	done          bool
+	stats         frameCounters
+}
+
+// OpenDCA opens a DCA file for playback starting at the frame containing startAt
+func OpenDCA(path string, settings AudioSettings, startAt time.Duration) (*DCAReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open DCA file: %w", err)
+	}
+
+	reader := &DCAReader{file: file, r: bufio.NewReader(file), frameDuration: settings.FrameDuration}
+	if startAt > 0 {
+		if err := reader.SeekFrame(int(startAt / settings.FrameDuration)); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	return reader, nil
+}
+
+// SeekFrame positions the reader at the given zero-based frame index
+func (d *DCAReader) SeekFrame(index int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, err := d.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek DCA file: %w", err)
+	}
+	d.r.Reset(d.file)
+
+	// Frames are variable-length, so walk the length prefixes
+	for i := 0; i < index; i++ {
+		size, err := d.readLength()
+		if err != nil {
+			return fmt.Errorf("failed to seek to frame %d: %w", index, err)
+		}
+		if _, err := d.r.Discard(size); err != nil {
+			return fmt.Errorf("failed to seek to frame %d: %w", index, noEOF(err))
+		}
+	}
+
+	return nil
+}
+
+// readLength reads a frame's length prefix
+func (d *DCAReader) readLength() (int, error) {
+	var size int16
+	if err := binary.Read(d.r, binary.LittleEndian, &size); err != nil {
+		return 0, err
+	}
+	if size < 0 {
+		return 0, fmt.Errorf("invalid DCA frame length %d", size)
+	}
+	return int(size), nil
+}
+
+// OpusFrame returns the next frame from the file
+// The returned slice is owned by the caller
+func (d *DCAReader) OpusFrame() ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.done {
+		return nil, io.EOF
+	}
+
+	size, err := d.readLength()
+	if err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(d.r, frame); err != nil {
+		return nil, noEOF(err)
+	}
+
+	d.stats.add(size)
+	return frame, nil
+}
+
+// Stats returns the frames read so far; nothing is buffered ahead of the reader
+func (d *DCAReader) Stats() EncoderStats {
+	return d.stats.snapshot(d.frameDuration, 0)
+}
+
+// Messages returns diagnostic output; reading a DCA file has no external process, so it's always empty
+func (d *DCAReader) Messages() string {
+	return ""
+}
+
+// Cleanup closes the file; it is safe to call more than once
+func (d *DCAReader) Cleanup() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.done {
+		return nil
+	}
+
+	d.done = true
+	return d.file.Close()
+}
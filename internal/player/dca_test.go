@@ -0,0 +1,85 @@
+package player
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestDCA writes frames of increasing length whose bytes are the frame index
+func writeTestDCA(t *testing.T, frames int) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	for i := 0; i < frames; i++ {
+		if err := writeDCAFrame(&buf, bytes.Repeat([]byte{byte(i)}, i+1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "track.dca")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDCAReaderSeek(t *testing.T) {
+	path := writeTestDCA(t, 10)
+
+	// 130ms falls in frame 6 at 20ms per frame
+	d, err := OpenDCA(path, DefaultAudioSettings(), 130*time.Millisecond)
+	if err != nil {
+		t.Fatalf("OpenDCA: %v", err)
+	}
+	defer d.Cleanup()
+
+	for want := 6; want < 10; want++ {
+		frame, err := d.OpusFrame()
+		if err != nil {
+			t.Fatalf("OpusFrame: %v", err)
+		}
+		if len(frame) != want+1 || frame[0] != byte(want) {
+			t.Fatalf("got frame %d (%d bytes), want frame %d", frame[0], len(frame), want)
+		}
+	}
+
+	if _, err := d.OpusFrame(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+
+	// Seeking back re-reads from the start of the file
+	if err := d.SeekFrame(2); err != nil {
+		t.Fatalf("SeekFrame: %v", err)
+	}
+	if frame, _ := d.OpusFrame(); len(frame) != 3 || frame[0] != 2 {
+		t.Errorf("after SeekFrame(2) got %v", frame)
+	}
+
+	d.Cleanup()
+	if _, err := d.OpusFrame(); err != io.EOF {
+		t.Errorf("expected EOF after Cleanup, got %v", err)
+	}
+}
+
+func TestDCAReaderTruncated(t *testing.T) {
+	path := writeTestDCA(t, 3)
+
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, data[:len(data)-1], 0644)
+
+	d, err := OpenDCA(path, DefaultAudioSettings(), 0)
+	if err != nil {
+		t.Fatalf("OpenDCA: %v", err)
+	}
+	defer d.Cleanup()
+
+	d.OpusFrame()
+	d.OpusFrame()
+	if _, err := d.OpusFrame(); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected ErrUnexpectedEOF for a truncated frame, got %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+package player
+
+// PlayerDefaults are the settings newly created players start with
+type PlayerDefaults struct {
+	Volume              int
+	ReduceOnVoice       bool
+	ReduceOnVoiceTarget int
+}
+
+// DefaultPlayerDefaults returns the defaults used when none are configured
+func DefaultPlayerDefaults() PlayerDefaults {
+	return PlayerDefaults{Volume: 100, ReduceOnVoiceTarget: 70}
+}
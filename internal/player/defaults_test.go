@@ -0,0 +1,112 @@
+package player
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/GrainedLotus515/gobard/internal/store"
+)
+
+func TestNewPlayersUseDefaults(t *testing.T) {
+	m := NewManager()
+	if p := m.GetPlayer("fresh"); p.Volume != 100 || p.ReduceOnVoice || p.ReduceOnVoiceTarget != 70 {
+		t.Errorf("unconfigured player: volume %d, reduce %v to %d", p.Volume, p.ReduceOnVoice, p.ReduceOnVoiceTarget)
+	}
+
+	m.SetDefaults(PlayerDefaults{Volume: 40, ReduceOnVoice: true, ReduceOnVoiceTarget: 20})
+	p := m.GetPlayer("guild")
+	if p.Volume != 40 || !p.ReduceOnVoice || p.ReduceOnVoiceTarget != 20 {
+		t.Errorf("configured player: volume %d, reduce %v to %d", p.Volume, p.ReduceOnVoice, p.ReduceOnVoiceTarget)
+	}
+}
+
+func TestGuildDefaultVolume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guilds", "volumes.json")
+
+	m := NewManager()
+	if err := m.SetGuildDefaultVolume("guild", 30); err == nil {
+		t.Error("setting a guild's volume without a store should fail")
+	}
+
+	volumes, err := store.Open[int](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetDefaults(PlayerDefaults{Volume: 80})
+	m.SetVolumeStore(volumes)
+	if err := m.SetGuildDefaultVolume("guild", 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetGuildDefaultVolume("guild", 101); err == nil {
+		t.Error("a volume over 100 should be rejected")
+	}
+
+	// The guild's own default outlives a restart and beats the configured one
+	volumes, err = store.Open[int](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = NewManager()
+	m.SetDefaults(PlayerDefaults{Volume: 80})
+	m.SetVolumeStore(volumes)
+	if p := m.GetPlayer("guild"); p.Volume != 30 {
+		t.Errorf("guild player volume %d, want 30", p.Volume)
+	}
+	if p := m.GetPlayer("other"); p.Volume != 80 {
+		t.Errorf("other player volume %d, want 80", p.Volume)
+	}
+
+	if err := m.SetGuildDefaultVolume("guild", -1); err != nil {
+		t.Fatal(err)
+	}
+	if volume, own := m.DefaultVolume("guild"); volume != 80 || own {
+		t.Errorf("after reset: volume %d, own %v", volume, own)
+	}
+}
+
+func TestGuildCustomFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guilds", "filters.json")
+	const chain = "equalizer=f=60:t=h:width=200:g=6"
+
+	m := NewManager()
+	if err := m.SetGuildCustomFilter("guild", chain); err != nil {
+		t.Errorf("setting a custom filter without a store failed: %v", err)
+	}
+
+	filters, err := store.Open[string](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetFilterStore(filters)
+	if err := m.SetGuildCustomFilter("guild", chain); err != nil {
+		t.Fatal(err)
+	}
+
+	// The chain outlives a restart
+	filters, err = store.Open[string](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = NewManager()
+	m.SetFilterStore(filters)
+	if filter := m.GetPlayer("guild").GetFilter(); filter != CustomFilter(chain) {
+		t.Errorf("reloaded filter %+v, want the custom chain", filter)
+	}
+	if filter := m.GetPlayer("other").GetFilter(); filter != NoFilter {
+		t.Errorf("other guild's filter %+v, want none", filter)
+	}
+
+	// Choosing a preset forgets it
+	if err := m.SetGuildCustomFilter("guild", ""); err != nil {
+		t.Fatal(err)
+	}
+	filters, err = store.Open[string](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = NewManager()
+	m.SetFilterStore(filters)
+	if filter := m.GetPlayer("guild").GetFilter(); filter != NoFilter {
+		t.Errorf("filter after forgetting %+v, want none", filter)
+	}
+}
@@ -0,0 +1,41 @@
+package player
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// DirectOpener fetches a direct link's audio through the same address checks its lookup
+// went through, so FFmpeg never connects anywhere on its own
+type DirectOpener func(ctx context.Context, link string) (io.ReadCloser, error)
+
+// errNoDirectOpener is returned for direct links when the player wasn't given a DirectOpener
+var errNoDirectOpener = errors.New("direct links can't be played")
+
+// newDirectEncoder plays a direct link by feeding the body open returns to FFmpeg's stdin
+// The body is closed with the encoder, or when the track leaves the queue
+func newDirectEncoder(open DirectOpener, track *Track, settings AudioSettings, startAt time.Duration, filter string) (*Encoder, error) {
+	if open == nil {
+		return nil, errNoDirectOpener
+	}
+
+	body, err := open(track.Context(), track.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	encoder, err := NewEncoder(EncoderConfig{
+		AudioSettings: settings,
+		Input:         "pipe:0",
+		Reader:        body,
+		StartOffset:   startAt,
+		FilterChain:   filter,
+	})
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	return encoder, nil
+}
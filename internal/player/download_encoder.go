@@ -0,0 +1,67 @@
+package player
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// DownloadSource is a download of a track that is still being written
+type DownloadSource interface {
+	// Open returns a reader over the download from its start; reads wait for more to be
+	// written, and fail if the download stalls or fails
+	Open() (io.ReadCloser, error)
+	// Failed reports whether the download stalled or failed while being read, after which
+	// the track should be streamed instead
+	Failed() bool
+}
+
+// newDownloadEncoder plays a track from its in-progress download, so the audio is only
+// fetched once for both playback and the cache
+// Like newPipedEncoder, it waits for the first Opus frame so the track can still be
+// streamed if the download doesn't get going
+func newDownloadEncoder(download DownloadSource, settings AudioSettings, startAt time.Duration, filter string) (*Encoder, error) {
+	reader, err := download.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	encoder, err := NewEncoder(EncoderConfig{
+		AudioSettings: settings,
+		Input:         "pipe:0",
+		Reader:        reader,
+		StartOffset:   startAt,
+		FilterChain:   filter,
+	})
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	select {
+	case <-encoder.ready:
+		return encoder, nil
+	case <-encoder.exited:
+	}
+
+	// Very short tracks may finish before the wait is noticed
+	select {
+	case <-encoder.ready:
+		return encoder, nil
+	default:
+	}
+
+	err = encoder.Cleanup()
+	if err == nil {
+		err = ErrNoData
+	}
+	if msg := lastLines(encoder.Messages(), 1); msg != "" {
+		return nil, fmt.Errorf("%w: %s", err, msg)
+	}
+	return nil, err
+}
+
+// followingDownload reports whether a track without a cached file would be played from its download
+func followingDownload(track *Track) bool {
+	return track.LocalPath == "" && track.Download != nil && !track.Download.Failed()
+}
@@ -0,0 +1,581 @@
+package player
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/tools"
+	"github.com/hraban/opus"
+)
+
+// EncoderConfig describes an FFmpeg + libopus encoding job
+// Cached files and network streams differ only in their FFmpeg input arguments
+type EncoderConfig struct {
+	AudioSettings
+
+	Input          string        // File path or URL passed to FFmpeg
+	IsURL          bool          // Input is a network stream
+	StartOffset    time.Duration // Seek offset applied before decoding
+	FilterChain    string        // FFmpeg -af filter chain (empty for none)
+	ReconnectFlags bool          // Let FFmpeg reconnect dropped HTTP streams
+	Live           bool          // Input is a live HLS manifest; start at its newest segment
+	Proxy          string        // HTTP proxy for URL inputs (empty for none)
+	Source         []string      // Command whose stdout is piped to FFmpeg; set Input to "pipe:0"
+	Reader         io.Reader     // Fed to FFmpeg's stdin, and closed with the encoder if it is an io.Closer; set Input to "pipe:0"
+}
+
+// inputKind names the input path for logs: "file", "url", or "pipe"
+func (cfg EncoderConfig) inputKind() string {
+	switch {
+	case len(cfg.Source) > 0, cfg.Reader != nil:
+		return "pipe"
+	case cfg.IsURL:
+		return "url"
+	default:
+		return "file"
+	}
+}
+
+// frameEncoder encodes one frame of interleaved PCM samples into an Opus packet
+type frameEncoder interface {
+	Encode(pcm []int16, data []byte) (int, error)
+}
+
+// Encoder handles audio encoding using FFmpeg + libopus
+type Encoder struct {
+	cmd         *exec.Cmd
+	source      *exec.Cmd // optional process feeding cmd's stdin (nil when FFmpeg reads the input itself)
+	input       io.Closer // optional reader feeding cmd's stdin, closed when the process ends
+	ctx         context.Context
+	cancel      context.CancelFunc
+	label       string
+	started     time.Time
+	opusEncoder frameEncoder
+	volume      *atomic.Int32 // scales the PCM before encoding when set
+	frameSize   int
+	channels    int
+	mu          sync.Mutex
+	done        bool
+	frameChan   chan []byte
+	stderr      *stderrRing
+	stderrDone  chan struct{}
+	ready       chan struct{} // closed once the first Opus frame is queued
+	exited      chan struct{} // closed once the encode loop has finished and the process is reaped
+	waitErr     error
+	noData      atomic.Bool // set when the process produced no PCM within the startup timeout
+
+	frameDuration time.Duration
+	stats         frameCounters
+}
+
+// ErrNoData is returned by OpusFrame when FFmpeg produced no audio within the startup timeout
+var ErrNoData = errors.New("no audio data received from ffmpeg")
+
+// maxStderrBytes caps how much FFmpeg stderr output each encoder keeps
+const maxStderrBytes = 4096
+
+// Process shutdown timings: SIGTERM first, SIGKILL after encoderKillDelay
+const (
+	encoderKillDelay      = 2 * time.Second
+	encoderCleanupTimeout = 5 * time.Second
+)
+
+// NewEncoder starts FFmpeg for the configured input and begins encoding Opus frames
+func NewEncoder(cfg EncoderConfig) (*Encoder, error) {
+	start := time.Now()
+
+	// Create Opus encoder
+	opusEnc, err := opus.NewEncoder(cfg.SampleRate, cfg.Channels, opus.AppAudio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create opus encoder: %w", err)
+	}
+
+	if err := opusEnc.SetBitrate(cfg.Bitrate); err != nil {
+		logger.Warn("Failed to set opus bitrate", "bitrate", cfg.Bitrate, "err", err)
+	}
+	if err := opusEnc.SetInBandFEC(cfg.FEC); err != nil {
+		logger.Warn("Failed to set opus FEC", "fec", cfg.FEC, "err", err)
+	}
+	if err := opusEnc.SetPacketLossPerc(cfg.PacketLoss); err != nil {
+		logger.Warn("Failed to set opus packet loss", "loss", cfg.PacketLoss, "err", err)
+	}
+
+	encoder, err := startEncoder(encoderProcess{
+		name:           tools.FFmpeg,
+		args:           cfg.ffmpegArgs(),
+		source:         cfg.Source,
+		stdin:          cfg.Reader,
+		startupTimeout: cfg.StartupTimeout,
+		label:          cfg.inputKind(),
+		volume:         cfg.Volume,
+	}, opusEnc, cfg.FrameSize(), cfg.Channels)
+	if err != nil {
+		return nil, err
+	}
+	encoder.frameDuration = cfg.FrameDuration
+
+	logger.Timing("Encoder creation completed", "input", cfg.inputKind(), "duration_ms", time.Since(start).Milliseconds())
+	return encoder, nil
+}
+
+// encoderProcess describes the command that produces PCM for an Encoder
+type encoderProcess struct {
+	name           string
+	args           []string
+	source         []string      // optional command whose stdout is piped into the process (program first)
+	stdin          io.Reader     // optional input for the process, closed with it if it is an io.Closer
+	startupTimeout time.Duration // stop if nothing is written within this window (0 to wait indefinitely)
+	label          string        // identifies the input path in timing logs
+	volume         *atomic.Int32 // optional live volume in percent the PCM is scaled by
+}
+
+// startEncoder runs a PCM-producing command and encodes its output until it ends or Cleanup is called
+func startEncoder(proc encoderProcess, enc frameEncoder, frameSize, channels int) (*Encoder, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cmd := newEncoderCommand(ctx, proc.name, proc.args)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create %s stdout pipe: %w", proc.name, err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create %s stderr pipe: %w", proc.name, err)
+	}
+
+	encoder := &Encoder{
+		cmd:         cmd,
+		ctx:         ctx,
+		cancel:      cancel,
+		label:       proc.label,
+		opusEncoder: enc,
+		volume:      proc.volume,
+		frameSize:   frameSize,
+		channels:    channels,
+		frameChan:   make(chan []byte, 300), // ~6 seconds buffer at 20ms frames
+		stderr:      &stderrRing{max: maxStderrBytes},
+		stderrDone:  make(chan struct{}),
+		ready:       make(chan struct{}),
+		exited:      make(chan struct{}),
+		started:     time.Now(),
+	}
+
+	if proc.stdin != nil {
+		cmd.Stdin = proc.stdin
+		encoder.input, _ = proc.stdin.(io.Closer)
+	}
+
+	var sourcePipe *os.File
+	if len(proc.source) > 0 {
+		if sourcePipe, err = encoder.startSource(proc.source); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	err = cmd.Start()
+
+	// Only the children should hold the pipe between source and process, so either
+	// side sees EOF or EPIPE when the other exits
+	if sourcePipe != nil {
+		sourcePipe.Close()
+	}
+
+	if err != nil {
+		cancel()
+		if encoder.source != nil {
+			encoder.source.Wait()
+		}
+		if encoder.input != nil {
+			encoder.input.Close()
+		}
+		return nil, fmt.Errorf("failed to start %s: %w", proc.name, err)
+	}
+
+	// Start stderr monitoring goroutine
+	go func() {
+		defer close(encoder.stderrDone)
+		monitorFFmpegErrors(stderr, encoder.stderr)
+	}()
+
+	// Start the encoding goroutine
+	go encoder.run(encoder.watchStartup(stdout, proc.startupTimeout))
+
+	return encoder, nil
+}
+
+// ffmpegArgs builds the FFmpeg command line that decodes the input to raw PCM s16le
+func (cfg EncoderConfig) ffmpegArgs() []string {
+	args := make([]string, 0, 20)
+
+	switch {
+	case cfg.IsURL && cfg.Live:
+		// Live segments are short, so retry quickly and on any network error; a manifest
+		// that has expired for good ends the stream and is re-extracted by the player
+		args = append(args,
+			"-reconnect", "1",
+			"-reconnect_streamed", "1",
+			"-reconnect_on_network_error", "1",
+			"-reconnect_delay_max", "2",
+			"-live_start_index", "-1",
+		)
+	case cfg.IsURL && cfg.ReconnectFlags:
+		args = append(args,
+			"-reconnect", "1",
+			"-reconnect_streamed", "1",
+			"-reconnect_delay_max", "5",
+		)
+	}
+
+	if cfg.IsURL && cfg.Proxy != "" {
+		args = append(args, "-http_proxy", cfg.Proxy)
+	}
+
+	if cfg.StartOffset > 0 && !cfg.Live && cfg.Reader == nil {
+		// Input seeking (before -i) is fast and sample-accurate for audio,
+		// and lets FFmpeg use HTTP range requests for URLs
+		args = append(args, "-ss", formatSeekOffset(cfg.StartOffset))
+	}
+
+	args = append(args, "-i", cfg.Input)
+
+	if cfg.StartOffset > 0 && cfg.Reader != nil {
+		// A reader can't be seeked, so the audio before the offset is decoded and dropped
+		args = append(args, "-ss", formatSeekOffset(cfg.StartOffset))
+	}
+
+	if cfg.FilterChain != "" {
+		args = append(args, "-af", cfg.FilterChain)
+	}
+
+	return append(args,
+		"-f", "s16le",
+		"-ar", fmt.Sprintf("%d", cfg.SampleRate),
+		"-ac", fmt.Sprintf("%d", cfg.Channels),
+		"-loglevel", "error", // Only show errors
+		"pipe:1", // Output to stdout
+	)
+}
+
+// monitorFFmpegErrors logs FFmpeg stderr output and keeps a copy in messages
+func monitorFFmpegErrors(stderr io.Reader, messages io.Writer) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := stderr.Read(buf)
+		if n > 0 {
+			logger.Error("FFmpeg error", "output", string(buf[:n]))
+			messages.Write(buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// stderrRing keeps the most recent output written to it, up to max bytes
+type stderrRing struct {
+	mu  sync.Mutex
+	buf []byte
+	max int
+}
+
+func (r *stderrRing) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.buf = append(r.buf, p...)
+	if over := len(r.buf) - r.max; over > 0 {
+		r.buf = append(r.buf[:0], r.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (r *stderrRing) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return string(r.buf)
+}
+
+// newEncoderCommand creates a command that is asked to exit with SIGTERM when ctx is cancelled
+func newEncoderCommand(ctx context.Context, name string, args []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	// Ask the process to exit cleanly; exec escalates to SIGKILL after WaitDelay
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = encoderKillDelay
+	return cmd
+}
+
+// startSource starts the command whose stdout feeds the main process's stdin and returns
+// the parent's copy of the pipe's read end; its stderr is collected alongside FFmpeg's in Messages
+func (e *Encoder) startSource(source []string) (*os.File, error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s pipe: %w", source[0], err)
+	}
+
+	e.source = newEncoderCommand(e.ctx, source[0], source[1:])
+	e.source.Stdout = pw
+	e.source.Stderr = e.stderr
+	e.cmd.Stdin = pr
+
+	err = e.source.Start()
+	pw.Close()
+	if err != nil {
+		pr.Close()
+		e.source = nil
+		return nil, fmt.Errorf("failed to start %s: %w", source[0], err)
+	}
+
+	return pr, nil
+}
+
+// watchStartup stops the process if the returned reader sees no data within timeout
+func (e *Encoder) watchStartup(stdout io.Reader, timeout time.Duration) io.Reader {
+	started := time.Now()
+
+	var timer *time.Timer
+	if timeout > 0 {
+		timer = time.AfterFunc(timeout, func() {
+			logger.Error("No audio data from ffmpeg, stopping", "timeout", timeout)
+			e.noData.Store(true)
+			e.cancel()
+		})
+	}
+
+	return &firstDataReader{
+		Reader: stdout,
+		onData: func() {
+			if timer == nil || timer.Stop() {
+				logger.Timing("First PCM byte received", "duration_ms", time.Since(started).Milliseconds())
+			}
+		},
+	}
+}
+
+// firstDataReader calls onData the first time a read returns data
+type firstDataReader struct {
+	io.Reader
+	onData func()
+	seen   bool
+}
+
+func (r *firstDataReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 && !r.seen {
+		r.seen = true
+		r.onData()
+	}
+	return n, err
+}
+
+// run encodes FFmpeg output until the stream ends or the encoder is stopped, then reaps the process
+func (e *Encoder) run(reader io.Reader) {
+	defer close(e.exited)
+	defer close(e.frameChan)
+
+	logger.Info("Starting encode loop")
+
+	frameCount, err := encodeLoop(e.ctx, reader, e.opusEncoder, e.frameSize, e.channels, e.volume, e.frameChan, func(size int) {
+		if e.stats.add(size) == 1 {
+			logger.Timing("Time to first opus frame", "input", e.label, "duration_ms", time.Since(e.started).Milliseconds())
+			close(e.ready)
+		}
+	})
+	switch {
+	case errors.Is(err, errEncoderStopped):
+		logger.Info("Encode loop stopped by signal", "frames_encoded", frameCount)
+	case err != nil:
+		logger.Error("Encode loop failed", "err", err, "frames_encoded", frameCount)
+		// FFmpeg may still be blocked writing to the pipe
+		e.cancel()
+	default:
+		logger.Info("Stream ended normally", "frames_encoded", frameCount)
+	}
+
+	// Wait closes the pipes, so all stderr must be read first
+	<-e.stderrDone
+	// Wait also waits for stdin to be copied; a reader that blocks for more data has to be
+	// told to stop
+	if e.input != nil {
+		e.input.Close()
+	}
+	e.waitErr = e.cmd.Wait()
+
+	// Report a failed source when FFmpeg itself exited cleanly on the truncated input
+	if e.source != nil {
+		if err := e.source.Wait(); err != nil && e.waitErr == nil {
+			e.waitErr = fmt.Errorf("%s: %w", e.source.Path, err)
+		}
+	}
+}
+
+// opusBufferPool holds scratch buffers for Opus encoding, shared across encoders
+var opusBufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, maxOpusPacketSize)
+		return &buf
+	},
+}
+
+// errEncoderStopped is returned by encodeLoop when it is signaled to stop
+var errEncoderStopped = errors.New("encoder stopped")
+
+// encodeLoop reads PCM s16le data and sends encoded Opus frames until EOF, an error, or ctx is cancelled
+// Every sample is encoded exactly once; a trailing partial frame is padded with silence
+// It returns the number of frames sent
+// volume, if non-nil, is read for every frame and scales its samples by that percentage
+// onFrame, if non-nil, is called with the size of each frame once it has been queued
+func encodeLoop(ctx context.Context, reader io.Reader, enc frameEncoder, frameSize, channels int, volume *atomic.Int32, frameChan chan<- []byte, onFrame func(size int)) (int, error) {
+	// PCM buffer: frameSize samples * channels * 2 bytes per sample
+	pcmBuffer := make([]byte, frameSize*channels*2)
+	pcmSamples := make([]int16, frameSize*channels)
+
+	// Encode into a pooled scratch buffer and send right-sized copies, so each frame
+	// only allocates its encoded length instead of a full packet buffer
+	scratch := opusBufferPool.Get().(*[]byte)
+	defer opusBufferPool.Put(scratch)
+
+	frameCount := 0
+	var firstFrameTime time.Time
+
+	for {
+		if ctx.Err() != nil {
+			return frameCount, errEncoderStopped
+		}
+
+		// Fill exactly one frame; pipe reads are rarely frame-sized
+		// A blocked read is released when cancellation terminates the process
+		n, err := io.ReadFull(reader, pcmBuffer)
+		last := false
+		switch {
+		case ctx.Err() != nil:
+			return frameCount, errEncoderStopped
+		case err == io.EOF:
+			// Stream ended on a frame boundary
+			return frameCount, nil
+		case err == io.ErrUnexpectedEOF:
+			// Pad the final partial frame with silence so the tail isn't lost
+			clear(pcmBuffer[n:])
+			last = true
+		case err != nil:
+			return frameCount, fmt.Errorf("ffmpeg read error: %w", err)
+		}
+
+		if frameCount == 0 {
+			firstFrameTime = time.Now()
+			logger.Debug("First PCM data received", "bytes", n)
+		}
+
+		// Convert bytes to int16 samples
+		for i := range pcmSamples {
+			pcmSamples[i] = int16(binary.LittleEndian.Uint16(pcmBuffer[i*2:]))
+		}
+		if volume != nil {
+			applyGain(pcmSamples, int(volume.Load()))
+		}
+
+		opusBytes, err := enc.Encode(pcmSamples, *scratch)
+		if err != nil {
+			return frameCount, fmt.Errorf("opus encoding error: %w", err)
+		}
+
+		// Send only the encoded bytes; the copy is owned by the receiver
+		frame := make([]byte, opusBytes)
+		copy(frame, (*scratch)[:opusBytes])
+
+		select {
+		case frameChan <- frame:
+			frameCount++
+			if frameCount == 1 {
+				logger.Timing("First opus frame ready", "duration_ms", time.Since(firstFrameTime).Milliseconds())
+			}
+			if onFrame != nil {
+				onFrame(len(frame))
+			}
+			if frameCount%500 == 0 {
+				logger.Debug("Encoding progress", "frames_encoded", frameCount)
+			}
+		case <-ctx.Done():
+			return frameCount, errEncoderStopped
+		}
+
+		if last {
+			return frameCount, nil
+		}
+	}
+}
+
+// OpusFrame returns the next Opus frame from the encoding stream
+// The returned slice is owned by the caller; the encoder never reuses or modifies it
+// It returns ErrNoData instead of io.EOF when FFmpeg never produced any audio
+func (e *Encoder) OpusFrame() ([]byte, error) {
+	frame, ok := <-e.frameChan
+	if !ok {
+		if e.noData.Load() {
+			return nil, ErrNoData
+		}
+		return nil, io.EOF
+	}
+	return frame, nil
+}
+
+// Stats returns the encoder's runtime counters; it is safe to call while encoding
+func (e *Encoder) Stats() EncoderStats {
+	return e.stats.snapshot(e.frameDuration, len(e.frameChan))
+}
+
+// Messages returns the most recent FFmpeg stderr output, including any source process
+func (e *Encoder) Messages() string {
+	return e.stderr.String()
+}
+
+// Cleanup stops the encoder and waits for the process to exit
+// It is safe to call more than once and from any goroutine
+func (e *Encoder) Cleanup() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.done {
+		return nil
+	}
+
+	e.done = true
+
+	// A process that already finished on its own reports its real exit status
+	select {
+	case <-e.exited:
+		return e.waitErr
+	default:
+	}
+
+	// Cancelling sends SIGTERM; exec escalates to SIGKILL after encoderKillDelay
+	e.cancel()
+
+	select {
+	case <-e.exited:
+		return nil
+	case <-time.After(encoderCleanupTimeout):
+		return fmt.Errorf("encoder process did not exit within %v", encoderCleanupTimeout)
+	}
+}
+
+// formatSeekOffset formats a duration as an FFmpeg -ss value in seconds
+func formatSeekOffset(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,512 @@
+package player
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeFrameEncoder records the PCM frames it is asked to encode
+type fakeFrameEncoder struct {
+	frames [][]int16
+}
+
+func (f *fakeFrameEncoder) Encode(pcm []int16, data []byte) (int, error) {
+	f.frames = append(f.frames, append([]int16(nil), pcm...))
+	data[0] = byte(len(f.frames))
+	return 1, nil
+}
+
+func TestEncodeLoopEncodesWholeFrames(t *testing.T) {
+	const frameSize, channels, frames = 960, 2, 5
+
+	pcm := make([]byte, frameSize*channels*2*frames)
+	for i := range pcm {
+		pcm[i] = byte(i)
+	}
+
+	enc := &fakeFrameEncoder{}
+	frameChan := make(chan []byte, frames)
+	count, err := encodeLoop(context.Background(), bytes.NewReader(pcm), enc, frameSize, channels, nil, frameChan, nil)
+	if err != nil {
+		t.Fatalf("encodeLoop returned error: %v", err)
+	}
+
+	if count != frames || len(frameChan) != frames || len(enc.frames) != frames {
+		t.Fatalf("expected %d frames, got count=%d sent=%d encoded=%d", frames, count, len(frameChan), len(enc.frames))
+	}
+
+	// First sample is little-endian bytes 0x00, 0x01
+	if got := enc.frames[0][0]; got != 0x0100 {
+		t.Errorf("first sample = %#x, want 0x0100", got)
+	}
+}
+
+func TestEncodeLoopOddSizedReads(t *testing.T) {
+	const frameSize, channels = 960, 2
+	const totalSamples = frameSize*channels*3 + 1234 // three and a bit frames
+
+	// Deterministic PCM pattern
+	input := make([]int16, totalSamples)
+	pcm := make([]byte, totalSamples*2)
+	for i := range input {
+		input[i] = int16(i*7 - 3000)
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(input[i]))
+	}
+
+	// Write through a pipe in odd-sized chunks so reads never line up with frames
+	pr, pw := io.Pipe()
+	go func() {
+		chunks := []int{1, 333, 4097, 7, 1919}
+		for offset, c := 0, 0; offset < len(pcm); c++ {
+			size := chunks[c%len(chunks)]
+			if offset+size > len(pcm) {
+				size = len(pcm) - offset
+			}
+			pw.Write(pcm[offset : offset+size])
+			offset += size
+		}
+		pw.Close()
+	}()
+
+	enc := &fakeFrameEncoder{}
+	frameChan := make(chan []byte, 10)
+	count, err := encodeLoop(context.Background(), pr, enc, frameSize, channels, nil, frameChan, nil)
+	if err != nil {
+		t.Fatalf("encodeLoop returned error: %v", err)
+	}
+
+	// The trailing partial frame must be padded, not dropped
+	if count != 4 {
+		t.Fatalf("expected 4 frames, got %d", count)
+	}
+
+	output := make([]int16, 0, count*frameSize*channels)
+	for _, frame := range enc.frames {
+		output = append(output, frame...)
+	}
+
+	for i, want := range input {
+		if output[i] != want {
+			t.Fatalf("sample %d = %d, want %d", i, output[i], want)
+		}
+	}
+	for i := len(input); i < len(output); i++ {
+		if output[i] != 0 {
+			t.Fatalf("padding sample %d = %d, want 0", i, output[i])
+		}
+	}
+}
+
+func TestEncodeLoopStops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := encodeLoop(ctx, strings.NewReader(""), &fakeFrameEncoder{}, 960, 2, nil, make(chan []byte), nil)
+	if err != errEncoderStopped {
+		t.Fatalf("expected errEncoderStopped, got %v", err)
+	}
+}
+
+// assertEncoderReleased checks that the process was reaped and the encoder's goroutines have exited
+func assertEncoderReleased(t *testing.T, e *Encoder, goroutines int) {
+	t.Helper()
+
+	if e.cmd.ProcessState == nil {
+		t.Fatal("process was not reaped")
+	}
+	if err := syscall.Kill(e.cmd.Process.Pid, 0); !errors.Is(err, syscall.ESRCH) {
+		t.Fatalf("process %d still exists: %v", e.cmd.Process.Pid, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines leaked: %d before, %d after", goroutines, runtime.NumGoroutine())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEncoderCleanupStopsIdleProcess(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	// sleep never writes, so the encode loop is blocked reading
+	e, err := startEncoder(encoderProcess{name: "sleep", args: []string{"30"}}, &fakeFrameEncoder{}, 960, 2)
+	if err != nil {
+		t.Fatalf("startEncoder: %v", err)
+	}
+
+	start := time.Now()
+	if err := e.Cleanup(); err != nil {
+		t.Fatalf("Cleanup returned error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= encoderKillDelay {
+		t.Errorf("SIGTERM should stop sleep promptly, took %v", elapsed)
+	}
+
+	assertEncoderReleased(t, e, goroutines)
+
+	// Second call is a no-op
+	if err := e.Cleanup(); err != nil {
+		t.Errorf("second Cleanup returned error: %v", err)
+	}
+}
+
+func TestEncoderCleanupUnblocksFullChannel(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	// cat produces PCM faster than anyone reads it, filling frameChan
+	e, err := startEncoder(encoderProcess{name: "cat", args: []string{"/dev/zero"}}, discardFrameEncoder{}, 960, 2)
+	if err != nil {
+		t.Fatalf("startEncoder: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(e.frameChan) < cap(e.frameChan) {
+		if time.Now().After(deadline) {
+			t.Fatal("frame channel never filled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Clean up from another goroutine than the one reading frames
+	errc := make(chan error, 1)
+	go func() { errc <- e.Cleanup() }()
+	if err := <-errc; err != nil {
+		t.Fatalf("Cleanup returned error: %v", err)
+	}
+
+	// Buffered frames drain and then the stream reports EOF
+	for {
+		if _, err := e.OpusFrame(); err == io.EOF {
+			break
+		}
+	}
+
+	assertEncoderReleased(t, e, goroutines)
+}
+
+func TestEncoderCleanupEscalatesToKill(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	// The shell ignores SIGTERM and execs into sleep, which inherits the ignored signal
+	e, err := startEncoder(encoderProcess{name: "sh", args: []string{"-c", "trap '' TERM; exec sleep 30"}}, &fakeFrameEncoder{}, 960, 2)
+	if err != nil {
+		t.Fatalf("startEncoder: %v", err)
+	}
+
+	// Give the shell time to install the trap
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	if err := e.Cleanup(); err != nil {
+		t.Fatalf("Cleanup returned error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < encoderKillDelay {
+		t.Errorf("process ignoring SIGTERM exited after %v, before the kill delay", elapsed)
+	}
+
+	assertEncoderReleased(t, e, goroutines)
+}
+
+func TestFrameCountersSnapshot(t *testing.T) {
+	var c frameCounters
+	if stats := c.snapshot(20*time.Millisecond, 0); stats.AverageBitrate != 0 || stats.SinceLastFrame != 0 {
+		t.Errorf("empty counters = %+v", stats)
+	}
+
+	// 50 frames of 320 bytes at 20ms is one second of 128kbps audio
+	for i := 0; i < 50; i++ {
+		c.add(320)
+	}
+	stats := c.snapshot(20*time.Millisecond, 7)
+	if stats.FramesEncoded != 50 || stats.BytesProduced != 16000 || stats.AverageBitrate != 128000 || stats.FramesBuffered != 7 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestStderrRingKeepsTail(t *testing.T) {
+	r := &stderrRing{max: 8}
+	r.Write([]byte("abcdef"))
+	r.Write([]byte("ghijkl"))
+
+	if got := r.String(); got != "efghijkl" {
+		t.Errorf("ring = %q, want %q", got, "efghijkl")
+	}
+}
+
+func TestEncoderStartupTimeout(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	e, err := startEncoder(encoderProcess{name: "sleep", args: []string{"30"}, startupTimeout: 100 * time.Millisecond}, &fakeFrameEncoder{}, 960, 2)
+	if err != nil {
+		t.Fatalf("startEncoder: %v", err)
+	}
+
+	if _, err := e.OpusFrame(); err != ErrNoData {
+		t.Fatalf("expected ErrNoData, got %v", err)
+	}
+	e.Cleanup()
+
+	assertEncoderReleased(t, e, goroutines)
+}
+
+func TestEncoderPipesSource(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	// Two and a half frames of PCM flow through the source into the main process
+	e, err := startEncoder(encoderProcess{
+		name:   "cat",
+		source: []string{"head", "-c", "9600", "/dev/zero"},
+	}, &fakeFrameEncoder{}, 960, 2)
+	if err != nil {
+		t.Fatalf("startEncoder: %v", err)
+	}
+
+	frames := 0
+	for {
+		if _, err := e.OpusFrame(); err != nil {
+			if err != io.EOF {
+				t.Fatalf("OpusFrame: %v", err)
+			}
+			break
+		}
+		frames++
+	}
+	if frames != 3 {
+		t.Errorf("expected 3 frames, got %d", frames)
+	}
+
+	// fakeFrameEncoder produces 1-byte packets
+	if stats := e.Stats(); stats.FramesEncoded != 3 || stats.BytesProduced != 3 || stats.FramesBuffered != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	if err := e.Cleanup(); err != nil {
+		t.Errorf("Cleanup returned error: %v", err)
+	}
+	if e.source.ProcessState == nil {
+		t.Error("source process was not reaped")
+	}
+	assertEncoderReleased(t, e, goroutines)
+}
+
+func TestEncoderReportsFailedSource(t *testing.T) {
+	e, err := startEncoder(encoderProcess{
+		name:   "cat",
+		source: []string{"sh", "-c", "echo 'ERROR: Video unavailable' >&2; exit 1"},
+	}, &fakeFrameEncoder{}, 960, 2)
+	if err != nil {
+		t.Fatalf("startEncoder: %v", err)
+	}
+
+	if _, err := e.OpusFrame(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+
+	if err := e.Cleanup(); err == nil || !strings.Contains(err.Error(), "sh") {
+		t.Errorf("expected source failure, got %v", err)
+	}
+	if got := e.Messages(); !strings.Contains(got, "Video unavailable") {
+		t.Errorf("Messages() = %q", got)
+	}
+}
+
+func TestEncoderCleanupStopsSource(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	e, err := startEncoder(encoderProcess{
+		name:   "cat",
+		source: []string{"sleep", "30"},
+	}, &fakeFrameEncoder{}, 960, 2)
+	if err != nil {
+		t.Fatalf("startEncoder: %v", err)
+	}
+
+	if err := e.Cleanup(); err != nil {
+		t.Fatalf("Cleanup returned error: %v", err)
+	}
+	if e.source.ProcessState == nil {
+		t.Fatal("source process was not reaped")
+	}
+	assertEncoderReleased(t, e, goroutines)
+}
+
+// waitingReader returns data once, then blocks like a download waiting for more until closed
+type waitingReader struct {
+	data   []byte
+	closed chan struct{}
+}
+
+func (r *waitingReader) Read(p []byte) (int, error) {
+	if len(r.data) > 0 {
+		n := copy(p, r.data)
+		r.data = r.data[n:]
+		return n, nil
+	}
+	<-r.closed
+	return 0, os.ErrClosed
+}
+
+func (r *waitingReader) Close() error {
+	close(r.closed)
+	return nil
+}
+
+func TestEncoderReadsStdin(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	input := &waitingReader{data: make([]byte, 3840), closed: make(chan struct{})}
+	e, err := startEncoder(encoderProcess{name: "cat", stdin: input}, &fakeFrameEncoder{}, 960, 2)
+	if err != nil {
+		t.Fatalf("startEncoder: %v", err)
+	}
+
+	if _, err := e.OpusFrame(); err != nil {
+		t.Fatalf("OpusFrame: %v", err)
+	}
+
+	// The reader is still waiting for more; Cleanup has to stop it
+	if err := e.Cleanup(); err != nil {
+		t.Errorf("Cleanup returned error: %v", err)
+	}
+	select {
+	case <-input.closed:
+	default:
+		t.Error("input was not closed")
+	}
+	assertEncoderReleased(t, e, goroutines)
+}
+
+func TestEncoderMessages(t *testing.T) {
+	e, err := startEncoder(encoderProcess{name: "sh", args: []string{"-c", "echo 'Invalid data found when processing input' >&2"}}, &fakeFrameEncoder{}, 960, 2)
+	if err != nil {
+		t.Fatalf("startEncoder: %v", err)
+	}
+
+	// Stream ends with no frames; stderr is still available afterwards
+	if _, err := e.OpusFrame(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+	e.Cleanup()
+
+	if got := e.Messages(); !strings.Contains(got, "Invalid data found") {
+		t.Errorf("Messages() = %q", got)
+	}
+}
+
+func TestFFmpegArgs(t *testing.T) {
+	settings := DefaultAudioSettings()
+
+	file := EncoderConfig{
+		AudioSettings: settings,
+		Input:         "song.webm",
+		StartOffset:   90 * time.Second,
+		FilterChain:   "bass=g=10",
+	}.ffmpegArgs()
+	want := "-ss 90.000 -i song.webm -af bass=g=10 -f s16le -ar 48000 -ac 2 -loglevel error pipe:1"
+	if got := strings.Join(file, " "); got != want {
+		t.Errorf("file args = %q, want %q", got, want)
+	}
+
+	stream := EncoderConfig{
+		AudioSettings:  settings,
+		Input:          "https://example.com/audio",
+		IsURL:          true,
+		ReconnectFlags: true,
+	}.ffmpegArgs()
+	want = "-reconnect 1 -reconnect_streamed 1 -reconnect_delay_max 5 -i https://example.com/audio -f s16le -ar 48000 -ac 2 -loglevel error pipe:1"
+	if got := strings.Join(stream, " "); got != want {
+		t.Errorf("stream args = %q, want %q", got, want)
+	}
+
+	live := EncoderConfig{
+		AudioSettings:  settings,
+		Input:          "https://example.com/live.m3u8",
+		IsURL:          true,
+		ReconnectFlags: true,
+		Live:           true,
+		StartOffset:    time.Minute,
+	}.ffmpegArgs()
+	want = "-reconnect 1 -reconnect_streamed 1 -reconnect_on_network_error 1 -reconnect_delay_max 2 -live_start_index -1 -i https://example.com/live.m3u8 -f s16le -ar 48000 -ac 2 -loglevel error pipe:1"
+	if got := strings.Join(live, " "); got != want {
+		t.Errorf("live args = %q, want %q", got, want)
+	}
+
+	// A reader can't seek, so the offset is applied to the output
+	download := EncoderConfig{
+		AudioSettings: settings,
+		Input:         "pipe:0",
+		Reader:        strings.NewReader(""),
+		StartOffset:   90 * time.Second,
+	}.ffmpegArgs()
+	want = "-i pipe:0 -ss 90.000 -f s16le -ar 48000 -ac 2 -loglevel error pipe:1"
+	if got := strings.Join(download, " "); got != want {
+		t.Errorf("download args = %q, want %q", got, want)
+	}
+
+	proxied := EncoderConfig{
+		AudioSettings: settings,
+		Input:         "https://example.com/audio",
+		IsURL:         true,
+		Proxy:         "http://proxy.example:3128",
+	}.ffmpegArgs()
+	want = "-http_proxy http://proxy.example:3128 -i https://example.com/audio -f s16le -ar 48000 -ac 2 -loglevel error pipe:1"
+	if got := strings.Join(proxied, " "); got != want {
+		t.Errorf("proxied args = %q, want %q", got, want)
+	}
+}
+
+// discardFrameEncoder produces a fixed-size packet without recording anything
+type discardFrameEncoder struct{}
+
+func (discardFrameEncoder) Encode(pcm []int16, data []byte) (int, error) {
+	return 320, nil
+}
+
+func BenchmarkEncodeLoop(b *testing.B) {
+	const frameSize, channels, frames = 960, 2, 500
+
+	pcm := make([]byte, frameSize*channels*2*frames)
+	for i := range pcm {
+		pcm[i] = byte(i)
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		frameChan := make(chan []byte, frames)
+		if _, err := encodeLoop(context.Background(), bytes.NewReader(pcm), discardFrameEncoder{}, frameSize, channels, nil, frameChan, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDirectLinksNeverReachFFmpeg(t *testing.T) {
+	track := &Track{URL: "https://example.com/song.mp3", Source: SourceDirect}
+
+	if _, err := newEncoder(track, DefaultAudioSettings(), 0, "", StreamModeURL, nil); !errors.Is(err, errNoDirectOpener) {
+		t.Errorf("without an opener: err = %v, want errNoDirectOpener", err)
+	}
+
+	refused := errors.New("links to local network addresses aren't allowed")
+	var opened string
+	open := func(ctx context.Context, link string) (io.ReadCloser, error) {
+		opened = link
+		return nil, refused
+	}
+	if _, err := newEncoder(track, DefaultAudioSettings(), 0, "", StreamModeURL, open); !errors.Is(err, refused) {
+		t.Errorf("refused link: err = %v, want the opener's error", err)
+	}
+	if opened != track.URL {
+		t.Errorf("opener got %q, want %q", opened, track.URL)
+	}
+}
@@ -0,0 +1,193 @@
+package player
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/tools"
+)
+
+// MaxCustomFilterLength caps the length of user-supplied filter chains
+const MaxCustomFilterLength = 256
+
+// customFilterPattern allows only characters used by plain filter chains; quotes, whitespace,
+// graph labels ([]) and chain separators (;) are rejected
+var customFilterPattern = regexp.MustCompile(`^[A-Za-z0-9_=:,.+*/|()-]+$`)
+
+// allowedFilters lists the audio filters custom chains may use; none of them take options
+// that read or write files or open network sockets, unlike ametadata, arnndn, sofalizer,
+// amovie or ladspa, so anything not listed is refused
+var allowedFilters = map[string]bool{
+	"acompressor": true, "acontrast": true, "acrusher": true, "adeclick": true, "adeclip": true,
+	"adelay": true, "aecho": true, "aemphasis": true, "aeval": true, "aexciter": true,
+	"afade": true, "afftdn": true, "aformat": true, "agate": true, "alimiter": true,
+	"allpass": true, "anequalizer": true, "anlmdn": true, "apad": true, "aphaser": true,
+	"apulsator": true, "aresample": true, "areverse": true, "asetrate": true, "asoftclip": true,
+	"asubboost": true, "asubcut": true, "asupercut": true, "atempo": true, "atrim": true,
+	"bandpass": true, "bandreject": true, "bass": true, "biquad": true, "chorus": true,
+	"compand": true, "compensationdelay": true, "crystalizer": true, "dcshift": true,
+	"deesser": true, "dynaudnorm": true, "earwax": true, "equalizer": true, "extrastereo": true,
+	"firequalizer": true, "flanger": true, "haas": true, "highpass": true, "highshelf": true,
+	"loudnorm": true, "lowpass": true, "lowshelf": true, "mcompand": true, "pan": true,
+	"rubberband": true, "silenceremove": true, "speechnorm": true, "stereotools": true,
+	"stereowiden": true, "superequalizer": true, "surround": true, "treble": true,
+	"tremolo": true, "vibrato": true, "virtualbass": true, "volume": true,
+}
+
+// pathLikeValue matches option values that name a file or URL rather than a number or an
+// expression: absolute and relative paths, URLs (whose "//" is left once the chain is
+// split on ":") and names with a file extension
+var pathLikeValue = regexp.MustCompile(`^/|^\./|//|\.\.|[A-Za-z_][A-Za-z0-9_-]*\.[A-Za-z]`)
+
+// AudioFilter is an FFmpeg audio filter chain applied while encoding
+type AudioFilter struct {
+	Name       string
+	Expression string  // FFmpeg -af filter chain (empty for no filtering)
+	Speed      float64 // Playback speed relative to the source (1.0 for no tempo change)
+}
+
+// NoFilter disables audio filtering
+var NoFilter = AudioFilter{Name: "off", Speed: 1.0}
+
+// FilterPresets maps preset names to their filters
+// Tempo-changing presets resample to 48kHz first so the speed factor is independent of the source rate
+var FilterPresets = map[string]AudioFilter{
+	"off": NoFilter,
+	"bassboost": {
+		Name:       "bassboost",
+		Expression: "bass=g=10:f=110:w=0.6",
+		Speed:      1.0,
+	},
+	"nightcore": {
+		Name:       "nightcore",
+		Expression: "aresample=48000,asetrate=48000*1.25,aresample=48000",
+		Speed:      1.25,
+	},
+	"vaporwave": {
+		Name:       "vaporwave",
+		Expression: "aresample=48000,asetrate=48000*0.8,aresample=48000",
+		Speed:      0.8,
+	},
+	"karaoke": {
+		Name:       "karaoke",
+		Expression: "pan=stereo|c0=c0-c1|c1=c1-c0",
+		Speed:      1.0,
+	},
+	"tremolo": {
+		Name:       "tremolo",
+		Expression: "tremolo=f=6:d=0.5",
+		Speed:      1.0,
+	},
+}
+
+// CustomFilter returns the filter for a /filter custom chain
+func CustomFilter(expression string) AudioFilter {
+	return AudioFilter{Name: "custom", Expression: expression, Speed: 1.0}
+}
+
+// frameAdvance returns how much source time one output frame covers with this filter
+func (f AudioFilter) frameAdvance(frameDuration time.Duration) time.Duration {
+	if f.Speed <= 0 {
+		return frameDuration
+	}
+	return time.Duration(float64(frameDuration) * f.Speed)
+}
+
+// RealTime converts a span of source time to wall-clock playback time with this filter
+func (f AudioFilter) RealTime(d time.Duration) time.Duration {
+	if f.Speed <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) / f.Speed)
+}
+
+// ValidateCustomFilter checks a user-supplied filter chain and dry-runs it against
+// a second of silence to make sure FFmpeg accepts it
+func ValidateCustomFilter(expression string) error {
+	if expression == "" {
+		return fmt.Errorf("filter expression is empty")
+	}
+
+	if err := checkCustomFilter(expression); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx,
+		tools.FFmpeg,
+		"-hide_banner",
+		"-loglevel", "error",
+		"-f", "lavfi",
+		"-i", "anullsrc=r=48000:cl=stereo",
+		"-t", "1",
+		"-af", expression,
+		"-f", "null",
+		"-",
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("filter validation timed out")
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("invalid filter: %s", firstLine(msg))
+		}
+		return fmt.Errorf("invalid filter: %w", err)
+	}
+
+	return nil
+}
+
+// checkCustomFilter checks that a filter chain only uses allowed filters, with no option
+// values that look like a path or URL
+func checkCustomFilter(expression string) error {
+	if len(expression) > MaxCustomFilterLength {
+		return fmt.Errorf("filter expression is longer than %d characters", MaxCustomFilterLength)
+	}
+
+	if !customFilterPattern.MatchString(expression) || strings.HasPrefix(expression, "-") {
+		return fmt.Errorf("filter expression contains unsupported characters")
+	}
+
+	for _, part := range strings.Split(expression, ",") {
+		name, args, _ := strings.Cut(part, "=")
+		if !allowedFilters[name] {
+			return fmt.Errorf("filter %q is not allowed", name)
+		}
+		for _, arg := range strings.Split(args, ":") {
+			// Positional values have no key
+			value := arg[strings.IndexByte(arg, '=')+1:]
+			if pathLikeValue.MatchString(value) {
+				return fmt.Errorf("filter %q can't be given a file or URL", name)
+			}
+		}
+	}
+	return nil
+}
+
+// firstLine returns the first line of a multi-line string
+func firstLine(s string) string {
+	if idx := strings.IndexByte(s, '\n'); idx != -1 {
+		return s[:idx]
+	}
+	return s
+}
+
+// lastLines returns the last n lines of a multi-line string, ignoring surrounding whitespace
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
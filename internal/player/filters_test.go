@@ -0,0 +1,62 @@
+package player
+
+import "testing"
+
+func TestCheckCustomFilter(t *testing.T) {
+	tests := []struct {
+		expression string
+		ok         bool
+	}{
+		{"bass=g=10:f=110:w=0.6", true},
+		{"volume=0.5,atempo=1.1", true},
+		{"volume=.5", true},
+		{"volume=1/2", true},
+		{"pan=stereo|c0=c0-c1|c1=c1-c0", true},
+		{"aecho=0.8:0.9:1000:0.3", true},
+
+		// Filters that read or write files
+		{"ametadata=mode=print:file=/tmp/out", false},
+		{"arnndn=m=/models/voice.rnnn", false},
+		{"sofalizer=sofa=/etc/passwd", false},
+		{"amovie=/etc/passwd", false},
+		{"volume=1,ladspa=file=cmt", false},
+		{"azmq", false},
+		{"Volume=0.5", false},
+
+		// Allowed filters given a path or URL
+		{"volume=/etc/passwd", false},
+		{"volume=volume=./gain", false},
+		{"aeval=exprs=../../secret", false},
+		{"volume=http://169.254.169.254/latest", false},
+		{"equalizer=f=presets/loud.txt", false},
+		{"volume=gain.txt", false},
+
+		{"volume=1;amovie=x", false},
+		{"-volume=1", false},
+	}
+	for _, tt := range tests {
+		err := checkCustomFilter(tt.expression)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkCustomFilter(%q) = %v, want allowed: %v", tt.expression, err, tt.ok)
+		}
+	}
+}
+
+func TestCheckCustomFilterAllowsPresets(t *testing.T) {
+	for name, preset := range FilterPresets {
+		if preset.Expression == "" {
+			continue
+		}
+		if err := checkCustomFilter(preset.Expression); err != nil {
+			t.Errorf("preset %s: %v", name, err)
+		}
+	}
+}
+
+func TestValidateCustomFilterRejectsBeforeRunningFFmpeg(t *testing.T) {
+	for _, expression := range []string{"", "ametadata=mode=print:file=out", "arnndn=m=x", "sofalizer=sofa=/x"} {
+		if err := ValidateCustomFilter(expression); err == nil {
+			t.Errorf("ValidateCustomFilter(%q) = nil, want an error", expression)
+		}
+	}
+}
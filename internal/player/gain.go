@@ -0,0 +1,50 @@
+package player
+
+import "math"
+
+// Volume limits in percent; volumes above MaxVolume boost the audio, which a guild must allow
+const (
+	MaxVolume        = 100
+	MaxBoostedVolume = 200
+)
+
+// Per-track volume limits in percent of the guild's volume
+const (
+	MinTrackVolume = 50
+	MaxTrackVolume = 150
+)
+
+// trackVolume is the volume a track plays at: the guild's volume raised or lowered by the
+// track's offset, never above limit so an offset can't boost a guild that doesn't allow it
+func trackVolume(volume int, track *Track, limit int) int {
+	if track == nil || track.VolumeOffset == 0 {
+		return volume
+	}
+	return min(volume*(100+track.VolumeOffset)/100, limit)
+}
+
+// limiterKnee is the level, as a fraction of full scale, above which boosted samples are
+// compressed instead of scaled
+const limiterKnee = 0.8
+
+// applyGain scales interleaved PCM samples in place by a volume in percent
+// Boosted samples louder than the knee are bent toward full scale along a tanh curve, so
+// loud passages saturate smoothly instead of clipping hard or wrapping around
+func applyGain(samples []int16, volume int) {
+	if volume == MaxVolume {
+		return
+	}
+
+	const full = math.MaxInt16
+	const knee = limiterKnee * full
+	gain := float64(volume) / 100
+	for i, s := range samples {
+		x := float64(s) * gain
+		if volume > MaxVolume {
+			if level := math.Abs(x); level > knee {
+				x = math.Copysign(knee+(full-knee)*math.Tanh((level-knee)/(full-knee)), x)
+			}
+		}
+		samples[i] = int16(math.Round(x))
+	}
+}
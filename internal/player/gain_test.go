@@ -0,0 +1,116 @@
+package player
+
+import (
+	"math"
+	"testing"
+)
+
+// fullScaleSine is one 20ms stereo frame of a 1kHz sine at full scale, with both extremes
+func fullScaleSine() []int16 {
+	samples := make([]int16, 960*2)
+	for i := 0; i < 960; i++ {
+		v := int16(math.Round(math.Sin(2*math.Pi*1000*float64(i)/48000) * math.MaxInt16))
+		samples[2*i], samples[2*i+1] = v, v
+	}
+	samples[0], samples[1] = math.MaxInt16, math.MinInt16
+	return samples
+}
+
+func TestApplyGainBoostDoesNotWrap(t *testing.T) {
+	for _, volume := range []int{101, 150, MaxBoostedVolume} {
+		in := fullScaleSine()
+		out := append([]int16(nil), in...)
+		applyGain(out, volume)
+
+		// A wrapped sample flips sign; a limited one keeps it and stays near full scale
+		for i := range in {
+			if in[i] > 0 && out[i] <= 0 || in[i] < 0 && out[i] >= 0 || in[i] == 0 && out[i] != 0 {
+				t.Fatalf("volume %d: sample %d went from %d to %d", volume, i, in[i], out[i])
+			}
+			if abs := math.Abs(float64(out[i])); abs > math.MaxInt16 || abs < math.Abs(float64(in[i]))*limiterKnee {
+				t.Fatalf("volume %d: sample %d went from %d to %d", volume, i, in[i], out[i])
+			}
+		}
+	}
+}
+
+func TestApplyGainLimiterIsSmooth(t *testing.T) {
+	// Louder input never comes out quieter, so the limiter saturates rather than folds back
+	prev := int16(0)
+	for s := 0; s <= math.MaxInt16; s += 7 {
+		sample := []int16{int16(s)}
+		applyGain(sample, MaxBoostedVolume)
+		if sample[0] < prev {
+			t.Fatalf("%d came out as %d, below %d for a quieter sample", s, sample[0], prev)
+		}
+		prev = sample[0]
+	}
+}
+
+func TestApplyGainScales(t *testing.T) {
+	samples := []int16{1000, -1000, math.MaxInt16, math.MinInt16}
+	applyGain(samples, MaxVolume)
+	if samples[0] != 1000 || samples[3] != math.MinInt16 {
+		t.Errorf("unity gain changed the samples: %v", samples)
+	}
+
+	applyGain(samples, 50)
+	if want := []int16{500, -500, 16384, -16384}; samples[0] != want[0] || samples[1] != want[1] || samples[2] != want[2] || samples[3] != want[3] {
+		t.Errorf("half volume = %v, want %v", samples, want)
+	}
+
+	// Quiet samples below the knee are scaled without limiting
+	quiet := []int16{10000}
+	applyGain(quiet, 150)
+	if quiet[0] != 15000 {
+		t.Errorf("boosted 10000 = %d, want 15000", quiet[0])
+	}
+}
+
+func TestSetTrackVolume(t *testing.T) {
+	m := NewManager()
+	p := m.GetPlayer("guild")
+	if err := p.SetTrackVolume(-20); err == nil {
+		t.Error("SetTrackVolume succeeded with nothing playing")
+	}
+
+	p.Queue.Add(&Track{Title: "loud"})
+	p.Queue.Next()
+	if err := p.SetVolume(50); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetTrackVolume(-20); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Queue.Current().VolumeOffset; got != -20 {
+		t.Errorf("VolumeOffset = %d, want -20", got)
+	}
+	if got := p.GetEncoderSettings().Volume.Load(); got != 40 {
+		t.Errorf("encoders scale by %d%%, want 40%% for 80%% of 50", got)
+	}
+
+	if err := p.SetTrackVolume(MaxTrackVolume); err == nil {
+		t.Error("SetTrackVolume accepted an offset above the limit")
+	}
+	// An offset can't lift the guild's volume past what it allows
+	if err := p.SetVolume(MaxVolume); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetTrackVolume(MaxTrackVolume - 100); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.GetEncoderSettings().Volume.Load(); got != MaxVolume {
+		t.Errorf("encoders scale by %d%% without boost allowed, want %d%%", got, MaxVolume)
+	}
+	p.SetAllowBoost(true)
+	if err := p.SetTrackVolume(MaxTrackVolume - 100); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.GetEncoderSettings().Volume.Load(); got != MaxTrackVolume {
+		t.Errorf("encoders scale by %d%% with boost allowed, want %d%%", got, MaxTrackVolume)
+	}
+	p.SetAllowBoost(false)
+	if got := p.GetEncoderSettings().Volume.Load(); got != MaxVolume {
+		t.Errorf("encoders scale by %d%% after forbidding boost, want %d%%", got, MaxVolume)
+	}
+}
@@ -0,0 +1,78 @@
+package player
+
+import (
+	"sync"
+	"time"
+)
+
+// opusSilence is a 20ms Opus frame of silence, sent in place of audio when the jitter buffer under-runs
+var opusSilence = []byte{0xf8, 0xff, 0xfe}
+
+// opusSilenceDuration is how much audio opusSilence covers; other frame durations send nothing on an under-run
+const opusSilenceDuration = 20 * time.Millisecond
+
+// sendClock ticks once per send slot; tests drive one by hand instead of waiting on real time
+type sendClock interface {
+	C() <-chan time.Time
+	Stop()
+	Reset(d time.Duration)
+}
+
+// tickerClock is the sendClock playback uses outside tests
+type tickerClock struct {
+	ticker *time.Ticker
+}
+
+func (c tickerClock) C() <-chan time.Time   { return c.ticker.C }
+func (c tickerClock) Stop()                 { c.ticker.Stop() }
+func (c tickerClock) Reset(d time.Duration) { c.ticker.Reset(d) }
+
+// bufferedFrame is a frame read ahead from an encoder, or the error that ended it
+type bufferedFrame struct {
+	data []byte
+	err  error
+}
+
+// jitterBuffer reads frames from an encoder ahead of playback, so a slow read doesn't hold up
+// the send clock; reading stops at the encoder's first error, which is delivered last
+type jitterBuffer struct {
+	frames chan bufferedFrame
+	done   chan struct{}
+	once   sync.Once
+}
+
+// newJitterBuffer starts reading up to depth frames ahead of playback from an encoder
+// The reader exits once closed, after its pending read returns; cleaning up the encoder ends it
+func newJitterBuffer(encoder EncoderInterface, depth int) *jitterBuffer {
+	j := &jitterBuffer{
+		frames: make(chan bufferedFrame, depth),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		for {
+			data, err := encoder.OpusFrame()
+			select {
+			case j.frames <- bufferedFrame{data: data, err: err}:
+			case <-j.done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return j
+}
+
+// close stops reading ahead, discarding buffered frames; it is safe to call more than once
+func (j *jitterBuffer) close() {
+	j.once.Do(func() { close(j.done) })
+}
+
+// jitterBufferDepth is how many frames of settings.JitterBuffer fit, at least one
+func jitterBufferDepth(settings AudioSettings) int {
+	if settings.FrameDuration <= 0 {
+		return 1
+	}
+	return max(1, int(settings.JitterBuffer/settings.FrameDuration))
+}
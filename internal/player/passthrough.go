@@ -0,0 +1,156 @@
+package player
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+)
+
+// PassthroughEncoder sends the Opus packets of a cached WebM file as-is instead of
+// decoding and re-encoding them
+type PassthroughEncoder struct {
+	file          *os.File
+	demuxer       *webmDemuxer
+	frameDuration time.Duration
+	next          []byte // first packet, read while checking eligibility
+	mu            sync.Mutex
+	done          bool
+	stats         frameCounters
+}
+
+// NewPassthroughEncoder opens a cached file for passthrough starting at startAt
+// It returns an error when the file can't be sent as-is: not WebM, not Opus, or packets
+// that don't match the configured channels and frame duration
+func NewPassthroughEncoder(path string, settings AudioSettings, startAt time.Duration) (*PassthroughEncoder, error) {
+	start := time.Now()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cached file: %w", err)
+	}
+
+	encoder, err := newPassthroughEncoder(file, settings, startAt)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	logger.Timing("Passthrough encoder creation completed", "start_at", startAt, "duration_ms", time.Since(start).Milliseconds())
+	return encoder, nil
+}
+
+// passthroughOverhead allows for the WebM framing counted in a cached file's size on top of
+// its Opus packets
+const passthroughOverhead = 1.05
+
+// checkPassthroughBitrate returns an error unless a cached file's audio, averaged over the
+// track's length, fits the bitrate the guild plays at; sending it as-is would otherwise
+// exceed a lower channel bitrate or override. Files of unknown length are transcoded
+func checkPassthroughBitrate(path string, duration time.Duration, bitrate int) error {
+	if duration <= 0 {
+		return fmt.Errorf("track length is unknown, so its bitrate can't be checked")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to check cached file: %w", err)
+	}
+	source := float64(info.Size()*8) / duration.Seconds() / passthroughOverhead
+	if source > float64(bitrate) {
+		return fmt.Errorf("%.0f kbps source is above the %d kbps output", source/1000, bitrate/1000)
+	}
+	return nil
+}
+
+func newPassthroughEncoder(file *os.File, settings AudioSettings, startAt time.Duration) (*PassthroughEncoder, error) {
+	demuxer, err := newWebMDemuxer(file)
+	if err != nil {
+		return nil, err
+	}
+
+	audio := demuxer.audio
+	if audio.codec != "A_OPUS" {
+		return nil, fmt.Errorf("codec %s is not Opus", audio.codec)
+	}
+	if audio.sampleRate != float64(settings.SampleRate) || audio.channels != settings.Channels {
+		return nil, fmt.Errorf("%gHz %d-channel audio doesn't match the %dHz %d-channel output",
+			audio.sampleRate, audio.channels, settings.SampleRate, settings.Channels)
+	}
+
+	// Packets are read without decoding, so skipping ahead is cheap
+	packet, err := demuxer.Next()
+	for err == nil && packet.Timestamp+opusPacketDuration(packet.Data) <= startAt {
+		packet, err = demuxer.Next()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read first Opus packet: %w", err)
+	}
+
+	if d := opusPacketDuration(packet.Data); d != settings.FrameDuration {
+		return nil, fmt.Errorf("%v Opus packets don't match the %v frame duration", d, settings.FrameDuration)
+	}
+
+	return &PassthroughEncoder{
+		file:          file,
+		demuxer:       demuxer,
+		frameDuration: settings.FrameDuration,
+		next:          packet.Data,
+	}, nil
+}
+
+// OpusFrame returns the next Opus packet from the file
+// The returned slice is owned by the caller
+func (e *PassthroughEncoder) OpusFrame() ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.done {
+		return nil, io.EOF
+	}
+
+	if e.next != nil {
+		frame := e.next
+		e.next = nil
+		e.stats.add(len(frame))
+		return frame, nil
+	}
+
+	packet, err := e.demuxer.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	// Playback timing assumes every packet covers one frame
+	if d := opusPacketDuration(packet.Data); d != e.frameDuration {
+		return nil, fmt.Errorf("unexpected %v Opus packet at %v", d, packet.Timestamp)
+	}
+
+	e.stats.add(len(packet.Data))
+	return packet.Data, nil
+}
+
+// Stats returns the packets read so far; nothing is buffered ahead of the reader
+func (e *PassthroughEncoder) Stats() EncoderStats {
+	return e.stats.snapshot(e.frameDuration, 0)
+}
+
+// Messages returns diagnostic output; passthrough has no external process, so it's always empty
+func (e *PassthroughEncoder) Messages() string {
+	return ""
+}
+
+// Cleanup closes the file; it is safe to call more than once
+func (e *PassthroughEncoder) Cleanup() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.done {
+		return nil
+	}
+
+	e.done = true
+	return e.file.Close()
+}
@@ -2,26 +2,125 @@ package player
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/sponsorblock"
+	"github.com/GrainedLotus515/gobard/internal/store"
+	"github.com/GrainedLotus515/gobard/internal/tools"
 	"github.com/bwmarrin/discordgo"
 )
 
+// sponsorDiscardThreshold is the longest SponsorBlock segment skipped by discarding frames
+// Longer segments restart the encoder at the end of the segment instead
+const sponsorDiscardThreshold = 3 * time.Second
+
+// earlyEndTolerance is how far short of its duration a track may end before it is reported as failed
+const earlyEndTolerance = 5 * time.Second
+
+// voiceReadyTimeout is how long playback waits for the voice connection to become ready
+const voiceReadyTimeout = 5 * time.Second
+
+// voiceReadyPoll is how often the voice connection is checked while waiting for it
+const voiceReadyPoll = 20 * time.Millisecond
+
+// maxLiveRefreshes is how many times in a row a stopped livestream is re-extracted before playback gives up
+const maxLiveRefreshes = 3
+
+// NoTrackLimit is the GuildPlayer.SetMaxTrackDuration limit that lets a guild queue tracks of any length
+const NoTrackLimit time.Duration = -1
+
+// PlaybackReason is why a track stopped playing
+type PlaybackReason int
+
+const (
+	// ReasonFinished means the track played to its end
+	ReasonFinished PlaybackReason = iota
+	// ReasonSkipped means Skip ended the track
+	ReasonSkipped
+	// ReasonStopped means Stop ended playback
+	ReasonStopped
+	// ReasonFailed means the track couldn't be played to its end; PlaybackResult.Err says why
+	ReasonFailed
+)
+
+// String returns the reason's name for logging
+func (r PlaybackReason) String() string {
+	switch r {
+	case ReasonFinished:
+		return "finished"
+	case ReasonSkipped:
+		return "skipped"
+	case ReasonStopped:
+		return "stopped"
+	case ReasonFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("PlaybackReason(%d)", int(r))
+}
+
+// ErrEncoderStart is wrapped by failures to start the encoder for a track
+var ErrEncoderStart = errors.New("failed to start encoder")
+
+// ErrVoiceNotReady is returned by Play when the voice connection exists but can't carry audio,
+// as after it silently died during a long idle or a gateway resume
+var ErrVoiceNotReady = errors.New("voice connection is not ready")
+
+// ErrVoiceNeverReady is returned when the voice connection didn't become ready within voiceReadyTimeout
+var ErrVoiceNeverReady = errors.New("voice connection never became ready")
+
+// ErrVoiceLost is returned when the voice connection went away or stopped accepting audio mid-track
+var ErrVoiceLost = errors.New("voice connection lost")
+
+// PlaybackResult is how and where the playback of a track ended
+type PlaybackResult struct {
+	Reason   PlaybackReason
+	Err      error         // Set when Reason is ReasonFailed
+	Position time.Duration // Playhead when playback ended
+}
+
+// Retryable reports whether a failed track never got going, so playing it again with a
+// fresh stream URL may work
+func (r PlaybackResult) Retryable() bool {
+	return r.Reason == ReasonFailed && (errors.Is(r.Err, ErrNoData) || errors.Is(r.Err, ErrEncoderStart))
+}
+
+// VoiceJoiner joins a guild's voice channel; the bot provides it so players can rejoin
+// without knowing about the Discord session
+type VoiceJoiner func(guildID, channelID string) (*discordgo.VoiceConnection, error)
+
 // EncoderInterface defines the interface for audio encoders
 type EncoderInterface interface {
 	OpusFrame() ([]byte, error)
+	Messages() string
+	Stats() EncoderStats
 	Cleanup() error
 }
 
+// AudioStats is a snapshot of a player's encoder and send counters
+type AudioStats struct {
+	Encoder       EncoderStats
+	HasEncoder    bool
+	FramesSent    int64         // frames sent to Discord for the current track
+	SinceLastSend time.Duration // 0 before the first frame
+	Underruns     int64         // send slots the jitter buffer had no frame for, filled with silence
+}
+
 // GuildPlayer manages playback for a single guild
 type GuildPlayer struct {
 	GuildID         string
 	Queue           *Queue
 	VoiceConnection *discordgo.VoiceConnection
+	// VoiceChannelID is the voice channel last joined, used to rejoin after the connection dies
+	VoiceChannelID string
+	// TextChannelID is the text channel playback was started from, where notices about it go
+	TextChannelID string
 
 	// Playback state
 	Playing         bool
@@ -30,30 +129,268 @@ type GuildPlayer struct {
 	CurrentPosition time.Duration
 	Volume          int
 
+	// AllowBoost lets the volume go above MaxVolume, up to MaxBoostedVolume
+	AllowBoost bool
+
+	// Audio filter applied by the encoder
+	Filter AudioFilter
+
+	// Encoder settings; BitrateOverride (bits per second) replaces the default bitrate when non-zero
+	// and ChannelBitrate holds the voice channel's bitrate (0 if unknown)
+	AudioSettings   AudioSettings
+	BitrateOverride int
+	ChannelBitrate  int
+
+	// Robustness overrides FEC and expected packet loss with a RobustnessLevels entry ("" for the default)
+	Robustness string
+
+	// spotifyMarket overrides the country used for Spotify lookups ("" for SPOTIFY_MARKET)
+	spotifyMarket string
+
+	// searchProvider overrides where searches look: "youtube" or "youtube_music" ("" for
+	// SEARCH_PROVIDER)
+	searchProvider string
+
+	// playbackMode overrides how tracks that aren't cached yet play: "stream-first",
+	// "download-first" or "auto" ("" for PLAYBACK_MODE)
+	playbackMode string
+
+	// maxTrackDuration overrides MAX_TRACK_DURATION when positive; NoTrackLimit lifts the
+	// limit and 0 uses the default
+	maxTrackDuration time.Duration
+
+	// fairQueue lets requesters take turns after every bulk add, as /play interleave does
+	fairQueue bool
+
+	// followRequester moves the bot into the voice channel the current track's requester
+	// switches to, once nobody is left listening
+	followRequester bool
+
+	// A-B section looping
+	ABLoopActive bool
+	ABLoopStart  time.Duration
+	ABLoopEnd    time.Duration
+
+	// ReplayFromStartAt makes looped replays honor Track.StartAt instead of starting from 0
+	ReplayFromStartAt bool
+
+	// StreamMode selects how uncached tracks are streamed
+	StreamMode StreamMode
+
 	// Voice reduction
 	ReduceOnVoice       bool
 	ReduceOnVoiceTarget int
 	OriginalVolume      int
 
-	// Encoder
-	stopChan chan bool
-	doneChan chan bool
+	// Frames sent to Discord for the current track, readable while playing
+	framesSent atomic.Int64
+	lastSent   atomic.Int64 // UnixNano of the last send
+	underruns  atomic.Int64 // send slots the jitter buffer had no frame for
+
+	// volume mirrors Volume for encoders, which scale decoded audio by it as they go
+	volume atomic.Int32
+
+	// pendingClip waits for the send loop to play it in place of the track's frames;
+	// sendingTrack is set while the send loop runs and sendingClip while PlayClip sends a
+	// clip on its own
+	pendingClip  *clip
+	sendingTrack bool
+	sendingClip  bool
+
+	// Encoder; stopChan carries why playback is being ended and doneChan how it ended
+	stopChan chan PlaybackReason
+	doneChan chan PlaybackResult
+	seekChan chan time.Duration
 	encoder  EncoderInterface
 
+	// openDirect fetches direct links for FFmpeg (nil refuses to play them)
+	openDirect DirectOpener
+
+	// openEncoder replaces newEncoder when set, letting tests play without ffmpeg
+	openEncoder func(track *Track, settings AudioSettings, startAt time.Duration, filter string, mode StreamMode) (EncoderInterface, error)
+
+	// newClock replaces the send clock's ticker when set, letting tests pace frames by hand
+	newClock func(frame time.Duration) sendClock
+
+	// SponsorBlock client (nil when disabled)
+	sponsorBlock *sponsorblock.Client
+	// sponsorVideo is the video whose SponsorBlock segments sponsorSegments holds, so replays
+	// don't look them up again
+	sponsorVideo    string
+	sponsorSegments []sponsorblock.Segment
+
+	// started holds the contexts, shared by a queued track's copies, of tracks that have
+	// started playing; each goes once its track leaves the queue
+	started map[context.Context]bool
+
+	// joinVoice joins a voice channel for EnsureVoice and Rejoin
+	joinVoice VoiceJoiner
+
 	mu sync.RWMutex
+	// joinMu serializes joins so concurrent commands join the voice channel once
+	joinMu sync.Mutex
 }
 
 // Manager manages all guild players
 type Manager struct {
-	players map[string]*GuildPlayer
-	mu      sync.RWMutex
+	players           map[string]*GuildPlayer
+	audioSettings     AudioSettings
+	sponsorBlock      *sponsorblock.Client
+	replayFromStartAt bool
+	historyLimit      int
+	joinVoice         VoiceJoiner
+	streamMode        StreamMode
+	openDirect        DirectOpener
+	defaults          PlayerDefaults
+	volumes           *store.Store[int]    // Per-guild default volumes; nil if not kept
+	filters           *store.Store[string] // Per-guild custom filter chains; nil if not kept
+	mu                sync.RWMutex
 }
 
 // NewManager creates a new player manager
 func NewManager() *Manager {
 	return &Manager{
-		players: make(map[string]*GuildPlayer),
+		players:       make(map[string]*GuildPlayer),
+		audioSettings: DefaultAudioSettings(),
+		streamMode:    StreamModeURL,
+		defaults:      DefaultPlayerDefaults(),
+		historyLimit:  DefaultHistoryLimit,
+	}
+}
+
+// AudioSettings returns the encoder settings used by newly created players
+func (m *Manager) AudioSettings() AudioSettings {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.audioSettings
+}
+
+// SetAudioSettings sets the encoder settings used by newly created players
+func (m *Manager) SetAudioSettings(settings AudioSettings) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.audioSettings = settings
+}
+
+// SetSponsorBlock sets the SponsorBlock client used by newly created players
+func (m *Manager) SetSponsorBlock(client *sponsorblock.Client) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sponsorBlock = client
+}
+
+// SetReplayFromStartAt sets whether newly created players restart looped tracks at their StartAt offset
+func (m *Manager) SetReplayFromStartAt(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replayFromStartAt = enabled
+}
+
+// SetHistoryLimit sets how many played tracks newly created players' queues keep
+func (m *Manager) SetHistoryLimit(limit int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.historyLimit = limit
+}
+
+// SetVoiceJoiner sets how newly created players join voice channels
+func (m *Manager) SetVoiceJoiner(join VoiceJoiner) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.joinVoice = join
+}
+
+// SetStreamMode sets how newly created players stream uncached tracks
+func (m *Manager) SetStreamMode(mode StreamMode) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.streamMode = mode
+}
+
+// SetDirectOpener sets how newly created players fetch direct links
+func (m *Manager) SetDirectOpener(open DirectOpener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.openDirect = open
+}
+
+// SetDefaults sets the volume and voice reduction settings newly created players start with
+func (m *Manager) SetDefaults(defaults PlayerDefaults) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.defaults = defaults
+}
+
+// SetVolumeStore sets where guilds' own default volumes are kept; they override the
+// configured default volume
+func (m *Manager) SetVolumeStore(volumes *store.Store[int]) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.volumes = volumes
+}
+
+// DefaultVolume returns the volume a guild's player starts at, and whether the guild set it
+func (m *Manager) DefaultVolume(guildID string) (int, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.defaultVolume(guildID)
+}
+
+// defaultVolume is DefaultVolume without locking; the caller must hold m.mu
+func (m *Manager) defaultVolume(guildID string) (int, bool) {
+	if m.volumes != nil {
+		if volume, ok := m.volumes.Get(guildID); ok {
+			return volume, true
+		}
+	}
+	return m.defaults.Volume, false
+}
+
+// SetGuildDefaultVolume stores the volume a guild's player starts at; a negative volume
+// goes back to the configured default
+func (m *Manager) SetGuildDefaultVolume(guildID string, volume int) error {
+	if volume > 100 {
+		return fmt.Errorf("volume must be between 0 and 100")
+	}
+
+	m.mu.RLock()
+	volumes := m.volumes
+	m.mu.RUnlock()
+	if volumes == nil {
+		return fmt.Errorf("per-server default volumes aren't available")
+	}
+
+	if volume < 0 {
+		return volumes.Clear(guildID)
+	}
+	return volumes.Set(guildID, volume)
+}
+
+// SetFilterStore sets where guilds' custom filter chains are kept; a guild's player starts
+// with its chain
+func (m *Manager) SetFilterStore(filters *store.Store[string]) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.filters = filters
+}
+
+// SetGuildCustomFilter stores the custom filter chain a guild's player starts with, "" forgetting it
+// Without a filter store the chain only lasts until the bot restarts
+func (m *Manager) SetGuildCustomFilter(guildID, expression string) error {
+	m.mu.RLock()
+	filters := m.filters
+	m.mu.RUnlock()
+	if filters == nil {
+		return nil
+	}
+
+	if expression == "" {
+		if _, ok := filters.Get(guildID); !ok {
+			return nil
+		}
+		return filters.Clear(guildID)
 	}
+	return filters.Set(guildID, expression)
 }
 
 // GetPlayer gets or creates a player for a guild
@@ -65,18 +402,52 @@ func (m *Manager) GetPlayer(guildID string) *GuildPlayer {
 		return player
 	}
 
+	volume, _ := m.defaultVolume(guildID)
+	filter := NoFilter
+	if m.filters != nil {
+		if expression, ok := m.filters.Get(guildID); ok {
+			filter = CustomFilter(expression)
+		}
+	}
+	queue := NewQueue()
+	queue.SetHistoryLimit(m.historyLimit)
 	player := &GuildPlayer{
 		GuildID:  guildID,
-		Queue:    NewQueue(),
-		Volume:   100,
-		stopChan: make(chan bool, 1),
-		doneChan: make(chan bool, 1),
+		Queue:    queue,
+		Volume:   volume,
+		Filter:   filter,
+		stopChan: make(chan PlaybackReason, 1),
+		doneChan: make(chan PlaybackResult, 1),
+		seekChan: make(chan time.Duration, 1),
+
+		AudioSettings:     m.audioSettings,
+		ReplayFromStartAt: m.replayFromStartAt,
+		StreamMode:        m.streamMode,
+		sponsorBlock:      m.sponsorBlock,
+		joinVoice:         m.joinVoice,
+		openDirect:        m.openDirect,
+
+		ReduceOnVoice:       m.defaults.ReduceOnVoice,
+		ReduceOnVoiceTarget: m.defaults.ReduceOnVoiceTarget,
 	}
+	player.volume.Store(int32(volume))
 
 	m.players[guildID] = player
 	return player
 }
 
+// Players returns every guild's player
+func (m *Manager) Players() []*GuildPlayer {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	players := make([]*GuildPlayer, 0, len(m.players))
+	for _, player := range m.players {
+		players = append(players, player)
+	}
+	return players
+}
+
 // RemovePlayer removes a player for a guild
 func (m *Manager) RemovePlayer(guildID string) {
 	m.mu.Lock()
@@ -103,6 +474,11 @@ func (p *GuildPlayer) Play() error {
 		return nil
 	}
 
+	// A connection that's still connecting is waited for by playTrack; only a dead one fails here
+	if voiceDead(p.VoiceConnection) {
+		return ErrVoiceNotReady
+	}
+
 	track := p.Queue.Current()
 	if track == nil {
 		track = p.Queue.Next()
@@ -113,6 +489,17 @@ func (p *GuildPlayer) Play() error {
 
 	p.Playing = true
 	p.Paused = false
+	p.CurrentPosition = 0
+	p.ABLoopActive = false
+	p.framesSent.Store(0)
+	p.lastSent.Store(0)
+	p.underruns.Store(0)
+
+	// Start from the requested timestamp on first play only, unless replays should honor it too
+	replay := p.markStarted(track)
+	if track.StartAt > 0 && (!replay || p.ReplayFromStartAt) {
+		p.CurrentPosition = track.StartAt
+	}
 
 	// Drain any stale completion signal
 	select {
@@ -126,20 +513,51 @@ func (p *GuildPlayer) Play() error {
 	default:
 	}
 
+	// Drain any seek request left over from the previous track
+	select {
+	case <-p.seekChan:
+	default:
+	}
+
 	// Start playback in goroutine
 	go p.playTrack(track)
 
 	return nil
 }
 
+// markStarted records that a queued track has started playing and reports whether it had
+// before; the caller must hold p.mu
+func (p *GuildPlayer) markStarted(track *Track) bool {
+	ctx := track.ctx
+	if ctx == nil {
+		return false
+	}
+	if p.started[ctx] {
+		return true
+	}
+	if p.started == nil {
+		p.started = make(map[context.Context]bool)
+	}
+	p.started[ctx] = true
+	context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.started, ctx)
+	})
+	return false
+}
+
 // playTrack handles the actual playback of a track
 func (p *GuildPlayer) playTrack(track *Track) {
 	logger.PlaybackStart(track.Title)
 
-	// Ensure completion is always signaled, regardless of exit path
+	// Ensure completion is always signaled with how playback ended, regardless of exit path
+	var result PlaybackResult
+	var position time.Duration
 	defer func() {
+		result.Position = position
 		select {
-		case p.doneChan <- true:
+		case p.doneChan <- result:
 		default:
 		}
 	}()
@@ -148,32 +566,38 @@ func (p *GuildPlayer) playTrack(track *Track) {
 	if p.VoiceConnection == nil {
 		logger.Error("No voice connection available")
 		p.mu.Unlock()
+		result = PlaybackResult{Reason: ReasonFailed, Err: ErrVoiceLost}
 		return
 	}
 	vc := p.VoiceConnection
+	position = p.CurrentPosition
+	filter := p.Filter
+	p.volume.Store(int32(trackVolume(p.Volume, track, p.volumeLimit())))
+	settings := p.encoderSettings()
+	streamMode := p.StreamMode
+	channelBitrate := p.ChannelBitrate
+	sponsorClient := p.sponsorBlock
+	var segments []sponsorblock.Segment
+	if track.ID != "" && p.sponsorVideo == track.ID {
+		segments = p.sponsorSegments
+	}
 	p.mu.Unlock()
 
-	// Create appropriate encoder based on whether we have a cached file
-	var encoder EncoderInterface
-	var err error
+	logger.PlaybackBitrate(settings.Bitrate, channelBitrate)
 
-	if track.LocalPath != "" {
-		// Use cached file
-		logger.Info("Using cached file", "path", track.LocalPath)
-		logger.PlaybackEncodingStart(track.LocalPath)
-		encoder, err = NewCustomEncoder(track.LocalPath, 48000, 2)
-	} else {
-		// Stream directly from URL
-		logger.Info("Streaming from URL", "url", track.URL)
-		logger.PlaybackEncodingStart(track.URL)
-		encoder, err = NewStreamingEncoder(track.URL, track.StreamURL, 48000, 2)
+	// Look up SponsorBlock segments alongside encoder startup; playback never waits on them
+	var segmentsChan <-chan []sponsorblock.Segment
+	if segments == nil {
+		segmentsChan = fetchSponsorSegments(sponsorClient, track)
 	}
 
+	encoder, err := p.startEncoder(track, settings, position, filter.Expression, streamMode)
 	if err != nil {
 		logger.PlaybackEncodingError(err)
 		p.mu.Lock()
 		p.Playing = false
 		p.mu.Unlock()
+		result = PlaybackResult{Reason: ReasonFailed, Err: fmt.Errorf("%w: %w", ErrEncoderStart, err)}
 		return
 	}
 	logger.PlaybackEncodingSuccess()
@@ -182,9 +606,112 @@ func (p *GuildPlayer) playTrack(track *Track) {
 	p.encoder = encoder
 	p.mu.Unlock()
 
-	// Wait for voice connection to be ready
+	// Frames are read ahead into a jitter buffer, so a slow read doesn't hold up the send clock
+	depth := jitterBufferDepth(settings)
+	buffer := newJitterBuffer(encoder, depth)
+	defer func() { buffer.close() }()
+	// primed is false until a new encoder's first frame arrives; waiting for it isn't an under-run
+	primed := false
+
+	// restartAt replaces the running encoder with one that starts at the given offset
+	restartAt := func(offset time.Duration) bool {
+		p.mu.RLock()
+		newFilter := p.Filter
+		newSettings := p.encoderSettings()
+		p.mu.RUnlock()
+
+		newEnc, err := p.startEncoder(track, newSettings, offset, newFilter.Expression, streamMode)
+		if err != nil {
+			logger.PlaybackEncodingError(err)
+			return false
+		}
+
+		p.mu.Lock()
+		if p.encoder != encoder {
+			// Playback was stopped while the new encoder was starting
+			p.mu.Unlock()
+			newEnc.Cleanup()
+			return false
+		}
+		p.encoder = newEnc
+		p.CurrentPosition = offset
+		p.mu.Unlock()
+
+		buffer.close()
+		encoder.Cleanup()
+		encoder = newEnc
+		buffer = newJitterBuffer(encoder, depth)
+		primed = false
+		filter = newFilter
+		settings = newSettings
+		position = offset
+		return true
+	}
+
+	// refreshLive replaces a live encoder whose stream stopped with one on a freshly
+	// extracted manifest, since live manifests expire; it returns false once the stream has ended
+	refreshLive := func() bool {
+		fresh := *track
+		fresh.StreamURL = ""
+		newEnc, err := p.startEncoder(&fresh, settings, 0, filter.Expression, streamMode)
+		if errors.Is(err, tools.ErrLiveEnded) {
+			logger.Info("Livestream ended", "title", track.Title)
+			return false
+		}
+		if err != nil {
+			logger.Warn("Failed to refresh livestream", "title", track.Title, "err", err)
+			return false
+		}
+
+		p.mu.Lock()
+		if p.encoder != encoder {
+			p.mu.Unlock()
+			newEnc.Cleanup()
+			return false
+		}
+		p.encoder = newEnc
+		p.mu.Unlock()
+
+		buffer.close()
+		encoder.Cleanup()
+		encoder = newEnc
+		buffer = newJitterBuffer(encoder, depth)
+		primed = false
+		return true
+	}
+
+	var skipped, discardUntil time.Duration
+	defer func() {
+		if skipped > 0 {
+			logger.SponsorBlockSummary(track.Title, skipped)
+		}
+		if underruns := p.underruns.Load(); underruns > 0 {
+			logger.Warn("Jitter buffer under-ran", "title", track.Title, "slots", underruns)
+		}
+	}()
+
+	// Wait until the voice connection can carry audio; right after a join it may still be connecting
 	logger.PlaybackVoiceWaiting()
-	time.Sleep(200 * time.Millisecond) // Give voice connection time to stabilize (reduced from 500ms)
+	waitStart := time.Now()
+	poll := time.NewTicker(voiceReadyPoll)
+	deadline := time.After(voiceReadyTimeout)
+	for !voiceReady(vc) {
+		select {
+		case result.Reason = <-p.stopChan:
+			poll.Stop()
+			logger.PlaybackStopped(0)
+			return
+		case <-deadline:
+			poll.Stop()
+			logger.Error("Voice connection never became ready", "title", track.Title, "waited", voiceReadyTimeout)
+			p.finishPlayback()
+			result = PlaybackResult{Reason: ReasonFailed, Err: ErrVoiceNeverReady}
+			return
+		case <-poll.C:
+		}
+	}
+	poll.Stop()
+	logger.PlaybackVoiceReady(time.Since(waitStart))
 
 	// Set speaking state BEFORE streaming
 	logger.PlaybackSpeakingStart()
@@ -194,19 +721,53 @@ func (p *GuildPlayer) playTrack(track *Track) {
 
 	// Manual frame sending
 	logger.PlaybackFrameStart()
+	p.mu.Lock()
+	p.sendingTrack = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.sendingTrack = false
+		p.dropClip()
+		p.mu.Unlock()
+	}()
+
+	// Frames go out on a steady clock rather than as fast as the voice connection takes them,
+	// so a hiccup isn't followed by a burst
+	clock := p.startClock(settings.FrameDuration)
+	defer clock.Stop()
+	clockRunning := true
 
 	frameCount := 0
+	liveRefreshes := 0
+	downloadFallback := false
 	for {
-		// Check for pause
-		p.mu.RLock()
+		// Check for pause and sound effects
+		p.mu.Lock()
 		paused := p.Paused
-		p.mu.RUnlock()
+		pending := p.pendingClip
+		p.pendingClip = nil
+		p.mu.Unlock()
+
+		// A sound effect takes the send slots; the track carries on where it was after it
+		if pending != nil {
+			if reason, stopped := sendClip(vc, pending, settings.FrameDuration, p.stopChan, nil); stopped {
+				result.Reason = reason
+				logger.PlaybackStopped(frameCount)
+				vc.Speaking(false)
+				return
+			}
+		}
 
 		if paused {
+			// The clock stops while paused; buffered frames wait for it to start again
+			if clockRunning {
+				clock.Stop()
+				clockRunning = false
+			}
 			time.Sleep(100 * time.Millisecond)
 			// Check for stop during pause
 			select {
-			case <-p.stopChan:
+			case result.Reason = <-p.stopChan:
 				logger.PlaybackStopped(frameCount)
 				vc.Speaking(false)
 				return
@@ -214,6 +775,10 @@ func (p *GuildPlayer) playTrack(track *Track) {
 			}
 			continue
 		}
+		if !clockRunning {
+			clock.Reset(settings.FrameDuration)
+			clockRunning = true
+		}
 
 		// Check voice connection periodically (every 100 frames ≈ 2 seconds)
 		if frameCount > 0 && frameCount%100 == 0 {
@@ -222,83 +787,406 @@ func (p *GuildPlayer) playTrack(track *Track) {
 			p.mu.RUnlock()
 			if !vcValid {
 				logger.Error("Voice connection lost during playback")
+				p.finishPlayback()
+				result = PlaybackResult{Reason: ReasonFailed, Err: ErrVoiceLost}
 				return
 			}
 		}
 
 		// Check for stop signal
 		select {
-		case <-p.stopChan:
+		case result.Reason = <-p.stopChan:
 			logger.PlaybackStopped(frameCount)
 			vc.Speaking(false)
 			return
 		default:
 		}
 
-		// Read opus frame
-		frame, err := encoder.OpusFrame()
+		// Check for seek requests
+		select {
+		case offset := <-p.seekChan:
+			discardUntil = 0
+			restartAt(offset)
+		default:
+		}
+
+		// Jump back to A once the playhead reaches B, dropping the loop if that fails so the
+		// restart isn't retried on every frame
+		if abStart, abEnd, abActive := p.ABLoop(); abActive && position >= abEnd {
+			discardUntil = 0
+			if !restartAt(abStart) {
+				logger.Warn("A-B loop cleared, couldn't jump back to its start", "title", track.Title, "start", abStart)
+				p.ClearABLoop()
+			}
+		}
+
+		// Pick up SponsorBlock segments once the lookup finishes
+		if segmentsChan != nil {
+			select {
+			case segments = <-segmentsChan:
+				p.mu.Lock()
+				p.sponsorVideo, p.sponsorSegments = track.ID, segments
+				p.mu.Unlock()
+				segmentsChan = nil
+			default:
+			}
+		}
+
+		// Jump past the segment the playhead just entered
+		if position >= discardUntil {
+			if seg, ok := sponsorblock.SegmentAt(segments, position); ok {
+				logger.SponsorBlockSkipping(seg.Category, position, seg.End)
+				skipped += seg.End - position
+				if seg.End-position <= sponsorDiscardThreshold || !restartAt(seg.End) {
+					discardUntil = seg.End
+				}
+			}
+		}
+
+		// Take the next frame; once it is flowing, a send slot passing first is an under-run
+		var next bufferedFrame
+		if primed {
+			select {
+			case next = <-buffer.frames:
+			case <-clock.C():
+				p.underruns.Add(1)
+				if settings.FrameDuration == opusSilenceDuration {
+					select {
+					case vc.OpusSend <- opusSilence:
+					default:
+					}
+				}
+				continue
+			case result.Reason = <-p.stopChan:
+				logger.PlaybackStopped(frameCount)
+				vc.Speaking(false)
+				return
+			}
+		} else {
+			select {
+			case next = <-buffer.frames:
+			case result.Reason = <-p.stopChan:
+				logger.PlaybackStopped(frameCount)
+				vc.Speaking(false)
+				return
+			}
+		}
+		frame, err := next.data, next.err
+		if err != nil && track.IsLive && !errors.Is(err, ErrNoData) && liveRefreshes < maxLiveRefreshes && p.isCurrentEncoder(encoder) {
+			logger.Warn("Livestream stopped, fetching a fresh manifest", "title", track.Title, "err", err)
+			liveRefreshes++
+			if refreshLive() {
+				continue
+			}
+		}
+		if err != nil && track.LocalPath == "" && track.Download != nil && track.Download.Failed() && !downloadFallback && p.endedEarly(track, encoder, position) {
+			// The download stalled or failed under the encoder; stream the rest instead
+			logger.Warn("Download fell behind playback, streaming the rest", "title", track.Title, "position", position)
+			downloadFallback = true
+			if restartAt(position) {
+				continue
+			}
+		}
 		if err != nil {
+			// Stop cleans up the encoder after signaling, so its reason explains the error
+			select {
+			case result.Reason = <-p.stopChan:
+				logger.PlaybackStopped(frameCount)
+				vc.Speaking(false)
+				return
+			default:
+			}
 			if err != io.EOF {
 				logger.PlaybackFrameError(err)
 			} else {
 				logger.PlaybackFramesComplete(frameCount)
 			}
+			if errors.Is(err, ErrNoData) {
+				result = PlaybackResult{Reason: ReasonFailed, Err: encoderError(err, encoder)}
+			} else if p.endedEarly(track, encoder, position) {
+				logger.PlaybackEndedEarly(track.Title, position, track.Duration, lastLines(encoder.Messages(), 5))
+				// A stream that simply ran out counts as finished; an encoder error cut it short
+				if err != io.EOF {
+					result = PlaybackResult{Reason: ReasonFailed, Err: encoderError(err, encoder)}
+				}
+			}
 			break
 		}
+		primed = true
+
+		// Drop frames inside a short skipped segment
+		if position < discardUntil {
+			position += filter.frameAdvance(settings.FrameDuration)
+			continue
+		}
+
+		// Wait for the frame's slot on the clock
+		select {
+		case <-clock.C():
+		case result.Reason = <-p.stopChan:
+			logger.PlaybackStopped(frameCount)
+			vc.Speaking(false)
+			return
+		}
 
 		// Send frame to voice connection with timeout protection
 		select {
 		case vc.OpusSend <- frame:
 			frameCount++
+			liveRefreshes = 0
+			p.framesSent.Add(1)
+			p.lastSent.Store(time.Now().UnixNano())
 			if frameCount%1000 == 0 {
 				logger.PlaybackFramesMilestone(frameCount)
 			}
 		case <-time.After(5 * time.Second):
 			logger.Error("Timeout sending opus frame, voice connection may be dead")
+			p.finishPlayback()
+			result = PlaybackResult{Reason: ReasonFailed, Err: ErrVoiceLost}
 			return
-		case <-p.stopChan:
+		case result.Reason = <-p.stopChan:
 			logger.PlaybackStopped(frameCount)
 			vc.Speaking(false)
 			return
 		}
+
+		// Positions are in source time, so tempo filters advance faster or slower than real time
+		position += filter.frameAdvance(settings.FrameDuration)
+		p.mu.Lock()
+		p.CurrentPosition = position
+		p.mu.Unlock()
 	}
 
 	// Clear speaking state
 	logger.PlaybackSpeakingStop()
 	vc.Speaking(false)
 
-	// Cleanup
+	p.finishPlayback()
+}
+
+// finishPlayback cleans up the encoder and marks the player as no longer playing
+func (p *GuildPlayer) finishPlayback() {
 	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	if p.encoder != nil {
 		p.encoder.Cleanup()
 		p.encoder = nil
 	}
 	p.Playing = false
-	p.mu.Unlock()
 }
 
-// WaitForCompletion waits for the current track to finish
-func (p *GuildPlayer) WaitForCompletion() {
-	select {
-	case <-p.doneChan:
-	case <-time.After(3 * time.Hour): // Max track length safety
-		logger.Info("Track completion timeout reached, continuing")
-	}
+// isCurrentEncoder reports whether encoder is still the one playing, rather than one
+// replaced or cleaned up by Stop
+func (p *GuildPlayer) isCurrentEncoder(encoder EncoderInterface) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.encoder == encoder
 }
 
-// Pause pauses playback
-func (p *GuildPlayer) Pause() {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+// encoderErrorLines is how many of the last lines of FFmpeg's stderr a playback failure reports
+const encoderErrorLines = 3
 
-	p.Paused = true
-	p.Playing = false
+// encoderError adds the last lines the encoder's process wrote to stderr to err, so the reason
+// a track failed reaches the channel and not just the log
+func encoderError(err error, encoder EncoderInterface) error {
+	if msg := lastLines(encoder.Messages(), encoderErrorLines); msg != "" {
+		return fmt.Errorf("%w: %s", err, strings.ReplaceAll(msg, "\n", "; "))
+	}
+	return err
 }
 
-// Resume resumes playback
-func (p *GuildPlayer) Resume() {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+// endedEarly reports whether the encoder's stream ran out well before the end of the track
+// An encoder replaced or cleaned up by Stop doesn't count
+func (p *GuildPlayer) endedEarly(track *Track, encoder EncoderInterface, position time.Duration) bool {
+	return p.isCurrentEncoder(encoder) && !track.IsLive && track.Duration > 0 && track.Duration-position > earlyEndTolerance
+}
+
+// AudioStats returns the current encoder's counters and the frames sent to Discord
+func (p *GuildPlayer) AudioStats() AudioStats {
+	p.mu.RLock()
+	encoder := p.encoder
+	p.mu.RUnlock()
+
+	stats := AudioStats{FramesSent: p.framesSent.Load(), Underruns: p.underruns.Load()}
+	if encoder != nil {
+		stats.Encoder = encoder.Stats()
+		stats.HasEncoder = true
+	}
+	if last := p.lastSent.Load(); last != 0 {
+		stats.SinceLastSend = time.Since(time.Unix(0, last))
+	}
+	return stats
+}
+
+// GetEncoderSettings safely gets the audio settings with per-guild overrides applied
+func (p *GuildPlayer) GetEncoderSettings() AudioSettings {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.encoderSettings()
+}
+
+// encoderSettings returns the audio settings with per-guild overrides applied; the caller must hold p.mu
+// The bitrate follows the voice channel when known, never exceeding the channel or configured maximum
+func (p *GuildPlayer) encoderSettings() AudioSettings {
+	settings := p.AudioSettings
+	if p.ChannelBitrate > 0 {
+		settings.Bitrate = p.ChannelBitrate
+	}
+	if p.BitrateOverride > 0 {
+		settings.Bitrate = p.BitrateOverride
+	}
+	if p.ChannelBitrate > 0 && settings.Bitrate > p.ChannelBitrate {
+		settings.Bitrate = p.ChannelBitrate
+	}
+	if settings.MaxBitrate > 0 && settings.Bitrate > settings.MaxBitrate {
+		settings.Bitrate = settings.MaxBitrate
+	}
+	if loss, ok := RobustnessLevels[p.Robustness]; ok {
+		settings.FEC = true
+		settings.PacketLoss = loss
+	}
+	settings.Volume = &p.volume
+	return settings
+}
+
+// unityVolume reports whether settings leave the decoded audio's volume as it is
+func unityVolume(settings AudioSettings) bool {
+	return settings.Volume == nil || settings.Volume.Load() == MaxVolume
+}
+
+// startClock starts the send clock with newClock, or a ticker if it isn't set
+func (p *GuildPlayer) startClock(frame time.Duration) sendClock {
+	if p.newClock != nil {
+		return p.newClock(frame)
+	}
+	return tickerClock{ticker: time.NewTicker(frame)}
+}
+
+// startEncoder creates the encoder for a track with openEncoder, or newEncoder if it isn't set
+func (p *GuildPlayer) startEncoder(track *Track, settings AudioSettings, startAt time.Duration, filter string, mode StreamMode) (EncoderInterface, error) {
+	if p.openEncoder != nil {
+		return p.openEncoder(track, settings, startAt, filter, mode)
+	}
+	return newEncoder(track, settings, startAt, filter, mode, p.openDirect)
+}
+
+// newEncoder creates the appropriate encoder for a track, starting at the given offset
+// Direct links are fetched with openDirect
+func newEncoder(track *Track, settings AudioSettings, startAt time.Duration, filter string, mode StreamMode, openDirect DirectOpener) (EncoderInterface, error) {
+	if track.LocalPath != "" {
+		// Use cached file
+		logger.Info("Using cached file", "path", track.LocalPath)
+
+		// Pre-encoded and cached Opus frames can be sent as-is unless a filter or the volume
+		// needs the decoded audio
+		asIs := filter == "" && unityVolume(settings)
+		if asIs && track.EncodedPath != "" {
+			encoder, err := OpenDCA(track.EncodedPath, settings, startAt)
+			if err == nil {
+				logger.Info("Using pre-encoded frames", "path", track.EncodedPath)
+				return encoder, nil
+			}
+			logger.Warn("Failed to open pre-encoded frames", "path", track.EncodedPath, "err", err)
+		}
+
+		if asIs {
+			// The source's packets keep their bitrate, so it must not exceed the guild's
+			err := checkPassthroughBitrate(track.LocalPath, track.Duration, settings.Bitrate)
+			if err == nil {
+				var encoder *PassthroughEncoder
+				if encoder, err = NewPassthroughEncoder(track.LocalPath, settings, startAt); err == nil {
+					return encoder, nil
+				}
+			}
+			logger.Debug("Passthrough unavailable, transcoding", "path", track.LocalPath, "reason", err)
+		}
+
+		logger.PlaybackEncodingStart(track.LocalPath)
+		encoder, err := NewCustomEncoder(track.LocalPath, settings, startAt, filter)
+		if err != nil {
+			return nil, err
+		}
+		return encoder, nil
+	}
+
+	// Play from the cache download while it is written, rather than fetching the audio again
+	if followingDownload(track) {
+		encoder, err := newDownloadEncoder(track.Download, settings, startAt, filter)
+		if err == nil {
+			logger.Info("Playing from the download in progress", "title", track.Title)
+			return encoder, nil
+		}
+		logger.Info("Streaming instead of playing from the download", "title", track.Title, "reason", err)
+	}
+
+	// Direct links are fetched by the bot and piped in, never by FFmpeg, which would skip
+	// the address checks
+	if track.Source == SourceDirect {
+		logger.Info("Streaming direct link", "url", track.URL)
+		logger.PlaybackEncodingStart(track.URL)
+		encoder, err := newDirectEncoder(openDirect, track, settings, startAt, filter)
+		if err != nil {
+			return nil, err
+		}
+		return encoder, nil
+	}
+
+	// Stream directly from URL
+	logger.Info("Streaming from URL", "url", track.URL)
+	logger.PlaybackEncodingStart(track.URL)
+	encoder, err := NewStreamingEncoder(track.URL, track.StreamURL, track.StreamProxy, track.IsLive, settings, startAt, filter, mode)
+	if err != nil {
+		return nil, err
+	}
+	return encoder, nil
+}
+
+// fetchSponsorSegments starts a background SponsorBlock lookup for a track
+// The returned channel delivers the segments if the lookup succeeds; nil means no lookup is needed
+func fetchSponsorSegments(client *sponsorblock.Client, track *Track) <-chan []sponsorblock.Segment {
+	if client == nil || track.Source != SourceYouTube || track.IsLive || track.ID == "" {
+		return nil
+	}
+
+	segmentsChan := make(chan []sponsorblock.Segment, 1)
+	go func(videoID string) {
+		segments, err := client.GetSegments(videoID)
+		if err != nil {
+			logger.Debug("SponsorBlock lookup failed", "id", videoID, "err", err)
+			return
+		}
+		logger.Debug("SponsorBlock segments fetched", "id", videoID, "count", len(segments))
+		segmentsChan <- segments
+	}(track.ID)
+
+	return segmentsChan
+}
+
+// WaitForCompletion waits for the current track to finish and returns how it ended
+func (p *GuildPlayer) WaitForCompletion() PlaybackResult {
+	select {
+	case result := <-p.doneChan:
+		return result
+	case <-time.After(3 * time.Hour): // Max track length safety
+		logger.Info("Track completion timeout reached, continuing")
+		return PlaybackResult{Reason: ReasonFinished, Position: p.Position()}
+	}
+}
+
+// Pause pauses playback
+func (p *GuildPlayer) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Paused = true
+	p.Playing = false
+}
+
+// Resume resumes playback
+func (p *GuildPlayer) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
 	if p.Paused {
 		p.Paused = false
@@ -308,6 +1196,11 @@ func (p *GuildPlayer) Resume() {
 
 // Stop stops playback completely
 func (p *GuildPlayer) Stop() {
+	p.stop(ReasonStopped)
+}
+
+// stop ends playback, telling the playback goroutine why
+func (p *GuildPlayer) stop(reason PlaybackReason) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -317,7 +1210,7 @@ func (p *GuildPlayer) Stop() {
 
 	// Stop streaming
 	select {
-	case p.stopChan <- true:
+	case p.stopChan <- reason:
 	default:
 	}
 
@@ -330,7 +1223,8 @@ func (p *GuildPlayer) Stop() {
 
 // Skip skips to the next track
 func (p *GuildPlayer) Skip() *Track {
-	p.Stop()
+	p.ClearABLoop()
+	p.stop(ReasonSkipped)
 
 	// Return what will play next (peek without advancing)
 	// Note: The playLoop will handle actually advancing the queue
@@ -338,10 +1232,8 @@ func (p *GuildPlayer) Skip() *Track {
 }
 
 // Seek seeks to a position in the current track
+// The running playback loop restarts its encoder at the new offset
 func (p *GuildPlayer) Seek(position time.Duration) error {
-	// Stop current playback first to prevent duplicate streams
-	p.Stop()
-
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -350,30 +1242,324 @@ func (p *GuildPlayer) Seek(position time.Duration) error {
 		return fmt.Errorf("no track currently playing")
 	}
 
-	if position < 0 || (!track.IsLive && position > track.Duration) {
+	if track.IsLive {
+		return fmt.Errorf("seeking is not supported for live streams")
+	}
+
+	if position < 0 || position > track.Duration {
 		return fmt.Errorf("invalid seek position")
 	}
 
+	if p.encoder == nil {
+		return fmt.Errorf("no track currently playing")
+	}
+
+	// An explicit seek ends any active A-B loop
+	p.ABLoopActive = false
+	p.requestSeek(position)
+
+	return nil
+}
+
+// requestSeek queues a seek for the playback loop; the caller must hold p.mu
+func (p *GuildPlayer) requestSeek(position time.Duration) {
+	// Replace any pending seek so only the latest position is applied
+	select {
+	case <-p.seekChan:
+	default:
+	}
+	p.seekChan <- position
 	p.CurrentPosition = position
+}
 
-	// Restart playback from new position
-	p.Playing = true
-	p.Paused = false
-	go p.playTrack(track)
+// SetABLoop loops the section between start and end of the current track
+func (p *GuildPlayer) SetABLoop(start, end time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	track := p.Queue.Current()
+	if track == nil || p.encoder == nil {
+		return fmt.Errorf("no track currently playing")
+	}
+
+	if track.IsLive {
+		return fmt.Errorf("A-B looping is not supported for live streams")
+	}
+
+	// The end must fall within the track when its length is known
+	if start < 0 || end <= start || (track.Duration > 0 && end > track.Duration) {
+		return fmt.Errorf("invalid loop section")
+	}
+
+	if end-start < time.Second {
+		return fmt.Errorf("loop section must be at least 1 second long")
+	}
+
+	p.ABLoopActive = true
+	p.ABLoopStart = start
+	p.ABLoopEnd = end
+
+	// Move into the section right away if the playhead is outside it
+	if p.CurrentPosition < start || p.CurrentPosition >= end {
+		p.requestSeek(start)
+	}
 
 	return nil
 }
 
-// SetVolume sets the playback volume (0-100)
+// ClearABLoop disables A-B looping
+func (p *GuildPlayer) ClearABLoop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ABLoopActive = false
+}
+
+// ABLoop safely returns the A-B loop section and whether it is active
+func (p *GuildPlayer) ABLoop() (time.Duration, time.Duration, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.ABLoopStart, p.ABLoopEnd, p.ABLoopActive
+}
+
+// SetFilter sets the audio filter, restarting the encoder at the current position if playing
+func (p *GuildPlayer) SetFilter(filter AudioFilter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Filter = filter
+	if p.encoder != nil {
+		p.requestSeek(p.CurrentPosition)
+	}
+}
+
+// SetBitrateOverride sets a per-guild bitrate in bits per second (0 restores the default),
+// restarting the encoder at the current position if playing
+func (p *GuildPlayer) SetBitrateOverride(bitrate int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if bitrate != 0 && (bitrate < MinBitrate || bitrate > MaxBitrate) {
+		return fmt.Errorf("bitrate must be between %d and %d kbps", MinBitrate/1000, MaxBitrate/1000)
+	}
+
+	p.BitrateOverride = bitrate
+	if p.encoder != nil {
+		p.requestSeek(p.CurrentPosition)
+	}
+	return nil
+}
+
+// SetRobustness sets the per-guild audio robustness level ("" restores the default),
+// restarting the encoder at the current position if playing
+func (p *GuildPlayer) SetRobustness(level string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := RobustnessLevels[level]; level != "" && !ok {
+		return fmt.Errorf("unknown robustness level: %s", level)
+	}
+
+	p.Robustness = level
+	if p.encoder != nil {
+		p.requestSeek(p.CurrentPosition)
+	}
+	return nil
+}
+
+// SetChannelBitrate records the voice channel's bitrate, restarting the encoder if it changed mid-track
+func (p *GuildPlayer) SetChannelBitrate(bitrate int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ChannelBitrate == bitrate {
+		return
+	}
+
+	p.ChannelBitrate = bitrate
+	if p.encoder != nil {
+		p.requestSeek(p.CurrentPosition)
+	}
+}
+
+// GetFilter safely gets the active audio filter
+func (p *GuildPlayer) GetFilter() AudioFilter {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.Filter
+}
+
+// SetPlaybackMode sets how tracks that aren't cached yet play ("" restores PLAYBACK_MODE)
+func (p *GuildPlayer) SetPlaybackMode(mode string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.playbackMode = mode
+}
+
+// GetPlaybackMode safely gets the playback mode override, "" if there is none
+func (p *GuildPlayer) GetPlaybackMode() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.playbackMode
+}
+
+// SetFollowRequester sets whether the bot follows the current track's requester between voice channels
+func (p *GuildPlayer) SetFollowRequester(follow bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.followRequester = follow
+}
+
+// FollowsRequester safely reports whether the bot follows the current track's requester
+func (p *GuildPlayer) FollowsRequester() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.followRequester
+}
+
+// SetMaxTrackDuration sets the longest track the guild may queue (NoTrackLimit for none, 0
+// restores MAX_TRACK_DURATION)
+func (p *GuildPlayer) SetMaxTrackDuration(limit time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maxTrackDuration = limit
+}
+
+// GetMaxTrackDuration safely gets the track length limit override, 0 if there is none
+func (p *GuildPlayer) GetMaxTrackDuration() time.Duration {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.maxTrackDuration
+}
+
+// SetSpotifyMarket sets the country Spotify lookups use ("" restores SPOTIFY_MARKET)
+func (p *GuildPlayer) SetSpotifyMarket(market string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.spotifyMarket = market
+}
+
+// GetSpotifyMarket safely gets the Spotify market override, "" if there is none
+func (p *GuildPlayer) GetSpotifyMarket() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.spotifyMarket
+}
+
+// SetSearchProvider sets where searches look ("" restores SEARCH_PROVIDER)
+func (p *GuildPlayer) SetSearchProvider(provider string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.searchProvider = provider
+}
+
+// GetSearchProvider safely gets the search provider override, "" if there is none
+func (p *GuildPlayer) GetSearchProvider() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.searchProvider
+}
+
+// SetFairQueue sets whether requesters take turns after every bulk add
+func (p *GuildPlayer) SetFairQueue(fair bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fairQueue = fair
+}
+
+// IsFairQueue safely reports whether requesters take turns after every bulk add
+func (p *GuildPlayer) IsFairQueue() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.fairQueue
+}
+
+// IsPlaying safely reports whether a track is playing
+func (p *GuildPlayer) IsPlaying() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.Playing
+}
+
+// GetVolume safely gets the playback volume
+func (p *GuildPlayer) GetVolume() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.Volume
+}
+
+// SetVolume sets the playback volume, from 0 to VolumeLimit
 func (p *GuildPlayer) SetVolume(volume int) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if volume < 0 || volume > 100 {
-		return fmt.Errorf("volume must be between 0 and 100")
+	if limit := p.volumeLimit(); volume < 0 || volume > limit {
+		return fmt.Errorf("volume must be between 0 and %d", limit)
 	}
 
+	p.setVolume(volume)
+	return nil
+}
+
+// VolumeLimit is the highest volume that can be set, above MaxVolume only if boosting is allowed
+func (p *GuildPlayer) VolumeLimit() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.volumeLimit()
+}
+
+// volumeLimit is VolumeLimit without locking; the caller must hold p.mu
+func (p *GuildPlayer) volumeLimit() int {
+	if p.AllowBoost {
+		return MaxBoostedVolume
+	}
+	return MaxVolume
+}
+
+// SetAllowBoost allows or forbids volumes above MaxVolume, bringing a boosted volume, or a
+// track boosted by its offset, back down when forbidding them
+func (p *GuildPlayer) SetAllowBoost(allow bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.AllowBoost = allow
+	if !allow {
+		p.OriginalVolume = min(p.OriginalVolume, MaxVolume)
+		p.setVolume(min(p.Volume, MaxVolume))
+	}
+}
+
+// setVolume sets the guild's volume and applies it; the caller must hold p.mu
+func (p *GuildPlayer) setVolume(volume int) {
 	p.Volume = volume
+	p.applyVolume()
+}
+
+// applyVolume updates the volume encoders scale by from the guild's volume and the current
+// track's offset; the caller must hold p.mu
+// Frames sent as-is can't be scaled, so a track playing that way is restarted decoded
+func (p *GuildPlayer) applyVolume() {
+	volume := trackVolume(p.Volume, p.Queue.Current(), p.volumeLimit())
+	p.volume.Store(int32(volume))
+	if _, decoded := p.encoder.(*Encoder); p.encoder != nil && !decoded && volume != MaxVolume {
+		p.requestSeek(p.CurrentPosition)
+	}
+}
+
+// SetTrackVolume sets the current track's volume offset in percent and applies it
+func (p *GuildPlayer) SetTrackVolume(offset int) error {
+	if offset < MinTrackVolume-100 || offset > MaxTrackVolume-100 {
+		return fmt.Errorf("track volume must be between %d%% and %d%%", MinTrackVolume, MaxTrackVolume)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	track := p.Queue.Current()
+	if track == nil {
+		return fmt.Errorf("nothing is playing")
+	}
+	p.Queue.UpdateCurrent(track, func(t *Track) { t.VolumeOffset = offset })
+	p.applyVolume()
 	return nil
 }
 
@@ -387,7 +1573,7 @@ func (p *GuildPlayer) ReduceVolume() {
 	}
 
 	p.OriginalVolume = p.Volume
-	p.Volume = p.ReduceOnVoiceTarget
+	p.setVolume(p.ReduceOnVoiceTarget)
 }
 
 // RestoreVolume restores volume after speaking ends
@@ -399,7 +1585,7 @@ func (p *GuildPlayer) RestoreVolume() {
 		return
 	}
 
-	p.Volume = p.OriginalVolume
+	p.setVolume(p.OriginalVolume)
 }
 
 // Disconnect disconnects from voice channel
@@ -418,6 +1604,13 @@ func (p *GuildPlayer) Disconnect() error {
 	return nil
 }
 
+// Position safely gets the current playback position
+func (p *GuildPlayer) Position() time.Duration {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.CurrentPosition
+}
+
 // IsLoopRunning safely checks if the playback loop is running
 func (p *GuildPlayer) IsLoopRunning() bool {
 	p.mu.RLock()
@@ -432,6 +1625,129 @@ func (p *GuildPlayer) SetLoopRunning(running bool) {
 	p.LoopRunning = running
 }
 
+// EnsureLoop starts the playback loop with start unless it is already running; the check
+// and the LoopRunning flip happen under one lock, so only one caller ever starts it
+func (p *GuildPlayer) EnsureLoop(start func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.LoopRunning {
+		return false
+	}
+	p.LoopRunning = true
+	go start()
+	return true
+}
+
+// EnsureVoice joins a voice channel unless the player is already connected, reporting
+// whether it joined; concurrent callers wait for the first join and reuse it
+func (p *GuildPlayer) EnsureVoice(channelID string) (bool, error) {
+	p.joinMu.Lock()
+	defer p.joinMu.Unlock()
+
+	if p.IsVoiceConnected() {
+		return false, nil
+	}
+	if err := p.join(channelID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// VoiceReady reports whether the voice connection is ready to carry audio
+func (p *GuildPlayer) VoiceReady() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return voiceReady(p.VoiceConnection)
+}
+
+// Rejoin replaces a dead voice connection by joining the last voice channel again
+func (p *GuildPlayer) Rejoin() error {
+	p.joinMu.Lock()
+	defer p.joinMu.Unlock()
+
+	p.mu.RLock()
+	channelID := p.VoiceChannelID
+	p.mu.RUnlock()
+	if channelID == "" {
+		return fmt.Errorf("no voice channel to rejoin")
+	}
+	return p.join(channelID)
+}
+
+// join connects to a voice channel with joinVoice; the caller must hold p.joinMu
+func (p *GuildPlayer) join(channelID string) error {
+	if p.joinVoice == nil {
+		return fmt.Errorf("joining voice channels is not set up")
+	}
+	vc, err := p.joinVoice(p.GuildID, channelID)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.VoiceConnection = vc
+	p.VoiceChannelID = channelID
+	return nil
+}
+
+// MoveTo joins another voice channel in the guild, taking the voice connection with it
+func (p *GuildPlayer) MoveTo(channelID string) error {
+	p.joinMu.Lock()
+	defer p.joinMu.Unlock()
+	return p.join(channelID)
+}
+
+// GetVoiceChannelID safely gets the voice channel last joined
+func (p *GuildPlayer) GetVoiceChannelID() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.VoiceChannelID
+}
+
+// GetTextChannelID safely gets the text channel playback was started from
+func (p *GuildPlayer) GetTextChannelID() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.TextChannelID
+}
+
+// SetTextChannelID records the text channel playback was started from
+func (p *GuildPlayer) SetTextChannelID(channelID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.TextChannelID = channelID
+}
+
+// SetVoiceChannelID records the voice channel the bot is in, as when it is moved
+func (p *GuildPlayer) SetVoiceChannelID(channelID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.VoiceChannelID = channelID
+}
+
+// voiceReady reports whether a voice connection has finished connecting, isn't dead and
+// can take audio frames
+func voiceReady(vc *discordgo.VoiceConnection) bool {
+	if vc == nil || vc.Cond == nil {
+		return false
+	}
+	vc.Cond.L.Lock()
+	defer vc.Cond.L.Unlock()
+	return vc.Status == discordgo.VoiceConnectionStatusReady && vc.OpusSend != nil
+}
+
+// voiceDead reports whether a voice connection has given up and will never become ready
+func voiceDead(vc *discordgo.VoiceConnection) bool {
+	if vc == nil || vc.Cond == nil {
+		return true
+	}
+	vc.Cond.L.Lock()
+	defer vc.Cond.L.Unlock()
+	return vc.Status == discordgo.VoiceConnectionStatusDead
+}
+
 // IsVoiceConnected safely checks if voice connection exists
 func (p *GuildPlayer) IsVoiceConnected() bool {
 	p.mu.RLock()
@@ -0,0 +1,439 @@
+package player
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeEncoder produces frames until it runs out, then returns err; once cleaned up it fails
+// like a real encoder whose process was killed
+type fakeEncoder struct {
+	frames   int // -1 for no end
+	err      error
+	messages string
+	read     atomic.Int64
+	cleaned  atomic.Bool
+}
+
+func (e *fakeEncoder) OpusFrame() ([]byte, error) {
+	if e.cleaned.Load() {
+		return nil, errors.New("encoder closed")
+	}
+	if e.frames >= 0 && e.read.Load() >= int64(e.frames) {
+		return nil, e.err
+	}
+	e.read.Add(1)
+	return []byte{0xf8, 0xff, 0xfe}, nil
+}
+
+func (e *fakeEncoder) Messages() string    { return e.messages }
+func (e *fakeEncoder) Stats() EncoderStats { return EncoderStats{} }
+func (e *fakeEncoder) Cleanup() error {
+	e.cleaned.Store(true)
+	return nil
+}
+
+// newTestPlayer returns a player with one queued track whose encoder is opened by open,
+// connected to a voice connection that accepts every frame
+func newTestPlayer(t *testing.T, open func() (EncoderInterface, error)) *GuildPlayer {
+	t.Helper()
+
+	vc := newTestVoiceConnection()
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		for {
+			select {
+			case <-vc.OpusSend:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	p := NewManager().GetPlayer("guild")
+	p.VoiceConnection = vc
+	p.openEncoder = func(*Track, AudioSettings, time.Duration, string, StreamMode) (EncoderInterface, error) {
+		return open()
+	}
+	p.Queue.Add(&Track{Title: "track"})
+	return p
+}
+
+// newTestVoiceConnection returns a ready voice connection with room for a few frames
+func newTestVoiceConnection() *discordgo.VoiceConnection {
+	return &discordgo.VoiceConnection{
+		Cond:     sync.NewCond(&sync.Mutex{}),
+		Status:   discordgo.VoiceConnectionStatusReady,
+		OpusSend: make(chan []byte, 10),
+	}
+}
+
+// waitForResult waits for the playing track to end
+func waitForResult(t *testing.T, p *GuildPlayer) PlaybackResult {
+	t.Helper()
+
+	results := make(chan PlaybackResult, 1)
+	go func() { results <- p.WaitForCompletion() }()
+	select {
+	case result := <-results:
+		return result
+	case <-time.After(5 * time.Second):
+		t.Fatal("playback didn't end")
+		return PlaybackResult{}
+	}
+}
+
+// waitForFrames waits until the player has sent a few frames
+func waitForFrames(t *testing.T, p *GuildPlayer) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for p.AudioStats().FramesSent < 5 {
+		if time.Now().After(deadline) {
+			t.Fatal("no frames were sent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPlaybackFinished(t *testing.T) {
+	p := newTestPlayer(t, func() (EncoderInterface, error) {
+		return &fakeEncoder{frames: 50, err: io.EOF}, nil
+	})
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+
+	result := waitForResult(t, p)
+	if result.Reason != ReasonFinished || result.Err != nil {
+		t.Errorf("result = %+v, want finished", result)
+	}
+	if want := 50 * 20 * time.Millisecond; result.Position != want {
+		t.Errorf("Position = %v, want %v", result.Position, want)
+	}
+}
+
+func TestPlaybackSkippedAndStopped(t *testing.T) {
+	tests := []struct {
+		name string
+		end  func(p *GuildPlayer)
+		want PlaybackReason
+	}{
+		{"skip", func(p *GuildPlayer) { p.Skip() }, ReasonSkipped},
+		{"stop", func(p *GuildPlayer) { p.Stop() }, ReasonStopped},
+		{"stop while paused", func(p *GuildPlayer) { p.Pause(); p.Stop() }, ReasonStopped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPlayer(t, func() (EncoderInterface, error) {
+				return &fakeEncoder{frames: -1}, nil
+			})
+			if err := p.Play(); err != nil {
+				t.Fatal(err)
+			}
+			waitForFrames(t, p)
+			tt.end(p)
+
+			result := waitForResult(t, p)
+			if result.Reason != tt.want || result.Err != nil {
+				t.Errorf("result = %+v, want %v", result, tt.want)
+			}
+			if result.Position <= 0 {
+				t.Errorf("Position = %v, want where playback was ended", result.Position)
+			}
+		})
+	}
+}
+
+func TestPlaybackFailed(t *testing.T) {
+	startErr := errors.New("ffmpeg not found")
+	tests := []struct {
+		name      string
+		open      func() (EncoderInterface, error)
+		wantErr   error
+		retryable bool
+	}{
+		{"encoder doesn't start", func() (EncoderInterface, error) { return nil, startErr }, ErrEncoderStart, true},
+		{"no audio", func() (EncoderInterface, error) { return &fakeEncoder{err: ErrNoData}, nil }, ErrNoData, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPlayer(t, tt.open)
+			if err := p.Play(); err != nil {
+				t.Fatal(err)
+			}
+
+			result := waitForResult(t, p)
+			if result.Reason != ReasonFailed || !errors.Is(result.Err, tt.wantErr) {
+				t.Errorf("result = %+v, want failed with %v", result, tt.wantErr)
+			}
+			if result.Retryable() != tt.retryable {
+				t.Errorf("Retryable() = %v, want %v", result.Retryable(), tt.retryable)
+			}
+		})
+	}
+}
+
+func TestPlaybackEncoderErrorCutsTrackShort(t *testing.T) {
+	encoderErr := errors.New("ffmpeg exited with status 1")
+	p := newTestPlayer(t, func() (EncoderInterface, error) {
+		return &fakeEncoder{frames: 10, err: encoderErr, messages: "Input #0, webm\n[opus @ 0x1] Error parsing Opus packet header\nError while decoding stream #0:0\n"}, nil
+	})
+	p.Queue.Peek().Duration = time.Minute
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+
+	result := waitForResult(t, p)
+	if result.Reason != ReasonFailed || !errors.Is(result.Err, encoderErr) || result.Retryable() {
+		t.Errorf("result = %+v, want a failure that isn't retried", result)
+	}
+	// The reason shown in the channel includes what FFmpeg said last
+	want := "ffmpeg exited with status 1: Input #0, webm; [opus @ 0x1] Error parsing Opus packet header; Error while decoding stream #0:0"
+	if result.Err == nil || result.Err.Error() != want {
+		t.Errorf("Err = %v, want %q", result.Err, want)
+	}
+}
+
+func TestPlaybackStartAtOnFirstPlayOnly(t *testing.T) {
+	p := newTestPlayer(t, func() (EncoderInterface, error) {
+		return &fakeEncoder{frames: 10, err: io.EOF}, nil
+	})
+	p.Queue.Peek().StartAt = time.Minute
+
+	// A loop replays the current track, which is copied as the queue updates it in between
+	for n, want := range []time.Duration{time.Minute + 200*time.Millisecond, 200 * time.Millisecond} {
+		if err := p.Play(); err != nil {
+			t.Fatal(err)
+		}
+		if result := waitForResult(t, p); result.Position != want {
+			t.Errorf("play %d ended at %v, want %v", n+1, result.Position, want)
+		}
+		p.Queue.UpdateCurrent(p.Queue.Current(), func(t *Track) { t.StreamURL = "" })
+	}
+}
+
+func TestABLoopClearedWhenRestartFails(t *testing.T) {
+	var opened atomic.Int32
+	p := newTestPlayer(t, func() (EncoderInterface, error) {
+		if opened.Add(1) > 1 {
+			return nil, errors.New("ffmpeg not found")
+		}
+		return &fakeEncoder{frames: -1}, nil
+	})
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+	waitForFrames(t, p)
+
+	// The track's length is unknown, which doesn't stop a loop being set
+	if err := p.SetABLoop(0, time.Second); err != nil {
+		t.Fatalf("SetABLoop() = %v, want a loop of a track of unknown length", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, _, active := p.ABLoop(); active; _, _, active = p.ABLoop() {
+		if time.Now().After(deadline) {
+			t.Fatal("the loop wasn't cleared after jumping back failed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := opened.Load(); n != 2 {
+		t.Errorf("encoder opened %d times, want one failed restart", n)
+	}
+	p.Stop()
+	waitForResult(t, p)
+}
+
+func TestConcurrentPlayJoinsAndStartsLoopOnce(t *testing.T) {
+	p := NewManager().GetPlayer("guild")
+
+	var joins, loops atomic.Int32
+	p.joinVoice = func(guildID, channelID string) (*discordgo.VoiceConnection, error) {
+		joins.Add(1)
+		time.Sleep(10 * time.Millisecond) // Joining takes a round trip to Discord
+		return newTestVoiceConnection(), nil
+	}
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.EnsureVoice("voice"); err != nil {
+				t.Error(err)
+				return
+			}
+			p.Queue.Add(&Track{Title: "track"})
+			p.EnsureLoop(func() { loops.Add(1) })
+		}()
+	}
+	wg.Wait()
+
+	// The loop goroutine may still be starting
+	deadline := time.Now().Add(time.Second)
+	for loops.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if joins.Load() != 1 || loops.Load() != 1 {
+		t.Errorf("%d joins and %d loops, want one of each", joins.Load(), loops.Load())
+	}
+	if p.Queue.Length() != 20 {
+		t.Errorf("Length() = %d, want 20", p.Queue.Length())
+	}
+}
+
+func TestRejoinReplacesDeadConnection(t *testing.T) {
+	p := newTestPlayer(t, func() (EncoderInterface, error) {
+		return &fakeEncoder{frames: 5, err: io.EOF}, nil
+	})
+	p.VoiceChannelID = "voice"
+	p.VoiceConnection.Status = discordgo.VoiceConnectionStatusDead
+
+	if err := p.Play(); !errors.Is(err, ErrVoiceNotReady) {
+		t.Fatalf("Play() on a dead connection = %v, want ErrVoiceNotReady", err)
+	}
+
+	fresh := newTestVoiceConnection()
+	go func() {
+		for range fresh.OpusSend {
+		}
+	}()
+	defer close(fresh.OpusSend)
+	var joinedChannel string
+	p.joinVoice = func(guildID, channelID string) (*discordgo.VoiceConnection, error) {
+		joinedChannel = channelID
+		return fresh, nil
+	}
+
+	if err := p.Rejoin(); err != nil {
+		t.Fatal(err)
+	}
+	if joinedChannel != "voice" || !p.VoiceReady() {
+		t.Fatalf("rejoined %q (ready %v), want the last voice channel", joinedChannel, p.VoiceReady())
+	}
+	if err := p.Play(); err != nil {
+		t.Fatalf("Play() after rejoining = %v", err)
+	}
+	if result := waitForResult(t, p); result.Reason != ReasonFinished {
+		t.Errorf("result = %+v, want finished", result)
+	}
+}
+
+func TestPlaybackWaitsForVoiceReady(t *testing.T) {
+	p := newTestPlayer(t, func() (EncoderInterface, error) {
+		return &fakeEncoder{frames: 5, err: io.EOF}, nil
+	})
+	vc := p.VoiceConnection
+	vc.Status = discordgo.VoiceConnectionStatusConnecting
+
+	// A connecting connection isn't refused; playback waits for it instead
+	if err := p.Play(); err != nil {
+		t.Fatalf("Play() while connecting = %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if p.AudioStats().FramesSent != 0 {
+		t.Fatal("frames were sent before the connection was ready")
+	}
+
+	vc.Cond.L.Lock()
+	vc.Status = discordgo.VoiceConnectionStatusReady
+	vc.Cond.L.Unlock()
+
+	if result := waitForResult(t, p); result.Reason != ReasonFinished || p.AudioStats().FramesSent != 5 {
+		t.Errorf("result = %+v after %d frames, want all 5 sent once ready", result, p.AudioStats().FramesSent)
+	}
+}
+
+// manualClock is a sendClock that ticks only when the test says so
+type manualClock struct {
+	ticks chan time.Time
+}
+
+func (c *manualClock) C() <-chan time.Time { return c.ticks }
+func (c *manualClock) Stop()               {}
+func (c *manualClock) Reset(time.Duration) {}
+
+// tick lets one send slot pass, once playback is waiting for it
+func (c *manualClock) tick(t *testing.T) {
+	t.Helper()
+	select {
+	case c.ticks <- time.Now():
+	case <-time.After(5 * time.Second):
+		t.Fatal("playback never waited for the next slot")
+	}
+}
+
+// gatedEncoder produces the frames the test hands it, and ends once frames is closed
+type gatedEncoder struct {
+	fakeEncoder
+	frames chan []byte
+}
+
+func (e *gatedEncoder) OpusFrame() ([]byte, error) {
+	frame, ok := <-e.frames
+	if !ok {
+		return nil, io.EOF
+	}
+	return frame, nil
+}
+
+func TestPlaybackPacesFrames(t *testing.T) {
+	encoder := &gatedEncoder{frames: make(chan []byte, 10)}
+	clock := &manualClock{ticks: make(chan time.Time)}
+	p := newTestPlayer(t, func() (EncoderInterface, error) { return encoder, nil })
+	vc := newTestVoiceConnection()
+	p.VoiceConnection = vc
+	p.newClock = func(time.Duration) sendClock { return clock }
+
+	// sent waits for the send a slot just let through
+	sent := func() []byte {
+		t.Helper()
+		select {
+		case frame := <-vc.OpusSend:
+			return frame
+		case <-time.After(5 * time.Second):
+			t.Fatal("nothing was sent in the slot")
+			return nil
+		}
+	}
+
+	// Frames read ahead wait for their slots instead of going out in a burst
+	encoder.frames <- []byte{1}
+	encoder.frames <- []byte{2}
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(vc.OpusSend) != 0 {
+		t.Fatal("a frame was sent before its slot")
+	}
+	for _, want := range []byte{1, 2} {
+		clock.tick(t)
+		if frame := sent(); !bytes.Equal(frame, []byte{want}) {
+			t.Fatalf("sent %v, want frame %d", frame, want)
+		}
+	}
+
+	// A slot with no frame ready gets silence and counts as an under-run
+	clock.tick(t)
+	if frame := sent(); !bytes.Equal(frame, opusSilence) {
+		t.Fatalf("sent %v in an empty slot, want silence", frame)
+	}
+	if underruns := p.AudioStats().Underruns; underruns != 1 {
+		t.Errorf("%d under-runs, want 1", underruns)
+	}
+
+	close(encoder.frames)
+	if result := waitForResult(t, p); result.Reason != ReasonFinished {
+		t.Errorf("result = %+v, want finished", result)
+	}
+}
@@ -0,0 +1,48 @@
+package player
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// EncoderStats is a snapshot of an encoder's runtime counters
+type EncoderStats struct {
+	FramesEncoded  int64
+	BytesProduced  int64
+	AverageBitrate int           // bits per second of audio produced so far
+	FramesBuffered int           // frames produced but not yet read
+	SinceLastFrame time.Duration // 0 before the first frame
+}
+
+// frameCounters tracks the frames an encoder produces; safe for concurrent use
+type frameCounters struct {
+	frames    atomic.Int64
+	bytes     atomic.Int64
+	lastFrame atomic.Int64 // UnixNano of the last frame
+}
+
+// add records a frame of size bytes and returns the new frame count
+func (c *frameCounters) add(size int) int64 {
+	c.bytes.Add(int64(size))
+	c.lastFrame.Store(time.Now().UnixNano())
+	return c.frames.Add(1)
+}
+
+// snapshot returns the counters as EncoderStats
+func (c *frameCounters) snapshot(frameDuration time.Duration, buffered int) EncoderStats {
+	stats := EncoderStats{
+		FramesEncoded:  c.frames.Load(),
+		BytesProduced:  c.bytes.Load(),
+		FramesBuffered: buffered,
+	}
+
+	if audio := time.Duration(stats.FramesEncoded) * frameDuration; audio > 0 {
+		stats.AverageBitrate = int(float64(stats.BytesProduced*8) / audio.Seconds())
+	}
+
+	if last := c.lastFrame.Load(); last != 0 {
+		stats.SinceLastFrame = time.Since(time.Unix(0, last))
+	}
+
+	return stats
+}
@@ -4,41 +4,54 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io"
 	"os/exec"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/GrainedLotus515/gobard/internal/logger"
-	"github.com/hraban/opus"
+	"github.com/GrainedLotus515/gobard/internal/tools"
 )
 
-// StreamingEncoder handles streaming audio encoding using yt-dlp + FFmpeg + libopus
-// It uses a two-step process: yt-dlp gets the direct URL, then FFmpeg streams from it
-type StreamingEncoder struct {
-	ffmpegCmd   *exec.Cmd
-	opusEncoder *opus.Encoder
-	frameSize   int
-	channels    int
-	sampleRate  int
-	mu          sync.Mutex
-	done        bool
-	frameChan   chan []byte
-	stopChan    chan bool
-}
+// StreamMode selects how uncached tracks are streamed
+type StreamMode string
+
+const (
+	// StreamModeURL has yt-dlp extract a direct URL that FFmpeg then fetches
+	StreamModeURL StreamMode = "url"
+	// StreamModePipe has yt-dlp download the audio straight into FFmpeg's stdin
+	StreamModePipe StreamMode = "pipe"
+)
 
-// NewStreamingEncoder creates a new streaming audio encoder
-// If streamURL is provided, it uses that directly; otherwise fetches via yt-dlp
-func NewStreamingEncoder(url string, streamURL string, sampleRate, channels int) (*StreamingEncoder, error) {
+// liveFormat prefers audio-only HLS for livestreams, falling back to the low-resolution
+// muxed HLS formats YouTube usually offers instead
+const liveFormat = "bestaudio[protocol^=m3u8]/best[protocol^=m3u8][height<=360]/best[protocol^=m3u8]/bestaudio/best"
+
+// NewStreamingEncoder creates a new audio encoder that streams from a URL
+// It uses a two-step process: yt-dlp gets the direct URL, then FFmpeg streams from it
+// If streamURL is provided, it uses that directly along with streamProxy, the proxy it
+// was extracted through; otherwise fetches via yt-dlp
+// In StreamModePipe without a streamURL, yt-dlp pipes the audio into FFmpeg instead,
+// falling back to the two-step process if that fails
+// If live is set, FFmpeg joins the stream's HLS manifest at its newest segment, and
+// tools.ErrLiveEnded is returned once yt-dlp no longer sees the stream as live
+// If startAt is non-zero, FFmpeg seeks to that offset before decoding
+// If filter is non-empty, it is passed to FFmpeg as an -af filter chain
+func NewStreamingEncoder(url, streamURL, streamProxy string, live bool, settings AudioSettings, startAt time.Duration, filter string, mode StreamMode) (*Encoder, error) {
 	start := time.Now()
 
-	frameSize := 960 // 20ms at 48kHz
-	if sampleRate != 48000 {
-		frameSize = (sampleRate * 20) / 1000
+	// Piping only saves the URL extraction, and FFmpeg can't seek within a pipe without
+	// downloading everything before the offset; livestreams need FFmpeg's HLS handling
+	if mode == StreamModePipe && streamURL == "" && startAt == 0 && !live {
+		encoder, err := newPipedEncoder(url, settings, filter)
+		if err == nil {
+			logger.Timing("Streaming encoder creation completed", "mode", mode, "duration_ms", time.Since(start).Milliseconds())
+			return encoder, nil
+		}
+		logger.Warn("Piped streaming failed, falling back to stream URL", "err", err)
 	}
 
 	var finalStreamURL string
+	proxy := streamProxy
 
 	if streamURL != "" {
 		// Use pre-fetched URL (fast path)
@@ -53,24 +66,35 @@ func NewStreamingEncoder(url string, streamURL string, sampleRate, channels int)
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
-		ytdlpCmd := exec.CommandContext(ctx,
-			"yt-dlp",
-			"-f", "bestaudio",
+		args := []string{"-f", "bestaudio"}
+		if live {
+			// A stream that has ended no longer matches and yields no URL
+			args = []string{"-f", liveFormat, "--match-filter", "is_live"}
+		}
+		args = append(args,
 			"-g", // Get URL only
 			"--no-warnings",
-			url,
 		)
 
+		release, err := tools.AcquireYtDlp(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("yt-dlp timed out after 30 seconds waiting for a free slot")
+		}
+		proxy = tools.Proxies.Next()
+		ytdlpCmd := exec.CommandContext(ctx, tools.YtDlp, tools.YtDlpArgs(proxy, url, args...)...)
+
 		var ytdlpStderr bytes.Buffer
 		ytdlpCmd.Stderr = &ytdlpStderr
 
 		urlOutput, err := ytdlpCmd.Output()
+		release()
+		tools.Proxies.ReportRun(ctx, proxy, err, ytdlpStderr.Bytes())
 		if err != nil {
 			if ctx.Err() == context.DeadlineExceeded {
 				return nil, fmt.Errorf("yt-dlp timed out after 30 seconds")
 			}
 			logger.Error("yt-dlp command failed", "stderr", ytdlpStderr.String())
-			return nil, fmt.Errorf("failed to get stream URL: %w", err)
+			return nil, tools.YtDlpError(fmt.Errorf("failed to get stream URL: %w", err), ytdlpStderr.Bytes())
 		}
 
 		finalStreamURL = strings.TrimSpace(string(urlOutput))
@@ -78,197 +102,93 @@ func NewStreamingEncoder(url string, streamURL string, sampleRate, channels int)
 	}
 
 	if finalStreamURL == "" {
+		if live {
+			return nil, tools.ErrLiveEnded
+		}
 		return nil, fmt.Errorf("no stream URL available")
 	}
 
-	logger.Info("Got stream URL, starting FFmpeg", "url_length", len(finalStreamURL))
-
-	// FFmpeg streams directly from the URL (FFmpeg handles HTTP natively)
-	ffmpegCmd := exec.Command(
-		"ffmpeg",
-		"-reconnect", "1",
-		"-reconnect_streamed", "1",
-		"-reconnect_delay_max", "5",
-		"-i", finalStreamURL, // Direct URL instead of pipe:0
-		"-f", "s16le",
-		"-ar", fmt.Sprintf("%d", sampleRate),
-		"-ac", fmt.Sprintf("%d", channels),
-		"-loglevel", "error", // Only show errors
-		"pipe:1", // Output to stdout
-	)
-
-	// Get stdout and stderr from FFmpeg
-	ffmpegStdout, err := ffmpegCmd.StdoutPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create ffmpeg stdout pipe: %w", err)
-	}
-
-	ffmpegStderr, err := ffmpegCmd.StderrPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create ffmpeg stderr pipe: %w", err)
-	}
+	logger.Info("Got stream URL, starting FFmpeg", "url_length", len(finalStreamURL), "start_at", startAt)
 
-	// Start FFmpeg
-	if err := ffmpegCmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	if proxy != "" && !tools.IsHTTPProxy(proxy) {
+		logger.Debug("FFmpeg only supports HTTP proxies, streaming directly", "proxy", tools.RedactProxy(proxy))
+		proxy = ""
 	}
 
-	// Create Opus encoder
-	opusEnc, err := opus.NewEncoder(sampleRate, channels, opus.AppAudio)
+	// FFmpeg streams directly from the URL (FFmpeg handles HTTP natively)
+	encoder, err := NewEncoder(EncoderConfig{
+		AudioSettings:  settings,
+		Input:          finalStreamURL,
+		IsURL:          true,
+		StartOffset:    startAt,
+		FilterChain:    filter,
+		ReconnectFlags: true,
+		Live:           live,
+		Proxy:          proxy,
+	})
 	if err != nil {
-		ffmpegCmd.Process.Kill()
-		return nil, fmt.Errorf("failed to create opus encoder: %w", err)
-	}
-
-	// Set bitrate to 128kbps
-	opusEnc.SetBitrate(128000)
-
-	encoder := &StreamingEncoder{
-		ffmpegCmd:   ffmpegCmd,
-		opusEncoder: opusEnc,
-		frameSize:   frameSize,
-		channels:    channels,
-		sampleRate:  sampleRate,
-		done:        false,
-		frameChan:   make(chan []byte, 300), // Increased from 100 to 300 (~6 seconds buffer)
-		stopChan:    make(chan bool, 1),
+		return nil, err
 	}
 
-	// Start stderr monitoring goroutine
-	go encoder.monitorFFmpegErrors(ffmpegStderr)
-
-	// Start the encoding goroutine
-	go encoder.encodeLoop(ffmpegStdout)
-
-	logger.Timing("Encoder creation completed", "duration_ms", time.Since(start).Milliseconds())
+	logger.Timing("Streaming encoder creation completed", "mode", StreamModeURL, "duration_ms", time.Since(start).Milliseconds())
 	return encoder, nil
 }
 
-// monitorFFmpegErrors reads and logs FFmpeg stderr output
-func (e *StreamingEncoder) monitorFFmpegErrors(stderr io.Reader) {
-	buf := make([]byte, 4096)
-	for {
-		n, err := stderr.Read(buf)
-		if n > 0 {
-			logger.Error("FFmpeg error", "output", string(buf[:n]))
-		}
-		if err != nil {
-			return
-		}
-	}
-}
+// pipedSlotTimeout is how long piped streaming waits for a yt-dlp slot before giving up
+const pipedSlotTimeout = 30 * time.Second
 
-// encodeLoop reads PCM data from FFmpeg and encodes to Opus frames
-func (e *StreamingEncoder) encodeLoop(reader io.Reader) {
-	defer close(e.frameChan)
+// newPipedEncoder streams url by piping yt-dlp's download into FFmpeg
+// It waits for the first Opus frame so a failing yt-dlp can still be retried another way,
+// holding a yt-dlp slot until then: by the first frame, extraction is done
+func newPipedEncoder(url string, settings AudioSettings, filter string) (*Encoder, error) {
+	logger.Info("Piping yt-dlp into FFmpeg", "url", url)
 
-	logger.Info("Starting encode loop")
-
-	// PCM buffer: frameSize samples * channels * 2 bytes per sample
-	pcmBufferSize := e.frameSize * e.channels * 2
-	pcmBuffer := make([]byte, pcmBufferSize)
-	pcmSamples := make([]int16, e.frameSize*e.channels)
-
-	frameCount := 0
-	var firstFrameTime time.Time
-
-	for {
-		select {
-		case <-e.stopChan:
-			logger.Info("Encode loop stopped by signal", "frames_encoded", frameCount)
-			e.ffmpegCmd.Process.Kill()
-			return
-		default:
-		}
-
-		// Read PCM data from FFmpeg
-		n, err := reader.Read(pcmBuffer)
-		if err != nil {
-			// Handle both EOF and unexpected EOF as end of stream
-			if err == io.EOF || err == io.ErrUnexpectedEOF {
-				logger.Info("Stream ended normally", "frames_encoded", frameCount)
-			} else {
-				logger.Error("FFmpeg read error", "err", err, "frames_encoded", frameCount)
-			}
-			return
-		}
-
-		if n == 0 {
-			continue
-		}
-
-		if frameCount == 0 {
-			firstFrameTime = time.Now()
-			logger.Info("First PCM data received", "bytes", n)
-		}
-
-		// Convert bytes to int16 samples
-		for i := 0; i < n/2; i++ {
-			pcmSamples[i] = int16(pcmBuffer[i*2]) | (int16(pcmBuffer[i*2+1]) << 8)
-		}
-
-		// Encode full frames
-		samplesPerFrame := e.frameSize * e.channels
-		for i := 0; i+samplesPerFrame <= n/2; i += samplesPerFrame {
-			frameData := pcmSamples[i : i+samplesPerFrame]
-			opusFrameBuffer := make([]byte, 4000)
-			opusBytes, err := e.opusEncoder.Encode(frameData, opusFrameBuffer)
-			if err != nil {
-				logger.Error("Opus encoding error", "err", err, "frames_encoded", frameCount)
-				return
-			}
-
-			// Send only the encoded bytes
-			opusFrame := opusFrameBuffer[:opusBytes]
-			select {
-			case e.frameChan <- opusFrame:
-				frameCount++
-				if frameCount == 1 {
-					logger.Timing("First opus frame ready", "duration_ms", time.Since(firstFrameTime).Milliseconds())
-				}
-				if frameCount%500 == 0 {
-					logger.Info("Streaming progress", "frames_encoded", frameCount)
-				}
-			case <-e.stopChan:
-				logger.Info("Encode loop stopped while sending frame", "frames_encoded", frameCount)
-				e.ffmpegCmd.Process.Kill()
-				return
-			}
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), pipedSlotTimeout)
+	release, err := tools.AcquireYtDlp(ctx)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("no yt-dlp slot freed up within %v", pipedSlotTimeout)
 	}
-}
-
-// OpusFrame returns the next Opus frame from the encoding stream
-func (e *StreamingEncoder) OpusFrame() ([]byte, error) {
-	frame, ok := <-e.frameChan
-	if !ok {
-		return nil, io.EOF
+	defer release()
+
+	proxy := tools.Proxies.Next()
+	encoder, err := NewEncoder(EncoderConfig{
+		AudioSettings: settings,
+		Input:         "pipe:0",
+		FilterChain:   filter,
+		Source: append([]string{tools.YtDlp}, tools.YtDlpArgs(proxy, url,
+			"-f", "bestaudio",
+			"-o", "-", // Write the container to stdout
+			"--quiet",
+			"--no-warnings",
+		)...),
+	})
+	if err != nil {
+		return nil, err
 	}
-	return frame, nil
-}
 
-// Cleanup stops the encoder and releases resources
-func (e *StreamingEncoder) Cleanup() error {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-
-	if e.done {
-		return nil
+	select {
+	case <-encoder.ready:
+		tools.Proxies.Report(proxy, nil)
+		return encoder, nil
+	case <-encoder.exited:
 	}
 
-	e.done = true
-
-	// Signal the encoding loop to stop
+	// Very short tracks may finish before the wait is noticed
 	select {
-	case e.stopChan <- true:
+	case <-encoder.ready:
+		tools.Proxies.Report(proxy, nil)
+		return encoder, nil
 	default:
 	}
 
-	// Kill FFmpeg process
-	if e.ffmpegCmd.Process != nil {
-		e.ffmpegCmd.Process.Kill()
+	err = encoder.Cleanup()
+	if err == nil {
+		err = ErrNoData
 	}
-
-	// Wait for process to exit
-	return e.ffmpegCmd.Wait()
+	tools.Proxies.ReportRun(context.Background(), proxy, err, []byte(encoder.Messages()))
+	if msg := lastLines(encoder.Messages(), 1); msg != "" {
+		return nil, fmt.Errorf("%w: %s", err, msg)
+	}
+	return nil, err
 }
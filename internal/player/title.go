@@ -0,0 +1,81 @@
+package player
+
+import (
+	"regexp"
+	"strings"
+)
+
+// bracketedPart matches a parenthesized or bracketed part of a title
+var bracketedPart = regexp.MustCompile(`\s*[(\[【]([^)\]】]*)[)\]】]`)
+
+// titleSeparator splits "Artist - Title" and trailing " - Official Video" parts
+var titleSeparator = regexp.MustCompile(`\s+[-–—]\s+`)
+
+// topicSuffix matches the " - Topic" ending of YouTube's auto-generated artist channels
+var topicSuffix = regexp.MustCompile(`(?i)\s*[-–—]\s*topic$`)
+
+// titleNoise are the words of qualifiers that describe an upload rather than the song, like
+// "Official Music Video" or "4K"
+var titleNoise = map[string]bool{
+	"official": true, "music": true, "video": true, "audio": true, "lyric": true, "lyrics": true,
+	"visualizer": true, "visualiser": true, "hd": true, "hq": true, "4k": true, "8k": true,
+	"1080p": true, "720p": true, "mv": true, "m": true, "v": true, "clip": true, "officiel": true,
+	"oficial": true, "videoclip": true, "with": true, "explicit": true, "uhd": true,
+}
+
+// versionStart marks the part after a dash as a version of the song, not its title, as in
+// "Title - Remastered 2009" or "Title - 2011 Remaster"
+var versionStart = regexp.MustCompile(`(?i)^(\d{4}\s+)?(remaster(ed)?|live|remix|mix|edit|version|acoustic|demo|mono|stereo|instrumental|from)\b`)
+
+// NormalizeTitle cleans up a video title for display and matching: it drops qualifiers like
+// "(Official Music Video)" or "[4K]", takes the artist from "Artist - Title" titles or from
+// an "Artist - Topic" channel, and falls back to the uploader as the artist
+// Qualifiers that name a version, like "(Live)" or "(Remastered)", are kept
+func NormalizeTitle(title, uploader string) (cleanTitle, artist string) {
+	artist = strings.TrimSpace(uploader)
+	topic := topicSuffix.MatchString(artist)
+	if topic {
+		artist = topicSuffix.ReplaceAllString(artist, "")
+	}
+
+	clean := bracketedPart.ReplaceAllStringFunc(title, func(part string) string {
+		if isTitleNoise(bracketedPart.FindStringSubmatch(part)[1]) {
+			return ""
+		}
+		return part
+	})
+	// Anything after a bar is usually the channel or a promotion
+	clean, _, _ = strings.Cut(clean, " | ")
+
+	var parts []string
+	for _, part := range titleSeparator.Split(clean, -1) {
+		if part = strings.TrimSpace(part); part != "" && !isTitleNoise(part) {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return strings.TrimSpace(title), artist
+	}
+
+	// Topic channels' titles are the song's own name, so a dash there belongs to the title
+	if !topic && len(parts) > 1 && !versionStart.MatchString(parts[1]) {
+		artist, parts = parts[0], parts[1:]
+	}
+	return strings.Join(strings.Fields(strings.Join(parts, " - ")), " "), artist
+}
+
+// isTitleNoise reports whether a part of a title only describes the upload
+func isTitleNoise(part string) bool {
+	words := strings.FieldsFunc(strings.ToLower(part), func(r rune) bool {
+		return r == ' ' || r == '/' || r == '-' || r == '+' || r == '&'
+	})
+	if len(words) == 0 {
+		return false
+	}
+	for _, word := range words {
+		if !titleNoise[word] {
+			return false
+		}
+	}
+	return true
+}
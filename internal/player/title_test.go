@@ -0,0 +1,58 @@
+package player
+
+import "testing"
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		title, uploader string
+		wantTitle       string
+		wantArtist      string
+	}{
+		// Qualifiers describing the upload are dropped
+		{"Rick Astley - Never Gonna Give You Up (Official Music Video)", "Rick Astley", "Never Gonna Give You Up", "Rick Astley"},
+		{"Daft Punk - Get Lucky (Official Audio) ft. Pharrell Williams, Nile Rodgers", "Daft Punk", "Get Lucky ft. Pharrell Williams, Nile Rodgers", "Daft Punk"},
+		{"Billie Eilish - bad guy [4K]", "BillieEilishVEVO", "bad guy", "Billie Eilish"},
+		{"The Weeknd - Blinding Lights (Official Video) [HD]", "TheWeekndVEVO", "Blinding Lights", "The Weeknd"},
+		{"Imagine Dragons - Believer (Lyric Video)", "ImagineDragonsVEVO", "Believer", "Imagine Dragons"},
+		{"Tame Impala - The Less I Know The Better (Official Visualizer)", "Tame Impala", "The Less I Know The Better", "Tame Impala"},
+		{"Dua Lipa - Levitating (Lyrics)", "7clouds", "Levitating", "Dua Lipa"},
+		{"PSY - GANGNAM STYLE(강남스타일) M/V", "officialpsy", "GANGNAM STYLE(강남스타일) M/V", "PSY"},
+		{"BTS (방탄소년단) 'Dynamite' Official MV", "HYBE LABELS", "BTS (방탄소년단) 'Dynamite' Official MV", "HYBE LABELS"},
+		{"Gorillaz - Feel Good Inc. (Official Video) | Gorillaz", "Gorillaz", "Feel Good Inc.", "Gorillaz"},
+		{"Kendrick Lamar - HUMBLE. [Official Music Video] [Explicit]", "KendrickLamarVEVO", "HUMBLE.", "Kendrick Lamar"},
+		{"Linkin Park - Numb - Official Video", "Linkin Park", "Numb", "Linkin Park"},
+		{"Stromae - Alors on danse (Clip Officiel)", "Stromae", "Alors on danse", "Stromae"},
+		{"Shakira - Hips Don't Lie (Official 4K Video) ft. Wyclef Jean", "shakiraVEVO", "Hips Don't Lie ft. Wyclef Jean", "Shakira"},
+		{"Metallica - Enter Sandman (Remastered) [HD]", "Metallica", "Enter Sandman (Remastered)", "Metallica"},
+
+		// Topic channels name the artist, and their titles are the song's own name
+		{"Bohemian Rhapsody", "Queen - Topic", "Bohemian Rhapsody", "Queen"},
+		{"Here Comes The Sun - Remastered 2009", "The Beatles - Topic", "Here Comes The Sun - Remastered 2009", "The Beatles"},
+		{"Something Just Like This", "The Chainsmokers – Topic", "Something Just Like This", "The Chainsmokers"},
+		{"Clair de Lune", "Claude Debussy — Topic", "Clair de Lune", "Claude Debussy"},
+
+		// Versions after a dash stay in the title
+		{"Hotel California - Live", "Eagles", "Hotel California - Live", "Eagles"},
+		{"Wonderwall - 2014 Remaster", "Oasis", "Wonderwall - 2014 Remaster", "Oasis"},
+		{"Nirvana - Smells Like Teen Spirit (Live at Reading 1992)", "Nirvana", "Smells Like Teen Spirit (Live at Reading 1992)", "Nirvana"},
+
+		// Versions and collaborators in brackets are kept
+		{"Avicii - Wake Me Up (Acoustic)", "Avicii", "Wake Me Up (Acoustic)", "Avicii"},
+		{"Mark Ronson - Uptown Funk (feat. Bruno Mars)", "Mark Ronson", "Uptown Funk (feat. Bruno Mars)", "Mark Ronson"},
+		{"Lil Nas X - Old Town Road (Remix) [Official Video]", "LilNasXVEVO", "Old Town Road (Remix)", "Lil Nas X"},
+
+		// Titles without an artist keep the uploader
+		{"Never Gonna Give You Up", "Rick Astley", "Never Gonna Give You Up", "Rick Astley"},
+		{"Interstellar Main Theme (HD)", "Hans Zimmer", "Interstellar Main Theme", "Hans Zimmer"},
+		{"Official Video", "Some Channel", "Official Video", "Some Channel"},
+		{"", "Some Channel", "", "Some Channel"},
+		{"Song  with   spaces (Audio)", "Uploader", "Song with spaces", "Uploader"},
+	}
+
+	for _, tt := range tests {
+		title, artist := NormalizeTitle(tt.title, tt.uploader)
+		if title != tt.wantTitle || artist != tt.wantArtist {
+			t.Errorf("NormalizeTitle(%q, %q) = %q, %q; want %q, %q", tt.title, tt.uploader, title, artist, tt.wantTitle, tt.wantArtist)
+		}
+	}
+}
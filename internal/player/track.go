@@ -1,6 +1,11 @@
 package player
 
 import (
+	"context"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -9,15 +14,26 @@ import (
 type TrackSource string
 
 const (
-	SourceYouTube TrackSource = "youtube"
-	SourceSpotify TrackSource = "spotify"
-	SourceDirect  TrackSource = "direct"
+	SourceYouTube    TrackSource = "youtube"
+	SourceSpotify    TrackSource = "spotify"
+	SourceDirect     TrackSource = "direct"
+	SourceAppleMusic TrackSource = "applemusic"
+	SourceDeezer     TrackSource = "deezer"
 )
 
+// NeedsMatch reports whether the track is only metadata from a service the bot can't stream
+// from, and has to be matched on YouTube before it plays
+func (t *Track) NeedsMatch() bool {
+	return t.Source == SourceSpotify || t.Source == SourceAppleMusic || t.Source == SourceDeezer
+}
+
 // Track represents a single music track
+// Once queued, a track is shared with command handlers and the playback loop, so it is
+// never modified in place: changes are made to a copy that replaces it in the queue
 type Track struct {
 	ID          string
 	Title       string
+	RawTitle    string // Title as the source gave it, before NormalizeTitle ("" if it wasn't cleaned up)
 	Artist      string
 	URL         string
 	Duration    time.Duration
@@ -25,154 +41,417 @@ type Track struct {
 	Thumbnail   string
 	RequestedBy string // Discord user ID
 	IsLive      bool
-	LocalPath   string // Path to cached file if available
-	StreamURL   string // Pre-fetched direct stream URL for faster playback
+	ViewCount   int64         // View count at lookup time, 0 if unknown
+	LocalPath   string        // Path to cached file if available
+	EncodedPath string        // Path to pre-encoded DCA frames for the current audio settings if available
+	StreamURL   string        // Pre-fetched direct stream URL for faster playback
+	StreamProxy string        // Proxy StreamURL was extracted through; YouTube binds the URL to its address
+	StartAt     time.Duration // Offset to start from on first play (e.g. from a t= URL parameter)
+	Partial     bool          // Built from a flat playlist entry; full info is fetched before it plays
+
+	// VolumeOffset raises or lowers the guild's volume for this track, in percent (0 for none)
+	VolumeOffset int
+
+	// Download is the track's cache download while it is in progress, played from instead of
+	// fetching the audio twice (nil if none)
+	Download DownloadSource
+
+	// Chapters lists the track's chapter markers in order (empty if none)
+	Chapters []Chapter
+
+	// ctx is cancelled when the track leaves the queue; copies share it
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Context returns a context for the track's background work (stream lookup, cache download)
+// It is cancelled when the track is removed or the queue is cleared
+func (t *Track) Context() context.Context {
+	if t.ctx == nil {
+		return context.Background()
+	}
+	return t.ctx
+}
+
+// Detached returns a copy of the track that can be queued again, with none of the original's
+// background work, which is cancelled once the original leaves the queue
+func (t *Track) Detached() *Track {
+	copied := *t
+	copied.ctx, copied.cancel = nil, nil
+	return &copied
+}
+
+// release cancels the track's background work
+func (t *Track) release() {
+	if t.cancel != nil {
+		t.cancel()
+	}
+}
+
+// Chapter represents a titled section of a track
+type Chapter struct {
+	Title string
+	Start time.Duration
 }
 
+// ChapterAt returns the index of the chapter containing the given position, or -1 if none
+func (t *Track) ChapterAt(position time.Duration) int {
+	index := -1
+	for i, chapter := range t.Chapters {
+		if chapter.Start > position {
+			break
+		}
+		index = i
+	}
+	return index
+}
+
+// OverLimit reports whether a track is known to run longer than limit (0 for no limit)
+// Livestreams have no length and tracks of unknown length can't be judged, so they never are
+func (t *Track) OverLimit(limit time.Duration) bool {
+	return limit > 0 && !t.IsLive && t.Duration > limit
+}
+
+// DefaultHistoryLimit is how many played tracks a queue keeps for Previous unless
+// SetHistoryLimit changes it
+const DefaultHistoryLimit = 50
+
 // Queue represents a music queue for a guild
+// Played tracks, the current track and upcoming tracks are kept apart, and only the last
+// few played tracks are kept, so a player that runs for days doesn't hold every track it
+// ever played
 type Queue struct {
-	Tracks       []*Track
-	CurrentIndex int
-	Loop         bool
-	Shuffle      bool
+	Loop    bool
+	Shuffle bool
+
 	mu           sync.RWMutex
+	history      []*Track // Played tracks, oldest first
+	current      *Track
+	upcoming     []*Track
+	historyLimit int
+	changed      chan struct{} // signalled after the order or position changes
+}
+
+// QueueSnapshot is a copy of a queue's tracks at one moment
+type QueueSnapshot struct {
+	History  []*Track // Played tracks, oldest first
+	Current  *Track   // nil if nothing is playing
+	Upcoming []*Track
 }
 
 // NewQueue creates a new empty queue
 func NewQueue() *Queue {
 	return &Queue{
-		Tracks:       make([]*Track, 0),
-		CurrentIndex: -1,
-		Loop:         false,
-		Shuffle:      false,
+		historyLimit: DefaultHistoryLimit,
+		changed:      make(chan struct{}, 1),
+	}
+}
+
+// SetHistoryLimit sets how many played tracks are kept, forgetting the oldest beyond it
+func (q *Queue) SetHistoryLimit(limit int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.historyLimit = max(limit, 0)
+	q.trimHistory()
+}
+
+// Changes signals after tracks are added, removed, reordered, or advanced past
+// Signals coalesce, so a receiver should re-read the queue each time; only one receiver is supported
+func (q *Queue) Changes() <-chan struct{} {
+	return q.changed
+}
+
+// notify signals a change without blocking; the caller must hold q.mu
+func (q *Queue) notify() {
+	select {
+	case q.changed <- struct{}{}:
+	default:
 	}
 }
 
+// pushHistory records the current track as played; the caller must hold q.mu
+func (q *Queue) pushHistory() {
+	if q.current == nil {
+		return
+	}
+	q.history = append(q.history, q.current)
+	q.current = nil
+	q.trimHistory()
+}
+
+// trimHistory forgets the oldest played tracks beyond the limit; the caller must hold q.mu
+func (q *Queue) trimHistory() {
+	drop := len(q.history) - q.historyLimit
+	if drop <= 0 {
+		return
+	}
+	for _, track := range q.history[:drop] {
+		track.release()
+	}
+	q.history = append([]*Track(nil), q.history[drop:]...)
+}
+
 // Add adds a track to the queue
 func (q *Queue) Add(track *Track) {
+	q.AddAll([]*Track{track})
+}
+
+// AddAll adds tracks to the end of the queue together, returning the current track and a
+// copy of the upcoming tracks ahead of them at that moment
+func (q *Queue) AddAll(tracks []*Track) (current *Track, ahead []*Track) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
-	q.Tracks = append(q.Tracks, track)
+	defer q.notify()
+
+	ahead = append([]*Track(nil), q.upcoming...)
+	for _, track := range tracks {
+		if track.ctx == nil {
+			track.ctx, track.cancel = context.WithCancel(context.Background())
+		}
+	}
+	q.upcoming = append(q.upcoming, tracks...)
+	return q.current, ahead
 }
 
-// Next moves to the next track in the queue
+// Next moves to the next track in the queue, or stays on the current one when looping
+// It returns nil once the queue runs out, and the next track added is played next
 func (q *Queue) Next() *Track {
 	q.mu.Lock()
 	defer q.mu.Unlock()
+	defer q.notify()
+
+	if q.Loop && q.current != nil {
+		return q.current
+	}
 
-	if len(q.Tracks) == 0 {
-		q.CurrentIndex = -1
+	q.pushHistory()
+	if len(q.upcoming) == 0 {
 		return nil
 	}
+	q.current = q.upcoming[0]
+	q.upcoming[0] = nil // Don't keep it reachable through the backing array
+	q.upcoming = q.upcoming[1:]
+	return q.current
+}
 
-	if q.Loop && q.CurrentIndex >= 0 && q.CurrentIndex < len(q.Tracks) {
-		// Stay on current track if looping
-		return q.Tracks[q.CurrentIndex]
+// Previous goes back to the last played track, putting the current one first in line
+// It returns nil, changing nothing, if no played track is kept
+func (q *Queue) Previous() *Track {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.history) == 0 {
+		return nil
+	}
+	if q.current != nil {
+		q.upcoming = append([]*Track{q.current}, q.upcoming...)
 	}
+	last := len(q.history) - 1
+	q.current = q.history[last]
+	q.history = q.history[:last]
 
-	q.CurrentIndex++
-	if q.CurrentIndex >= len(q.Tracks) {
-		// Reset index so new tracks can be picked up
-		q.CurrentIndex = -1
+	q.notify()
+	return q.current
+}
+
+// JumpTo makes the upcoming track at index current, as if the ones before it were skipped;
+// the skipped tracks leave the queue
+// It returns nil, changing nothing, for an index out of range
+func (q *Queue) JumpTo(index int) *Track {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if index < 0 || index >= len(q.upcoming) {
 		return nil
 	}
+	for _, track := range q.upcoming[:index] {
+		track.release()
+	}
+	q.pushHistory()
+	q.current = q.upcoming[index]
+	q.upcoming = append([]*Track(nil), q.upcoming[index+1:]...)
 
-	return q.Tracks[q.CurrentIndex]
+	q.notify()
+	return q.current
 }
 
 // Current returns the current track
 func (q *Queue) Current() *Track {
 	q.mu.RLock()
 	defer q.mu.RUnlock()
-
-	if q.CurrentIndex < 0 || q.CurrentIndex >= len(q.Tracks) {
-		return nil
-	}
-	return q.Tracks[q.CurrentIndex]
+	return q.current
 }
 
 // Clear removes all tracks from the queue except the current one
 func (q *Queue) Clear() {
 	q.mu.Lock()
 	defer q.mu.Unlock()
+	defer q.notify()
 
-	if q.CurrentIndex >= 0 && q.CurrentIndex < len(q.Tracks) {
-		current := q.Tracks[q.CurrentIndex]
-		q.Tracks = []*Track{current}
-		q.CurrentIndex = 0
-	} else {
-		q.Tracks = make([]*Track, 0)
-		q.CurrentIndex = -1
+	for _, track := range q.history {
+		track.release()
 	}
+	for _, track := range q.upcoming {
+		track.release()
+	}
+	q.history = nil
+	q.upcoming = nil
 }
 
 // ClearAll removes all tracks from the queue including the current one
 func (q *Queue) ClearAll() {
 	q.mu.Lock()
 	defer q.mu.Unlock()
+	defer q.notify()
 
-	q.Tracks = make([]*Track, 0)
-	q.CurrentIndex = -1
+	if q.current != nil {
+		q.current.release()
+		q.current = nil
+	}
+	for _, track := range q.history {
+		track.release()
+	}
+	for _, track := range q.upcoming {
+		track.release()
+	}
+	q.history = nil
+	q.upcoming = nil
 }
 
-// Remove removes a track at the specified index
+// Remove removes the upcoming track at index, where 0 is the next track
 func (q *Queue) Remove(index int) bool {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	if index < 0 || index >= len(q.Tracks) {
+	if index < 0 || index >= len(q.upcoming) {
 		return false
 	}
 
-	q.Tracks = append(q.Tracks[:index], q.Tracks[index+1:]...)
+	q.upcoming[index].release()
+	q.upcoming = append(q.upcoming[:index:index], q.upcoming[index+1:]...)
 
-	// Adjust current index if necessary
-	if q.CurrentIndex >= index {
-		q.CurrentIndex--
+	q.notify()
+	return true
+}
+
+// RemoveTrack removes track if it is still queued after the current track
+func (q *Queue) RemoveTrack(track *Track) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	index := slices.Index(q.upcoming, track)
+	if index < 0 {
+		return false
 	}
+	track.release()
+	q.upcoming = append(q.upcoming[:index:index], q.upcoming[index+1:]...)
 
+	q.notify()
 	return true
 }
 
-// Move moves a track from one position to another
-func (q *Queue) Move(from, to int) bool {
+// QueueMatch is a copy of an upcoming track found by title, with its index where 0 is the
+// next track
+type QueueMatch struct {
+	Index int
+	Track *Track
+}
+
+// Find returns the upcoming tracks whose title contains text, ignoring case and spacing
+func (q *Queue) Find(text string) []QueueMatch {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.find(text)
+}
+
+// find is Find without locking; the caller must hold q.mu
+func (q *Queue) find(text string) []QueueMatch {
+	want := titleKey(text)
+	if want == "" {
+		return nil
+	}
+	var matches []QueueMatch
+	for i, track := range q.upcoming {
+		if strings.Contains(titleKey(track.Title), want) || strings.Contains(titleKey(track.RawTitle), want) {
+			copied := *track
+			matches = append(matches, QueueMatch{Index: i, Track: &copied})
+		}
+	}
+	return matches
+}
+
+// RemoveByTitle removes upcoming tracks whose title contains text: every match with all, or
+// else the only one; the current track is never removed
+// It returns the removed tracks, or when several match without all, removes nothing and
+// returns them as candidates
+func (q *Queue) RemoveByTitle(text string, all bool) (removed []*Track, candidates []QueueMatch) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	if from < 0 || from >= len(q.Tracks) || to < 0 || to >= len(q.Tracks) {
-		return false
+	matches := q.find(text)
+	if len(matches) > 1 && !all {
+		return nil, matches
+	}
+	if len(matches) == 0 {
+		return nil, nil
 	}
 
-	track := q.Tracks[from]
-	q.Tracks = append(q.Tracks[:from], q.Tracks[from+1:]...)
+	kept := q.upcoming[:0:0]
+	next := 0
+	for i, track := range q.upcoming {
+		if next < len(matches) && matches[next].Index == i {
+			next++
+			track.release()
+			removed = append(removed, track)
+			continue
+		}
+		kept = append(kept, track)
+	}
+	q.upcoming = kept
+
+	q.notify()
+	return removed, nil
+}
+
+// titleKey is a title lowercased with its spacing collapsed, for comparing titles
+func titleKey(title string) string {
+	return strings.Join(strings.Fields(strings.ToLower(title)), " ")
+}
 
-	// Insert at new position
-	q.Tracks = append(q.Tracks[:to], append([]*Track{track}, q.Tracks[to:]...)...)
+// Move moves an upcoming track from one index to another, where 0 is the next track
+func (q *Queue) Move(from, to int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
 
-	// Adjust current index
-	if q.CurrentIndex == from {
-		q.CurrentIndex = to
-	} else if from < q.CurrentIndex && to >= q.CurrentIndex {
-		q.CurrentIndex--
-	} else if from > q.CurrentIndex && to <= q.CurrentIndex {
-		q.CurrentIndex++
+	if from < 0 || from >= len(q.upcoming) || to < 0 || to >= len(q.upcoming) {
+		return false
 	}
 
+	track := q.upcoming[from]
+	rest := append(q.upcoming[:from:from], q.upcoming[from+1:]...)
+	q.upcoming = append(rest[:to:to], append([]*Track{track}, rest[to:]...)...)
+
+	q.notify()
 	return true
 }
 
-// IsEmpty returns true if the queue is empty
+// IsEmpty returns true if nothing is playing or queued
 func (q *Queue) IsEmpty() bool {
 	q.mu.RLock()
 	defer q.mu.RUnlock()
-	return len(q.Tracks) == 0
+	return q.current == nil && len(q.upcoming) == 0
 }
 
-// Length returns the number of tracks in the queue
+// Length returns the number of tracks playing or queued, not counting played ones
 func (q *Queue) Length() int {
 	q.mu.RLock()
 	defer q.mu.RUnlock()
-	return len(q.Tracks)
+
+	if q.current == nil {
+		return len(q.upcoming)
+	}
+	return len(q.upcoming) + 1
 }
 
 // Peek returns the next track without advancing the queue
@@ -180,14 +459,124 @@ func (q *Queue) Peek() *Track {
 	q.mu.RLock()
 	defer q.mu.RUnlock()
 
-	if len(q.Tracks) == 0 {
+	if len(q.upcoming) == 0 {
 		return nil
 	}
+	return q.upcoming[0]
+}
+
+// Upcoming returns up to n tracks after the current one
+func (q *Queue) Upcoming(n int) []*Track {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
 
-	nextIndex := q.CurrentIndex + 1
-	if nextIndex >= len(q.Tracks) {
+	if n <= 0 || len(q.upcoming) == 0 {
 		return nil
 	}
+	return append([]*Track(nil), q.upcoming[:min(n, len(q.upcoming))]...)
+}
 
-	return q.Tracks[nextIndex]
+// Snapshot returns a copy of the played, current and upcoming tracks
+func (q *Queue) Snapshot() QueueSnapshot {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return QueueSnapshot{
+		History:  append([]*Track(nil), q.history...),
+		Current:  q.current,
+		Upcoming: append([]*Track(nil), q.upcoming...),
+	}
+}
+
+// ShuffleUpcoming shuffles the tracks after the current one
+func (q *Queue) ShuffleUpcoming() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	defer q.notify()
+
+	rand.Shuffle(len(q.upcoming), func(i, j int) {
+		q.upcoming[i], q.upcoming[j] = q.upcoming[j], q.upcoming[i]
+	})
+}
+
+// SortUpcoming sorts the tracks after the current one by less, keeping the order of tracks
+// it considers equal
+func (q *Queue) SortUpcoming(less func(a, b *Track) bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	defer q.notify()
+
+	sort.SliceStable(q.upcoming, func(i, j int) bool {
+		return less(q.upcoming[i], q.upcoming[j])
+	})
+}
+
+// ReverseUpcoming reverses the order of the tracks after the current one
+func (q *Queue) ReverseUpcoming() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	defer q.notify()
+
+	slices.Reverse(q.upcoming)
+}
+
+// InterleaveByRequester reorders the tracks after the current one so their requesters take
+// turns, in the order each first comes up, keeping each requester's tracks in their order
+func (q *Queue) InterleaveByRequester() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	defer q.notify()
+
+	var requesters []string
+	byRequester := make(map[string][]*Track)
+	for _, track := range q.upcoming {
+		if _, ok := byRequester[track.RequestedBy]; !ok {
+			requesters = append(requesters, track.RequestedBy)
+		}
+		byRequester[track.RequestedBy] = append(byRequester[track.RequestedBy], track)
+	}
+
+	interleaved := make([]*Track, 0, len(q.upcoming))
+	for turn := 0; len(interleaved) < len(q.upcoming); turn++ {
+		for _, requester := range requesters {
+			if tracks := byRequester[requester]; turn < len(tracks) {
+				interleaved = append(interleaved, tracks[turn])
+			}
+		}
+	}
+	q.upcoming = interleaved
+}
+
+// ReplaceUpcoming swaps old for replacement if old is still queued after the current track
+func (q *Queue) ReplaceUpcoming(old, replacement *Track) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, track := range q.upcoming {
+		if track == old {
+			q.upcoming[i] = replacement
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateCurrent applies update to a copy of old and returns the copy, which replaces old
+// in the queue if old is still the current track
+func (q *Queue) UpdateCurrent(old *Track, update func(*Track)) *Track {
+	updated := *old
+	update(&updated)
+	q.ReplaceCurrent(old, &updated)
+	return &updated
+}
+
+// ReplaceCurrent swaps old for replacement if old is the current track
+func (q *Queue) ReplaceCurrent(old, replacement *Track) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.current == nil || q.current != old {
+		return false
+	}
+	q.current = replacement
+	return true
 }
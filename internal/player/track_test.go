@@ -0,0 +1,467 @@
+package player
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestQueue(titles ...string) *Queue {
+	q := NewQueue()
+	for _, title := range titles {
+		q.Add(&Track{Title: title})
+	}
+	return q
+}
+
+func TestQueueUpcoming(t *testing.T) {
+	q := newTestQueue("a", "b", "c", "d")
+	q.Next()
+
+	upcoming := q.Upcoming(2)
+	if len(upcoming) != 2 || upcoming[0].Title != "b" || upcoming[1].Title != "c" {
+		t.Errorf("Upcoming(2) = %v", upcoming)
+	}
+
+	q.Next()
+	q.Next()
+	q.Next()
+	if upcoming := q.Upcoming(2); len(upcoming) != 0 {
+		t.Errorf("Upcoming(2) at the last track = %v", upcoming)
+	}
+}
+
+func TestQueueReplaceUpcoming(t *testing.T) {
+	q := newTestQueue("a", "b")
+	current := q.Next()
+	next := q.Peek()
+
+	resolved := &Track{Title: "b (resolved)"}
+	if !q.ReplaceUpcoming(next, resolved) {
+		t.Fatal("ReplaceUpcoming refused an upcoming track")
+	}
+	if q.Peek() != resolved {
+		t.Error("queue doesn't hold the replacement")
+	}
+
+	if q.ReplaceUpcoming(current, &Track{}) {
+		t.Error("ReplaceUpcoming replaced the current track")
+	}
+	if q.ReplaceUpcoming(next, &Track{}) {
+		t.Error("ReplaceUpcoming replaced a track that is no longer queued")
+	}
+}
+
+func TestQueueReplaceCurrent(t *testing.T) {
+	q := newTestQueue("a", "b")
+	current := q.Next()
+
+	if q.ReplaceCurrent(q.Peek(), &Track{}) {
+		t.Error("ReplaceCurrent replaced an upcoming track")
+	}
+
+	resolved := &Track{Title: "a (resolved)"}
+	if !q.ReplaceCurrent(current, resolved) {
+		t.Fatal("ReplaceCurrent refused the current track")
+	}
+	if q.Current() != resolved {
+		t.Error("queue doesn't hold the replacement")
+	}
+}
+
+func TestQueueShuffleUpcomingKeepsCurrent(t *testing.T) {
+	q := newTestQueue("a", "b", "c", "d", "e")
+	current := q.Next()
+
+	for range 10 {
+		q.ShuffleUpcoming()
+		if q.Current() != current {
+			t.Fatal("shuffle moved the current track")
+		}
+	}
+	if q.Length() != 5 {
+		t.Errorf("Length() = %d after shuffling", q.Length())
+	}
+}
+
+func TestQueueSortAndReverseUpcoming(t *testing.T) {
+	q := newTestQueue("x", "c", "e", "a", "d", "b")
+	q.Next()
+	current := q.Next()
+
+	q.SortUpcoming(func(a, b *Track) bool { return a.Title < b.Title })
+	if got := titles(q.Snapshot().Upcoming); got != "a,b,d,e" {
+		t.Errorf("sorted upcoming = %s, want a,b,d,e", got)
+	}
+	q.ReverseUpcoming()
+	if got := titles(q.Snapshot().Upcoming); got != "e,d,b,a" {
+		t.Errorf("reversed upcoming = %s, want e,d,b,a", got)
+	}
+
+	snapshot := q.Snapshot()
+	if snapshot.Current != current || len(snapshot.History) != 1 || snapshot.History[0].Title != "x" {
+		t.Error("sorting moved the current track or history")
+	}
+}
+
+func TestQueueInterleaveByRequester(t *testing.T) {
+	q := NewQueue()
+	for _, title := range []string{"x", "a1", "a2", "a3", "b1", "b2", "c1"} {
+		q.Add(&Track{Title: title, RequestedBy: title[:1]})
+	}
+	current := q.Next()
+
+	q.InterleaveByRequester()
+	if got := titles(q.Snapshot().Upcoming); got != "a1,b1,c1,a2,b2,a3" {
+		t.Errorf("interleaved upcoming = %s, want a1,b1,c1,a2,b2,a3", got)
+	}
+	if q.Current() != current {
+		t.Error("interleaving moved the current track")
+	}
+}
+
+func TestQueueChanges(t *testing.T) {
+	q := NewQueue()
+
+	select {
+	case <-q.Changes():
+		t.Fatal("new queue signalled a change")
+	default:
+	}
+
+	// Signals coalesce, so several changes leave one pending signal
+	q.Add(&Track{Title: "a"})
+	q.Add(&Track{Title: "b"})
+	q.Move(1, 0)
+
+	select {
+	case <-q.Changes():
+	default:
+		t.Fatal("no change signalled")
+	}
+	select {
+	case <-q.Changes():
+		t.Fatal("changes didn't coalesce")
+	default:
+	}
+
+	// Replacing a track doesn't change the order
+	q.ReplaceUpcoming(q.Peek(), &Track{})
+	select {
+	case <-q.Changes():
+		t.Error("replacement signalled a change")
+	default:
+	}
+}
+
+func TestQueueRemovalCancelsTrackContext(t *testing.T) {
+	q := newTestQueue("a", "b", "c")
+	current := q.Next()
+	b, c := q.Upcoming(2)[0], q.Upcoming(2)[1]
+
+	// Copies made while the track is queued share its context
+	updated := q.UpdateCurrent(current, func(t *Track) { t.LocalPath = "a.webm" })
+
+	q.Remove(0)
+	if b.Context().Err() == nil {
+		t.Error("removed track's context is still live")
+	}
+	if c.Context().Err() != nil {
+		t.Error("remaining track's context was cancelled")
+	}
+
+	q.Clear()
+	if c.Context().Err() == nil {
+		t.Error("cleared track's context is still live")
+	}
+	if updated.Context().Err() != nil {
+		t.Error("Clear cancelled the current track")
+	}
+
+	q.ClearAll()
+	if current.Context().Err() == nil || updated.Context().Err() == nil {
+		t.Error("ClearAll left the current track's context live")
+	}
+}
+
+// titles returns the titles of tracks, for comparing queues
+func titles(tracks []*Track) string {
+	var names []string
+	for _, track := range tracks {
+		names = append(names, track.Title)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestQueueRemove(t *testing.T) {
+	tests := []struct {
+		name  string
+		index int
+		ok    bool
+		want  string
+	}{
+		{"next", 0, true, "c,d"},
+		{"middle", 1, true, "b,d"},
+		{"last", 2, true, "b,c"},
+		{"past the end", 3, false, "b,c,d"},
+		{"negative", -1, false, "b,c,d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQueue("a", "b", "c", "d")
+			current := q.Next()
+
+			if ok := q.Remove(tt.index); ok != tt.ok {
+				t.Errorf("Remove(%d) = %v, want %v", tt.index, ok, tt.ok)
+			}
+			if got := titles(q.Snapshot().Upcoming); got != tt.want {
+				t.Errorf("upcoming = %s, want %s", got, tt.want)
+			}
+			if q.Current() != current {
+				t.Error("Remove changed the current track")
+			}
+		})
+	}
+}
+
+func TestQueueRemoveTrack(t *testing.T) {
+	q := newTestQueue("a", "b", "c")
+	current := q.Next()
+	b := q.Peek()
+
+	if !q.RemoveTrack(b) {
+		t.Fatal("RemoveTrack refused an upcoming track")
+	}
+	if got := titles(q.Snapshot().Upcoming); got != "c" {
+		t.Errorf("upcoming = %s, want c", got)
+	}
+	if b.Context().Err() == nil {
+		t.Error("RemoveTrack didn't cancel the track's context")
+	}
+	if b.Detached().Context().Err() != nil {
+		t.Error("a detached copy of a removed track shares its cancelled context")
+	}
+	if q.RemoveTrack(b) {
+		t.Error("RemoveTrack removed a track twice")
+	}
+	if q.RemoveTrack(current) || q.Current() != current {
+		t.Error("RemoveTrack removed the current track")
+	}
+}
+
+func TestQueueMove(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to int
+		ok       bool
+		want     string
+	}{
+		{"to the front", 2, 0, true, "d,b,c,e"},
+		{"to the back", 0, 3, true, "c,d,e,b"},
+		{"one down", 1, 2, true, "b,d,c,e"},
+		{"one up", 2, 1, true, "b,d,c,e"},
+		{"in place", 1, 1, true, "b,c,d,e"},
+		{"from past the end", 4, 0, false, "b,c,d,e"},
+		{"to past the end", 0, 4, false, "b,c,d,e"},
+		{"negative", -1, 0, false, "b,c,d,e"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQueue("a", "b", "c", "d", "e")
+			current := q.Next()
+
+			if ok := q.Move(tt.from, tt.to); ok != tt.ok {
+				t.Errorf("Move(%d, %d) = %v, want %v", tt.from, tt.to, ok, tt.ok)
+			}
+			if got := titles(q.Snapshot().Upcoming); got != tt.want {
+				t.Errorf("upcoming = %s, want %s", got, tt.want)
+			}
+			if q.Current() != current {
+				t.Error("Move changed the current track")
+			}
+		})
+	}
+}
+
+func TestQueueNext(t *testing.T) {
+	q := newTestQueue("a", "b")
+	if q.Current() != nil || q.Length() != 2 {
+		t.Fatalf("new queue: current = %v, length = %d", q.Current(), q.Length())
+	}
+
+	q.Next()
+	q.Loop = true
+	if got := q.Next(); got.Title != "a" {
+		t.Errorf("Next() while looping = %s, want a", got.Title)
+	}
+	q.Loop = false
+	if got := q.Next(); got.Title != "b" {
+		t.Errorf("Next() = %s, want b", got.Title)
+	}
+	if got := q.Next(); got != nil {
+		t.Errorf("Next() at the end = %s, want nil", got.Title)
+	}
+	if !q.IsEmpty() || titles(q.Snapshot().History) != "a,b" {
+		t.Errorf("after the end: empty = %v, history = %s", q.IsEmpty(), titles(q.Snapshot().History))
+	}
+
+	// A track added after the queue ran out plays next, not the played ones again
+	q.Add(&Track{Title: "c"})
+	if got := q.Next(); got.Title != "c" {
+		t.Errorf("Next() after adding = %s, want c", got.Title)
+	}
+}
+
+func TestQueueHistoryIsBounded(t *testing.T) {
+	q := newTestQueue("a", "b", "c", "d", "e")
+	q.SetHistoryLimit(2)
+	first := q.Next()
+	for q.Next() != nil {
+	}
+
+	if got := titles(q.Snapshot().History); got != "d,e" {
+		t.Errorf("history = %s, want d,e", got)
+	}
+	if first.Context().Err() == nil {
+		t.Error("forgotten track's context is still live")
+	}
+}
+
+func TestQueuePrevious(t *testing.T) {
+	q := newTestQueue("a", "b", "c")
+	if q.Previous() != nil {
+		t.Error("Previous() with no history returned a track")
+	}
+
+	q.Next()
+	q.Next()
+	if got := q.Previous(); got == nil || got.Title != "a" {
+		t.Fatalf("Previous() = %v, want a", got)
+	}
+	if got := titles(q.Snapshot().Upcoming); got != "b,c" {
+		t.Errorf("upcoming = %s, want b,c", got)
+	}
+	if q.Previous() != nil || q.Current().Title != "a" {
+		t.Error("Previous() past the first track changed the queue")
+	}
+}
+
+func TestQueueJumpTo(t *testing.T) {
+	q := newTestQueue("a", "b", "c", "d")
+	q.Next()
+	skipped := q.Peek()
+
+	if q.JumpTo(3) != nil {
+		t.Error("JumpTo past the end returned a track")
+	}
+	if got := q.JumpTo(1); got == nil || got.Title != "c" {
+		t.Fatalf("JumpTo(1) = %v, want c", got)
+	}
+	snapshot := q.Snapshot()
+	if titles(snapshot.History) != "a" || titles(snapshot.Upcoming) != "d" {
+		t.Errorf("after JumpTo: history = %s, upcoming = %s", titles(snapshot.History), titles(snapshot.Upcoming))
+	}
+	if skipped.Context().Err() == nil {
+		t.Error("skipped track's context is still live")
+	}
+}
+
+func TestUnqueuedTrackContext(t *testing.T) {
+	if (&Track{}).Context() == nil {
+		t.Error("unqueued track has no context")
+	}
+}
+
+func TestTrackOverLimit(t *testing.T) {
+	tests := []struct {
+		track *Track
+		limit time.Duration
+		want  bool
+	}{
+		{&Track{Duration: 2 * time.Hour}, time.Hour, true},
+		{&Track{Duration: time.Hour}, time.Hour, false},
+		{&Track{Duration: 10 * time.Hour}, 0, false},
+		{&Track{}, time.Hour, false},
+		{&Track{IsLive: true, Duration: 2 * time.Hour}, time.Hour, false},
+	}
+	for _, tt := range tests {
+		if got := tt.track.OverLimit(tt.limit); got != tt.want {
+			t.Errorf("OverLimit(%s) for %+v = %v, want %v", tt.limit, tt.track, got, tt.want)
+		}
+	}
+}
+
+func TestQueueFind(t *testing.T) {
+	q := newTestQueue("Bohemian Rhapsody", "Under Pressure", "Radio Ga Ga", "Another One Bites the Dust")
+	q.Next()
+
+	matches := q.Find("  under   PRESSURE ")
+	if len(matches) != 1 || matches[0].Index != 0 || matches[0].Track.Title != "Under Pressure" {
+		t.Errorf("Find = %+v, want Under Pressure at 0", matches)
+	}
+	matches[0].Track.Title = "changed"
+	if q.Snapshot().Upcoming[0].Title != "Under Pressure" {
+		t.Error("changing a match changed the queued track")
+	}
+	if matches := q.Find("bohemian"); len(matches) != 0 {
+		t.Errorf("Find matched the current track: %+v", matches)
+	}
+	if matches := q.Find("a"); len(matches) != 2 {
+		t.Errorf("Find(a) found %d tracks, want 2", len(matches))
+	}
+	if matches := q.Find(" "); len(matches) != 0 {
+		t.Errorf("Find with blank text = %+v", matches)
+	}
+}
+
+func TestQueueRemoveByTitle(t *testing.T) {
+	q := newTestQueue("Song One", "Song Two", "Other", "song three")
+	current := q.Next()
+
+	removed, candidates := q.RemoveByTitle("song", false)
+	if len(removed) != 0 || len(candidates) != 2 {
+		t.Fatalf("ambiguous removal: removed %d, %d candidates; want none and 2", len(removed), len(candidates))
+	}
+	if got := titles(q.Snapshot().Upcoming); got != "Song Two,Other,song three" {
+		t.Errorf("an ambiguous removal changed the queue: %s", got)
+	}
+
+	removed, _ = q.RemoveByTitle("other", false)
+	if len(removed) != 1 || removed[0].Title != "Other" {
+		t.Fatalf("removed = %v, want Other", removed)
+	}
+	if removed[0].Context().Err() == nil {
+		t.Error("a removed track's context wasn't cancelled")
+	}
+
+	removed, _ = q.RemoveByTitle("SONG", true)
+	if len(removed) != 2 {
+		t.Errorf("removed %d tracks, want 2", len(removed))
+	}
+	if got := titles(q.Snapshot().Upcoming); got != "" {
+		t.Errorf("upcoming = %s, want none", got)
+	}
+	if q.Current() != current {
+		t.Error("RemoveByTitle changed the current track")
+	}
+}
+
+func TestQueueAddAll(t *testing.T) {
+	q := newTestQueue("a", "b", "c")
+	q.Next()
+
+	current, ahead := q.AddAll([]*Track{{Title: "d"}, {Title: "e"}})
+	if current == nil || current.Title != "a" {
+		t.Errorf("current = %v, want a", current)
+	}
+	if got := titles(ahead); got != "b,c" {
+		t.Errorf("ahead = %s, want b,c", got)
+	}
+	if got := titles(q.Snapshot().Upcoming); got != "b,c,d,e" {
+		t.Errorf("upcoming = %s, want b,c,d,e", got)
+	}
+	ahead[0] = nil
+	if q.Peek() == nil {
+		t.Error("changing the returned tracks changed the queue")
+	}
+}
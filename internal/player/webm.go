@@ -0,0 +1,427 @@
+package player
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Matroska element IDs used by the WebM demuxer
+const (
+	ebmlIDHeader            = 0x1A45DFA3
+	ebmlIDSegment           = 0x18538067
+	ebmlIDInfo              = 0x1549A966
+	ebmlIDTimecodeScale     = 0x2AD7B1
+	ebmlIDTracks            = 0x1654AE6B
+	ebmlIDTrackEntry        = 0xAE
+	ebmlIDTrackNumber       = 0xD7
+	ebmlIDTrackType         = 0x83
+	ebmlIDCodecID           = 0x86
+	ebmlIDAudio             = 0xE1
+	ebmlIDSamplingFrequency = 0xB5
+	ebmlIDChannels          = 0x9F
+	ebmlIDCluster           = 0x1F43B675
+	ebmlIDClusterTimecode   = 0xE7
+	ebmlIDSimpleBlock       = 0xA3
+	ebmlIDBlockGroup        = 0xA0
+	ebmlIDBlock             = 0xA1
+)
+
+// matroskaAudioTrack is the TrackType of audio tracks
+const matroskaAudioTrack = 2
+
+// maxWebMElementSize bounds the elements read into memory (blocks, codec IDs)
+const maxWebMElementSize = 1 << 20
+
+// webmTrack describes a track entry from the Tracks element
+type webmTrack struct {
+	number     uint64
+	trackType  uint64
+	codec      string
+	sampleRate float64
+	channels   int
+}
+
+// webmPacket is one codec packet and its presentation time
+type webmPacket struct {
+	Timestamp time.Duration
+	Data      []byte
+}
+
+// webmDemuxer reads Opus packets from the first audio track of a WebM (Matroska) stream
+// Master elements that lead to blocks are entered rather than parsed, so clusters of
+// unknown size (as written by live muxers) work too
+type webmDemuxer struct {
+	r         *bufio.Reader
+	timescale time.Duration // duration of one timecode unit
+	tracks    []webmTrack
+	audio     webmTrack
+	clusterTC int64
+	pending   []webmPacket
+}
+
+// newWebMDemuxer reads the stream headers up to the first cluster and selects the audio track
+func newWebMDemuxer(r io.Reader) (*webmDemuxer, error) {
+	d := &webmDemuxer{
+		r:         bufio.NewReader(r),
+		timescale: time.Millisecond, // Matroska default TimecodeScale of 1,000,000ns
+	}
+
+	id, size, err := d.readHeader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read EBML header: %w", err)
+	}
+	if id != ebmlIDHeader {
+		return nil, fmt.Errorf("not a WebM file")
+	}
+	if err := d.skip(size); err != nil {
+		return nil, err
+	}
+
+	for {
+		id, size, err := d.readHeader()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read WebM headers: %w", err)
+		}
+
+		if id == ebmlIDCluster {
+			break
+		}
+
+		if err := d.readHeaderElement(id, size); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, track := range d.tracks {
+		if track.trackType == matroskaAudioTrack {
+			d.audio = track
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("no audio track found")
+}
+
+// readHeaderElement handles an element that precedes the first cluster
+func (d *webmDemuxer) readHeaderElement(id uint64, size int64) error {
+	switch id {
+	case ebmlIDSegment, ebmlIDInfo, ebmlIDTracks, ebmlIDAudio:
+		// Enter the master element
+		return nil
+	case ebmlIDTrackEntry:
+		d.tracks = append(d.tracks, webmTrack{channels: 1, sampleRate: 8000})
+		return nil
+	case ebmlIDTimecodeScale:
+		v, err := d.readUint(size)
+		d.timescale = time.Duration(v)
+		return err
+	}
+
+	if len(d.tracks) == 0 {
+		return d.skip(size)
+	}
+	track := &d.tracks[len(d.tracks)-1]
+
+	var err error
+	switch id {
+	case ebmlIDTrackNumber:
+		track.number, err = d.readUint(size)
+	case ebmlIDTrackType:
+		track.trackType, err = d.readUint(size)
+	case ebmlIDCodecID:
+		var b []byte
+		b, err = d.readBytes(size)
+		track.codec = string(b)
+	case ebmlIDSamplingFrequency:
+		track.sampleRate, err = d.readFloat(size)
+	case ebmlIDChannels:
+		var v uint64
+		v, err = d.readUint(size)
+		track.channels = int(v)
+	default:
+		err = d.skip(size)
+	}
+	return err
+}
+
+// Next returns the next packet of the audio track, or io.EOF at the end of the stream
+func (d *webmDemuxer) Next() (webmPacket, error) {
+	for len(d.pending) == 0 {
+		id, size, err := d.readHeader()
+		if err != nil {
+			return webmPacket{}, err
+		}
+
+		switch id {
+		case ebmlIDCluster, ebmlIDBlockGroup:
+			// Enter the master element
+		case ebmlIDClusterTimecode:
+			tc, err := d.readUint(size)
+			if err != nil {
+				return webmPacket{}, err
+			}
+			d.clusterTC = int64(tc)
+		case ebmlIDSimpleBlock, ebmlIDBlock:
+			block, err := d.readBytes(size)
+			if err != nil {
+				return webmPacket{}, err
+			}
+			if err := d.parseBlock(block); err != nil {
+				return webmPacket{}, err
+			}
+		default:
+			if err := d.skip(size); err != nil {
+				return webmPacket{}, err
+			}
+		}
+	}
+
+	packet := d.pending[0]
+	d.pending = d.pending[1:]
+	return packet, nil
+}
+
+// parseBlock queues the frames of a (Simple)Block that belongs to the audio track
+func (d *webmDemuxer) parseBlock(block []byte) error {
+	track, n := parseVint(block)
+	if n == 0 || len(block) < n+3 {
+		return fmt.Errorf("malformed block")
+	}
+	if track != d.audio.number {
+		return nil
+	}
+
+	relative := int16(binary.BigEndian.Uint16(block[n:]))
+	lacing := (block[n+2] >> 1) & 0x03
+
+	frames, err := splitLaces(block[n+3:], lacing)
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Duration(d.clusterTC+int64(relative)) * d.timescale
+	for _, frame := range frames {
+		d.pending = append(d.pending, webmPacket{Timestamp: timestamp, Data: frame})
+		timestamp += opusPacketDuration(frame)
+	}
+	return nil
+}
+
+// splitLaces splits laced block data into frames (lacing: 0 none, 1 Xiph, 2 fixed-size, 3 EBML)
+func splitLaces(data []byte, lacing byte) ([][]byte, error) {
+	if lacing == 0 {
+		return [][]byte{data}, nil
+	}
+
+	if len(data) < 1 {
+		return nil, fmt.Errorf("malformed laced block")
+	}
+	count := int(data[0]) + 1
+	data = data[1:]
+
+	sizes := make([]int, count)
+	switch lacing {
+	case 1: // Xiph: each size is a run of 255s plus a final byte
+		for i := 0; i < count-1; i++ {
+			for {
+				if len(data) == 0 {
+					return nil, fmt.Errorf("malformed Xiph lacing")
+				}
+				b := data[0]
+				data = data[1:]
+				sizes[i] += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+	case 2: // Fixed-size
+		if len(data)%count != 0 {
+			return nil, fmt.Errorf("malformed fixed-size lacing")
+		}
+		for i := range sizes[:count-1] {
+			sizes[i] = len(data) / count
+		}
+	case 3: // EBML: first size, then signed differences
+		first, n := parseVint(data)
+		if n == 0 {
+			return nil, fmt.Errorf("malformed EBML lacing")
+		}
+		data = data[n:]
+		sizes[0] = int(first)
+		for i := 1; i < count-1; i++ {
+			raw, n := parseVint(data)
+			if n == 0 {
+				return nil, fmt.Errorf("malformed EBML lacing")
+			}
+			data = data[n:]
+			// Signed VINTs are stored with a bias of 2^(7n-1)-1
+			sizes[i] = sizes[i-1] + int(int64(raw)-(int64(1)<<(7*n-1)-1))
+		}
+	}
+
+	frames := make([][]byte, count)
+	for i := 0; i < count-1; i++ {
+		if sizes[i] < 0 || sizes[i] > len(data) {
+			return nil, fmt.Errorf("malformed laced block")
+		}
+		frames[i] = data[:sizes[i]]
+		data = data[sizes[i]:]
+	}
+	frames[count-1] = data
+	return frames, nil
+}
+
+// readHeader reads an element ID and data size; size is -1 for unknown-size elements
+func (d *webmDemuxer) readHeader() (uint64, int64, error) {
+	id, _, err := d.readVint(true)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	size, length, err := d.readVint(false)
+	if err != nil {
+		return 0, 0, noEOF(err)
+	}
+	if size == 1<<(7*length)-1 {
+		return id, -1, nil
+	}
+	return id, int64(size), nil
+}
+
+// readVint reads a variable-length integer, optionally keeping the length marker (as element IDs do)
+func (d *webmDemuxer) readVint(keepMarker bool) (uint64, int, error) {
+	first, err := d.r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	length := bits.LeadingZeros8(first) + 1
+	if length > 8 {
+		return 0, 0, fmt.Errorf("invalid EBML variable-length integer")
+	}
+
+	value := uint64(first)
+	if !keepMarker {
+		value &= 0xFF >> length
+	}
+	for i := 1; i < length; i++ {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return 0, 0, noEOF(err)
+		}
+		value = value<<8 | uint64(b)
+	}
+	return value, length, nil
+}
+
+// parseVint decodes a data-size style variable-length integer from b, returning 0 bytes read if malformed
+func parseVint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	length := bits.LeadingZeros8(b[0]) + 1
+	if length > 8 || len(b) < length {
+		return 0, 0
+	}
+	value := uint64(b[0] & (0xFF >> length))
+	for i := 1; i < length; i++ {
+		value = value<<8 | uint64(b[i])
+	}
+	return value, length
+}
+
+func (d *webmDemuxer) readBytes(size int64) ([]byte, error) {
+	if size < 0 || size > maxWebMElementSize {
+		return nil, fmt.Errorf("WebM element too large (%d bytes)", size)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return nil, noEOF(err)
+	}
+	return b, nil
+}
+
+func (d *webmDemuxer) readUint(size int64) (uint64, error) {
+	if size > 8 {
+		return 0, fmt.Errorf("invalid unsigned integer size %d", size)
+	}
+	b, err := d.readBytes(size)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+func (d *webmDemuxer) readFloat(size int64) (float64, error) {
+	b, err := d.readBytes(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	}
+	return 0, fmt.Errorf("invalid float size %d", size)
+}
+
+func (d *webmDemuxer) skip(size int64) error {
+	if size < 0 {
+		return fmt.Errorf("cannot skip WebM element of unknown size")
+	}
+	if _, err := d.r.Discard(int(size)); err != nil {
+		return noEOF(err)
+	}
+	return nil
+}
+
+// noEOF reports a stream that ends inside an element as truncated rather than finished
+func noEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// opusPacketDuration returns the audio duration of an Opus packet from its TOC byte (RFC 6716 section 3.1)
+func opusPacketDuration(packet []byte) time.Duration {
+	if len(packet) == 0 {
+		return 0
+	}
+
+	toc := packet[0]
+	config := toc >> 3
+
+	var frame time.Duration
+	switch {
+	case config < 12: // SILK: 10, 20, 40, 60ms
+		frame = []time.Duration{10, 20, 40, 60}[config%4] * time.Millisecond
+	case config < 16: // Hybrid: 10, 20ms
+		frame = []time.Duration{10, 20}[config%2] * time.Millisecond
+	default: // CELT: 2.5, 5, 10, 20ms
+		frame = []time.Duration{2500, 5000, 10000, 20000}[config%4] * time.Microsecond
+	}
+
+	switch toc & 0x03 {
+	case 0:
+		return frame
+	case 1, 2:
+		return 2 * frame
+	default:
+		if len(packet) < 2 {
+			return 0
+		}
+		return time.Duration(packet[1]&0x3F) * frame
+	}
+}
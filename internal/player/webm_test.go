@@ -0,0 +1,173 @@
+package player
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// testdata/silence.webm holds one second of 20ms stereo Opus silence in two clusters,
+// ending with a BlockGroup as FFmpeg writes it
+const fixtureWebM = "testdata/silence.webm"
+
+func TestWebMDemuxerFixture(t *testing.T) {
+	file, err := os.Open(fixtureWebM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	d, err := newWebMDemuxer(file)
+	if err != nil {
+		t.Fatalf("newWebMDemuxer: %v", err)
+	}
+
+	if d.audio.codec != "A_OPUS" || d.audio.channels != 2 || d.audio.sampleRate != 48000 {
+		t.Fatalf("unexpected audio track %+v", d.audio)
+	}
+
+	var total time.Duration
+	count := 0
+	for {
+		packet, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+
+		if packet.Timestamp != total {
+			t.Errorf("packet %d timestamp = %v, want %v", count, packet.Timestamp, total)
+		}
+		if !bytes.Equal(packet.Data, []byte{0xFC, 0xFF, 0xFE}) {
+			t.Errorf("packet %d = %x", count, packet.Data)
+		}
+
+		total += opusPacketDuration(packet.Data)
+		count++
+	}
+
+	if count != 50 || total != time.Second {
+		t.Errorf("got %d packets totalling %v, want 50 totalling 1s", count, total)
+	}
+}
+
+func TestPassthroughEncoder(t *testing.T) {
+	e, err := NewPassthroughEncoder(fixtureWebM, DefaultAudioSettings(), 500*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewPassthroughEncoder: %v", err)
+	}
+	defer e.Cleanup()
+
+	frames := 0
+	for {
+		frame, err := e.OpusFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("OpusFrame: %v", err)
+		}
+		if len(frame) != 3 {
+			t.Errorf("frame %d is %d bytes, want 3", frames, len(frame))
+		}
+		frames++
+	}
+
+	if frames != 25 {
+		t.Errorf("expected 25 frames after seeking to 500ms, got %d", frames)
+	}
+}
+
+func TestPassthroughEncoderIneligible(t *testing.T) {
+	mono := DefaultAudioSettings()
+	mono.Channels = 1
+	if _, err := NewPassthroughEncoder(fixtureWebM, mono, 0); err == nil {
+		t.Error("expected channel mismatch error")
+	}
+
+	longFrames := DefaultAudioSettings()
+	longFrames.FrameDuration = 40 * time.Millisecond
+	if _, err := NewPassthroughEncoder(fixtureWebM, longFrames, 0); err == nil {
+		t.Error("expected frame duration mismatch error")
+	}
+
+	if _, err := NewPassthroughEncoder("webm.go", DefaultAudioSettings(), 0); err == nil {
+		t.Error("expected error for a non-WebM file")
+	}
+}
+
+func TestCheckPassthroughBitrate(t *testing.T) {
+	// The fixture is 652 bytes for a second of audio, about 5 kbps
+	tests := []struct {
+		duration time.Duration
+		bitrate  int
+		ok       bool
+	}{
+		{time.Second, 8000, true},
+		{time.Second, 5000, true},
+		{time.Second, 4000, false},
+		{500 * time.Millisecond, 8000, false},
+		{0, MaxBitrate, false},
+	}
+	for _, tt := range tests {
+		err := checkPassthroughBitrate(fixtureWebM, tt.duration, tt.bitrate)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkPassthroughBitrate(%v, %d) = %v, want passthrough: %v", tt.duration, tt.bitrate, err, tt.ok)
+		}
+	}
+}
+
+func TestSplitLaces(t *testing.T) {
+	tests := []struct {
+		name   string
+		lacing byte
+		data   []byte
+		want   []int
+	}{
+		{"none", 0, []byte{1, 2, 3}, []int{3}},
+		{"xiph", 1, append([]byte{2, 255, 1, 2}, make([]byte, 256+2+4)...), []int{256, 2, 4}},
+		{"fixed", 2, append([]byte{2}, make([]byte, 9)...), []int{3, 3, 3}},
+		// sizes 5, 3 (difference -2 stored as 0x80|(63-2)), last takes the remainder
+		{"ebml", 3, append([]byte{2, 0x85, 0x80 | 61}, make([]byte, 5+3+1)...), []int{5, 3, 1}},
+	}
+
+	for _, tt := range tests {
+		frames, err := splitLaces(tt.data, tt.lacing)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(frames) != len(tt.want) {
+			t.Errorf("%s: got %d frames, want %d", tt.name, len(frames), len(tt.want))
+			continue
+		}
+		for i, frame := range frames {
+			if len(frame) != tt.want[i] {
+				t.Errorf("%s: frame %d is %d bytes, want %d", tt.name, i, len(frame), tt.want[i])
+			}
+		}
+	}
+}
+
+func TestOpusPacketDuration(t *testing.T) {
+	tests := []struct {
+		packet []byte
+		want   time.Duration
+	}{
+		{[]byte{0xFC}, 20 * time.Millisecond},             // CELT 20ms, one frame
+		{[]byte{0xF8 | 0x01}, 40 * time.Millisecond},      // CELT 20ms, two frames
+		{[]byte{0x18}, 60 * time.Millisecond},             // SILK 60ms
+		{[]byte{0x83, 0x03}, 3 * 2500 * time.Microsecond}, // CELT 2.5ms, three frames
+		{nil, 0},
+	}
+
+	for _, tt := range tests {
+		if got := opusPacketDuration(tt.packet); got != tt.want {
+			t.Errorf("opusPacketDuration(%x) = %v, want %v", tt.packet, got, tt.want)
+		}
+	}
+}
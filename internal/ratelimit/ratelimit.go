@@ -0,0 +1,95 @@
+// Package ratelimit limits how often something may happen per key, with token buckets
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Rate is how often a key may be allowed through: Burst times at once, refilling at Burst
+// per Per
+type Rate struct {
+	Burst int
+	Per   time.Duration
+}
+
+// Limiter is a token bucket per key, such as one per user
+// Buckets that have refilled are forgotten, so keys seen once don't pile up
+type Limiter struct {
+	rate Rate
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+// bucket is one key's tokens as of last
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New returns a limiter allowing each key through at rate
+func New(rate Rate) *Limiter {
+	rate.Burst = max(rate.Burst, 1)
+	return &Limiter{rate: rate, buckets: make(map[string]*bucket)}
+}
+
+// Allow takes a token from key's bucket at now, reporting whether there was one and, if
+// not, how long until there is
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.rate.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refilled(b, now)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration(math.Ceil((1 - b.tokens) / l.perNanosecond()))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// refilled returns how many tokens b holds at now
+func (l *Limiter) refilled(b *bucket, now time.Time) float64 {
+	// A clock going backwards refills nothing
+	elapsed := max(now.Sub(b.last), 0)
+	return min(b.tokens+float64(elapsed)*l.perNanosecond(), float64(l.rate.Burst))
+}
+
+// perNanosecond is how many tokens a bucket gains each nanosecond
+func (l *Limiter) perNanosecond() float64 {
+	if l.rate.Per <= 0 {
+		return float64(l.rate.Burst)
+	}
+	return float64(l.rate.Burst) / float64(l.rate.Per)
+}
+
+// prune forgets full buckets, at most once per refill period; the caller must hold l.mu
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.rate.Per {
+		return
+	}
+	l.lastPrune = now
+	for key, b := range l.buckets {
+		if l.refilled(b, now) >= float64(l.rate.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Len returns how many keys the limiter is tracking
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
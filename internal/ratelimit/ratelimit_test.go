@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiterRefill(t *testing.T) {
+	l := New(Rate{Burst: 5, Per: time.Minute})
+	start := time.Unix(1000, 0)
+
+	for n := range 5 {
+		if ok, _ := l.Allow("user", start); !ok {
+			t.Fatalf("call %d of the burst was refused", n+1)
+		}
+	}
+	ok, wait := l.Allow("user", start)
+	if ok || wait.Round(time.Millisecond) != 12*time.Second {
+		t.Fatalf("Allow after the burst = %v, %v; want refused for 12s", ok, wait)
+	}
+
+	// Other keys have their own buckets
+	if ok, _ := l.Allow("other", start); !ok {
+		t.Error("another key was refused")
+	}
+
+	// A token comes back every 12 seconds, and no faster
+	if ok, wait := l.Allow("user", start.Add(6*time.Second)); ok || wait.Round(time.Millisecond) != 6*time.Second {
+		t.Errorf("Allow halfway to a token = %v, %v; want refused for 6s", ok, wait)
+	}
+	if ok, _ := l.Allow("user", start.Add(12*time.Second)); !ok {
+		t.Error("Allow after a token refilled was refused")
+	}
+	if ok, _ := l.Allow("user", start.Add(12*time.Second)); ok {
+		t.Error("one refilled token allowed two calls")
+	}
+
+	// The bucket never holds more than the burst
+	later := start.Add(time.Hour)
+	for n := range 5 {
+		if ok, _ := l.Allow("user", later); !ok {
+			t.Fatalf("call %d after a long wait was refused", n+1)
+		}
+	}
+	if ok, _ := l.Allow("user", later); ok {
+		t.Error("a long wait allowed more than the burst")
+	}
+}
+
+func TestLimiterClockGoingBack(t *testing.T) {
+	l := New(Rate{Burst: 1, Per: time.Minute})
+	now := time.Unix(1000, 0)
+	l.Allow("user", now)
+	if ok, _ := l.Allow("user", now.Add(-time.Hour)); ok {
+		t.Error("a clock going backwards refilled the bucket")
+	}
+}
+
+func TestLimiterForgetsFullBuckets(t *testing.T) {
+	l := New(Rate{Burst: 2, Per: time.Minute})
+	now := time.Unix(1000, 0)
+	l.Allow("a", now)
+	l.Allow("b", now)
+	if l.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", l.Len())
+	}
+
+	l.Allow("c", now.Add(2*time.Minute))
+	if l.Len() != 1 {
+		t.Errorf("Len after the others refilled = %d, want 1", l.Len())
+	}
+}
+
+func TestLimiterConcurrentAccess(t *testing.T) {
+	l := New(Rate{Burst: 10, Per: time.Hour})
+	now := time.Now()
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				if ok, _ := l.Allow("user", now); ok {
+					allowed.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != 10 {
+		t.Errorf("allowed %d of 500 concurrent calls, want the burst of 10", got)
+	}
+}
@@ -0,0 +1,114 @@
+package sponsorblock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// DefaultAPIURL is the public SponsorBlock segment endpoint
+const DefaultAPIURL = "https://sponsor.ajay.app/api/skipSegments"
+
+// Segment represents a time range of a video that should be skipped
+type Segment struct {
+	Start    time.Duration
+	End      time.Duration
+	Category string
+}
+
+// apiSegment represents a segment as returned by the SponsorBlock API
+type apiSegment struct {
+	Segment    [2]float64 `json:"segment"`
+	UUID       string     `json:"UUID"`
+	Category   string     `json:"category"`
+	ActionType string     `json:"actionType"`
+}
+
+// Client handles SponsorBlock API requests
+type Client struct {
+	httpClient *http.Client
+	apiURL     string
+	categories []string
+}
+
+// NewClient creates a new SponsorBlock client
+func NewClient(categories []string, timeout time.Duration) *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: timeout},
+		apiURL:     DefaultAPIURL,
+		categories: categories,
+	}
+}
+
+// GetSegments fetches the skippable segments for a YouTube video ID
+// A video without any submitted segments returns an empty slice and no error
+func (c *Client) GetSegments(videoID string) ([]Segment, error) {
+	categories, err := json.Marshal(c.categories)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode categories: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("videoID", videoID)
+	params.Set("categories", string(categories))
+	params.Set("actionTypes", `["skip"]`)
+
+	resp, err := c.httpClient.Get(c.apiURL + "?" + params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query SponsorBlock: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// 404 means no segments have been submitted for this video
+	if resp.StatusCode == http.StatusNotFound {
+		return []Segment{}, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("SponsorBlock returned status %d", resp.StatusCode)
+	}
+
+	var results []apiSegment
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("failed to parse SponsorBlock response: %w", err)
+	}
+
+	segments := make([]Segment, 0, len(results))
+	for _, r := range results {
+		if r.ActionType != "" && r.ActionType != "skip" {
+			continue
+		}
+
+		start := time.Duration(r.Segment[0] * float64(time.Second))
+		end := time.Duration(r.Segment[1] * float64(time.Second))
+		if end <= start {
+			continue
+		}
+
+		segments = append(segments, Segment{
+			Start:    start,
+			End:      end,
+			Category: r.Category,
+		})
+	}
+
+	// Keep segments in playback order so callers can scan them linearly
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Start < segments[j].Start
+	})
+
+	return segments, nil
+}
+
+// SegmentAt returns the segment containing the given playback position, if any
+func SegmentAt(segments []Segment, position time.Duration) (Segment, bool) {
+	for _, seg := range segments {
+		if position >= seg.Start && position < seg.End {
+			return seg, true
+		}
+	}
+	return Segment{}, false
+}
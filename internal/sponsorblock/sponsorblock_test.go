@@ -0,0 +1,106 @@
+package sponsorblock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client whose requests go to handler
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client := NewClient([]string{"sponsor", "selfpromo"}, 5*time.Second)
+	client.apiURL = server.URL
+	return client
+}
+
+func TestGetSegments(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("videoID") != "dQw4w9WgXcQ" || query.Get("categories") != `["sponsor","selfpromo"]` || query.Get("actionTypes") != `["skip"]` {
+			t.Errorf("query = %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`[
+			{"segment": [90.5, 120], "UUID": "b", "category": "selfpromo", "actionType": "skip"},
+			{"segment": [10, 30.25], "UUID": "a", "category": "sponsor"},
+			{"segment": [40, 50], "UUID": "c", "category": "sponsor", "actionType": "mute"},
+			{"segment": [60, 60], "UUID": "d", "category": "sponsor", "actionType": "skip"}
+		]`))
+	})
+
+	segments, err := client.GetSegments("dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sorted, without the muted and empty segments
+	want := []Segment{
+		{Start: 10 * time.Second, End: 30250 * time.Millisecond, Category: "sponsor"},
+		{Start: 90500 * time.Millisecond, End: 120 * time.Second, Category: "selfpromo"},
+	}
+	if len(segments) != len(want) {
+		t.Fatalf("got %+v, want %+v", segments, want)
+	}
+	for idx := range want {
+		if segments[idx] != want[idx] {
+			t.Errorf("segment %d = %+v, want %+v", idx, segments[idx], want[idx])
+		}
+	}
+}
+
+func TestGetSegmentsResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr bool
+	}{
+		{"no segments submitted", http.StatusNotFound, "Not Found", false},
+		{"server error", http.StatusInternalServerError, "", true},
+		{"rate limited", http.StatusTooManyRequests, "", true},
+		{"malformed body", http.StatusOK, "{", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			segments, err := client.GetSegments("dQw4w9WgXcQ")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetSegments() error = %v, want an error: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (segments == nil || len(segments) != 0) {
+				t.Errorf("segments = %#v, want an empty slice", segments)
+			}
+		})
+	}
+}
+
+func TestSegmentAt(t *testing.T) {
+	segments := []Segment{
+		{Start: 10 * time.Second, End: 20 * time.Second, Category: "sponsor"},
+		{Start: 30 * time.Second, End: 40 * time.Second, Category: "outro"},
+	}
+	tests := []struct {
+		position time.Duration
+		want     string
+	}{
+		{0, ""},
+		{10 * time.Second, "sponsor"},
+		{19 * time.Second, "sponsor"},
+		{20 * time.Second, ""},
+		{35 * time.Second, "outro"},
+		{time.Minute, ""},
+	}
+	for _, tt := range tests {
+		seg, ok := SegmentAt(segments, tt.position)
+		if ok != (tt.want != "") || seg.Category != tt.want {
+			t.Errorf("SegmentAt(%v) = %+v, %v; want %q", tt.position, seg, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package spotify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+)
+
+// Match is the YouTube video a Spotify track was matched to
+type Match struct {
+	VideoID   string    `json:"video_id"`
+	Title     string    `json:"title"`
+	Score     int       `json:"score"` // The matcher's score, so weak matches can be retried
+	MatchedAt time.Time `json:"matched_at"`
+}
+
+// saveDelay is how long Put waits before writing the store, so matching a whole playlist
+// writes the file once rather than once per track
+const saveDelay = 5 * time.Second
+
+// MatchStore remembers Spotify track to YouTube video matches in a JSON file, so replaying
+// a playlist doesn't search YouTube again
+// Matches expire after maxAge in case a better upload appears
+type MatchStore struct {
+	path   string
+	maxAge time.Duration
+
+	mu        sync.Mutex
+	matches   map[string]Match // By Spotify track ID
+	saveTimer *time.Timer      // Pending save after a Put, nil if there is none
+}
+
+// NewMatchStore opens the store at path, creating its directory; a missing or damaged file
+// is an empty store
+func NewMatchStore(path string, maxAge time.Duration) (*MatchStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create match store directory: %w", err)
+	}
+
+	s := &MatchStore{path: path, maxAge: maxAge, matches: make(map[string]Match)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read match store: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.matches); err != nil {
+		// Matches can always be found again, so a damaged file is replaced on the next save
+		logger.Warn("Ignoring unreadable Spotify match store", "path", path, "err", err)
+		s.matches = make(map[string]Match)
+	}
+
+	// Drop expired matches so the file doesn't grow forever
+	for id, match := range s.matches {
+		if s.expired(match) {
+			delete(s.matches, id)
+		}
+	}
+	return s, nil
+}
+
+// Get returns the stored match for a Spotify track ID, if it hasn't expired
+func (s *MatchStore) Get(trackID string) (Match, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	match, ok := s.matches[trackID]
+	if !ok || s.expired(match) {
+		return Match{}, false
+	}
+	return match, true
+}
+
+// Put stores a match for a Spotify track ID; the store is saved saveDelay later, together
+// with any other matches put by then
+func (s *MatchStore) Put(trackID string, match Match) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if match.MatchedAt.IsZero() {
+		match.MatchedAt = time.Now()
+	}
+	s.matches[trackID] = match
+	if s.saveTimer == nil {
+		s.saveTimer = time.AfterFunc(saveDelay, s.saveLater)
+	}
+}
+
+// saveLater is the pending save Put schedules; failures are only logged, as the matches
+// are still in memory and the next save retries
+func (s *MatchStore) saveLater() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.saveTimer == nil {
+		return // Flush or Clear saved first
+	}
+	s.saveTimer = nil
+	if err := s.save(); err != nil {
+		logger.Warn("Failed to save Spotify matches", "err", err)
+	}
+}
+
+// Flush writes any matches put since the last save; call it before exiting
+func (s *MatchStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.saveTimer == nil {
+		return nil
+	}
+	s.saveTimer.Stop()
+	s.saveTimer = nil
+	return s.save()
+}
+
+// Clear forgets every match and returns how many there were
+func (s *MatchStore) Clear() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.saveTimer != nil {
+		s.saveTimer.Stop()
+		s.saveTimer = nil
+	}
+	n := len(s.matches)
+	s.matches = make(map[string]Match)
+	return n, s.save()
+}
+
+// expired reports whether a match is older than the store's maximum age
+func (s *MatchStore) expired(match Match) bool {
+	return s.maxAge > 0 && time.Since(match.MatchedAt) > s.maxAge
+}
+
+// save writes the store to a temporary file and renames it over the old one, so a crash
+// mid-write can't leave a truncated file; the caller must hold s.mu
+func (s *MatchStore) save() error {
+	data, err := json.Marshal(s.matches)
+	if err != nil {
+		return fmt.Errorf("failed to encode match store: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write match store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write match store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package spotify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMatchStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spotify", "matches.json")
+	store, err := NewMatchStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put("track", Match{VideoID: "dQw4w9WgXcQ", Title: "Song", Score: 75})
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("store was written before the save delay: %v", err)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewMatchStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match, ok := reopened.Get("track")
+	if !ok || match.VideoID != "dQw4w9WgXcQ" || match.Score != 75 {
+		t.Errorf("Get after reopening = %+v, %v", match, ok)
+	}
+
+	if n, err := reopened.Clear(); err != nil || n != 1 {
+		t.Errorf("Clear = %d, %v", n, err)
+	}
+	if _, ok := reopened.Get("track"); ok {
+		t.Error("match survived Clear")
+	}
+}
+
+func TestMatchStoreExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "matches.json")
+	store, err := NewMatchStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put("old", Match{VideoID: "a", MatchedAt: time.Now().Add(-2 * time.Hour)})
+	store.Put("new", Match{VideoID: "b"})
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := store.Get("old"); ok {
+		t.Error("expired match returned")
+	}
+	if _, ok := store.Get("new"); !ok {
+		t.Error("fresh match missing")
+	}
+
+	reopened, err := NewMatchStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.matches) != 1 {
+		t.Errorf("reopened store kept %d matches, want the expired one dropped", len(reopened.matches))
+	}
+}
@@ -2,7 +2,10 @@ package spotify
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"regexp"
 	"strings"
 	"time"
 
@@ -12,39 +15,86 @@ import (
 	"golang.org/x/oauth2/clientcredentials"
 )
 
+// DefaultMarket is used when no market is configured; client-credentials tokens carry no
+// country, so the market can't be taken from the token
+const DefaultMarket = "US"
+
+var marketPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// NormalizeMarket upper-cases an ISO 3166-1 alpha-2 country code and checks its shape
+func NormalizeMarket(market string) (string, error) {
+	market = strings.ToUpper(strings.TrimSpace(market))
+	if !marketPattern.MatchString(market) {
+		return "", fmt.Errorf("invalid Spotify market %q; use a two-letter country code like US or DE", market)
+	}
+	return market, nil
+}
+
 // Client handles Spotify operations
 type Client struct {
 	client *spotify.Client
 	ctx    context.Context
+	market string // default market for lookups
 }
 
-// NewClient creates a new Spotify client
-func NewClient(clientID, clientSecret string) (*Client, error) {
-	ctx := context.Background()
-
-	config := &clientcredentials.Config{
+// NewClient creates a new Spotify client looking up catalog data in market
+// Access tokens are renewed as they expire; the credentials are checked up front
+func NewClient(clientID, clientSecret, market string) (*Client, error) {
+	return newClient(&clientcredentials.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
 		TokenURL:     spotifyauth.TokenURL,
-	}
+	}, market)
+}
 
-	token, err := config.Token(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get Spotify token: %w", err)
+// CheckCredentials fetches an access token to confirm Spotify accepts the client ID and
+// secret; it returns ErrInvalidCredentials if they are rejected
+func CheckCredentials(ctx context.Context, clientID, clientSecret string) error {
+	transport := &tokenTransport{
+		config: &clientcredentials.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			TokenURL:     spotifyauth.TokenURL,
+		},
+		base: http.DefaultTransport,
 	}
+	_, err := transport.currentToken(ctx, nil)
+	return err
+}
 
-	httpClient := spotifyauth.New().Client(ctx, token)
-	client := spotify.New(httpClient)
+// newClient creates a client authorizing through config, with options for the API client
+func newClient(config *clientcredentials.Config, market string, opts ...spotify.ClientOption) (*Client, error) {
+	ctx := context.Background()
+
+	// Only bad credentials are fatal; other failures are retried on the first request
+	transport := &tokenTransport{config: config, base: http.DefaultTransport}
+	if _, err := transport.currentToken(ctx, nil); errors.Is(err, ErrInvalidCredentials) {
+		return nil, err
+	}
 
 	return &Client{
-		client: client,
+		client: spotify.New(&http.Client{Transport: transport}, opts...),
 		ctx:    ctx,
+		market: market,
 	}, nil
 }
 
-// GetTrackInfo gets information about a Spotify track
-func (c *Client) GetTrackInfo(trackID string) (*player.Track, error) {
-	track, err := c.client.GetTrack(c.ctx, spotify.ID(trackID))
+// marketOr returns market, or the client's default market if it's empty
+// Tracks unplayable in the market are still returned; only their metadata is used to find
+// them on YouTube
+func (c *Client) marketOr(market string) string {
+	if market != "" {
+		return market
+	}
+	if c.market != "" {
+		return c.market
+	}
+	return DefaultMarket
+}
+
+// GetTrackInfo gets information about a Spotify track as listed in market ("" for the default)
+func (c *Client) GetTrackInfo(trackID, market string) (*player.Track, error) {
+	track, err := c.client.GetTrack(c.ctx, spotify.ID(trackID), spotify.Market(c.marketOr(market)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get track info: %w", err)
 	}
@@ -64,9 +114,12 @@ func (c *Client) GetTrackInfo(trackID string) (*player.Track, error) {
 	}, nil
 }
 
-// GetPlaylistTracks gets all tracks from a Spotify playlist
-func (c *Client) GetPlaylistTracks(playlistID string) ([]*player.Track, error) {
+// GetPlaylistTracks gets all tracks from a Spotify playlist as listed in market ("" for the default)
+// The names of entries that can't be queued, like podcast episodes and tracks removed from
+// the market, are returned alongside
+func (c *Client) GetPlaylistTracks(playlistID, market string) ([]*player.Track, []string, error) {
 	tracks := make([]*player.Track, 0)
+	missing := make([]string, 0)
 
 	offset := 0
 	limit := 100
@@ -77,13 +130,19 @@ func (c *Client) GetPlaylistTracks(playlistID string) ([]*player.Track, error) {
 			spotify.ID(playlistID),
 			spotify.Limit(limit),
 			spotify.Offset(offset),
+			spotify.Market(c.marketOr(market)),
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get playlist tracks: %w", err)
+			return nil, nil, fmt.Errorf("failed to get playlist tracks: %w", err)
 		}
 
-		for _, item := range page.Items {
+		for idx, item := range page.Items {
 			if item.Track.Track == nil {
+				if item.Track.Episode != nil {
+					missing = append(missing, fmt.Sprintf("%s (podcast episode)", item.Track.Episode.Name))
+				} else {
+					missing = append(missing, fmt.Sprintf("#%d (unavailable in %s)", offset+idx+1, c.marketOr(market)))
+				}
 				continue
 			}
 
@@ -110,40 +169,57 @@ func (c *Client) GetPlaylistTracks(playlistID string) ([]*player.Track, error) {
 		offset += limit
 	}
 
-	return tracks, nil
+	return tracks, missing, nil
 }
 
-// GetAlbumTracks gets all tracks from a Spotify album
-func (c *Client) GetAlbumTracks(albumID string) ([]*player.Track, error) {
-	album, err := c.client.GetAlbum(c.ctx, spotify.ID(albumID))
-	if err != nil {
-		return nil, fmt.Errorf("failed to get album: %w", err)
-	}
-
+// GetAlbumTracks gets all tracks from a Spotify album as listed in market ("" for the default)
+func (c *Client) GetAlbumTracks(albumID, market string) ([]*player.Track, error) {
 	tracks := make([]*player.Track, 0)
 
-	for _, track := range album.Tracks.Tracks {
-		artists := make([]string, len(track.Artists))
-		for i, artist := range track.Artists {
-			artists[i] = artist.Name
+	offset := 0
+	limit := 50
+
+	for {
+		page, err := c.client.GetAlbumTracks(
+			c.ctx,
+			spotify.ID(albumID),
+			spotify.Limit(limit),
+			spotify.Offset(offset),
+			spotify.Market(c.marketOr(market)),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get album: %w", err)
 		}
 
-		tracks = append(tracks, &player.Track{
-			ID:       track.ID.String(),
-			Title:    track.Name,
-			Artist:   strings.Join(artists, ", "),
-			Duration: time.Duration(track.Duration) * time.Millisecond,
-			Source:   player.SourceSpotify,
-			URL:      track.ExternalURLs["spotify"],
-		})
+		for _, track := range page.Tracks {
+			artists := make([]string, len(track.Artists))
+			for i, artist := range track.Artists {
+				artists[i] = artist.Name
+			}
+
+			tracks = append(tracks, &player.Track{
+				ID:       track.ID.String(),
+				Title:    track.Name,
+				Artist:   strings.Join(artists, ", "),
+				Duration: time.Duration(track.Duration) * time.Millisecond,
+				Source:   player.SourceSpotify,
+				URL:      track.ExternalURLs["spotify"],
+			})
+		}
+
+		if len(page.Tracks) < limit {
+			break
+		}
+
+		offset += limit
 	}
 
 	return tracks, nil
 }
 
-// GetArtistTopTracks gets an artist's top tracks
-func (c *Client) GetArtistTopTracks(artistID string) ([]*player.Track, error) {
-	topTracks, err := c.client.GetArtistsTopTracks(c.ctx, spotify.ID(artistID), "US")
+// GetArtistTopTracks gets an artist's top tracks in market ("" for the default)
+func (c *Client) GetArtistTopTracks(artistID, market string) ([]*player.Track, error) {
+	topTracks, err := c.client.GetArtistsTopTracks(c.ctx, spotify.ID(artistID), c.marketOr(market))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get artist top tracks: %w", err)
 	}
@@ -171,7 +247,7 @@ func (c *Client) GetArtistTopTracks(artistID string) ([]*player.Track, error) {
 
 // SearchTrack searches for a track on Spotify
 func (c *Client) SearchTrack(query string) (*player.Track, error) {
-	result, err := c.client.Search(c.ctx, query, spotify.SearchTypeTrack, spotify.Limit(1))
+	result, err := c.client.Search(c.ctx, query, spotify.SearchTypeTrack, spotify.Limit(1), spotify.Market(c.marketOr("")))
 	if err != nil {
 		return nil, fmt.Errorf("failed to search: %w", err)
 	}
@@ -195,27 +271,3 @@ func (c *Client) SearchTrack(query string) (*player.Track, error) {
 		URL:      track.ExternalURLs["spotify"],
 	}, nil
 }
-
-// ParseSpotifyURL parses a Spotify URL and returns the type and ID
-func ParseSpotifyURL(url string) (string, string, error) {
-	// Format: https://open.spotify.com/{type}/{id}
-	parts := strings.Split(url, "/")
-	if len(parts) < 5 {
-		return "", "", fmt.Errorf("invalid Spotify URL")
-	}
-
-	spotifyType := parts[3] // track, playlist, album, artist
-	id := parts[4]
-
-	// Remove query parameters if present
-	if idx := strings.Index(id, "?"); idx != -1 {
-		id = id[:idx]
-	}
-
-	return spotifyType, id, nil
-}
-
-// IsSpotifyURL checks if a URL is a Spotify URL
-func IsSpotifyURL(url string) bool {
-	return strings.Contains(url, "spotify.com") || strings.HasPrefix(url, "spotify:")
-}
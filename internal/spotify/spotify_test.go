@@ -0,0 +1,56 @@
+package spotify
+
+import "testing"
+
+func TestMarketSentWithLookups(t *testing.T) {
+	fake := newFakeSpotify(t, 3600)
+	c, err := fake.client(t, "id", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct{ market, want string }{
+		{market: "", want: "US"},
+		{market: "DE", want: "DE"},
+	} {
+		if _, err := c.GetTrackInfo("abc", tt.market); err != nil {
+			t.Fatal(err)
+		}
+		if got := fake.market.Load(); got != tt.want {
+			t.Errorf("GetTrackInfo with market %q sent market=%v, want %s", tt.market, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeMarket(t *testing.T) {
+	for raw, want := range map[string]string{"de": "DE", " US ": "US", "pt": "PT"} {
+		if got, err := NormalizeMarket(raw); err != nil || got != want {
+			t.Errorf("NormalizeMarket(%q) = %q, %v; want %q", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"", "USA", "u1", "from_token"} {
+		if _, err := NormalizeMarket(raw); err == nil {
+			t.Errorf("NormalizeMarket(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestPlaylistReportsMissingEntries(t *testing.T) {
+	fake := newFakeSpotify(t, 3600)
+	c, err := fake.client(t, "id", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracks, missing, err := c.GetPlaylistTracks("playlist", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 1 || tracks[0].Title != "Song" {
+		t.Errorf("tracks = %+v, want only Song", tracks)
+	}
+	want := []string{"Some Podcast (podcast episode)", "#3 (unavailable in US)"}
+	if len(missing) != len(want) || missing[0] != want[0] || missing[1] != want[1] {
+		t.Errorf("missing = %q, want %q", missing, want)
+	}
+}
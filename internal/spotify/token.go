@@ -0,0 +1,90 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// ErrInvalidCredentials is returned when Spotify rejects the client ID or secret
+var ErrInvalidCredentials = errors.New("Spotify rejected the client credentials; check SPOTIFY_CLIENT_ID and SPOTIFY_CLIENT_SECRET")
+
+// tokenTransport authorizes requests with a client-credentials token, fetching a new one
+// when it expires or when Spotify rejects it with a 401
+type tokenTransport struct {
+	config *clientcredentials.Config
+	base   http.RoundTripper
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// RoundTrip sends req with the current token, retrying once with a fresh token on a 401
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.currentToken(req.Context(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.send(req, token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// The token was revoked or expired early; a request whose body can't be replayed
+	// returns the 401 as-is
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	logger.Debug("Spotify rejected the access token, fetching a new one")
+	if token, err = t.currentToken(req.Context(), token); err != nil {
+		return nil, err
+	}
+	if req.GetBody != nil {
+		if req.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.send(req, token)
+}
+
+// send clones req with token's Authorization header, since RoundTrippers mustn't modify requests
+func (t *tokenTransport) send(req *http.Request, token *oauth2.Token) (*http.Response, error) {
+	authorized := req.Clone(req.Context())
+	token.SetAuthHeader(authorized)
+	return t.base.RoundTrip(authorized)
+}
+
+// currentToken returns a valid token, fetching a new one if the cached token has expired
+// or is rejected, which is the token a request was refused with (nil if none)
+func (t *tokenTransport) currentToken(ctx context.Context, rejected *oauth2.Token) (*oauth2.Token, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Another request may already have replaced the rejected token
+	if t.token.Valid() && (rejected == nil || t.token.AccessToken != rejected.AccessToken) {
+		return t.token, nil
+	}
+
+	token, err := t.config.Token(ctx)
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) && (retrieveErr.Response.StatusCode == http.StatusBadRequest || retrieveErr.Response.StatusCode == http.StatusUnauthorized) {
+			logger.Error("Spotify rejected the client credentials", "status", retrieveErr.Response.Status)
+			return nil, ErrInvalidCredentials
+		}
+		logger.Warn("Failed to refresh Spotify token, will retry on the next request", "err", err)
+		return nil, fmt.Errorf("failed to get Spotify token: %w", err)
+	}
+
+	t.token = token
+	return token, nil
+}
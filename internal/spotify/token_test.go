@@ -0,0 +1,113 @@
+package spotify
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zmb3/spotify/v2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// fakeSpotify serves a token endpoint, a track endpoint that only accepts the newest token
+// and records the requested market, and a playlist with entries that can't be queued
+type fakeSpotify struct {
+	server    *httptest.Server
+	issued    atomic.Int32
+	expiresIn int // token lifetime in seconds
+	revoked   atomic.Bool
+	market    atomic.Value // market query parameter of the last API request
+}
+
+func newFakeSpotify(t *testing.T, expiresIn int) *fakeSpotify {
+	f := &fakeSpotify{expiresIn: expiresIn}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "id" || secret != "secret" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_client"}`)
+			return
+		}
+		n := f.issued.Add(1)
+		f.revoked.Store(false)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%d}`, n, f.expiresIn)
+	})
+	mux.HandleFunc("/api/tracks/", func(w http.ResponseWriter, r *http.Request) {
+		f.market.Store(r.URL.Query().Get("market"))
+		want := fmt.Sprintf("Bearer token-%d", f.issued.Load())
+		if r.Header.Get("Authorization") != want || f.revoked.Load() {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":{"status":401,"message":"The access token expired"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":"abc","name":"Song","artists":[{"name":"Artist"}],"duration_ms":1000}`)
+	})
+	mux.HandleFunc("/api/playlists/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"items":[
+			{"track":{"type":"track","id":"abc","name":"Song","artists":[{"name":"Artist"}],"duration_ms":1000}},
+			{"track":{"type":"episode","id":"ep","name":"Some Podcast"}},
+			{"track":null}
+		]}`)
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeSpotify) client(t *testing.T, id, secret string) (*Client, error) {
+	t.Helper()
+	return newClient(&clientcredentials.Config{
+		ClientID:     id,
+		ClientSecret: secret,
+		TokenURL:     f.server.URL + "/token",
+	}, "US", spotify.WithBaseURL(f.server.URL+"/api/"))
+}
+
+func TestTokenRefreshedAfterExpiry(t *testing.T) {
+	// oauth2 treats tokens as expired 10 seconds early, so an 11-second token is stale after 1
+	fake := newFakeSpotify(t, 11)
+	c, err := fake.client(t, "id", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.GetTrackInfo("abc", ""); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := c.GetTrackInfo("abc", ""); err != nil {
+		t.Fatalf("request after expiry: %v", err)
+	}
+	if n := fake.issued.Load(); n != 2 {
+		t.Errorf("issued %d tokens, want 2", n)
+	}
+}
+
+func TestTokenRefreshedOnUnauthorized(t *testing.T) {
+	fake := newFakeSpotify(t, 3600)
+	c, err := fake.client(t, "id", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.revoked.Store(true)
+	if _, err := c.GetTrackInfo("abc", ""); err != nil {
+		t.Fatalf("request with a revoked token: %v", err)
+	}
+	if n := fake.issued.Load(); n != 2 {
+		t.Errorf("issued %d tokens, want 2", n)
+	}
+}
+
+func TestInvalidCredentials(t *testing.T) {
+	fake := newFakeSpotify(t, 3600)
+	if _, err := fake.client(t, "id", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("newClient = %v, want ErrInvalidCredentials", err)
+	}
+}
@@ -0,0 +1,130 @@
+package spotify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// webHost serves the canonical links that ParseSpotifyURL understands
+	webHost = "open.spotify.com"
+	// shortLinkHost serves share links that redirect to webHost
+	shortLinkHost = "spotify.link"
+	// shortLinkTimeout bounds the request that expands a short link
+	shortLinkTimeout = 5 * time.Second
+)
+
+// shortLinkClient expands short links; tests swap its transport
+var shortLinkClient = &http.Client{Timeout: shortLinkTimeout}
+
+var (
+	idPattern   = regexp.MustCompile(`^[A-Za-z0-9]{22}$`)
+	intlSegment = regexp.MustCompile(`^intl-[A-Za-z]{2}(-[A-Za-z]{2})?$`)
+)
+
+// linkTypes are the kinds of Spotify links that can be queued
+var linkTypes = map[string]bool{"track": true, "playlist": true, "album": true, "artist": true}
+
+// ParseSpotifyURL parses a Spotify link and returns its type (track, playlist, album or
+// artist) and ID
+// Accepts open.spotify.com links (including intl-xx regional paths and legacy user
+// playlists), spotify: URIs, and spotify.link short links, which are expanded with one request
+func ParseSpotifyURL(raw string) (string, string, error) {
+	raw = strings.TrimSpace(raw)
+
+	if rest, ok := strings.CutPrefix(raw, "spotify:"); ok {
+		return parseSegments(strings.Split(rest, ":"))
+	}
+
+	u, err := parseWebURL(raw)
+	if err != nil {
+		return "", "", err
+	}
+
+	if u.Hostname() == shortLinkHost {
+		if u, err = expandShortLink(u.String()); err != nil {
+			return "", "", err
+		}
+	}
+
+	return parseSegments(strings.Split(strings.Trim(u.Path, "/"), "/"))
+}
+
+// IsSpotifyURL checks if a URL is a Spotify URL
+func IsSpotifyURL(raw string) bool {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "spotify:") {
+		return true
+	}
+	_, err := parseWebURL(raw)
+	return err == nil
+}
+
+// parseWebURL parses an http(s) link on a Spotify host; the scheme may be left out
+func parseWebURL(raw string) (*neturl.URL, error) {
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	u, err := neturl.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.User != nil {
+		return nil, fmt.Errorf("invalid Spotify URL")
+	}
+	u.Host = strings.ToLower(u.Host)
+	switch u.Hostname() {
+	case webHost, "play.spotify.com", shortLinkHost:
+		return u, nil
+	}
+	return nil, fmt.Errorf("invalid Spotify URL")
+}
+
+// parseSegments extracts the type and ID from link path segments or URI parts,
+// skipping regional prefixes and the user part of legacy playlist links
+func parseSegments(segments []string) (string, string, error) {
+	if len(segments) > 0 && intlSegment.MatchString(segments[0]) {
+		segments = segments[1:]
+	}
+	if len(segments) == 4 && segments[0] == "user" {
+		segments = segments[2:]
+	}
+	if len(segments) != 2 {
+		return "", "", fmt.Errorf("invalid Spotify URL")
+	}
+
+	linkType, id := segments[0], segments[1]
+	if !linkTypes[linkType] {
+		return "", "", fmt.Errorf("unsupported Spotify link type %q", linkType)
+	}
+	if !idPattern.MatchString(id) {
+		return "", "", fmt.Errorf("invalid Spotify ID %q", id)
+	}
+	return linkType, id, nil
+}
+
+// expandShortLink follows a short link's redirects to the open.spotify.com link it points at
+func expandShortLink(link string) (*neturl.URL, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shortLinkTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, link, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Spotify short link: %w", err)
+	}
+	resp, err := shortLinkClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand Spotify short link: %w", err)
+	}
+	resp.Body.Close()
+
+	// The client follows redirects, so the final request is the one that was answered
+	target := resp.Request.URL
+	if strings.ToLower(target.Hostname()) != webHost {
+		return nil, fmt.Errorf("Spotify short link didn't lead to a Spotify page")
+	}
+	return target, nil
+}
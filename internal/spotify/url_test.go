@@ -0,0 +1,98 @@
+package spotify
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseSpotifyURL(t *testing.T) {
+	const id = "4uLU6hMCjMI75M1A2tKUQC"
+
+	tests := []struct {
+		name     string
+		raw      string
+		wantType string
+		wantErr  bool
+	}{
+		{name: "track", raw: "https://open.spotify.com/track/" + id, wantType: "track"},
+		{name: "share junk", raw: "https://open.spotify.com/track/" + id + "?si=a1b2c3d4e5f6&context=spotify", wantType: "track"},
+		{name: "trailing slash", raw: "https://open.spotify.com/album/" + id + "/", wantType: "album"},
+		{name: "no scheme", raw: "open.spotify.com/playlist/" + id, wantType: "playlist"},
+		{name: "uppercase host", raw: "https://OPEN.Spotify.com/artist/" + id, wantType: "artist"},
+		{name: "regional", raw: "https://open.spotify.com/intl-de/track/" + id + "?si=x", wantType: "track"},
+		{name: "regional with country", raw: "https://open.spotify.com/intl-pt-br/album/" + id, wantType: "album"},
+		{name: "legacy user playlist", raw: "https://open.spotify.com/user/someone/playlist/" + id, wantType: "playlist"},
+		{name: "play host", raw: "https://play.spotify.com/track/" + id, wantType: "track"},
+		{name: "track URI", raw: "spotify:track:" + id, wantType: "track"},
+		{name: "playlist URI", raw: "spotify:playlist:" + id, wantType: "playlist"},
+		{name: "legacy user playlist URI", raw: "spotify:user:someone:playlist:" + id, wantType: "playlist"},
+		{name: "podcast", raw: "https://open.spotify.com/show/" + id, wantErr: true},
+		{name: "short ID", raw: "https://open.spotify.com/track/abc", wantErr: true},
+		{name: "bad ID charset", raw: "https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKU-C", wantErr: true},
+		{name: "no ID", raw: "https://open.spotify.com/track", wantErr: true},
+		{name: "other host", raw: "https://evil.example/track/" + id, wantErr: true},
+		{name: "look-alike host", raw: "https://open.spotify.com.evil.example/track/" + id, wantErr: true},
+		{name: "bad URI", raw: "spotify:track", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			linkType, gotID, err := ParseSpotifyURL(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseSpotifyURL(%q) = %q, %q; want an error", tt.raw, linkType, gotID)
+				}
+				return
+			}
+			if err != nil || linkType != tt.wantType || gotID != id {
+				t.Errorf("ParseSpotifyURL(%q) = %q, %q, %v; want %q, %q", tt.raw, linkType, gotID, err, tt.wantType, id)
+			}
+		})
+	}
+}
+
+// redirectTransport answers short link requests with a redirect to target
+type redirectTransport struct {
+	target string
+}
+
+func (r redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == shortLinkHost {
+		return &http.Response{
+			StatusCode: http.StatusTemporaryRedirect,
+			Header:     http.Header{"Location": {r.target}},
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestParseSpotifyShortLink(t *testing.T) {
+	defer func(transport http.RoundTripper) { shortLinkClient.Transport = transport }(shortLinkClient.Transport)
+
+	shortLinkClient.Transport = redirectTransport{target: "https://open.spotify.com/intl-fr/track/4uLU6hMCjMI75M1A2tKUQC?si=abc"}
+	linkType, id, err := ParseSpotifyURL("https://spotify.link/AbCdEfGh")
+	if err != nil || linkType != "track" || id != "4uLU6hMCjMI75M1A2tKUQC" {
+		t.Errorf("ParseSpotifyURL = %q, %q, %v", linkType, id, err)
+	}
+
+	shortLinkClient.Transport = redirectTransport{target: "https://evil.example/track/4uLU6hMCjMI75M1A2tKUQC"}
+	if _, _, err := ParseSpotifyURL("https://spotify.link/AbCdEfGh"); err == nil || !strings.Contains(err.Error(), "short link") {
+		t.Errorf("ParseSpotifyURL of a link leaving Spotify = %v", err)
+	}
+}
+
+func TestIsSpotifyURL(t *testing.T) {
+	for _, raw := range []string{"spotify:track:4uLU6hMCjMI75M1A2tKUQC", "https://open.spotify.com/track/x", "spotify.link/abc", "https://open.spotify.com/intl-de/album/x"} {
+		if !IsSpotifyURL(raw) {
+			t.Errorf("IsSpotifyURL(%q) = false", raw)
+		}
+	}
+	for _, raw := range []string{"https://evil.example/?x=spotify.com", "never gonna give you up", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"} {
+		if IsSpotifyURL(raw) {
+			t.Errorf("IsSpotifyURL(%q) = true", raw)
+		}
+	}
+}
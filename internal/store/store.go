@@ -0,0 +1,113 @@
+// Package store keeps small per-guild or per-user settings in JSON files
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+)
+
+// Store remembers one setting per guild or user in a JSON file, so it survives restarts
+type Store[T any] struct {
+	path string
+
+	mu     sync.Mutex
+	values map[string]T // By guild or user ID
+}
+
+// Open opens the store at path, creating its directory; a missing file is an empty store
+func Open[T any](path string) (*Store[T], error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	s := &Store[T]{path: path, values: make(map[string]T)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	if err := json.Unmarshal(data, &s.values); err != nil {
+		logger.Warn("Ignoring unreadable store", "path", path, "err", err)
+		s.values = make(map[string]T)
+	}
+	return s, nil
+}
+
+// Get returns the value for an ID, if there is one
+func (s *Store[T]) Get(id string) (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.values[id]
+	return value, ok
+}
+
+// Set stores the value for an ID and saves the store
+func (s *Store[T]) Set(id string, value T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[id] = value
+	return s.save()
+}
+
+// Clear forgets the value for an ID and saves the store
+func (s *Store[T]) Clear(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.values, id)
+	return s.save()
+}
+
+// Update replaces the value for an ID with the one update returns and saves the store; update
+// gets the current value, if there is one, and nothing changes if it fails
+func (s *Store[T]) Update(id string, update func(value T, ok bool) (T, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.values[id]
+	value, err := update(current, ok)
+	if err != nil {
+		return err
+	}
+	s.values[id] = value
+	return s.save()
+}
+
+// All returns a copy of every stored value, by ID
+func (s *Store[T]) All() map[string]T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return maps.Clone(s.values)
+}
+
+// save writes the store to a temporary file and renames it over the old one; the caller
+// must hold s.mu
+func (s *Store[T]) save() error {
+	data, err := json.Marshal(s.values)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", filepath.Base(s.path), err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(s.path), err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(s.path), err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guilds", "audit.json")
+	store, err := Open[string](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("1", "10"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("2", "20"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Clear("2"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open[string](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channelID, ok := reopened.Get("1"); !ok || channelID != "10" {
+		t.Errorf("Get(1) = %q, %v, want 10", channelID, ok)
+	}
+	if _, ok := reopened.Get("2"); ok {
+		t.Error("Get(2) found a cleared value")
+	}
+}
+
+func TestStoreUpdate(t *testing.T) {
+	store, err := Open[[]string](filepath.Join(t.TempDir(), "users", "favorites.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendValue := func(value string) func([]string, bool) ([]string, error) {
+		return func(values []string, _ bool) ([]string, error) {
+			return append(values, value), nil
+		}
+	}
+	if err := store.Update("1", appendValue("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Update("1", appendValue("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("refused")
+	if err := store.Update("1", func([]string, bool) ([]string, error) { return nil, failure }); err != failure {
+		t.Errorf("Update = %v, want the update's error", err)
+	}
+	if values, _ := store.Get("1"); len(values) != 2 || values[0] != "a" || values[1] != "b" {
+		t.Errorf("Get(1) = %v, want [a b]", values)
+	}
+}
@@ -0,0 +1,73 @@
+package tools
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultYtDlpConcurrency is how many yt-dlp processes may extract at once unless configured
+const DefaultYtDlpConcurrency = 3
+
+// ytDlpSlots limits the yt-dlp processes extracting at once, across every package that runs
+// yt-dlp; processes that go on to transfer audio give their slot up once extraction is done
+var ytDlpSlots atomic.Pointer[limiter]
+
+func init() {
+	ytDlpSlots.Store(newLimiter(DefaultYtDlpConcurrency))
+}
+
+// SetYtDlpConcurrency sets how many yt-dlp processes may extract at once
+// Processes already running finish under the old limit, so for a moment both limits'
+// processes may run
+func SetYtDlpConcurrency(n int) {
+	ytDlpSlots.Store(newLimiter(max(n, 1)))
+}
+
+// AcquireYtDlp waits for a yt-dlp slot, giving up when ctx ends
+// The returned release gives the slot back; it may be called more than once, so a process
+// can release it early and defer it too
+func AcquireYtDlp(ctx context.Context) (release func(), err error) {
+	l := ytDlpSlots.Load()
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func() { once.Do(l.release) }, nil
+}
+
+// YtDlpStats returns how many yt-dlp processes hold a slot, how many wait for one, and the limit
+func YtDlpStats() (running, waiting, limit int) {
+	l := ytDlpSlots.Load()
+	return int(l.running.Load()), int(l.waiting.Load()), cap(l.sem)
+}
+
+// limiter is a semaphore that gives up waiting when the caller's context ends
+type limiter struct {
+	sem     chan struct{}
+	running atomic.Int32
+	waiting atomic.Int32
+}
+
+func newLimiter(n int) *limiter {
+	return &limiter{sem: make(chan struct{}, n)}
+}
+
+// acquire waits for a free slot; the caller must release it unless an error is returned
+func (l *limiter) acquire(ctx context.Context) error {
+	l.waiting.Add(1)
+	defer l.waiting.Add(-1)
+
+	select {
+	case l.sem <- struct{}{}:
+		l.running.Add(1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *limiter) release() {
+	l.running.Add(-1)
+	<-l.sem
+}
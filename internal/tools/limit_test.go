@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiterCancelledWaitGivesUpSlot(t *testing.T) {
+	l := newLimiter(1)
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire on a full limiter = %v, want deadline exceeded", err)
+	}
+	if l.waiting.Load() != 0 {
+		t.Errorf("waiting = %d after the wait was abandoned", l.waiting.Load())
+	}
+
+	l.release()
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire after release = %v", err)
+	}
+}
+
+func TestAcquireYtDlpReleasesOnce(t *testing.T) {
+	defer ytDlpSlots.Store(ytDlpSlots.Load())
+	SetYtDlpConcurrency(2)
+
+	first, err := AcquireYtDlp(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := AcquireYtDlp(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Releasing early and again when done frees the slot only once
+	first()
+	first()
+	if running, _, _ := YtDlpStats(); running != 1 {
+		t.Errorf("running = %d after one process released its slot twice, want 1", running)
+	}
+	second()
+}
@@ -0,0 +1,149 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+)
+
+// Proxies routes yt-dlp and FFmpeg network traffic; nil means connect directly
+var Proxies *ProxyPool
+
+const (
+	// maxProxyFailures is how many failures in a row take a proxy out of rotation
+	maxProxyFailures = 3
+	// proxyCooldown is how long a failing proxy stays out of rotation
+	proxyCooldown = 5 * time.Minute
+)
+
+// ProxyPool hands out proxies round-robin, skipping ones that keep failing
+type ProxyPool struct {
+	mu      sync.Mutex
+	proxies []*proxyState
+	next    int
+	now     func() time.Time
+}
+
+// proxyState tracks the recent failures of one proxy
+type proxyState struct {
+	url       string
+	failures  int
+	skipUntil time.Time
+}
+
+// NewProxyPool creates a pool over the given proxy URLs, or returns nil if there are none
+func NewProxyPool(urls []string) *ProxyPool {
+	if len(urls) == 0 {
+		return nil
+	}
+
+	pool := &ProxyPool{now: time.Now}
+	for _, u := range urls {
+		pool.proxies = append(pool.proxies, &proxyState{url: u})
+	}
+	return pool
+}
+
+// Next returns the proxy for the next request, or "" to connect directly
+// Proxies cooling down after repeated failures are skipped unless every proxy is
+// cooling down, in which case the one that recovers soonest is used
+func (p *ProxyPool) Next() string {
+	if p == nil {
+		return ""
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	var soonest *proxyState
+	for range p.proxies {
+		proxy := p.proxies[p.next]
+		p.next = (p.next + 1) % len(p.proxies)
+
+		if !now.Before(proxy.skipUntil) {
+			logger.Debug("Using proxy", "proxy", RedactProxy(proxy.url))
+			return proxy.url
+		}
+		if soonest == nil || proxy.skipUntil.Before(soonest.skipUntil) {
+			soonest = proxy
+		}
+	}
+
+	logger.Debug("All proxies are cooling down, using the next to recover", "proxy", RedactProxy(soonest.url))
+	return soonest.url
+}
+
+// Report records the outcome of a request made through proxy, with err classified by YtDlpError
+// Only failures the proxy may be behind count against it: see proxyFault
+func (p *ProxyPool) Report(proxy string, err error) {
+	if p == nil || proxy == "" || (err != nil && !proxyFault(err)) {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, state := range p.proxies {
+		if state.url != proxy {
+			continue
+		}
+
+		if err == nil {
+			state.failures = 0
+			return
+		}
+
+		state.failures++
+		if state.failures >= maxProxyFailures {
+			state.failures = 0
+			state.skipUntil = p.now().Add(proxyCooldown)
+			logger.Warn("Proxy failed repeatedly, skipping it", "proxy", RedactProxy(proxy), "cooldown", proxyCooldown, "err", err)
+		}
+		return
+	}
+}
+
+// ReportRun records the outcome of a yt-dlp run through proxy, classifying a failure by its
+// stderr (nil for the output kept in an *exec.ExitError); a run that ended with ctx counts as
+// ctx's error
+func (p *ProxyPool) ReportRun(ctx context.Context, proxy string, err error, stderr []byte) {
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		} else {
+			err = YtDlpError(err, stderr)
+		}
+	}
+	p.Report(proxy, err)
+}
+
+// proxyFault reports whether a failure may be the proxy's doing: a network error, a timeout or
+// YouTube refusing or rate limiting its address. Content errors such as an unavailable or
+// age-restricted video, and requests cancelled by the caller, say nothing about the proxy
+func proxyFault(err error) bool {
+	return errors.Is(err, ErrNetwork) || errors.Is(err, ErrRateLimited) || errors.Is(err, ErrBotCheck) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// IsHTTPProxy reports whether proxy can be used by FFmpeg, which only supports HTTP proxies
+func IsHTTPProxy(proxy string) bool {
+	u, err := url.Parse(proxy)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// RedactProxy hides the credentials in a proxy URL for logging
+func RedactProxy(proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return "invalid proxy URL"
+	}
+	if u.User != nil {
+		u.User = url.User("redacted")
+	}
+	return u.String()
+}
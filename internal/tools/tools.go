@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Paths and arguments for external binaries; set once at startup before any command runs
+var (
+	FFmpeg         = "ffmpeg"
+	FFprobe        = "ffprobe" // optional; reads tags and durations of direct links
+	YtDlp          = "yt-dlp"
+	YtDlpExtraArgs []string
+
+	// YtDlpCookiesFile is passed to yt-dlp with --cookies when set
+	YtDlpCookiesFile string
+)
+
+// versionTimeout bounds each version check at startup
+const versionTimeout = 10 * time.Second
+
+// YtDlpArgs returns the arguments for a yt-dlp invocation on target through proxy ("" for
+// none), with the cookies file and YtDlpExtraArgs placed after the given options so they
+// can override them
+// The target follows "--" so user input starting with a dash is never read as an option
+func YtDlpArgs(proxy, target string, args ...string) []string {
+	out := make([]string, 0, len(args)+len(YtDlpExtraArgs)+6)
+	out = append(out, args...)
+	if proxy != "" {
+		out = append(out, "--proxy", proxy)
+	}
+	if YtDlpCookiesFile != "" {
+		out = append(out, "--cookies", YtDlpCookiesFile)
+	}
+	out = append(out, YtDlpExtraArgs...)
+	return append(out, "--", target)
+}
+
+// Versions holds the versions reported by the external binaries
+type Versions struct {
+	FFmpeg string
+	YtDlp  string
+}
+
+// Check runs FFmpeg and yt-dlp to confirm they are usable
+// The error lists every binary that is missing or fails to run
+func Check() (Versions, error) {
+	var versions Versions
+	var problems []string
+
+	version, err := FFmpegVersion()
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("ffmpeg (%s): %v", FFmpeg, err))
+	}
+	versions.FFmpeg = version
+
+	version, err = YtDlpVersion()
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("yt-dlp (%s): %v", YtDlp, err))
+	}
+	versions.YtDlp = version
+
+	if len(problems) > 0 {
+		return versions, fmt.Errorf("required binaries unavailable (set FFMPEG_PATH / YTDLP_PATH): %s", strings.Join(problems, "; "))
+	}
+	return versions, nil
+}
+
+// FFmpegVersion runs FFmpeg and returns the version it reports
+func FFmpegVersion() (string, error) {
+	output, err := runVersion(FFmpeg, "-version")
+	if err != nil {
+		return "", err
+	}
+	// "ffmpeg version 6.1.1 Copyright (c) ..."
+	return firstField(output, 2), nil
+}
+
+// FFprobeVersion runs FFprobe and returns the version it reports
+func FFprobeVersion() (string, error) {
+	output, err := runVersion(FFprobe, "-version")
+	if err != nil {
+		return "", err
+	}
+	// "ffprobe version 6.1.1 Copyright (c) ..."
+	return firstField(output, 2), nil
+}
+
+// YtDlpVersion runs yt-dlp and returns the version it reports, a release date like 2024.08.06
+func YtDlpVersion() (string, error) {
+	output, err := runVersion(YtDlp, "--version")
+	if err != nil {
+		return "", err
+	}
+	return firstField(output, 0), nil
+}
+
+// runVersion runs a binary with its version flag and returns the output
+func runVersion(path, flag string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, path, flag).Output()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return "", fmt.Errorf("not found")
+		}
+		return "", err
+	}
+	return string(output), nil
+}
+
+// firstField returns the nth whitespace-separated field of the first line, or "unknown"
+func firstField(output string, n int) string {
+	line, _, _ := strings.Cut(output, "\n")
+	fields := strings.Fields(line)
+	if n >= len(fields) {
+		return "unknown"
+	}
+	return fields[n]
+}
@@ -0,0 +1,66 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestYtDlpArgs(t *testing.T) {
+	defer func(extra []string) { YtDlpExtraArgs = extra }(YtDlpExtraArgs)
+	YtDlpExtraArgs = []string{"--force-ipv4"}
+
+	got := strings.Join(YtDlpArgs("", "https://youtu.be/x", "-f", "bestaudio"), " ")
+	if want := "-f bestaudio --force-ipv4 -- https://youtu.be/x"; got != want {
+		t.Errorf("YtDlpArgs = %q, want %q", got, want)
+	}
+}
+
+func TestYtDlpArgsDashTarget(t *testing.T) {
+	args := YtDlpArgs("", "--exec=touch /tmp/pwned", "--dump-json")
+	if n := len(args); n < 2 || args[n-2] != "--" || args[n-1] != "--exec=touch /tmp/pwned" {
+		t.Errorf("YtDlpArgs = %q, want the target after --", args)
+	}
+}
+
+func TestYtDlpArgsCookies(t *testing.T) {
+	defer func(cookies string) { YtDlpCookiesFile = cookies }(YtDlpCookiesFile)
+	YtDlpCookiesFile = "/etc/gobard/cookies.txt"
+
+	got := strings.Join(YtDlpArgs("", "https://youtu.be/x", "-g"), " ")
+	if want := "-g --cookies /etc/gobard/cookies.txt -- https://youtu.be/x"; got != want {
+		t.Errorf("YtDlpArgs = %q, want %q", got, want)
+	}
+}
+
+func TestYtDlpArgsProxy(t *testing.T) {
+	got := strings.Join(YtDlpArgs("socks5://127.0.0.1:1080", "https://youtu.be/x", "-g"), " ")
+	if want := "-g --proxy socks5://127.0.0.1:1080 -- https://youtu.be/x"; got != want {
+		t.Errorf("YtDlpArgs = %q, want %q", got, want)
+	}
+}
+
+func TestCheckReportsEveryMissingBinary(t *testing.T) {
+	defer func(ffmpeg, ytdlp string) { FFmpeg, YtDlp = ffmpeg, ytdlp }(FFmpeg, YtDlp)
+	FFmpeg = "/nonexistent/ffmpeg"
+	YtDlp = "/nonexistent/yt-dlp"
+
+	_, err := Check()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, path := range []string{FFmpeg, YtDlp} {
+		if !strings.Contains(err.Error(), path) {
+			t.Errorf("error %q doesn't mention %s", err, path)
+		}
+	}
+}
+
+func TestFirstField(t *testing.T) {
+	output := "ffmpeg version 6.1.1 Copyright (c) 2000-2023\nbuilt with gcc"
+	if got := firstField(output, 2); got != "6.1.1" {
+		t.Errorf("firstField = %q", got)
+	}
+	if got := firstField("", 0); got != "unknown" {
+		t.Errorf("firstField of empty output = %q", got)
+	}
+}
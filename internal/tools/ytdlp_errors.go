@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// Errors for common yt-dlp failures; their messages are shown to users as-is
+var (
+	ErrVideoUnavailable = errors.New("this video is unavailable")
+	ErrPrivateVideo     = errors.New("this video is private")
+	ErrGeoBlocked       = errors.New("this video isn't available in the bot's country")
+	ErrAgeRestricted    = errors.New("this video is age-restricted")
+	ErrCopyright        = errors.New("this video was taken down over a copyright claim")
+	ErrBotCheck         = errors.New("YouTube wants the bot to sign in to prove it isn't a bot; try again later or configure a cookies file")
+	ErrNetwork          = errors.New("couldn't reach YouTube; try again in a moment")
+	ErrRateLimited      = errors.New("YouTube is refusing the bot's requests for now; try again later")
+	ErrLiveEnded        = errors.New("this livestream has ended")
+)
+
+// ytDlpFailure maps yt-dlp stderr messages to an error
+type ytDlpFailure struct {
+	err     error
+	markers []string
+}
+
+// ytDlpFailures is checked in order; the more specific reasons come first because
+// yt-dlp often prefixes them with "Video unavailable"
+var ytDlpFailures = []ytDlpFailure{
+	{ErrPrivateVideo, []string{"Private video", "This video is private"}},
+	{ErrCopyright, []string{"copyright claim", "copyright grounds"}},
+	{ErrGeoBlocked, []string{"not made this video available in your country", "not available in your country", "geo restriction"}},
+	{ErrAgeRestricted, []string{"Sign in to confirm your age", "inappropriate for some users"}},
+	{ErrBotCheck, []string{"not a bot"}},
+	{ErrLiveEnded, []string{"This live event has ended", "live stream recording is not available"}},
+	{ErrVideoUnavailable, []string{"Video unavailable", "This video is unavailable", "This video has been removed", "Incomplete YouTube ID"}},
+	{ErrRateLimited, []string{"HTTP Error 429", "Too Many Requests", "HTTP Error 403", "403: Forbidden"}},
+	{ErrNetwork, []string{"timed out", "Temporary failure in name resolution", "Connection refused", "Connection reset", "Network is unreachable", "Unable to connect to proxy", "Tunnel connection failed"}},
+}
+
+// YtDlpError turns a failed yt-dlp run into one of the errors above based on its stderr
+// Unrecognized failures keep err with the last line of stderr appended
+// stderr may be nil to use the output captured in an *exec.ExitError
+func YtDlpError(err error, stderr []byte) error {
+	var exitErr *exec.ExitError
+	if stderr == nil && errors.As(err, &exitErr) {
+		stderr = exitErr.Stderr
+	}
+
+	for _, failure := range ytDlpFailures {
+		for _, marker := range failure.markers {
+			if !bytes.Contains(stderr, []byte(marker)) {
+				continue
+			}
+			if failure.err != ErrAgeRestricted {
+				return failure.err
+			}
+			if YtDlpCookiesFile == "" {
+				return fmt.Errorf("%w and no cookies are configured", ErrAgeRestricted)
+			}
+			return fmt.Errorf("%w and the configured cookies were not accepted", ErrAgeRestricted)
+		}
+	}
+
+	if line := lastLine(stderr); line != "" {
+		return fmt.Errorf("%w: %s", err, line)
+	}
+	return err
+}
+
+// lastLine returns the last non-empty line of output
+func lastLine(output []byte) string {
+	lines := bytes.Split(bytes.TrimSpace(output), []byte("\n"))
+	return string(bytes.TrimSpace(lines[len(lines)-1]))
+}
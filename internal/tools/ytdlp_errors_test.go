@@ -0,0 +1,120 @@
+package tools
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestYtDlpError(t *testing.T) {
+	defer func(cookies string) { YtDlpCookiesFile = cookies }(YtDlpCookiesFile)
+	YtDlpCookiesFile = ""
+
+	tests := []struct {
+		name   string
+		stderr string
+		want   error
+	}{
+		{
+			name:   "unavailable",
+			stderr: "ERROR: [youtube] dQw4w9WgXcQ: Video unavailable\n",
+			want:   ErrVideoUnavailable,
+		},
+		{
+			name:   "removed",
+			stderr: "ERROR: [youtube] dQw4w9WgXcQ: Video unavailable. This video has been removed by the uploader\n",
+			want:   ErrVideoUnavailable,
+		},
+		{
+			name:   "private",
+			stderr: "ERROR: [youtube] dQw4w9WgXcQ: Private video. Sign in if you've been granted access to this video\n",
+			want:   ErrPrivateVideo,
+		},
+		{
+			name:   "geo-blocked",
+			stderr: "ERROR: [youtube] dQw4w9WgXcQ: Video unavailable. The uploader has not made this video available in your country\n",
+			want:   ErrGeoBlocked,
+		},
+		{
+			name:   "age-restricted",
+			stderr: "ERROR: [youtube] dQw4w9WgXcQ: Sign in to confirm your age. This video may be inappropriate for some users.\n",
+			want:   ErrAgeRestricted,
+		},
+		{
+			name:   "copyright",
+			stderr: "ERROR: [youtube] dQw4w9WgXcQ: Video unavailable. This video is no longer available due to a copyright claim by Example Records\n",
+			want:   ErrCopyright,
+		},
+		{
+			name:   "bot check",
+			stderr: "ERROR: [youtube] dQw4w9WgXcQ: Sign in to confirm you’re not a bot. Use --cookies-from-browser or --cookies for the authentication.\n",
+			want:   ErrBotCheck,
+		},
+		{
+			name:   "live ended",
+			stderr: "ERROR: [youtube] dQw4w9WgXcQ: This live event has ended.\n",
+			want:   ErrLiveEnded,
+		},
+		{
+			name:   "timeout",
+			stderr: "WARNING: [youtube] Unable to download webpage: The read operation timed out\nERROR: [youtube] dQw4w9WgXcQ: Unable to download API page: The read operation timed out\n",
+			want:   ErrNetwork,
+		},
+		{
+			name:   "dns",
+			stderr: "ERROR: [youtube] dQw4w9WgXcQ: Unable to download webpage: <urlopen error [Errno -3] Temporary failure in name resolution>\n",
+			want:   ErrNetwork,
+		},
+		{
+			name:   "rate limited",
+			stderr: "ERROR: [youtube] dQw4w9WgXcQ: Unable to download webpage: HTTP Error 429: Too Many Requests\n",
+			want:   ErrRateLimited,
+		},
+		{
+			name:   "forbidden",
+			stderr: "ERROR: unable to download video data: HTTP Error 403: Forbidden\n",
+			want:   ErrRateLimited,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := YtDlpError(errors.New("exit status 1"), []byte(tt.stderr))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("YtDlpError = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestYtDlpErrorAgeRestrictedCookies(t *testing.T) {
+	defer func(cookies string) { YtDlpCookiesFile = cookies }(YtDlpCookiesFile)
+	stderr := []byte("ERROR: [youtube] abc: Sign in to confirm your age. This video may be inappropriate for some users.\n")
+
+	YtDlpCookiesFile = ""
+	if err := YtDlpError(errors.New("exit status 1"), stderr); !strings.Contains(err.Error(), "no cookies are configured") {
+		t.Errorf("error %q doesn't mention missing cookies", err)
+	}
+
+	YtDlpCookiesFile = "cookies.txt"
+	if err := YtDlpError(errors.New("exit status 1"), stderr); strings.Contains(err.Error(), "no cookies") {
+		t.Errorf("error %q claims no cookies are configured", err)
+	}
+}
+
+func TestYtDlpErrorUnknown(t *testing.T) {
+	original := errors.New("failed to get video info: exit status 1")
+	stderr := []byte("WARNING: something odd\nERROR: [generic] Unsupported URL: https://example.com/\n\n")
+
+	err := YtDlpError(original, stderr)
+	if !errors.Is(err, original) {
+		t.Errorf("YtDlpError = %v, want it to wrap the original error", err)
+	}
+	if want := "failed to get video info: exit status 1: ERROR: [generic] Unsupported URL: https://example.com/"; err.Error() != want {
+		t.Errorf("YtDlpError = %q, want %q", err, want)
+	}
+
+	if err := YtDlpError(original, nil); err != original {
+		t.Errorf("YtDlpError without stderr = %v, want the original error", err)
+	}
+}
@@ -0,0 +1,291 @@
+package webmeta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/player"
+)
+
+const (
+	// fetchTimeout bounds fetching a page, including redirects
+	fetchTimeout = 10 * time.Second
+	// maxPageSize is how much of a page is read; music service pages run to a few hundred KB
+	maxPageSize = 4 << 20
+	// userAgent identifies the bot to the services it reads pages from
+	userAgent = "Mozilla/5.0 (compatible; GoBard; +https://github.com/GrainedLotus515/GoBard)"
+)
+
+// Recording is a song described on a page
+type Recording struct {
+	Title    string
+	Artist   string
+	Duration time.Duration // 0 if unknown
+	URL      string        // The song's own page, empty if unknown
+}
+
+// Import is what was read from a music service link: one song, or an album's or playlist's tracks
+type Import struct {
+	Title  string // Album or playlist name, empty for a single song
+	Owner  string // Album artist or playlist creator, empty if unknown
+	Tracks []*player.Track
+}
+
+// Page is the metadata read from a music service page
+type Page struct {
+	URL  *neturl.URL       // Where the page was read from, after redirects
+	Meta map[string]string // OpenGraph and other <meta> tags by property or name
+
+	// From the page's schema.org JSON-LD, if any
+	Collection string      // Album or playlist name, empty for song pages
+	Owner      string      // Album artist or playlist creator
+	Recordings []Recording // The page's song, or the collection's tracks
+}
+
+// Fetch reads a page and its metadata, refusing redirects to hosts allowed doesn't accept
+func Fetch(ctx context.Context, client *http.Client, link string, allowed func(host string) bool) (*Page, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	// Copy the client so the redirect check doesn't leak into other requests
+	checked := *client
+	checked.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return fmt.Errorf("too many redirects")
+		}
+		if !allowed(strings.ToLower(req.URL.Hostname())) {
+			return fmt.Errorf("redirected to unexpected host %s", req.URL.Hostname())
+		}
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept-Language", "en")
+
+	resp, err := checked.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("page returned %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read page: %w", err)
+	}
+
+	page := Parse(body)
+	page.URL = resp.Request.URL
+	return page, nil
+}
+
+var (
+	metaTag   = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attribute = regexp.MustCompile(`(?s)([\w:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	ldScript  = regexp.MustCompile(`(?is)<script[^>]*type\s*=\s*["']application/ld\+json["'][^>]*>(.*?)</script>`)
+)
+
+// Parse reads the <meta> tags and JSON-LD music metadata from an HTML page
+func Parse(body []byte) *Page {
+	page := &Page{Meta: make(map[string]string)}
+
+	for _, tag := range metaTag.FindAll(body, -1) {
+		attrs := make(map[string]string)
+		for _, m := range attribute.FindAllSubmatch(tag, -1) {
+			attrs[strings.ToLower(string(m[1]))] = html.UnescapeString(string(m[2]) + string(m[3]))
+		}
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		// The first tag wins; pages repeat some for other platforms
+		if _, seen := page.Meta[key]; key != "" && !seen {
+			page.Meta[key] = cleanText(attrs["content"])
+		}
+	}
+
+	for _, m := range ldScript.FindAllSubmatch(body, -1) {
+		if page.readLinkedData(m[1]) {
+			break
+		}
+	}
+	return page
+}
+
+// Get returns the first non-empty meta tag among keys
+func (p *Page) Get(keys ...string) string {
+	for _, key := range keys {
+		if value := p.Meta[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// ldNode is the part of a schema.org node that describes music
+type ldNode struct {
+	Type     any             `json:"@type"`
+	Name     string          `json:"name"`
+	Duration string          `json:"duration"`
+	URL      string          `json:"url"`
+	ByArtist json.RawMessage `json:"byArtist"`
+	Author   json.RawMessage `json:"author"`
+	Track    json.RawMessage `json:"track"`
+	Tracks   json.RawMessage `json:"tracks"`
+	Item     json.RawMessage `json:"item"`
+	Elements json.RawMessage `json:"itemListElement"`
+	Graph    []ldNode        `json:"@graph"`
+}
+
+// readLinkedData fills in the page's music metadata from one JSON-LD script and reports
+// whether it described a song, album or playlist
+func (p *Page) readLinkedData(data []byte) bool {
+	var nodes []ldNode
+	if err := json.Unmarshal(data, &nodes); err != nil {
+		var node ldNode
+		if err := json.Unmarshal(data, &node); err != nil {
+			return false
+		}
+		nodes = append(node.Graph, node)
+	}
+
+	for _, node := range nodes {
+		switch {
+		case node.is("MusicRecording"):
+			p.Recordings = []Recording{node.recording()}
+			return true
+		case node.is("MusicAlbum"), node.is("MusicPlaylist"):
+			p.Collection = cleanText(node.Name)
+			p.Owner = names(node.ByArtist)
+			if p.Owner == "" {
+				p.Owner = names(node.Author)
+			}
+			for _, list := range []json.RawMessage{node.Track, node.Tracks} {
+				for _, track := range listItems(list) {
+					recording := track.recording()
+					if recording.Artist == "" {
+						recording.Artist = p.Owner
+					}
+					if recording.Title != "" {
+						p.Recordings = append(p.Recordings, recording)
+					}
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// is reports whether the node has the given type; @type may be a string or a list
+func (n ldNode) is(kind string) bool {
+	switch t := n.Type.(type) {
+	case string:
+		return t == kind
+	case []any:
+		for _, v := range t {
+			if v == kind {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// recording converts a MusicRecording node
+func (n ldNode) recording() Recording {
+	return Recording{
+		Title:    cleanText(n.Name),
+		Artist:   names(n.ByArtist),
+		Duration: parseISODuration(n.Duration),
+		URL:      n.URL,
+	}
+}
+
+// listItems returns the recordings in a track list, which is either an array of recordings
+// or an ItemList whose elements wrap them in ListItems
+func listItems(raw json.RawMessage) []ldNode {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var nodes []ldNode
+	if err := json.Unmarshal(raw, &nodes); err != nil {
+		var list ldNode
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil
+		}
+		return listItems(list.Elements)
+	}
+
+	items := make([]ldNode, 0, len(nodes))
+	for _, node := range nodes {
+		if len(node.Item) > 0 {
+			var inner ldNode
+			if err := json.Unmarshal(node.Item, &inner); err == nil {
+				node = inner
+			}
+		}
+		items = append(items, node)
+	}
+	return items
+}
+
+// names joins the names in a byArtist or author value, which is a person or a list of them
+func names(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var people []ldNode
+	if err := json.Unmarshal(raw, &people); err != nil {
+		var person ldNode
+		if err := json.Unmarshal(raw, &person); err != nil {
+			return ""
+		}
+		people = []ldNode{person}
+	}
+
+	list := make([]string, 0, len(people))
+	for _, person := range people {
+		if name := cleanText(person.Name); name != "" {
+			list = append(list, name)
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+var isoDuration = regexp.MustCompile(`^P(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISODuration parses durations like "PT3M20S", returning 0 for anything else
+func parseISODuration(s string) time.Duration {
+	m := isoDuration.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0
+	}
+	hours, _ := strconv.Atoi(m[1])
+	minutes, _ := strconv.Atoi(m[2])
+	seconds, _ := strconv.ParseFloat(m[3], 64)
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second))
+}
+
+// cleanText trims whitespace and the invisible direction marks some services put around titles
+func cleanText(s string) string {
+	return strings.TrimSpace(strings.NewReplacer("‎", "", "‏", "").Replace(s))
+}
@@ -0,0 +1,97 @@
+package youtube
+
+import (
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// filterSpare is how many more results Client.Search fetches than it returns, to have
+// something to return when the best ones are filtered out
+const filterSpare = 2
+
+// ResultFilter drops search results that are too long to be the song searched for and moves
+// junk uploads, like hour-long loops, behind the rest
+type ResultFilter struct {
+	// MaxDuration drops results longer than it; 0 for no limit
+	MaxDuration time.Duration
+	// MaxRatio drops results longer than this multiple of the expected length, when it is
+	// known; 0 for no limit
+	MaxRatio float64
+	// JunkPatterns are lowercase title words that move a result behind the others, unless
+	// the query has them too
+	JunkPatterns []string
+}
+
+// filter is the ResultFilter searches use; it lets everything through until one is set
+var filter atomic.Pointer[ResultFilter]
+
+func init() {
+	filter.Store(&ResultFilter{})
+}
+
+// SetResultFilter sets the filter applied to search results
+func SetResultFilter(f ResultFilter) {
+	f.JunkPatterns = slices.Clone(f.JunkPatterns)
+	for i, pattern := range f.JunkPatterns {
+		f.JunkPatterns[i] = strings.ToLower(pattern)
+	}
+	filter.Store(&f)
+}
+
+// Apply filters results for query, expected being the length of the song searched for (0 if
+// unknown)
+// It never returns fewer than one result: if every result would be dropped, the first is kept
+func (f *ResultFilter) Apply(results []SearchResult, query string, expected time.Duration) []SearchResult {
+	if len(results) == 0 {
+		return results
+	}
+
+	kept := make([]SearchResult, 0, len(results))
+	for _, result := range results {
+		if !f.tooLong(result, expected) {
+			kept = append(kept, result)
+		}
+	}
+	if len(kept) == 0 {
+		return results[:1]
+	}
+
+	query = strings.ToLower(query)
+	slices.SortStableFunc(kept, func(a, b SearchResult) int {
+		aJunk, bJunk := f.junk(a, query), f.junk(b, query)
+		switch {
+		case aJunk == bJunk:
+			return 0
+		case aJunk:
+			return 1
+		}
+		return -1
+	})
+	return kept
+}
+
+// tooLong reports whether a result is over the filter's length limits; livestreams and
+// results of unknown length never are
+func (f *ResultFilter) tooLong(result SearchResult, expected time.Duration) bool {
+	length := time.Duration(result.Duration * float64(time.Second))
+	if result.IsLive || length <= 0 {
+		return false
+	}
+	if f.MaxDuration > 0 && length > f.MaxDuration {
+		return true
+	}
+	return f.MaxRatio > 0 && expected > 0 && float64(length) > float64(expected)*f.MaxRatio
+}
+
+// junk reports whether a result's title has a junk pattern the query doesn't
+func (f *ResultFilter) junk(result SearchResult, query string) bool {
+	title := strings.ToLower(result.Title)
+	for _, pattern := range f.JunkPatterns {
+		if strings.Contains(title, pattern) && !strings.Contains(query, pattern) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package youtube
+
+import (
+	"testing"
+	"time"
+)
+
+func resultIDs(results []SearchResult) []string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	return ids
+}
+
+func TestResultFilterApply(t *testing.T) {
+	results := []SearchResult{
+		{ID: "loop", Title: "Song (1 HOUR LOOP)", Duration: 3600},
+		{ID: "album", Title: "Artist - Full Album", Duration: 2700},
+		{ID: "slowed", Title: "Song (slowed + reverb)", Duration: 260},
+		{ID: "song", Title: "Song", Duration: 200},
+		{ID: "live", Title: "Song radio", IsLive: true},
+	}
+	f := &ResultFilter{
+		MaxDuration:  time.Hour,
+		MaxRatio:     3,
+		JunkPatterns: []string{"1 hour", "full album", "slowed + reverb"},
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected time.Duration
+		want     []string
+	}{
+		// Junk moves behind the rest, keeping its order
+		{"junk demoted", "song", 0, []string{"song", "live", "loop", "album", "slowed"}},
+		// Unless the query asks for it
+		{"junk searched for", "song slowed + reverb", 0, []string{"slowed", "song", "live", "loop", "album"}},
+		// A known length drops uploads much longer than the song
+		{"expected length", "song", 200 * time.Second, []string{"song", "live", "slowed"}},
+	}
+	for _, tt := range tests {
+		got := resultIDs(f.Apply(results, tt.query, tt.expected))
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: Apply = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: Apply = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+
+	capped := &ResultFilter{MaxDuration: 30 * time.Minute}
+	if got := resultIDs(capped.Apply(results, "song", 0)); len(got) != 3 || got[0] != "slowed" {
+		t.Errorf("Apply with a 30m cap = %v, want the loop and album dropped", got)
+	}
+}
+
+func TestResultFilterNeverEmpties(t *testing.T) {
+	results := []SearchResult{
+		{ID: "first", Title: "Mix", Duration: 7200},
+		{ID: "second", Title: "Other mix", Duration: 5400},
+	}
+	f := &ResultFilter{MaxDuration: time.Hour}
+	if got := resultIDs(f.Apply(results, "mix", 0)); len(got) != 1 || got[0] != "first" {
+		t.Errorf("Apply with everything too long = %v, want the first result", got)
+	}
+	if got := f.Apply(nil, "mix", 0); len(got) != 0 {
+		t.Errorf("Apply(nil) = %v", got)
+	}
+}
+
+func TestSetResultFilterLowercasesPatterns(t *testing.T) {
+	defer func(previous *ResultFilter) { filter.Store(previous) }(filter.Load())
+
+	patterns := []string{"Full Album"}
+	SetResultFilter(ResultFilter{JunkPatterns: patterns})
+	if patterns[0] != "Full Album" {
+		t.Error("SetResultFilter changed the caller's patterns")
+	}
+	if got := filter.Load().JunkPatterns; len(got) != 1 || got[0] != "full album" {
+		t.Errorf("patterns = %q, want lowercase", got)
+	}
+}
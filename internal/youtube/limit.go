@@ -0,0 +1,94 @@
+package youtube
+
+import (
+	"context"
+	"sync"
+
+	"github.com/GrainedLotus515/gobard/internal/tools"
+)
+
+// DefaultMaxConcurrency is how many yt-dlp processes may extract at once unless configured
+const DefaultMaxConcurrency = tools.DefaultYtDlpConcurrency
+
+// SetMaxConcurrency sets how many yt-dlp processes may extract at once
+// The limit is shared with the streaming encoder's yt-dlp runs; see tools.AcquireYtDlp
+func SetMaxConcurrency(n int) {
+	tools.SetYtDlpConcurrency(n)
+}
+
+// Stats describes the yt-dlp processes started by the bot
+type Stats struct {
+	Running int // Processes holding a slot now
+	Waiting int // Lookups waiting for a free slot
+	Limit   int // Most processes allowed at once
+}
+
+// CurrentStats returns the current yt-dlp process counts
+func CurrentStats() Stats {
+	running, waiting, limit := tools.YtDlpStats()
+	return Stats{Running: running, Waiting: waiting, Limit: limit}
+}
+
+// flightGroup shares one lookup between concurrent callers asking for the same key
+type flightGroup[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*flight[T]
+}
+
+// flight is one shared lookup
+type flight[T any] struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	val     T
+	err     error
+}
+
+// do runs fn once for all concurrent callers with the same key and returns its result
+// fn runs under a context that is cancelled only once every caller has given up, so one
+// caller cancelling doesn't fail the lookup for the others
+func (g *flightGroup[T]) do(ctx context.Context, key string, fn func(ctx context.Context) (T, error)) (T, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flight[T])
+	}
+	f, ok := g.calls[key]
+	if !ok {
+		runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight[T]{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = f
+
+		go func() {
+			defer cancel()
+			f.val, f.err = fn(runCtx)
+
+			g.mu.Lock()
+			if g.calls[key] == f {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.val, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			// Nobody wants the result any more; a later caller starts a fresh lookup
+			f.cancel()
+			if g.calls[key] == f {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+
+		var zero T
+		return zero, ctx.Err()
+	}
+}
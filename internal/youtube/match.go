@@ -0,0 +1,171 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/logger"
+	"github.com/GrainedLotus515/gobard/internal/player"
+)
+
+// ErrNoCloseMatch is returned by FindMatch when every search result scores below MinMatchScore
+var ErrNoCloseMatch = errors.New("no close YouTube match")
+
+const (
+	// matchCandidates is how many search results FindMatch scores
+	matchCandidates = 5
+	// MinMatchScore is the lowest score FindMatch accepts
+	MinMatchScore = 0
+	// ConfidentMatchScore is the score from which a match is trusted enough not to search again
+	ConfidentMatchScore = 50
+)
+
+// versionPattern matches title words that mark a different version of a song
+var versionPattern = regexp.MustCompile(`\b(live|cover|sped[ -]up|speed[ -]up|slowed|8d|nightcore|karaoke|instrumental|remix|full album|reaction)\b`)
+
+// titleSuffix matches the parts of a title after the song name, like " - Remastered 2009" or " (feat. X)"
+var titleSuffix = regexp.MustCompile(`\s+(-|\(|\[).*$`)
+
+// FindMatch searches YouTube for want, a track from another service, and returns a copy of
+// want pointing at the best-scoring result and its score; it returns ErrNoCloseMatch if none
+// is close enough
+func (c *Client) FindMatch(ctx context.Context, want *player.Track) (*player.Track, int, error) {
+	return c.findMatch(ctx, want, MinMatchScore)
+}
+
+// FindLooseMatch is FindMatch accepting the best result however low it scores, like a cover
+// or a live version, for when a likely wrong match beats none
+func (c *Client) FindLooseMatch(ctx context.Context, want *player.Track) (*player.Track, int, error) {
+	return c.findMatch(ctx, want, math.MinInt)
+}
+
+// findMatch finds want's best match, returning ErrNoCloseMatch if it scores below minScore
+func (c *Client) findMatch(ctx context.Context, want *player.Track, minScore int) (*player.Track, int, error) {
+	query := strings.TrimSpace(want.Artist + " " + want.Title)
+	// Queries for tracks from other services are always songs, which YouTube Music finds
+	// without the intros and skits of music videos
+	results, proxy, err := search(ctx, query, matchCandidates, SearchYouTubeMusic)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(results) == 0 {
+		return nil, 0, fmt.Errorf("no results for %q", query)
+	}
+	results = filter.Load().Apply(results, query, want.Duration)
+
+	best, score := bestMatch(want, results)
+	if score < minScore {
+		logger.Debug("Best YouTube match scored too low", "query", query, "title", best.Title, "score", score)
+		return nil, score, fmt.Errorf("%w for %q", ErrNoCloseMatch, query)
+	}
+
+	// Copying want keeps the queue's bookkeeping, like the requester and the track's context
+	found := trackFromResult(best)
+	matched := *want
+	matched.ID = found.ID
+	matched.Title = found.Title
+	matched.RawTitle = found.RawTitle
+	matched.Artist = found.Artist
+	matched.URL = found.URL
+	matched.Duration = found.Duration
+	matched.Source = found.Source
+	matched.Thumbnail = found.Thumbnail
+	matched.IsLive = found.IsLive
+	matched.ViewCount = found.ViewCount
+	matched.StreamURL = found.StreamURL
+	matched.StreamProxy = proxy
+	matched.Chapters = found.Chapters
+	matched.Partial = false
+	return &matched, score, nil
+}
+
+// ResolveMatch returns a copy of want pointing at a YouTube video matched earlier, with its
+// info and stream URL looked up like ResolveTrack
+func (c *Client) ResolveMatch(ctx context.Context, want *player.Track, videoID string) (*player.Track, error) {
+	matched := *want
+	matched.ID = videoID
+	matched.URL = "https://www.youtube.com/watch?v=" + videoID
+	matched.Source = player.SourceYouTube
+	matched.Title, matched.RawTitle, matched.Artist, matched.Thumbnail = "", "", "", ""
+	matched.Duration = 0
+	matched.StreamURL, matched.StreamProxy = "", ""
+	matched.Partial = true
+	return c.ResolveTrack(ctx, &matched)
+}
+
+// bestMatch returns the highest-scoring result and its score; earlier results win ties
+func bestMatch(want *player.Track, results []SearchResult) (SearchResult, int) {
+	best, bestScore := results[0], ScoreMatch(want, results[0])
+	for _, result := range results[1:] {
+		if score := ScoreMatch(want, result); score > bestScore {
+			best, bestScore = result, score
+		}
+	}
+	return best, bestScore
+}
+
+// ScoreMatch rates how likely a search result is the same recording as want
+// Durations within 5 seconds count most; live versions, covers, edits and album uploads are
+// penalized unless want's title names them too, and official audio and topic channels are rewarded
+func ScoreMatch(want *player.Track, got SearchResult) int {
+	wantTitle := strings.ToLower(want.Title)
+	title := strings.ToLower(got.Title)
+	uploader := strings.ToLower(got.Uploader)
+	score := 0
+
+	if want.Duration > 0 && got.Duration > 0 {
+		diff := want.Duration - time.Duration(got.Duration)*time.Second
+		if diff < 0 {
+			diff = -diff
+		}
+		switch {
+		case diff <= 5*time.Second:
+			score += 40
+		case diff <= 15*time.Second:
+			score += 20
+		case diff <= 30*time.Second:
+		case diff <= 2*time.Minute:
+			score -= 30
+		default:
+			score -= 60
+		}
+	}
+
+	for _, word := range versionPattern.FindAllString(title, -1) {
+		if !strings.Contains(wantTitle, word) {
+			score -= 40
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(uploader, " - topic"),
+		strings.Contains(strings.ToLower(got.Description), "provided to youtube"):
+		score += 20
+	case strings.Contains(title, "official audio"):
+		score += 15
+	case strings.Contains(title, "official video"), strings.Contains(title, "official music video"):
+		score += 5
+	}
+
+	// The song's name is compared without upload noise like "(Official Video)" or the artist
+	cleanTitle, _ := player.NormalizeTitle(got.Title, got.Uploader)
+	if name := strings.ToLower(titleSuffix.ReplaceAllString(want.Title, "")); name != "" && strings.Contains(strings.ToLower(cleanTitle), name) {
+		score += 10
+	}
+	if artist := strings.ToLower(firstArtist(want.Artist)); artist != "" && (strings.Contains(uploader, artist) || strings.Contains(title, artist)) {
+		score += 10
+	}
+
+	return score
+}
+
+// firstArtist returns the first name of a comma-separated artist list
+func firstArtist(artists string) string {
+	first, _, _ := strings.Cut(artists, ",")
+	return strings.TrimSpace(first)
+}
@@ -0,0 +1,119 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/player"
+)
+
+func TestBestMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    *player.Track
+		results []SearchResult
+		wantID  string
+	}{
+		{
+			name: "official audio over live and sped up",
+			want: &player.Track{Title: "Blinding Lights", Artist: "The Weeknd", Duration: 200 * time.Second},
+			results: []SearchResult{
+				{ID: "live", Title: "The Weeknd - Blinding Lights (Live at the Grammys)", Uploader: "The Weeknd", Duration: 262},
+				{ID: "spedup", Title: "blinding lights (sped up)", Uploader: "sped up songs", Duration: 160},
+				{ID: "video", Title: "The Weeknd - Blinding Lights (Official Video)", Uploader: "TheWeekndVEVO", Duration: 263},
+				{ID: "audio", Title: "The Weeknd - Blinding Lights (Official Audio)", Uploader: "The Weeknd", Duration: 201},
+			},
+			wantID: "audio",
+		},
+		{
+			name: "topic channel over full album upload",
+			want: &player.Track{Title: "Come Together - Remastered 2009", Artist: "The Beatles", Duration: 259 * time.Second},
+			results: []SearchResult{
+				{ID: "album", Title: "The Beatles - Abbey Road (Full Album)", Uploader: "Beatles Archive", Duration: 2832},
+				{ID: "topic", Title: "Come Together (Remastered 2009)", Uploader: "The Beatles - Topic", Duration: 260},
+			},
+			wantID: "topic",
+		},
+		{
+			name: "original over cover of the same length",
+			want: &player.Track{Title: "Hallelujah", Artist: "Jeff Buckley", Duration: 414 * time.Second},
+			results: []SearchResult{
+				{ID: "cover", Title: "Hallelujah - Jeff Buckley (cover)", Uploader: "Some Singer", Duration: 412},
+				{ID: "original", Title: "Jeff Buckley - Hallelujah", Uploader: "jeffbuckleyVEVO", Duration: 415},
+			},
+			wantID: "original",
+		},
+		{
+			name: "provided to YouTube over 8D edit",
+			want: &player.Track{Title: "Heat Waves", Artist: "Glass Animals", Duration: 238 * time.Second},
+			results: []SearchResult{
+				{ID: "8d", Title: "Glass Animals - Heat Waves (8D AUDIO)", Uploader: "8D Tunes", Duration: 239},
+				{ID: "art", Title: "Heat Waves", Uploader: "Glass Animals", Duration: 239, Description: "Provided to YouTube by Universal Music Group"},
+			},
+			wantID: "art",
+		},
+		{
+			name: "live version kept when the source is live",
+			want: &player.Track{Title: "Hotel California - Live", Artist: "Eagles", Duration: 432 * time.Second},
+			results: []SearchResult{
+				{ID: "studio", Title: "Eagles - Hotel California (Official Audio)", Uploader: "Eagles", Duration: 391},
+				{ID: "live", Title: "Eagles - Hotel California (Live 1994)", Uploader: "Eagles", Duration: 430},
+			},
+			wantID: "live",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, score := bestMatch(tt.want, tt.results)
+			if got.ID != tt.wantID {
+				t.Errorf("bestMatch picked %q (score %d), want %q", got.ID, score, tt.wantID)
+			}
+			if score < MinMatchScore {
+				t.Errorf("best score %d is below MinMatchScore", score)
+			}
+		})
+	}
+}
+
+func TestScoreMatchRejectsWrongSong(t *testing.T) {
+	want := &player.Track{Title: "Bohemian Rhapsody", Artist: "Queen", Duration: 354 * time.Second}
+	results := []SearchResult{
+		{ID: "reaction", Title: "First time hearing Queen - Bohemian Rhapsody REACTION", Uploader: "Reacts", Duration: 1210},
+		{ID: "karaoke", Title: "Bohemian Rhapsody (Karaoke Version)", Uploader: "Sing King", Duration: 360},
+	}
+	if got, score := bestMatch(want, results); score >= MinMatchScore {
+		t.Errorf("bestMatch accepted %q with score %d", got.ID, score)
+	}
+}
+
+func TestFindMatchKeepsQueueFields(t *testing.T) {
+	fakeYtDlp(t, `{"id":"spedupspedu","title":"Heat Waves (sped up)","uploader":"Edits","duration":190,"webpage_url":"https://www.youtube.com/watch?v=spedupspedu","formats":[{"acodec":"opus","vcodec":"none","url":"https://cdn.example/a","abr":160}]}
+{"id":"heatwavesyt","title":"Heat Waves","uploader":"Glass Animals - Topic","duration":239,"webpage_url":"https://www.youtube.com/watch?v=heatwavesyt","formats":[{"acodec":"opus","vcodec":"none","url":"https://cdn.example/b","abr":160}]}`)
+
+	want := &player.Track{Title: "Heat Waves", Artist: "Glass Animals", Duration: 238 * time.Second, Source: player.SourceSpotify, RequestedBy: "user", URL: "https://open.spotify.com/track/x"}
+	got, _, err := NewClient("").FindMatch(context.Background(), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != "heatwavesyt" || got.Source != player.SourceYouTube || got.URL != "https://www.youtube.com/watch?v=heatwavesyt" || got.StreamURL != "https://cdn.example/b" {
+		t.Errorf("FindMatch = %+v", got)
+	}
+	if got.RequestedBy != "user" {
+		t.Errorf("RequestedBy = %q, want it carried over", got.RequestedBy)
+	}
+	if want.Source != player.SourceSpotify {
+		t.Error("FindMatch modified the track it was given")
+	}
+}
+
+func TestFindMatchNoCloseMatch(t *testing.T) {
+	fakeYtDlp(t, `{"id":"karaokekar","title":"Heat Waves (Karaoke Version)","uploader":"Sing King","duration":400,"formats":[{"acodec":"opus","vcodec":"none","url":"https://cdn.example/a","abr":160}]}`)
+
+	want := &player.Track{Title: "Heat Waves", Artist: "Glass Animals", Duration: 238 * time.Second}
+	if _, _, err := NewClient("").FindMatch(context.Background(), want); !errors.Is(err, ErrNoCloseMatch) {
+		t.Errorf("FindMatch error = %v, want ErrNoCloseMatch", err)
+	}
+}
@@ -0,0 +1,118 @@
+package youtube
+
+import (
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrNotYouTubeURL is returned by ParseURL for input that isn't a link to a YouTube host
+var ErrNotYouTubeURL = errors.New("not a YouTube URL")
+
+// youtubeHosts are the hosts ParseURL accepts
+var youtubeHosts = map[string]bool{
+	"youtube.com":              true,
+	"www.youtube.com":          true,
+	"m.youtube.com":            true,
+	"music.youtube.com":        true,
+	"youtu.be":                 true,
+	"youtube-nocookie.com":     true,
+	"www.youtube-nocookie.com": true,
+}
+
+var (
+	videoIDPattern    = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	playlistIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{2,64}$`)
+)
+
+// videoPathPrefixes are the paths that carry a video ID as their next segment
+var videoPathPrefixes = []string{"/shorts/", "/live/", "/embed/", "/v/", "/e/"}
+
+// Link is a parsed YouTube URL
+type Link struct {
+	VideoID    string        // Empty for playlist pages
+	PlaylistID string        // Empty unless the URL names a playlist
+	StartAt    time.Duration // From a t= or start= parameter, 0 if absent
+}
+
+// ParseURL validates a YouTube link and extracts its video and playlist IDs
+// Shorts, youtu.be, embed and YouTube Music links are all accepted; a missing scheme is
+// allowed so pasted "youtube.com/watch?v=..." links work
+// It returns ErrNotYouTubeURL for anything that isn't on a YouTube host, and another
+// error for YouTube links without a playable video or playlist
+func ParseURL(raw string) (*Link, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	u, err := neturl.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.User != nil {
+		return nil, ErrNotYouTubeURL
+	}
+	host := strings.ToLower(u.Hostname())
+	if !youtubeHosts[host] {
+		return nil, ErrNotYouTubeURL
+	}
+
+	query := u.Query()
+	link := &Link{}
+
+	switch {
+	case host == "youtu.be":
+		link.VideoID = strings.Trim(u.Path, "/")
+	case u.Path == "/watch":
+		link.VideoID = query.Get("v")
+	case u.Path == "/playlist":
+	default:
+		for _, prefix := range videoPathPrefixes {
+			if id, ok := strings.CutPrefix(u.Path, prefix); ok {
+				link.VideoID = strings.TrimSuffix(id, "/")
+				break
+			}
+		}
+	}
+
+	if list := query.Get("list"); list != "" {
+		if !playlistIDPattern.MatchString(list) {
+			return nil, fmt.Errorf("invalid YouTube playlist ID %q", list)
+		}
+		link.PlaylistID = list
+	}
+
+	if link.VideoID != "" && !videoIDPattern.MatchString(link.VideoID) {
+		return nil, fmt.Errorf("invalid YouTube video ID %q", link.VideoID)
+	}
+	if link.VideoID == "" && link.PlaylistID == "" {
+		return nil, fmt.Errorf("unsupported YouTube link; use a video or playlist URL")
+	}
+
+	link.StartAt, _ = ParseStartTime(u.String())
+	return link, nil
+}
+
+// IsPlaylist reports whether the link should be imported as a playlist
+func (l *Link) IsPlaylist() bool {
+	return l.PlaylistID != ""
+}
+
+// WatchURL returns the canonical watch URL for the link's video, keeping its start time
+func (l *Link) WatchURL() string {
+	watch := "https://www.youtube.com/watch?v=" + l.VideoID
+	if l.StartAt > 0 {
+		watch += fmt.Sprintf("&t=%d", int(l.StartAt.Seconds()))
+	}
+	return watch
+}
+
+// PlaylistURL returns the canonical URL for the link's playlist
+// The video is kept when present, since mixes can only be fetched from a watch URL
+func (l *Link) PlaylistURL() string {
+	if l.VideoID != "" {
+		return "https://www.youtube.com/watch?v=" + l.VideoID + "&list=" + l.PlaylistID
+	}
+	return "https://www.youtube.com/playlist?list=" + l.PlaylistID
+}
@@ -0,0 +1,94 @@
+package youtube
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseURL(t *testing.T) {
+	const id = "dQw4w9WgXcQ"
+	const list = "PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI"
+
+	tests := []struct {
+		name     string
+		raw      string
+		video    string
+		playlist string
+		startAt  time.Duration
+		wantErr  error // ErrNotYouTubeURL, or errAny for any other error
+	}{
+		{name: "watch", raw: "https://www.youtube.com/watch?v=" + id, video: id},
+		{name: "watch without www", raw: "https://youtube.com/watch?v=" + id, video: id},
+		{name: "http", raw: "http://www.youtube.com/watch?v=" + id, video: id},
+		{name: "no scheme", raw: "youtube.com/watch?v=" + id, video: id},
+		{name: "uppercase host", raw: "https://WWW.YouTube.com/watch?v=" + id, video: id},
+		{name: "mobile", raw: "https://m.youtube.com/watch?v=" + id + "&feature=share", video: id},
+		{name: "music", raw: "https://music.youtube.com/watch?v=" + id + "&si=abc", video: id},
+		{name: "short link", raw: "https://youtu.be/" + id, video: id},
+		{name: "short link with time", raw: "https://youtu.be/" + id + "?t=42", video: id, startAt: 42 * time.Second},
+		{name: "watch with time", raw: "https://www.youtube.com/watch?v=" + id + "&t=1m30s", video: id, startAt: 90 * time.Second},
+		{name: "shorts", raw: "https://www.youtube.com/shorts/" + id, video: id},
+		{name: "live", raw: "https://www.youtube.com/live/" + id + "?feature=share", video: id},
+		{name: "embed", raw: "https://www.youtube.com/embed/" + id, video: id},
+		{name: "nocookie embed", raw: "https://www.youtube-nocookie.com/embed/" + id, video: id},
+		{name: "playlist", raw: "https://www.youtube.com/playlist?list=" + list, playlist: list},
+		{name: "music playlist", raw: "https://music.youtube.com/playlist?list=" + list, playlist: list},
+		{name: "video in playlist", raw: "https://www.youtube.com/watch?v=" + id + "&list=" + list + "&index=3", video: id, playlist: list},
+		{name: "look-alike host", raw: "https://youtube.com.evil.example/watch?v=" + id, wantErr: ErrNotYouTubeURL},
+		{name: "host in query", raw: "https://evil.example/?x=youtube.com", wantErr: ErrNotYouTubeURL},
+		{name: "list= elsewhere", raw: "https://evil.example/watch?list=" + list, wantErr: ErrNotYouTubeURL},
+		{name: "credentials", raw: "https://youtube.com@evil.example/watch?v=" + id, wantErr: ErrNotYouTubeURL},
+		{name: "other scheme", raw: "file://youtube.com/watch?v=" + id, wantErr: ErrNotYouTubeURL},
+		{name: "search terms", raw: "never gonna give you up", wantErr: ErrNotYouTubeURL},
+		{name: "channel", raw: "https://www.youtube.com/@RickAstleyYT", wantErr: errAny},
+		{name: "bad video ID", raw: "https://www.youtube.com/watch?v=--exec%20rm", wantErr: errAny},
+		{name: "short video ID", raw: "https://youtu.be/abc", wantErr: errAny},
+		{name: "bad playlist ID", raw: "https://www.youtube.com/playlist?list=PL;rm", wantErr: errAny},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, err := ParseURL(tt.raw)
+			switch {
+			case tt.wantErr == errAny:
+				if err == nil || errors.Is(err, ErrNotYouTubeURL) {
+					t.Fatalf("ParseURL(%q) error = %v, want a YouTube link error", tt.raw, err)
+				}
+				return
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseURL(%q) error = %v, want %v", tt.raw, err, tt.wantErr)
+				}
+				return
+			case err != nil:
+				t.Fatalf("ParseURL(%q) error = %v", tt.raw, err)
+			}
+
+			if link.VideoID != tt.video || link.PlaylistID != tt.playlist || link.StartAt != tt.startAt {
+				t.Errorf("ParseURL(%q) = %+v, want video %q, playlist %q, start %v", tt.raw, link, tt.video, tt.playlist, tt.startAt)
+			}
+		})
+	}
+}
+
+// errAny marks test cases expecting an error other than ErrNotYouTubeURL
+var errAny = errors.New("any error")
+
+func TestLinkCanonicalURLs(t *testing.T) {
+	link, err := ParseURL("https://youtu.be/dQw4w9WgXcQ?t=42&si=tracking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := link.WatchURL(), "https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=42"; got != want {
+		t.Errorf("WatchURL = %q, want %q", got, want)
+	}
+
+	link, err = ParseURL("https://music.youtube.com/playlist?list=OLAK5uy_abc&feature=share")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := link.PlaylistURL(), "https://www.youtube.com/playlist?list=OLAK5uy_abc"; got != want {
+		t.Errorf("PlaylistURL = %q, want %q", got, want)
+	}
+}
@@ -1,18 +1,59 @@
 package youtube
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	neturl "net/url"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/GrainedLotus515/gobard/internal/logger"
 	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/GrainedLotus515/gobard/internal/tools"
 )
 
+// Extraction errors returned by Client methods; check them with errors.Is
+// They live in tools so the streaming encoder's yt-dlp fallback can return them too
+var (
+	ErrVideoUnavailable = tools.ErrVideoUnavailable
+	ErrPrivateVideo     = tools.ErrPrivateVideo
+	ErrGeoBlocked       = tools.ErrGeoBlocked
+	ErrAgeRestricted    = tools.ErrAgeRestricted
+	ErrCopyright        = tools.ErrCopyright
+	ErrBotCheck         = tools.ErrBotCheck
+	ErrNetwork          = tools.ErrNetwork
+	ErrRateLimited      = tools.ErrRateLimited
+	ErrLiveEnded        = tools.ErrLiveEnded
+)
+
+// SearchProvider is where searches look for videos
+type SearchProvider string
+
+const (
+	// SearchYouTube searches all of YouTube
+	SearchYouTube SearchProvider = "youtube"
+	// SearchYouTubeMusic searches YouTube Music, whose results are songs rather than music
+	// videos with intros and skits; searches with no results there fall back to SearchYouTube
+	SearchYouTubeMusic SearchProvider = "youtube_music"
+)
+
+// prefix is yt-dlp's --default-search prefix for the provider
+func (p SearchProvider) prefix() string {
+	if p == SearchYouTubeMusic {
+		return "ytmsearch"
+	}
+	return "ytsearch"
+}
+
 // Client handles YouTube operations
 type Client struct {
 	apiKey string
@@ -27,14 +68,44 @@ func NewClient(apiKey string) *Client {
 
 // SearchResult represents a YouTube search result from yt-dlp
 type SearchResult struct {
-	ID        string   `json:"id"`
-	Title     string   `json:"title"`
-	Duration  float64  `json:"duration"`
-	Thumbnail string   `json:"thumbnail"`
-	Uploader  string   `json:"uploader"`
-	URL       string   `json:"webpage_url"`
-	IsLive    bool     `json:"is_live"`
-	Formats   []Format `json:"formats"`
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Duration    float64   `json:"duration"`
+	Thumbnail   string    `json:"thumbnail"`
+	Uploader    string    `json:"uploader"`
+	Description string    `json:"description"`
+	URL         string    `json:"webpage_url"`
+	IsLive      bool      `json:"is_live"`
+	ViewCount   int64     `json:"view_count"`
+	Formats     []Format  `json:"formats"`
+	Chapters    []Chapter `json:"chapters"`
+
+	// Set on flat playlist entries, which may also lack Thumbnail
+	PlaylistID       string      `json:"playlist_id"`
+	PlaylistTitle    string      `json:"playlist_title"`
+	PlaylistUploader string      `json:"playlist_uploader"`
+	PlaylistCount    int         `json:"playlist_count"` // Size of the whole playlist
+	Thumbnails       []Thumbnail `json:"thumbnails"`
+}
+
+// Thumbnail is one of a video's thumbnail sizes
+type Thumbnail struct {
+	URL string `json:"url"`
+}
+
+// thumbnail returns the result's thumbnail, falling back to the last (largest) listed size
+func (r SearchResult) thumbnail() string {
+	if r.Thumbnail != "" || len(r.Thumbnails) == 0 {
+		return r.Thumbnail
+	}
+	return r.Thumbnails[len(r.Thumbnails)-1].URL
+}
+
+// Chapter represents a chapter marker in a video
+type Chapter struct {
+	Title     string  `json:"title"`
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
 }
 
 // Format represents an available format
@@ -45,6 +116,20 @@ type Format struct {
 	AudioCodec string  `json:"acodec"`
 	VideoCodec string  `json:"vcodec"`
 	ABR        float64 `json:"abr"` // Audio bitrate in kbps
+	Protocol   string  `json:"protocol"`
+	Height     int     `json:"height"`
+}
+
+// convertChapters converts yt-dlp chapter markers to track chapters
+func convertChapters(chapters []Chapter) []player.Chapter {
+	result := make([]player.Chapter, 0, len(chapters))
+	for _, ch := range chapters {
+		result = append(result, player.Chapter{
+			Title: ch.Title,
+			Start: time.Duration(ch.StartTime * float64(time.Second)),
+		})
+	}
+	return result
 }
 
 // extractBestAudioURL finds the best audio-only URL from formats
@@ -79,135 +164,328 @@ func extractBestAudioURL(formats []Format) string {
 	return bestURL
 }
 
-// Search searches for videos and returns track information
-func (c *Client) Search(query string) ([]*player.Track, error) {
+// extractLiveAudioURL picks the HLS manifest to play a livestream from
+// Audio-only manifests are preferred; YouTube usually only offers muxed ones for live
+// video, so the best of those up to 360p keeps the bandwidth down
+func extractLiveAudioURL(formats []Format) string {
+	var audioOnly, muxed, other Format
+	for _, f := range formats {
+		if f.AudioCodec == "none" || f.URL == "" || !strings.HasPrefix(f.Protocol, "m3u8") {
+			continue
+		}
+		switch {
+		case f.VideoCodec == "none":
+			if f.ABR >= audioOnly.ABR {
+				audioOnly = f
+			}
+		case f.Height <= 360:
+			if f.Height >= muxed.Height {
+				muxed = f
+			}
+		default:
+			if other.URL == "" || f.Height < other.Height {
+				other = f
+			}
+		}
+	}
+
+	for _, f := range []Format{audioOnly, muxed, other} {
+		if f.URL != "" {
+			return f.URL
+		}
+	}
+	// Not HLS after all; use whatever regular format has audio
+	return extractBestAudioURL(formats)
+}
+
+// streamURLFor picks the URL FFmpeg should stream a video from
+func streamURLFor(result SearchResult) string {
+	if result.IsLive {
+		return extractLiveAudioURL(result.Formats)
+	}
+	return extractBestAudioURL(result.Formats)
+}
+
+// Search searches YouTube and returns up to limit tracks, best match first
+// Results go through the ResultFilter set with SetResultFilter
+func (c *Client) Search(ctx context.Context, query string, limit int, provider SearchProvider) ([]*player.Track, error) {
+	// A few extra results give the filter something to pick instead of a junk upload
+	results, proxy, err := search(ctx, query, max(limit, 1)+filterSpare, provider)
+	if err != nil {
+		return nil, err
+	}
+	results = filter.Load().Apply(results, query, 0)
+	results = results[:min(len(results), max(limit, 1))]
+
+	tracks := make([]*player.Track, 0, len(results))
+	for _, result := range results {
+		track := trackFromResult(result)
+		track.StreamProxy = proxy
+		tracks = append(tracks, track)
+	}
+	return tracks, nil
+}
+
+// search runs a yt-dlp search for up to limit results, leaving out those without audio,
+// and returns them with the proxy they were fetched through
+// A YouTube Music search that fails or finds nothing is run again on YouTube, unless ctx ended
+func search(ctx context.Context, query string, limit int, provider SearchProvider) ([]SearchResult, string, error) {
+	results, proxy, err := searchWith(ctx, query, limit, provider)
+	if provider == SearchYouTubeMusic && ctx.Err() == nil && (err != nil || len(results) == 0) {
+		logger.Debug("No YouTube Music results, searching YouTube", "query", query, "err", err)
+		return searchWith(ctx, query, limit, SearchYouTube)
+	}
+	return results, proxy, err
+}
+
+// searchWith runs a search with one provider
+func searchWith(ctx context.Context, query string, limit int, provider SearchProvider) ([]SearchResult, string, error) {
 	start := time.Now()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if limit < 1 {
+		limit = 1
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx,
-		"yt-dlp",
+	output, proxy, err := runYtDlp(ctx, query,
 		"--dump-json",
 		"--no-playlist",
 		"--no-warnings",
-		"--default-search", "ytsearch1",
-		query,
+		"--default-search", fmt.Sprintf("%s%d", provider.prefix(), limit),
 	)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, "", fmt.Errorf("search timed out after 30 seconds")
+		}
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		return nil, "", tools.YtDlpError(fmt.Errorf("failed to search YouTube: %w", err), nil)
+	}
 
-	output, err := cmd.Output()
+	results, err := parseSearchResults(output)
 	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return nil, fmt.Errorf("search timed out after 30 seconds")
+		return nil, "", err
+	}
+
+	playable := make([]SearchResult, 0, len(results))
+	for _, result := range results {
+		if !hasAudio(result.Formats) {
+			logger.Debug("Skipping search result without audio", "id", result.ID, "title", result.Title)
+			continue
 		}
-		return nil, fmt.Errorf("failed to search YouTube: %w", err)
+		// YouTube Music results link to music.youtube.com; tracks keep the regular watch URL,
+		// which caching and stream extraction are keyed on
+		if provider == SearchYouTubeMusic && result.ID != "" {
+			result.URL = "https://www.youtube.com/watch?v=" + result.ID
+		}
+		playable = append(playable, result)
 	}
 
-	var result SearchResult
-	if err := json.Unmarshal(output, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse search result: %w", err)
+	logger.Timing("YouTube search completed", "query", query, "provider", string(provider), "limit", limit, "results", len(playable), "duration_ms", time.Since(start).Milliseconds())
+	return playable, proxy, nil
+}
+
+// SearchFirst searches YouTube and returns only the best match
+func (c *Client) SearchFirst(ctx context.Context, query string, provider SearchProvider) (*player.Track, error) {
+	tracks, err := c.Search(ctx, query, 1, provider)
+	if err != nil {
+		return nil, err
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("no results for %q", query)
+	}
+	return tracks[0], nil
+}
+
+// parseSearchResults decodes yt-dlp's output, one JSON object per result
+func parseSearchResults(output []byte) ([]SearchResult, error) {
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	results := make([]SearchResult, 0)
+
+	for {
+		var result SearchResult
+		err := decoder.Decode(&result)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse search result: %w", err)
+		}
+		results = append(results, result)
 	}
 
-	streamURL := extractBestAudioURL(result.Formats)
-	logger.Timing("YouTube search completed", "query", query, "duration_ms", time.Since(start).Milliseconds(), "has_stream_url", streamURL != "")
+	return results, nil
+}
 
-	track := &player.Track{
+// hasAudio reports whether any format carries an audio stream
+func hasAudio(formats []Format) bool {
+	for _, f := range formats {
+		if f.AudioCodec != "none" && f.AudioCodec != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// trackFromResult converts a full yt-dlp result into a track with its best stream URL
+func trackFromResult(result SearchResult) *player.Track {
+	title, artist := player.NormalizeTitle(result.Title, result.Uploader)
+	return &player.Track{
 		ID:        result.ID,
-		Title:     result.Title,
-		Artist:    result.Uploader,
+		Title:     title,
+		RawTitle:  result.Title,
+		Artist:    artist,
 		URL:       result.URL,
 		Duration:  time.Duration(result.Duration) * time.Second,
 		Source:    player.SourceYouTube,
-		Thumbnail: result.Thumbnail,
+		Thumbnail: result.thumbnail(),
 		IsLive:    result.IsLive,
-		StreamURL: streamURL,
+		ViewCount: result.ViewCount,
+		StreamURL: streamURLFor(result),
+		Chapters:  convertChapters(result.Chapters),
 	}
-
-	return []*player.Track{track}, nil
 }
 
 // GetVideoInfo gets information about a YouTube video
-func (c *Client) GetVideoInfo(url string) (*player.Track, error) {
+func (c *Client) GetVideoInfo(ctx context.Context, url string) (*player.Track, error) {
 	start := time.Now()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx,
-		"yt-dlp",
-		"--dump-json",
-		"--no-playlist",
-		"--no-warnings",
-		url,
-	)
-
-	output, err := cmd.Output()
+	info, err := fetchVideoInfo(ctx, url)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			return nil, fmt.Errorf("video info fetch timed out after 30 seconds")
 		}
-		return nil, fmt.Errorf("failed to get video info: %w", err)
+		return nil, err
 	}
 
-	var result SearchResult
-	if err := json.Unmarshal(output, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse video info: %w", err)
-	}
-
-	streamURL := extractBestAudioURL(result.Formats)
-	logger.Timing("Video info fetch completed", "url", url, "duration_ms", time.Since(start).Milliseconds(), "has_stream_url", streamURL != "")
+	track := trackFromResult(info.result)
+	track.StreamProxy = info.proxy
+	logger.Timing("Video info fetch completed", "url", url, "duration_ms", time.Since(start).Milliseconds(), "has_stream_url", track.StreamURL != "")
 
-	track := &player.Track{
-		ID:        result.ID,
-		Title:     result.Title,
-		Artist:    result.Uploader,
-		URL:       result.URL,
-		Duration:  time.Duration(result.Duration) * time.Second,
-		Source:    player.SourceYouTube,
-		Thumbnail: result.Thumbnail,
-		IsLive:    result.IsLive,
-		StreamURL: streamURL,
+	// Honor a t=/start= timestamp in the URL, as the YouTube website does
+	if startAt, ok := ParseStartTime(url); ok {
+		if track.IsLive || (track.Duration > 0 && startAt >= track.Duration) {
+			logger.Debug("Ignoring out-of-range start timestamp", "url", url, "start_at", startAt, "duration", track.Duration)
+		} else {
+			track.StartAt = startAt
+		}
 	}
 
 	return track, nil
 }
 
-// GetPlaylistInfo gets information about a YouTube playlist
-func (c *Client) GetPlaylistInfo(url string) ([]*player.Track, error) {
+// PlaylistOptions selects the part of a playlist to import
+type PlaylistOptions struct {
+	Offset int // Entries to skip from the start of the playlist
+	Limit  int // Maximum tracks to import (0 for all)
+
+	// Progress, if set, is called as tracks are resolved; total is 0 while unknown
+	Progress func(resolved, total int)
+}
+
+// mixTitle names YouTube Mixes, whose generated titles change from fetch to fetch
+const mixTitle = "YouTube Mix"
+
+// Playlist is the imported part of a playlist
+type Playlist struct {
+	Title      string // Empty if unknown
+	Uploader   string // Channel that owns the playlist, empty if unknown
+	Tracks     []*player.Track
+	Total      int // Entries in the whole playlist, 0 if unknown
+	NextOffset int // Offset that continues the import, 0 if nothing is left
+	Skipped    int // Private or deleted entries left out
+	Failed     int // Entries that couldn't be read or resolved
+	TooLong    int // Entries over the server's track length limit
+	Live       int // Livestreams, when they aren't allowed
+	Blocked    int // Entries on the server's or the bot's blocklist
+
+	// Missing names entries left out for reasons worth showing, like podcast episodes in a
+	// Spotify playlist
+	Missing []string
+}
+
+// GetPlaylistInfo gets information about part of a YouTube playlist
+// Private and deleted entries are skipped and don't count toward the limit
+func (c *Client) GetPlaylistInfo(ctx context.Context, url string, opts PlaylistOptions) (*Playlist, error) {
 	start := time.Now()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx,
-		"yt-dlp",
+	args := []string{
 		"--dump-json",
 		"--flat-playlist",
 		"--no-warnings",
-		url,
-	)
+		"--playlist-start", strconv.Itoa(opts.Offset + 1),
+	}
+	if opts.Limit > 0 {
+		// Fetch a few extra entries so unavailable ones don't leave the page short
+		end := opts.Offset + opts.Limit + opts.Limit/10 + 5
+		args = append(args, "--playlist-end", strconv.Itoa(end))
+	}
 
-	output, err := cmd.Output()
+	release, err := tools.AcquireYtDlp(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("playlist fetch timed out after 60 seconds")
+	}
 	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return nil, fmt.Errorf("playlist fetch timed out after 60 seconds")
-		}
-		return nil, fmt.Errorf("failed to get playlist info: %w", err)
+		return nil, err
 	}
+	defer release()
 
-	// yt-dlp outputs one JSON object per line for playlists
-	lines := strings.Split(string(output), "\n")
-	tracks := make([]*player.Track, 0)
+	proxy := tools.Proxies.Next()
+	cmd := exec.CommandContext(ctx, tools.YtDlp, tools.YtDlpArgs(proxy, url, args...)...)
 
-	for _, line := range lines {
-		if line == "" {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start yt-dlp: %w", err)
+	}
+
+	// yt-dlp outputs one JSON object per line for playlists, page by page, so entries
+	// are read as they arrive to report progress
+	playlist := &Playlist{Tracks: make([]*player.Track, 0)}
+	consumed := opts.Offset
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		// Keep draining past the limit so yt-dlp can exit
+		if len(line) == 0 || (opts.Limit > 0 && len(playlist.Tracks) == opts.Limit) {
 			continue
 		}
+		consumed++
 
 		var result SearchResult
-		if err := json.Unmarshal([]byte(line), &result); err != nil {
+		if err := json.Unmarshal(line, &result); err != nil {
+			playlist.Failed++
 			continue // Skip malformed entries
 		}
+		if result.PlaylistCount > 0 {
+			playlist.Total = result.PlaylistCount
+		}
+		if playlist.Title == "" {
+			playlist.Title = result.PlaylistTitle
+			playlist.Uploader = result.PlaylistUploader
+			if strings.HasPrefix(result.PlaylistID, "RD") {
+				playlist.Title = mixTitle
+			}
+		}
+		if isUnavailableEntry(result) {
+			playlist.Skipped++
+			continue
+		}
 
 		// Build video URL from ID if not provided
 		videoURL := result.URL
@@ -215,147 +493,342 @@ func (c *Client) GetPlaylistInfo(url string) ([]*player.Track, error) {
 			videoURL = fmt.Sprintf("https://www.youtube.com/watch?v=%s", result.ID)
 		}
 
+		title, artist := player.NormalizeTitle(result.Title, result.Uploader)
 		track := &player.Track{
 			ID:        result.ID,
-			Title:     result.Title,
-			Artist:    result.Uploader,
+			Title:     title,
+			RawTitle:  result.Title,
+			Artist:    artist,
 			URL:       videoURL,
 			Duration:  time.Duration(result.Duration) * time.Second,
 			Source:    player.SourceYouTube,
-			Thumbnail: result.Thumbnail,
+			Thumbnail: result.thumbnail(),
 			IsLive:    result.IsLive,
+			ViewCount: result.ViewCount,
+			Partial:   true,
 		}
 
-		tracks = append(tracks, track)
+		playlist.Tracks = append(playlist.Tracks, track)
+		if opts.Progress != nil {
+			opts.Progress(len(playlist.Tracks), playlist.expected(opts))
+		}
 	}
 
-	logger.Timing("Playlist fetch completed", "url", url, "track_count", len(tracks), "duration_ms", time.Since(start).Milliseconds())
+	// A scan error stops the loop early; drain the rest so Wait doesn't block on yt-dlp
+	scanErr := scanner.Err()
+	io.Copy(io.Discard, stdout)
+
+	err = cmd.Wait()
+	if err == nil {
+		err = scanErr
+	}
+	tools.Proxies.ReportRun(ctx, proxy, err, stderr.Bytes())
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("playlist fetch timed out after 60 seconds")
+		}
+		return nil, tools.YtDlpError(fmt.Errorf("failed to get playlist info: %w", err), stderr.Bytes())
+	}
 
-	// Pre-fetch stream URLs for first 3 tracks in parallel
-	if len(tracks) > 0 {
-		c.prefetchStreamURLs(tracks, 3)
+	if consumed < playlist.Total {
+		playlist.NextOffset = consumed
 	}
 
-	return tracks, nil
+	logger.Timing("Playlist fetch completed", "url", url, "title", playlist.Title, "track_count", len(playlist.Tracks), "skipped", playlist.Skipped, "failed", playlist.Failed, "total", playlist.Total, "duration_ms", time.Since(start).Milliseconds())
+
+	return playlist, nil
 }
 
-// prefetchStreamURLs fetches stream URLs for the first N tracks in parallel
-func (c *Client) prefetchStreamURLs(tracks []*player.Track, count int) {
-	if count > len(tracks) {
-		count = len(tracks)
+// expected returns how many tracks the import should end with, or 0 while the playlist size is unknown
+func (p *Playlist) expected(opts PlaylistOptions) int {
+	if p.Total == 0 {
+		return 0
+	}
+	remaining := max(p.Total-opts.Offset-p.Skipped-p.Failed, 0)
+	if opts.Limit > 0 {
+		return min(remaining, opts.Limit)
 	}
+	return remaining
+}
+
+// isUnavailableEntry reports whether a flat playlist entry is a private or deleted video
+func isUnavailableEntry(result SearchResult) bool {
+	if result.Duration > 0 {
+		return false
+	}
+	switch result.Title {
+	case "", "[Private video]", "[Deleted video]":
+		return true
+	}
+	return false
+}
 
+// ResolveTrack fetches full info for a flat playlist track and returns a filled-in copy
+// The original is left untouched, so it can stay in a queue while this runs
+func (c *Client) ResolveTrack(ctx context.Context, track *player.Track) (*player.Track, error) {
 	start := time.Now()
-	var wg sync.WaitGroup
-	var successCount int
-	var mu sync.Mutex
-
-	for i := 0; i < count; i++ {
-		wg.Add(1)
-		go func(track *player.Track, index int) {
-			defer wg.Done()
-
-			// Skip if already has stream URL or is live
-			if track.StreamURL != "" || track.IsLive || track.URL == "" {
-				return
-			}
 
-			// Fetch full video info to get stream URL (10 second timeout)
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-
-			cmd := exec.CommandContext(ctx,
-				"yt-dlp",
-				"--dump-json",
-				"--no-playlist",
-				"--no-warnings",
-				track.URL,
-			)
-
-			output, err := cmd.Output()
-			if err != nil {
-				logger.Debug("Prefetch failed for track", "index", index, "title", track.Title, "err", err)
-				return // Silently fail, will be fetched later
-			}
+	resolved := *track
+	if err := fillTrack(ctx, &resolved); err != nil {
+		return nil, err
+	}
 
-			var result SearchResult
-			if err := json.Unmarshal(output, &result); err != nil {
-				return
-			}
+	logger.Timing("Track resolution completed", "title", resolved.Title, "duration_ms", time.Since(start).Milliseconds())
+	return &resolved, nil
+}
 
-			track.StreamURL = extractBestAudioURL(result.Formats)
-			// Also update title if it was missing from flat playlist
-			if track.Title == "" && result.Title != "" {
-				track.Title = result.Title
-			}
-			if track.Artist == "" && result.Uploader != "" {
-				track.Artist = result.Uploader
-			}
+// fillTrack fetches full video info and fills in what a flat playlist entry lacks
+func fillTrack(ctx context.Context, track *player.Track) error {
+	info, err := fetchVideoInfo(ctx, track.URL)
+	if err != nil {
+		return err
+	}
 
-			mu.Lock()
-			successCount++
-			mu.Unlock()
-		}(tracks[i], i)
+	result := info.result
+	track.StreamURL = streamURLFor(result)
+	track.StreamProxy = info.proxy
+	track.Chapters = convertChapters(result.Chapters)
+	track.IsLive = result.IsLive
+	track.Partial = false
+
+	// Flat playlist entries may lack these
+	title, artist := player.NormalizeTitle(result.Title, result.Uploader)
+	if track.Title == "" && title != "" {
+		track.Title, track.RawTitle = title, result.Title
+	}
+	if track.Artist == "" && artist != "" {
+		track.Artist = artist
+	}
+	if track.Duration == 0 && result.Duration > 0 {
+		track.Duration = time.Duration(result.Duration) * time.Second
 	}
+	if track.Thumbnail == "" && result.thumbnail() != "" {
+		track.Thumbnail = result.thumbnail()
+	}
+
+	return nil
+}
+
+// downloadAttempts is how many times Download runs yt-dlp before giving up
+const downloadAttempts = 4
+
+// downloadBackoff is the wait before the first retry, doubled for each one after
+var downloadBackoff = 2 * time.Second
+
+// DownloadError is returned by Download once a video can't be downloaded, either
+// because every attempt failed or because the failure can't be fixed by retrying
+type DownloadError struct {
+	URL      string
+	Attempts int
+	Err      error
+}
+
+func (e *DownloadError) Error() string {
+	return fmt.Sprintf("download failed after %d attempt(s): %v", e.Attempts, e.Err)
+}
 
-	wg.Wait()
-	logger.Timing("Playlist prefetch completed", "requested", count, "success", successCount, "duration_ms", time.Since(start).Milliseconds())
+func (e *DownloadError) Unwrap() error {
+	return e.Err
 }
 
 // Download downloads a video to the cache directory
-func (c *Client) Download(url, outputPath string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+// Failures are retried with exponential backoff, resuming from yt-dlp's partial file
+// Cancelling ctx stops yt-dlp; its partial files are removed on any failure
+func (c *Client) Download(ctx context.Context, url, outputPath string) error {
+	backoff := downloadBackoff
+	for attempt := 1; ; attempt++ {
+		err := downloadOnce(ctx, url, outputPath)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			removePartialDownload(outputPath)
+			return fmt.Errorf("download cancelled: %w", context.Canceled)
+		}
+		if attempt == downloadAttempts || !retryable(err) {
+			removePartialDownload(outputPath)
+			return &DownloadError{URL: url, Attempts: attempt, Err: err}
+		}
+
+		logger.Warn("Download failed, retrying", "url", url, "attempt", attempt, "backoff", backoff, "err", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			removePartialDownload(outputPath)
+			return fmt.Errorf("download cancelled: %w", context.Canceled)
+		}
+		backoff *= 2
+	}
+}
+
+// downloadStarted is printed by yt-dlp once a download's extraction is done and the
+// transfer begins
+const downloadStarted = "gobard:download-started"
+
+// downloadOnce runs a single yt-dlp download, which resumes any partial file left behind
+// It holds a yt-dlp slot only while yt-dlp extracts the video, not for the transfer
+func downloadOnce(ctx context.Context, url, outputPath string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx,
-		"yt-dlp",
+	release, err := tools.AcquireYtDlp(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	proxy := tools.Proxies.Next()
+	cmd := exec.CommandContext(ctx, tools.YtDlp, tools.YtDlpArgs(proxy, url,
 		"-f", "bestaudio[ext=webm]/bestaudio",
 		"--no-post-overwrites",
 		"--no-warnings",
+		"--print", "before_dl:"+downloadStarted,
+		"--no-simulate",
 		"-o", outputPath,
-		url,
-	)
+	)...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start yt-dlp: %w", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if scanner.Text() == downloadStarted {
+			release()
+		}
+	}
+	io.Copy(io.Discard, stdout)
 
-	if err := cmd.Run(); err != nil {
+	err = cmd.Wait()
+	tools.Proxies.ReportRun(ctx, proxy, err, stderr.Bytes())
+	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			return fmt.Errorf("download timed out after 5 minutes")
 		}
-		return fmt.Errorf("failed to download video: %w", err)
+		return tools.YtDlpError(fmt.Errorf("failed to download video: %w", err), stderr.Bytes())
 	}
-
 	return nil
 }
 
+// retryable reports whether a failed download might succeed if tried again
+func retryable(err error) bool {
+	for _, permanent := range []error{ErrVideoUnavailable, ErrPrivateVideo, ErrGeoBlocked, ErrAgeRestricted, ErrCopyright, ErrBotCheck, ErrLiveEnded} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	return true
+}
+
+// removePartialDownload deletes the files yt-dlp leaves behind when interrupted
+func removePartialDownload(outputPath string) {
+	partials, _ := filepath.Glob(outputPath + ".part*")
+	for _, path := range append(partials, outputPath, outputPath+".ytdl") {
+		os.Remove(path)
+	}
+}
+
 // GetStreamURL gets the direct stream URL for a video
 func (c *Client) GetStreamURL(url string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx,
-		"yt-dlp",
-		"-f", "bestaudio",
-		"-g", // Get URL
-		"--no-warnings",
-		url,
-	)
-
-	output, err := cmd.Output()
-	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("stream URL fetch timed out after 30 seconds")
+	streamURL, err := streamLookups.do(ctx, url, func(ctx context.Context) (string, error) {
+		output, _, err := runYtDlp(ctx, url,
+			"-f", "bestaudio",
+			"-g", // Get URL
+			"--no-warnings",
+		)
+		if err != nil {
+			return "", tools.YtDlpError(fmt.Errorf("failed to get stream URL: %w", err), nil)
 		}
-		return "", fmt.Errorf("failed to get stream URL: %w", err)
+		return strings.TrimSpace(string(output)), nil
+	})
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("stream URL fetch timed out after 30 seconds")
 	}
+	return streamURL, err
+}
 
-	return strings.TrimSpace(string(output)), nil
+// videoInfo is the result of a full video info lookup
+type videoInfo struct {
+	result SearchResult
+	proxy  string // Proxy the lookup went through, which the stream URL is tied to
 }
 
-// IsPlaylist checks if a URL is a playlist
-func IsPlaylist(url string) bool {
-	return strings.Contains(url, "playlist") || strings.Contains(url, "list=")
+// Concurrent lookups of the same URL share one yt-dlp process
+var (
+	infoLookups   flightGroup[videoInfo]
+	streamLookups flightGroup[string]
+)
+
+// fetchVideoInfo gets the full yt-dlp info for a video
+func fetchVideoInfo(ctx context.Context, url string) (videoInfo, error) {
+	return infoLookups.do(ctx, url, func(ctx context.Context) (videoInfo, error) {
+		output, proxy, err := runYtDlp(ctx, url,
+			"--dump-json",
+			"--no-playlist",
+			"--no-warnings",
+		)
+		if err != nil {
+			return videoInfo{}, tools.YtDlpError(fmt.Errorf("failed to get video info: %w", err), nil)
+		}
+
+		var result SearchResult
+		if err := json.Unmarshal(output, &result); err != nil {
+			return videoInfo{}, fmt.Errorf("failed to parse video info: %w", err)
+		}
+		return videoInfo{result: result, proxy: proxy}, nil
+	})
+}
+
+// runYtDlp runs yt-dlp once a slot is free and returns its stdout and the proxy it used
+// stderr is kept in the returned *exec.ExitError for error classification
+func runYtDlp(ctx context.Context, target string, args ...string) ([]byte, string, error) {
+	release, err := tools.AcquireYtDlp(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+
+	proxy := tools.Proxies.Next()
+	cmd := exec.CommandContext(ctx, tools.YtDlp, tools.YtDlpArgs(proxy, target, args...)...)
+	output, err := cmd.Output()
+	tools.Proxies.ReportRun(ctx, proxy, err, nil)
+	return output, proxy, err
 }
 
-// IsYouTubeURL checks if a URL is a YouTube URL
-func IsYouTubeURL(url string) bool {
-	return strings.Contains(url, "youtube.com") || strings.Contains(url, "youtu.be")
+// ParseStartTime extracts the t= or start= timestamp from a YouTube URL
+// Supports plain seconds ("213") and unit forms ("3m33s", "1h2m3s")
+func ParseStartTime(rawURL string) (time.Duration, bool) {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return 0, false
+	}
+
+	query := u.Query()
+	value := query.Get("t")
+	if value == "" {
+		value = query.Get("start")
+	}
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return d, true
+	}
+
+	logger.Debug("Ignoring invalid start timestamp", "url", rawURL, "value", value)
+	return 0, false
 }
@@ -0,0 +1,329 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GrainedLotus515/gobard/internal/player"
+	"github.com/GrainedLotus515/gobard/internal/tools"
+)
+
+func TestParseSearchResultsMultipleObjects(t *testing.T) {
+	output := []byte(`{"id":"a","title":"First","view_count":1200,"formats":[{"acodec":"opus","vcodec":"none","url":"u","abr":160}]}
+{"id":"b","title":"Second","formats":[{"acodec":"none","vcodec":"avc1"}]}
+`)
+
+	results, err := parseSearchResults(output)
+	if err != nil {
+		t.Fatalf("parseSearchResults: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if results[0].ID != "a" || results[0].ViewCount != 1200 {
+		t.Errorf("first result = %+v", results[0])
+	}
+	if !hasAudio(results[0].Formats) {
+		t.Error("first result should have audio")
+	}
+	if hasAudio(results[1].Formats) {
+		t.Error("second result has no audio formats")
+	}
+}
+
+func TestParseSearchResultsEmpty(t *testing.T) {
+	results, err := parseSearchResults(nil)
+	if err != nil {
+		t.Fatalf("parseSearchResults: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("got %d results, want 0", len(results))
+	}
+}
+
+func TestParseSearchResultsMalformed(t *testing.T) {
+	if _, err := parseSearchResults([]byte(`{"id":`)); err == nil {
+		t.Error("expected an error for truncated output")
+	}
+}
+
+func TestIsUnavailableEntry(t *testing.T) {
+	tests := []struct {
+		result SearchResult
+		want   bool
+	}{
+		{SearchResult{Title: "[Deleted video]"}, true},
+		{SearchResult{Title: "[Private video]"}, true},
+		{SearchResult{}, true},
+		{SearchResult{Title: "Live radio"}, false},
+		{SearchResult{Title: "[Deleted video]", Duration: 212}, false},
+	}
+
+	for _, tt := range tests {
+		if got := isUnavailableEntry(tt.result); got != tt.want {
+			t.Errorf("isUnavailableEntry(%+v) = %v, want %v", tt.result, got, tt.want)
+		}
+	}
+}
+
+// fakeYtDlp installs a yt-dlp stand-in that prints output for every invocation
+func fakeYtDlp(t *testing.T, output string) {
+	t.Helper()
+	scriptYtDlp(t, "cat <<'EOF'\n"+output+"\nEOF\n")
+}
+
+// TestResolveConcurrentWithQueueSnapshots checks, under -race, that filling in queued
+// tracks never writes to a track that readers may hold
+func TestResolveConcurrentWithQueueSnapshots(t *testing.T) {
+	fakeYtDlp(t, `{"id":"x","title":"Resolved","uploader":"Someone","duration":60,"formats":[{"acodec":"opus","vcodec":"none","url":"https://cdn.example/x","abr":160}]}`)
+
+	queue := player.NewQueue()
+	tracks := make([]*player.Track, 4)
+	for i := range tracks {
+		tracks[i] = &player.Track{URL: "https://www.youtube.com/watch?v=x", Source: player.SourceYouTube, Partial: true}
+		queue.Add(tracks[i])
+	}
+
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for range 2 {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for _, track := range queue.Snapshot().Upcoming {
+					_ = track.Title + track.Artist + track.StreamURL + track.LocalPath
+					_ = track.Duration
+				}
+			}
+		}()
+	}
+
+	// The background resolver's path: resolve a copy and swap it into the queue
+	client := NewClient("")
+	var resolvers sync.WaitGroup
+	for _, track := range queue.Upcoming(len(tracks)) {
+		resolvers.Add(1)
+		go func() {
+			defer resolvers.Done()
+			resolved, err := client.ResolveTrack(context.Background(), track)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			queue.ReplaceUpcoming(track, resolved)
+		}()
+	}
+	resolvers.Wait()
+
+	close(stop)
+	readers.Wait()
+
+	for i, track := range tracks {
+		if track.StreamURL != "" || !track.Partial {
+			t.Errorf("original track %d was modified: %+v", i, track)
+		}
+	}
+	for i, track := range queue.Snapshot().Upcoming {
+		if track.Title != "Resolved" || track.Duration != time.Minute || track.Partial {
+			t.Errorf("queued track %d = %+v", i, track)
+		}
+	}
+}
+
+func TestExtractLiveAudioURL(t *testing.T) {
+	muxed := []Format{
+		{URL: "https://example.com/1080.m3u8", Protocol: "m3u8_native", AudioCodec: "mp4a.40.2", VideoCodec: "avc1", Height: 1080},
+		{URL: "https://example.com/144.m3u8", Protocol: "m3u8_native", AudioCodec: "mp4a.40.2", VideoCodec: "avc1", Height: 144},
+		{URL: "https://example.com/360.m3u8", Protocol: "m3u8_native", AudioCodec: "mp4a.40.2", VideoCodec: "avc1", Height: 360},
+		{URL: "https://example.com/480.m3u8", Protocol: "m3u8_native", AudioCodec: "mp4a.40.2", VideoCodec: "avc1", Height: 480},
+	}
+	if got := extractLiveAudioURL(muxed); got != "https://example.com/360.m3u8" {
+		t.Errorf("muxed formats: got %q, want the 360p manifest", got)
+	}
+
+	withAudio := append(muxed, Format{URL: "https://example.com/audio.m3u8", Protocol: "m3u8", AudioCodec: "mp4a.40.2", VideoCodec: "none", ABR: 128})
+	if got := extractLiveAudioURL(withAudio); got != "https://example.com/audio.m3u8" {
+		t.Errorf("audio-only manifest available: got %q", got)
+	}
+
+	highOnly := muxed[:1]
+	if got := extractLiveAudioURL(highOnly); got != "https://example.com/1080.m3u8" {
+		t.Errorf("only high resolutions: got %q", got)
+	}
+}
+
+func TestGetPlaylistInfoMetadata(t *testing.T) {
+	fakeYtDlp(t, `{"id":"aaaaaaaaaaa","title":"One","duration":60,"playlist_id":"PLx","playlist_title":"Road Trip","playlist_uploader":"Someone","playlist_count":2,"thumbnails":[{"url":"https://i.example/small.jpg"},{"url":"https://i.example/large.jpg"}]}
+{"id":"bbbbbbbbbbb","title":"Two","duration":60,"playlist_id":"PLx","playlist_title":"Road Trip","playlist_uploader":"Someone","playlist_count":2}`)
+
+	playlist, err := NewClient("").GetPlaylistInfo(context.Background(), "https://www.youtube.com/playlist?list=PLx", PlaylistOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playlist.Title != "Road Trip" || playlist.Uploader != "Someone" || playlist.Total != 2 {
+		t.Errorf("playlist = %q by %q with %d tracks", playlist.Title, playlist.Uploader, playlist.Total)
+	}
+	if len(playlist.Tracks) != 2 || playlist.Tracks[0].Thumbnail != "https://i.example/large.jpg" {
+		t.Errorf("tracks = %+v, want the largest listed thumbnail on the first", playlist.Tracks)
+	}
+}
+
+func TestGetPlaylistInfoMixTitle(t *testing.T) {
+	fakeYtDlp(t, `{"id":"aaaaaaaaaaa","title":"One","duration":60,"playlist_id":"RDaaaaaaaaaaa","playlist_title":"Mix - One","playlist_count":1}`)
+
+	playlist, err := NewClient("").GetPlaylistInfo(context.Background(), "https://www.youtube.com/watch?v=aaaaaaaaaaa&list=RDaaaaaaaaaaa", PlaylistOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playlist.Title != "YouTube Mix" {
+		t.Errorf("Title = %q, want the mix fallback", playlist.Title)
+	}
+}
+
+// scriptYtDlp installs a yt-dlp stand-in running the given shell script
+func scriptYtDlp(t *testing.T, script string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "yt-dlp")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := tools.YtDlp
+	tools.YtDlp = path
+	t.Cleanup(func() { tools.YtDlp = previous })
+}
+
+func TestDownloadRetriesTransientFailures(t *testing.T) {
+	defer func(backoff time.Duration) { downloadBackoff = backoff }(downloadBackoff)
+	downloadBackoff = time.Millisecond
+
+	// Fail twice with a network error, then write the -o output file
+	counter := filepath.Join(t.TempDir(), "attempts")
+	scriptYtDlp(t, `echo x >> `+counter+`
+if [ $(wc -l < `+counter+`) -lt 3 ]; then
+	echo "ERROR: Unable to download webpage: The read operation timed out" >&2
+	exit 1
+fi
+while [ "$1" != "-o" ]; do shift; done
+echo audio > "$2"
+`)
+
+	output := filepath.Join(t.TempDir(), "track.webm")
+	if err := NewClient("").Download(context.Background(), "https://www.youtube.com/watch?v=x", output); err != nil {
+		t.Fatalf("Download = %v", err)
+	}
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("output missing: %v", err)
+	}
+}
+
+func TestDownloadStopsOnPermanentFailure(t *testing.T) {
+	defer func(backoff time.Duration) { downloadBackoff = backoff }(downloadBackoff)
+	downloadBackoff = time.Millisecond
+
+	scriptYtDlp(t, `echo "ERROR: [youtube] x: Private video" >&2
+exit 1
+`)
+
+	output := filepath.Join(t.TempDir(), "track.webm")
+	os.WriteFile(output+".part", []byte("partial"), 0o644)
+
+	err := NewClient("").Download(context.Background(), "https://www.youtube.com/watch?v=x", output)
+	var downloadErr *DownloadError
+	if !errors.As(err, &downloadErr) || downloadErr.Attempts != 1 || !errors.Is(err, ErrPrivateVideo) {
+		t.Fatalf("Download = %v, want a DownloadError after one attempt", err)
+	}
+	if _, err := os.Stat(output + ".part"); !os.IsNotExist(err) {
+		t.Error("partial file was left behind")
+	}
+}
+
+func TestDownloadReleasesSlotAfterExtraction(t *testing.T) {
+	defer SetMaxConcurrency(DefaultMaxConcurrency)
+	SetMaxConcurrency(1)
+
+	// Extract, then hold the transfer open until the test lets it finish
+	dir := t.TempDir()
+	started, proceed := filepath.Join(dir, "started"), filepath.Join(dir, "proceed")
+	scriptYtDlp(t, `touch `+started+`
+echo `+downloadStarted+`
+while [ ! -f `+proceed+` ]; do sleep 0.01; done
+while [ "$1" != "-o" ]; do shift; done
+echo audio > "$2"
+`)
+
+	output := filepath.Join(t.TempDir(), "track.webm")
+	done := make(chan error, 1)
+	go func() {
+		done <- NewClient("").Download(context.Background(), "https://www.youtube.com/watch?v=x", output)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, err := os.Stat(started); err != nil; _, err = os.Stat(started) {
+		if time.Now().After(deadline) {
+			t.Fatal("yt-dlp didn't start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The only slot frees up while the transfer is still running
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	release, err := tools.AcquireYtDlp(ctx)
+	if err != nil {
+		t.Fatalf("no slot while a download was transferring: %v", err)
+	}
+	release()
+
+	os.WriteFile(proceed, nil, 0o644)
+	if err := <-done; err != nil {
+		t.Fatalf("Download = %v", err)
+	}
+}
+
+func TestSearchYouTubeMusic(t *testing.T) {
+	// YouTube Music knows "song" but not "skit"; results link to music.youtube.com
+	scriptYtDlp(t, `case "$*" in
+*ytmsearch*song*) echo '{"id":"songsongson","title":"Song","uploader":"Artist","duration":180,"webpage_url":"https://music.youtube.com/watch?v=songsongson","formats":[{"acodec":"opus","vcodec":"none","url":"https://cdn.example/a","abr":160}]}' ;;
+*ytmsearch*broken*) echo 'ERROR: [youtube:music:search_url] Unable to extract' >&2; exit 1 ;;
+*ytmsearch*) ;;
+*ytsearch*) echo '{"id":"skitskitski","title":"Skit","uploader":"Artist","duration":60,"webpage_url":"https://www.youtube.com/watch?v=skitskitski","formats":[{"acodec":"opus","vcodec":"none","url":"https://cdn.example/b","abr":160}]}' ;;
+esac`)
+	client := NewClient("")
+
+	tracks, err := client.Search(context.Background(), "song", 1, SearchYouTubeMusic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 1 || tracks[0].URL != "https://www.youtube.com/watch?v=songsongson" {
+		t.Fatalf("YouTube Music search = %+v, want the song with a regular watch URL", tracks)
+	}
+
+	tracks, err = client.Search(context.Background(), "skit", 1, SearchYouTubeMusic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 1 || tracks[0].ID != "skitskitski" {
+		t.Errorf("YouTube Music search without results = %+v, want YouTube's result", tracks)
+	}
+
+	tracks, err = client.Search(context.Background(), "broken", 1, SearchYouTubeMusic)
+	if err != nil {
+		t.Fatalf("YouTube Music search that failed = %v, want YouTube's result", err)
+	}
+	if len(tracks) != 1 || tracks[0].ID != "skitskitski" {
+		t.Errorf("YouTube Music search that failed = %+v, want YouTube's result", tracks)
+	}
+}